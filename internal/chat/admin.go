@@ -0,0 +1,273 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const maxModesBodySize = 4 * 1024
+
+// ConnectionInfo is an administrative snapshot of a joined connection
+type ConnectionInfo struct {
+	UserID          string   `json:"userId"`
+	Username        string   `json:"username"`
+	StreamKey       string   `json:"streamKey"`
+	Rooms           []string `json:"rooms,omitempty"` // added with join_room
+	RemoteAddr      string   `json:"remoteAddr"`
+	ProtocolVersion int      `json:"protocolVersion"`
+	Queued          int      `json:"queued"` // frames waiting in the send queue
+}
+
+// Connections returns the joined connections, optionally limited to one room
+func (h *WSHandler) Connections(streamKey string) []ConnectionInfo {
+	infos := []ConnectionInfo{}
+	add := func(conn *Connection) {
+		infos = append(infos, ConnectionInfo{
+			UserID:          conn.UserID,
+			Username:        conn.Username,
+			StreamKey:       conn.StreamKey,
+			Rooms:           conn.joinedRooms(),
+			RemoteAddr:      conn.RemoteAddr,
+			ProtocolVersion: int(conn.protocolVersion.Load()),
+			Queued:          len(conn.Send),
+		})
+	}
+	if streamKey == "" {
+		h.eachConnection(add)
+	} else {
+		for _, conn := range h.roomConnections(streamKey) {
+			add(conn)
+		}
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].UserID < infos[j].UserID })
+	return infos
+}
+
+// ClearRoom removes a room's buffered messages and tells its clients to clear their view
+func (h *WSHandler) ClearRoom(streamKey string) (int, error) {
+	removed, err := h.manager.ClearRoom(streamKey)
+	if err != nil {
+		return 0, err
+	}
+
+	h.broadcast(streamKey, WSMessage{
+		Type:      "chat_cleared",
+		Timestamp: time.Now(),
+	}, "")
+	return removed, nil
+}
+
+// RevokeSessionsHandler serves POST /api/chat/admin/users/{userID}/revoke,
+// invalidating a user's credentials and disconnecting them everywhere
+func (h *WSHandler) RevokeSessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.PathValue("userID")
+	if userID == "" {
+		http.Error(w, "Missing userID", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.RevokeSessions(userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"userId":  userID,
+		"revoked": true,
+	})
+}
+
+// TraceHandler serves /api/chat/admin/trace/{userID}, the per-user message trace:
+//
+//	POST   ?minutes=N  start tracing the user (default 15 minutes)
+//	GET                read the buffered trace events
+//	DELETE             stop tracing and discard the events
+func (h *WSHandler) TraceHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userID")
+	if userID == "" {
+		http.Error(w, "Missing userID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		duration := defaultTraceDuration
+		if val := r.URL.Query().Get("minutes"); val != "" {
+			minutes, err := strconv.Atoi(val)
+			if err != nil || minutes <= 0 {
+				http.Error(w, "Invalid minutes", http.StatusBadRequest)
+				return
+			}
+			duration = time.Duration(min(minutes, int(maxTraceDuration/time.Minute))) * time.Minute
+		}
+
+		expiresAt := h.tracer.Enable(userID, duration)
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"userId":    userID,
+			"expiresAt": expiresAt,
+		})
+
+	case http.MethodGet:
+		events, expiresAt, exists := h.tracer.Events(userID)
+		if !exists {
+			http.Error(w, "User is not being traced", http.StatusNotFound)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"userId":    userID,
+			"expiresAt": expiresAt,
+			"events":    events,
+		})
+
+	case http.MethodDelete:
+		h.tracer.Disable(userID)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RoomsHandler serves GET /api/chat/admin/rooms, listing every room with its stats
+func (h *WSHandler) RoomsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	connections := map[string]int{}
+	for _, conn := range h.Connections("") {
+		connections[conn.StreamKey]++
+		for _, room := range conn.Rooms {
+			connections[room]++
+		}
+	}
+
+	type roomInfo struct {
+		RoomSummary
+		Connections int `json:"connections"`
+	}
+
+	rooms := []roomInfo{}
+	for _, summary := range h.manager.RoomSummaries() {
+		rooms = append(rooms, roomInfo{RoomSummary: summary, Connections: connections[summary.StreamKey]})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"rooms": rooms,
+	})
+}
+
+// ConnectionsHandler serves GET /api/chat/admin/connections?streamKey=, listing
+// joined connections on this instance
+func (h *WSHandler) ConnectionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"connections": h.Connections(r.URL.Query().Get("streamKey")),
+	})
+}
+
+// DisconnectHandler serves POST /api/chat/admin/users/{userID}/disconnect, closing
+// a user's connections on this instance without revoking their credentials
+func (h *WSHandler) DisconnectHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.PathValue("userID")
+	if userID == "" {
+		http.Error(w, "Missing userID", http.StatusBadRequest)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"userId": userID,
+		"closed": h.closeUserConnections(userID, "disconnected by an administrator"),
+	})
+}
+
+// ClearRoomHandler serves POST /api/chat/admin/rooms/{streamKey}/clear
+func (h *WSHandler) ClearRoomHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	removed, err := h.ClearRoom(streamKey)
+	if err != nil {
+		writeChatError(w, http.StatusNotFound, ErrRoomNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"streamKey": streamKey,
+		"removed":   removed,
+	})
+}
+
+// RoomModesHandler serves /api/chat/admin/rooms/{streamKey}/modes:
+//
+//	GET  read the room's modes
+//	PUT  replace the room's modes with the RoomModes in the body
+func (h *WSHandler) RoomModesHandler(w http.ResponseWriter, r *http.Request) {
+	room, exists := h.manager.GetRoom(r.PathValue("streamKey"))
+	if !exists {
+		writeChatError(w, http.StatusNotFound, ErrRoomNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, room.Modes())
+
+	case http.MethodPut:
+		var modes RoomModes
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxModesBodySize)).Decode(&modes); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		if err := h.SetRoomModes(room.StreamKey, modes); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusOK, modes)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RateLimitHandler serves GET /api/chat/admin/ratelimit/{userID}, reading a
+// user's rate limiter state
+func (h *WSHandler) RateLimitHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.PathValue("userID")
+	state, exists := h.rateLimiter.State(userID)
+	if !exists {
+		http.Error(w, "No rate limiter record for user", http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, state)
+}
@@ -0,0 +1,164 @@
+package chat
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+// maxArchiveAttempts is how many passes try to upload a session's log before it is
+// given up on, so an unreachable bucket can't hold finished rooms in memory forever
+const maxArchiveAttempts = 5
+
+// ArchiveUploader stores a finished session's compressed chat log under key
+type ArchiveUploader interface {
+	Upload(key string, body []byte) error
+}
+
+// chatArchiver collects the rooms of finished stream sessions until the next
+// archive pass uploads their messages
+type chatArchiver struct {
+	uploader ArchiveUploader
+	prefix   string
+
+	mu       sync.Mutex
+	finished []archiveJob // rooms deleted for inactivity since the last pass, or whose upload failed
+}
+
+// archiveJob is a finished room waiting for its log to be uploaded
+type archiveJob struct {
+	room     *ChatRoom
+	attempts int // failed uploads so far
+}
+
+// newChatArchiver creates an archiver uploading logs under prefix
+func newChatArchiver(uploader ArchiveUploader, prefix string) *chatArchiver {
+	return &chatArchiver{uploader: uploader, prefix: prefix}
+}
+
+// newConfiguredArchiver creates the archiver the config asks for, or returns nil
+// when archival is off or misconfigured
+func newConfiguredArchiver(config *ChatConfig) *chatArchiver {
+	if config.ArchiveS3Endpoint == "" {
+		return nil
+	}
+
+	uploader, err := NewS3Uploader(config.ArchiveS3Endpoint, config.ArchiveS3Bucket, config.ArchiveS3Region, config.ArchiveS3AccessKey, config.ArchiveS3SecretKey)
+	if err != nil {
+		log.Printf("Chat archival disabled: %v", err)
+		return nil
+	}
+	return newChatArchiver(uploader, config.ArchivePrefix)
+}
+
+// finish queues a room whose stream session ended for the next pass
+func (a *chatArchiver) finish(room *ChatRoom) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.finished = append(a.finished, archiveJob{room: room})
+}
+
+// retry queues a room whose upload failed for the next pass
+func (a *chatArchiver) retry(job archiveJob) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.finished = append(a.finished, job)
+}
+
+// take returns the queued rooms, emptying the queue
+func (a *chatArchiver) take() []archiveJob {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	jobs := a.finished
+	a.finished = nil
+	return jobs
+}
+
+// archiveKey is where a session's log is stored: one object per session under its
+// stream key, named for when the session started
+func (a *chatArchiver) archiveKey(room *ChatRoom) string {
+	startedAt, _ := room.session()
+	return a.prefix + room.StreamKey + "/" + startedAt.UTC().Format("20060102T150405Z") + ".ndjson.gz"
+}
+
+// encodeArchive writes messages as gzipped newline-delimited JSON
+func encodeArchive(messages []ChatMessage) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	encoder := json.NewEncoder(zw)
+	for _, msg := range messages {
+		if err := encoder.Encode(msg); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// archiveFinished uploads the logs of finished sessions and trims their messages
+// from memory. Rooms restored since, because their stream came back, are left
+// alone; they are queued again when they next go inactive. A failed upload is
+// retried on the next pass, up to maxArchiveAttempts passes, after which the
+// session's log is dropped. Returns how many sessions were archived.
+func (m *Manager) archiveFinished() int {
+	archived := 0
+	for _, job := range m.archiver.take() {
+		room := job.room
+		if live, exists := m.GetRoom(room.StreamKey); exists && live == room {
+			continue
+		}
+
+		messages := room.GetMessages(0)
+		if len(messages) == 0 {
+			continue
+		}
+		body, err := encodeArchive(messages)
+		if err != nil {
+			log.Printf("Failed to encode chat archive for %s: %v", room.StreamKey, err)
+			continue
+		}
+
+		key := m.archiver.archiveKey(room)
+		if err := m.archiver.uploader.Upload(key, body); err != nil {
+			job.attempts++
+			if job.attempts >= maxArchiveAttempts {
+				log.Printf("Failed to archive chat for %s after %d attempts, dropping %d messages: %v", room.StreamKey, job.attempts, len(messages), err)
+				continue
+			}
+			log.Printf("Failed to archive chat for %s, retrying next pass: %v", room.StreamKey, err)
+			m.archiver.retry(job)
+			continue
+		}
+
+		room.Trim(0)
+		archived++
+		log.Printf("Archived %d chat messages (%d KB) to %s", len(messages), len(body)/1024, key)
+	}
+	return archived
+}
+
+// archiveWorker archives finished sessions every ArchiveIntervalMinutes until the
+// manager stops
+func (m *Manager) archiveWorker() {
+	defer trackWorker("manager.archive")()
+
+	ticker := time.NewTicker(time.Duration(m.config.ArchiveIntervalMinutes) * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.archiveFinished()
+		case <-m.stopArchive:
+			return
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package chat
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeS3 accepts PUTs, keeping each object's body by path
+type fakeS3 struct {
+	mu      sync.Mutex
+	objects map[string][]byte
+	headers http.Header
+	fail    bool
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, *httptest.Server) {
+	f := &fakeS3{objects: make(map[string][]byte)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+
+		if f.fail {
+			http.Error(w, "<Error>SlowDown</Error>", http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		f.objects[r.URL.EscapedPath()] = body
+		f.headers = r.Header.Clone()
+	}))
+	t.Cleanup(server.Close)
+	return f, server
+}
+
+func (f *fakeS3) setFailing(fail bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.fail = fail
+}
+
+// decodeArchive reads the messages of a gzipped newline-delimited JSON log
+func decodeArchive(t *testing.T, body []byte) []ChatMessage {
+	zr, err := gzip.NewReader(strings.NewReader(string(body)))
+	require.NoError(t, err)
+
+	messages := []ChatMessage{}
+	scanner := bufio.NewScanner(zr)
+	for scanner.Scan() {
+		var msg ChatMessage
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &msg))
+		messages = append(messages, msg)
+	}
+	require.NoError(t, scanner.Err())
+	return messages
+}
+
+func TestArchiveFinishedSessions(t *testing.T) {
+	s3, server := newFakeS3(t)
+	uploader, err := NewS3Uploader(server.URL, "logs", "us-east-1", "access", "secret")
+	require.NoError(t, err)
+
+	config := DefaultConfig()
+	config.InactiveStreamTimeout = 0
+	manager := NewManager(config)
+	defer manager.Stop()
+	manager.archiver = newChatArchiver(uploader, "chat/")
+
+	for _, text := range []string{"one", "two"} {
+		_, err := manager.AddMessage("stream key", "user", "alice", text)
+		require.NoError(t, err)
+	}
+	room, _ := manager.GetRoom("stream key")
+
+	// Live rooms aren't archived
+	require.Zero(t, manager.archiveFinished())
+
+	// A failed upload is retried on the next pass
+	manager.expireRoom("stream key")
+	s3.setFailing(true)
+	require.Zero(t, manager.archiveFinished())
+	require.Equal(t, 2, room.Messages.Size())
+	s3.setFailing(false)
+	require.Equal(t, 1, manager.archiveFinished())
+
+	key := "/logs/chat/stream%20key/" + room.startedAt.UTC().Format("20060102T150405Z") + ".ndjson.gz"
+	require.Contains(t, s3.objects, key)
+	messages := decodeArchive(t, s3.objects[key])
+	require.Equal(t, []string{"one", "two"}, messageTexts(messages))
+
+	require.Equal(t, "gzip", s3.headers.Get("Content-Encoding"))
+	require.Regexp(t, `^AWS4-HMAC-SHA256 Credential=access/\d{8}/us-east-1/s3/aws4_request, SignedHeaders=host;x-amz-content-sha256;x-amz-date, Signature=[0-9a-f]{64}$`, s3.headers.Get("Authorization"))
+
+	// Archived messages are trimmed from memory, and not uploaded again
+	require.Zero(t, room.Messages.Size())
+	require.Zero(t, manager.archiveFinished())
+}
+
+func TestArchiveGivesUpAfterMaxAttempts(t *testing.T) {
+	s3, server := newFakeS3(t)
+	uploader, err := NewS3Uploader(server.URL, "logs", "us-east-1", "access", "secret")
+	require.NoError(t, err)
+
+	config := DefaultConfig()
+	config.InactiveStreamTimeout = 0
+	manager := NewManager(config)
+	defer manager.Stop()
+	manager.archiver = newChatArchiver(uploader, "chat/")
+
+	_, err = manager.AddMessage("room", "user", "alice", "lost")
+	require.NoError(t, err)
+	manager.expireRoom("room")
+
+	s3.setFailing(true)
+	for range maxArchiveAttempts {
+		require.Len(t, manager.archiver.finished, 1)
+		require.Zero(t, manager.archiveFinished())
+	}
+	require.Empty(t, manager.archiver.finished)
+
+	s3.setFailing(false)
+	require.Zero(t, manager.archiveFinished())
+	require.Empty(t, s3.objects)
+}
+
+func TestS3Escape(t *testing.T) {
+	require.Equal(t, "a-b_c.d~e%20f%2Bg%24", s3Escape("a-b_c.d~e f+g$"))
+	require.Equal(t, "chat/room%2A1/log.gz", s3EscapePath("chat/room*1/log.gz"))
+
+	_, err := NewS3Uploader("ftp://example.com", "bucket", "us-east-1", "a", "b")
+	require.Error(t, err)
+	_, err = NewS3Uploader("https://example.com", "", "us-east-1", "a", "b")
+	require.Error(t, err)
+}
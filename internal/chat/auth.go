@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// authenticateTimeout bounds an Authenticator's work for one join, such as a
+// call to an identity provider
+const authenticateTimeout = 10 * time.Second
+
+// Identity is the user an Authenticator resolved a client's credentials to
+type Identity struct {
+	UserID   string
+	Username string // empty if the credentials don't name the user
+	Roles    []string
+	IssuedAt time.Time // when the credentials were issued; zero if unknown, which any recent revocation refuses
+}
+
+// Credentials are what a client presented when it connected, kept until it joins
+type Credentials struct {
+	Token      string      // bearer token: ?access_token= or a bearer.<token> subprotocol, IRC PASS, gRPC authorization
+	Header     http.Header // handshake headers, cookies included; gRPC metadata; nil over IRC
+	RemoteAddr string
+}
+
+// Cookie returns the named cookie the client sent, or http.ErrNoCookie
+func (c Credentials) Cookie(name string) (*http.Cookie, error) {
+	request := http.Request{Header: c.Header}
+	return request.Cookie(name)
+}
+
+// Authenticator resolves who a client is when it joins, so host applications can
+// check OIDC tokens, session cookies or API keys their own way. Authenticate
+// returns an error, or a nil identity, for clients that may not chat.
+type Authenticator interface {
+	Authenticate(ctx context.Context, credentials Credentials) (*Identity, error)
+}
+
+// AuthenticatorFunc adapts a function to an Authenticator
+type AuthenticatorFunc func(ctx context.Context, credentials Credentials) (*Identity, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, credentials Credentials) (*Identity, error) {
+	return f(ctx, credentials)
+}
+
+var errNoIdentity = errors.New("no identity")
+
+// SetAuthenticator makes joins resolve their user through a, replacing any JWT
+// verification from the config. With nil, clients join as whoever they claim to be.
+func (h *WSHandler) SetAuthenticator(a Authenticator) {
+	h.authMux.Lock()
+	defer h.authMux.Unlock()
+	h.authenticator = a
+}
+
+// currentAuthenticator returns the authenticator joins go through, if any
+func (h *WSHandler) currentAuthenticator() Authenticator {
+	h.authMux.RLock()
+	defer h.authMux.RUnlock()
+	return h.authenticator
+}
+
+// resolveIdentity runs credentials through the authenticator, refusing identities
+// whose sessions were revoked after their credentials were issued. It returns a nil
+// identity, and no error, when no authenticator is set.
+func (h *WSHandler) resolveIdentity(credentials Credentials) (*Identity, error) {
+	authenticator := h.currentAuthenticator()
+	if authenticator == nil {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), authenticateTimeout)
+	defer cancel()
+
+	identity, err := authenticator.Authenticate(ctx, credentials)
+	if err == nil && identity == nil {
+		err = errNoIdentity
+	}
+	if err == nil && h.revocations.IsRevoked(identity.UserID, identity.IssuedAt) {
+		err = errors.New("session revoked")
+	}
+	if err != nil {
+		log.Printf("Refusing chat join from %s: %v", credentials.RemoteAddr, err)
+		return nil, ErrUnauthenticated
+	}
+	return identity, nil
+}
+
+// requestCredentials returns the credentials a handshake from the client at
+// remoteAddr carries
+func requestCredentials(r *http.Request, remoteAddr string) Credentials {
+	return Credentials{
+		Token:      requestJWT(r),
+		Header:     r.Header.Clone(),
+		RemoteAddr: remoteAddr,
+	}
+}
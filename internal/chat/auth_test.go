@@ -0,0 +1,49 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionCookieAuthenticator(t *testing.T) {
+	h, server := newTestHandler(t)
+	sessions := map[string]*Identity{"s3cret": {UserID: "alice", Username: "Alice"}}
+	h.SetAuthenticator(AuthenticatorFunc(func(_ context.Context, credentials Credentials) (*Identity, error) {
+		cookie, err := credentials.Cookie("session")
+		if err != nil {
+			return nil, err
+		}
+		if identity, ok := sessions[cookie.Value]; ok {
+			return identity, nil
+		}
+		return nil, errors.New("unknown session")
+	}))
+
+	dial := func(session string) *websocket.Conn {
+		url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?streamKey=room"
+		conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Cookie": {"session=" + session}})
+		require.NoError(t, err)
+		t.Cleanup(func() { conn.Close() })
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "join", "data": map[string]string{"userId": "alice", "username": "alice"}}))
+		return conn
+	}
+
+	require.Equal(t, CodeUnauthenticated, readUntil(t, dial("guessed"), "error")["code"])
+
+	readUntil(t, dial("s3cret"), "room_state")
+	users := h.manager.GetUsers("room")
+	require.Len(t, users, 1)
+	require.Equal(t, "Alice", users[0].Username)
+
+	// Without an authenticator clients are who they say they are
+	h.SetAuthenticator(nil)
+	conn := dialTestClient(t, server, "room")
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "join", "data": map[string]string{"userId": "bob", "username": "bob"}}))
+	readUntil(t, conn, "room_state")
+}
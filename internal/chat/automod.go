@@ -0,0 +1,58 @@
+package chat
+
+import (
+	"strings"
+	"unicode"
+)
+
+// AutoMod filters chat messages against a list of blocked terms
+type AutoMod struct {
+	terms      []string
+	silentDrop bool
+}
+
+// NewAutoMod creates a new automod filter. When silentDrop is set, filtered
+// messages are echoed back to their sender only instead of being rejected.
+func NewAutoMod(terms []string, silentDrop bool) *AutoMod {
+	normalized := make([]string, 0, len(terms))
+	for _, term := range terms {
+		if term = normalizeText(term); term != "" {
+			normalized = append(normalized, term)
+		}
+	}
+
+	return &AutoMod{
+		terms:      normalized,
+		silentDrop: silentDrop,
+	}
+}
+
+// Check returns an error if the message contains a blocked term
+func (am *AutoMod) Check(message string) *ChatError {
+	if len(am.terms) == 0 {
+		return nil
+	}
+
+	// Pad with spaces so terms only match on whole words
+	normalized := " " + normalizeText(message) + " "
+	for _, term := range am.terms {
+		if strings.Contains(normalized, " "+term+" ") {
+			return ErrMessageBlocked
+		}
+	}
+
+	return nil
+}
+
+// SilentDrop reports whether filtered messages should appear to succeed for the sender
+func (am *AutoMod) SilentDrop() bool {
+	return am.silentDrop
+}
+
+// normalizeText lowercases text and collapses punctuation and whitespace into single spaces
+func normalizeText(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	return strings.Join(words, " ")
+}
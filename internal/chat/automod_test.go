@@ -0,0 +1,16 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAutoModMatchesWholeWords(t *testing.T) {
+	am := NewAutoMod([]string{"spam", "Buy Followers"}, false)
+
+	require.Equal(t, ErrMessageBlocked, am.Check("this is SPAM!"))
+	require.Equal(t, ErrMessageBlocked, am.Check("buy   followers now"))
+	require.Nil(t, am.Check("spammer is not a blocked word"))
+	require.Nil(t, am.Check("hello"))
+}
@@ -0,0 +1,192 @@
+package chat
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// backpressureNotice advises a client switched to digests to ease off
+const backpressureNotice = "Chat is busier than your connection can keep up with; messages will arrive in batches."
+
+// digestBuffer holds the chat messages broadcast to a connection in digest mode
+// until the next digest, at most maxBatchSize per room. Typing indicators are
+// dropped while it is active; other frames are delivered as usual.
+type digestBuffer struct {
+	active atomic.Bool
+
+	mu        sync.Mutex
+	notice    *WSMessage                // the backpressure frame opening the episode, until it is queued
+	rooms     []string                  // rooms with held messages, in the order they were first held
+	messages  map[string][]*ChatMessage // room -> held messages, oldest first
+	skipped   int                       // messages dropped because a room's digest was full, this episode
+	lastFlush time.Time
+}
+
+// hold keeps a broadcast for the next digest, reporting false for frames that
+// should be delivered as usual
+func (d *digestBuffer) hold(msg WSMessage) bool {
+	if !d.active.Load() {
+		return false
+	}
+	if msg.Type == "typing" {
+		return true
+	}
+	chatMsg, ok := batchable(msg)
+	if !ok {
+		return false
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.active.Load() {
+		// Stopped meanwhile
+		return false
+	}
+	held, seen := d.messages[msg.Room]
+	if !seen {
+		d.rooms = append(d.rooms, msg.Room)
+	}
+	if len(held) >= maxBatchSize {
+		held = held[1:]
+		d.skipped++
+	}
+	d.messages[msg.Room] = append(held, chatMsg)
+	return true
+}
+
+// start switches the buffer on for a new episode, queueing notice ahead of the
+// first digest
+func (d *digestBuffer) start(notice WSMessage) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.notice = &notice
+	d.messages = make(map[string][]*ChatMessage)
+	d.rooms = nil
+	d.skipped = 0
+	d.lastFlush = time.Now()
+	d.active.Store(true)
+}
+
+// flush queues the episode's notice and a message_batch frame per room for the
+// connection, stopping once its queue is full. It reports whether everything held
+// was queued.
+func (d *digestBuffer) flush(c *Connection) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.flushLocked(c)
+}
+
+// flushLocked is flush for callers holding the mutex
+func (d *digestBuffer) flushLocked(c *Connection) bool {
+	d.lastFlush = time.Now()
+	if d.notice != nil {
+		select {
+		case c.Send <- *d.notice:
+			d.notice = nil
+		default:
+			return false
+		}
+	}
+	for len(d.rooms) > 0 {
+		room := d.rooms[0]
+		frame := WSMessage{Type: "message_batch", Data: d.messages[room], Room: room, Timestamp: time.Now()}
+		select {
+		case c.Send <- frame:
+		default:
+			c.wake()
+			return false
+		}
+		delete(d.messages, room)
+		d.rooms = d.rooms[1:]
+	}
+	c.wake()
+	return true
+}
+
+// stop flushes the buffer and switches it off, returning how many messages the
+// episode skipped. It fails, leaving the buffer on, if the connection's queue
+// can't take everything held.
+func (d *digestBuffer) stop(c *Connection) (skipped int, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.flushLocked(c) {
+		return 0, false
+	}
+	d.active.Store(false)
+	return d.skipped, true
+}
+
+// due reports whether the next digest should be sent
+func (d *digestBuffer) due(interval time.Duration) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return time.Since(d.lastFlush) >= interval
+}
+
+// samplePressure checks the connection's send queue against the backpressure
+// watermark. A client above it for BackpressureSeconds straight samples is told to
+// ease off and gets chat messages in periodic digests; one back under half the
+// watermark for as long returns to live delivery. Only clients speaking protocol
+// version 2 understand the message_batch frames digests are sent as.
+func (c *Connection) samplePressure(config *ChatConfig) {
+	if c.protocolVersion.Load() < 2 || cap(c.Send) == 0 {
+		return
+	}
+	fill := len(c.Send) * 100 / cap(c.Send)
+
+	if !c.digest.active.Load() {
+		if fill >= config.BackpressurePercent {
+			c.pressureSamples++
+		} else {
+			c.pressureSamples = 0
+		}
+		if c.pressureSamples >= config.BackpressureSeconds {
+			c.pressureSamples = 0
+			c.digest.start(WSMessage{
+				Type:      "backpressure",
+				Data:      BackpressureEvent{Digest: true, IntervalSeconds: config.DigestIntervalSeconds, Message: backpressureNotice},
+				Timestamp: time.Now(),
+			})
+			c.digest.flush(c)
+		}
+		return
+	}
+
+	if fill*2 < config.BackpressurePercent {
+		c.pressureSamples++
+	} else {
+		c.pressureSamples = 0
+	}
+
+	if c.pressureSamples >= config.BackpressureSeconds {
+		if skipped, ok := c.digest.stop(c); ok {
+			c.pressureSamples = 0
+			c.send(WSMessage{Type: "backpressure", Data: BackpressureEvent{Skipped: skipped}, Timestamp: time.Now()})
+		}
+		return
+	}
+	if c.digest.due(time.Duration(config.DigestIntervalSeconds) * time.Second) {
+		c.digest.flush(c)
+	}
+}
+
+// backpressureMonitor samples every connection's send queue against the
+// backpressure watermark
+func (h *WSHandler) backpressureMonitor() {
+	defer trackWorker("ws.backpressureMonitor")()
+
+	ticker := time.NewTicker(loadSampleInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.eachConnection(func(c *Connection) {
+			c.samplePressure(h.manager.config)
+		})
+	}
+}
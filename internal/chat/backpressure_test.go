@@ -0,0 +1,82 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackpressureSwitchesToDigests(t *testing.T) {
+	h, c := newSlowTestConnection(t, 4)
+	config := h.manager.config
+	config.BackpressurePercent = 50
+	config.BackpressureSeconds = 2
+	config.DigestIntervalSeconds = 0 // a digest every sample
+	c.protocolVersion.Store(2)
+
+	chat := func(id string) WSMessage {
+		return WSMessage{Type: "message", Data: &ChatMessage{ID: id}, Room: "room"}
+	}
+	require.True(t, c.deliver(chat("1")))
+	require.True(t, c.deliver(chat("2")))
+
+	// Backed up for two samples in a row
+	c.samplePressure(config)
+	require.False(t, c.digest.active.Load())
+	c.samplePressure(config)
+	require.True(t, c.digest.active.Load())
+
+	// Chat messages and typing are held back; other frames still go out
+	require.True(t, c.deliver(chat("3")))
+	require.True(t, c.deliver(WSMessage{Type: "typing", Room: "room"}))
+	require.True(t, c.deliver(WSMessage{Type: "system", Room: "room"}))
+
+	frames := pending(c)
+	require.Equal(t, []string{"message", "message", "backpressure", "system"}, frameTypes(frames))
+	require.True(t, frames[2].Data.(BackpressureEvent).Digest)
+
+	// Digests carry what was held
+	c.samplePressure(config)
+	frames = pending(c)
+	require.Equal(t, []string{"message_batch"}, frameTypes(frames))
+	require.Equal(t, []string{"3"}, batchIDs(frames[0]))
+
+	// Caught up for two samples, it gets the last digest and goes back to live delivery
+	require.True(t, c.deliver(chat("4")))
+	c.samplePressure(config)
+	frames = pending(c)
+	require.Equal(t, []string{"message_batch", "backpressure"}, frameTypes(frames))
+	require.Equal(t, []string{"4"}, batchIDs(frames[0]))
+	require.False(t, frames[1].Data.(BackpressureEvent).Digest)
+
+	require.True(t, c.deliver(chat("5")))
+	require.Equal(t, []string{"message"}, frameTypes(pending(c)))
+}
+
+func TestBackpressureSkipsVersionOneClients(t *testing.T) {
+	h, c := newSlowTestConnection(t, 2)
+	config := h.manager.config
+	config.BackpressureSeconds = 1
+	c.protocolVersion.Store(1)
+
+	require.True(t, c.deliver(WSMessage{Type: "system"}))
+	c.samplePressure(config)
+	require.False(t, c.digest.active.Load())
+}
+
+func frameTypes(frames []WSMessage) []string {
+	types := make([]string, len(frames))
+	for i, frame := range frames {
+		types[i] = frame.Type
+	}
+	return types
+}
+
+func batchIDs(frame WSMessage) []string {
+	messages := frame.Data.([]*ChatMessage)
+	ids := make([]string, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return ids
+}
@@ -0,0 +1,205 @@
+package chat
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Overflow policies, for when more messages are waiting to be written than a
+// store's queue holds
+const (
+	OverflowDrop  = "drop"  // drop new messages, counting them, until the queue drains
+	OverflowFlush = "flush" // write the queue on the sender's goroutine, holding it up
+)
+
+// WriteBatching configures how a store holds appended messages and writes them in
+// batches, keeping its writes off the send path
+type WriteBatching struct {
+	BatchSize     int           // held messages that trigger a write before the interval
+	FlushInterval time.Duration // longest a message is held
+	QueueSize     int           // messages held before the overflow policy applies
+	Overflow      string        // OverflowDrop or OverflowFlush
+}
+
+// DefaultWriteBatching returns the batching stores use unless configured otherwise
+func DefaultWriteBatching() WriteBatching {
+	return WriteBatching{
+		BatchSize:     256,
+		FlushInterval: 200 * time.Millisecond,
+		QueueSize:     10000,
+		Overflow:      OverflowDrop,
+	}
+}
+
+// WriteBatchingFromConfig returns the batching set by a config's Persist settings
+func WriteBatchingFromConfig(config *ChatConfig) WriteBatching {
+	return WriteBatching{
+		BatchSize:     config.PersistBatchSize,
+		FlushInterval: time.Duration(config.PersistFlushIntervalMs) * time.Millisecond,
+		QueueSize:     config.PersistQueueSize,
+		Overflow:      config.PersistOverflow,
+	}
+}
+
+// writeBatcher holds a store's appended messages and writes them in order, a
+// batch at a time, from a background worker
+type writeBatcher struct {
+	name     string // the store, in logs
+	batching WriteBatching
+	write    func(batch []ChatMessage) error
+
+	mu      sync.Mutex
+	pending []ChatMessage
+	dropped atomic.Int64
+	blocked atomic.Int64 // appends that had to write the queue themselves
+
+	writeMu sync.Mutex // serializes batches so they land in order
+
+	wake chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// newWriteBatcher starts a batcher writing through write
+func newWriteBatcher(name string, batching WriteBatching, write func(batch []ChatMessage) error) (*writeBatcher, error) {
+	if batching.Overflow != OverflowDrop && batching.Overflow != OverflowFlush {
+		return nil, fmt.Errorf("unknown overflow policy %q", batching.Overflow)
+	}
+	if batching.BatchSize <= 0 || batching.FlushInterval <= 0 || batching.QueueSize <= 0 {
+		return nil, fmt.Errorf("batch size, flush interval and queue size must be positive")
+	}
+
+	b := &writeBatcher{
+		name:     name,
+		batching: batching,
+		write:    write,
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go b.worker()
+	return b, nil
+}
+
+// add holds a message for the next batch. With a full queue it either drops the
+// message or writes the queue first, as the overflow policy says.
+func (b *writeBatcher) add(msg ChatMessage) {
+	b.mu.Lock()
+	if len(b.pending) >= b.batching.QueueSize {
+		b.mu.Unlock()
+		if b.batching.Overflow == OverflowDrop {
+			if b.dropped.Add(1)%1000 == 1 {
+				log.Printf("Chat %s queue full, dropped %d messages so far", b.name, b.dropped.Load())
+			}
+			return
+		}
+
+		if b.blocked.Add(1)%1000 == 1 {
+			log.Printf("Chat %s queue full, writing it from the sender %d times so far", b.name, b.blocked.Load())
+		}
+		if err := b.flush(); err != nil {
+			log.Printf("Failed to write chat messages to %s: %v", b.name, err)
+		}
+		b.mu.Lock()
+	}
+	b.pending = append(b.pending, msg)
+	full := len(b.pending) >= b.batching.BatchSize
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// flush writes every held message, a batch at a time. A batch that fails is
+// dropped with the rest rather than retried, so a broken store can't hold memory
+// forever.
+func (b *writeBatcher) flush() error {
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	b.mu.Lock()
+	held := b.pending
+	b.pending = nil
+	b.mu.Unlock()
+
+	return b.writeLocked(held)
+}
+
+// writeNow writes messages at once, after those already held, rather than
+// holding them, so imports larger than the queue aren't dropped
+func (b *writeBatcher) writeNow(messages []ChatMessage) error {
+	if err := b.flush(); err != nil {
+		return err
+	}
+
+	b.writeMu.Lock()
+	defer b.writeMu.Unlock()
+
+	return b.writeLocked(messages)
+}
+
+// writeLocked writes messages in batches. Callers must hold writeMu.
+func (b *writeBatcher) writeLocked(messages []ChatMessage) error {
+	for len(messages) > 0 {
+		n := min(len(messages), b.batching.BatchSize)
+		if err := b.write(messages[:n]); err != nil {
+			return err
+		}
+		messages = messages[n:]
+	}
+	return nil
+}
+
+// Pending returns the number of messages held for writing
+func (b *writeBatcher) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.pending)
+}
+
+// Dropped returns the number of messages dropped for a full queue
+func (b *writeBatcher) Dropped() int64 {
+	return b.dropped.Load()
+}
+
+// close stops the worker and writes the messages still held
+func (b *writeBatcher) close() {
+	b.once.Do(func() {
+		close(b.stop)
+	})
+	<-b.done
+
+	if err := b.flush(); err != nil {
+		log.Printf("Failed to write chat messages to %s on close: %v", b.name, err)
+	}
+}
+
+// worker writes held messages every flush interval, or sooner once a batch fills
+func (b *writeBatcher) worker() {
+	defer trackWorker("batcher." + b.name)()
+	defer close(b.done)
+
+	ticker := time.NewTicker(b.batching.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-b.wake:
+		case <-b.stop:
+			return
+		}
+		if err := b.flush(); err != nil {
+			log.Printf("Failed to write chat messages to %s: %v", b.name, err)
+		}
+	}
+}
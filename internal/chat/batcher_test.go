@@ -0,0 +1,94 @@
+package chat
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// batchRecorder collects the batches a writeBatcher writes
+type batchRecorder struct {
+	mu      sync.Mutex
+	batches [][]ChatMessage
+}
+
+func (w *batchRecorder) write(batch []ChatMessage) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.batches = append(w.batches, append([]ChatMessage(nil), batch...))
+	return nil
+}
+
+func (w *batchRecorder) written() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ids := []string{}
+	for _, batch := range w.batches {
+		ids = append(ids, messageIDs(batch)...)
+	}
+	return ids
+}
+
+func testMessages(n int) []ChatMessage {
+	messages := make([]ChatMessage, n)
+	for i := range messages {
+		messages[i] = ChatMessage{ID: strconv.Itoa(i + 1), StreamKey: "room", Seq: int64(i + 1)}
+	}
+	return messages
+}
+
+func TestWriteBatcherFlushesOnSizeOrInterval(t *testing.T) {
+	writer := &batchRecorder{}
+	batcher, err := newWriteBatcher("test", WriteBatching{BatchSize: 3, FlushInterval: 50 * time.Millisecond, QueueSize: 10, Overflow: OverflowDrop}, writer.write)
+	require.NoError(t, err)
+	t.Cleanup(batcher.close)
+
+	for _, msg := range testMessages(3) {
+		batcher.add(msg)
+	}
+	require.Eventually(t, func() bool { return len(writer.written()) == 3 }, time.Second, 5*time.Millisecond)
+
+	// A partial batch waits for the interval
+	batcher.add(ChatMessage{ID: "4"})
+	require.Equal(t, 1, batcher.Pending())
+	require.Eventually(t, func() bool { return batcher.Pending() == 0 }, time.Second, 5*time.Millisecond)
+	require.Equal(t, []string{"1", "2", "3", "4"}, writer.written())
+
+	// Writing at once splits into batches and keeps the order
+	batcher.add(ChatMessage{ID: "5"})
+	require.NoError(t, batcher.writeNow(testMessages(4)))
+	require.Equal(t, []string{"1", "2", "3", "4", "5", "1", "2", "3", "4"}, writer.written())
+}
+
+func TestWriteBatcherOverflow(t *testing.T) {
+	batching := WriteBatching{BatchSize: 100, FlushInterval: time.Hour, QueueSize: 2, Overflow: OverflowDrop}
+
+	writer := &batchRecorder{}
+	dropping, err := newWriteBatcher("test", batching, writer.write)
+	require.NoError(t, err)
+	for _, msg := range testMessages(5) {
+		dropping.add(msg)
+	}
+	require.Equal(t, int64(3), dropping.Dropped())
+	dropping.close()
+	require.Equal(t, []string{"1", "2"}, writer.written())
+
+	batching.Overflow = OverflowFlush
+	writer = &batchRecorder{}
+	flushing, err := newWriteBatcher("test", batching, writer.write)
+	require.NoError(t, err)
+	for _, msg := range testMessages(5) {
+		flushing.add(msg)
+	}
+	require.Zero(t, flushing.Dropped())
+	require.Equal(t, []string{"1", "2", "3", "4"}, writer.written())
+	flushing.close()
+	require.Equal(t, []string{"1", "2", "3", "4", "5"}, writer.written())
+
+	batching.Overflow = "block"
+	_, err = newWriteBatcher("test", batching, writer.write)
+	require.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Benchmarks for the hot paths. Compare runs with benchstat to catch regressions:
+//
+//	go test ./internal/chat -run '^$' -bench . -count 10 > new.txt
+
+func BenchmarkCircularBufferAdd(b *testing.B) {
+	cb := NewCircularBuffer(1000)
+	msg := ChatMessage{ID: "id", UserID: "alice", Username: "alice", Message: "hello chat", Timestamp: time.Now()}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg.Seq = int64(i)
+		cb.Add(msg)
+	}
+}
+
+func BenchmarkSlabBufferAdd(b *testing.B) {
+	sb := NewSlabBuffer(1000, slabSlotBytes(DefaultConfig()))
+	msg := ChatMessage{ID: "id", UserID: "alice", Username: "alice", Message: "hello chat", Timestamp: time.Now()}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		msg.Seq = int64(i)
+		sb.Add(msg)
+	}
+}
+
+func BenchmarkCircularBufferGetRecent(b *testing.B) {
+	cb := NewCircularBuffer(1000)
+	for i := 0; i < 1000; i++ {
+		cb.Add(ChatMessage{ID: fmt.Sprint(i), Seq: int64(i), Message: "hello chat"})
+	}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		cb.GetRecent(50)
+	}
+}
+
+func BenchmarkRateLimiterCheckMessage(b *testing.B) {
+	rl := NewRateLimiter(DefaultConfig())
+	b.Cleanup(rl.Stop)
+
+	var users atomic.Int64
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		// Each goroutine cycles through its own users so records stay under the limits
+		first := users.Add(1000) - 1000
+		i := 0
+		for pb.Next() {
+			rl.CheckMessage(fmt.Sprintf("user%d", first+int64(i%1000)), "hello chat")
+			i++
+		}
+	})
+}
+
+func BenchmarkBroadcast(b *testing.B) {
+	for _, size := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("connections=%d", size), func(b *testing.B) {
+			config := DefaultConfig()
+			config.SlowClientMaxDrops = 0
+			config.LoadShedQueuePercent = 0
+			manager := NewManager(config)
+			b.Cleanup(manager.Stop)
+			h := NewWSHandler(manager, NewRateLimiter(config))
+
+			// Connections whose queues are drained as fast as the hub fills them
+			for i := 0; i < size; i++ {
+				c := &Connection{
+					UserID:    fmt.Sprintf("user%d", i),
+					StreamKey: "room",
+					Transport: &recordingTransport{},
+					Send:      make(chan WSMessage, config.SendQueueSize),
+					manager:   h,
+					done:      make(chan struct{}),
+				}
+				go func() {
+					for {
+						select {
+						case <-c.Send:
+						case <-c.done:
+							return
+						}
+					}
+				}()
+				b.Cleanup(func() { c.Close("") })
+				c.joinedAs.Store(c.UserID)
+				h.register("room", c)
+			}
+
+			msg := WSMessage{Type: "message", Data: &ChatMessage{UserID: "alice", Message: "hello chat"}, Timestamp: time.Now()}
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				h.broadcast("room", msg, "")
+			}
+
+			// The hub fans out in order, so once the last report arrives every broadcast has been
+			done := make(chan struct{})
+			h.broadcastReporting("room", msg, "", func(int, int) { close(done) })
+			<-done
+		})
+	}
+}
@@ -0,0 +1,258 @@
+package chat
+
+import (
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	bridgeQueueSize = 256
+	echoMemory      = 30 * time.Minute // how long relayed message IDs are remembered
+)
+
+// MessageOrigin records where a bridged message was posted before it reached chat
+type MessageOrigin struct {
+	System string `json:"system"` // bridge name, such as "irc", "discord" or "matrix"
+	ID     string `json:"id"`     // the message's ID in that system
+}
+
+// Bridge relays a room's chat messages to another chat system
+type Bridge interface {
+	// Name identifies the other system. Messages the bridge relays in carry it as their origin.
+	Name() string
+
+	// Relay posts a chat message in the other system and returns its ID there
+	Relay(msg ChatMessage) (string, error)
+}
+
+// BridgedMessage is a message a bridge received from its system
+type BridgedMessage struct {
+	Origin   MessageOrigin
+	Via      []MessageOrigin // earlier hops the other system reported, if it was bridged there too
+	UserID   string
+	Username string
+	Message  string
+}
+
+// identities lists every ID the message is known by
+func (m BridgedMessage) identities() []MessageOrigin {
+	return append([]MessageOrigin{m.Origin}, m.Via...)
+}
+
+// echoEntry is a message known to be in chat and the systems it has already been in
+type echoEntry struct {
+	messageID string
+	systems   map[string]bool
+	seen      time.Time
+}
+
+// EchoSuppressor keeps bridged chat loop-free. It remembers every foreign ID a chat
+// message is known by, whether it was relayed in or out, so a message can't come back
+// in through any bridge and is never relayed to a system it came from.
+type EchoSuppressor struct {
+	byOrigin  map[MessageOrigin]*echoEntry
+	byMessage map[string]*echoEntry // chat message ID -> entry
+	ttl       time.Duration
+	mutex     sync.Mutex
+}
+
+// NewEchoSuppressor creates a suppressor that forgets messages after ttl
+func NewEchoSuppressor(ttl time.Duration) *EchoSuppressor {
+	return &EchoSuppressor{
+		byOrigin:  make(map[MessageOrigin]*echoEntry),
+		byMessage: make(map[string]*echoEntry),
+		ttl:       ttl,
+	}
+}
+
+// Admit reports whether a bridged message is new to chat and, if so, reserves its
+// identities so the same message arriving through another bridge is refused
+func (s *EchoSuppressor) Admit(msg BridgedMessage) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pruneLocked()
+
+	for _, origin := range msg.identities() {
+		if _, exists := s.byOrigin[origin]; exists {
+			return false
+		}
+	}
+
+	entry := &echoEntry{systems: make(map[string]bool), seen: time.Now()}
+	for _, origin := range msg.identities() {
+		s.byOrigin[origin] = entry
+		entry.systems[origin.System] = true
+	}
+	return true
+}
+
+// Forget releases the identities reserved by Admit when the message could not be posted
+func (s *EchoSuppressor) Forget(msg BridgedMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, origin := range msg.identities() {
+		delete(s.byOrigin, origin)
+	}
+}
+
+// Posted links an admitted bridged message to the chat message it became
+func (s *EchoSuppressor) Posted(msg BridgedMessage, messageID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if entry, exists := s.byOrigin[msg.Origin]; exists {
+		entry.messageID = messageID
+		s.byMessage[messageID] = entry
+	}
+}
+
+// ShouldRelay reports whether a chat message may be relayed to a system, which it
+// may not if it came from there
+func (s *EchoSuppressor) ShouldRelay(msg ChatMessage, system string) bool {
+	if msg.Origin != nil && msg.Origin.System == system {
+		return false
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entry, exists := s.byMessage[msg.ID]
+	return !exists || !entry.systems[system]
+}
+
+// Relayed records that a chat message was posted in a system as remoteID, so it is
+// recognized if that system, or one bridged to it, sends it back
+func (s *EchoSuppressor) Relayed(messageID, system, remoteID string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Messages may only ever be relayed out, so forget old ones here too
+	s.pruneLocked()
+
+	entry, exists := s.byMessage[messageID]
+	if !exists {
+		entry = &echoEntry{messageID: messageID, systems: make(map[string]bool)}
+		s.byMessage[messageID] = entry
+	}
+	entry.systems[system] = true
+	entry.seen = time.Now()
+	s.byOrigin[MessageOrigin{System: system, ID: remoteID}] = entry
+}
+
+// pruneLocked forgets messages not seen within the ttl
+func (s *EchoSuppressor) pruneLocked() {
+	cutoff := time.Now().Add(-s.ttl)
+	for origin, entry := range s.byOrigin {
+		if entry.seen.Before(cutoff) {
+			delete(s.byOrigin, origin)
+			delete(s.byMessage, entry.messageID)
+		}
+	}
+	for messageID, entry := range s.byMessage {
+		if entry.seen.Before(cutoff) {
+			delete(s.byMessage, messageID)
+		}
+	}
+}
+
+// bridgeHub relays room messages to the registered bridges
+type bridgeHub struct {
+	bridges map[string]chan ChatMessage // bridge name -> relay queue
+	echoes  *EchoSuppressor
+	mutex   sync.RWMutex
+}
+
+// newBridgeHub creates a hub with no bridges
+func newBridgeHub() *bridgeHub {
+	return &bridgeHub{
+		bridges: make(map[string]chan ChatMessage),
+		echoes:  NewEchoSuppressor(echoMemory),
+	}
+}
+
+// relay queues a chat message for every bridge it didn't come from. It never blocks;
+// messages are dropped for bridges that fall behind.
+func (b *bridgeHub) relay(msg ChatMessage) {
+	b.mutex.RLock()
+	defer b.mutex.RUnlock()
+
+	for name, queue := range b.bridges {
+		if !b.echoes.ShouldRelay(msg, name) {
+			continue
+		}
+		select {
+		case queue <- msg:
+		default:
+			log.Printf("Chat bridge %s is behind, dropping message %s", name, msg.ID)
+		}
+	}
+}
+
+// worker posts queued messages through one bridge until its queue is closed
+func (b *bridgeHub) worker(bridge Bridge, queue chan ChatMessage) {
+	defer trackWorker("bridge.relay")()
+
+	for msg := range queue {
+		remoteID, err := bridge.Relay(msg)
+		if err != nil {
+			log.Printf("Chat bridge %s failed to relay message %s: %v", bridge.Name(), msg.ID, err)
+			continue
+		}
+		b.echoes.Relayed(msg.ID, bridge.Name(), remoteID)
+	}
+}
+
+// AddBridge starts relaying chat messages through a bridge and returns a function
+// that removes it. Bridge names must be unique.
+func (h *WSHandler) AddBridge(bridge Bridge) func() {
+	queue := make(chan ChatMessage, bridgeQueueSize)
+
+	h.bridges.mutex.Lock()
+	h.bridges.bridges[bridge.Name()] = queue
+	h.bridges.mutex.Unlock()
+
+	go h.bridges.worker(bridge, queue)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.bridges.mutex.Lock()
+			delete(h.bridges.bridges, bridge.Name())
+			h.bridges.mutex.Unlock()
+			close(queue)
+		})
+	}
+}
+
+// RelayIn posts a message received by a bridge to a room, unless it is an echo of a
+// message already in chat, in which case ErrEchoSuppressed is returned. Bridged
+// messages go through the chat filter and room modes like any other.
+func (h *WSHandler) RelayIn(streamKey string, msg BridgedMessage) (*ChatMessage, error) {
+	if !h.bridges.echoes.Admit(msg) {
+		return nil, ErrEchoSuppressed
+	}
+
+	if err := h.autoMod.Check(msg.Message); err != nil {
+		h.bridges.echoes.Forget(msg)
+		return nil, err
+	}
+
+	origin := msg.Origin
+	chatMsg := newChatMessage(streamKey, msg.UserID, msg.Username, msg.Message)
+	chatMsg.Origin = &origin
+	if err := h.manager.addMessage(chatMsg); err != nil {
+		h.bridges.echoes.Forget(msg)
+		return nil, err
+	}
+	h.bridges.echoes.Posted(msg, chatMsg.ID)
+
+	h.broadcast(streamKey, WSMessage{
+		Type:      "message",
+		Data:      chatMsg,
+		Timestamp: time.Now(),
+	}, "")
+	return chatMsg, nil
+}
@@ -0,0 +1,184 @@
+package chat
+
+import (
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// relayedCopy is a chat message a fake bridge posted in its system
+type relayedCopy struct {
+	msg    ChatMessage
+	remote MessageOrigin
+}
+
+// fakeBridge records what it relays and numbers the copies it posts
+type fakeBridge struct {
+	name    string
+	relayed chan relayedCopy
+	nextID  atomic.Int64
+}
+
+func newFakeBridge(name string) *fakeBridge {
+	return &fakeBridge{name: name, relayed: make(chan relayedCopy, 10)}
+}
+
+func (b *fakeBridge) Name() string { return b.name }
+
+func (b *fakeBridge) Relay(msg ChatMessage) (string, error) {
+	remoteID := fmt.Sprintf("%s-%d", b.name, b.nextID.Add(1))
+	b.relayed <- relayedCopy{msg: msg, remote: MessageOrigin{System: b.name, ID: remoteID}}
+	return remoteID, nil
+}
+
+// receive waits until the bridge has relayed a message and the hub has recorded
+// the copy, returning the message and the copy's identity
+func (b *fakeBridge) receive(t *testing.T, h *WSHandler) (ChatMessage, MessageOrigin) {
+	select {
+	case relayed := <-b.relayed:
+		require.Eventually(t, func() bool {
+			h.bridges.echoes.mutex.Lock()
+			defer h.bridges.echoes.mutex.Unlock()
+			_, recorded := h.bridges.echoes.byOrigin[relayed.remote]
+			return recorded
+		}, 5*time.Second, time.Millisecond)
+		return relayed.msg, relayed.remote
+	case <-time.After(5 * time.Second):
+		t.Fatalf("%s bridge relayed nothing", b.name)
+		return ChatMessage{}, MessageOrigin{}
+	}
+}
+
+func (b *fakeBridge) requireNothing(t *testing.T) {
+	select {
+	case relayed := <-b.relayed:
+		t.Fatalf("%s bridge relayed %q", b.name, relayed.msg.Message)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestBridgeEchoSuppression(t *testing.T) {
+	t.Run("relayed out and back in", func(t *testing.T) {
+		h, _ := newTestHandler(t)
+		irc := newFakeBridge("irc")
+		defer h.AddBridge(irc)()
+
+		chatMsg, err := h.manager.AddMessage("room", "alice", "alice", "hello")
+		require.NoError(t, err)
+		h.broadcast("room", WSMessage{Type: "message", Data: chatMsg}, "")
+
+		relayed, remote := irc.receive(t, h)
+		require.Equal(t, chatMsg.ID, relayed.ID)
+
+		// The copy posted in IRC comes straight back
+		_, err = h.RelayIn("room", BridgedMessage{Origin: remote, UserID: "alice", Username: "alice", Message: "hello"})
+		require.ErrorIs(t, err, ErrEchoSuppressed)
+	})
+
+	t.Run("never relayed back to its origin", func(t *testing.T) {
+		h, _ := newTestHandler(t)
+		discord := newFakeBridge("discord")
+		matrix := newFakeBridge("matrix")
+		defer h.AddBridge(discord)()
+		defer h.AddBridge(matrix)()
+
+		chatMsg, err := h.RelayIn("room", BridgedMessage{
+			Origin:   MessageOrigin{System: "discord", ID: "123"},
+			UserID:   "discord:bob",
+			Username: "bob",
+			Message:  "hi from discord",
+		})
+		require.NoError(t, err)
+		require.Equal(t, &MessageOrigin{System: "discord", ID: "123"}, chatMsg.Origin)
+
+		relayed, remote := matrix.receive(t, h)
+		require.Equal(t, chatMsg.ID, relayed.ID)
+		discord.requireNothing(t)
+
+		// Matrix sends our copy back
+		_, err = h.RelayIn("room", BridgedMessage{Origin: remote, UserID: "matrix:bob", Username: "bob", Message: "hi from discord"})
+		require.ErrorIs(t, err, ErrEchoSuppressed)
+		discord.requireNothing(t)
+	})
+
+	t.Run("same message through two bridges", func(t *testing.T) {
+		h, _ := newTestHandler(t)
+		discord := newFakeBridge("discord")
+		matrix := newFakeBridge("matrix")
+		defer h.AddBridge(discord)()
+		defer h.AddBridge(matrix)()
+
+		_, err := h.RelayIn("room", BridgedMessage{
+			Origin:  MessageOrigin{System: "discord", ID: "123"},
+			UserID:  "discord:bob",
+			Message: "hi",
+		})
+		require.NoError(t, err)
+		matrix.receive(t, h)
+
+		// A Discord-Matrix bridge outside chat copied it into Matrix as well
+		_, err = h.RelayIn("room", BridgedMessage{
+			Origin:  MessageOrigin{System: "matrix", ID: "$abc"},
+			Via:     []MessageOrigin{{System: "discord", ID: "123"}},
+			UserID:  "matrix:bob",
+			Message: "hi",
+		})
+		require.ErrorIs(t, err, ErrEchoSuppressed)
+	})
+
+	t.Run("upstream systems are skipped", func(t *testing.T) {
+		h, _ := newTestHandler(t)
+		discord := newFakeBridge("discord")
+		matrix := newFakeBridge("matrix")
+		irc := newFakeBridge("irc")
+		defer h.AddBridge(discord)()
+		defer h.AddBridge(matrix)()
+		defer h.AddBridge(irc)()
+
+		// Posted in Discord, bridged to Matrix outside chat, relayed in from Matrix
+		chatMsg, err := h.RelayIn("room", BridgedMessage{
+			Origin:  MessageOrigin{System: "matrix", ID: "$abc"},
+			Via:     []MessageOrigin{{System: "discord", ID: "123"}},
+			UserID:  "matrix:bob",
+			Message: "hi",
+		})
+		require.NoError(t, err)
+
+		relayed, _ := irc.receive(t, h)
+		require.Equal(t, chatMsg.ID, relayed.ID)
+		discord.requireNothing(t)
+		matrix.requireNothing(t)
+	})
+
+	t.Run("refused messages can be retried", func(t *testing.T) {
+		h, _ := newTestHandler(t)
+		room := h.manager.GetOrCreateRoom("room")
+		room.SetModes(RoomModes{ReadOnly: true})
+
+		msg := BridgedMessage{Origin: MessageOrigin{System: "irc", ID: "1"}, UserID: "irc:carol", Message: "hey"}
+		_, err := h.RelayIn("room", msg)
+		require.ErrorIs(t, err, ErrRoomReadOnly)
+
+		room.SetModes(RoomModes{})
+		_, err = h.RelayIn("room", msg)
+		require.NoError(t, err)
+	})
+}
+
+func TestEchoSuppressorForgetsRelayedMessages(t *testing.T) {
+	echoes := NewEchoSuppressor(50 * time.Millisecond)
+
+	// Messages only relayed out are never admitted, but are forgotten all the same
+	echoes.Relayed("one", "irc", "remote-one")
+	time.Sleep(60 * time.Millisecond)
+	echoes.Relayed("two", "irc", "remote-two")
+
+	echoes.mutex.Lock()
+	defer echoes.mutex.Unlock()
+	require.Len(t, echoes.byOrigin, 1)
+	require.Len(t, echoes.byMessage, 1)
+	require.Contains(t, echoes.byMessage, "two")
+}
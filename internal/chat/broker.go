@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"sync"
+)
+
+// Broker is the backplane used to propagate events between chat instances. It
+// carries instance-wide events, such as session revocations; a room's messages
+// stay on the instance that owns the room, which routing sends its clients to.
+type Broker interface {
+	// Publish sends a payload to every subscriber of a subject, on all instances
+	Publish(subject string, payload []byte) error
+	// Subscribe registers a handler for a subject and returns a function that removes it
+	Subscribe(subject string, handler func(payload []byte)) (func(), error)
+	// Close releases the broker's resources
+	Close() error
+}
+
+// LocalBroker is an in-process Broker for single-instance deployments
+type LocalBroker struct {
+	handlers map[string]map[int]func([]byte)
+	nextID   int
+	mutex    sync.RWMutex
+}
+
+// NewLocalBroker creates a new in-process broker
+func NewLocalBroker() *LocalBroker {
+	return &LocalBroker{
+		handlers: make(map[string]map[int]func([]byte)),
+	}
+}
+
+// Publish delivers a payload to the subject's handlers synchronously
+func (lb *LocalBroker) Publish(subject string, payload []byte) error {
+	lb.mutex.RLock()
+	handlers := make([]func([]byte), 0, len(lb.handlers[subject]))
+	for _, handler := range lb.handlers[subject] {
+		handlers = append(handlers, handler)
+	}
+	lb.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(payload)
+	}
+
+	return nil
+}
+
+// Subscribe registers a handler for a subject
+func (lb *LocalBroker) Subscribe(subject string, handler func([]byte)) (func(), error) {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	if lb.handlers[subject] == nil {
+		lb.handlers[subject] = make(map[int]func([]byte))
+	}
+
+	id := lb.nextID
+	lb.nextID++
+	lb.handlers[subject][id] = handler
+
+	return func() {
+		lb.mutex.Lock()
+		defer lb.mutex.Unlock()
+		delete(lb.handlers[subject], id)
+	}, nil
+}
+
+// Close removes all handlers
+func (lb *LocalBroker) Close() error {
+	lb.mutex.Lock()
+	defer lb.mutex.Unlock()
+
+	lb.handlers = make(map[string]map[int]func([]byte))
+	return nil
+}
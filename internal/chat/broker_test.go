@@ -0,0 +1,25 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalBrokerDeliversToSubscribers(t *testing.T) {
+	broker := NewLocalBroker()
+	subject := subjectSessionsRevoked
+
+	received := [][]byte{}
+	unsubscribe, err := broker.Subscribe(subject, func(payload []byte) {
+		received = append(received, payload)
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, broker.Publish(subject, []byte("one")))
+	require.NoError(t, broker.Publish("chat.other", []byte("two")))
+	unsubscribe()
+	require.NoError(t, broker.Publish(subject, []byte("three")))
+
+	require.Equal(t, [][]byte{[]byte("one")}, received)
+}
@@ -0,0 +1,197 @@
+// Package chatclient is a small WebSocket client for bots and tools that talk to
+// the chat server. Its protocol types are generated from the server's, see
+// protocol_gen.go.
+package chatclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const eventBufferSize = 256
+
+// Client is one chat session with the server
+type Client struct {
+	conn     *websocket.Conn
+	events   chan ServerFrame
+	writeMux sync.Mutex
+	err      error
+	done     chan struct{}
+}
+
+// Dial connects to the chat endpoint (for example ws://localhost:8080/api/chat)
+// for a stream and announces the client's protocol version. header may carry an
+// Authorization token.
+func Dial(ctx context.Context, endpoint, streamKey string, header http.Header) (*Client, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("streamKey", streamKey)
+	u.RawQuery = query.Encode()
+
+	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), header)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Client{
+		conn:   conn,
+		events: make(chan ServerFrame, eventBufferSize),
+		done:   make(chan struct{}),
+	}
+	go c.readLoop()
+
+	if err := c.send(FrameHello, HelloFrame{ProtocolVersion: ProtocolVersion}); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Join joins the stream's chat as a user
+func (c *Client) Join(userID, username string) error {
+	return c.send(FrameJoin, JoinFrame{UserID: userID, Username: username})
+}
+
+// Send sends a chat message. The client must have joined.
+func (c *Client) Send(message string) error {
+	return c.send(FrameMessage, ChatFrame{Message: message})
+}
+
+// JoinRoom adds another stream's chat to the connection, as the user given to Join.
+// Events about it carry the stream key in ServerFrame.Room.
+func (c *Client) JoinRoom(streamKey string) error {
+	return c.send(FrameJoinRoom, JoinRoomFrame{Room: streamKey})
+}
+
+// LeaveRoom leaves a stream's chat added with JoinRoom
+func (c *Client) LeaveRoom(streamKey string) error {
+	return c.send(FrameLeaveRoom, LeaveRoomFrame{Room: streamKey})
+}
+
+// SendTo sends a chat message to a stream's chat added with JoinRoom
+func (c *Client) SendTo(streamKey, message string) error {
+	return c.send(FrameMessage, ChatFrame{Message: message, Room: streamKey})
+}
+
+// Ack reports the sequence number of the last message received. Missing messages
+// after it arrive as a FrameMissed event; send one when ChatMessage.Seq skips ahead.
+func (c *Client) Ack(seq int64) error {
+	return c.send(FrameAck, AckFrame{Seq: seq})
+}
+
+// Reserve asks for a message ID to render a message optimistically under. The ID
+// arrives as a FrameReserved event; pass it to SendReserved.
+func (c *Client) Reserve() error {
+	return c.send(FrameReserve, ReserveFrame{})
+}
+
+// SendReserved sends a chat message under a reserved ID
+func (c *Client) SendReserved(id, message string) error {
+	return c.send(FrameMessage, ChatFrame{Message: message, ID: id})
+}
+
+// Typing starts or stops the typing indicator
+func (c *Client) Typing(isTyping bool) error {
+	return c.send(FrameTyping, TypingFrame{IsTyping: isTyping})
+}
+
+// Ping asks the server to echo the current time. The answer arrives as a FramePong
+// event; see PongEvent.Latency.
+func (c *Client) Ping() error {
+	return c.send(FramePing, PingFrame{ClientTime: time.Now().UnixMilli()})
+}
+
+// SubscribeStats asks for the room's stats every interval, delivered as FrameRoomStats
+// events. The connection needs a token with the read:stats scope. An interval of
+// zero uses the server default.
+func (c *Client) SubscribeStats(interval time.Duration) error {
+	return c.send(FrameStats, StatsFrame{Subscribe: true, IntervalSeconds: int(interval.Seconds())})
+}
+
+// UnsubscribeStats stops room stats events
+func (c *Client) UnsubscribeStats() error {
+	return c.send(FrameStats, StatsFrame{})
+}
+
+// Latency returns the round trip time of a ping and how far the server's clock is
+// ahead of the client's, assuming the trip took equally long both ways
+func (p PongEvent) Latency(received time.Time) (rtt, skew time.Duration) {
+	sent := time.UnixMilli(p.ClientTime)
+	rtt = received.Sub(sent)
+	skew = time.UnixMilli(p.ServerTime).Sub(sent.Add(rtt / 2))
+	return rtt, skew
+}
+
+// Events returns the frames received from the server. It is closed when the
+// connection ends; Err then reports why.
+func (c *Client) Events() <-chan ServerFrame {
+	return c.events
+}
+
+// Err returns the error that ended the connection, once Events is closed
+func (c *Client) Err() error {
+	select {
+	case <-c.done:
+		return c.err
+	default:
+		return nil
+	}
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	c.writeMux.Lock()
+	c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")) //nolint
+	c.writeMux.Unlock()
+	return c.conn.Close()
+}
+
+// send writes one frame to the server
+func (c *Client) send(frameType string, data interface{}) error {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	return c.conn.WriteJSON(ClientFrame{Type: frameType, Data: data})
+}
+
+// readLoop delivers server frames until the connection ends
+func (c *Client) readLoop() {
+	defer close(c.done)
+	defer close(c.events)
+
+	for {
+		_, payload, err := c.conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure) {
+				c.err = err
+			}
+			return
+		}
+
+		var frame ServerFrame
+		if err := json.Unmarshal(payload, &frame); err != nil {
+			c.err = fmt.Errorf("decoding server frame: %w", err)
+			return
+		}
+		c.events <- frame
+	}
+}
+
+// Decode unmarshals a frame's data into the payload type for its Type, such as
+// ChatMessage for FrameMessage
+func (f ServerFrame) Decode(v interface{}) error {
+	if len(f.Data) == 0 {
+		return fmt.Errorf("%s frame has no data", f.Type)
+	}
+	return json.Unmarshal(f.Data, v)
+}
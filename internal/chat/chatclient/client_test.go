@@ -0,0 +1,61 @@
+package chatclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/chat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientRoundTrip(t *testing.T) {
+	config := chat.DefaultConfig()
+	manager := chat.NewManager(config)
+	t.Cleanup(manager.Stop)
+	h := chat.NewWSHandler(manager, chat.NewRateLimiter(config))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/chat", h.HTTPHandler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	client, err := Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http")+"/api/chat", "room", nil)
+	require.NoError(t, err)
+	defer client.Close()
+
+	readUntil := func(frameType string) ServerFrame {
+		for {
+			select {
+			case frame, ok := <-client.Events():
+				require.True(t, ok, "connection ended: %v", client.Err())
+				if frame.Type == frameType {
+					return frame
+				}
+			case <-ctx.Done():
+				t.Fatalf("no %s frame", frameType)
+			}
+		}
+	}
+
+	var hello HelloEvent
+	require.NoError(t, readUntil(FrameHello).Decode(&hello))
+	require.Equal(t, ProtocolVersion, hello.ProtocolVersion)
+
+	require.NoError(t, client.Join("bot", "Bot"))
+	var users []ChatUser
+	require.NoError(t, readUntil(FrameUsers).Decode(&users))
+	require.Equal(t, "bot", users[0].UserID)
+
+	require.NoError(t, client.Send("beep"))
+	var msg ChatMessage
+	require.NoError(t, readUntil(FrameMessage).Decode(&msg))
+	require.Equal(t, "beep", msg.Message)
+	require.Equal(t, "Bot", msg.Username)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/chat/chatclient"
+)
+
+// sentAtMarker tags each message with when it was sent, so receivers can measure
+// delivery latency on the load generator's own clock
+const sentAtMarker = " #sent="
+
+// words are mixed into messages so the server's duplicate detection doesn't
+// mistake senders for spammers
+var words = strings.Fields("stream chat hello great play nice clip lol wow again game when what team round map win lose pog gg")
+
+// loadConfig describes the load to generate
+type loadConfig struct {
+	URL            string
+	Clients        int
+	Rooms          int
+	RoomPrefix     string
+	SendersPercent int
+	Rate           float64 // messages per second per sender
+	Duration       time.Duration
+	Ramp           time.Duration
+	Token          string
+}
+
+// report collects what the simulated clients saw
+type report struct {
+	elapsed   time.Duration
+	connected atomic.Int64
+	failed    atomic.Int64
+	sent      atomic.Int64
+	received  atomic.Int64
+	rejected  atomic.Int64 // error and rate_limit frames
+	dropped   atomic.Int64 // connections the server closed early
+
+	latencyMux sync.Mutex
+	latencies  []time.Duration
+}
+
+// run connects the clients, sends for the configured duration and returns the report
+func run(ctx context.Context, cfg loadConfig) *report {
+	r := &report{}
+	start := time.Now()
+
+	header := http.Header{}
+	if cfg.Token != "" {
+		header.Set("Authorization", "Bearer "+cfg.Token)
+	}
+
+	senders := cfg.Clients * cfg.SendersPercent / 100
+	sendUntil := start.Add(cfg.Ramp + cfg.Duration)
+
+	var wg sync.WaitGroup
+	step := cfg.Ramp / time.Duration(cfg.Clients)
+	for i := 0; i < cfg.Clients; i++ {
+		if ctx.Err() != nil {
+			break
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			r.runClient(ctx, cfg, header, i, i < senders, sendUntil)
+		}(i)
+		time.Sleep(step)
+	}
+
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	return r
+}
+
+// runClient connects one client, sends if it is a sender, and reads until sendUntil
+// plus a moment for the last messages to arrive
+func (r *report) runClient(ctx context.Context, cfg loadConfig, header http.Header, i int, sender bool, sendUntil time.Time) {
+	ctx, cancel := context.WithDeadline(ctx, sendUntil.Add(2*time.Second))
+	defer cancel()
+
+	room := fmt.Sprintf("%s%d", cfg.RoomPrefix, i%cfg.Rooms)
+	client, err := chatclient.Dial(ctx, cfg.URL, room, header)
+	if err != nil {
+		r.failed.Add(1)
+		return
+	}
+	defer client.Close()
+
+	userID := fmt.Sprintf("load%d", i)
+	if err := client.Join(userID, userID); err != nil {
+		r.failed.Add(1)
+		return
+	}
+	r.connected.Add(1)
+
+	if sender {
+		go r.send(ctx, client, cfg.Rate, sendUntil)
+	}
+
+	for {
+		select {
+		case frame, ok := <-client.Events():
+			if !ok {
+				if ctx.Err() == nil {
+					r.dropped.Add(1)
+				}
+				return
+			}
+			r.handle(frame)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// send sends messages at the rate until sendUntil, starting at a random offset so
+// senders don't fire in lockstep
+func (r *report) send(ctx context.Context, client *chatclient.Client, rate float64, sendUntil time.Time) {
+	interval := time.Duration(float64(time.Second) / rate)
+
+	select {
+	case <-time.After(time.Duration(rand.Int63n(int64(interval)))):
+	case <-ctx.Done():
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for time.Now().Before(sendUntil) {
+		if err := client.Send(message()); err != nil {
+			return
+		}
+		r.sent.Add(1)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// message builds a message text of random words ending with its send time
+func message() string {
+	parts := make([]string, 3+rand.Intn(5))
+	for i := range parts {
+		parts[i] = words[rand.Intn(len(words))]
+	}
+	return strings.Join(parts, " ") + sentAtMarker + strconv.FormatInt(time.Now().UnixNano(), 10)
+}
+
+// handle records one frame from the server
+func (r *report) handle(frame chatclient.ServerFrame) {
+	now := time.Now()
+
+	switch frame.Type {
+	case chatclient.FrameMessage:
+		var msg chatclient.ChatMessage
+		if frame.Decode(&msg) == nil {
+			r.record(msg, now)
+		}
+	case chatclient.FrameMessageBatch:
+		var batch []chatclient.ChatMessage
+		if frame.Decode(&batch) == nil {
+			for _, msg := range batch {
+				r.record(msg, now)
+			}
+		}
+	case chatclient.FrameError, chatclient.FrameRateLimit:
+		r.rejected.Add(1)
+	}
+}
+
+// record counts a received message and its latency, if it was sent by this run
+func (r *report) record(msg chatclient.ChatMessage, received time.Time) {
+	r.received.Add(1)
+
+	at := strings.LastIndex(msg.Message, sentAtMarker)
+	if at < 0 {
+		return
+	}
+	sentAt, err := strconv.ParseInt(msg.Message[at+len(sentAtMarker):], 10, 64)
+	if err != nil {
+		return
+	}
+
+	r.latencyMux.Lock()
+	r.latencies = append(r.latencies, received.Sub(time.Unix(0, sentAt)))
+	r.latencyMux.Unlock()
+}
+
+// percentile returns the latency below which p percent of deliveries arrived
+func (r *report) percentile(p float64) time.Duration {
+	if len(r.latencies) == 0 {
+		return 0
+	}
+	return r.latencies[int(float64(len(r.latencies)-1)*p/100)]
+}
+
+// String summarizes the run
+func (r *report) String() string {
+	r.latencyMux.Lock()
+	defer r.latencyMux.Unlock()
+	sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "elapsed      %s\n", r.elapsed.Round(time.Millisecond))
+	fmt.Fprintf(&b, "clients      %d connected, %d failed, %d closed by the server\n", r.connected.Load(), r.failed.Load(), r.dropped.Load())
+	fmt.Fprintf(&b, "messages     %d sent, %d received (%.0f/s), %d rejected\n",
+		r.sent.Load(), r.received.Load(), float64(r.received.Load())/r.elapsed.Seconds(), r.rejected.Load())
+	if len(r.latencies) > 0 {
+		fmt.Fprintf(&b, "latency      p50 %s, p95 %s, p99 %s, max %s\n",
+			r.percentile(50), r.percentile(95), r.percentile(99), r.latencies[len(r.latencies)-1])
+	}
+	return b.String()
+}
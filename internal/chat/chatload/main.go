@@ -0,0 +1,63 @@
+// Command chatload puts a chat server under load: it connects simulated WebSocket
+// clients spread over a number of rooms, has some of them send messages at a
+// steady rate, and reports throughput, rejections and delivery latency.
+//
+//	go run ./internal/chat/chatload -url ws://localhost:8080/api/chat -clients 1000 -rooms 10
+//
+// Rooms are named with -room-prefix and a number. The server must allow them,
+// so point it at an instance without a stream lookup or use live stream keys.
+// Every client connects from this host, so raise or disable the server's
+// per-address limits (CHAT_MAX_CONNECTIONS_PER_IP=0, CHAT_MAX_JOINS_PER_IP_PER_MINUTE=0).
+// Keep -rate under the server's rate limits unless rejections are what you are
+// measuring.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+)
+
+func main() {
+	cfg := loadConfig{}
+	flag.StringVar(&cfg.URL, "url", "ws://localhost:8080/api/chat", "chat WebSocket endpoint")
+	flag.IntVar(&cfg.Clients, "clients", 100, "simulated clients")
+	flag.IntVar(&cfg.Rooms, "rooms", 10, "rooms the clients are spread over")
+	flag.StringVar(&cfg.RoomPrefix, "room-prefix", "load-", "prefix of the room stream keys")
+	flag.IntVar(&cfg.SendersPercent, "senders", 10, "percentage of clients that send messages")
+	flag.Float64Var(&cfg.Rate, "rate", 0.2, "messages per second from each sender")
+	flag.DurationVar(&cfg.Duration, "duration", time.Minute, "how long to send after every client has connected")
+	flag.DurationVar(&cfg.Ramp, "ramp", 5*time.Second, "time over which clients connect")
+	flag.StringVar(&cfg.Token, "token", "", "API token sent as a bearer Authorization header")
+	flag.Parse()
+
+	if err := cfg.validate(); err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	log.Printf("Connecting %d clients to %d rooms over %s", cfg.Clients, cfg.Rooms, cfg.Ramp)
+	report := run(ctx, cfg)
+	fmt.Print(report)
+}
+
+// validate rejects configurations that can't generate load
+func (cfg loadConfig) validate() error {
+	switch {
+	case cfg.Clients < 1:
+		return fmt.Errorf("-clients must be at least 1")
+	case cfg.Rooms < 1:
+		return fmt.Errorf("-rooms must be at least 1")
+	case cfg.SendersPercent < 0 || cfg.SendersPercent > 100:
+		return fmt.Errorf("-senders must be a percentage")
+	case cfg.Rate <= 0 && cfg.SendersPercent > 0:
+		return fmt.Errorf("-rate must be positive")
+	}
+	return nil
+}
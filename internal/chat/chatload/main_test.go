@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/chat"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunDeliversAcrossRooms(t *testing.T) {
+	config := chat.DefaultConfig()
+	manager := chat.NewManager(config)
+	t.Cleanup(manager.Stop)
+	h := chat.NewWSHandler(manager, chat.NewRateLimiter(config))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/chat", h.HTTPHandler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	report := run(context.Background(), loadConfig{
+		URL:            "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat",
+		Clients:        6,
+		Rooms:          2,
+		RoomPrefix:     "load-",
+		SendersPercent: 50,
+		Rate:           2,
+		Duration:       time.Second,
+		Ramp:           100 * time.Millisecond,
+	})
+
+	require.EqualValues(t, 6, report.connected.Load())
+	require.Zero(t, report.failed.Load())
+	require.Positive(t, report.sent.Load())
+	require.Zero(t, report.rejected.Load())
+
+	// Each message reaches the clients in its room that had joined when it was sent,
+	// which is at least its sender and at most all three
+	require.GreaterOrEqual(t, report.received.Load(), report.sent.Load())
+	require.LessOrEqual(t, report.received.Load(), 3*report.sent.Load())
+	require.Len(t, report.latencies, int(report.received.Load()))
+	require.Contains(t, report.String(), "latency")
+}
+
+func TestValidate(t *testing.T) {
+	valid := loadConfig{Clients: 10, Rooms: 2, SendersPercent: 10, Rate: 1}
+	require.NoError(t, valid.validate())
+
+	invalid := valid
+	invalid.Rooms = 0
+	require.Error(t, invalid.validate())
+
+	invalid = valid
+	invalid.SendersPercent = 150
+	require.Error(t, invalid.validate())
+}
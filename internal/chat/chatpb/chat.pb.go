@@ -0,0 +1,2074 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.12
+// 	protoc        (unknown)
+// source: chat.proto
+
+package chatpb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type ClientFrame struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Frame:
+	//
+	//	*ClientFrame_Join
+	//	*ClientFrame_Message
+	//	*ClientFrame_Typing
+	//	*ClientFrame_Hello
+	//	*ClientFrame_Ping
+	//	*ClientFrame_Reserve
+	//	*ClientFrame_Stats
+	Frame         isClientFrame_Frame `protobuf_oneof:"frame"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ClientFrame) Reset() {
+	*x = ClientFrame{}
+	mi := &file_chat_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClientFrame) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClientFrame) ProtoMessage() {}
+
+func (x *ClientFrame) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClientFrame.ProtoReflect.Descriptor instead.
+func (*ClientFrame) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *ClientFrame) GetFrame() isClientFrame_Frame {
+	if x != nil {
+		return x.Frame
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetJoin() *Join {
+	if x != nil {
+		if x, ok := x.Frame.(*ClientFrame_Join); ok {
+			return x.Join
+		}
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetMessage() *SendMessage {
+	if x != nil {
+		if x, ok := x.Frame.(*ClientFrame_Message); ok {
+			return x.Message
+		}
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetTyping() *SetTyping {
+	if x != nil {
+		if x, ok := x.Frame.(*ClientFrame_Typing); ok {
+			return x.Typing
+		}
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetHello() *ClientHello {
+	if x != nil {
+		if x, ok := x.Frame.(*ClientFrame_Hello); ok {
+			return x.Hello
+		}
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetPing() *Ping {
+	if x != nil {
+		if x, ok := x.Frame.(*ClientFrame_Ping); ok {
+			return x.Ping
+		}
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetReserve() *Reserve {
+	if x != nil {
+		if x, ok := x.Frame.(*ClientFrame_Reserve); ok {
+			return x.Reserve
+		}
+	}
+	return nil
+}
+
+func (x *ClientFrame) GetStats() *Stats {
+	if x != nil {
+		if x, ok := x.Frame.(*ClientFrame_Stats); ok {
+			return x.Stats
+		}
+	}
+	return nil
+}
+
+type isClientFrame_Frame interface {
+	isClientFrame_Frame()
+}
+
+type ClientFrame_Join struct {
+	Join *Join `protobuf:"bytes,1,opt,name=join,proto3,oneof"`
+}
+
+type ClientFrame_Message struct {
+	Message *SendMessage `protobuf:"bytes,2,opt,name=message,proto3,oneof"`
+}
+
+type ClientFrame_Typing struct {
+	Typing *SetTyping `protobuf:"bytes,3,opt,name=typing,proto3,oneof"`
+}
+
+type ClientFrame_Hello struct {
+	Hello *ClientHello `protobuf:"bytes,4,opt,name=hello,proto3,oneof"`
+}
+
+type ClientFrame_Ping struct {
+	Ping *Ping `protobuf:"bytes,5,opt,name=ping,proto3,oneof"`
+}
+
+type ClientFrame_Reserve struct {
+	Reserve *Reserve `protobuf:"bytes,6,opt,name=reserve,proto3,oneof"`
+}
+
+type ClientFrame_Stats struct {
+	Stats *Stats `protobuf:"bytes,7,opt,name=stats,proto3,oneof"`
+}
+
+func (*ClientFrame_Join) isClientFrame_Frame() {}
+
+func (*ClientFrame_Message) isClientFrame_Frame() {}
+
+func (*ClientFrame_Typing) isClientFrame_Frame() {}
+
+func (*ClientFrame_Hello) isClientFrame_Frame() {}
+
+func (*ClientFrame_Ping) isClientFrame_Frame() {}
+
+func (*ClientFrame_Reserve) isClientFrame_Frame() {}
+
+func (*ClientFrame_Stats) isClientFrame_Frame() {}
+
+// Stats subscribes to, or unsubscribes from, periodic RoomStats events. The stream
+// needs a read:stats API token in its authorization metadata.
+type Stats struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	Subscribe       bool                   `protobuf:"varint,1,opt,name=subscribe,proto3" json:"subscribe,omitempty"`
+	IntervalSeconds uint32                 `protobuf:"varint,2,opt,name=interval_seconds,json=intervalSeconds,proto3" json:"interval_seconds,omitempty"` // between events, 0 for the default of 5
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Stats) Reset() {
+	*x = Stats{}
+	mi := &file_chat_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Stats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Stats) ProtoMessage() {}
+
+func (x *Stats) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Stats.ProtoReflect.Descriptor instead.
+func (*Stats) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Stats) GetSubscribe() bool {
+	if x != nil {
+		return x.Subscribe
+	}
+	return false
+}
+
+func (x *Stats) GetIntervalSeconds() uint32 {
+	if x != nil {
+		return x.IntervalSeconds
+	}
+	return 0
+}
+
+// Reserve asks for a message ID to send a message under later
+type Reserve struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Reserve) Reset() {
+	*x = Reserve{}
+	mi := &file_chat_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Reserve) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Reserve) ProtoMessage() {}
+
+func (x *Reserve) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Reserve.ProtoReflect.Descriptor instead.
+func (*Reserve) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{2}
+}
+
+// Ping asks the server to echo the client's clock for latency measurement
+type Ping struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ClientTimeMs  int64                  `protobuf:"varint,1,opt,name=client_time_ms,json=clientTimeMs,proto3" json:"client_time_ms,omitempty"` // milliseconds since the Unix epoch
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ping) Reset() {
+	*x = Ping{}
+	mi := &file_chat_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ping) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ping) ProtoMessage() {}
+
+func (x *Ping) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ping.ProtoReflect.Descriptor instead.
+func (*Ping) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Ping) GetClientTimeMs() int64 {
+	if x != nil {
+		return x.ClientTimeMs
+	}
+	return 0
+}
+
+// ClientHello tells the server which protocol version the client speaks
+type ClientHello struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ProtocolVersion uint32                 `protobuf:"varint,1,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *ClientHello) Reset() {
+	*x = ClientHello{}
+	mi := &file_chat_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ClientHello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ClientHello) ProtoMessage() {}
+
+func (x *ClientHello) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ClientHello.ProtoReflect.Descriptor instead.
+func (*ClientHello) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ClientHello) GetProtocolVersion() uint32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+type Join struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	StreamKey     string                 `protobuf:"bytes,1,opt,name=stream_key,json=streamKey,proto3" json:"stream_key,omitempty"`
+	UserId        string                 `protobuf:"bytes,2,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Username      string                 `protobuf:"bytes,3,opt,name=username,proto3" json:"username,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Join) Reset() {
+	*x = Join{}
+	mi := &file_chat_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Join) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Join) ProtoMessage() {}
+
+func (x *Join) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Join.ProtoReflect.Descriptor instead.
+func (*Join) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Join) GetStreamKey() string {
+	if x != nil {
+		return x.StreamKey
+	}
+	return ""
+}
+
+func (x *Join) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *Join) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+type SendMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"` // from a Reserved event, to broadcast the message under that ID
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SendMessage) Reset() {
+	*x = SendMessage{}
+	mi := &file_chat_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SendMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SendMessage) ProtoMessage() {}
+
+func (x *SendMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SendMessage.ProtoReflect.Descriptor instead.
+func (*SendMessage) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *SendMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *SendMessage) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+type SetTyping struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	IsTyping      bool                   `protobuf:"varint,1,opt,name=is_typing,json=isTyping,proto3" json:"is_typing,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetTyping) Reset() {
+	*x = SetTyping{}
+	mi := &file_chat_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetTyping) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetTyping) ProtoMessage() {}
+
+func (x *SetTyping) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetTyping.ProtoReflect.Descriptor instead.
+func (*SetTyping) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *SetTyping) GetIsTyping() bool {
+	if x != nil {
+		return x.IsTyping
+	}
+	return false
+}
+
+type ServerEvent struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Timestamp *timestamppb.Timestamp `protobuf:"bytes,1,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Room      string                 `protobuf:"bytes,15,opt,name=room,proto3" json:"room,omitempty"` // stream key of the room the event belongs to
+	// Types that are valid to be assigned to Event:
+	//
+	//	*ServerEvent_Message
+	//	*ServerEvent_History
+	//	*ServerEvent_Users
+	//	*ServerEvent_UserJoined
+	//	*ServerEvent_UserLeft
+	//	*ServerEvent_Typing
+	//	*ServerEvent_System
+	//	*ServerEvent_Error
+	//	*ServerEvent_Timeout
+	//	*ServerEvent_Hello
+	//	*ServerEvent_MessageBatch
+	//	*ServerEvent_Pong
+	//	*ServerEvent_Reserved
+	//	*ServerEvent_RoomStats
+	Event         isServerEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ServerEvent) Reset() {
+	*x = ServerEvent{}
+	mi := &file_chat_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ServerEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ServerEvent) ProtoMessage() {}
+
+func (x *ServerEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ServerEvent.ProtoReflect.Descriptor instead.
+func (*ServerEvent) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *ServerEvent) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetRoom() string {
+	if x != nil {
+		return x.Room
+	}
+	return ""
+}
+
+func (x *ServerEvent) GetEvent() isServerEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetMessage() *ChatMessage {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_Message); ok {
+			return x.Message
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetHistory() *History {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_History); ok {
+			return x.History
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetUsers() *UserList {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_Users); ok {
+			return x.Users
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetUserJoined() *UserEvent {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_UserJoined); ok {
+			return x.UserJoined
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetUserLeft() *UserEvent {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_UserLeft); ok {
+			return x.UserLeft
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetTyping() *TypingEvent {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_Typing); ok {
+			return x.Typing
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetSystem() *SystemMessage {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_System); ok {
+			return x.System
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetTimeout() *Timeout {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_Timeout); ok {
+			return x.Timeout
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetHello() *Hello {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_Hello); ok {
+			return x.Hello
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetMessageBatch() *MessageBatch {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_MessageBatch); ok {
+			return x.MessageBatch
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetPong() *Pong {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_Pong); ok {
+			return x.Pong
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetReserved() *Reserved {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_Reserved); ok {
+			return x.Reserved
+		}
+	}
+	return nil
+}
+
+func (x *ServerEvent) GetRoomStats() *RoomStats {
+	if x != nil {
+		if x, ok := x.Event.(*ServerEvent_RoomStats); ok {
+			return x.RoomStats
+		}
+	}
+	return nil
+}
+
+type isServerEvent_Event interface {
+	isServerEvent_Event()
+}
+
+type ServerEvent_Message struct {
+	Message *ChatMessage `protobuf:"bytes,2,opt,name=message,proto3,oneof"`
+}
+
+type ServerEvent_History struct {
+	History *History `protobuf:"bytes,3,opt,name=history,proto3,oneof"`
+}
+
+type ServerEvent_Users struct {
+	Users *UserList `protobuf:"bytes,4,opt,name=users,proto3,oneof"`
+}
+
+type ServerEvent_UserJoined struct {
+	UserJoined *UserEvent `protobuf:"bytes,5,opt,name=user_joined,json=userJoined,proto3,oneof"`
+}
+
+type ServerEvent_UserLeft struct {
+	UserLeft *UserEvent `protobuf:"bytes,6,opt,name=user_left,json=userLeft,proto3,oneof"`
+}
+
+type ServerEvent_Typing struct {
+	Typing *TypingEvent `protobuf:"bytes,7,opt,name=typing,proto3,oneof"`
+}
+
+type ServerEvent_System struct {
+	System *SystemMessage `protobuf:"bytes,8,opt,name=system,proto3,oneof"`
+}
+
+type ServerEvent_Error struct {
+	Error *Error `protobuf:"bytes,9,opt,name=error,proto3,oneof"`
+}
+
+type ServerEvent_Timeout struct {
+	Timeout *Timeout `protobuf:"bytes,10,opt,name=timeout,proto3,oneof"`
+}
+
+type ServerEvent_Hello struct {
+	Hello *Hello `protobuf:"bytes,11,opt,name=hello,proto3,oneof"`
+}
+
+type ServerEvent_MessageBatch struct {
+	MessageBatch *MessageBatch `protobuf:"bytes,12,opt,name=message_batch,json=messageBatch,proto3,oneof"`
+}
+
+type ServerEvent_Pong struct {
+	Pong *Pong `protobuf:"bytes,13,opt,name=pong,proto3,oneof"`
+}
+
+type ServerEvent_Reserved struct {
+	Reserved *Reserved `protobuf:"bytes,14,opt,name=reserved,proto3,oneof"`
+}
+
+type ServerEvent_RoomStats struct {
+	RoomStats *RoomStats `protobuf:"bytes,16,opt,name=room_stats,json=roomStats,proto3,oneof"`
+}
+
+func (*ServerEvent_Message) isServerEvent_Event() {}
+
+func (*ServerEvent_History) isServerEvent_Event() {}
+
+func (*ServerEvent_Users) isServerEvent_Event() {}
+
+func (*ServerEvent_UserJoined) isServerEvent_Event() {}
+
+func (*ServerEvent_UserLeft) isServerEvent_Event() {}
+
+func (*ServerEvent_Typing) isServerEvent_Event() {}
+
+func (*ServerEvent_System) isServerEvent_Event() {}
+
+func (*ServerEvent_Error) isServerEvent_Event() {}
+
+func (*ServerEvent_Timeout) isServerEvent_Event() {}
+
+func (*ServerEvent_Hello) isServerEvent_Event() {}
+
+func (*ServerEvent_MessageBatch) isServerEvent_Event() {}
+
+func (*ServerEvent_Pong) isServerEvent_Event() {}
+
+func (*ServerEvent_Reserved) isServerEvent_Event() {}
+
+func (*ServerEvent_RoomStats) isServerEvent_Event() {}
+
+// RoomStats reports a room's activity over the last interval
+type RoomStats struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	StreamKey         string                 `protobuf:"bytes,1,opt,name=stream_key,json=streamKey,proto3" json:"stream_key,omitempty"`
+	Users             int32                  `protobuf:"varint,2,opt,name=users,proto3" json:"users,omitempty"`
+	Viewers           int32                  `protobuf:"varint,3,opt,name=viewers,proto3" json:"viewers,omitempty"`                                                 // users and read-only subscribers
+	Messages          int64                  `protobuf:"varint,4,opt,name=messages,proto3" json:"messages,omitempty"`                                               // since the room opened
+	MessagesPerMinute float64                `protobuf:"fixed64,5,opt,name=messages_per_minute,json=messagesPerMinute,proto3" json:"messages_per_minute,omitempty"` // over the last interval
+	RateLimitHits     int64                  `protobuf:"varint,6,opt,name=rate_limit_hits,json=rateLimitHits,proto3" json:"rate_limit_hits,omitempty"`              // messages rejected by the rate limiter in the last interval
+	IntervalSeconds   int32                  `protobuf:"varint,7,opt,name=interval_seconds,json=intervalSeconds,proto3" json:"interval_seconds,omitempty"`
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *RoomStats) Reset() {
+	*x = RoomStats{}
+	mi := &file_chat_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RoomStats) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RoomStats) ProtoMessage() {}
+
+func (x *RoomStats) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RoomStats.ProtoReflect.Descriptor instead.
+func (*RoomStats) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *RoomStats) GetStreamKey() string {
+	if x != nil {
+		return x.StreamKey
+	}
+	return ""
+}
+
+func (x *RoomStats) GetUsers() int32 {
+	if x != nil {
+		return x.Users
+	}
+	return 0
+}
+
+func (x *RoomStats) GetViewers() int32 {
+	if x != nil {
+		return x.Viewers
+	}
+	return 0
+}
+
+func (x *RoomStats) GetMessages() int64 {
+	if x != nil {
+		return x.Messages
+	}
+	return 0
+}
+
+func (x *RoomStats) GetMessagesPerMinute() float64 {
+	if x != nil {
+		return x.MessagesPerMinute
+	}
+	return 0
+}
+
+func (x *RoomStats) GetRateLimitHits() int64 {
+	if x != nil {
+		return x.RateLimitHits
+	}
+	return 0
+}
+
+func (x *RoomStats) GetIntervalSeconds() int32 {
+	if x != nil {
+		return x.IntervalSeconds
+	}
+	return 0
+}
+
+// Reserved answers a Reserve with an ID valid until expires_at
+type Reserved struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	ExpiresAt     *timestamppb.Timestamp `protobuf:"bytes,2,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Reserved) Reset() {
+	*x = Reserved{}
+	mi := &file_chat_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Reserved) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Reserved) ProtoMessage() {}
+
+func (x *Reserved) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Reserved.ProtoReflect.Descriptor instead.
+func (*Reserved) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Reserved) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *Reserved) GetExpiresAt() *timestamppb.Timestamp {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return nil
+}
+
+// Pong answers a Ping with the client's timestamp and the server's clock
+type Pong struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ClientTimeMs  int64                  `protobuf:"varint,1,opt,name=client_time_ms,json=clientTimeMs,proto3" json:"client_time_ms,omitempty"`
+	ServerTimeMs  int64                  `protobuf:"varint,2,opt,name=server_time_ms,json=serverTimeMs,proto3" json:"server_time_ms,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Pong) Reset() {
+	*x = Pong{}
+	mi := &file_chat_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Pong) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Pong) ProtoMessage() {}
+
+func (x *Pong) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Pong.ProtoReflect.Descriptor instead.
+func (*Pong) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *Pong) GetClientTimeMs() int64 {
+	if x != nil {
+		return x.ClientTimeMs
+	}
+	return 0
+}
+
+func (x *Pong) GetServerTimeMs() int64 {
+	if x != nil {
+		return x.ServerTimeMs
+	}
+	return 0
+}
+
+// Hello is the first event of every session
+type Hello struct {
+	state              protoimpl.MessageState `protogen:"open.v1"`
+	ProtocolVersion    uint32                 `protobuf:"varint,1,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	MinProtocolVersion uint32                 `protobuf:"varint,2,opt,name=min_protocol_version,json=minProtocolVersion,proto3" json:"min_protocol_version,omitempty"`
+	Features           map[string]bool        `protobuf:"bytes,3,rep,name=features,proto3" json:"features,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"varint,2,opt,name=value"`
+	unknownFields      protoimpl.UnknownFields
+	sizeCache          protoimpl.SizeCache
+}
+
+func (x *Hello) Reset() {
+	*x = Hello{}
+	mi := &file_chat_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Hello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Hello) ProtoMessage() {}
+
+func (x *Hello) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Hello.ProtoReflect.Descriptor instead.
+func (*Hello) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Hello) GetProtocolVersion() uint32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *Hello) GetMinProtocolVersion() uint32 {
+	if x != nil {
+		return x.MinProtocolVersion
+	}
+	return 0
+}
+
+func (x *Hello) GetFeatures() map[string]bool {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+type ChatMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	StreamKey     string                 `protobuf:"bytes,2,opt,name=stream_key,json=streamKey,proto3" json:"stream_key,omitempty"`
+	UserId        string                 `protobuf:"bytes,3,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Username      string                 `protobuf:"bytes,4,opt,name=username,proto3" json:"username,omitempty"`
+	Message       string                 `protobuf:"bytes,5,opt,name=message,proto3" json:"message,omitempty"`
+	Timestamp     *timestamppb.Timestamp `protobuf:"bytes,6,opt,name=timestamp,proto3" json:"timestamp,omitempty"`
+	Origin        *MessageOrigin         `protobuf:"bytes,7,opt,name=origin,proto3" json:"origin,omitempty"` // set on messages relayed in by a bridge
+	Seq           int64                  `protobuf:"varint,8,opt,name=seq,proto3" json:"seq,omitempty"`      // numbered per room as messages are stored
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChatMessage) Reset() {
+	*x = ChatMessage{}
+	mi := &file_chat_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChatMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChatMessage) ProtoMessage() {}
+
+func (x *ChatMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChatMessage.ProtoReflect.Descriptor instead.
+func (*ChatMessage) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *ChatMessage) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetStreamKey() string {
+	if x != nil {
+		return x.StreamKey
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *ChatMessage) GetTimestamp() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Timestamp
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetOrigin() *MessageOrigin {
+	if x != nil {
+		return x.Origin
+	}
+	return nil
+}
+
+func (x *ChatMessage) GetSeq() int64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+// MessageOrigin records where a bridged message was posted before it reached chat
+type MessageOrigin struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	System        string                 `protobuf:"bytes,1,opt,name=system,proto3" json:"system,omitempty"`
+	Id            string                 `protobuf:"bytes,2,opt,name=id,proto3" json:"id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessageOrigin) Reset() {
+	*x = MessageOrigin{}
+	mi := &file_chat_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageOrigin) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageOrigin) ProtoMessage() {}
+
+func (x *MessageOrigin) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageOrigin.ProtoReflect.Descriptor instead.
+func (*MessageOrigin) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *MessageOrigin) GetSystem() string {
+	if x != nil {
+		return x.System
+	}
+	return ""
+}
+
+func (x *MessageOrigin) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// History holds the recent messages of a room, oldest first
+type History struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*ChatMessage         `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *History) Reset() {
+	*x = History{}
+	mi := &file_chat_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *History) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*History) ProtoMessage() {}
+
+func (x *History) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use History.ProtoReflect.Descriptor instead.
+func (*History) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *History) GetMessages() []*ChatMessage {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+// MessageBatch holds chat messages coalesced into one frame, oldest first
+type MessageBatch struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*ChatMessage         `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessageBatch) Reset() {
+	*x = MessageBatch{}
+	mi := &file_chat_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageBatch) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageBatch) ProtoMessage() {}
+
+func (x *MessageBatch) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageBatch.ProtoReflect.Descriptor instead.
+func (*MessageBatch) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *MessageBatch) GetMessages() []*ChatMessage {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+type UserList struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Users         []*User                `protobuf:"bytes,1,rep,name=users,proto3" json:"users,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserList) Reset() {
+	*x = UserList{}
+	mi := &file_chat_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserList) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserList) ProtoMessage() {}
+
+func (x *UserList) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserList.ProtoReflect.Descriptor instead.
+func (*UserList) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *UserList) GetUsers() []*User {
+	if x != nil {
+		return x.Users
+	}
+	return nil
+}
+
+type User struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Username      string                 `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *User) Reset() {
+	*x = User{}
+	mi := &file_chat_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *User) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*User) ProtoMessage() {}
+
+func (x *User) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use User.ProtoReflect.Descriptor instead.
+func (*User) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *User) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *User) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+type UserEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Username      string                 `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UserEvent) Reset() {
+	*x = UserEvent{}
+	mi := &file_chat_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserEvent) ProtoMessage() {}
+
+func (x *UserEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserEvent.ProtoReflect.Descriptor instead.
+func (*UserEvent) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *UserEvent) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *UserEvent) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+type TypingEvent struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UserId        string                 `protobuf:"bytes,1,opt,name=user_id,json=userId,proto3" json:"user_id,omitempty"`
+	Username      string                 `protobuf:"bytes,2,opt,name=username,proto3" json:"username,omitempty"`
+	IsTyping      bool                   `protobuf:"varint,3,opt,name=is_typing,json=isTyping,proto3" json:"is_typing,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TypingEvent) Reset() {
+	*x = TypingEvent{}
+	mi := &file_chat_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TypingEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TypingEvent) ProtoMessage() {}
+
+func (x *TypingEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TypingEvent.ProtoReflect.Descriptor instead.
+func (*TypingEvent) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *TypingEvent) GetUserId() string {
+	if x != nil {
+		return x.UserId
+	}
+	return ""
+}
+
+func (x *TypingEvent) GetUsername() string {
+	if x != nil {
+		return x.Username
+	}
+	return ""
+}
+
+func (x *TypingEvent) GetIsTyping() bool {
+	if x != nil {
+		return x.IsTyping
+	}
+	return false
+}
+
+type SystemMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Message       string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SystemMessage) Reset() {
+	*x = SystemMessage{}
+	mi := &file_chat_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SystemMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SystemMessage) ProtoMessage() {}
+
+func (x *SystemMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SystemMessage.ProtoReflect.Descriptor instead.
+func (*SystemMessage) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *SystemMessage) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+type Error struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Message string                 `protobuf:"bytes,1,opt,name=message,proto3" json:"message,omitempty"`
+	// Set when the error comes from the rate limiter rather than a bad request
+	RateLimited bool `protobuf:"varint,2,opt,name=rate_limited,json=rateLimited,proto3" json:"rate_limited,omitempty"`
+	// Machine-readable code such as STREAM_NOT_FOUND, when the error has one
+	Code string `protobuf:"bytes,3,opt,name=code,proto3" json:"code,omitempty"`
+	// Invalid fields of a rejected client frame, when code is INVALID_FRAME
+	Fields []*FieldError `protobuf:"bytes,4,rep,name=fields,proto3" json:"fields,omitempty"`
+	// Specifics of errors about limits
+	Details       *ErrorDetails `protobuf:"bytes,5,opt,name=details,proto3" json:"details,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_chat_proto_msgTypes[22]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[22]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{22}
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Error) GetRateLimited() bool {
+	if x != nil {
+		return x.RateLimited
+	}
+	return false
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetFields() []*FieldError {
+	if x != nil {
+		return x.Fields
+	}
+	return nil
+}
+
+func (x *Error) GetDetails() *ErrorDetails {
+	if x != nil {
+		return x.Details
+	}
+	return nil
+}
+
+// ErrorDetails are the machine-readable specifics of an error; zero when not applicable
+type ErrorDetails struct {
+	state             protoimpl.MessageState `protogen:"open.v1"`
+	RetryAfterSeconds int32                  `protobuf:"varint,1,opt,name=retry_after_seconds,json=retryAfterSeconds,proto3" json:"retry_after_seconds,omitempty"`
+	Limit             int32                  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	Window            int32                  `protobuf:"varint,3,opt,name=window,proto3" json:"window,omitempty"` // seconds the limit counts over
+	Tier              string                 `protobuf:"bytes,4,opt,name=tier,proto3" json:"tier,omitempty"`      // which limit was exceeded, e.g. "burst" or "slow_mode"
+	unknownFields     protoimpl.UnknownFields
+	sizeCache         protoimpl.SizeCache
+}
+
+func (x *ErrorDetails) Reset() {
+	*x = ErrorDetails{}
+	mi := &file_chat_proto_msgTypes[23]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ErrorDetails) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ErrorDetails) ProtoMessage() {}
+
+func (x *ErrorDetails) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[23]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ErrorDetails.ProtoReflect.Descriptor instead.
+func (*ErrorDetails) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{23}
+}
+
+func (x *ErrorDetails) GetRetryAfterSeconds() int32 {
+	if x != nil {
+		return x.RetryAfterSeconds
+	}
+	return 0
+}
+
+func (x *ErrorDetails) GetLimit() int32 {
+	if x != nil {
+		return x.Limit
+	}
+	return 0
+}
+
+func (x *ErrorDetails) GetWindow() int32 {
+	if x != nil {
+		return x.Window
+	}
+	return 0
+}
+
+func (x *ErrorDetails) GetTier() string {
+	if x != nil {
+		return x.Tier
+	}
+	return ""
+}
+
+type FieldError struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         string                 `protobuf:"bytes,1,opt,name=field,proto3" json:"field,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FieldError) Reset() {
+	*x = FieldError{}
+	mi := &file_chat_proto_msgTypes[24]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FieldError) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FieldError) ProtoMessage() {}
+
+func (x *FieldError) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[24]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FieldError.ProtoReflect.Descriptor instead.
+func (*FieldError) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{24}
+}
+
+func (x *FieldError) GetField() string {
+	if x != nil {
+		return x.Field
+	}
+	return ""
+}
+
+func (x *FieldError) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+// Timeout reports the seconds left of the user's timeout, or zero once it has ended
+type Timeout struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	DurationSeconds float64                `protobuf:"fixed64,1,opt,name=duration_seconds,json=durationSeconds,proto3" json:"duration_seconds,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Timeout) Reset() {
+	*x = Timeout{}
+	mi := &file_chat_proto_msgTypes[25]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Timeout) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Timeout) ProtoMessage() {}
+
+func (x *Timeout) ProtoReflect() protoreflect.Message {
+	mi := &file_chat_proto_msgTypes[25]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Timeout.ProtoReflect.Descriptor instead.
+func (*Timeout) Descriptor() ([]byte, []int) {
+	return file_chat_proto_rawDescGZIP(), []int{25}
+}
+
+func (x *Timeout) GetDurationSeconds() float64 {
+	if x != nil {
+		return x.DurationSeconds
+	}
+	return 0
+}
+
+var File_chat_proto protoreflect.FileDescriptor
+
+const file_chat_proto_rawDesc = "" +
+	"\n" +
+	"\n" +
+	"chat.proto\x12\x14broadcastbox.chat.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\x9f\x03\n" +
+	"\vClientFrame\x120\n" +
+	"\x04join\x18\x01 \x01(\v2\x1a.broadcastbox.chat.v1.JoinH\x00R\x04join\x12=\n" +
+	"\amessage\x18\x02 \x01(\v2!.broadcastbox.chat.v1.SendMessageH\x00R\amessage\x129\n" +
+	"\x06typing\x18\x03 \x01(\v2\x1f.broadcastbox.chat.v1.SetTypingH\x00R\x06typing\x129\n" +
+	"\x05hello\x18\x04 \x01(\v2!.broadcastbox.chat.v1.ClientHelloH\x00R\x05hello\x120\n" +
+	"\x04ping\x18\x05 \x01(\v2\x1a.broadcastbox.chat.v1.PingH\x00R\x04ping\x129\n" +
+	"\areserve\x18\x06 \x01(\v2\x1d.broadcastbox.chat.v1.ReserveH\x00R\areserve\x123\n" +
+	"\x05stats\x18\a \x01(\v2\x1b.broadcastbox.chat.v1.StatsH\x00R\x05statsB\a\n" +
+	"\x05frame\"P\n" +
+	"\x05Stats\x12\x1c\n" +
+	"\tsubscribe\x18\x01 \x01(\bR\tsubscribe\x12)\n" +
+	"\x10interval_seconds\x18\x02 \x01(\rR\x0fintervalSeconds\"\t\n" +
+	"\aReserve\",\n" +
+	"\x04Ping\x12$\n" +
+	"\x0eclient_time_ms\x18\x01 \x01(\x03R\fclientTimeMs\"8\n" +
+	"\vClientHello\x12)\n" +
+	"\x10protocol_version\x18\x01 \x01(\rR\x0fprotocolVersion\"Z\n" +
+	"\x04Join\x12\x1d\n" +
+	"\n" +
+	"stream_key\x18\x01 \x01(\tR\tstreamKey\x12\x17\n" +
+	"\auser_id\x18\x02 \x01(\tR\x06userId\x12\x1a\n" +
+	"\busername\x18\x03 \x01(\tR\busername\"7\n" +
+	"\vSendMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\"(\n" +
+	"\tSetTyping\x12\x1b\n" +
+	"\tis_typing\x18\x01 \x01(\bR\bisTyping\"\xb8\a\n" +
+	"\vServerEvent\x128\n" +
+	"\ttimestamp\x18\x01 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12\x12\n" +
+	"\x04room\x18\x0f \x01(\tR\x04room\x12=\n" +
+	"\amessage\x18\x02 \x01(\v2!.broadcastbox.chat.v1.ChatMessageH\x00R\amessage\x129\n" +
+	"\ahistory\x18\x03 \x01(\v2\x1d.broadcastbox.chat.v1.HistoryH\x00R\ahistory\x126\n" +
+	"\x05users\x18\x04 \x01(\v2\x1e.broadcastbox.chat.v1.UserListH\x00R\x05users\x12B\n" +
+	"\vuser_joined\x18\x05 \x01(\v2\x1f.broadcastbox.chat.v1.UserEventH\x00R\n" +
+	"userJoined\x12>\n" +
+	"\tuser_left\x18\x06 \x01(\v2\x1f.broadcastbox.chat.v1.UserEventH\x00R\buserLeft\x12;\n" +
+	"\x06typing\x18\a \x01(\v2!.broadcastbox.chat.v1.TypingEventH\x00R\x06typing\x12=\n" +
+	"\x06system\x18\b \x01(\v2#.broadcastbox.chat.v1.SystemMessageH\x00R\x06system\x123\n" +
+	"\x05error\x18\t \x01(\v2\x1b.broadcastbox.chat.v1.ErrorH\x00R\x05error\x129\n" +
+	"\atimeout\x18\n" +
+	" \x01(\v2\x1d.broadcastbox.chat.v1.TimeoutH\x00R\atimeout\x123\n" +
+	"\x05hello\x18\v \x01(\v2\x1b.broadcastbox.chat.v1.HelloH\x00R\x05hello\x12I\n" +
+	"\rmessage_batch\x18\f \x01(\v2\".broadcastbox.chat.v1.MessageBatchH\x00R\fmessageBatch\x120\n" +
+	"\x04pong\x18\r \x01(\v2\x1a.broadcastbox.chat.v1.PongH\x00R\x04pong\x12<\n" +
+	"\breserved\x18\x0e \x01(\v2\x1e.broadcastbox.chat.v1.ReservedH\x00R\breserved\x12@\n" +
+	"\n" +
+	"room_stats\x18\x10 \x01(\v2\x1f.broadcastbox.chat.v1.RoomStatsH\x00R\troomStatsB\a\n" +
+	"\x05event\"\xf9\x01\n" +
+	"\tRoomStats\x12\x1d\n" +
+	"\n" +
+	"stream_key\x18\x01 \x01(\tR\tstreamKey\x12\x14\n" +
+	"\x05users\x18\x02 \x01(\x05R\x05users\x12\x18\n" +
+	"\aviewers\x18\x03 \x01(\x05R\aviewers\x12\x1a\n" +
+	"\bmessages\x18\x04 \x01(\x03R\bmessages\x12.\n" +
+	"\x13messages_per_minute\x18\x05 \x01(\x01R\x11messagesPerMinute\x12&\n" +
+	"\x0frate_limit_hits\x18\x06 \x01(\x03R\rrateLimitHits\x12)\n" +
+	"\x10interval_seconds\x18\a \x01(\x05R\x0fintervalSeconds\"U\n" +
+	"\bReserved\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x129\n" +
+	"\n" +
+	"expires_at\x18\x02 \x01(\v2\x1a.google.protobuf.TimestampR\texpiresAt\"R\n" +
+	"\x04Pong\x12$\n" +
+	"\x0eclient_time_ms\x18\x01 \x01(\x03R\fclientTimeMs\x12$\n" +
+	"\x0eserver_time_ms\x18\x02 \x01(\x03R\fserverTimeMs\"\xe8\x01\n" +
+	"\x05Hello\x12)\n" +
+	"\x10protocol_version\x18\x01 \x01(\rR\x0fprotocolVersion\x120\n" +
+	"\x14min_protocol_version\x18\x02 \x01(\rR\x12minProtocolVersion\x12E\n" +
+	"\bfeatures\x18\x03 \x03(\v2).broadcastbox.chat.v1.Hello.FeaturesEntryR\bfeatures\x1a;\n" +
+	"\rFeaturesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\bR\x05value:\x028\x01\"\x94\x02\n" +
+	"\vChatMessage\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1d\n" +
+	"\n" +
+	"stream_key\x18\x02 \x01(\tR\tstreamKey\x12\x17\n" +
+	"\auser_id\x18\x03 \x01(\tR\x06userId\x12\x1a\n" +
+	"\busername\x18\x04 \x01(\tR\busername\x12\x18\n" +
+	"\amessage\x18\x05 \x01(\tR\amessage\x128\n" +
+	"\ttimestamp\x18\x06 \x01(\v2\x1a.google.protobuf.TimestampR\ttimestamp\x12;\n" +
+	"\x06origin\x18\a \x01(\v2#.broadcastbox.chat.v1.MessageOriginR\x06origin\x12\x10\n" +
+	"\x03seq\x18\b \x01(\x03R\x03seq\"7\n" +
+	"\rMessageOrigin\x12\x16\n" +
+	"\x06system\x18\x01 \x01(\tR\x06system\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\tR\x02id\"H\n" +
+	"\aHistory\x12=\n" +
+	"\bmessages\x18\x01 \x03(\v2!.broadcastbox.chat.v1.ChatMessageR\bmessages\"M\n" +
+	"\fMessageBatch\x12=\n" +
+	"\bmessages\x18\x01 \x03(\v2!.broadcastbox.chat.v1.ChatMessageR\bmessages\"<\n" +
+	"\bUserList\x120\n" +
+	"\x05users\x18\x01 \x03(\v2\x1a.broadcastbox.chat.v1.UserR\x05users\";\n" +
+	"\x04User\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1a\n" +
+	"\busername\x18\x02 \x01(\tR\busername\"@\n" +
+	"\tUserEvent\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1a\n" +
+	"\busername\x18\x02 \x01(\tR\busername\"_\n" +
+	"\vTypingEvent\x12\x17\n" +
+	"\auser_id\x18\x01 \x01(\tR\x06userId\x12\x1a\n" +
+	"\busername\x18\x02 \x01(\tR\busername\x12\x1b\n" +
+	"\tis_typing\x18\x03 \x01(\bR\bisTyping\")\n" +
+	"\rSystemMessage\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\"\xd0\x01\n" +
+	"\x05Error\x12\x18\n" +
+	"\amessage\x18\x01 \x01(\tR\amessage\x12!\n" +
+	"\frate_limited\x18\x02 \x01(\bR\vrateLimited\x12\x12\n" +
+	"\x04code\x18\x03 \x01(\tR\x04code\x128\n" +
+	"\x06fields\x18\x04 \x03(\v2 .broadcastbox.chat.v1.FieldErrorR\x06fields\x12<\n" +
+	"\adetails\x18\x05 \x01(\v2\".broadcastbox.chat.v1.ErrorDetailsR\adetails\"\x80\x01\n" +
+	"\fErrorDetails\x12.\n" +
+	"\x13retry_after_seconds\x18\x01 \x01(\x05R\x11retryAfterSeconds\x12\x14\n" +
+	"\x05limit\x18\x02 \x01(\x05R\x05limit\x12\x16\n" +
+	"\x06window\x18\x03 \x01(\x05R\x06window\x12\x12\n" +
+	"\x04tier\x18\x04 \x01(\tR\x04tier\"<\n" +
+	"\n" +
+	"FieldError\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\tR\x05field\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\"4\n" +
+	"\aTimeout\x12)\n" +
+	"\x10duration_seconds\x18\x01 \x01(\x01R\x0fdurationSeconds2[\n" +
+	"\x04Chat\x12S\n" +
+	"\aConnect\x12!.broadcastbox.chat.v1.ClientFrame\x1a!.broadcastbox.chat.v1.ServerEvent(\x010\x01B7Z5github.com/glimesh/broadcast-box/internal/chat/chatpbb\x06proto3"
+
+var (
+	file_chat_proto_rawDescOnce sync.Once
+	file_chat_proto_rawDescData []byte
+)
+
+func file_chat_proto_rawDescGZIP() []byte {
+	file_chat_proto_rawDescOnce.Do(func() {
+		file_chat_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_chat_proto_rawDesc), len(file_chat_proto_rawDesc)))
+	})
+	return file_chat_proto_rawDescData
+}
+
+var file_chat_proto_msgTypes = make([]protoimpl.MessageInfo, 27)
+var file_chat_proto_goTypes = []any{
+	(*ClientFrame)(nil),           // 0: broadcastbox.chat.v1.ClientFrame
+	(*Stats)(nil),                 // 1: broadcastbox.chat.v1.Stats
+	(*Reserve)(nil),               // 2: broadcastbox.chat.v1.Reserve
+	(*Ping)(nil),                  // 3: broadcastbox.chat.v1.Ping
+	(*ClientHello)(nil),           // 4: broadcastbox.chat.v1.ClientHello
+	(*Join)(nil),                  // 5: broadcastbox.chat.v1.Join
+	(*SendMessage)(nil),           // 6: broadcastbox.chat.v1.SendMessage
+	(*SetTyping)(nil),             // 7: broadcastbox.chat.v1.SetTyping
+	(*ServerEvent)(nil),           // 8: broadcastbox.chat.v1.ServerEvent
+	(*RoomStats)(nil),             // 9: broadcastbox.chat.v1.RoomStats
+	(*Reserved)(nil),              // 10: broadcastbox.chat.v1.Reserved
+	(*Pong)(nil),                  // 11: broadcastbox.chat.v1.Pong
+	(*Hello)(nil),                 // 12: broadcastbox.chat.v1.Hello
+	(*ChatMessage)(nil),           // 13: broadcastbox.chat.v1.ChatMessage
+	(*MessageOrigin)(nil),         // 14: broadcastbox.chat.v1.MessageOrigin
+	(*History)(nil),               // 15: broadcastbox.chat.v1.History
+	(*MessageBatch)(nil),          // 16: broadcastbox.chat.v1.MessageBatch
+	(*UserList)(nil),              // 17: broadcastbox.chat.v1.UserList
+	(*User)(nil),                  // 18: broadcastbox.chat.v1.User
+	(*UserEvent)(nil),             // 19: broadcastbox.chat.v1.UserEvent
+	(*TypingEvent)(nil),           // 20: broadcastbox.chat.v1.TypingEvent
+	(*SystemMessage)(nil),         // 21: broadcastbox.chat.v1.SystemMessage
+	(*Error)(nil),                 // 22: broadcastbox.chat.v1.Error
+	(*ErrorDetails)(nil),          // 23: broadcastbox.chat.v1.ErrorDetails
+	(*FieldError)(nil),            // 24: broadcastbox.chat.v1.FieldError
+	(*Timeout)(nil),               // 25: broadcastbox.chat.v1.Timeout
+	nil,                           // 26: broadcastbox.chat.v1.Hello.FeaturesEntry
+	(*timestamppb.Timestamp)(nil), // 27: google.protobuf.Timestamp
+}
+var file_chat_proto_depIdxs = []int32{
+	5,  // 0: broadcastbox.chat.v1.ClientFrame.join:type_name -> broadcastbox.chat.v1.Join
+	6,  // 1: broadcastbox.chat.v1.ClientFrame.message:type_name -> broadcastbox.chat.v1.SendMessage
+	7,  // 2: broadcastbox.chat.v1.ClientFrame.typing:type_name -> broadcastbox.chat.v1.SetTyping
+	4,  // 3: broadcastbox.chat.v1.ClientFrame.hello:type_name -> broadcastbox.chat.v1.ClientHello
+	3,  // 4: broadcastbox.chat.v1.ClientFrame.ping:type_name -> broadcastbox.chat.v1.Ping
+	2,  // 5: broadcastbox.chat.v1.ClientFrame.reserve:type_name -> broadcastbox.chat.v1.Reserve
+	1,  // 6: broadcastbox.chat.v1.ClientFrame.stats:type_name -> broadcastbox.chat.v1.Stats
+	27, // 7: broadcastbox.chat.v1.ServerEvent.timestamp:type_name -> google.protobuf.Timestamp
+	13, // 8: broadcastbox.chat.v1.ServerEvent.message:type_name -> broadcastbox.chat.v1.ChatMessage
+	15, // 9: broadcastbox.chat.v1.ServerEvent.history:type_name -> broadcastbox.chat.v1.History
+	17, // 10: broadcastbox.chat.v1.ServerEvent.users:type_name -> broadcastbox.chat.v1.UserList
+	19, // 11: broadcastbox.chat.v1.ServerEvent.user_joined:type_name -> broadcastbox.chat.v1.UserEvent
+	19, // 12: broadcastbox.chat.v1.ServerEvent.user_left:type_name -> broadcastbox.chat.v1.UserEvent
+	20, // 13: broadcastbox.chat.v1.ServerEvent.typing:type_name -> broadcastbox.chat.v1.TypingEvent
+	21, // 14: broadcastbox.chat.v1.ServerEvent.system:type_name -> broadcastbox.chat.v1.SystemMessage
+	22, // 15: broadcastbox.chat.v1.ServerEvent.error:type_name -> broadcastbox.chat.v1.Error
+	25, // 16: broadcastbox.chat.v1.ServerEvent.timeout:type_name -> broadcastbox.chat.v1.Timeout
+	12, // 17: broadcastbox.chat.v1.ServerEvent.hello:type_name -> broadcastbox.chat.v1.Hello
+	16, // 18: broadcastbox.chat.v1.ServerEvent.message_batch:type_name -> broadcastbox.chat.v1.MessageBatch
+	11, // 19: broadcastbox.chat.v1.ServerEvent.pong:type_name -> broadcastbox.chat.v1.Pong
+	10, // 20: broadcastbox.chat.v1.ServerEvent.reserved:type_name -> broadcastbox.chat.v1.Reserved
+	9,  // 21: broadcastbox.chat.v1.ServerEvent.room_stats:type_name -> broadcastbox.chat.v1.RoomStats
+	27, // 22: broadcastbox.chat.v1.Reserved.expires_at:type_name -> google.protobuf.Timestamp
+	26, // 23: broadcastbox.chat.v1.Hello.features:type_name -> broadcastbox.chat.v1.Hello.FeaturesEntry
+	27, // 24: broadcastbox.chat.v1.ChatMessage.timestamp:type_name -> google.protobuf.Timestamp
+	14, // 25: broadcastbox.chat.v1.ChatMessage.origin:type_name -> broadcastbox.chat.v1.MessageOrigin
+	13, // 26: broadcastbox.chat.v1.History.messages:type_name -> broadcastbox.chat.v1.ChatMessage
+	13, // 27: broadcastbox.chat.v1.MessageBatch.messages:type_name -> broadcastbox.chat.v1.ChatMessage
+	18, // 28: broadcastbox.chat.v1.UserList.users:type_name -> broadcastbox.chat.v1.User
+	24, // 29: broadcastbox.chat.v1.Error.fields:type_name -> broadcastbox.chat.v1.FieldError
+	23, // 30: broadcastbox.chat.v1.Error.details:type_name -> broadcastbox.chat.v1.ErrorDetails
+	0,  // 31: broadcastbox.chat.v1.Chat.Connect:input_type -> broadcastbox.chat.v1.ClientFrame
+	8,  // 32: broadcastbox.chat.v1.Chat.Connect:output_type -> broadcastbox.chat.v1.ServerEvent
+	32, // [32:33] is the sub-list for method output_type
+	31, // [31:32] is the sub-list for method input_type
+	31, // [31:31] is the sub-list for extension type_name
+	31, // [31:31] is the sub-list for extension extendee
+	0,  // [0:31] is the sub-list for field type_name
+}
+
+func init() { file_chat_proto_init() }
+func file_chat_proto_init() {
+	if File_chat_proto != nil {
+		return
+	}
+	file_chat_proto_msgTypes[0].OneofWrappers = []any{
+		(*ClientFrame_Join)(nil),
+		(*ClientFrame_Message)(nil),
+		(*ClientFrame_Typing)(nil),
+		(*ClientFrame_Hello)(nil),
+		(*ClientFrame_Ping)(nil),
+		(*ClientFrame_Reserve)(nil),
+		(*ClientFrame_Stats)(nil),
+	}
+	file_chat_proto_msgTypes[8].OneofWrappers = []any{
+		(*ServerEvent_Message)(nil),
+		(*ServerEvent_History)(nil),
+		(*ServerEvent_Users)(nil),
+		(*ServerEvent_UserJoined)(nil),
+		(*ServerEvent_UserLeft)(nil),
+		(*ServerEvent_Typing)(nil),
+		(*ServerEvent_System)(nil),
+		(*ServerEvent_Error)(nil),
+		(*ServerEvent_Timeout)(nil),
+		(*ServerEvent_Hello)(nil),
+		(*ServerEvent_MessageBatch)(nil),
+		(*ServerEvent_Pong)(nil),
+		(*ServerEvent_Reserved)(nil),
+		(*ServerEvent_RoomStats)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_chat_proto_rawDesc), len(file_chat_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   27,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_chat_proto_goTypes,
+		DependencyIndexes: file_chat_proto_depIdxs,
+		MessageInfos:      file_chat_proto_msgTypes,
+	}.Build()
+	File_chat_proto = out.File
+	file_chat_proto_goTypes = nil
+	file_chat_proto_depIdxs = nil
+}
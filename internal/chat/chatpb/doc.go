@@ -0,0 +1,4 @@
+// Package chatpb holds the generated protobuf and gRPC code for the chat API.
+package chatpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative chat.proto
@@ -0,0 +1,95 @@
+package chat
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the reverse proxies whose forwarding headers are believed
+// about who a request's client is. Headers on requests from anywhere else are
+// ignored, since any client can send them.
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// NewTrustedProxies parses entries that are CIDR ranges such as "10.0.0.0/8" or
+// single addresses. Invalid entries are logged and skipped.
+func NewTrustedProxies(entries []string) *TrustedProxies {
+	proxies := &TrustedProxies{}
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if !strings.Contains(entry, "/") {
+			if ip := net.ParseIP(entry); ip != nil && ip.To4() != nil {
+				entry += "/32"
+			} else {
+				entry += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			log.Printf("Ignoring invalid trusted proxy %q: %v", entry, err)
+			continue
+		}
+		proxies.nets = append(proxies.nets, network)
+	}
+	return proxies
+}
+
+// trusts reports whether ip belongs to a trusted proxy
+func (tp *TrustedProxies) trusts(ip net.IP) bool {
+	for _, network := range tp.nets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client that made the request. Behind a
+// trusted proxy that is the rightmost X-Forwarded-For hop that isn't another
+// trusted proxy, or X-Real-IP if the proxy doesn't send X-Forwarded-For;
+// otherwise it is the address the request came from.
+func (tp *TrustedProxies) ClientIP(r *http.Request) string {
+	return tp.Resolve(remoteIP(r), r.Header)
+}
+
+// Resolve returns the client behind peer, the address a connection came from,
+// reading the forwarding headers the way ClientIP does. Listeners without headers,
+// such as IRC, pass nil and get peer back.
+func (tp *TrustedProxies) Resolve(peer string, header http.Header) string {
+	if ip := net.ParseIP(peer); ip == nil || !tp.trusts(ip) {
+		return peer
+	}
+
+	if forwarded := header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		client := peer
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := net.ParseIP(strings.TrimSpace(hops[i]))
+			if hop == nil {
+				// Whatever added a malformed hop can't be trusted for the ones before it
+				break
+			}
+			client = hop.String()
+			if !tp.trusts(hop) {
+				break
+			}
+		}
+		return client
+	}
+
+	if realIP := net.ParseIP(strings.TrimSpace(header.Get("X-Real-IP"))); realIP != nil {
+		return realIP.String()
+	}
+	return peer
+}
+
+// clientIP returns the address of the client behind any trusted proxies
+func (h *WSHandler) clientIP(r *http.Request) string {
+	return h.proxies.ClientIP(r)
+}
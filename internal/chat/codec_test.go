@@ -0,0 +1,60 @@
+package chat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func benchmarkFrames() []WSMessage {
+	history := make([]ChatMessage, 100)
+	for i := range history {
+		history[i] = *newChatMessage("room", "user"+strconv.Itoa(i), "User "+strconv.Itoa(i), "hello there, this is a chat message")
+	}
+
+	return []WSMessage{
+		{Type: "message", Data: newChatMessage("room", "alice", "Alice", "hello"), Timestamp: time.Now()},
+		{Type: "history", Data: history, Timestamp: time.Now()},
+		{Type: "user_joined", Data: map[string]interface{}{"userId": "bob", "username": "Bob"}, Timestamp: time.Now()},
+	}
+}
+
+func TestCodecsProduceEquivalentJSON(t *testing.T) {
+	std, err := NewCodec(CodecJSON)
+	require.NoError(t, err)
+	fast, err := NewCodec(CodecJSONIter)
+	require.NoError(t, err)
+
+	for _, frame := range benchmarkFrames() {
+		expected, err := std.Marshal(frame)
+		require.NoError(t, err)
+		actual, err := fast.Marshal(frame)
+		require.NoError(t, err)
+		require.JSONEq(t, string(expected), string(actual))
+	}
+
+	_, err = NewCodec("xml")
+	require.Error(t, err)
+}
+
+func BenchmarkCodecMarshal(b *testing.B) {
+	frames := benchmarkFrames()
+
+	for _, name := range []string{CodecJSON, CodecJSONIter} {
+		codec, err := NewCodec(name)
+		require.NoError(b, err)
+
+		for _, frame := range frames {
+			b.Run(name+"/"+frame.Type, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if _, err := codec.Marshal(frame); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package chat
+
+import (
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Compactor is implemented by message stores that can delete every room's
+// expired messages at once and reclaim the space they took
+type Compactor interface {
+	// Compact deletes the messages stored before cutoff, returning how many it
+	// deleted and how many bytes of storage that freed
+	Compact(cutoff time.Time) (removed int, reclaimed int64, err error)
+}
+
+// CompactionReport describes one compaction pass
+type CompactionReport struct {
+	StartedAt         time.Time `json:"startedAt"`
+	DurationMs        int64     `json:"durationMs"`
+	ExpiredMessages   int       `json:"expiredMessages"`   // deleted from the message store
+	TombstonesRemoved int       `json:"tombstonesRemoved"` // repeated clears dropped from replay logs
+	FilesCompressed   int       `json:"filesCompressed"`   // replay logs and event log files gzipped
+	BytesReclaimed    int64     `json:"bytesReclaimed"`
+	Errors            []string  `json:"errors,omitempty"`
+}
+
+// compactionStats keeps what compaction has done since startup, for Diagnostics
+type compactionStats struct {
+	last      atomic.Pointer[CompactionReport]
+	reclaimed atomic.Int64
+}
+
+// fail notes an error that stopped part of a pass
+func (r *CompactionReport) fail(what string, err error) {
+	log.Printf("Chat compaction failed to %s: %v", what, err)
+	r.Errors = append(r.Errors, what+": "+err.Error())
+}
+
+// compactionCutoff returns when messages stored before have expired: older than
+// CompactionRetentionDays and than any room keeps them. It reports false while
+// stored messages are kept forever.
+func (m *Manager) compactionCutoff(now time.Time) (time.Time, bool) {
+	if m.config.CompactionRetentionDays <= 0 {
+		return time.Time{}, false
+	}
+
+	keep := time.Duration(m.config.CompactionRetentionDays) * 24 * time.Hour
+	keep = max(keep, time.Duration(m.config.MessageRetentionMinutes)*time.Minute, m.settings.longestRetention())
+	return now.Add(-keep), true
+}
+
+// Compact deletes expired messages from the message store and gzips replay logs
+// last written before coldBefore. Failures are logged and listed in the report
+// rather than stopping the rest of the pass.
+func (m *Manager) Compact(coldBefore time.Time) CompactionReport {
+	report := CompactionReport{StartedAt: time.Now()}
+
+	if compactor, ok := m.persistence().(Compactor); ok {
+		if cutoff, expires := m.compactionCutoff(report.StartedAt); expires {
+			removed, reclaimed, err := compactor.Compact(cutoff)
+			report.ExpiredMessages += removed
+			report.BytesReclaimed += reclaimed
+			if err != nil {
+				report.fail("compact the message store", err)
+			}
+		}
+	}
+
+	if err := m.replay.Compact(coldBefore, &report); err != nil {
+		report.fail("compress replay logs", err)
+	}
+	return report
+}
+
+// Compact runs a compaction pass like Manager.Compact that also gzips rotated
+// event log files, and records it for Diagnostics
+func (h *WSHandler) Compact() CompactionReport {
+	coldBefore := time.Now().Add(-time.Duration(h.manager.config.CompactionColdHours) * time.Hour)
+
+	report := h.manager.Compact(coldBefore)
+	if err := h.eventLog.Compress(coldBefore, &report); err != nil {
+		report.fail("compress the event log", err)
+	}
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+
+	h.compaction.last.Store(&report)
+	h.compaction.reclaimed.Add(report.BytesReclaimed)
+	log.Printf("Chat compaction deleted %d expired messages, dropped %d repeated clears and compressed %d files, reclaiming %d KB in %dms",
+		report.ExpiredMessages, report.TombstonesRemoved, report.FilesCompressed, report.BytesReclaimed/1024, report.DurationMs)
+	return report
+}
+
+// compactionWorker compacts persisted history every interval
+func (h *WSHandler) compactionWorker(interval time.Duration) {
+	defer trackWorker("ws.compaction")()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.Compact()
+	}
+}
+
+// CompactHandler serves POST /api/chat/admin/compact, running a compaction pass
+// now and returning its report
+func (h *WSHandler) CompactHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.Compact())
+}
+
+// gzipFile replaces a file with a gzipped copy named with a .gz suffix, returning
+// how many bytes smaller it is
+func gzipFile(path string) (int64, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer src.Close()
+
+	info, err := src.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size, err := writeGzipFile(path+gzipSuffix, func(w io.Writer) error {
+		_, err := io.Copy(w, src)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Remove(path); err != nil {
+		return 0, err
+	}
+	return info.Size() - size, nil
+}
+
+// writeGzipFile writes a gzipped file through a temporary one, so a crash never
+// leaves it half written, and returns its size
+func writeGzipFile(path string, write func(w io.Writer) error) (int64, error) {
+	tmp := path + ".tmp"
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	writer := gzip.NewWriter(file)
+	err = write(writer)
+	if err == nil {
+		err = writer.Close()
+	}
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// gzipFileReader reads a gzipped file, closing the file with the reader
+type gzipFileReader struct {
+	*gzip.Reader
+	file *os.File
+}
+
+// Close closes the gzip reader and the file under it
+func (r gzipFileReader) Close() error {
+	r.Reader.Close()
+	return r.file.Close()
+}
+
+// openMaybeGzipped opens a file for reading, decompressing it if its name ends in .gz
+func openMaybeGzipped(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, gzipSuffix) {
+		return file, nil
+	}
+
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return gzipFileReader{Reader: reader, file: file}, nil
+}
@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompactionGzipsColdReplayLogs(t *testing.T) {
+	h := newReplayTestHandler(t)
+	h.manager.StreamStarted("room")
+	room, _ := h.manager.GetRoom("room")
+	sessionID := replaySessionID(room.startedAt)
+
+	_, err := h.manager.AddMessage("room", "alice", "alice", "cleared")
+	require.NoError(t, err)
+	_, err = h.manager.ClearRoom("room")
+	require.NoError(t, err)
+	_, err = h.manager.ClearRoom("room")
+	require.NoError(t, err)
+	_, err = h.manager.AddMessage("room", "bob", "bob", "kept")
+	require.NoError(t, err)
+	require.NoError(t, h.manager.replay.Flush())
+
+	// Nothing has gone cold yet
+	report := h.manager.Compact(time.Now().Add(-time.Hour))
+	require.Zero(t, report.FilesCompressed)
+
+	report = h.manager.Compact(time.Now().Add(time.Minute))
+	require.Equal(t, 1, report.FilesCompressed)
+	require.Equal(t, 1, report.TombstonesRemoved)
+	require.Positive(t, report.BytesReclaimed)
+	path := h.manager.replay.path("room", sessionID)
+	require.FileExists(t, path+gzipSuffix)
+	require.NoFileExists(t, path)
+
+	// Chat recorded later lands in a new log, read after the compressed one
+	_, err = h.manager.AddMessage("room", "carol", "carol", "later")
+	require.NoError(t, err)
+
+	sessions, err := h.manager.replay.Sessions("room")
+	require.NoError(t, err)
+	require.Len(t, sessions, 1)
+	messages, err := h.manager.replay.Messages("room", sessionID, 0)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	require.Equal(t, "kept", messages[0].Message)
+	require.Equal(t, "later", messages[1].Message)
+
+	h.manager.Compact(time.Now().Add(time.Minute))
+	summary, err := h.manager.replay.Summary("room", sessionID)
+	require.NoError(t, err)
+	require.Equal(t, 3, summary.Messages)
+	require.Equal(t, 1, summary.Clears)
+}
+
+func TestEventLogCompressesRotatedFiles(t *testing.T) {
+	dir := t.TempDir()
+	eventLog, err := NewEventLog(dir, 200, 0, false)
+	require.NoError(t, err)
+	t.Cleanup(func() { eventLog.Close() })
+
+	for _, eventType := range []string{"one", "two", "three"} {
+		require.NoError(t, eventLog.Append(eventType, "room", map[string]string{"padding": "0123456789012345678901234567890123456789"}))
+	}
+
+	var report CompactionReport
+	require.NoError(t, eventLog.Compress(time.Now().Add(time.Minute), &report))
+	require.Equal(t, 2, report.FilesCompressed)
+	require.FileExists(t, walPath(dir, 1)+gzipSuffix)
+	require.FileExists(t, walPath(dir, 3)) // still being written
+
+	require.NoError(t, eventLog.Append("four", "room", nil))
+	require.NoError(t, eventLog.Flush())
+	require.Equal(t, []string{"one", "two", "three", "four"}, readEventTypes(t, dir))
+}
+
+func TestCompactionDeletesExpiredMessages(t *testing.T) {
+	config := DefaultConfig()
+	config.CompactionRetentionDays = 1
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "chat.db"), DefaultWriteBatching())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	manager.SetMessageStore(store)
+
+	now := time.Now()
+	for i := 0; i < 100; i++ {
+		require.NoError(t, store.Append(ChatMessage{ID: strconv.Itoa(i), StreamKey: "old", Message: "stale", Seq: int64(i + 1), Timestamp: now.Add(-48 * time.Hour)}))
+	}
+	require.NoError(t, store.Append(ChatMessage{ID: "new", StreamKey: "room", Seq: 1, Timestamp: now}))
+
+	// A room keeping messages longer holds back what expires
+	require.NoError(t, manager.SetRetentionPolicy("old", RetentionPolicy{RetentionMinutes: 72 * 60}))
+	report := manager.Compact(now)
+	require.Zero(t, report.ExpiredMessages)
+	require.Empty(t, report.Errors)
+
+	require.NoError(t, manager.SetRetentionPolicy("old", RetentionPolicy{}))
+	report = manager.Compact(now)
+	require.Equal(t, 100, report.ExpiredMessages)
+	require.Empty(t, report.Errors)
+
+	messages, err := store.Range("old", 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, messages)
+	messages, err = store.Range("room", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"new"}, messageIDs(messages))
+}
+
+func TestCompactReportsToDiagnostics(t *testing.T) {
+	h := newReplayTestHandler(t)
+	h.manager.config.CompactionColdHours = 0
+	_, err := h.manager.AddMessage("room", "alice", "alice", "hello")
+	require.NoError(t, err)
+	require.NoError(t, h.manager.replay.Flush())
+
+	// Cold means untouched since before the pass started
+	old := time.Now().Add(-time.Hour)
+	room, _ := h.manager.GetRoom("room")
+	require.NoError(t, os.Chtimes(h.manager.replay.path("room", replaySessionID(room.startedAt)), old, old))
+
+	report := h.Compact()
+	require.Equal(t, 1, report.FilesCompressed)
+
+	d := h.Diagnostics()
+	require.NotNil(t, d.LastCompaction)
+	require.Equal(t, 1, d.LastCompaction.FilesCompressed)
+	require.Equal(t, report.BytesReclaimed, d.BytesReclaimed)
+}
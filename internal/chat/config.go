@@ -1,8 +1,10 @@
 package chat
 
 import (
+	"log"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -11,24 +13,193 @@ type ChatConfig struct {
 	// Memory limits
 	MaxTotalMemoryMB     int // Default: 100 MB
 	MaxMessagesPerStream int // Default: 500 messages
+	MinMessagesPerStream int // Default: 50 messages; buffers grow towards the max with activity
 	MaxUsersPerStream    int // Default: 100 users
+	MaxRoomsPerUser      int // Default: 10 rooms (0 = unlimited)
+	MaxJoinsPerMinute    int // Default: 20 joins (0 = unlimited)
+
+	// Message buffers
+	BufferMode               string // Default: "heap"; "slab" copies messages into a preallocated slab per room
+	MessagesPerViewer        int    // Default: 0 (off); a room's buffer may grow to this many messages per viewer when that's above MaxMessagesPerStream
+	PopularStreamMaxMessages int    // Default: 2000 messages a popular room's buffer may grow to
+
+	// Streams
+	RequireLiveStream bool // Default: false (any stream key gets a room)
 
 	// Time limits
-	MessageRetentionMinutes int           // Default: 30 minutes
-	CleanupIntervalMinutes  int           // Default: 5 minutes
-	InactiveStreamTimeout   time.Duration // Default: 10 minutes
+	MessageRetentionMinutes  int           // Default: 30 minutes
+	CleanupIntervalMinutes   int           // Default: 5 minutes
+	InactiveStreamTimeout    time.Duration // Default: 10 minutes
+	RoomDeletionGraceMinutes int           // Default: 30 minutes (0 = delete immediately)
 
 	// Rate limiting
-	MaxMessagesPerMinute     int // Default: 10
-	MaxCharactersPerMessage  int // Default: 500
-	SpamThresholdMessages    int // Default: 20
-	SpamTimeoutMinutes       int // Default: 5
+	MaxMessagesPerMinute    int // Default: 10
+	MaxCharactersPerMessage int // Default: 500
+	SpamThresholdMessages   int // Default: 20
+	SpamTimeoutMinutes      int // Default: 5
+
+	// Automod
+	BlockedTerms      []string // Default: none
+	AutoModSilentDrop bool     // Default: false
+
+	// Scraper detection
+	ScraperMaxRooms      int // Default: 10 rooms read without participating (0 = disabled)
+	ScraperWindowMinutes int // Default: 10 minutes
+
+	// HTTP API
+	APITokens      []APIToken // Default: none (history and stats endpoints are public)
+	AllowedOrigins []string   // Default: none (same-origin pages only); "https://example.com", "https://*.example.com" or "*" for any
+
+	// Viewer authentication with signed JWTs; either key makes a token required to chat
+	JWTSecret        string // Default: "" (not used); shared secret for HS256 tokens
+	JWTPublicKeyFile string // Default: "" (not used); PEM RSA public key for RS256 tokens
+	JWTIssuer        string // Default: "" (any issuer); the iss claim tokens must carry
+	JWTAudience      string // Default: "" (any audience); a value the aud claim must include
+	GuestAccess      string // Default: "read" (guests watch without chatting); "chat" lets them chat under generated names, "off" refuses them
+
+	// Display names, which no two users in a room may share once folded for case and lookalike characters
+	UsernameCollision string   // Default: "suffix" (a taken name gets a number); "reject" refuses the join, "allow" skips the check
+	ReservedUsernames []string // Default: admin, administrator, mod, moderator, system, staff; "name=userID" entries reserve a name for one user
+
+	// Webhooks
+	Webhooks           []WebhookEndpoint // Default: none
+	WebhookMaxAttempts int               // Default: 5 delivery attempts per event
+
+	// Event export to Kafka
+	KafkaBrokers []string // Default: none (export disabled)
+	KafkaTopic   string   // Default: "chat-events"
+	KafkaFormat  string   // Default: "json"; "msgpack" for smaller records
+
+	// Connection cap
+	MaxConnections         int // Default: 0 (unlimited) concurrent connections per instance, over any transport
+	ConnectionRetrySeconds int // Default: 5 seconds suggested to clients turned away at the cap
+
+	// Per-address limits, for connections over every transport
+	MaxConnectionsPerIP    int      // Default: 100 concurrent connections from one address, or IPv6 /64 (0 = unlimited)
+	MaxJoinsPerIPPerMinute int      // Default: 120 connections opened per minute from one address (0 = unlimited)
+	TrustedProxies         []string // Default: none (forwarding headers are ignored); CIDRs or addresses of reverse proxies whose X-Forwarded-For is believed
+
+	// Draining for restarts
+	DrainSeconds      int    // Default: 20 seconds over which connections are closed when draining
+	DrainReconnectURL string // Default: none (clients reconnect to the address they used); where drained clients are sent
+
+	// Load shedding
+	LoadShedQueuePercent int // Default: 50% average send queue fill (0 = disabled)
+	LoadShedEncodeMicros int // Default: 1000 microseconds average frame encode time
+
+	// Load throttling
+	LoadThrottleMessagesPerSecond int // Default: 0 (off) messages per second across every room before slow mode engages
+	LoadThrottleMemoryPercent     int // Default: 90% of MaxTotalMemoryMB in use before slow mode engages (0 = off)
+	LoadThrottleSlowModeSeconds   int // Default: 5 seconds between a user's messages while engaged (0 = never throttle)
+
+	// Send queues and slow clients
+	SendQueueSize         int    // Default: 256 frames queued per connection
+	SendQueuePolicy       string // Default: "drop-newest"; "drop-oldest" or "disconnect" when a queue is full
+	SlowClientWarnPercent int    // Default: 75% send queue fill before the client is warned it is falling behind (0 = never warn)
+	SlowClientMaxDrops    int    // Default: 100 dropped frames before the connection is closed (0 = never close); not applied under "drop-oldest"
+
+	// Backpressure
+	BackpressurePercent   int // Default: 50% send queue fill that counts as backed up (0 = never switch clients to digests)
+	BackpressureSeconds   int // Default: 5 seconds backed up before a client is switched to digests, and caught up before it is switched back
+	DigestIntervalSeconds int // Default: 2 seconds between digests
+
+	// History on join
+	JoinHistorySize int // Default: 100 recent messages sent on joining a room; clients page back further with history_request
+
+	// Encoding
+	Codec string // Default: "json" (encoding/json); "jsoniter" for faster encoding in large rooms
+
+	// Batching
+	BatchWindowMs int // Default: 0 ms (disabled); chat messages queued within the window are sent as one message_batch frame
+
+	// Writing
+	WriteWorkers int // Default: 0 (a writer goroutine per WebSocket); otherwise the size of a shared pool writing to every WebSocket
+
+	// Connection backend
+	WSBackend string // Default: "gorilla"; "netpoll" reads WebSockets from an epoll loop (Linux, no compression)
+
+	// WebSocket compression (permessage-deflate)
+	CompressionEnabled  bool // Default: true
+	CompressionMinBytes int  // Default: 512 bytes; smaller frames are sent uncompressed
+	CompressionLevel    int  // Default: 1 (best speed), up to 9 (best compression)
+
+	// Gateways
+	IRCAddress  string // Default: "" (IRC gateway disabled)
+	GRPCAddress string // Default: "" (gRPC API disabled)
+
+	// Cross-instance backplane
+	NATSURL    string // Default: "" (single instance, in-process broker)
+	NATSStream string // Default: "" (core NATS); a JetStream stream name keeps events for reconnecting instances
+
+	// Shared history
+	RedisURL             string // Default: "" (each instance serves the history it has seen)
+	RedisStreams         bool   // Default: false (history kept in Redis lists); true uses capped Redis Streams, which also persist messages
+	RedisStreamMaxLength int    // Default: 10000 messages per room's stream
+
+	// Persistent history
+	SQLitePath  string // Default: "" (messages are kept in memory only)
+	PostgresURL string // Default: "" (not used); takes precedence over SQLitePath
+
+	// Batched writes to the SQLite or Postgres store
+	PersistBatchSize       int    // Default: 256 held messages that trigger a write before the interval
+	PersistFlushIntervalMs int    // Default: 200 ms at most a message is held
+	PersistQueueSize       int    // Default: 10000 messages held before the overflow policy applies
+	PersistOverflow        string // Default: "drop" (new messages are dropped); "flush" writes the queue on the sender's goroutine
+
+	// Tenants, each storing its rooms' messages apart
+	Tenants []string // Default: none (one tenant); "name=prefix" entries for rooms whose stream keys start with prefix
+
+	// Room routing across instances
+	ClusterNodes   []string // Default: none (every instance serves every room); base URLs such as "http://chat-1:8080"
+	ClusterSelf    string   // Default: ""; this instance's entry in ClusterNodes
+	ClusterRouting string   // Default: "proxy"; "redirect" to answer misrouted requests with 307
+
+	// Startup
+	WarmupStatusURL string // Default: "" (no warm-up)
+
+	// Per-user stats for "chat wrapped" exports
+	StatsDir string // Default: "" (kept in memory only)
+
+	// Chat replay for stream recordings
+	ReplayDir string // Default: "" (replay disabled)
+
+	// Write-ahead log of chat events
+	WALDir       string // Default: "" (event log disabled)
+	WALMaxFileMB int    // Default: 64 MB per file before rotating
+	WALMaxFiles  int    // Default: 10 files kept (0 = keep every file)
+	WALSync      bool   // Default: false; true syncs every event to disk before it is broadcast
+
+	// Archival of finished sessions' chat to S3-compatible storage
+	ArchiveS3Endpoint      string // Default: "" (archival disabled); e.g. "https://s3.us-east-1.amazonaws.com"
+	ArchiveS3Bucket        string // Default: ""
+	ArchiveS3Region        string // Default: "us-east-1"
+	ArchiveS3AccessKey     string // Default: ""
+	ArchiveS3SecretKey     string // Default: ""
+	ArchivePrefix          string // Default: "chat/"; object keys are <prefix><streamKey>/<session start>.ndjson.gz
+	ArchiveIntervalMinutes int    // Default: 5 minutes between archive passes
+
+	// Compaction of persisted history
+	CompactionIntervalMinutes int // Default: 0 (compaction disabled); e.g. 360
+	CompactionRetentionDays   int // Default: 0 (stored messages kept forever); longer room retention policies are honored
+	CompactionColdHours       int // Default: 24 hours before replay logs and rotated event log files are gzipped
+
+	// Storage health checks
+	StorageCheckIntervalSeconds int // Default: 10 seconds between pings of each storage backend; 0 disables checks
+	StorageFailureThreshold     int // Default: 3 failed checks in a row before falling back to memory-only mode
+
+	// Usage telemetry, opt-in
+	TelemetryURL             string // Default: "" (no reporting)
+	TelemetryIntervalMinutes int    // Default: 60 minutes
 
 	// Features
-	EnableViewerList    bool // Default: true
-	EnableMentions      bool // Default: true
-	EnableTypingStatus  bool // Default: false
-	EnableEmojis        bool // Default: true
+	EnableViewerList   bool // Default: true
+	EnableMentions     bool // Default: true
+	EnableTypingStatus bool // Default: false
+	EnableEmojis       bool // Default: true
+
+	// Viewer counts
+	ViewerCountDebounceMs int  // Default: 1000 ms between viewer_count_changed events per room (0 = disabled)
+	BroadcastViewerCount  bool // Default: true (also send viewer_count_changed frames to clients)
 }
 
 // DefaultConfig returns the default chat configuration
@@ -37,12 +208,24 @@ func DefaultConfig() *ChatConfig {
 		// Memory limits
 		MaxTotalMemoryMB:     100,
 		MaxMessagesPerStream: 500,
+		MinMessagesPerStream: 50,
 		MaxUsersPerStream:    100,
+		MaxRoomsPerUser:      10,
+		MaxJoinsPerMinute:    20,
+
+		// Message buffers
+		BufferMode:               BufferHeap,
+		MessagesPerViewer:        0,
+		PopularStreamMaxMessages: 2000,
+
+		// Streams
+		RequireLiveStream: false,
 
 		// Time limits
-		MessageRetentionMinutes: 30,
-		CleanupIntervalMinutes:  5,
-		InactiveStreamTimeout:   10 * time.Minute,
+		MessageRetentionMinutes:  30,
+		CleanupIntervalMinutes:   5,
+		InactiveStreamTimeout:    10 * time.Minute,
+		RoomDeletionGraceMinutes: 30,
 
 		// Rate limiting
 		MaxMessagesPerMinute:    10,
@@ -50,11 +233,118 @@ func DefaultConfig() *ChatConfig {
 		SpamThresholdMessages:   20,
 		SpamTimeoutMinutes:      5,
 
+		// Automod
+		BlockedTerms:      []string{},
+		AutoModSilentDrop: false,
+
+		// Scraper detection
+		ScraperMaxRooms:      10,
+		ScraperWindowMinutes: 10,
+
+		// Viewer authentication
+		GuestAccess:       GuestAccessRead,
+		UsernameCollision: UsernameSuffix,
+		ReservedUsernames: []string{"admin", "administrator", "mod", "moderator", "system", "staff"},
+
+		// Webhooks
+		WebhookMaxAttempts: 5,
+
+		// Event export
+		KafkaTopic:  "chat-events",
+		KafkaFormat: ExportFormatJSON,
+
+		// Connection cap
+		MaxConnections:         0,
+		ConnectionRetrySeconds: 5,
+
+		// Per-address limits
+		MaxConnectionsPerIP:    100,
+		MaxJoinsPerIPPerMinute: 120,
+
+		// Draining for restarts
+		DrainSeconds:      20,
+		DrainReconnectURL: "",
+
+		// Load shedding
+		LoadShedQueuePercent: 50,
+		LoadShedEncodeMicros: 1000,
+
+		// Load throttling
+		LoadThrottleMessagesPerSecond: 0,
+		LoadThrottleMemoryPercent:     90,
+		LoadThrottleSlowModeSeconds:   5,
+
+		// Send queues and slow clients
+		SendQueueSize:         256,
+		SendQueuePolicy:       OverflowDropNewest,
+		SlowClientWarnPercent: 75,
+		SlowClientMaxDrops:    100,
+
+		// Backpressure
+		BackpressurePercent:   50,
+		BackpressureSeconds:   5,
+		DigestIntervalSeconds: 2,
+
+		// History on join
+		JoinHistorySize: 100,
+
+		// Encoding
+		Codec: CodecJSON,
+
+		// Batching
+		BatchWindowMs: 0,
+
+		// Writing
+		WriteWorkers: 0,
+
+		// Connection backend
+		WSBackend: BackendGorilla,
+
+		// WebSocket compression
+		CompressionEnabled:  true,
+		CompressionMinBytes: 512,
+		CompressionLevel:    1,
+
+		// Shared history
+		RedisStreamMaxLength: 10000,
+
+		// Batched writes to the persistent store
+		PersistBatchSize:       256,
+		PersistFlushIntervalMs: 200,
+		PersistQueueSize:       10000,
+		PersistOverflow:        OverflowDrop,
+
+		// Room routing
+		ClusterRouting: RoutingProxy,
+
+		// Archival
+		ArchiveS3Region:        "us-east-1",
+		ArchivePrefix:          "chat/",
+		ArchiveIntervalMinutes: 5,
+
+		// Compaction
+		CompactionColdHours: 24,
+
+		// Storage health checks
+		StorageCheckIntervalSeconds: 10,
+		StorageFailureThreshold:     3,
+
+		// Write-ahead event log
+		WALMaxFileMB: 64,
+		WALMaxFiles:  10,
+
+		// Usage telemetry
+		TelemetryIntervalMinutes: 60,
+
 		// Features
 		EnableViewerList:   true,
 		EnableMentions:     true,
 		EnableTypingStatus: false,
 		EnableEmojis:       true,
+
+		// Viewer counts
+		ViewerCountDebounceMs: 1000,
+		BroadcastViewerCount:  true,
 	}
 }
 
@@ -62,6 +352,13 @@ func DefaultConfig() *ChatConfig {
 func LoadFromEnv() *ChatConfig {
 	config := DefaultConfig()
 
+	// Profile presets are applied first so individual settings can override them
+	if val := os.Getenv("CHAT_PROFILE"); val != "" {
+		if err := config.ApplyProfile(val); err != nil {
+			log.Printf("Ignoring CHAT_PROFILE: %v", err)
+		}
+	}
+
 	// Memory limits
 	if val := os.Getenv("CHAT_MAX_MEMORY_MB"); val != "" {
 		if parsed, err := strconv.Atoi(val); err == nil {
@@ -75,12 +372,56 @@ func LoadFromEnv() *ChatConfig {
 		}
 	}
 
+	if val := os.Getenv("CHAT_MIN_MESSAGES_PER_STREAM"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.MinMessagesPerStream = parsed
+		}
+	}
+
+	// Message buffers
+	if val := os.Getenv("CHAT_BUFFER_MODE"); val != "" {
+		if validBufferMode(val) {
+			config.BufferMode = val
+		} else {
+			log.Printf("Ignoring CHAT_BUFFER_MODE: unknown mode %q", val)
+		}
+	}
+
+	if val := os.Getenv("CHAT_MESSAGES_PER_VIEWER"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			config.MessagesPerViewer = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_POPULAR_STREAM_MAX_MESSAGES"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			config.PopularStreamMaxMessages = parsed
+		}
+	}
+
 	if val := os.Getenv("CHAT_MAX_USERS_PER_STREAM"); val != "" {
 		if parsed, err := strconv.Atoi(val); err == nil {
 			config.MaxUsersPerStream = parsed
 		}
 	}
 
+	if val := os.Getenv("CHAT_MAX_ROOMS_PER_USER"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.MaxRoomsPerUser = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_MAX_JOINS_PER_MINUTE"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.MaxJoinsPerMinute = parsed
+		}
+	}
+
+	// Streams
+	if val := os.Getenv("CHAT_REQUIRE_LIVE_STREAM"); val != "" {
+		config.RequireLiveStream = val == "true"
+	}
+
 	// Time limits
 	if val := os.Getenv("CHAT_MESSAGE_RETENTION_MINUTES"); val != "" {
 		if parsed, err := strconv.Atoi(val); err == nil {
@@ -94,6 +435,12 @@ func LoadFromEnv() *ChatConfig {
 		}
 	}
 
+	if val := os.Getenv("CHAT_ROOM_DELETION_GRACE_MINUTES"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.RoomDeletionGraceMinutes = parsed
+		}
+	}
+
 	// Rate limiting
 	if val := os.Getenv("CHAT_MAX_MESSAGES_PER_MINUTE"); val != "" {
 		if parsed, err := strconv.Atoi(val); err == nil {
@@ -119,6 +466,392 @@ func LoadFromEnv() *ChatConfig {
 		}
 	}
 
+	// Automod
+	if val := os.Getenv("CHAT_BLOCKED_TERMS"); val != "" {
+		config.BlockedTerms = strings.Split(val, ",")
+	}
+
+	if val := os.Getenv("CHAT_AUTOMOD_SILENT_DROP"); val != "" {
+		config.AutoModSilentDrop = val == "true"
+	}
+
+	// Scraper detection
+	if val := os.Getenv("CHAT_SCRAPER_MAX_ROOMS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.ScraperMaxRooms = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_SCRAPER_WINDOW_MINUTES"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.ScraperWindowMinutes = parsed
+		}
+	}
+
+	// HTTP API
+	if val := os.Getenv("CHAT_API_TOKENS"); val != "" {
+		if tokens, err := ParseAPITokens(val); err == nil {
+			config.APITokens = tokens
+		} else {
+			log.Printf("Ignoring invalid CHAT_API_TOKENS: %v", err)
+		}
+	}
+	if val := os.Getenv("CHAT_ALLOWED_ORIGINS"); val != "" {
+		config.AllowedOrigins = strings.Split(val, ",")
+	}
+
+	// Viewer authentication
+	config.JWTSecret = os.Getenv("CHAT_JWT_SECRET")
+	config.JWTPublicKeyFile = os.Getenv("CHAT_JWT_PUBLIC_KEY_FILE")
+	config.JWTIssuer = os.Getenv("CHAT_JWT_ISSUER")
+	config.JWTAudience = os.Getenv("CHAT_JWT_AUDIENCE")
+	if val := os.Getenv("CHAT_GUEST_ACCESS"); val != "" {
+		config.GuestAccess = val
+	}
+	if val := os.Getenv("CHAT_USERNAME_COLLISION"); val != "" {
+		config.UsernameCollision = val
+	}
+	if val := os.Getenv("CHAT_RESERVED_USERNAMES"); val != "" {
+		config.ReservedUsernames = strings.Split(val, ",")
+	}
+
+	// Webhooks
+	if val := os.Getenv("CHAT_WEBHOOKS"); val != "" {
+		if endpoints, err := ParseWebhookEndpoints(val); err == nil {
+			config.Webhooks = endpoints
+		} else {
+			log.Printf("Ignoring invalid CHAT_WEBHOOKS: %v", err)
+		}
+	}
+
+	if val := os.Getenv("CHAT_WEBHOOK_MAX_ATTEMPTS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.WebhookMaxAttempts = parsed
+		}
+	}
+
+	// Event export
+	if val := os.Getenv("CHAT_KAFKA_BROKERS"); val != "" {
+		config.KafkaBrokers = strings.Split(val, ",")
+	}
+
+	if val := os.Getenv("CHAT_KAFKA_TOPIC"); val != "" {
+		config.KafkaTopic = val
+	}
+
+	if val := os.Getenv("CHAT_KAFKA_FORMAT"); val != "" {
+		config.KafkaFormat = val
+	}
+
+	// Connection cap
+	if val := os.Getenv("CHAT_MAX_CONNECTIONS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.MaxConnections = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_CONNECTION_RETRY_SECONDS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			config.ConnectionRetrySeconds = parsed
+		}
+	}
+
+	// Per-address limits
+	if val := os.Getenv("CHAT_MAX_CONNECTIONS_PER_IP"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			config.MaxConnectionsPerIP = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_MAX_JOINS_PER_IP_PER_MINUTE"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			config.MaxJoinsPerIPPerMinute = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_TRUSTED_PROXIES"); val != "" {
+		config.TrustedProxies = strings.Split(val, ",")
+	}
+
+	// Draining for restarts
+	if val := os.Getenv("CHAT_DRAIN_SECONDS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			config.DrainSeconds = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_DRAIN_RECONNECT_URL"); val != "" {
+		config.DrainReconnectURL = val
+	}
+
+	// Load shedding
+	if val := os.Getenv("CHAT_LOAD_SHED_QUEUE_PERCENT"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.LoadShedQueuePercent = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_LOAD_SHED_ENCODE_MICROS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.LoadShedEncodeMicros = parsed
+		}
+	}
+
+	// Load throttling
+	if val := os.Getenv("CHAT_LOAD_THROTTLE_MESSAGES_PER_SECOND"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			config.LoadThrottleMessagesPerSecond = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_LOAD_THROTTLE_MEMORY_PERCENT"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			config.LoadThrottleMemoryPercent = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_LOAD_THROTTLE_SLOW_MODE_SECONDS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			config.LoadThrottleSlowModeSeconds = parsed
+		}
+	}
+
+	// Send queues and slow clients
+	if val := os.Getenv("CHAT_SEND_QUEUE_SIZE"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			config.SendQueueSize = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_SEND_QUEUE_POLICY"); val != "" {
+		if validOverflowPolicy(val) {
+			config.SendQueuePolicy = val
+		} else {
+			log.Printf("Ignoring CHAT_SEND_QUEUE_POLICY: unknown policy %q", val)
+		}
+	}
+
+	if val := os.Getenv("CHAT_SLOW_CLIENT_WARN_PERCENT"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.SlowClientWarnPercent = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_SLOW_CLIENT_MAX_DROPS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.SlowClientMaxDrops = parsed
+		}
+	}
+
+	// Backpressure
+	if val := os.Getenv("CHAT_BACKPRESSURE_PERCENT"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			config.BackpressurePercent = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_BACKPRESSURE_SECONDS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			config.BackpressureSeconds = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_DIGEST_INTERVAL_SECONDS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed > 0 {
+			config.DigestIntervalSeconds = parsed
+		}
+	}
+
+	// History on join
+	if val := os.Getenv("CHAT_JOIN_HISTORY_SIZE"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			config.JoinHistorySize = parsed
+		}
+	}
+
+	// Encoding
+	if val := os.Getenv("CHAT_CODEC"); val != "" {
+		if _, err := NewCodec(val); err == nil {
+			config.Codec = val
+		} else {
+			log.Printf("Ignoring CHAT_CODEC: %v", err)
+		}
+	}
+
+	// Batching
+	if val := os.Getenv("CHAT_BATCH_WINDOW_MS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.BatchWindowMs = parsed
+		}
+	}
+
+	// Writing
+	if val := os.Getenv("CHAT_WRITE_WORKERS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil && parsed >= 0 {
+			config.WriteWorkers = parsed
+		}
+	}
+
+	// Connection backend
+	if val := os.Getenv("CHAT_WS_BACKEND"); val != "" {
+		if validBackend(val) {
+			config.WSBackend = val
+		} else {
+			log.Printf("Ignoring CHAT_WS_BACKEND: unknown backend %q", val)
+		}
+	}
+
+	// WebSocket compression
+	if val := os.Getenv("CHAT_COMPRESSION"); val != "" {
+		config.CompressionEnabled = val == "true"
+	}
+
+	if val := os.Getenv("CHAT_COMPRESSION_MIN_BYTES"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.CompressionMinBytes = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_COMPRESSION_LEVEL"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.CompressionLevel = parsed
+		}
+	}
+
+	// Gateways
+	config.IRCAddress = os.Getenv("CHAT_IRC_ADDRESS")
+	config.GRPCAddress = os.Getenv("CHAT_GRPC_ADDRESS")
+
+	// Cross-instance backplane
+	config.NATSURL = os.Getenv("CHAT_NATS_URL")
+	config.NATSStream = os.Getenv("CHAT_NATS_STREAM")
+
+	// Shared history
+	config.RedisURL = os.Getenv("CHAT_REDIS_URL")
+	if val := os.Getenv("CHAT_REDIS_STREAMS"); val != "" {
+		config.RedisStreams = val == "true"
+	}
+	if val := os.Getenv("CHAT_REDIS_STREAM_MAX_LENGTH"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.RedisStreamMaxLength = n
+		}
+	}
+
+	// Persistent history
+	config.SQLitePath = os.Getenv("CHAT_SQLITE_PATH")
+	config.PostgresURL = os.Getenv("CHAT_POSTGRES_URL")
+	if val := os.Getenv("CHAT_PERSIST_BATCH_SIZE"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.PersistBatchSize = n
+		}
+	}
+	if val := os.Getenv("CHAT_PERSIST_FLUSH_INTERVAL_MS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.PersistFlushIntervalMs = n
+		}
+	}
+	if val := os.Getenv("CHAT_PERSIST_QUEUE_SIZE"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.PersistQueueSize = n
+		}
+	}
+	if val := os.Getenv("CHAT_PERSIST_OVERFLOW"); val != "" {
+		config.PersistOverflow = val
+	}
+	if val := os.Getenv("CHAT_TENANTS"); val != "" {
+		config.Tenants = strings.Split(val, ",")
+	}
+
+	// Room routing
+	if val := os.Getenv("CHAT_CLUSTER_NODES"); val != "" {
+		config.ClusterNodes = strings.Split(val, ",")
+	}
+	config.ClusterSelf = os.Getenv("CHAT_CLUSTER_SELF")
+
+	if val := os.Getenv("CHAT_CLUSTER_ROUTING"); val != "" {
+		config.ClusterRouting = val
+	}
+
+	// Startup
+	config.WarmupStatusURL = os.Getenv("CHAT_WARMUP_STATUS_URL")
+
+	// Per-user stats
+	config.StatsDir = os.Getenv("CHAT_STATS_DIR")
+
+	// Chat replay
+	config.ReplayDir = os.Getenv("CHAT_REPLAY_DIR")
+
+	// Write-ahead event log
+	config.WALDir = os.Getenv("CHAT_WAL_DIR")
+	if val := os.Getenv("CHAT_WAL_MAX_FILE_MB"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.WALMaxFileMB = n
+		}
+	}
+	if val := os.Getenv("CHAT_WAL_MAX_FILES"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.WALMaxFiles = n
+		}
+	}
+	if val := os.Getenv("CHAT_WAL_SYNC"); val != "" {
+		config.WALSync = val == "true"
+	}
+
+	// Archival
+	config.ArchiveS3Endpoint = os.Getenv("CHAT_ARCHIVE_S3_ENDPOINT")
+	config.ArchiveS3Bucket = os.Getenv("CHAT_ARCHIVE_S3_BUCKET")
+	if val := os.Getenv("CHAT_ARCHIVE_S3_REGION"); val != "" {
+		config.ArchiveS3Region = val
+	}
+	config.ArchiveS3AccessKey = os.Getenv("CHAT_ARCHIVE_S3_ACCESS_KEY")
+	config.ArchiveS3SecretKey = os.Getenv("CHAT_ARCHIVE_S3_SECRET_KEY")
+	if val := os.Getenv("CHAT_ARCHIVE_PREFIX"); val != "" {
+		config.ArchivePrefix = val
+	}
+	if val := os.Getenv("CHAT_ARCHIVE_INTERVAL_MINUTES"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.ArchiveIntervalMinutes = n
+		}
+	}
+
+	// Compaction
+	if val := os.Getenv("CHAT_COMPACTION_INTERVAL_MINUTES"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.CompactionIntervalMinutes = n
+		}
+	}
+	if val := os.Getenv("CHAT_COMPACTION_RETENTION_DAYS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.CompactionRetentionDays = n
+		}
+	}
+	if val := os.Getenv("CHAT_COMPACTION_COLD_HOURS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.CompactionColdHours = n
+		}
+	}
+
+	// Storage health checks
+	if val := os.Getenv("CHAT_STORAGE_CHECK_INTERVAL_SECONDS"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.StorageCheckIntervalSeconds = n
+		}
+	}
+	if val := os.Getenv("CHAT_STORAGE_FAILURE_THRESHOLD"); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			config.StorageFailureThreshold = n
+		}
+	}
+
+	// Usage telemetry
+	config.TelemetryURL = os.Getenv("CHAT_TELEMETRY_URL")
+
+	if val := os.Getenv("CHAT_TELEMETRY_INTERVAL_MINUTES"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.TelemetryIntervalMinutes = parsed
+		}
+	}
+
 	// Features
 	if val := os.Getenv("CHAT_ENABLE_VIEWER_LIST"); val != "" {
 		config.EnableViewerList = val == "true"
@@ -136,6 +869,17 @@ func LoadFromEnv() *ChatConfig {
 		config.EnableEmojis = val == "true"
 	}
 
+	// Viewer counts
+	if val := os.Getenv("CHAT_VIEWER_COUNT_DEBOUNCE_MS"); val != "" {
+		if parsed, err := strconv.Atoi(val); err == nil {
+			config.ViewerCountDebounceMs = parsed
+		}
+	}
+
+	if val := os.Getenv("CHAT_BROADCAST_VIEWER_COUNT"); val != "" {
+		config.BroadcastViewerCount = val == "true"
+	}
+
 	return config
 }
 
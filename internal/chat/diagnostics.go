@@ -0,0 +1,166 @@
+package chat
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const diagnosticsInterval = time.Minute
+
+// workerCounts tracks long-lived goroutines by kind so leaks show up in Diagnostics
+var workerCounts sync.Map // name -> *atomic.Int64
+
+// trackWorker counts a goroutine of the given kind until the returned function is called.
+// Use it as: defer trackWorker("kind")()
+func trackWorker(name string) func() {
+	counter, _ := workerCounts.LoadOrStore(name, &atomic.Int64{})
+	counter.(*atomic.Int64).Add(1)
+	return func() { counter.(*atomic.Int64).Add(-1) }
+}
+
+// workerSnapshot returns the number of running goroutines of each tracked kind
+func workerSnapshot() map[string]int64 {
+	workers := map[string]int64{}
+	workerCounts.Range(func(name, counter interface{}) bool {
+		if n := counter.(*atomic.Int64).Load(); n > 0 {
+			workers[name.(string)] = n
+		}
+		return true
+	})
+	return workers
+}
+
+// Diagnostics is a snapshot of the chat system's live resources, for spotting
+// leaks in long-running instances
+type Diagnostics struct {
+	Rooms        int              `json:"rooms"`
+	DeletedRooms int              `json:"deletedRooms"`
+	Users        int              `json:"users"`
+	Goroutines   int              `json:"goroutines"` // whole process
+	Workers      map[string]int64 `json:"workers"`    // tracked chat goroutines by kind
+
+	// Filled in by WSHandler.Diagnostics
+	Connections         int      `json:"connections"`
+	Subscribers         int      `json:"subscribers"`
+	PollSessions        int      `json:"pollSessions"`
+	PendingFrames       int      `json:"pendingFrames"` // queued in connection and subscriber channels
+	PendingWebhooks     int      `json:"pendingWebhooks"`
+	PendingExports      int      `json:"pendingExports"`
+	PendingWrites       int      `json:"pendingWrites"`       // connections waiting for a write pool worker
+	DroppedExports      int64    `json:"droppedExports"`      // events the Kafka export dropped since start
+	SlowEvictions       int64    `json:"slowEvictions"`       // connections closed for falling behind since start
+	RejectedConnections int64    `json:"rejectedConnections"` // WebSocket upgrades refused at MaxConnections since start
+	LoadThrottled       bool     `json:"loadThrottled"`       // every room is in slow mode due to load
+	Draining            bool     `json:"draining"`            // connections are being closed for a restart
+	Leaks               []string `json:"leaks,omitempty"`
+
+	// Compaction of persisted history
+	LastCompaction *CompactionReport `json:"lastCompaction,omitempty"`
+	BytesReclaimed int64             `json:"bytesReclaimed"` // since start
+}
+
+// Diagnostics reports the manager's rooms and the chat goroutines running in the process
+func (m *Manager) Diagnostics() Diagnostics {
+	users := 0
+	for _, room := range m.liveRooms() {
+		users += room.UserCount()
+	}
+	live, deleted := m.roomCounts()
+
+	return Diagnostics{
+		Rooms:        live,
+		DeletedRooms: deleted,
+		Users:        users,
+		Goroutines:   runtime.NumGoroutine(),
+		Workers:      workerSnapshot(),
+	}
+}
+
+// Diagnostics extends the manager's report with connection state and leak detection
+func (h *WSHandler) Diagnostics() Diagnostics {
+	d := h.manager.Diagnostics()
+
+	h.eachConnection(func(conn *Connection) {
+		d.Connections++
+		d.PendingFrames += len(conn.Send)
+
+		select {
+		case <-conn.Done():
+			d.Leaks = append(d.Leaks, fmt.Sprintf("closed connection for user %s is still registered", conn.UserID))
+			return
+		default:
+		}
+
+		if !h.manager.hasRoom(conn.StreamKey) {
+			d.Leaks = append(d.Leaks, fmt.Sprintf("connection for user %s outlived its room %s", conn.UserID, conn.StreamKey))
+		}
+	})
+
+	h.subMux.RLock()
+	for _, subs := range h.subscribers {
+		d.Subscribers += len(subs)
+		for sub := range subs {
+			d.PendingFrames += len(sub)
+		}
+	}
+	h.subMux.RUnlock()
+
+	h.pollMux.Lock()
+	d.PollSessions = len(h.pollSessions)
+	h.pollMux.Unlock()
+
+	d.PendingWebhooks = h.webhooks.Pending()
+	d.PendingExports = h.exporter.Pending()
+	if h.writers != nil {
+		d.PendingWrites = h.writers.Pending()
+	}
+	d.DroppedExports = h.exporter.Dropped()
+	d.SlowEvictions = h.slowEvictions.Load()
+	d.RejectedConnections = h.rejectedConns.Load()
+	d.LoadThrottled = h.loadThrottle.Active()
+	d.Draining = h.Draining()
+	d.LastCompaction = h.compaction.last.Load()
+	d.BytesReclaimed = h.compaction.reclaimed.Load()
+
+	sort.Strings(d.Leaks)
+	return d
+}
+
+// hasRoom reports whether a room, live or soft-deleted, exists
+func (m *Manager) hasRoom(streamKey string) bool {
+	shard := m.shard(streamKey)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	return shard.hasLocked(streamKey)
+}
+
+// diagnosticsMonitor periodically logs suspected resource leaks
+func (h *WSHandler) diagnosticsMonitor() {
+	defer trackWorker("ws.diagnostics")()
+
+	ticker := time.NewTicker(diagnosticsInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		for _, leak := range h.Diagnostics().Leaks {
+			log.Printf("Chat leak detected: %s", leak)
+		}
+	}
+}
+
+// DiagnosticsHandler serves GET /api/chat/admin/diagnostics
+func (h *WSHandler) DiagnosticsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.Diagnostics())
+}
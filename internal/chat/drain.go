@@ -0,0 +1,98 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+const maxDrainBodySize = 4 * 1024
+
+// Drain takes the instance out of service for a rolling restart. It stops
+// accepting WebSocket upgrades, tells every connected client it is about to be
+// disconnected and where to reconnect, then closes the connections one at a time
+// spread over window, so they don't all land on the remaining instances at once.
+// It returns once every connection has been closed. Draining can't be undone; the
+// instance is expected to exit afterwards.
+func (h *WSHandler) Drain(reconnectURL string, window time.Duration) {
+	if !h.draining.CompareAndSwap(false, true) {
+		return
+	}
+
+	conns := []*Connection{}
+	h.eachConnection(func(c *Connection) {
+		conns = append(conns, c)
+	})
+	log.Printf("Draining chat: closing %d connections over %s", len(conns), window)
+
+	notice := WSMessage{
+		Type:      "drain",
+		Data:      DrainEvent{ReconnectURL: reconnectURL, Seconds: int(window.Seconds())},
+		Timestamp: time.Now(),
+	}
+	for _, c := range conns {
+		select {
+		case c.Send <- notice:
+			c.wake()
+		default:
+			// The client is behind; it reconnects without being told where
+		}
+	}
+
+	// The first close waits a step too, giving clients time to read the notice
+	var step time.Duration
+	if len(conns) > 0 {
+		step = window / time.Duration(len(conns))
+	}
+	for _, c := range conns {
+		time.Sleep(step)
+		c.Close("")
+	}
+	log.Println("Chat drained")
+}
+
+// Draining reports whether the instance is draining and refusing new connections
+func (h *WSHandler) Draining() bool {
+	return h.draining.Load()
+}
+
+// DrainHandler serves POST /api/chat/admin/drain, starting a drain. The optional
+// body overrides the configured reconnectUrl and windowSeconds.
+func (h *WSHandler) DrainHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body := struct {
+		ReconnectURL  string `json:"reconnectUrl"`
+		WindowSeconds *int   `json:"windowSeconds"`
+	}{ReconnectURL: h.manager.config.DrainReconnectURL}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxDrainBodySize)).Decode(&body); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	window := h.manager.config.DrainSeconds
+	if body.WindowSeconds != nil {
+		if *body.WindowSeconds < 0 {
+			http.Error(w, "windowSeconds must not be negative", http.StatusBadRequest)
+			return
+		}
+		window = *body.WindowSeconds
+	}
+
+	if h.Draining() {
+		http.Error(w, "Already draining", http.StatusConflict)
+		return
+	}
+	go h.Drain(body.ReconnectURL, time.Duration(window)*time.Second)
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"reconnectUrl":  body.ReconnectURL,
+		"windowSeconds": window,
+	})
+}
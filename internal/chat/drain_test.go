@@ -0,0 +1,76 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainClosesConnectionsGradually(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+	bob := dialTestClient(t, server, "room")
+	joinTestClient(t, bob, "bob")
+
+	drained := make(chan struct{})
+	go func() {
+		h.Drain("wss://chat-2.example.com", 200*time.Millisecond)
+		close(drained)
+	}()
+
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		notice := readUntil(t, conn, "drain")
+		require.Equal(t, "wss://chat-2.example.com", notice["data"].(map[string]interface{})["reconnectUrl"])
+	}
+
+	// New WebSockets are turned away while draining
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?streamKey=room"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, CodeDraining, body["code"])
+
+	select {
+	case <-drained:
+	case <-time.After(5 * time.Second):
+		t.Fatal("drain didn't finish")
+	}
+	for _, conn := range []*websocket.Conn{alice, bob} {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				require.True(t, websocket.IsCloseError(err, websocket.CloseNormalClosure), err)
+				break
+			}
+		}
+	}
+	require.True(t, h.Diagnostics().Draining)
+}
+
+func TestDrainHandler(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.DrainHandler(rec, httptest.NewRequest(http.MethodPost, "/api/chat/admin/drain", strings.NewReader(`{"windowSeconds": -1}`)))
+	require.Equal(t, http.StatusBadRequest, rec.Code)
+	require.False(t, h.Draining())
+
+	rec = httptest.NewRecorder()
+	h.DrainHandler(rec, httptest.NewRequest(http.MethodPost, "/api/chat/admin/drain", strings.NewReader(`{"windowSeconds": 0}`)))
+	require.Equal(t, http.StatusAccepted, rec.Code)
+	require.Eventually(t, h.Draining, time.Second, 5*time.Millisecond)
+
+	rec = httptest.NewRecorder()
+	h.DrainHandler(rec, httptest.NewRequest(http.MethodPost, "/api/chat/admin/drain", nil))
+	require.Equal(t, http.StatusConflict, rec.Code)
+}
@@ -0,0 +1,110 @@
+package chat
+
+import (
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultEmbedLimit   = 20
+	defaultEmbedRefresh = 5 // seconds
+	maxEmbedRefresh     = 300
+)
+
+// embedTemplate renders a room's recent messages for OBS browser sources and
+// iframes. It reloads itself with a meta refresh so it needs no JavaScript.
+var embedTemplate = template.Must(template.New("embed").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+{{if .Refresh}}<meta http-equiv="refresh" content="{{.Refresh}}">{{end}}
+<title>Chat</title>
+<style>
+  html, body { margin: 0; background: transparent; color: #fff; font: 16px/1.4 sans-serif; }
+  body { display: flex; flex-direction: column; justify-content: flex-end; min-height: 100vh; }
+  .message { padding: 2px 8px; text-shadow: 0 1px 2px #000; overflow-wrap: anywhere; }
+  .username { font-weight: bold; }
+</style>
+</head>
+<body>
+{{range .Messages}}<div class="message" data-id="{{.ID}}"><span class="username">{{.Username}}</span>: {{.Message}}</div>
+{{end}}</body>
+</html>
+`))
+
+// embedPage is the data behind the embed template and its JSON form
+type embedPage struct {
+	Messages []ChatMessage `json:"messages"`
+	Refresh  int           `json:"refresh"` // seconds until the embed should be reloaded, 0 for never
+}
+
+// carriesToken reports whether a request presents an API token or a JWT
+func carriesToken(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.URL.Query().Get("token") != "" || requestJWT(r) != ""
+}
+
+// EmbedHandler serves GET /api/chat/{streamKey}/embed?limit=N&refresh=S&format=json,
+// a read-only view of the room's last messages that needs no join. It renders HTML
+// that reloads every S seconds (0 disables), or JSON with format=json.
+func (h *WSHandler) EmbedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey", http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	page := embedPage{Refresh: defaultEmbedRefresh}
+
+	limit := defaultEmbedLimit
+	if val := params.Get("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxPageSize)
+	}
+
+	if val := params.Get("refresh"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed < 0 || parsed > maxEmbedRefresh {
+			http.Error(w, fmt.Sprintf("Invalid refresh, must be between 0 and %d seconds", maxEmbedRefresh), http.StatusBadRequest)
+			return
+		}
+		page.Refresh = parsed
+	}
+
+	if err := h.checkHistoryRead(r, streamKey); err != nil {
+		writeChatError(w, http.StatusTooManyRequests, err)
+		return
+	}
+
+	page.Messages = h.manager.GetMessages(streamKey, limit)
+	if page.Refresh > 0 {
+		// What a token was allowed to read mustn't be served from shared caches
+		visibility := "public"
+		if carriesToken(r) {
+			visibility = "private"
+		}
+		w.Header().Set("Cache-Control", fmt.Sprintf("%s, max-age=%d", visibility, page.Refresh))
+	}
+
+	if params.Get("format") == "json" {
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := embedTemplate.Execute(w, page); err != nil {
+		log.Printf("Failed to render chat embed: %v", err)
+	}
+}
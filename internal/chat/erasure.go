@@ -0,0 +1,173 @@
+package chat
+
+import (
+	"log"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// UserEraser is implemented by message and history stores that can remove one
+// user's messages from every room at once
+type UserEraser interface {
+	// EraseUser removes every message the user sent, returning how many were removed
+	EraseUser(userID string) (int, error)
+}
+
+// ErasureReport describes what EraseUserData removed
+type ErasureReport struct {
+	UserID   string              `json:"userId"`
+	Redacted map[string][]string `json:"redacted"` // stream key -> IDs of the buffered messages removed
+	Stored   int                 `json:"stored"`   // messages removed from the message and history stores
+	Replayed int                 `json:"replayed"` // messages removed from session replay logs
+	Stats    int                 `json:"stats"`    // channels whose activity aggregate for the user was removed
+}
+
+// EraseUserData removes what the server keeps about a user, for right-to-erasure
+// requests: their messages in every room's buffer, including rooms awaiting purge,
+// in the message and shared history stores and in session replay logs, their
+// activity stats, their profile, their rate limit record and any saved timeout.
+// Stores that can't erase by user are skipped with a log line, and archives already
+// uploaded are left as they are. The error is the first store failure; everything
+// else is erased regardless.
+func (m *Manager) EraseUserData(userID string) (ErasureReport, error) {
+	report := ErasureReport{UserID: userID, Redacted: make(map[string][]string)}
+
+	for _, room := range m.allRooms() {
+		if ids := room.removeUserMessages(userID); len(ids) > 0 {
+			report.Redacted[room.StreamKey] = ids
+		}
+	}
+
+	// A shared history that is also the message store is erased once
+	stores := []interface{}{}
+	if store := m.persistence(); store != nil {
+		stores = append(stores, store)
+	}
+	if history := m.sharedHistory(); history != nil {
+		if persisted, ok := history.(MessageStore); !ok || persisted != m.persistence() {
+			stores = append(stores, history)
+		}
+	}
+	var firstErr error
+	for _, store := range stores {
+		eraser, ok := store.(UserEraser)
+		if !ok {
+			log.Printf("Chat store %T can't erase a user's messages, skipping it", store)
+			continue
+		}
+		removed, err := eraser.EraseUser(userID)
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		report.Stored += removed
+	}
+
+	replayed, err := m.replay.EraseUser(userID)
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+	report.Replayed = replayed
+
+	stats, err := m.userStats.ForgetUser(userID)
+	if err != nil && firstErr == nil {
+		firstErr = err
+	}
+	report.Stats = stats
+
+	if err := m.profileStore().DeleteProfile(userID); err != nil && firstErr == nil {
+		firstErr = err
+	}
+
+	m.hooksMux.RLock()
+	rl := m.rateLimiter
+	m.hooksMux.RUnlock()
+	if rl != nil {
+		rl.Forget(userID)
+	}
+
+	log.Printf("Erased chat data of user %s from %d rooms", userID, len(report.Redacted))
+	return report, firstErr
+}
+
+// allRooms returns every room, live or awaiting purge
+func (m *Manager) allRooms() []*ChatRoom {
+	rooms := []*ChatRoom{}
+	for _, shard := range m.shards {
+		shard.mutex.RLock()
+		for _, room := range shard.rooms {
+			rooms = append(rooms, room)
+		}
+		for _, deleted := range shard.deletedRooms {
+			rooms = append(rooms, deleted.room)
+		}
+		shard.mutex.RUnlock()
+	}
+	return rooms
+}
+
+// removeUserMessages drops a user's messages from the room's buffer, keeping the
+// rest in order, and returns the IDs of those dropped
+func (cr *ChatRoom) removeUserMessages(userID string) []string {
+	cr.MessagesMux.Lock()
+	defer cr.MessagesMux.Unlock()
+
+	messages := cr.Messages.GetAll()
+	removed := []string{}
+	for _, msg := range messages {
+		if msg.UserID == userID {
+			removed = append(removed, msg.ID)
+		}
+	}
+	if len(removed) == 0 {
+		return nil
+	}
+
+	kept := slices.DeleteFunc(messages, func(msg ChatMessage) bool { return msg.UserID == userID })
+	cr.Messages.Clear()
+	for _, msg := range kept {
+		cr.Messages.Add(msg)
+	}
+	return removed
+}
+
+// EraseUserData erases a user's data like Manager.EraseUserData, then tells each
+// room that held their messages which to take down. The event log can't be
+// rewritten, so a user_erased event is appended to it for its consumers to redact
+// the user's earlier events by.
+func (h *WSHandler) EraseUserData(userID string) (ErasureReport, error) {
+	report, err := h.manager.EraseUserData(userID)
+	h.publishEvent(WebhookEventUserErased, "", map[string]interface{}{
+		"userId": userID,
+	})
+	for streamKey, ids := range report.Redacted {
+		h.broadcast(streamKey, WSMessage{
+			Type:      "messages_redacted",
+			Data:      RedactedEvent{UserID: userID, MessageIDs: ids},
+			Timestamp: time.Now(),
+		}, "")
+	}
+	return report, err
+}
+
+// EraseUserHandler serves POST /api/chat/admin/users/{userID}/erase, erasing a
+// user's chat data on request
+func (h *WSHandler) EraseUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.PathValue("userID")
+	if userID == "" {
+		http.Error(w, "Missing userID", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.EraseUserData(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, report)
+}
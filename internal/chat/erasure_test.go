@@ -0,0 +1,104 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEraseUserData(t *testing.T) {
+	h, server := newTestHandler(t)
+	m := h.manager
+	store := NewMemoryStore()
+	m.SetMessageStore(store)
+	m.SetRateLimiter(h.rateLimiter)
+	h.rateLimiter.SetTimeoutStore(store)
+
+	bob := dialTestClient(t, server, "room")
+	joinTestClient(t, bob, "bob")
+
+	alice, err := m.AddMessage("room", "alice", "Alice", "my address is...")
+	require.NoError(t, err)
+	_, err = m.AddMessage("room", "bob", "Bob", "hi")
+	require.NoError(t, err)
+	elsewhere, err := m.AddMessage("other", "alice", "Alice", "elsewhere")
+	require.NoError(t, err)
+
+	record := h.rateLimiter.lockRecord("alice")
+	record.TimeoutUntil = time.Now().Add(time.Hour)
+	h.rateLimiter.watchTimeout(record, time.Time{})
+	record.mu.Unlock()
+
+	report, err := h.EraseUserData("alice")
+	require.NoError(t, err)
+	require.Equal(t, map[string][]string{"room": {alice.ID}, "other": {elsewhere.ID}}, report.Redacted)
+	require.Equal(t, 2, report.Stored)
+
+	// Buffers and the store keep everyone else's messages
+	require.Equal(t, []string{"hi"}, messageTexts(m.GetMessages("room", 0)))
+	require.Empty(t, m.GetMessages("other", 0))
+	stored, err := store.Range("room", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"hi"}, messageTexts(stored))
+
+	// The rate limiter forgets the user, saved timeout included
+	_, exists := h.rateLimiter.State("alice")
+	require.False(t, exists)
+	timeouts, err := store.LoadTimeouts()
+	require.NoError(t, err)
+	require.Empty(t, timeouts)
+
+	// Connected clients are told to take the messages down
+	frame := readUntil(t, bob, "messages_redacted")
+	require.Equal(t, "room", frame["room"])
+	data := frame["data"].(map[string]interface{})
+	require.Equal(t, "alice", data["userId"])
+	require.Equal(t, []interface{}{alice.ID}, data["messageIds"])
+}
+
+func TestEraseUserDataFromReplaysAndStats(t *testing.T) {
+	config := DefaultConfig()
+	config.ReplayDir = t.TempDir()
+	config.StatsDir = t.TempDir()
+	m := NewManager(config)
+	defer m.Stop()
+
+	_, err := m.AddMessage("room", "alice", "Alice", "compacted")
+	require.NoError(t, err)
+	bob, err := m.AddMessage("room", "bob", "Bob", "hi")
+	require.NoError(t, err)
+	require.NoError(t, m.replay.Compact(time.Now().Add(time.Hour), &CompactionReport{}))
+	_, err = m.AddMessage("room", "alice", "Alice", "pending")
+	require.NoError(t, err)
+
+	// Alice, moderating, deleted Bob's message
+	room, _ := m.GetRoom("room")
+	m.replay.RecordTombstone(room.startedAt, Tombstone{StreamKey: "room", MessageID: bob.ID, Type: TombstoneDeleted, ByUserID: "alice", Timestamp: time.Now()})
+	require.NoError(t, m.userStats.Flush())
+
+	report, err := m.EraseUserData("alice")
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Replayed)
+	require.Equal(t, 1, report.Stats)
+
+	// The replay keeps Bob's message, deleted by nobody in particular
+	sessionID := replaySessionID(room.startedAt)
+	messages, err := m.replay.Messages("room", sessionID, 0)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, bob.ID, messages[0].ID)
+	require.NotZero(t, messages[0].DeletedMs)
+	path := m.replay.path("room", sessionID)
+	for _, logPath := range []string{path + gzipSuffix, path} {
+		require.NoError(t, readReplayLog(logPath, func(entry replayEntry) {
+			require.False(t, entry.Message != nil && entry.Message.UserID == "alice")
+			require.False(t, entry.Tombstone != nil && entry.Tombstone.ByUserID == "alice")
+		}))
+	}
+
+	// Stats forget Alice in memory and on disk
+	require.Empty(t, m.userStats.UserActivity("alice"))
+	require.Empty(t, NewUserStatsStore(config.StatsDir).UserActivity("alice"))
+	require.Contains(t, NewUserStatsStore(config.StatsDir).UserActivity("bob"), "room")
+}
@@ -0,0 +1,229 @@
+package chat
+
+import "time"
+
+// Error codes sent in the code field of "error" and "rate_limit" frames and of
+// HTTP error bodies. Clients should branch on these, and on the error's details,
+// rather than on its message, which is English prose that may change.
+const (
+	// Joining and rooms
+	CodeRoomFull         = "ROOM_FULL"
+	CodeTooManyRooms     = "TOO_MANY_ROOMS"
+	CodeJoinRateLimit    = "JOIN_RATE_LIMIT"
+	CodeNotJoined        = "NOT_JOINED"
+	CodeAlreadyJoined    = "ALREADY_JOINED"
+	CodeNotInRoom        = "NOT_IN_ROOM"
+	CodeRoomNotFound     = "ROOM_NOT_FOUND"
+	CodeRoomNotAllowed   = "ROOM_NOT_ALLOWED"
+	CodeStreamNotFound   = "STREAM_NOT_FOUND"
+	CodeStreamEnded      = "STREAM_ENDED"
+	CodeChatDisabled     = "CHAT_DISABLED"
+	CodeHistoryThrottled = "HISTORY_THROTTLED"
+	CodeCursorNotFound   = "CURSOR_NOT_FOUND"
+	CodeUnauthenticated  = "UNAUTHENTICATED"
+	CodeIdentityMismatch = "IDENTITY_MISMATCH"
+	CodeGuestsDisabled   = "GUESTS_DISABLED"
+	CodeGuestReadOnly    = "GUEST_READ_ONLY"
+	CodeUsernameTaken    = "USERNAME_TAKEN"
+	CodeUsernameReserved = "USERNAME_RESERVED"
+
+	// Room modes
+	CodeReadOnly  = "READ_ONLY"
+	CodeSlowMode  = "SLOW_MODE"
+	CodeEmoteOnly = "EMOTE_ONLY"
+
+	// Moderation
+	CodeNotPermitted = "NOT_PERMITTED"
+
+	// Rate limiting and spam protection
+	CodeTimeout                = "TIMEOUT"
+	CodeRateLimit              = "RATE_LIMIT"
+	CodeRateLimitLongMessage   = "RATE_LIMIT_LONG_MESSAGE"
+	CodeRateLimitMediumMessage = "RATE_LIMIT_MEDIUM_MESSAGE"
+	CodeMessageTooLong         = "MESSAGE_TOO_LONG"
+	CodeSpamDetected           = "SPAM_DETECTED"
+	CodeHeavySpam              = "HEAVY_SPAM"
+	CodeDuplicateSpam          = "DUPLICATE_SPAM"
+	CodeHeavyTextSpam          = "HEAVY_TEXT_SPAM"
+	CodeRepeatOffender         = "REPEAT_OFFENDER"
+	CodeMessageBlocked         = "MESSAGE_BLOCKED"
+	CodeEchoSuppressed         = "ECHO_SUPPRESSED"
+	CodeSlowClient             = "SLOW_CLIENT"
+	CodeServerFull             = "SERVER_FULL"
+	CodeIPConnectionLimit      = "IP_CONNECTION_LIMIT"
+	CodeIPJoinRateLimit        = "IP_JOIN_RATE_LIMIT"
+	CodeDraining               = "DRAINING"
+
+	// Protocol
+	CodeProtocolUnsupported = "PROTOCOL_UNSUPPORTED"
+	CodeInvalidFrame        = "INVALID_FRAME"
+	CodeReservationNotFound = "RESERVATION_NOT_FOUND"
+	CodeTooManyReservations = "TOO_MANY_RESERVATIONS"
+	CodeUnauthorized        = "UNAUTHORIZED"
+	CodeForbidden           = "FORBIDDEN"
+	CodeOriginNotAllowed    = "ORIGIN_NOT_ALLOWED"
+	CodeReplayDisabled      = "REPLAY_DISABLED"
+	CodeReplayNotFound      = "REPLAY_NOT_FOUND"
+)
+
+// Tiers name the limit an error's details.tier says was exceeded. Several codes can
+// share a tier, and a TIMEOUT reports the tier that earned the timeout.
+const (
+	TierBurst          = "burst"
+	TierSpam           = "spam"
+	TierHeavySpam      = "heavy_spam"
+	TierLongMessage    = "long_message"
+	TierMediumMessage  = "medium_message"
+	TierMessageLength  = "message_length"
+	TierDuplicate      = "duplicate"
+	TierTextSpam       = "text_spam"
+	TierRepeatOffender = "repeat_offender"
+	TierSlowMode       = "slow_mode"
+	TierJoinRate       = "join_rate"
+	TierHistoryReads   = "history_reads"
+	TierLoad           = "load"
+	TierModerator      = "moderator"
+	TierIPConnections  = "ip_connections"
+	TierIPJoinRate     = "ip_join_rate"
+)
+
+// ErrorCodeInfo documents one error code for clients
+type ErrorCodeInfo struct {
+	Code        string
+	Description string
+}
+
+// ErrorCodes lists every error code the server sends. The client SDKs' error code
+// types are generated from it, so new codes must be added here.
+var ErrorCodes = []ErrorCodeInfo{
+	{CodeRoomFull, "The room has as many users as it allows"},
+	{CodeTooManyRooms, "The user is in as many rooms as one user may be; details.limit is the cap"},
+	{CodeJoinRateLimit, "The user joined rooms too quickly; details give the limit, window and when to retry"},
+	{CodeNotJoined, "The frame needs a join first"},
+	{CodeAlreadyJoined, "The session has already joined"},
+	{CodeNotInRoom, "The frame names a room the connection hasn't joined"},
+	{CodeRoomNotFound, "The room does not exist"},
+	{CodeRoomNotAllowed, "The server's room policy refused to create the room"},
+	{CodeStreamNotFound, "No stream has this key"},
+	{CodeStreamEnded, "The stream is no longer live"},
+	{CodeChatDisabled, "The streamer turned chat off; don't reconnect until it's back on"},
+	{CodeHistoryThrottled, "History was withheld because the user reads too many rooms; retry after details.retryAfterSeconds"},
+	{CodeCursorNotFound, "The history page cursor is no longer stored"},
+	{CodeUnauthenticated, "Joining needs credentials the server accepts, and the client's were missing, invalid, expired or revoked"},
+	{CodeIdentityMismatch, "The join's userId isn't the user the connection's credentials belong to"},
+	{CodeGuestsDisabled, "The server doesn't let guests join; join as a user"},
+	{CodeGuestReadOnly, "Guests can watch but not chat; join as a user to chat"},
+	{CodeUsernameTaken, "Another user in the room has the same name, or one that looks like it; join under another"},
+	{CodeUsernameReserved, "The name, or one that looks like it, is reserved for a signed-in account"},
+	{CodeReadOnly, "The room is read-only"},
+	{CodeSlowMode, "Slow mode allows one message per details.window seconds; retry after details.retryAfterSeconds"},
+	{CodeEmoteOnly, "The room only accepts emotes"},
+	{CodeNotPermitted, "The user's roles in the room don't allow the action, or the user it targets ranks as high"},
+	{CodeTimeout, "The user is timed out; retry after details.retryAfterSeconds"},
+	{CodeRateLimit, "Too many messages in a short burst; the user is timed out"},
+	{CodeRateLimitLongMessage, "Too many long messages; details give the limit and window"},
+	{CodeRateLimitMediumMessage, "Too many medium-length messages; details give the limit and window"},
+	{CodeMessageTooLong, "The message is longer than details.limit characters"},
+	{CodeSpamDetected, "Sustained messaging above the spam limit; the user is timed out"},
+	{CodeHeavySpam, "Messaging far above the spam limit; the user is timed out"},
+	{CodeDuplicateSpam, "The same message was sent repeatedly; the user is timed out"},
+	{CodeHeavyTextSpam, "Too many characters in a short time; the user is timed out"},
+	{CodeRepeatOffender, "Repeated violations; the user is timed out for longer each time"},
+	{CodeMessageBlocked, "The chat filter blocked the message"},
+	{CodeEchoSuppressed, "A bridge relayed a message that is already in chat"},
+	{CodeSlowClient, "The client isn't reading frames fast enough; some were skipped, and the connection closes if it stays behind"},
+	{CodeServerFull, "The server has as many connections as it accepts; retry after details.retryAfterSeconds"},
+	{CodeIPConnectionLimit, "The client's address has details.limit connections open, as many as one address may"},
+	{CodeIPJoinRateLimit, "The client's address opened connections too quickly; details give the limit, window and when to retry"},
+	{CodeDraining, "The server is shutting down and accepts no new connections; retry after details.retryAfterSeconds"},
+	{CodeProtocolUnsupported, "The client's protocol version is too old"},
+	{CodeInvalidFrame, "The frame doesn't match the protocol; fields lists the problems"},
+	{CodeReservationNotFound, "The reserved message ID is unknown or expired"},
+	{CodeTooManyReservations, "The connection holds details.limit unused message IDs"},
+	{CodeUnauthorized, "The request needs a valid API token"},
+	{CodeForbidden, "The API token lacks the required scope"},
+	{CodeOriginNotAllowed, "The page's origin isn't on the server's allowlist for WebSocket connections"},
+	{CodeReplayDisabled, "The server doesn't record chat for replay"},
+	{CodeReplayNotFound, "No chat was recorded for the stream session"},
+}
+
+// Error definitions
+var (
+	ErrRoomFull            = &ChatError{Code: CodeRoomFull, Message: "Chat room is full"}
+	ErrTimeout             = &ChatError{Code: CodeTimeout, Message: "You are timed out from chat"}
+	ErrRateLimit           = &ChatError{Code: CodeRateLimit, Message: "You are sending messages too quickly"}
+	ErrTooManyRooms        = &ChatError{Code: CodeTooManyRooms, Message: "You have joined too many chat rooms"}
+	ErrJoinRateLimit       = &ChatError{Code: CodeJoinRateLimit, Message: "You are joining chat rooms too quickly"}
+	ErrNotJoined           = &ChatError{Code: CodeNotJoined, Message: "Not joined to chat"}
+	ErrAlreadyJoined       = &ChatError{Code: CodeAlreadyJoined, Message: "Already joined to chat"}
+	ErrHistoryThrottled    = &ChatError{Code: CodeHistoryThrottled, Message: "Chat history is temporarily unavailable"}
+	ErrCursorNotFound      = &ChatError{Code: CodeCursorNotFound, Message: "Message cursor is no longer available"}
+	ErrUnauthorized        = &ChatError{Code: CodeUnauthorized, Message: "A valid API token is required"}
+	ErrForbidden           = &ChatError{Code: CodeForbidden, Message: "API token lacks the required scope"}
+	ErrOriginNotAllowed    = &ChatError{Code: CodeOriginNotAllowed, Message: "Chat can't be embedded on this site"}
+	ErrMessageBlocked      = &ChatError{Code: CodeMessageBlocked, Message: "Your message was blocked by the chat filter"}
+	ErrStreamNotFound      = &ChatError{Code: CodeStreamNotFound, Message: "This stream does not exist"}
+	ErrStreamEnded         = &ChatError{Code: CodeStreamEnded, Message: "This stream has ended"}
+	ErrProtocolUnsupported = &ChatError{Code: CodeProtocolUnsupported, Message: "Chat protocol version is no longer supported"}
+	ErrRoomNotAllowed      = &ChatError{Code: CodeRoomNotAllowed, Message: "Chat is not available for this stream"}
+	ErrInvalidFrame        = &ChatError{Code: CodeInvalidFrame, Message: "Chat frame does not match the protocol"}
+	ErrRoomNotFound        = &ChatError{Code: CodeRoomNotFound, Message: "Chat room does not exist"}
+	ErrNotInRoom           = &ChatError{Code: CodeNotInRoom, Message: "You have not joined that chat room"}
+	ErrRoomReadOnly        = &ChatError{Code: CodeReadOnly, Message: "Chat is in read-only mode"}
+	ErrChatDisabled        = &ChatError{Code: CodeChatDisabled, Message: "The streamer has turned chat off"}
+	ErrReplayDisabled      = &ChatError{Code: CodeReplayDisabled, Message: "Chat replay is not enabled on this server"}
+	ErrReplayNotFound      = &ChatError{Code: CodeReplayNotFound, Message: "No chat was recorded for this stream session"}
+	ErrSlowMode            = &ChatError{Code: CodeSlowMode, Message: "Chat is in slow mode."}
+	ErrEmoteOnly           = &ChatError{Code: CodeEmoteOnly, Message: "Chat is in emote-only mode"}
+	ErrReservationNotFound = &ChatError{Code: CodeReservationNotFound, Message: "Message ID reservation is unknown or has expired"}
+	ErrTooManyReservations = &ChatError{Code: CodeTooManyReservations, Message: "Too many message IDs are reserved"}
+	ErrEchoSuppressed      = &ChatError{Code: CodeEchoSuppressed, Message: "Message is already in chat"}
+	ErrSlowClient          = &ChatError{Code: CodeSlowClient, Message: "Your connection is too slow to keep up with chat"}
+	ErrServerFull          = &ChatError{Code: CodeServerFull, Message: "Chat is at capacity, try again shortly"}
+	ErrIPConnectionLimit   = &ChatError{Code: CodeIPConnectionLimit, Message: "Too many chat connections from your network"}
+	ErrIPJoinRateLimit     = &ChatError{Code: CodeIPJoinRateLimit, Message: "Too many chat connection attempts from your network, try again shortly"}
+	ErrDraining            = &ChatError{Code: CodeDraining, Message: "Chat is restarting, try again shortly"}
+	ErrUnauthenticated     = &ChatError{Code: CodeUnauthenticated, Message: "Sign in to chat"}
+	ErrIdentityMismatch    = &ChatError{Code: CodeIdentityMismatch, Message: "You can only join as the user you signed in as"}
+	ErrGuestsDisabled      = &ChatError{Code: CodeGuestsDisabled, Message: "Sign in to watch chat"}
+	ErrGuestReadOnly       = &ChatError{Code: CodeGuestReadOnly, Message: "Sign in to chat"}
+	ErrUsernameTaken       = &ChatError{Code: CodeUsernameTaken, Message: "Someone in this chat already goes by that name"}
+	ErrUsernameReserved    = &ChatError{Code: CodeUsernameReserved, Message: "That name is reserved"}
+	ErrNotPermitted        = &ChatError{Code: CodeNotPermitted, Message: "You don't have permission to do that"}
+)
+
+// ErrorDetails are the machine-readable specifics of an error, so clients can show
+// a countdown or the exceeded limit without parsing the message
+type ErrorDetails struct {
+	RetryAfterSeconds int    `json:"retryAfterSeconds,omitempty"` // until the action may succeed
+	Limit             int    `json:"limit,omitempty"`             // the limit that was reached
+	Window            int    `json:"window,omitempty"`            // seconds the limit counts over
+	Tier              string `json:"tier,omitempty"`              // which limit, one of the Tier constants
+}
+
+// ChatError represents a chat error
+type ChatError struct {
+	Code    string
+	Message string
+	Details *ErrorDetails // for errors about limits
+}
+
+func (e *ChatError) Error() string {
+	return e.Message
+}
+
+// Is matches chat errors by code, so errors.Is finds copies that carry details
+func (e *ChatError) Is(target error) bool {
+	t, ok := target.(*ChatError)
+	return ok && t.Code == e.Code
+}
+
+// retryAfter rounds a wait up to whole seconds for ErrorDetails.RetryAfterSeconds
+func retryAfter(wait time.Duration) int {
+	return int((wait + time.Second - 1) / time.Second)
+}
+
+// withDetails returns a copy of the error carrying details
+func (e *ChatError) withDetails(details ErrorDetails) *ChatError {
+	return &ChatError{Code: e.Code, Message: e.Message, Details: &details}
+}
@@ -0,0 +1,63 @@
+package chat
+
+import (
+	"sync"
+)
+
+// Event types published on the EventBus
+const (
+	EventViewerCountChanged = "viewer_count_changed"
+)
+
+// Event is something that happened in chat that other parts of the server, such as
+// the video layer, may react to
+type Event struct {
+	Type      string
+	StreamKey string
+	Data      interface{}
+}
+
+// EventBus delivers chat events to in-process subscribers
+type EventBus struct {
+	handlers map[int]func(Event)
+	nextID   int
+	mutex    sync.RWMutex
+}
+
+// NewEventBus creates a bus with no subscribers
+func NewEventBus() *EventBus {
+	return &EventBus{
+		handlers: make(map[int]func(Event)),
+	}
+}
+
+// Subscribe registers a handler for every event and returns a function that removes it.
+// Handlers run synchronously on the publishing goroutine and must not block.
+func (b *EventBus) Subscribe(handler func(Event)) func() {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = handler
+
+	return func() {
+		b.mutex.Lock()
+		defer b.mutex.Unlock()
+		delete(b.handlers, id)
+	}
+}
+
+// Publish delivers an event to every subscriber
+func (b *EventBus) Publish(event Event) {
+	b.mutex.RLock()
+	handlers := make([]func(Event), 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.mutex.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,223 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+)
+
+// Formats accepted by CHAT_KAFKA_FORMAT
+const (
+	ExportFormatJSON    = "json"
+	ExportFormatMsgpack = "msgpack"
+)
+
+const (
+	exportQueueSize    = 10000
+	exportBatchSize    = 500
+	exportBatchTimeout = time.Second
+	exportWriteTimeout = 10 * time.Second
+)
+
+// exportWriter is the part of kafka.Writer the exporter uses
+type exportWriter interface {
+	WriteMessages(ctx context.Context, messages ...kafka.Message) error
+	Close() error
+}
+
+// EventExporter streams every chat event webhooks can receive (messages, joins,
+// leaves and moderation actions) to a Kafka topic for analytics and compliance.
+// Events are queued without blocking and encoded and written in batches by a
+// background worker, so exporting adds nothing to the broadcast path. Each record
+// is keyed by stream key, keeping a room's events in order within a partition.
+type EventExporter struct {
+	writer  exportWriter // nil when export is disabled
+	codec   Codec
+	queue   chan WebhookEvent
+	dropped atomic.Int64
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewKafkaExporter creates an exporter writing to the topic on the given brokers in
+// the given format. With no brokers it is disabled and drops every event.
+func NewKafkaExporter(brokers []string, topic string, format string) (*EventExporter, error) {
+	if len(brokers) == 0 {
+		return &EventExporter{}, nil
+	}
+
+	codec, err := exportCodec(format)
+	if err != nil {
+		return nil, err
+	}
+
+	return newEventExporter(&kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    exportBatchSize,
+		BatchTimeout: exportBatchTimeout,
+		WriteTimeout: exportWriteTimeout,
+		RequiredAcks: kafka.RequireOne,
+	}, codec), nil
+}
+
+// exportCodec returns the codec for an export format
+func exportCodec(format string) (Codec, error) {
+	switch format {
+	case ExportFormatJSON, "":
+		return stdJSONCodec{}, nil
+	case ExportFormatMsgpack:
+		return msgpackCodec{}, nil
+	default:
+		return nil, fmt.Errorf("unknown chat export format %q", format)
+	}
+}
+
+// newEventExporter starts an exporter on a writer
+func newEventExporter(writer exportWriter, codec Codec) *EventExporter {
+	e := &EventExporter{
+		writer: writer,
+		codec:  codec,
+		queue:  make(chan WebhookEvent, exportQueueSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go e.worker()
+	return e
+}
+
+// Export queues an event. It never blocks; events are dropped, and counted, if
+// the queue is full.
+func (e *EventExporter) Export(eventType, streamKey string, data interface{}) {
+	if e.writer == nil {
+		return
+	}
+
+	event := WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		StreamKey: streamKey,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		if e.dropped.Add(1)%1000 == 1 {
+			log.Printf("Chat export queue full, dropped %d events so far", e.dropped.Load())
+		}
+	}
+}
+
+// Pending returns the number of events waiting to be written
+func (e *EventExporter) Pending() int {
+	return len(e.queue)
+}
+
+// Dropped returns how many events were dropped because the queue was full
+func (e *EventExporter) Dropped() int64 {
+	return e.dropped.Load()
+}
+
+// Close writes the events already queued and closes the writer
+func (e *EventExporter) Close() error {
+	if e.writer == nil {
+		return nil
+	}
+
+	e.once.Do(func() {
+		close(e.stop)
+	})
+	<-e.done
+	return e.writer.Close()
+}
+
+// worker writes queued events in batches of up to exportBatchSize, waiting at most
+// exportBatchTimeout to fill one
+func (e *EventExporter) worker() {
+	defer trackWorker("export.worker")()
+	defer close(e.done)
+
+	ticker := time.NewTicker(exportBatchTimeout)
+	defer ticker.Stop()
+
+	batch := make([]kafka.Message, 0, exportBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), exportWriteTimeout)
+		if err := e.writer.WriteMessages(ctx, batch...); err != nil {
+			log.Printf("Failed to export %d chat events: %v", len(batch), err)
+		}
+		cancel()
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case event := <-e.queue:
+			if message, ok := e.encode(event); ok {
+				batch = append(batch, message)
+			}
+			if len(batch) >= exportBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.stop:
+			for {
+				select {
+				case event := <-e.queue:
+					if message, ok := e.encode(event); ok {
+						batch = append(batch, message)
+					}
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+// encode turns an event into a Kafka record keyed by its stream key
+func (e *EventExporter) encode(event WebhookEvent) (kafka.Message, bool) {
+	value, err := e.codec.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode %s event for export: %v", event.Type, err)
+		return kafka.Message{}, false
+	}
+
+	return kafka.Message{
+		Key:   []byte(event.StreamKey),
+		Value: value,
+		Time:  event.Timestamp,
+		Headers: []kafka.Header{
+			{Key: "type", Value: []byte(event.Type)},
+		},
+	}, true
+}
+
+// publishEvent records a chat event that isn't broadcast in the event log, then
+// hands it to webhooks and the event export
+func (h *WSHandler) publishEvent(eventType, streamKey string, data interface{}) {
+	h.logEvent(eventType, streamKey, data)
+	h.dispatchEvent(eventType, streamKey, data)
+}
+
+// dispatchEvent hands a chat event to webhooks and the event export
+func (h *WSHandler) dispatchEvent(eventType, streamKey string, data interface{}) {
+	h.webhooks.Dispatch(eventType, streamKey, data)
+	h.exporter.Export(eventType, streamKey, data)
+}
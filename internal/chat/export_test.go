@@ -0,0 +1,66 @@
+package chat
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingWriter collects the records an exporter writes
+type recordingWriter struct {
+	messages []kafka.Message
+	closed   bool
+	mutex    sync.Mutex
+}
+
+func (w *recordingWriter) WriteMessages(_ context.Context, messages ...kafka.Message) error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.messages = append(w.messages, messages...)
+	return nil
+}
+
+func (w *recordingWriter) Close() error {
+	w.closed = true
+	return nil
+}
+
+func TestEventExporterWritesKeyedRecords(t *testing.T) {
+	writer := &recordingWriter{}
+	exporter := newEventExporter(writer, stdJSONCodec{})
+
+	msg := newChatMessage("room", "alice", "alice", "hello")
+	exporter.Export(WebhookEventMessage, "room", msg)
+	exporter.Export(WebhookEventUserTimeout, "room", map[string]interface{}{"userId": "alice"})
+	require.NoError(t, exporter.Close())
+	require.True(t, writer.closed)
+
+	require.Len(t, writer.messages, 2)
+	record := writer.messages[0]
+	require.Equal(t, "room", string(record.Key))
+	require.Equal(t, []kafka.Header{{Key: "type", Value: []byte(WebhookEventMessage)}}, record.Headers)
+
+	var event struct {
+		Type      string      `json:"type"`
+		StreamKey string      `json:"streamKey"`
+		Data      ChatMessage `json:"data"`
+	}
+	require.NoError(t, stdJSONCodec{}.Unmarshal(record.Value, &event))
+	require.Equal(t, WebhookEventMessage, event.Type)
+	require.Equal(t, "hello", event.Data.Message)
+	require.Equal(t, WebhookEventUserTimeout, string(writer.messages[1].Headers[0].Value))
+}
+
+func TestKafkaExporterDisabledWithoutBrokers(t *testing.T) {
+	exporter, err := NewKafkaExporter(nil, "chat-events", ExportFormatJSON)
+	require.NoError(t, err)
+	exporter.Export(WebhookEventMessage, "room", nil)
+	require.Zero(t, exporter.Pending())
+	require.NoError(t, exporter.Close())
+
+	_, err = NewKafkaExporter([]string{"localhost:9092"}, "chat-events", "xml")
+	require.ErrorContains(t, err, "unknown chat export format")
+}
@@ -0,0 +1,440 @@
+package chat
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/glimesh/broadcast-box/internal/chat/chatpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// GRPCServer serves the chat protocol over gRPC for server-side consumers
+type GRPCServer struct {
+	chatpb.UnimplementedChatServer
+
+	handler *WSHandler
+	server  *grpc.Server
+}
+
+// NewGRPCServer creates a gRPC server backed by the WebSocket handler's rooms
+func NewGRPCServer(h *WSHandler) *GRPCServer {
+	s := &GRPCServer{
+		handler: h,
+		server:  grpc.NewServer(),
+	}
+	chatpb.RegisterChatServer(s.server, s)
+	return s
+}
+
+// ListenAndServe accepts gRPC clients on addr until the server is stopped
+func (s *GRPCServer) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Chat gRPC API listening on %s", addr)
+	return s.Serve(listener)
+}
+
+// Serve accepts gRPC clients on an existing listener
+func (s *GRPCServer) Serve(listener net.Listener) error {
+	return s.server.Serve(listener)
+}
+
+// Stop closes every stream and the listener
+func (s *GRPCServer) Stop() {
+	s.server.Stop()
+}
+
+// grpcTransport carries a Connection over a gRPC stream
+type grpcTransport struct {
+	cancel context.CancelFunc
+	reason string
+	mutex  sync.Mutex
+}
+
+// Close ends the stream, reporting the reason to the client as its status
+func (t *grpcTransport) Close(reason string) error {
+	t.mutex.Lock()
+	t.reason = reason
+	t.mutex.Unlock()
+
+	t.cancel()
+	return nil
+}
+
+// closeReason returns the reason the server closed the stream, if any
+func (t *grpcTransport) closeReason() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.reason
+}
+
+// Connect runs a chat session for the lifetime of the stream
+func (s *GRPCServer) Connect(stream chatpb.Chat_ConnectServer) error {
+	remoteAddr := ""
+	if p, ok := peer.FromContext(stream.Context()); ok {
+		if host, _, err := net.SplitHostPort(p.Addr.String()); err == nil {
+			remoteAddr = host
+		}
+	}
+	credentials := streamCredentials(stream.Context(), remoteAddr)
+	credentials.RemoteAddr = s.handler.proxies.Resolve(remoteAddr, credentials.Header)
+
+	if err := s.handler.admit(credentials.RemoteAddr); err != nil {
+		code := codes.Unavailable
+		if admissionStatus(err) == http.StatusTooManyRequests {
+			code = codes.ResourceExhausted
+		}
+		return status.Error(code, err.Message)
+	}
+	defer s.handler.releaseConnection(credentials.RemoteAddr)
+
+	first, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+
+	join := first.GetJoin()
+	if join == nil {
+		return status.Error(codes.InvalidArgument, "first frame must be a join")
+	}
+	if join.StreamKey == "" {
+		return status.Error(codes.InvalidArgument, "missing stream key")
+	}
+	if err := s.handler.manager.OpenRoom(join.StreamKey, nil); err != nil {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(stream.Context())
+	defer cancel()
+
+	transport := &grpcTransport{cancel: cancel}
+	conn := newConnection(s.handler, join.StreamKey, credentials.RemoteAddr, transport)
+	conn.credentials = credentials
+	conn.statsAllowed = s.handler.tokens.HeaderAuthorized(credentials.Header, ScopeReadStats)
+	defer conn.cleanup()
+
+	conn.handleMessage(joinFrame(join))
+	if conn.UserID == "" {
+		// The join was refused; its error frame is already queued
+		for {
+			select {
+			case msg := <-conn.Send:
+				if msg.Type == "error" {
+					return status.Error(codes.FailedPrecondition, msg.Error)
+				}
+			default:
+				return status.Error(codes.FailedPrecondition, "join refused")
+			}
+		}
+	}
+
+	go s.readFrames(stream, conn, cancel)
+
+	for {
+		select {
+		case msg := <-conn.Send:
+			event := toServerEvent(msg)
+			if event == nil {
+				continue
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+			conn.traceWritten(msg)
+
+		case <-ctx.Done():
+			if reason := transport.closeReason(); reason != "" {
+				return status.Error(codes.PermissionDenied, reason)
+			}
+			return nil
+		}
+	}
+}
+
+// readFrames feeds client frames into the session until the client stops sending
+func (s *GRPCServer) readFrames(stream chatpb.Chat_ConnectServer, conn *Connection, cancel context.CancelFunc) {
+	defer trackWorker("grpc.readFrames")()
+	defer cancel()
+
+	for {
+		frame, err := stream.Recv()
+		if err != nil {
+			return
+		}
+
+		if frame.GetJoin() != nil {
+			conn.sendChatError(ErrAlreadyJoined)
+			continue
+		}
+		conn.handleMessage(clientFrameMessage(frame))
+	}
+}
+
+// streamCredentials returns the credentials in a stream's metadata, with the
+// bearer token from its authorization entry
+func streamCredentials(ctx context.Context, remoteAddr string) Credentials {
+	credentials := Credentials{Header: http.Header{}, RemoteAddr: remoteAddr}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for key, values := range md {
+		credentials.Header[http.CanonicalHeaderKey(key)] = values
+	}
+	for _, value := range md.Get("authorization") {
+		if token, ok := strings.CutPrefix(value, "Bearer "); ok {
+			credentials.Token = token
+		}
+	}
+	return credentials
+}
+
+// joinFrame converts a gRPC join into the frame the session layer expects
+func joinFrame(join *chatpb.Join) map[string]interface{} {
+	return map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{
+			"userId":   join.UserId,
+			"username": join.Username,
+		},
+	}
+}
+
+// clientFrameMessage converts a protobuf client frame into the frame the session layer expects
+func clientFrameMessage(frame *chatpb.ClientFrame) map[string]interface{} {
+	switch f := frame.Frame.(type) {
+	case *chatpb.ClientFrame_Join:
+		return joinFrame(f.Join)
+	case *chatpb.ClientFrame_Message:
+		return map[string]interface{}{
+			"type": "message",
+			"data": map[string]interface{}{"message": f.Message.Message, "id": f.Message.Id},
+		}
+	case *chatpb.ClientFrame_Typing:
+		return map[string]interface{}{
+			"type": "typing",
+			"data": map[string]interface{}{"isTyping": f.Typing.IsTyping},
+		}
+	case *chatpb.ClientFrame_Hello:
+		return map[string]interface{}{
+			"type": "hello",
+			"data": map[string]interface{}{"protocolVersion": int(f.Hello.ProtocolVersion)},
+		}
+	case *chatpb.ClientFrame_Reserve:
+		return map[string]interface{}{
+			"type": "reserve",
+			"data": map[string]interface{}{},
+		}
+	case *chatpb.ClientFrame_Ping:
+		return map[string]interface{}{
+			"type": "ping",
+			"data": map[string]interface{}{"clientTime": f.Ping.ClientTimeMs},
+		}
+	case *chatpb.ClientFrame_Stats:
+		return map[string]interface{}{
+			"type": "stats",
+			"data": map[string]interface{}{"subscribe": f.Stats.Subscribe, "intervalSeconds": int(f.Stats.IntervalSeconds)},
+		}
+	}
+
+	// No type, which handleMessage rejects
+	return map[string]interface{}{}
+}
+
+// toServerEvent converts a session frame to its gRPC event, or nil if it has no equivalent
+func toServerEvent(msg WSMessage) *chatpb.ServerEvent {
+	event := &chatpb.ServerEvent{Timestamp: timestamppb.New(msg.Timestamp), Room: msg.Room}
+
+	switch msg.Type {
+	case "hello":
+		hello, ok := msg.Data.(HelloEvent)
+		if !ok {
+			return nil
+		}
+		event.Event = &chatpb.ServerEvent_Hello{Hello: &chatpb.Hello{
+			ProtocolVersion:    uint32(hello.ProtocolVersion),
+			MinProtocolVersion: uint32(hello.MinProtocolVersion),
+			Features:           hello.Features,
+		}}
+
+	case "message":
+		chatMsg, ok := msg.Data.(*ChatMessage)
+		if !ok {
+			return nil
+		}
+		event.Event = &chatpb.ServerEvent_Message{Message: toChatMessage(*chatMsg)}
+
+	case "history":
+		messages, ok := msg.Data.([]ChatMessage)
+		if !ok {
+			return nil
+		}
+		history := &chatpb.History{Messages: make([]*chatpb.ChatMessage, 0, len(messages))}
+		for _, chatMsg := range messages {
+			history.Messages = append(history.Messages, toChatMessage(chatMsg))
+		}
+		event.Event = &chatpb.ServerEvent_History{History: history}
+
+	case "message_batch":
+		messages, ok := msg.Data.([]*ChatMessage)
+		if !ok {
+			return nil
+		}
+		batch := &chatpb.MessageBatch{Messages: make([]*chatpb.ChatMessage, 0, len(messages))}
+		for _, chatMsg := range messages {
+			batch.Messages = append(batch.Messages, toChatMessage(*chatMsg))
+		}
+		event.Event = &chatpb.ServerEvent_MessageBatch{MessageBatch: batch}
+
+	case "users":
+		users, ok := msg.Data.([]*ChatUser)
+		if !ok {
+			return nil
+		}
+		list := &chatpb.UserList{Users: make([]*chatpb.User, 0, len(users))}
+		for _, user := range users {
+			list.Users = append(list.Users, &chatpb.User{UserId: user.UserID, Username: user.Username})
+		}
+		event.Event = &chatpb.ServerEvent_Users{Users: list}
+
+	case "user_joined", "user_left":
+		user, ok := msg.Data.(UserEvent)
+		if !ok {
+			return nil
+		}
+		userEvent := &chatpb.UserEvent{UserId: user.UserID, Username: user.Username}
+		if msg.Type == "user_joined" {
+			event.Event = &chatpb.ServerEvent_UserJoined{UserJoined: userEvent}
+		} else {
+			event.Event = &chatpb.ServerEvent_UserLeft{UserLeft: userEvent}
+		}
+
+	case "typing":
+		typing, ok := msg.Data.(TypingEvent)
+		if !ok {
+			return nil
+		}
+		event.Event = &chatpb.ServerEvent_Typing{Typing: &chatpb.TypingEvent{
+			UserId:   typing.UserID,
+			Username: typing.Username,
+			IsTyping: typing.IsTyping,
+		}}
+
+	case "system":
+		system, ok := msg.Data.(SystemEvent)
+		if !ok {
+			return nil
+		}
+		event.Event = &chatpb.ServerEvent_System{System: &chatpb.SystemMessage{Message: system.Message}}
+
+	case "error", "rate_limit":
+		event.Event = &chatpb.ServerEvent_Error{Error: &chatpb.Error{
+			Message:     msg.Error,
+			RateLimited: msg.Type == "rate_limit",
+			Code:        msg.Code,
+			Fields:      toFieldErrors(msg.Fields),
+			Details:     toErrorDetails(msg.Details),
+		}}
+
+	case "pong":
+		pong, ok := msg.Data.(PongEvent)
+		if !ok {
+			return nil
+		}
+		event.Event = &chatpb.ServerEvent_Pong{Pong: &chatpb.Pong{
+			ClientTimeMs: pong.ClientTime,
+			ServerTimeMs: pong.ServerTime,
+		}}
+
+	case "reserved":
+		reserved, ok := msg.Data.(ReservedEvent)
+		if !ok {
+			return nil
+		}
+		event.Event = &chatpb.ServerEvent_Reserved{Reserved: &chatpb.Reserved{
+			Id:        reserved.ID,
+			ExpiresAt: timestamppb.New(reserved.ExpiresAt),
+		}}
+
+	case "timeout":
+		timeout, ok := msg.Data.(TimeoutEvent)
+		if !ok {
+			return nil
+		}
+		event.Event = &chatpb.ServerEvent_Timeout{Timeout: &chatpb.Timeout{DurationSeconds: timeout.Duration}}
+
+	case "timeout_ended":
+		event.Event = &chatpb.ServerEvent_Timeout{Timeout: &chatpb.Timeout{}}
+
+	case "room_stats":
+		stats, ok := msg.Data.(RoomStatsEvent)
+		if !ok {
+			return nil
+		}
+		event.Event = &chatpb.ServerEvent_RoomStats{RoomStats: &chatpb.RoomStats{
+			StreamKey:         stats.StreamKey,
+			Users:             int32(stats.Users),
+			Viewers:           int32(stats.Viewers),
+			Messages:          stats.Messages,
+			MessagesPerMinute: stats.MessagesPerMinute,
+			RateLimitHits:     stats.RateLimitHits,
+			IntervalSeconds:   int32(stats.IntervalSeconds),
+		}}
+
+	default:
+		return nil
+	}
+
+	return event
+}
+
+// toFieldErrors converts validation failures to their protobuf form
+func toFieldErrors(fields []FieldError) []*chatpb.FieldError {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	out := make([]*chatpb.FieldError, 0, len(fields))
+	for _, field := range fields {
+		out = append(out, &chatpb.FieldError{Field: field.Field, Message: field.Message})
+	}
+	return out
+}
+
+// toErrorDetails converts error details to their protobuf form
+func toErrorDetails(details *ErrorDetails) *chatpb.ErrorDetails {
+	if details == nil {
+		return nil
+	}
+	return &chatpb.ErrorDetails{
+		RetryAfterSeconds: int32(details.RetryAfterSeconds),
+		Limit:             int32(details.Limit),
+		Window:            int32(details.Window),
+		Tier:              details.Tier,
+	}
+}
+
+// toChatMessage converts a stored message to its protobuf form
+func toChatMessage(msg ChatMessage) *chatpb.ChatMessage {
+	out := &chatpb.ChatMessage{
+		Id:        msg.ID,
+		StreamKey: msg.StreamKey,
+		UserId:    msg.UserID,
+		Username:  msg.Username,
+		Message:   msg.Message,
+		Timestamp: timestamppb.New(msg.Timestamp),
+		Seq:       msg.Seq,
+	}
+	if msg.Origin != nil {
+		out.Origin = &chatpb.MessageOrigin{System: msg.Origin.System, Id: msg.Origin.ID}
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+package chat
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/chat/chatpb"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestGRPCBridgesMessages(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	grpcServer := NewGRPCServer(h)
+	go grpcServer.Serve(listener) //nolint
+	defer grpcServer.Stop()
+
+	client, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := chatpb.NewChatClient(client).Connect(ctx)
+	require.NoError(t, err)
+	require.NoError(t, stream.Send(&chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Join{
+		Join: &chatpb.Join{StreamKey: "room", UserId: "bot", Username: "bot"},
+	}}))
+
+	recvUntil := func(match func(*chatpb.ServerEvent) bool) *chatpb.ServerEvent {
+		for {
+			event, err := stream.Recv()
+			require.NoError(t, err)
+			if match(event) {
+				return event
+			}
+		}
+	}
+	recvUntil(func(e *chatpb.ServerEvent) bool { return e.GetUsers() != nil })
+
+	// A WebSocket viewer sees the bot's messages and the bot sees theirs
+	viewer := dialTestClient(t, server, "room")
+	joinTestClient(t, viewer, "viewer")
+	joined := recvUntil(func(e *chatpb.ServerEvent) bool {
+		return e.GetUserJoined() != nil && e.GetUserJoined().UserId == "viewer"
+	})
+	require.Equal(t, "viewer", joined.GetUserJoined().Username)
+
+	require.NoError(t, stream.Send(&chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Message{
+		Message: &chatpb.SendMessage{Message: "beep"},
+	}}))
+	msg := readUntil(t, viewer, "message")
+	require.Equal(t, "beep", msg["data"].(map[string]interface{})["message"])
+
+	require.NoError(t, viewer.WriteJSON(map[string]interface{}{
+		"type": "message",
+		"data": map[string]interface{}{"message": "boop"},
+	}))
+	event := recvUntil(func(e *chatpb.ServerEvent) bool {
+		return e.GetMessage() != nil && e.GetMessage().UserId == "viewer"
+	})
+	require.Equal(t, "boop", event.GetMessage().Message)
+}
+
+func TestGRPCRoomStatsNeedToken(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.tokens = NewTokenStore([]APIToken{{Name: "dashboard", Token: "secret", Scopes: []Scope{ScopeReadStats}}})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := NewGRPCServer(h)
+	go grpcServer.Serve(listener) //nolint
+	defer grpcServer.Stop()
+
+	client, err := grpc.NewClient(listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer client.Close()
+
+	subscribe := func(ctx context.Context) *chatpb.ServerEvent {
+		stream, err := chatpb.NewChatClient(client).Connect(ctx)
+		require.NoError(t, err)
+		require.NoError(t, stream.Send(&chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Join{
+			Join: &chatpb.Join{StreamKey: "room", UserId: "bot", Username: "bot"},
+		}}))
+		require.NoError(t, stream.Send(&chatpb.ClientFrame{Frame: &chatpb.ClientFrame_Stats{
+			Stats: &chatpb.Stats{Subscribe: true, IntervalSeconds: 1},
+		}}))
+		for {
+			event, err := stream.Recv()
+			require.NoError(t, err)
+			if event.GetRoomStats() != nil || event.GetError() != nil {
+				return event
+			}
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	refused := subscribe(ctx)
+	require.Equal(t, CodeForbidden, refused.GetError().GetCode())
+
+	stats := subscribe(metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer secret"))
+	require.Equal(t, "room", stats.GetRoomStats().GetStreamKey())
+	require.Equal(t, int32(1), stats.GetRoomStats().GetIntervalSeconds())
+}
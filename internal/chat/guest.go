@@ -0,0 +1,99 @@
+package chat
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"time"
+)
+
+// Guest access, for viewers who join without an account
+const (
+	GuestAccessOff  = "off"  // every join names a user
+	GuestAccessRead = "read" // guests watch but can't chat
+	GuestAccessChat = "chat" // guests chat under a generated name
+
+	guestIDPrefix = "guest:"
+)
+
+// GuestEvent is the payload of the "guest" frame answering a guest join
+type GuestEvent struct {
+	Username string `json:"username"` // the generated name the guest chats under
+	CanChat  bool   `json:"canChat"`
+}
+
+// generateGuestName returns a display name such as "Guest48213"
+func generateGuestName() string {
+	return fmt.Sprintf("Guest%05d", rand.IntN(100000))
+}
+
+// joinGuest lets a client follow its room without joining as a user. It isn't in
+// the room's user list until it chats, if guests may.
+func (c *Connection) joinGuest(frame *JoinFrame) {
+	access := c.manager.manager.config.GuestAccess
+	if access != GuestAccessRead && access != GuestAccessChat {
+		c.sendChatError(ErrGuestsDisabled)
+		return
+	}
+	if c.guest || c.UserID != "" {
+		c.sendChatError(ErrAlreadyJoined)
+		return
+	}
+
+	c.guest = true
+	c.guestName = generateGuestName()
+	c.lazyHistory = frame.LazyHistory
+
+	c.manager.register(c.StreamKey, c)
+	c.manager.viewerCounts.addGuest(c.StreamKey, 1)
+
+	c.send(WSMessage{
+		Type:      "guest",
+		Data:      GuestEvent{Username: c.guestName, CanChat: access == GuestAccessChat},
+		Timestamp: time.Now(),
+	})
+	c.enterRoom(c.StreamKey, false)
+}
+
+// joinAsGuest joins a guest to its room's users under its generated name, the
+// first time it chats
+func (c *Connection) joinAsGuest() error {
+	if c.manager.manager.config.GuestAccess != GuestAccessChat {
+		return ErrGuestReadOnly
+	}
+
+	// Guests are known by their address, so their rate limits and timeouts outlast
+	// a reconnect. Guests behind one address chat as one user, under its name.
+	userID := guestIDPrefix + ipLimitKey(c.RemoteAddr)
+	if room, exists := c.manager.manager.GetRoom(c.StreamKey); exists {
+		if user, joined := room.GetUser(userID); joined {
+			c.guestName = user.Username
+		}
+	}
+	name, first, err := c.manager.manager.joinUser(c.StreamKey, userID, c.guestName, c.rolesIn(c.StreamKey))
+	if err != nil {
+		return err
+	}
+	if name != c.guestName {
+		c.guestName = name
+		c.send(WSMessage{Type: "username_assigned", Data: UserEvent{UserID: userID, Username: name}, Timestamp: time.Now()})
+	}
+	c.manager.viewerCounts.addGuest(c.StreamKey, -1)
+
+	// The room's hub files connections by user; registering again moves it under the new one
+	c.UserID = userID
+	c.Username = c.guestName
+	c.joinedAs.Store(userID)
+	c.manager.register(c.StreamKey, c)
+
+	if first {
+		c.announceJoin(c.StreamKey)
+	}
+	return nil
+}
+
+// leaveGuest takes a guest that never chatted out of its room
+func (c *Connection) leaveGuest() {
+	c.manager.unregister(c.StreamKey, c)
+	c.manager.viewerCounts.addGuest(c.StreamKey, -1)
+	c.manager.touchViewerCount(c.StreamKey)
+}
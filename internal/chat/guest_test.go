@@ -0,0 +1,115 @@
+package chat
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// joinTestGuest joins a client as a guest, returning its "guest" frame's data
+func joinTestGuest(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "join", "data": map[string]interface{}{"guest": true}}))
+	return readUntil(t, conn, "guest")["data"].(map[string]interface{})
+}
+
+func sendTestMessage(t *testing.T, conn *websocket.Conn, text string) {
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "message", "data": map[string]interface{}{"message": text}}))
+}
+
+func TestReadOnlyGuest(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.SetAuthenticator(AuthenticatorFunc(func(context.Context, Credentials) (*Identity, error) {
+		return nil, errors.New("no accounts here")
+	}))
+
+	guest := dialTestClient(t, server, "room")
+	event := joinTestGuest(t, guest)
+	require.Regexp(t, `^Guest\d{5}$`, event["username"])
+	require.Equal(t, false, event["canChat"])
+	readUntil(t, guest, "users")
+
+	// Guests are counted as viewers but aren't in the user list
+	require.Empty(t, h.manager.GetUsers("room"))
+	require.Equal(t, 1, h.ViewerCount("room"))
+
+	h.SetAuthenticator(nil)
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+	sendTestMessage(t, alice, "hello lurkers")
+	require.Equal(t, "hello lurkers", readUntil(t, guest, "message")["data"].(map[string]interface{})["message"])
+
+	sendTestMessage(t, guest, "let me in")
+	require.Equal(t, CodeGuestReadOnly, readUntil(t, guest, "error")["code"])
+
+	guest.Close()
+	require.Eventually(t, func() bool { return h.ViewerCount("room") == 1 }, time.Second, 10*time.Millisecond)
+}
+
+func TestChattingGuest(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.manager.config.GuestAccess = GuestAccessChat
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+	readUntil(t, alice, "user_joined")
+
+	guest := dialTestClient(t, server, "room")
+	name := joinTestGuest(t, guest)["username"]
+	readUntil(t, guest, "users")
+
+	// Chatting joins the guest under its generated name
+	sendTestMessage(t, guest, "hi")
+	joined := readUntil(t, alice, "user_joined")["data"].(map[string]interface{})
+	require.Equal(t, name, joined["username"])
+	require.Regexp(t, `^guest:`, joined["userId"])
+	message := readUntil(t, alice, "message")["data"].(map[string]interface{})
+	require.Equal(t, name, message["username"])
+	require.Equal(t, 2, h.ViewerCount("room"))
+
+	// A guest can't join again as somebody else
+	require.NoError(t, guest.WriteJSON(map[string]interface{}{"type": "join", "data": map[string]interface{}{"userId": "bob", "username": "bob"}}))
+	require.Equal(t, CodeAlreadyJoined, readUntil(t, guest, "error")["code"])
+}
+
+func TestGuestsKnownByAddress(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.manager.config.GuestAccess = GuestAccessChat
+
+	first := dialTestClient(t, server, "room")
+	name := joinTestGuest(t, first)["username"]
+	readUntil(t, first, "users")
+	sendTestMessage(t, first, "hi")
+	readUntil(t, first, "message")
+
+	// A second guest from the same address chats as the same user
+	second := dialTestClient(t, server, "room")
+	joinTestGuest(t, second)
+	readUntil(t, second, "users")
+	sendTestMessage(t, second, "hello")
+	message := readUntil(t, second, "message")["data"].(map[string]interface{})
+	require.Equal(t, name, message["username"])
+	require.Equal(t, "guest:127.0.0.1", message["userId"])
+	require.Len(t, h.manager.GetUsers("room"), 1)
+
+	// so a timeout sticks to the address rather than the connection
+	room, _ := h.manager.GetRoom("room")
+	room.TimeoutUser("guest:127.0.0.1", time.Minute)
+	third := dialTestClient(t, server, "room")
+	joinTestGuest(t, third)
+	readUntil(t, third, "users")
+	sendTestMessage(t, third, "again")
+	require.Equal(t, CodeTimeout, readUntil(t, third, "error")["code"])
+}
+
+func TestGuestsDisabled(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.manager.config.GuestAccess = GuestAccessOff
+
+	refused := dialTestClient(t, server, "room")
+	require.NoError(t, refused.WriteJSON(map[string]interface{}{"type": "join", "data": map[string]interface{}{"guest": true}}))
+	require.Equal(t, CodeGuestsDisabled, readUntil(t, refused, "error")["code"])
+}
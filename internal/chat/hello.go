@@ -0,0 +1,87 @@
+package chat
+
+import (
+	"fmt"
+	"time"
+)
+
+// Chat protocol versions. Bump ProtocolVersion for changes old clients can't
+// handle, and raise MinProtocolVersion once support for an old version is dropped.
+//
+// Version 2 clients accept message_batch frames.
+const (
+	ProtocolVersion    = 2
+	MinProtocolVersion = 1
+)
+
+// Features returns the optional chat features advertised to clients in the hello frame
+func (c *ChatConfig) Features() map[string]bool {
+	return map[string]bool{
+		"typing":        c.EnableTypingStatus,
+		"viewerList":    c.EnableViewerList,
+		"mentions":      c.EnableMentions,
+		"emojis":        c.EnableEmojis,
+		"reactions":     false,
+		"emotes":        false,
+		"batching":      c.BatchWindowMs > 0 || c.WriteWorkers > 0,
+		"reserve":       true,
+		"multiRoom":     true,
+		"historyPaging": true,
+		"digests":       c.BackpressurePercent > 0,
+	}
+}
+
+// helloFrame is the first frame of every session, advertising what the server speaks
+func (h *WSHandler) helloFrame() WSMessage {
+	return WSMessage{
+		Type: "hello",
+		Data: HelloEvent{
+			ProtocolVersion:    ProtocolVersion,
+			MinProtocolVersion: MinProtocolVersion,
+			Features:           h.manager.config.Features(),
+		},
+		Timestamp: time.Now(),
+	}
+}
+
+// handleHello records the protocol version the client speaks. Clients that never
+// send a hello are treated as version 1.
+func (c *Connection) handleHello(frame *HelloFrame) {
+	version := frame.ProtocolVersion
+	if version < MinProtocolVersion {
+		c.sendChatError(&ChatError{
+			Code:    ErrProtocolUnsupported.Code,
+			Message: fmt.Sprintf("%s: version %d is older than %d", ErrProtocolUnsupported.Message, version, MinProtocolVersion),
+		})
+		return
+	}
+
+	c.protocolVersion.Store(int32(min(version, ProtocolVersion)))
+}
+
+// intValue reads a whole number decoded by any of the codecs
+func intValue(v interface{}) (int, bool) {
+	switch n := v.(type) {
+	case float64:
+		return int(n), n == float64(int(n))
+	case int:
+		return n, true
+	case int8:
+		return int(n), true
+	case int16:
+		return int(n), true
+	case int32:
+		return int(n), true
+	case int64:
+		return int(n), true
+	case uint8:
+		return int(n), true
+	case uint16:
+		return int(n), true
+	case uint32:
+		return int(n), true
+	case uint64:
+		return int(n), true
+	}
+	return 0, false
+}
@@ -0,0 +1,108 @@
+package chat
+
+import (
+	"log"
+	"slices"
+	"time"
+)
+
+// HistoryStore keeps rooms' recent messages where every chat instance can read
+// them, so a client joining on any instance sees the same history. Rooms still
+// buffer their own messages for resume and paging, which stay per instance.
+type HistoryStore interface {
+	// Append adds a message to the end of its room's history
+	Append(msg ChatMessage) error
+	// Recent returns up to limit of a room's latest messages, oldest first
+	Recent(streamKey string, limit int) ([]ChatMessage, error)
+	// Clear drops a room's history
+	Clear(streamKey string) error
+	// Close releases the store's resources
+	Close() error
+}
+
+// SetHistoryStore shares history through store. Messages posted from then on are
+// appended to it, and GetMessages reads from it, falling back to the room's own
+// buffer when the store fails.
+func (m *Manager) SetHistoryStore(store HistoryStore) {
+	m.hooksMux.Lock()
+	defer m.hooksMux.Unlock()
+
+	m.historyStore = store
+	m.storage.reset(storageHistory)
+}
+
+// sharedHistory returns the installed history store, or nil when there is none or
+// health checks found it down
+func (m *Manager) sharedHistory() HistoryStore {
+	m.hooksMux.RLock()
+	defer m.hooksMux.RUnlock()
+
+	if m.storage.down(storageHistory) {
+		return nil
+	}
+	return m.historyStore
+}
+
+// appendSharedHistory copies a stored message to the shared history, if any. A
+// shared history that is also the message store already has it from the room.
+func (m *Manager) appendSharedHistory(msg ChatMessage) {
+	store := m.sharedHistory()
+	if store == nil {
+		return
+	}
+	if persisted, ok := store.(MessageStore); ok && persisted == m.persistence() {
+		return
+	}
+
+	if err := store.Append(msg); err != nil {
+		log.Printf("Failed to share chat message for %s: %v", msg.StreamKey, err)
+	}
+}
+
+// sharedMessages reads a room's recent messages from the shared history. ok is
+// false without a store or when it fails, and the caller should use the room's
+// buffer instead. Messages older than the retention are left out, as the room's
+// cleanup would have removed them.
+func (m *Manager) sharedMessages(streamKey string, recentN int) (messages []ChatMessage, ok bool) {
+	store := m.sharedHistory()
+	if store == nil {
+		return nil, false
+	}
+
+	limit := m.config.MaxMessagesPerStream
+	if recentN > 0 && recentN < limit {
+		limit = recentN
+	}
+
+	messages, err := store.Recent(streamKey, limit)
+	if err != nil {
+		log.Printf("Falling back to local chat history for %s: %v", streamKey, err)
+		return nil, false
+	}
+
+	cutoff := time.Now().Add(-time.Duration(m.config.MessageRetentionMinutes) * time.Minute)
+	kept := messages[:0]
+	for _, msg := range messages {
+		if msg.Timestamp.After(cutoff) {
+			kept = append(kept, msg)
+		}
+	}
+	return kept, true
+}
+
+// sharedMessagesBefore pages back from a cursor the room no longer has through the
+// shared history, so clients can keep paging through what other instances saw.
+// found is false when the shared history doesn't have it either.
+func (m *Manager) sharedMessagesBefore(streamKey, beforeID string, limit int) (messages []ChatMessage, hasMore bool, found bool) {
+	shared, ok := m.sharedMessages(streamKey, 0)
+	if !ok {
+		return nil, false, false
+	}
+
+	end := slices.IndexFunc(shared, func(msg ChatMessage) bool { return msg.ID == beforeID })
+	if end == -1 {
+		return nil, false, false
+	}
+	start := max(end-limit, 0)
+	return shared[start:end], start > 0, true
+}
@@ -0,0 +1,267 @@
+package chat
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportPageSize is how many stored messages a history export reads at a time
+const exportPageSize = 500
+
+// Formats the history export endpoint can write
+const (
+	HistoryFormatJSON = "json"
+	HistoryFormatCSV  = "csv"
+)
+
+// historyCSVHeader names the columns of a CSV history export
+var historyCSVHeader = []string{"seq", "id", "timestamp", "userId", "username", "message", "originSystem", "originId", "deletedAt", "editedAt"}
+
+// HistoryMessage is a message in a history export. One moderators deleted keeps
+// its place without its text, and one they edited has its latest text, so the
+// export shows where history was moderated.
+type HistoryMessage struct {
+	ChatMessage
+	DeletedAt *time.Time `json:"deletedAt,omitempty"`
+	EditedAt  *time.Time `json:"editedAt,omitempty"`
+}
+
+// RetainedMessages returns a room's full retained history, oldest first: every
+// message still in its message store, or the buffered ones without one
+func (m *Manager) RetainedMessages(streamKey string) []HistoryMessage {
+	history := []HistoryMessage{}
+	m.EachRetainedPage(streamKey, func(page []HistoryMessage) error {
+		history = append(history, page...)
+		return nil
+	})
+	return history
+}
+
+// EachRetainedPage calls fn with a room's full retained history a page at a time,
+// oldest first, so a long history never has to be held at once. It reads every
+// message still in the message store, or the buffered ones without one, and stops
+// at the first error fn or the store returns.
+func (m *Manager) EachRetainedPage(streamKey string, fn func(page []HistoryMessage) error) error {
+	if store := m.persistence(); store != nil {
+		fates, err := roomTombstones(store, streamKey)
+		var messages []ChatMessage
+		if err == nil {
+			messages, err = store.Range(streamKey, 0, exportPageSize)
+		}
+		if err == nil {
+			for len(messages) > 0 {
+				if err := fn(historyMessages(messages, fates)); err != nil {
+					return err
+				}
+				if messages, err = store.Range(streamKey, messages[len(messages)-1].Seq, exportPageSize); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		log.Printf("Failed to read persisted chat messages for %s, exporting the buffer: %v", streamKey, err)
+	}
+
+	room, exists := m.GetRoom(streamKey)
+	if !exists {
+		return nil
+	}
+	return fn(historyMessages(room.GetMessages(0), nil))
+}
+
+// historyMessages marks the messages tombstones say were deleted or edited
+func historyMessages(messages []ChatMessage, fates map[string]messageFate) []HistoryMessage {
+	history := make([]HistoryMessage, 0, len(messages))
+	for _, msg := range messages {
+		entry := HistoryMessage{ChatMessage: msg}
+		fate := fates[msg.ID]
+		if fate.edited != nil {
+			entry.Message = fate.edited.Message
+			entry.EditedAt = &fate.edited.Timestamp
+		}
+		if fate.deleted != nil {
+			entry.Message = ""
+			entry.DeletedAt = &fate.deleted.Timestamp
+		}
+		history = append(history, entry)
+	}
+	return history
+}
+
+// ExportHandler serves GET /api/chat/{streamKey}/export?format=json|csv, streaming
+// a room's full retained history as a download
+func (h *WSHandler) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey", http.StatusBadRequest)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = HistoryFormatJSON
+	}
+	if format != HistoryFormatJSON && format != HistoryFormatCSV {
+		http.Error(w, "Invalid format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.checkHistoryRead(r, streamKey); err != nil {
+		writeChatError(w, http.StatusTooManyRequests, err)
+		return
+	}
+
+	filename := "chat-" + exportFilename(streamKey) + "." + format
+	w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+
+	var writer historyWriter
+	if format == HistoryFormatCSV {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		writer = &csvHistoryWriter{csv: csv.NewWriter(w)}
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		writer = &jsonHistoryWriter{w: w}
+	}
+
+	// Each page goes out as soon as it is read
+	flusher, _ := w.(http.Flusher)
+	err := writer.begin()
+	if err == nil {
+		err = h.manager.EachRetainedPage(streamKey, func(page []HistoryMessage) error {
+			if err := writer.write(page); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		err = writer.end()
+	}
+	if err != nil {
+		log.Printf("Failed to write chat export for %s: %v", streamKey, err)
+	}
+}
+
+// historyWriter writes a history export in one of the formats a page at a time
+type historyWriter interface {
+	begin() error
+	write(page []HistoryMessage) error
+	end() error
+}
+
+// jsonHistoryWriter writes a history export as a JSON array, one message at a time
+type jsonHistoryWriter struct {
+	w       io.Writer
+	written bool
+}
+
+func (j *jsonHistoryWriter) begin() error {
+	_, err := j.w.Write([]byte("["))
+	return err
+}
+
+func (j *jsonHistoryWriter) write(page []HistoryMessage) error {
+	for _, msg := range page {
+		if j.written {
+			if _, err := j.w.Write([]byte(",")); err != nil {
+				return err
+			}
+		}
+		data, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if _, err := j.w.Write(data); err != nil {
+			return err
+		}
+		j.written = true
+	}
+	return nil
+}
+
+func (j *jsonHistoryWriter) end() error {
+	_, err := j.w.Write([]byte("]\n"))
+	return err
+}
+
+// csvHistoryWriter writes a history export as CSV rows under historyCSVHeader
+type csvHistoryWriter struct {
+	csv *csv.Writer
+}
+
+func (c *csvHistoryWriter) begin() error {
+	return c.csv.Write(historyCSVHeader)
+}
+
+func (c *csvHistoryWriter) write(page []HistoryMessage) error {
+	for _, msg := range page {
+		var originSystem, originID string
+		if msg.Origin != nil {
+			originSystem, originID = msg.Origin.System, msg.Origin.ID
+		}
+		row := []string{
+			strconv.FormatInt(msg.Seq, 10),
+			csvText(msg.ID),
+			msg.Timestamp.UTC().Format(time.RFC3339Nano),
+			csvText(msg.UserID),
+			csvText(msg.Username),
+			csvText(msg.Message),
+			csvText(originSystem),
+			csvText(originID),
+			formatExportTime(msg.DeletedAt),
+			formatExportTime(msg.EditedAt),
+		}
+		if err := c.csv.Write(row); err != nil {
+			return err
+		}
+	}
+	c.csv.Flush()
+	return c.csv.Error()
+}
+
+func (c *csvHistoryWriter) end() error {
+	c.csv.Flush()
+	return c.csv.Error()
+}
+
+// csvText keeps text users chose from being read as a formula by spreadsheets,
+// which run cells starting with =, +, -, @, a tab or a carriage return, by
+// prefixing such values with a quote
+func csvText(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// formatExportTime writes an optional time for a CSV export, empty when unset
+func formatExportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// exportFilename makes a stream key safe to use in a download's filename
+func exportFilename(streamKey string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_' {
+			return r
+		}
+		return '_'
+	}, streamKey)
+}
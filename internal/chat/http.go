@@ -0,0 +1,155 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+
+	maxSystemMessageLength = 2000
+	maxSystemBodySize      = 16 * 1024
+)
+
+// messagesPage is the response body for the history endpoint
+type messagesPage struct {
+	Messages   []ChatMessage `json:"messages"`
+	HasMore    bool          `json:"hasMore"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// MessagesHandler serves GET /api/chat/{streamKey}/messages?before=<id>&limit=N,
+// paging backwards through a room's history
+func (h *WSHandler) MessagesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey", http.StatusBadRequest)
+		return
+	}
+
+	limit := defaultPageSize
+	if val := r.URL.Query().Get("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxPageSize)
+	}
+
+	if err := h.checkHistoryRead(r, streamKey); err != nil {
+		writeChatError(w, http.StatusTooManyRequests, err)
+		return
+	}
+
+	messages, hasMore, err := h.manager.GetMessagesBefore(streamKey, r.URL.Query().Get("before"), limit)
+	if err != nil {
+		var chatErr *ChatError
+		if !errors.As(err, &chatErr) {
+			log.Printf("Failed to read chat history for %s: %v", streamKey, err)
+			http.Error(w, "Failed to read history", http.StatusInternalServerError)
+			return
+		}
+		writeChatError(w, http.StatusNotFound, chatErr)
+		return
+	}
+
+	page := messagesPage{
+		Messages: messages,
+		HasMore:  hasMore,
+	}
+	if hasMore && len(messages) > 0 {
+		page.NextCursor = messages[0].ID
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// SystemMessageHandler serves POST /api/chat/{streamKey}/system, letting the host
+// application or external tools announce a system message in a room
+func (h *WSHandler) SystemMessageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSystemBodySize)).Decode(&body); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if body.Message == "" || len(body.Message) > maxSystemMessageLength {
+		http.Error(w, "Invalid message content", http.StatusBadRequest)
+		return
+	}
+
+	h.BroadcastSystemMessage(streamKey, body.Message)
+
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{
+		"streamKey": streamKey,
+		"message":   body.Message,
+	})
+}
+
+// checkHistoryRead applies scraper throttling to an HTTP history read, returning
+// ErrHistoryThrottled with the remaining cooldown if it is refused. Integrations
+// holding a history token are exempt.
+func (h *WSHandler) checkHistoryRead(r *http.Request, streamKey string) *ChatError {
+	if token := h.tokens.Lookup(r); token != nil && token.HasScope(ScopeReadHistory) {
+		return nil
+	}
+
+	identity := "ip:" + h.clientIP(r)
+	if h.readTracker.AllowRead(streamKey, identity) {
+		return nil
+	}
+	return h.readTracker.throttledError(identity)
+}
+
+// RequireScope wraps a handler so it only runs for requests authorized for the scope
+func (h *WSHandler) RequireScope(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return h.tokens.RequireScope(scope, next)
+}
+
+// writeJSON writes a JSON response with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write chat response: %v", err)
+	}
+}
+
+// writeChatError writes a ChatError as a JSON response
+func writeChatError(w http.ResponseWriter, status int, chatErr *ChatError) {
+	body := map[string]interface{}{
+		"code":  chatErr.Code,
+		"error": chatErr.Message,
+	}
+	if chatErr.Details != nil {
+		body["details"] = chatErr.Details
+		if chatErr.Details.RetryAfterSeconds > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(chatErr.Details.RetryAfterSeconds))
+		}
+	}
+	writeJSON(w, status, body)
+}
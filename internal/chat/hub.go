@@ -0,0 +1,212 @@
+package chat
+
+const hubBroadcastBuffer = 256
+
+// roomHub owns the connections receiving one room's frames. Its goroutine is the
+// only one touching the member map: joins, leaves, broadcasts and lookups reach it
+// over channels, so senders in different rooms never contend for a lock. A hub
+// exists while its room has connections and retires when the last one leaves.
+type roomHub struct {
+	streamKey  string
+	register   chan *Connection
+	unregister chan *Connection
+	broadcast  chan hubBroadcast
+	query      chan chan []*Connection
+	done       chan struct{} // closed when the hub retires
+}
+
+// hubBroadcast is a frame for every member of a room but one user
+type hubBroadcast struct {
+	msg          WSMessage
+	exceptUserID string
+	report       func(queued, dropped int) // called on the hub goroutine once fanned out, if set
+}
+
+// run serves the hub's channels until its last member leaves
+func (hub *roomHub) run(h *WSHandler) {
+	defer trackWorker("ws.hub")()
+
+	members := make(map[string]map[*Connection]struct{}) // userID -> connections
+	userOf := make(map[*Connection]string)               // userID each connection registered under; a guest's changes once it chats
+	count := 0
+
+	for {
+		select {
+		case c := <-hub.register:
+			userID, _ := c.joinedAs.Load().(string)
+
+			// A connection registered under another user is moved rather than filed twice
+			if previous, registered := userOf[c]; registered && previous != userID {
+				delete(members[previous], c)
+				if len(members[previous]) == 0 {
+					delete(members, previous)
+				}
+				delete(userOf, c)
+				count--
+			}
+
+			// Every connection of a user, such as one per browser tab, gets the room's frames
+			conns := members[userID]
+			if conns == nil {
+				conns = make(map[*Connection]struct{})
+				members[userID] = conns
+			}
+			if _, exists := conns[c]; !exists {
+				conns[c] = struct{}{}
+				userOf[c] = userID
+				count++
+			}
+
+		case c := <-hub.unregister:
+			userID, registered := userOf[c]
+			if conns := members[userID]; registered && conns != nil {
+				delete(conns, c)
+				delete(userOf, c)
+				count--
+				if len(conns) == 0 {
+					delete(members, userID)
+				}
+			}
+			if len(members) == 0 {
+				h.retireHub(hub)
+				return
+			}
+
+		case b := <-hub.broadcast:
+			queued, dropped := 0, 0
+			for userID, conns := range members {
+				if b.exceptUserID != "" && userID == b.exceptUserID {
+					continue
+				}
+				for conn := range conns {
+					if conn.deliver(b.msg) {
+						queued++
+					} else {
+						dropped++
+					}
+				}
+			}
+			if b.report != nil {
+				b.report(queued, dropped)
+			}
+
+		case reply := <-hub.query:
+			all := make([]*Connection, 0, count)
+			for _, conns := range members {
+				for conn := range conns {
+					all = append(all, conn)
+				}
+			}
+			reply <- all
+		}
+	}
+}
+
+// members returns the hub's connections, or none if it has retired
+func (hub *roomHub) members() []*Connection {
+	reply := make(chan []*Connection, 1)
+	select {
+	case hub.query <- reply:
+		return <-reply
+	case <-hub.done:
+		return nil
+	}
+}
+
+// hub returns a room's hub, starting one if create is set and it has none
+func (h *WSHandler) hub(streamKey string, create bool) *roomHub {
+	h.hubMux.RLock()
+	hub := h.hubs[streamKey]
+	h.hubMux.RUnlock()
+	if hub != nil || !create {
+		return hub
+	}
+
+	h.hubMux.Lock()
+	defer h.hubMux.Unlock()
+
+	if hub = h.hubs[streamKey]; hub == nil {
+		hub = &roomHub{
+			streamKey:  streamKey,
+			register:   make(chan *Connection),
+			unregister: make(chan *Connection),
+			broadcast:  make(chan hubBroadcast, hubBroadcastBuffer),
+			query:      make(chan chan []*Connection),
+			done:       make(chan struct{}),
+		}
+		h.hubs[streamKey] = hub
+		go hub.run(h)
+	}
+	return hub
+}
+
+// retireHub removes an empty hub so it can exit. Anyone who looked the hub up
+// before then sees its done channel closed and starts a fresh hub if they need one.
+func (h *WSHandler) retireHub(hub *roomHub) {
+	h.hubMux.Lock()
+	defer h.hubMux.Unlock()
+
+	delete(h.hubs, hub.streamKey)
+	close(hub.done)
+}
+
+// allHubs returns every running hub
+func (h *WSHandler) allHubs() []*roomHub {
+	h.hubMux.RLock()
+	defer h.hubMux.RUnlock()
+
+	hubs := make([]*roomHub, 0, len(h.hubs))
+	for _, hub := range h.hubs {
+		hubs = append(hubs, hub)
+	}
+	return hubs
+}
+
+// register adds a joined connection to a room it receives. It returns once the
+// hub has it, so frames broadcast afterwards reach the connection.
+func (h *WSHandler) register(streamKey string, c *Connection) {
+	for {
+		hub := h.hub(streamKey, true)
+		select {
+		case hub.register <- c:
+			return
+		case <-hub.done:
+			// Retired while we were looking; the next lookup starts a new hub
+		}
+	}
+}
+
+// unregister removes a connection from a room, leaving the user's other
+// connections in it. It returns once the connection gets no more of the room's
+// broadcasts.
+func (h *WSHandler) unregister(streamKey string, c *Connection) {
+	hub := h.hub(streamKey, false)
+	if hub == nil {
+		return
+	}
+	select {
+	case hub.unregister <- c:
+	case <-hub.done:
+	}
+}
+
+// roomConnections returns the connections receiving a room's frames
+func (h *WSHandler) roomConnections(streamKey string) []*Connection {
+	if hub := h.hub(streamKey, false); hub != nil {
+		return hub.members()
+	}
+	return nil
+}
+
+// eachConnection calls fn once for every joined connection, in no particular order.
+// Connections are members of their own room's hub as well as those of rooms added
+// with join_room, so only the former counts.
+func (h *WSHandler) eachConnection(fn func(c *Connection)) {
+	for _, hub := range h.allHubs() {
+		for _, conn := range hub.members() {
+			if conn.StreamKey == hub.streamKey {
+				fn(conn)
+			}
+		}
+	}
+}
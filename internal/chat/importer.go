@@ -0,0 +1,330 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const maxImportBodySize = 512 * 1024 * 1024
+
+// Chat export formats ParseChatExport reads
+const (
+	ImportTwitch  = "twitch"  // JSON written by TwitchDownloader and tools following it
+	ImportYouTube = "youtube" // live_chat.json written by yt-dlp
+)
+
+var (
+	errImportNowhere = errors.New("neither a message store nor chat replay is configured")
+	errImportExists  = errors.New("chat was already recorded for a session starting then")
+	errImportStart   = errors.New("the export doesn't say when the stream started; pass startedAt")
+)
+
+// BatchAppender is implemented by message stores that can write many messages at
+// once, rather than queueing them like Append, for imports larger than the queue
+type BatchAppender interface {
+	AppendBatch(messages []ChatMessage) error
+}
+
+// ImportedSession is one stream session's chat, read from another platform's export
+type ImportedSession struct {
+	Platform  string        // format the chat was read from, recorded as each message's origin
+	StartedAt time.Time     // zero when the export doesn't say
+	Duration  time.Duration // zero when the export doesn't say
+	Messages  []ImportedMessage
+	Skipped   int // entries that weren't chat messages, such as subscriptions or polls
+}
+
+// ImportedMessage is a chat message from another platform's export
+type ImportedMessage struct {
+	ID       string // on the other platform
+	UserID   string // on the other platform
+	Username string
+	Message  string
+	Offset   time.Duration // since the session started
+}
+
+// ImportResult describes a finished import
+type ImportResult struct {
+	StreamKey string `json:"streamKey"`
+	SessionID string `json:"sessionId"` // the replay session the chat was recorded to
+	Imported  int    `json:"imported"`
+	Skipped   int    `json:"skipped"`
+}
+
+// ParseChatExport reads a chat export in one of the Import formats
+func ParseChatExport(format string, r io.Reader) (ImportedSession, error) {
+	switch format {
+	case ImportTwitch:
+		return parseTwitchExport(r)
+	case ImportYouTube:
+		return parseYouTubeExport(r)
+	default:
+		return ImportedSession{}, fmt.Errorf("unknown chat export format %q", format)
+	}
+}
+
+// twitchExport is the part of a TwitchDownloader chat export that is imported
+type twitchExport struct {
+	Video struct {
+		CreatedAt string  `json:"created_at"`
+		Length    float64 `json:"length"` // seconds
+	} `json:"video"`
+	Comments []struct {
+		ID        string  `json:"_id"`
+		Offset    float64 `json:"content_offset_seconds"`
+		Commenter struct {
+			ID          string `json:"_id"`
+			Name        string `json:"name"`
+			DisplayName string `json:"display_name"`
+		} `json:"commenter"`
+		Message struct {
+			Body string `json:"body"`
+		} `json:"message"`
+	} `json:"comments"`
+}
+
+// parseTwitchExport reads a TwitchDownloader chat export
+func parseTwitchExport(r io.Reader) (ImportedSession, error) {
+	var export twitchExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return ImportedSession{}, fmt.Errorf("reading Twitch chat export: %w", err)
+	}
+
+	session := ImportedSession{
+		Platform: ImportTwitch,
+		Duration: time.Duration(export.Video.Length * float64(time.Second)),
+		Messages: make([]ImportedMessage, 0, len(export.Comments)),
+	}
+	if startedAt, err := time.Parse(time.RFC3339, export.Video.CreatedAt); err == nil {
+		session.StartedAt = startedAt
+	}
+
+	for _, comment := range export.Comments {
+		if comment.Message.Body == "" {
+			session.Skipped++
+			continue
+		}
+		username := comment.Commenter.DisplayName
+		if username == "" {
+			username = comment.Commenter.Name
+		}
+		session.Messages = append(session.Messages, ImportedMessage{
+			ID:       comment.ID,
+			UserID:   comment.Commenter.ID,
+			Username: username,
+			Message:  comment.Message.Body,
+			Offset:   time.Duration(comment.Offset * float64(time.Second)),
+		})
+	}
+	return session, nil
+}
+
+// youTubeChatLine is one line of a yt-dlp live_chat.json export
+type youTubeChatLine struct {
+	ReplayChatItemAction struct {
+		Actions []struct {
+			AddChatItemAction struct {
+				Item struct {
+					LiveChatTextMessageRenderer *struct {
+						ID      string `json:"id"`
+						Message struct {
+							Runs []struct {
+								Text  string `json:"text"`
+								Emoji *struct {
+									Shortcuts []string `json:"shortcuts"`
+								} `json:"emoji"`
+							} `json:"runs"`
+						} `json:"message"`
+						AuthorName struct {
+							SimpleText string `json:"simpleText"`
+						} `json:"authorName"`
+						AuthorExternalChannelID string `json:"authorExternalChannelId"`
+						TimestampUsec           string `json:"timestampUsec"`
+					} `json:"liveChatTextMessageRenderer"`
+				} `json:"item"`
+			} `json:"addChatItemAction"`
+		} `json:"actions"`
+		VideoOffsetTimeMsec string `json:"videoOffsetTimeMsec"`
+	} `json:"replayChatItemAction"`
+}
+
+// parseYouTubeExport reads a yt-dlp live_chat.json export. The stream's start is
+// worked out from the first message's send time and offset into the video.
+func parseYouTubeExport(r io.Reader) (ImportedSession, error) {
+	session := ImportedSession{Platform: ImportYouTube, Messages: []ImportedMessage{}}
+
+	decoder := json.NewDecoder(r)
+	for {
+		var line youTubeChatLine
+		err := decoder.Decode(&line)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return ImportedSession{}, fmt.Errorf("reading YouTube chat export: %w", err)
+		}
+
+		offsetMs, err := strconv.ParseInt(line.ReplayChatItemAction.VideoOffsetTimeMsec, 10, 64)
+		if err != nil {
+			session.Skipped++
+			continue
+		}
+		for _, action := range line.ReplayChatItemAction.Actions {
+			item := action.AddChatItemAction.Item.LiveChatTextMessageRenderer
+			if item == nil {
+				session.Skipped++
+				continue
+			}
+
+			var text strings.Builder
+			for _, run := range item.Message.Runs {
+				switch {
+				case run.Text != "":
+					text.WriteString(run.Text)
+				case run.Emoji != nil && len(run.Emoji.Shortcuts) > 0:
+					text.WriteString(run.Emoji.Shortcuts[0])
+				}
+			}
+			if text.Len() == 0 {
+				session.Skipped++
+				continue
+			}
+
+			offset := time.Duration(offsetMs) * time.Millisecond
+			if session.StartedAt.IsZero() {
+				if usec, err := strconv.ParseInt(item.TimestampUsec, 10, 64); err == nil {
+					session.StartedAt = time.UnixMicro(usec).Add(-offset)
+				}
+			}
+			session.Messages = append(session.Messages, ImportedMessage{
+				ID:       item.ID,
+				UserID:   item.AuthorExternalChannelID,
+				Username: item.AuthorName.SimpleText,
+				Message:  text.String(),
+				Offset:   offset,
+			})
+		}
+	}
+	return session, nil
+}
+
+// ImportSession stores another platform's chat of a stream session as the chat of
+// a session of streamKey starting at the same time, in the message store and for
+// replay, so chat replays of VODs survive moving platforms. Users are identified
+// as <platform>:<their ID there>, and each message keeps its ID there as its
+// origin. Imported messages are stored unnumbered, so they never show up as
+// messages a live room's clients missed.
+func (m *Manager) ImportSession(streamKey string, session ImportedSession) (ImportResult, error) {
+	if session.StartedAt.IsZero() {
+		return ImportResult{}, errImportStart
+	}
+	store := m.persistence()
+	if store == nil && !m.replay.Enabled() {
+		return ImportResult{}, errImportNowhere
+	}
+
+	sessionID := replaySessionID(session.StartedAt)
+	if m.replay.Enabled() && m.replay.hasSession(streamKey, sessionID) {
+		return ImportResult{}, errImportExists
+	}
+
+	sort.SliceStable(session.Messages, func(i, j int) bool {
+		return session.Messages[i].Offset < session.Messages[j].Offset
+	})
+	messages := make([]ChatMessage, 0, len(session.Messages))
+	for _, imported := range session.Messages {
+		msg := newChatMessage(streamKey, session.Platform+":"+imported.UserID, imported.Username, imported.Message)
+		msg.Timestamp = session.StartedAt.Add(imported.Offset)
+		msg.Origin = &MessageOrigin{System: session.Platform, ID: imported.ID}
+		messages = append(messages, *msg)
+	}
+
+	if store != nil {
+		if batcher, ok := store.(BatchAppender); ok {
+			if err := batcher.AppendBatch(messages); err != nil {
+				return ImportResult{}, err
+			}
+		} else {
+			for _, msg := range messages {
+				if err := store.Append(msg); err != nil {
+					return ImportResult{}, err
+				}
+			}
+		}
+	}
+
+	if m.replay.Enabled() {
+		m.replay.RecordStart(streamKey, session.StartedAt)
+		for _, msg := range messages {
+			m.replay.Record(msg, session.StartedAt)
+		}
+		if session.Duration > 0 {
+			m.replay.RecordEnd(streamKey, session.StartedAt, session.StartedAt.Add(session.Duration))
+		}
+		if err := m.replay.Flush(); err != nil {
+			return ImportResult{}, err
+		}
+	}
+
+	log.Printf("Imported %d %s chat messages into stream %s, session %s", len(messages), session.Platform, streamKey, sessionID)
+	return ImportResult{StreamKey: streamKey, SessionID: sessionID, Imported: len(messages), Skipped: session.Skipped}, nil
+}
+
+// ImportHandler serves POST /api/chat/admin/rooms/{streamKey}/import?format=F&startedAt=MS,
+// importing the chat export in the body. startedAt, in Unix milliseconds, places
+// the session when the export doesn't say when the stream started, or overrides it.
+func (h *WSHandler) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey", http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	var startedAt time.Time
+	if val := params.Get("startedAt"); val != "" {
+		ms, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || ms <= 0 {
+			http.Error(w, "Invalid startedAt", http.StatusBadRequest)
+			return
+		}
+		startedAt = time.UnixMilli(ms)
+	}
+
+	session, err := ParseChatExport(params.Get("format"), http.MaxBytesReader(w, r.Body, maxImportBodySize))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !startedAt.IsZero() {
+		session.StartedAt = startedAt
+	}
+
+	result, err := h.manager.ImportSession(streamKey, session)
+	switch {
+	case errors.Is(err, errImportStart):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, errImportExists):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errImportNowhere):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case err != nil:
+		log.Printf("Failed to import chat into %s: %v", streamKey, err)
+		http.Error(w, "Failed to import chat", http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, result)
+	}
+}
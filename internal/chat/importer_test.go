@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const twitchExportFixture = `{
+	"streamer": {"name": "streamer", "id": 1},
+	"video": {"created_at": "2024-03-01T18:00:00Z", "length": 3600},
+	"comments": [
+		{"_id": "c2", "content_offset_seconds": 75.5, "commenter": {"_id": "22", "name": "bob", "display_name": "Bob"}, "message": {"body": "second"}},
+		{"_id": "c1", "content_offset_seconds": 12, "commenter": {"_id": "11", "name": "alice", "display_name": "Alice"}, "message": {"body": "first"}},
+		{"_id": "c3", "content_offset_seconds": 80, "commenter": {"_id": "33", "name": "carol"}, "message": {"body": ""}}
+	]
+}`
+
+const youTubeExportFixture = `{"replayChatItemAction": {"actions": [{"addChatItemAction": {"item": {"liveChatTextMessageRenderer": {"id": "y1", "message": {"runs": [{"text": "hello "}, {"emoji": {"shortcuts": [":wave:"]}}]}, "authorName": {"simpleText": "Dana"}, "authorExternalChannelId": "UC1", "timestampUsec": "1709316010000000"}}}}], "videoOffsetTimeMsec": "10000"}}
+{"replayChatItemAction": {"actions": [{"addChatItemAction": {"item": {"liveChatMembershipItemRenderer": {"id": "m1"}}}}], "videoOffsetTimeMsec": "15000"}}
+{"replayChatItemAction": {"actions": [{"addChatItemAction": {"item": {"liveChatTextMessageRenderer": {"id": "y2", "message": {"runs": [{"text": "bye"}]}, "authorName": {"simpleText": "Eve"}, "authorExternalChannelId": "UC2", "timestampUsec": "1709316030000000"}}}}], "videoOffsetTimeMsec": "30000"}}
+`
+
+func TestParseChatExports(t *testing.T) {
+	session, err := ParseChatExport(ImportTwitch, strings.NewReader(twitchExportFixture))
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, 3, 1, 18, 0, 0, 0, time.UTC), session.StartedAt.UTC())
+	require.Equal(t, time.Hour, session.Duration)
+	require.Equal(t, 1, session.Skipped)
+	require.Len(t, session.Messages, 2)
+	require.Equal(t, ImportedMessage{ID: "c2", UserID: "22", Username: "Bob", Message: "second", Offset: 75500 * time.Millisecond}, session.Messages[0])
+
+	session, err = ParseChatExport(ImportYouTube, strings.NewReader(youTubeExportFixture))
+	require.NoError(t, err)
+	require.Equal(t, time.UnixMicro(1709316000000000), session.StartedAt)
+	require.Equal(t, 1, session.Skipped)
+	require.Len(t, session.Messages, 2)
+	require.Equal(t, ImportedMessage{ID: "y1", UserID: "UC1", Username: "Dana", Message: "hello :wave:", Offset: 10 * time.Second}, session.Messages[0])
+
+	_, err = ParseChatExport("kick", strings.NewReader("{}"))
+	require.Error(t, err)
+}
+
+func TestImportHandlerStoresSessionForReplay(t *testing.T) {
+	h := newReplayTestHandler(t)
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "chat.db"), DefaultWriteBatching())
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	h.manager.SetMessageStore(store)
+
+	importChat := func(query, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/?"+query, strings.NewReader(body))
+		r.SetPathValue("streamKey", "room")
+		w := httptest.NewRecorder()
+		h.ImportHandler(w, r)
+		return w
+	}
+
+	w := importChat("format=twitch", twitchExportFixture)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result ImportResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Equal(t, ImportResult{StreamKey: "room", SessionID: "1709316000000", Imported: 2, Skipped: 1}, result)
+
+	// The session replays in order, timed from the VOD's start
+	messages, err := h.manager.replay.Messages("room", result.SessionID, 0)
+	require.NoError(t, err)
+	require.Len(t, messages, 2)
+	require.Equal(t, "first", messages[0].Message)
+	require.Equal(t, int64(12000), messages[0].OffsetMs)
+	require.Equal(t, "twitch:11", messages[0].UserID)
+	require.Equal(t, &MessageOrigin{System: ImportTwitch, ID: "c1"}, messages[0].Origin)
+	summary, err := h.manager.replay.Summary("room", result.SessionID)
+	require.NoError(t, err)
+	require.Equal(t, int64(time.Hour/time.Millisecond), summary.DurationMs)
+
+	// Stored, but never as messages a live room's clients missed
+	stored, err := store.UserMessages("twitch:22")
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	live, err := store.Range("room", 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, live)
+
+	w = importChat("format=twitch", twitchExportFixture)
+	require.Equal(t, http.StatusConflict, w.Code)
+
+	w = importChat("format=youtube&startedAt=1709400000000", youTubeExportFixture)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	require.Equal(t, "1709400000000", result.SessionID)
+
+	w = importChat("format=twitch", `{"comments": []}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,414 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// maxUserIDLength bounds the userId a join may claim, since it is echoed into
+// every frame and IRC line that names the user
+const maxUserIDLength = 128
+
+// InboundFrame is a decoded client frame. The concrete types below document the
+// client protocol and are what client SDK schemas are generated from.
+type InboundFrame interface {
+	// FrameType returns the frame's "type" discriminator
+	FrameType() string
+	// Validate returns the fields that hold unacceptable values
+	Validate() []FieldError
+}
+
+// HelloFrame announces the protocol version the client speaks
+type HelloFrame struct {
+	ProtocolVersion int `json:"protocolVersion"`
+}
+
+// JoinFrame joins the session's room as a user
+type JoinFrame struct {
+	UserID      string `json:"userId,omitempty"`      // required unless joining as a guest
+	Username    string `json:"username,omitempty"`    // required unless joining as a guest
+	LazyHistory bool   `json:"lazyHistory,omitempty"` // skip the history sent on joining rooms; page it in with history_request instead
+	Guest       bool   `json:"guest,omitempty"`       // watch without an account; userId and username are ignored, and a "guest" frame gives the generated name
+}
+
+// ChatFrame sends a chat message to the room
+type ChatFrame struct {
+	Message string `json:"message"`
+	ID      string `json:"id,omitempty"`   // from a "reserved" frame, to broadcast the message under that ID
+	Room    string `json:"room,omitempty"` // a room added with join_room, instead of the connection's own
+}
+
+// TypingFrame starts or stops the user's typing indicator
+type TypingFrame struct {
+	IsTyping bool   `json:"isTyping"`
+	Room     string `json:"room,omitempty"` // a room added with join_room, instead of the connection's own
+}
+
+// PingFrame asks the server to echo the client's clock for latency measurement
+type PingFrame struct {
+	ClientTime int64 `json:"clientTime"` // milliseconds since the Unix epoch
+}
+
+// ReserveFrame reserves a message ID the client can render optimistically before
+// sending the message itself
+type ReserveFrame struct{}
+
+// StatsFrame subscribes to, or unsubscribes from, periodic "room_stats" frames
+type StatsFrame struct {
+	Subscribe       bool `json:"subscribe"`
+	IntervalSeconds int  `json:"intervalSeconds,omitempty"` // between frames, defaults to 5
+}
+
+// AckFrame reports the sequence number of the last message the client received
+// from a room. The server answers with a "missed" frame holding anything after it,
+// so clients send one after spotting a gap in the numbers.
+type AckFrame struct {
+	Seq  int64  `json:"seq"`
+	Room string `json:"room,omitempty"` // a room added with join_room, instead of the connection's own
+}
+
+// JoinRoomFrame adds another room to a joined session, as the same user
+type JoinRoomFrame struct {
+	Room string `json:"room"` // stream key
+}
+
+// LeaveRoomFrame leaves a room added with join_room
+type LeaveRoomFrame struct {
+	Room string `json:"room"` // stream key
+}
+
+// HistoryRequestFrame asks for a page of a room's history, answered with a
+// "history_page" frame
+type HistoryRequestFrame struct {
+	Before string `json:"before,omitempty"` // ID of the oldest message the client has; empty for the newest messages
+	Limit  int    `json:"limit,omitempty"`  // messages per page, defaults to 50 and is capped at 100
+	Room   string `json:"room,omitempty"`   // a room added with join_room, instead of the connection's own
+}
+
+// SetProfileFrame replaces the user's own name color and preferences, which are
+// kept across reconnects and answered with a "profile" frame
+type SetProfileFrame struct {
+	Color       string            `json:"color,omitempty"`       // #rrggbb, or empty for the client's default
+	Preferences map[string]string `json:"preferences,omitempty"` // notification and other client preferences
+}
+
+// ModerateFrame takes a moderation action in a room, which the user's roles there
+// must allow. Every user in the room is told with a "moderation" frame.
+type ModerateFrame struct {
+	Action          string `json:"action"`                    // timeout, untimeout, clear or slow_mode
+	UserID          string `json:"userId,omitempty"`          // the user to time out, or whose timeout to lift
+	DurationSeconds int    `json:"durationSeconds,omitempty"` // of a timeout, or between messages in slow mode; 0 turns slow mode off
+	Room            string `json:"room,omitempty"`            // a room added with join_room, instead of the connection's own
+}
+
+func (*HelloFrame) FrameType() string          { return "hello" }
+func (*JoinFrame) FrameType() string           { return "join" }
+func (*ChatFrame) FrameType() string           { return "message" }
+func (*TypingFrame) FrameType() string         { return "typing" }
+func (*PingFrame) FrameType() string           { return "ping" }
+func (*ReserveFrame) FrameType() string        { return "reserve" }
+func (*StatsFrame) FrameType() string          { return "stats" }
+func (*AckFrame) FrameType() string            { return "ack" }
+func (*JoinRoomFrame) FrameType() string       { return "join_room" }
+func (*LeaveRoomFrame) FrameType() string      { return "leave_room" }
+func (*HistoryRequestFrame) FrameType() string { return "history_request" }
+func (*SetProfileFrame) FrameType() string     { return "set_profile" }
+func (*ModerateFrame) FrameType() string       { return "moderate" }
+
+func (f *HelloFrame) Validate() []FieldError {
+	if f.ProtocolVersion < 0 {
+		return []FieldError{{Field: "protocolVersion", Message: "must not be negative"}}
+	}
+	return nil
+}
+
+func (f *JoinFrame) Validate() []FieldError {
+	if f.Guest {
+		return nil
+	}
+
+	var errs []FieldError
+	switch {
+	case f.UserID == "":
+		errs = append(errs, FieldError{Field: "userId", Message: "is required"})
+	case len(f.UserID) > maxUserIDLength:
+		errs = append(errs, FieldError{Field: "userId", Message: fmt.Sprintf("must be at most %d bytes", maxUserIDLength)})
+	case strings.IndexFunc(f.UserID, func(r rune) bool { return unicode.IsSpace(r) || unicode.IsControl(r) }) >= 0:
+		errs = append(errs, FieldError{Field: "userId", Message: "must not contain spaces or control characters"})
+	}
+	if f.Username == "" {
+		errs = append(errs, FieldError{Field: "username", Message: "is required"})
+	}
+	return errs
+}
+
+func (f *ChatFrame) Validate() []FieldError {
+	if f.Message == "" {
+		return []FieldError{{Field: "message", Message: "is required"}}
+	}
+	return nil
+}
+
+func (f *TypingFrame) Validate() []FieldError {
+	return nil
+}
+
+func (f *ReserveFrame) Validate() []FieldError {
+	return nil
+}
+
+func (f *StatsFrame) Validate() []FieldError {
+	if f.IntervalSeconds < 0 || f.IntervalSeconds > maxStatsIntervalSeconds {
+		return []FieldError{{Field: "intervalSeconds", Message: fmt.Sprintf("must be between 1 and %d, or 0 for the default", maxStatsIntervalSeconds)}}
+	}
+	return nil
+}
+
+func (f *AckFrame) Validate() []FieldError {
+	if f.Seq < 0 {
+		return []FieldError{{Field: "seq", Message: "must not be negative"}}
+	}
+	return nil
+}
+
+func (f *JoinRoomFrame) Validate() []FieldError {
+	if f.Room == "" {
+		return []FieldError{{Field: "room", Message: "is required"}}
+	}
+	return nil
+}
+
+func (f *LeaveRoomFrame) Validate() []FieldError {
+	if f.Room == "" {
+		return []FieldError{{Field: "room", Message: "is required"}}
+	}
+	return nil
+}
+
+func (f *HistoryRequestFrame) Validate() []FieldError {
+	if f.Limit < 0 {
+		return []FieldError{{Field: "limit", Message: "must not be negative"}}
+	}
+	return nil
+}
+
+func (f *SetProfileFrame) Validate() []FieldError {
+	return UserProfile{Color: f.Color, Preferences: f.Preferences}.fieldErrors()
+}
+
+func (f *ModerateFrame) Validate() []FieldError {
+	switch f.Action {
+	case ModerateTimeout:
+		var errs []FieldError
+		if f.UserID == "" {
+			errs = append(errs, FieldError{Field: "userId", Message: "is required"})
+		}
+		if f.DurationSeconds < 1 || f.DurationSeconds > maxModeratorTimeoutSeconds {
+			errs = append(errs, FieldError{Field: "durationSeconds", Message: fmt.Sprintf("must be between 1 and %d", maxModeratorTimeoutSeconds)})
+		}
+		return errs
+	case ModerateUntimeout:
+		if f.UserID == "" {
+			return []FieldError{{Field: "userId", Message: "is required"}}
+		}
+	case ModerateSlowMode:
+		if f.DurationSeconds < 0 || f.DurationSeconds > maxSlowModeSeconds {
+			return []FieldError{{Field: "durationSeconds", Message: fmt.Sprintf("must be between 0 and %d", maxSlowModeSeconds)}}
+		}
+	case ModerateClear:
+	default:
+		return []FieldError{{Field: "action", Message: "must be timeout, untimeout, clear or slow_mode"}}
+	}
+	return nil
+}
+
+func (f *PingFrame) Validate() []FieldError {
+	if f.ClientTime < 0 {
+		return []FieldError{{Field: "clientTime", Message: "must not be negative"}}
+	}
+	return nil
+}
+
+// inboundDecoders builds each frame type from its "data" object
+var inboundDecoders = map[string]func(r *fieldReader) InboundFrame{
+	"hello": func(r *fieldReader) InboundFrame {
+		r.require("protocolVersion")
+		return &HelloFrame{ProtocolVersion: r.int("protocolVersion")}
+	},
+	"join": func(r *fieldReader) InboundFrame {
+		return &JoinFrame{UserID: r.string("userId"), Username: r.string("username"), LazyHistory: r.bool("lazyHistory"), Guest: r.bool("guest")}
+	},
+	"message": func(r *fieldReader) InboundFrame {
+		return &ChatFrame{Message: r.string("message"), ID: r.string("id"), Room: r.string("room")}
+	},
+	"typing": func(r *fieldReader) InboundFrame {
+		return &TypingFrame{IsTyping: r.bool("isTyping"), Room: r.string("room")}
+	},
+	"ping": func(r *fieldReader) InboundFrame {
+		r.require("clientTime")
+		return &PingFrame{ClientTime: int64(r.int("clientTime"))}
+	},
+	"reserve": func(r *fieldReader) InboundFrame {
+		return &ReserveFrame{}
+	},
+	"stats": func(r *fieldReader) InboundFrame {
+		r.require("subscribe")
+		return &StatsFrame{Subscribe: r.bool("subscribe"), IntervalSeconds: r.int("intervalSeconds")}
+	},
+	"ack": func(r *fieldReader) InboundFrame {
+		r.require("seq")
+		return &AckFrame{Seq: int64(r.int("seq")), Room: r.string("room")}
+	},
+	"join_room": func(r *fieldReader) InboundFrame {
+		return &JoinRoomFrame{Room: r.string("room")}
+	},
+	"leave_room": func(r *fieldReader) InboundFrame {
+		return &LeaveRoomFrame{Room: r.string("room")}
+	},
+	"history_request": func(r *fieldReader) InboundFrame {
+		return &HistoryRequestFrame{Before: r.string("before"), Limit: r.int("limit"), Room: r.string("room")}
+	},
+	"set_profile": func(r *fieldReader) InboundFrame {
+		return &SetProfileFrame{Color: r.string("color"), Preferences: r.stringMap("preferences")}
+	},
+	"moderate": func(r *fieldReader) InboundFrame {
+		r.require("action")
+		return &ModerateFrame{Action: r.string("action"), UserID: r.string("userId"), DurationSeconds: r.int("durationSeconds"), Room: r.string("room")}
+	},
+}
+
+// FieldError describes one invalid field of a client frame
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is returned for client frames that don't match the protocol
+type ValidationError struct {
+	FrameType string
+	Fields    []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Fields))
+	for _, field := range e.Fields {
+		parts = append(parts, field.Field+" "+field.Message)
+	}
+
+	if e.FrameType == "" {
+		return "Invalid frame: " + strings.Join(parts, "; ")
+	}
+	return fmt.Sprintf("Invalid %s frame: %s", e.FrameType, strings.Join(parts, "; "))
+}
+
+// DecodeInbound turns a frame decoded by any of the codecs into its typed form
+// and validates it
+func DecodeInbound(msg map[string]interface{}) (InboundFrame, error) {
+	msgType, ok := msg["type"].(string)
+	if !ok {
+		return nil, &ValidationError{Fields: []FieldError{{Field: "type", Message: "must be a string"}}}
+	}
+
+	decode, known := inboundDecoders[msgType]
+	if !known {
+		return nil, &ValidationError{Fields: []FieldError{{Field: "type", Message: fmt.Sprintf("%q is not a known frame type", msgType)}}}
+	}
+
+	data, ok := msg["data"].(map[string]interface{})
+	if !ok {
+		return nil, &ValidationError{FrameType: msgType, Fields: []FieldError{{Field: "data", Message: "must be an object"}}}
+	}
+
+	reader := &fieldReader{data: data}
+	frame := decode(reader)
+	if len(reader.errs) > 0 {
+		return nil, &ValidationError{FrameType: msgType, Fields: reader.errs}
+	}
+
+	return frame, validateInbound(frame)
+}
+
+// validateInbound runs a frame's validation, returning a *ValidationError or nil
+func validateInbound(frame InboundFrame) error {
+	if fields := frame.Validate(); len(fields) > 0 {
+		return &ValidationError{FrameType: frame.FrameType(), Fields: fields}
+	}
+	return nil
+}
+
+// fieldReader reads typed fields out of a frame's data object, collecting type
+// mismatches. Absent fields read as the zero value and are left to Validate.
+type fieldReader struct {
+	data map[string]interface{}
+	errs []FieldError
+}
+
+// require records an error if a field is absent
+func (r *fieldReader) require(name string) {
+	if v, exists := r.data[name]; !exists || v == nil {
+		r.errs = append(r.errs, FieldError{Field: name, Message: "is required"})
+	}
+}
+
+func (r *fieldReader) string(name string) string {
+	v, exists := r.data[name]
+	if !exists || v == nil {
+		return ""
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		r.errs = append(r.errs, FieldError{Field: name, Message: "must be a string"})
+	}
+	return s
+}
+
+func (r *fieldReader) stringMap(name string) map[string]string {
+	v, exists := r.data[name]
+	if !exists || v == nil {
+		return nil
+	}
+
+	object, ok := v.(map[string]interface{})
+	if !ok {
+		r.errs = append(r.errs, FieldError{Field: name, Message: "must be an object"})
+		return nil
+	}
+	values := make(map[string]string, len(object))
+	for key, item := range object {
+		s, ok := item.(string)
+		if !ok {
+			r.errs = append(r.errs, FieldError{Field: name, Message: "must map names to strings"})
+			return nil
+		}
+		values[key] = s
+	}
+	return values
+}
+
+func (r *fieldReader) bool(name string) bool {
+	v, exists := r.data[name]
+	if !exists || v == nil {
+		return false
+	}
+
+	b, ok := v.(bool)
+	if !ok {
+		r.errs = append(r.errs, FieldError{Field: name, Message: "must be a boolean"})
+	}
+	return b
+}
+
+func (r *fieldReader) int(name string) int {
+	v, exists := r.data[name]
+	if !exists || v == nil {
+		return 0
+	}
+
+	n, ok := intValue(v)
+	if !ok {
+		r.errs = append(r.errs, FieldError{Field: name, Message: "must be an integer"})
+	}
+	return n
+}
@@ -0,0 +1,86 @@
+package chat
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeInbound(t *testing.T) {
+	frame, err := DecodeInbound(map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{"userId": "alice", "username": "Alice"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &JoinFrame{UserID: "alice", Username: "Alice"}, frame)
+
+	// msgpack decodes small integers as int8
+	frame, err = DecodeInbound(map[string]interface{}{
+		"type": "hello",
+		"data": map[string]interface{}{"protocolVersion": int8(1)},
+	})
+	require.NoError(t, err)
+	require.Equal(t, &HelloFrame{ProtocolVersion: 1}, frame)
+
+	for name, tc := range map[string]struct {
+		msg    map[string]interface{}
+		fields []FieldError
+	}{
+		"missing type": {
+			msg:    map[string]interface{}{"data": map[string]interface{}{}},
+			fields: []FieldError{{Field: "type", Message: "must be a string"}},
+		},
+		"unknown type": {
+			msg:    map[string]interface{}{"type": "dance", "data": map[string]interface{}{}},
+			fields: []FieldError{{Field: "type", Message: `"dance" is not a known frame type`}},
+		},
+		"missing data": {
+			msg:    map[string]interface{}{"type": "message"},
+			fields: []FieldError{{Field: "data", Message: "must be an object"}},
+		},
+		"wrong field type": {
+			msg: map[string]interface{}{
+				"type": "join",
+				"data": map[string]interface{}{"userId": 42, "username": true},
+			},
+			fields: []FieldError{
+				{Field: "userId", Message: "must be a string"},
+				{Field: "username", Message: "must be a string"},
+			},
+		},
+		"ping without a timestamp": {
+			msg:    map[string]interface{}{"type": "ping", "data": map[string]interface{}{}},
+			fields: []FieldError{{Field: "clientTime", Message: "is required"}},
+		},
+		"negative history page size": {
+			msg:    map[string]interface{}{"type": "history_request", "data": map[string]interface{}{"limit": -1}},
+			fields: []FieldError{{Field: "limit", Message: "must not be negative"}},
+		},
+		"user id that could break an IRC line": {
+			msg: map[string]interface{}{
+				"type": "join",
+				"data": map[string]interface{}{"userId": "eve\r\nPRIVMSG #room :hi", "username": "Eve"},
+			},
+			fields: []FieldError{{Field: "userId", Message: "must not contain spaces or control characters"}},
+		},
+		"overlong user id": {
+			msg: map[string]interface{}{
+				"type": "join",
+				"data": map[string]interface{}{"userId": strings.Repeat("a", maxUserIDLength+1), "username": "A"},
+			},
+			fields: []FieldError{{Field: "userId", Message: "must be at most 128 bytes"}},
+		},
+		"missing required fields": {
+			msg:    map[string]interface{}{"type": "join", "data": map[string]interface{}{}},
+			fields: []FieldError{{Field: "userId", Message: "is required"}, {Field: "username", Message: "is required"}},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeInbound(tc.msg)
+			var validationErr *ValidationError
+			require.ErrorAs(t, err, &validationErr)
+			require.Equal(t, tc.fields, validationErr.Fields)
+		})
+	}
+}
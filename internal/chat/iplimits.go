@@ -0,0 +1,110 @@
+package chat
+
+import (
+	"net"
+	"sync"
+	"time"
+)
+
+// IPLimiter caps how many chat connections one remote address may hold open and
+// how often it may open new ones, so a single host can't take up the instance's
+// sockets. IPv6 clients are counted by /64, the smallest block a host is usually
+// given, so they can't dodge the limits by rotating addresses.
+type IPLimiter struct {
+	maxConnections    int
+	maxJoinsPerMinute int
+	connections       map[string]int         // address -> open connections
+	joins             map[string][]time.Time // address -> recent connection attempts
+	lastCleanup       time.Time
+	mutex             sync.Mutex
+}
+
+// NewIPLimiter creates a new per-address limiter. A limit of 0 disables that check.
+func NewIPLimiter(maxConnections, maxJoinsPerMinute int) *IPLimiter {
+	return &IPLimiter{
+		maxConnections:    maxConnections,
+		maxJoinsPerMinute: maxJoinsPerMinute,
+		connections:       make(map[string]int),
+		joins:             make(map[string][]time.Time),
+		lastCleanup:       time.Now(),
+	}
+}
+
+// Admit counts a new connection from ip, or returns an error if the address is
+// opening connections too quickly or already holds as many as it may. Every
+// admitted connection must be released.
+func (l *IPLimiter) Admit(ip string) *ChatError {
+	key := ipLimitKey(ip)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	now := time.Now()
+	if now.Sub(l.lastCleanup) > time.Minute {
+		l.cleanup(now)
+	}
+	recent := pruneTimestamps(l.joins[key], now.Add(-time.Minute))
+
+	if l.maxJoinsPerMinute > 0 && len(recent) >= l.maxJoinsPerMinute {
+		l.joins[key] = recent
+		return ErrIPJoinRateLimit.withDetails(ErrorDetails{
+			RetryAfterSeconds: retryAfter(recent[0].Add(time.Minute).Sub(now)),
+			Limit:             l.maxJoinsPerMinute,
+			Window:            60,
+			Tier:              TierIPJoinRate,
+		})
+	}
+
+	if l.maxConnections > 0 && l.connections[key] >= l.maxConnections {
+		l.joins[key] = recent
+		return ErrIPConnectionLimit.withDetails(ErrorDetails{Limit: l.maxConnections, Tier: TierIPConnections})
+	}
+
+	l.connections[key]++
+	l.joins[key] = append(recent, now)
+	return nil
+}
+
+// Release frees the slot of a connection admitted from ip
+func (l *IPLimiter) Release(ip string) {
+	key := ipLimitKey(ip)
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.connections[key]--; l.connections[key] <= 0 {
+		delete(l.connections, key)
+	}
+}
+
+// Connections returns how many connections are open from ip's address
+func (l *IPLimiter) Connections(ip string) int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.connections[ipLimitKey(ip)]
+}
+
+// cleanup drops attempt history older than the rate window. Callers must hold
+// the mutex.
+func (l *IPLimiter) cleanup(now time.Time) {
+	cutoff := now.Add(-time.Minute)
+	for key, timestamps := range l.joins {
+		if recent := pruneTimestamps(timestamps, cutoff); len(recent) == 0 {
+			delete(l.joins, key)
+		} else {
+			l.joins[key] = recent
+		}
+	}
+	l.lastCleanup = now
+}
+
+// ipLimitKey returns the address connections from ip are counted under: the
+// address itself for IPv4, its /64 for IPv6
+func ipLimitKey(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(64, 128)), Mask: net.CIDRMask(64, 128)}).String()
+}
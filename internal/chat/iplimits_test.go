@@ -0,0 +1,139 @@
+package chat
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/chat/chatpb"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+func TestClientIP(t *testing.T) {
+	proxies := NewTrustedProxies([]string{"10.0.0.0/8", "192.0.2.1", "not-an-ip"})
+	request := func(remoteAddr string, headers map[string]string) *http.Request {
+		r := httptest.NewRequest(http.MethodGet, "/api/chat", nil)
+		r.RemoteAddr = remoteAddr
+		for name, value := range headers {
+			r.Header.Set(name, value)
+		}
+		return r
+	}
+
+	// Headers from clients that aren't proxies are ignored
+	require.Equal(t, "203.0.113.9", proxies.ClientIP(request("203.0.113.9:4000", map[string]string{"X-Forwarded-For": "198.51.100.1"})))
+
+	// Behind proxies the rightmost untrusted hop is the client, whatever it claims before that
+	require.Equal(t, "198.51.100.7", proxies.ClientIP(request("10.1.2.3:4000", map[string]string{"X-Forwarded-For": "1.1.1.1, 198.51.100.7, 10.9.9.9"})))
+	require.Equal(t, "198.51.100.7", proxies.ClientIP(request("192.0.2.1:4000", map[string]string{"X-Real-IP": "198.51.100.7"})))
+	require.Equal(t, "10.1.2.3", proxies.ClientIP(request("10.1.2.3:4000", nil)))
+}
+
+func TestIPLimiter(t *testing.T) {
+	limiter := NewIPLimiter(2, 3)
+
+	require.Nil(t, limiter.Admit("198.51.100.1"))
+	require.Nil(t, limiter.Admit("198.51.100.1"))
+	err := limiter.Admit("198.51.100.1")
+	require.Equal(t, CodeIPConnectionLimit, err.Code)
+	require.Equal(t, 2, err.Details.Limit)
+	require.Nil(t, limiter.Admit("198.51.100.2"))
+
+	// A freed slot can be reused, until the address has opened too many this minute
+	limiter.Release("198.51.100.1")
+	require.Nil(t, limiter.Admit("198.51.100.1"))
+	limiter.Release("198.51.100.1")
+	err = limiter.Admit("198.51.100.1")
+	require.Equal(t, CodeIPJoinRateLimit, err.Code)
+	require.Positive(t, err.Details.RetryAfterSeconds)
+
+	// IPv6 clients share their /64
+	require.Nil(t, limiter.Admit("2001:db8::1"))
+	require.Nil(t, limiter.Admit("2001:db8::2"))
+	require.Equal(t, CodeIPConnectionLimit, limiter.Admit("2001:db8::3").Code)
+	require.Nil(t, limiter.Admit("2001:db8:0:1::1"))
+}
+
+func TestWebSocketPerIPConnectionLimit(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.ipLimits = NewIPLimiter(2, 0)
+
+	first := dialTestClient(t, server, "room")
+	dialTestClient(t, server, "room")
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?streamKey=room"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.Error(t, err)
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// Closing a connection frees its slot
+	first.Close()
+	require.Eventually(t, func() bool { return h.ipLimits.Connections("127.0.0.1") == 1 }, 5*time.Second, 10*time.Millisecond)
+	dialTestClient(t, server, "room")
+}
+
+func TestListenersApplyConnectionLimits(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.ipLimits = NewIPLimiter(1, 0)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	gateway := NewIRCGateway(h)
+	go gateway.Serve(listener) //nolint
+	defer gateway.Close()
+
+	first, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	require.Eventually(t, func() bool { return h.ipLimits.Connections("127.0.0.1") == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// The address's one slot is taken, so IRC, gRPC and long-poll clients are refused
+	second, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	require.NoError(t, second.SetReadDeadline(time.Now().Add(5*time.Second)))
+	line, err := bufio.NewReader(second).ReadString('\n')
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(line, "ERROR :"), line)
+
+	grpcListener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	grpcServer := NewGRPCServer(h)
+	go grpcServer.Serve(grpcListener) //nolint
+	defer grpcServer.Stop()
+
+	client, err := grpc.NewClient(grpcListener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer client.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := chatpb.NewChatClient(client).Connect(ctx)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	require.Equal(t, codes.ResourceExhausted, status.Code(err))
+
+	resp, err := http.Post(server.URL+"/api/chat/poll?streamKey=room", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+
+	// Freed slots are refused too while the instance drains
+	first.Close()
+	require.Eventually(t, func() bool { return h.ipLimits.Connections("127.0.0.1") == 0 }, 5*time.Second, 10*time.Millisecond)
+	h.draining.Store(true)
+	resp, err = http.Post(server.URL+"/api/chat/poll?streamKey=room", "application/json", nil)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Zero(t, h.openConns.Load())
+}
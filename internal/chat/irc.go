@@ -0,0 +1,590 @@
+package chat
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	ircServerName    = "tmi.twitch.tv"
+	ircMaxLineLength = 16 * 1024
+	ircPingInterval  = 4 * time.Minute
+	ircReadTimeout   = 6 * time.Minute
+	ircWriteTimeout  = 10 * time.Second
+)
+
+// IRCGateway bridges a Twitch-style IRC dialect into chat rooms, so existing bot
+// frameworks (tmi.js, go-twitch-irc) can connect unchanged. IRC channels map to
+// stream keys: #mystream is the room for stream key "mystream".
+type IRCGateway struct {
+	handler  *WSHandler
+	listener net.Listener
+	mutex    sync.Mutex
+}
+
+// NewIRCGateway creates a gateway that joins clients into the handler's rooms
+func NewIRCGateway(handler *WSHandler) *IRCGateway {
+	return &IRCGateway{handler: handler}
+}
+
+// ListenAndServe accepts IRC clients on the given TCP address until Close is called
+func (g *IRCGateway) ListenAndServe(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Chat IRC gateway listening on %s", addr)
+	return g.Serve(listener)
+}
+
+// Serve accepts IRC clients on the listener until Close is called
+func (g *IRCGateway) Serve(listener net.Listener) error {
+	g.mutex.Lock()
+	g.listener = listener
+	g.mutex.Unlock()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		client := &ircClient{
+			gateway:  g,
+			conn:     conn,
+			channels: make(map[string]*ircChannel),
+		}
+		go client.serve()
+	}
+}
+
+// Close stops accepting new IRC clients
+func (g *IRCGateway) Close() error {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+
+	if g.listener == nil {
+		return nil
+	}
+	return g.listener.Close()
+}
+
+// ircClient is a single IRC connection, which may be joined to several channels
+type ircClient struct {
+	gateway  *IRCGateway
+	conn     net.Conn
+	nick     string
+	token    string // from PASS, with any oauth: prefix removed
+	tags     bool   // client requested twitch.tv/tags
+	channels map[string]*ircChannel
+	writeMux sync.Mutex
+}
+
+// ircChannel is a client's membership in one room. Logged-in users get a full
+// Connection; anonymous justinfan users only follow the room's broadcast feed.
+type ircChannel struct {
+	conn *Connection
+	feed chan WSMessage
+	stop chan struct{}
+}
+
+// ircTransport carries one channel of an IRC client as a chat Connection
+type ircTransport struct {
+	client *ircClient
+}
+
+// Close disconnects the IRC client when a session is forcibly closed
+func (t *ircTransport) Close(reason string) error {
+	if reason == "" {
+		return nil
+	}
+
+	t.client.writeLine(fmt.Sprintf(":%s NOTICE * :%s", ircServerName, reason))
+	return t.client.conn.Close()
+}
+
+// serve reads commands from the client until it disconnects
+func (c *ircClient) serve() {
+	defer trackWorker("irc.client")()
+	defer c.close()
+
+	remoteAddr := c.conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(remoteAddr); err == nil {
+		remoteAddr = host
+	}
+
+	// Raw TCP carries no forwarding headers, so the peer is the client
+	if err := c.gateway.handler.admit(remoteAddr); err != nil {
+		c.writeLine("ERROR :" + err.Message)
+		return
+	}
+	defer c.gateway.handler.releaseConnection(remoteAddr)
+
+	done := make(chan struct{})
+	defer close(done)
+	go c.keepAlive(done)
+
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 4096), ircMaxLineLength)
+
+	for {
+		c.conn.SetReadDeadline(time.Now().Add(ircReadTimeout)) //nolint
+		if !scanner.Scan() {
+			return
+		}
+
+		command, params := parseIRCLine(scanner.Text())
+		if !c.handleCommand(command, params, remoteAddr) {
+			return
+		}
+	}
+}
+
+// keepAlive pings the client periodically until done is closed
+func (c *ircClient) keepAlive(done <-chan struct{}) {
+	ticker := time.NewTicker(ircPingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !c.writeLine("PING :" + ircServerName) {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+// handleCommand handles a single IRC command, returning false to disconnect
+func (c *ircClient) handleCommand(command string, params []string, remoteAddr string) bool {
+	switch command {
+	case "CAP":
+		if len(params) >= 2 && params[0] == "REQ" {
+			if strings.Contains(params[1], "twitch.tv/tags") {
+				c.tags = true
+			}
+			c.writeLine(fmt.Sprintf(":%s CAP * ACK :%s", ircServerName, params[1]))
+		}
+
+	case "PASS":
+		// Twitch clients send "oauth:<token>"; the token is checked when joining
+		if len(params) >= 1 {
+			c.token = strings.TrimPrefix(params[0], "oauth:")
+		}
+
+	case "NICK":
+		if len(params) < 1 || c.nick != "" {
+			return true
+		}
+		c.nick = ircNick(params[0])
+		c.writeWelcome()
+
+	case "JOIN":
+		if c.nick == "" || len(params) < 1 {
+			return true
+		}
+		for _, channel := range strings.Split(params[0], ",") {
+			c.join(channel, remoteAddr)
+		}
+
+	case "PART":
+		if len(params) < 1 {
+			return true
+		}
+		for _, channel := range strings.Split(params[0], ",") {
+			c.part(channel)
+		}
+
+	case "PRIVMSG":
+		if len(params) < 2 {
+			return true
+		}
+		c.privmsg(params[0], params[1])
+
+	case "PING":
+		token := ircServerName
+		if len(params) > 0 {
+			token = params[0]
+		}
+		c.writeLine(fmt.Sprintf(":%s PONG %s :%s", ircServerName, ircServerName, token))
+
+	case "QUIT":
+		return false
+	}
+
+	return true
+}
+
+// writeWelcome sends the registration burst Twitch clients wait for
+func (c *ircClient) writeWelcome() {
+	for _, line := range []string{
+		fmt.Sprintf(":%s 001 %s :Welcome, GLHF!", ircServerName, c.nick),
+		fmt.Sprintf(":%s 002 %s :Your host is %s", ircServerName, c.nick, ircServerName),
+		fmt.Sprintf(":%s 003 %s :This server is rather new", ircServerName, c.nick),
+		fmt.Sprintf(":%s 004 %s :-", ircServerName, c.nick),
+		fmt.Sprintf(":%s 375 %s :-", ircServerName, c.nick),
+		fmt.Sprintf(":%s 372 %s :You are in a maze of twisty passages, all alike.", ircServerName, c.nick),
+		fmt.Sprintf(":%s 376 %s :>", ircServerName, c.nick),
+	} {
+		c.writeLine(line)
+	}
+}
+
+// isAnonymous reports whether the client logged in as a read-only justinfan user
+func (c *ircClient) isAnonymous() bool {
+	return strings.HasPrefix(c.nick, "justinfan")
+}
+
+// join joins the client to a channel's room
+func (c *ircClient) join(channel, remoteAddr string) {
+	streamKey := strings.TrimPrefix(channel, "#")
+	if streamKey == "" {
+		return
+	}
+	if _, joined := c.channels[streamKey]; joined {
+		return
+	}
+
+	h := c.gateway.handler
+	membership := &ircChannel{stop: make(chan struct{})}
+
+	if c.isAnonymous() {
+		feed, err := h.subscribe(streamKey)
+		if err != nil {
+			c.writeLine(fmt.Sprintf(":%s NOTICE #%s :%s", ircServerName, streamKey, ircSafe(err.Message)))
+			return
+		}
+		membership.feed = feed
+	} else {
+		if err := h.manager.OpenRoom(streamKey, nil); err != nil {
+			c.writeLine(fmt.Sprintf(":%s NOTICE #%s :%s", ircServerName, streamKey, ircSafe(err.Error())))
+			return
+		}
+
+		identity, err := h.resolveIdentity(Credentials{Token: c.token, RemoteAddr: remoteAddr})
+		if err != nil {
+			c.writeLine(fmt.Sprintf(":%s NOTICE #%s :Login authentication failed", ircServerName, streamKey))
+			return
+		}
+
+		userID := c.nick
+		if identity != nil {
+			userID = identity.UserID
+		}
+		conn := newConnection(h, streamKey, remoteAddr, &ircTransport{client: c})
+		conn.identity = identity
+		conn.handleFrame(&JoinFrame{UserID: userID, Username: c.nick})
+
+		if conn.UserID == "" {
+			// The join was refused; pass the reason on and give up on the channel
+			for drained := false; !drained; {
+				select {
+				case msg := <-conn.Send:
+					for _, line := range c.translate(streamKey, msg) {
+						c.writeLine(line)
+					}
+				default:
+					drained = true
+				}
+			}
+			conn.Close("")
+			return
+		}
+
+		membership.conn = conn
+	}
+
+	c.channels[streamKey] = membership
+
+	c.writeLine(fmt.Sprintf(":%s!%s@%s.%s JOIN #%s", c.nick, c.nick, c.nick, ircServerName, streamKey))
+	if c.tags {
+		modes := h.roomState(streamKey).Modes
+		c.writeLine(fmt.Sprintf("@emote-only=%d;followers-only=-1;r9k=0;room-id=%s;slow=%d;subs-only=0 :%s ROOMSTATE #%s",
+			ircFlag(modes.EmoteOnly), escapeIRCTag(streamKey), modes.SlowModeSeconds, ircServerName, streamKey))
+	}
+
+	// Relay room traffic only after the JOIN echo so NAMES follows it
+	if membership.conn != nil {
+		go c.relay(streamKey, membership.conn.Send, membership.conn.Done())
+	} else {
+		go c.relay(streamKey, membership.feed, membership.stop)
+	}
+}
+
+// part removes the client from a channel
+func (c *ircClient) part(channel string) {
+	streamKey := strings.TrimPrefix(channel, "#")
+	membership, joined := c.channels[streamKey]
+	if !joined {
+		return
+	}
+
+	delete(c.channels, streamKey)
+	c.leave(streamKey, membership)
+	c.writeLine(fmt.Sprintf(":%s!%s@%s.%s PART #%s", c.nick, c.nick, c.nick, ircServerName, streamKey))
+}
+
+// leave tears down a channel membership
+func (c *ircClient) leave(streamKey string, membership *ircChannel) {
+	if membership.conn != nil {
+		membership.conn.cleanup()
+		return
+	}
+
+	c.gateway.handler.unsubscribe(streamKey, membership.feed)
+	close(membership.stop)
+}
+
+// privmsg sends a chat message into a channel's room
+func (c *ircClient) privmsg(channel, text string) {
+	streamKey := strings.TrimPrefix(channel, "#")
+	membership, joined := c.channels[streamKey]
+	if !joined || membership.conn == nil {
+		c.writeLine(fmt.Sprintf("@msg-id=msg_channel_suspended :%s NOTICE #%s :You cannot send messages to this channel.",
+			ircServerName, streamKey))
+		return
+	}
+
+	membership.conn.handleFrame(&ChatFrame{Message: text})
+}
+
+// relay translates room frames into IRC lines until stopped
+func (c *ircClient) relay(streamKey string, frames <-chan WSMessage, stop <-chan struct{}) {
+	defer trackWorker("irc.relay")()
+
+	for {
+		select {
+		case msg, ok := <-frames:
+			if !ok {
+				// The room's feed ended because chat was turned off
+				c.writeLine(fmt.Sprintf(":%s NOTICE #%s :%s", ircServerName, streamKey, ircSafe(ErrChatDisabled.Message)))
+				return
+			}
+			for _, line := range c.translate(streamKey, msg) {
+				if !c.writeLine(line) {
+					return
+				}
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// translate converts a chat frame into the IRC lines a Twitch client expects
+func (c *ircClient) translate(streamKey string, msg WSMessage) []string {
+	switch msg.Type {
+	case "message":
+		chatMsg, ok := msg.Data.(*ChatMessage)
+		if !ok || chatMsg.UserID == c.nick {
+			// Twitch never echoes a client's own messages back to it
+			return nil
+		}
+
+		nick := ircNick(chatMsg.UserID)
+		prefix := ""
+		if c.tags {
+			badges, mod, userType := c.senderTags(streamKey, chatMsg.UserID)
+			prefix = fmt.Sprintf("@badge-info=;badges=%s;color=;display-name=%s;emotes=;id=%s;mod=%s;room-id=%s;subscriber=0;tmi-sent-ts=%d;turbo=0;user-id=%s;user-type=%s ",
+				badges, escapeIRCTag(chatMsg.Username), chatMsg.ID, mod, escapeIRCTag(streamKey),
+				chatMsg.Timestamp.UnixMilli(), escapeIRCTag(chatMsg.UserID), userType)
+		}
+		return []string{fmt.Sprintf("%s:%s!%s@%s.%s PRIVMSG #%s :%s",
+			prefix, nick, nick, nick, ircServerName, streamKey, ircSafe(chatMsg.Message))}
+
+	case "users":
+		users, ok := msg.Data.([]*ChatUser)
+		if !ok {
+			return nil
+		}
+		names := make([]string, 0, len(users))
+		for _, user := range users {
+			names = append(names, ircNick(user.UserID))
+		}
+		return []string{
+			fmt.Sprintf(":%s.%s 353 %s = #%s :%s", c.nick, ircServerName, c.nick, streamKey, strings.Join(names, " ")),
+			fmt.Sprintf(":%s.%s 366 %s #%s :End of /NAMES list", c.nick, ircServerName, c.nick, streamKey),
+		}
+
+	case "user_joined", "user_left":
+		user, ok := msg.Data.(UserEvent)
+		if !ok {
+			return nil
+		}
+		nick := ircNick(user.UserID)
+		if nick == c.nick {
+			return nil
+		}
+		verb := "JOIN"
+		if msg.Type == "user_left" {
+			verb = "PART"
+		}
+		return []string{fmt.Sprintf(":%s!%s@%s.%s %s #%s", nick, nick, nick, ircServerName, verb, streamKey)}
+
+	case "system":
+		system, ok := msg.Data.(SystemEvent)
+		if !ok {
+			return nil
+		}
+		return []string{fmt.Sprintf(":%s NOTICE #%s :%s", ircServerName, streamKey, ircSafe(system.Message))}
+
+	case "room_modes":
+		modes, ok := msg.Data.(RoomModes)
+		if !ok || !c.tags {
+			return nil
+		}
+		return []string{fmt.Sprintf("@emote-only=%d;room-id=%s;slow=%d :%s ROOMSTATE #%s",
+			ircFlag(modes.EmoteOnly), escapeIRCTag(streamKey), modes.SlowModeSeconds, ircServerName, streamKey)}
+
+	case "chat_cleared":
+		return []string{fmt.Sprintf(":%s CLEARCHAT #%s", ircServerName, streamKey)}
+
+	case "error", "rate_limit":
+		return []string{fmt.Sprintf("@msg-id=msg_ratelimit :%s NOTICE #%s :%s", ircServerName, streamKey, ircSafe(msg.Error))}
+
+	case "timeout":
+		timeout, ok := msg.Data.(TimeoutEvent)
+		if !ok {
+			return nil
+		}
+		seconds := timeout.Duration
+		return []string{fmt.Sprintf("@msg-id=msg_timedout :%s NOTICE #%s :You are timed out for %s more seconds.",
+			ircServerName, streamKey, strconv.Itoa(int(seconds)))}
+
+	case "timeout_ended":
+		return []string{fmt.Sprintf(":%s NOTICE #%s :Your timeout has ended.", ircServerName, streamKey)}
+	}
+
+	return nil
+}
+
+// writeLine writes a single line to the client, returning false once the socket is dead
+func (c *ircClient) writeLine(line string) bool {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+
+	c.conn.SetWriteDeadline(time.Now().Add(ircWriteTimeout)) //nolint
+	if _, err := c.conn.Write([]byte(line + "\r\n")); err != nil {
+		return false
+	}
+	return true
+}
+
+// close leaves every channel and closes the socket
+func (c *ircClient) close() {
+	for streamKey, membership := range c.channels {
+		c.leave(streamKey, membership)
+	}
+	c.channels = map[string]*ircChannel{}
+	c.conn.Close()
+}
+
+// senderTags returns the badges, mod and user-type tags for a message's sender,
+// from their roles and badges in the room
+func (c *ircClient) senderTags(streamKey, userID string) (badges, mod, userType string) {
+	room, exists := c.gateway.handler.manager.GetRoom(streamKey)
+	if !exists {
+		return "", "0", ""
+	}
+	user, exists := room.GetUser(userID)
+	if !exists {
+		return "", "0", ""
+	}
+
+	tags := make([]string, 0, len(user.Badges))
+	for _, badge := range user.Badges {
+		tags = append(tags, escapeIRCTag(badge)+"/1")
+	}
+	mod = "0"
+	if slices.Contains(user.Roles, RoleModerator) {
+		mod, userType = "1", "mod"
+	}
+	return strings.Join(tags, ","), mod, userType
+}
+
+// parseIRCLine splits a raw IRC line into its command and parameters, discarding tags and prefix
+func parseIRCLine(line string) (string, []string) {
+	line = strings.TrimRight(line, "\r\n")
+
+	if strings.HasPrefix(line, "@") {
+		if idx := strings.IndexByte(line, ' '); idx != -1 {
+			line = strings.TrimLeft(line[idx+1:], " ")
+		}
+	}
+	if strings.HasPrefix(line, ":") {
+		if idx := strings.IndexByte(line, ' '); idx != -1 {
+			line = strings.TrimLeft(line[idx+1:], " ")
+		}
+	}
+
+	trailing := ""
+	hasTrailing := false
+	if idx := strings.Index(line, " :"); idx != -1 {
+		trailing = line[idx+2:]
+		hasTrailing = true
+		line = line[:idx]
+	}
+
+	fields := strings.Fields(line)
+	if len(fields) == 0 {
+		return "", nil
+	}
+
+	params := fields[1:]
+	if hasTrailing {
+		params = append(params, trailing)
+	}
+
+	return strings.ToUpper(fields[0]), params
+}
+
+// escapeIRCTag escapes a value for use in an IRCv3 message tag
+func escapeIRCTag(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\:`,
+		" ", `\s`,
+		"\r", `\r`,
+		"\n", `\n`,
+	).Replace(value)
+}
+
+// ircFlag renders a boolean ROOMSTATE tag
+func ircFlag(on bool) int {
+	if on {
+		return 1
+	}
+	return 0
+}
+
+// ircSafe strips line breaks that would otherwise inject extra IRC commands
+func ircSafe(text string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(text)
+}
+
+// ircNick turns a userID into a nick that can't break out of a line's prefix or
+// a NAMES list: lower case, without spaces, control characters or the characters
+// IRC uses to delimit nicks
+func ircNick(userID string) string {
+	nick := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || strings.ContainsRune("!@:,#", r) {
+			return -1
+		}
+		return unicode.ToLower(r)
+	}, userID)
+	if nick == "" {
+		return "_"
+	}
+	return nick
+}
@@ -0,0 +1,82 @@
+package chat
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseIRCLine(t *testing.T) {
+	command, params := parseIRCLine("@badges=;color= :nick!nick@host PRIVMSG #room :hello there\r\n")
+	require.Equal(t, "PRIVMSG", command)
+	require.Equal(t, []string{"#room", "hello there"}, params)
+
+	command, params = parseIRCLine("JOIN #a,#b")
+	require.Equal(t, "JOIN", command)
+	require.Equal(t, []string{"#a,#b"}, params)
+}
+
+func TestIRCNick(t *testing.T) {
+	require.Equal(t, "alice", ircNick("Alice"))
+	require.Equal(t, "guestabc", ircNick("guest:abc"))
+	require.Equal(t, "evenickxyprivmsgroomhi", ircNick("Eve\r\n:nick!x@y PRIVMSG #room :hi"))
+	require.Equal(t, "_", ircNick("!@: "))
+}
+
+func TestIRCGatewayBridgesMessages(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	gateway := NewIRCGateway(h)
+	go gateway.Serve(listener) //nolint
+	defer gateway.Close()
+
+	clientSide, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	defer clientSide.Close()
+
+	lines := bufio.NewReader(clientSide)
+	readLineContaining := func(substr string) string {
+		require.NoError(t, clientSide.SetReadDeadline(time.Now().Add(5*time.Second)))
+		for {
+			line, err := lines.ReadString('\n')
+			require.NoError(t, err)
+			if strings.Contains(line, substr) {
+				return line
+			}
+		}
+	}
+	send := func(line string) {
+		_, err := clientSide.Write([]byte(line + "\r\n"))
+		require.NoError(t, err)
+	}
+
+	send("CAP REQ :twitch.tv/tags twitch.tv/commands")
+	send("PASS oauth:anything")
+	send("NICK bot")
+	readLineContaining(" 376 bot ")
+
+	send("JOIN #room")
+	readLineContaining(" 366 bot #room ")
+
+	viewer := dialTestClient(t, server, "room")
+	joinTestClient(t, viewer, "viewer")
+
+	send("PRIVMSG #room :hello from irc")
+	msg := readUntil(t, viewer, "message")
+	require.Equal(t, "hello from irc", msg["data"].(map[string]interface{})["message"])
+
+	require.NoError(t, viewer.WriteJSON(map[string]interface{}{
+		"type": "message",
+		"data": map[string]interface{}{"message": "hi bot"},
+	}))
+	line := readLineContaining("PRIVMSG #room")
+	require.Contains(t, line, "display-name=viewer;")
+	require.True(t, strings.HasSuffix(strings.TrimSpace(line), ":hi bot"))
+}
@@ -0,0 +1,244 @@
+package chat
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	jwtLeeway            = 30 * time.Second // clock skew allowed on exp, nbf and iat
+	jwtSubprotocolPrefix = "bearer."        // Sec-WebSocket-Protocol entry carrying a token, beside a chat.v1 protocol
+)
+
+// jwtMaxLifetime is the longest gap between a token's iat and exp that is accepted,
+// so every token a session revocation covers expires while it is still kept
+const jwtMaxLifetime = revocationRetention - jwtLeeway
+
+var errInvalidToken = errors.New("invalid token")
+
+// jwtClaims are the claims chat reads from a token
+type jwtClaims struct {
+	Subject   string      `json:"sub"`
+	Username  string      `json:"username"`
+	Roles     []string    `json:"roles"`
+	Issuer    string      `json:"iss"`
+	Audience  jwtAudience `json:"aud"`
+	ExpiresAt *int64      `json:"exp"`
+	NotBefore *int64      `json:"nbf"`
+	IssuedAt  *int64      `json:"iat"`
+}
+
+// jwtAudience is the aud claim, which may be a string or a list of strings
+type jwtAudience []string
+
+func (a *jwtAudience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = jwtAudience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+// JWTVerifier is the Authenticator for signed tokens viewers present when connecting
+type JWTVerifier struct {
+	secret    []byte         // HS256
+	publicKey *rsa.PublicKey // RS256
+	issuer    string
+	audience  string
+}
+
+// NewJWTVerifier creates a verifier for HS256 tokens signed with secret and RS256
+// tokens signed by the key in publicKeyFile
+func NewJWTVerifier(secret, publicKeyFile, issuer, audience string) (*JWTVerifier, error) {
+	v := &JWTVerifier{
+		issuer:   issuer,
+		audience: audience,
+	}
+	if secret != "" {
+		v.secret = []byte(secret)
+	}
+	if publicKeyFile != "" {
+		key, err := loadRSAPublicKey(publicKeyFile)
+		if err != nil {
+			return v, err
+		}
+		v.publicKey = key
+	}
+	return v, nil
+}
+
+// loadRSAPublicKey reads a PEM encoded RSA public key or certificate
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%s holds no PEM block", path)
+	}
+
+	var key interface{}
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		key = cert.PublicKey
+	case "RSA PUBLIC KEY":
+		key, err = x509.ParsePKCS1PublicKey(block.Bytes)
+	default:
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an RSA public key", path)
+	}
+	return rsaKey, nil
+}
+
+// Authenticate verifies the token the client connected with
+func (v *JWTVerifier) Authenticate(_ context.Context, credentials Credentials) (*Identity, error) {
+	if credentials.Token == "" {
+		return nil, fmt.Errorf("%w: none presented", errInvalidToken)
+	}
+	return v.Verify(credentials.Token)
+}
+
+// Verify checks a token's signature and claims, returning who it was issued to
+func (v *JWTVerifier) Verify(token string) (*Identity, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errInvalidToken
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeJWTSegment(parts[0], &header); err != nil {
+		return nil, errInvalidToken
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errInvalidToken
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch {
+	case header.Algorithm == "HS256" && v.secret != nil:
+		mac := hmac.New(sha256.New, v.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errInvalidToken
+		}
+	case header.Algorithm == "RS256" && v.publicKey != nil:
+		digest := sha256.Sum256(signed)
+		if rsa.VerifyPKCS1v15(v.publicKey, crypto.SHA256, digest[:], signature) != nil {
+			return nil, errInvalidToken
+		}
+	default:
+		// Only the algorithms with a configured key are accepted, never "none"
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", errInvalidToken, header.Algorithm)
+	}
+
+	var claims jwtClaims
+	if err := decodeJWTSegment(parts[1], &claims); err != nil {
+		return nil, errInvalidToken
+	}
+	if err := v.checkClaims(&claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return &Identity{
+		UserID:   claims.Subject,
+		Username: claims.Username,
+		Roles:    claims.Roles,
+		IssuedAt: time.Unix(*claims.IssuedAt, 0),
+	}, nil
+}
+
+// checkClaims checks a verified token is current and meant for this server
+func (v *JWTVerifier) checkClaims(claims *jwtClaims, now time.Time) error {
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: no subject", errInvalidToken)
+	}
+	if claims.ExpiresAt == nil || now.After(time.Unix(*claims.ExpiresAt, 0).Add(jwtLeeway)) {
+		return fmt.Errorf("%w: expired", errInvalidToken)
+	}
+	if claims.NotBefore != nil && now.Add(jwtLeeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return fmt.Errorf("%w: not yet valid", errInvalidToken)
+	}
+	// Revocations are only kept for a while, so tokens must say when they were
+	// issued and expire before the revocations covering them are forgotten
+	if claims.IssuedAt == nil {
+		return fmt.Errorf("%w: no issue time", errInvalidToken)
+	}
+	if now.Add(jwtLeeway).Before(time.Unix(*claims.IssuedAt, 0)) {
+		return fmt.Errorf("%w: issued in the future", errInvalidToken)
+	}
+	if time.Unix(*claims.ExpiresAt, 0).Sub(time.Unix(*claims.IssuedAt, 0)) > jwtMaxLifetime {
+		return fmt.Errorf("%w: lifetime over %s", errInvalidToken, jwtMaxLifetime)
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return fmt.Errorf("%w: wrong issuer", errInvalidToken)
+	}
+	if v.audience != "" {
+		for _, audience := range claims.Audience {
+			if audience == v.audience {
+				return nil
+			}
+		}
+		return fmt.Errorf("%w: wrong audience", errInvalidToken)
+	}
+	return nil
+}
+
+// decodeJWTSegment decodes a base64url JSON segment of a token
+func decodeJWTSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// requestJWT returns the token a handshake carries, from the access_token query
+// parameter or a bearer.<token> WebSocket subprotocol, which browsers can set
+// where they can't set headers
+func requestJWT(r *http.Request) string {
+	if token := r.URL.Query().Get("access_token"); token != "" {
+		return token
+	}
+	for _, header := range r.Header.Values("Sec-WebSocket-Protocol") {
+		for _, protocol := range strings.Split(header, ",") {
+			if token, ok := strings.CutPrefix(strings.TrimSpace(protocol), jwtSubprotocolPrefix); ok {
+				return token
+			}
+		}
+	}
+	return ""
+}
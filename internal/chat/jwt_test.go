@@ -0,0 +1,161 @@
+package chat
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+const testJWTSecret = "test-secret"
+
+// signTestJWT signs claims as an HS256 token with testJWTSecret
+func signTestJWT(t *testing.T, claims map[string]interface{}) string {
+	signed := encodeTestJWT(t, "HS256", claims)
+	mac := hmac.New(sha256.New, []byte(testJWTSecret))
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// encodeTestJWT returns a token's unsigned header and claims segments
+func encodeTestJWT(t *testing.T, algorithm string, claims map[string]interface{}) string {
+	header, err := json.Marshal(map[string]string{"alg": algorithm, "typ": "JWT"})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+}
+
+func testClaims(userID string) map[string]interface{} {
+	now := time.Now()
+	return map[string]interface{}{
+		"sub":      userID,
+		"username": "Alice",
+		"roles":    []string{"viewer"},
+		"iat":      now.Unix(),
+		"exp":      now.Add(time.Hour).Unix(),
+		"iss":      "auth.example.com",
+		"aud":      []string{"chat"},
+	}
+}
+
+func TestJWTVerifier(t *testing.T) {
+	verifier, err := NewJWTVerifier(testJWTSecret, "", "auth.example.com", "chat")
+	require.NoError(t, err)
+
+	identity, err := verifier.Verify(signTestJWT(t, testClaims("alice")))
+	require.NoError(t, err)
+	require.Equal(t, "alice", identity.UserID)
+	require.Equal(t, "Alice", identity.Username)
+	require.Equal(t, []string{"viewer"}, identity.Roles)
+
+	for name, change := range map[string]func(claims map[string]interface{}){
+		"expired":      func(c map[string]interface{}) { c["exp"] = time.Now().Add(-time.Hour).Unix() },
+		"no expiry":    func(c map[string]interface{}) { delete(c, "exp") },
+		"no iat":       func(c map[string]interface{}) { delete(c, "iat") },
+		"too long":     func(c map[string]interface{}) { c["exp"] = time.Now().Add(revocationRetention).Unix() },
+		"not yet":      func(c map[string]interface{}) { c["nbf"] = time.Now().Add(time.Hour).Unix() },
+		"no subject":   func(c map[string]interface{}) { delete(c, "sub") },
+		"other issuer": func(c map[string]interface{}) { c["iss"] = "evil.example.com" },
+		"other aud":    func(c map[string]interface{}) { c["aud"] = "api" },
+	} {
+		claims := testClaims("alice")
+		change(claims)
+		_, err := verifier.Verify(signTestJWT(t, claims))
+		require.ErrorIs(t, err, errInvalidToken, name)
+	}
+
+	// Tampered claims, unsigned tokens and unconfigured algorithms are refused
+	token := signTestJWT(t, testClaims("alice"))
+	parts := strings.Split(token, ".")
+	forged := encodeTestJWT(t, "HS256", testClaims("mallory"))
+	_, err = verifier.Verify(forged + "." + parts[2])
+	require.ErrorIs(t, err, errInvalidToken)
+	_, err = verifier.Verify(encodeTestJWT(t, "none", testClaims("alice")) + ".")
+	require.ErrorIs(t, err, errInvalidToken)
+	_, err = verifier.Verify(encodeTestJWT(t, "RS256", testClaims("alice")) + "." + parts[2])
+	require.ErrorIs(t, err, errInvalidToken)
+}
+
+func TestJWTVerifierRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600))
+
+	verifier, err := NewJWTVerifier("", path, "", "")
+	require.NoError(t, err)
+
+	signed := encodeTestJWT(t, "RS256", testClaims("alice"))
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	require.NoError(t, err)
+
+	identity, err := verifier.Verify(signed + "." + base64.RawURLEncoding.EncodeToString(signature))
+	require.NoError(t, err)
+	require.Equal(t, "alice", identity.UserID)
+
+	// An HS256 token can't pass itself off with the public key as its secret
+	_, err = verifier.Verify(signTestJWT(t, testClaims("alice")))
+	require.ErrorIs(t, err, errInvalidToken)
+}
+
+func TestJoinRequiresJWT(t *testing.T) {
+	h, server := newTestHandler(t)
+	verifier, err := NewJWTVerifier(testJWTSecret, "", "", "")
+	require.NoError(t, err)
+	h.SetAuthenticator(verifier)
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?streamKey=room"
+	join := func(conn *websocket.Conn, userID, username string) {
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "join", "data": map[string]string{"userId": userID, "username": username}}))
+	}
+
+	for _, query := range []string{"", "&access_token=garbage"} {
+		conn := dialTestClient(t, server, "room"+query)
+		join(conn, "alice", "alice")
+		require.Equal(t, CodeUnauthenticated, readUntil(t, conn, "error")["code"])
+	}
+
+	// A token passed as a subprotocol, beside the protocol the server picks
+	token := signTestJWT(t, testClaims("alice"))
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{
+		"Sec-WebSocket-Protocol": {SubprotocolJSON + ", " + jwtSubprotocolPrefix + token},
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	require.Equal(t, SubprotocolJSON, conn.Subprotocol())
+
+	// The join can't claim to be someone else
+	join(conn, "bob", "bob")
+	require.Equal(t, CodeIdentityMismatch, readUntil(t, conn, "error")["code"])
+
+	// And the token's username wins over the frame's
+	join(conn, "alice", "admin")
+	readUntil(t, conn, "room_state")
+	users := h.manager.GetUsers("room")
+	require.Len(t, users, 1)
+	require.Equal(t, "Alice", users[0].Username)
+
+	// Tokens issued before a revocation are refused
+	h.revocations.Revoke("alice", time.Now().Add(time.Minute))
+	conn = dialTestClient(t, server, "room&access_token="+token)
+	join(conn, "alice", "alice")
+	require.Equal(t, CodeUnauthenticated, readUntil(t, conn, "error")["code"])
+}
@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+)
+
+// LoadLevel is how much optional traffic is being shed to keep chat messages flowing
+type LoadLevel int32
+
+const (
+	LoadNormal       LoadLevel = iota
+	LoadShedTyping             // typing indicators are dropped
+	LoadShedPresence           // join/leave deltas and viewer counts are dropped as well
+)
+
+const (
+	loadSampleInterval = time.Second
+	loadCalmSamples    = 10 // consecutive calm samples before stepping back down a level
+)
+
+// LoadShedder watches broadcast pressure and progressively drops the cheapest-to-lose
+// frames before chat messages are ever delayed. Levels rise one step per pressured
+// sample and fall one step after a sustained calm period.
+type LoadShedder struct {
+	enabled         bool
+	queueThreshold  float64       // average Send queue fill that counts as pressure
+	encodeThreshold time.Duration // average per-frame encode time that counts as pressure
+
+	level       atomic.Int32
+	encodeNanos atomic.Int64
+	encodeCount atomic.Int64
+	calmSamples int
+}
+
+// NewLoadShedder creates a shedder. A queuePercent of 0 disables shedding.
+func NewLoadShedder(queuePercent, encodeMicros int) *LoadShedder {
+	return &LoadShedder{
+		enabled:         queuePercent > 0,
+		queueThreshold:  float64(queuePercent) / 100,
+		encodeThreshold: time.Duration(encodeMicros) * time.Microsecond,
+	}
+}
+
+// Level returns the current shedding level
+func (ls *LoadShedder) Level() LoadLevel {
+	return LoadLevel(ls.level.Load())
+}
+
+// Allows reports whether frames of a type should still be delivered
+func (ls *LoadShedder) Allows(msgType string) bool {
+	switch msgType {
+	case "typing":
+		return ls.Level() < LoadShedTyping
+	case "user_joined", "user_left", EventViewerCountChanged:
+		return ls.Level() < LoadShedPresence
+	}
+	return true
+}
+
+// ObserveEncode records how long a frame took to encode
+func (ls *LoadShedder) ObserveEncode(d time.Duration) {
+	ls.encodeNanos.Add(int64(d))
+	ls.encodeCount.Add(1)
+}
+
+// sample folds one measurement period into the level and returns the new level
+func (ls *LoadShedder) sample(queueFill float64) LoadLevel {
+	var encodeAvg time.Duration
+	if count := ls.encodeCount.Swap(0); count > 0 {
+		encodeAvg = time.Duration(ls.encodeNanos.Swap(0) / count)
+	}
+
+	pressure := queueFill / ls.queueThreshold
+	if ls.encodeThreshold > 0 {
+		pressure = max(pressure, float64(encodeAvg)/float64(ls.encodeThreshold))
+	}
+
+	level := ls.Level()
+	switch {
+	case pressure >= 1:
+		ls.calmSamples = 0
+		if level < LoadShedPresence {
+			level++
+		}
+	case pressure < 0.5:
+		ls.calmSamples++
+		if ls.calmSamples >= loadCalmSamples && level > LoadNormal {
+			level--
+			ls.calmSamples = 0
+		}
+	default:
+		ls.calmSamples = 0
+	}
+
+	ls.level.Store(int32(level))
+	return level
+}
+
+// loadMonitor samples Send queue depths across all connections and adjusts shedding
+func (h *WSHandler) loadMonitor() {
+	defer trackWorker("ws.loadMonitor")()
+
+	ticker := time.NewTicker(loadSampleInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		queued, capacity := 0, 0
+		h.eachConnection(func(conn *Connection) {
+			queued += len(conn.Send)
+			capacity += cap(conn.Send)
+		})
+
+		fill := 0.0
+		if capacity > 0 {
+			fill = float64(queued) / float64(capacity)
+		}
+
+		previous := h.loadShedder.Level()
+		if level := h.loadShedder.sample(fill); level != previous {
+			log.Printf("Chat load level changed from %d to %d (queue fill %.0f%%)", previous, level, fill*100)
+		}
+	}
+}
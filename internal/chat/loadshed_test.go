@@ -0,0 +1,29 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadShedderEscalatesAndRecovers(t *testing.T) {
+	ls := NewLoadShedder(50, 1000)
+	require.True(t, ls.Allows("typing"))
+
+	require.Equal(t, LoadShedTyping, ls.sample(0.6))
+	require.False(t, ls.Allows("typing"))
+	require.True(t, ls.Allows("user_joined"))
+
+	// Slow encoding counts as pressure even with empty queues
+	ls.ObserveEncode(5 * time.Millisecond)
+	require.Equal(t, LoadShedPresence, ls.sample(0))
+	require.False(t, ls.Allows("user_left"))
+	require.True(t, ls.Allows("message"))
+
+	// One level is restored per sustained calm period
+	for i := 0; i < loadCalmSamples-1; i++ {
+		require.Equal(t, LoadShedPresence, ls.sample(0))
+	}
+	require.Equal(t, LoadShedTyping, ls.sample(0))
+}
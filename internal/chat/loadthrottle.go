@@ -0,0 +1,146 @@
+package chat
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Notices broadcast to every room when the load throttle engages and lifts
+const (
+	loadThrottleOnNotice  = "Chat is in slow mode due to load."
+	loadThrottleOffNotice = "Chat is no longer in slow mode."
+)
+
+// LoadThrottle puts the whole instance into slow mode while message throughput or
+// memory use is past its threshold, so users are told why their messages are held
+// back instead of chat degrading silently. It engages on the first pressured
+// sample and lifts after a sustained calm period, like LoadShedder's levels.
+type LoadThrottle struct {
+	messagesThreshold float64       // messages per second across every room (0 = ignored)
+	memoryThreshold   float64       // share of the memory limit in use (0 = ignored)
+	interval          time.Duration // minimum gap between a user's messages while engaged
+
+	active      atomic.Bool
+	calmSamples int
+
+	mu       sync.Mutex
+	lastPost map[string]time.Time // userID -> last message while engaged
+}
+
+// NewLoadThrottle creates a throttle. It is disabled when both thresholds are 0
+// or slowModeSeconds is 0.
+func NewLoadThrottle(messagesPerSecond, memoryPercent, slowModeSeconds int) *LoadThrottle {
+	return &LoadThrottle{
+		messagesThreshold: float64(messagesPerSecond),
+		memoryThreshold:   float64(memoryPercent) / 100,
+		interval:          time.Duration(slowModeSeconds) * time.Second,
+		lastPost:          make(map[string]time.Time),
+	}
+}
+
+// enabled reports whether the throttle can ever engage
+func (lt *LoadThrottle) enabled() bool {
+	return (lt.messagesThreshold > 0 || lt.memoryThreshold > 0) && lt.interval > 0
+}
+
+// Active reports whether the instance is in slow mode due to load
+func (lt *LoadThrottle) Active() bool {
+	return lt.active.Load()
+}
+
+// sample folds one measurement period into the throttle and returns whether it is
+// engaged afterwards
+func (lt *LoadThrottle) sample(messagesPerSecond, memoryFill float64) bool {
+	pressure := 0.0
+	if lt.messagesThreshold > 0 {
+		pressure = messagesPerSecond / lt.messagesThreshold
+	}
+	if lt.memoryThreshold > 0 {
+		pressure = max(pressure, memoryFill/lt.memoryThreshold)
+	}
+
+	active := lt.Active()
+	switch {
+	case pressure >= 1:
+		lt.calmSamples = 0
+		active = true
+	case pressure < 0.8:
+		lt.calmSamples++
+		if lt.calmSamples >= loadCalmSamples && active {
+			active = false
+			lt.calmSamples = 0
+		}
+	default:
+		lt.calmSamples = 0
+	}
+
+	if !active && lt.Active() {
+		lt.mu.Lock()
+		clear(lt.lastPost)
+		lt.mu.Unlock()
+	}
+	lt.active.Store(active)
+	return active
+}
+
+// allow checks a user's message against the throttle, recording it when it is
+// allowed. It returns nil while the throttle isn't engaged.
+func (lt *LoadThrottle) allow(userID string) *ChatError {
+	if !lt.Active() {
+		return nil
+	}
+
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+
+	if last, posted := lt.lastPost[userID]; posted {
+		if wait := lt.interval - time.Since(last); wait > 0 {
+			seconds := int(lt.interval / time.Second)
+			return &ChatError{
+				Code:    CodeSlowMode,
+				Message: fmt.Sprintf("%s Try again in %d seconds.", loadThrottleOnNotice, retryAfter(wait)),
+				Details: &ErrorDetails{RetryAfterSeconds: retryAfter(wait), Limit: 1, Window: seconds, Tier: TierLoad},
+			}
+		}
+	}
+	lt.lastPost[userID] = time.Now()
+	return nil
+}
+
+// loadThrottleMonitor samples message throughput and memory use, engaging and
+// lifting the throttle and announcing each change in every room
+func (h *WSHandler) loadThrottleMonitor() {
+	defer trackWorker("ws.loadThrottleMonitor")()
+
+	ticker := time.NewTicker(loadSampleInterval)
+	defer ticker.Stop()
+
+	lastCount := h.manager.messageCount.Load()
+	for range ticker.C {
+		count := h.manager.messageCount.Load()
+		rate := float64(count-lastCount) / loadSampleInterval.Seconds()
+		lastCount = count
+		fill := h.manager.memTracker.UsagePercent() / 100
+
+		previous := h.loadThrottle.Active()
+		if active := h.loadThrottle.sample(rate, fill); active != previous {
+			log.Printf("Chat load throttle engaged: %t (%.0f messages/s, memory %.0f%%)", active, rate, fill*100)
+			h.announceLoadThrottle(active)
+		}
+	}
+}
+
+// announceLoadThrottle tells every room that slow mode due to load began or ended
+func (h *WSHandler) announceLoadThrottle(active bool) {
+	notice := loadThrottleOffNotice
+	if active {
+		notice = loadThrottleOnNotice
+	}
+
+	for _, hub := range h.allHubs() {
+		h.BroadcastSystemMessage(hub.streamKey, notice)
+	}
+}
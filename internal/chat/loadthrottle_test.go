@@ -0,0 +1,85 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadThrottleEngagesAndLifts(t *testing.T) {
+	lt := NewLoadThrottle(100, 90, 5)
+	require.True(t, lt.enabled())
+	require.Nil(t, lt.allow("alice"))
+	require.Nil(t, lt.allow("alice"))
+
+	// Either signal engages it
+	require.True(t, lt.sample(150, 0))
+	require.Nil(t, lt.allow("alice"))
+	err := lt.allow("alice")
+	require.NotNil(t, err)
+	require.Equal(t, CodeSlowMode, err.Code)
+	require.Equal(t, TierLoad, err.Details.Tier)
+	require.Nil(t, lt.allow("bob"))
+
+	require.True(t, lt.sample(0, 0.95))
+
+	// Load just under the threshold doesn't count as calm
+	for i := 0; i < loadCalmSamples; i++ {
+		require.True(t, lt.sample(90, 0))
+	}
+
+	// It lifts after a sustained calm period
+	for i := 0; i < loadCalmSamples-1; i++ {
+		require.True(t, lt.sample(0, 0))
+	}
+	require.False(t, lt.sample(0, 0))
+	require.Nil(t, lt.allow("alice"))
+
+	require.False(t, NewLoadThrottle(0, 0, 5).enabled())
+	require.False(t, NewLoadThrottle(100, 90, 0).enabled())
+}
+
+func TestLoadThrottleAnnouncesSlowMode(t *testing.T) {
+	config := DefaultConfig()
+	config.LoadThrottleMemoryPercent = 0 // sampled by hand below
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+	h := NewWSHandler(manager, NewRateLimiter(config))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/chat", h.HTTPHandler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	h.loadThrottle = NewLoadThrottle(1, 0, 60)
+	require.True(t, h.loadThrottle.sample(10, 0))
+	h.announceLoadThrottle(true)
+	notice := readUntil(t, alice, "system")
+	require.Equal(t, loadThrottleOnNotice, notice["data"].(map[string]interface{})["message"])
+
+	// Clients joining while it's engaged are told too
+	bob := dialTestClient(t, server, "room")
+	require.NoError(t, bob.WriteJSON(map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{"userId": "bob", "username": "bob"},
+	}))
+	notice = readUntil(t, bob, "system")
+	require.Equal(t, loadThrottleOnNotice, notice["data"].(map[string]interface{})["message"])
+
+	for _, text := range []string{"first", "second"} {
+		require.NoError(t, alice.WriteJSON(map[string]interface{}{
+			"type": "message",
+			"data": map[string]interface{}{"message": text},
+		}))
+	}
+	msg := readUntil(t, bob, "message")
+	require.Equal(t, "first", msg["data"].(map[string]interface{})["message"])
+	rejected := readUntil(t, alice, "error")
+	require.Equal(t, CodeSlowMode, rejected["code"])
+	require.Equal(t, TierLoad, rejected["details"].(map[string]interface{})["tier"])
+}
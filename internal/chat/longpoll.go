@@ -0,0 +1,205 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	longPollWait        = 25 * time.Second
+	longPollSessionTTL  = 60 * time.Second
+	longPollMaxBodySize = 64 * 1024
+)
+
+// pollTransport carries a Connection over HTTP long-polling. Frames stay queued
+// on the connection's Send channel until the client's next poll collects them.
+type pollTransport struct{}
+
+// Close is a no-op; pending polls notice the closed connection through Done
+func (t *pollTransport) Close(string) error {
+	return nil
+}
+
+// pollSession tracks a long-poll client between requests
+type pollSession struct {
+	conn     *Connection
+	lastSeen time.Time
+	mutex    sync.Mutex // serializes inbound messages like a WebSocket read loop would
+}
+
+// LongPollHandler serves the long-poll transport on /api/chat/poll:
+//
+//	POST   ?streamKey=<key>  open a session, returning its sessionId
+//	GET    ?session=<id>     wait for and collect pending frames
+//	POST   ?session=<id>     send a frame (same JSON as the WebSocket protocol)
+//	DELETE ?session=<id>     leave and close the session
+//
+// With room routing across instances, keep the streamKey parameter on the session
+// requests too so they reach the instance holding the session.
+func (h *WSHandler) LongPollHandler(w http.ResponseWriter, r *http.Request) {
+	sessionID := r.URL.Query().Get("session")
+	if sessionID == "" {
+		h.openPollSession(w, r)
+		return
+	}
+
+	session, exists := h.touchPollSession(sessionID)
+	if !exists {
+		http.Error(w, "Unknown or expired session", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		h.pollReceive(w, r, session)
+
+	case http.MethodPost:
+		var msg map[string]interface{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, longPollMaxBodySize)).Decode(&msg); err != nil {
+			http.Error(w, "Invalid message", http.StatusBadRequest)
+			return
+		}
+
+		session.mutex.Lock()
+		session.conn.handleMessage(msg)
+		session.mutex.Unlock()
+
+		w.WriteHeader(http.StatusAccepted)
+
+	case http.MethodDelete:
+		h.closePollSession(sessionID)
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// openPollSession creates a long-poll session for a room
+func (h *WSHandler) openPollSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.URL.Query().Get("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey parameter", http.StatusBadRequest)
+		return
+	}
+
+	ip := h.clientIP(r)
+	if err := h.admit(ip); err != nil {
+		writeChatError(w, admissionStatus(err), err)
+		return
+	}
+
+	if err := h.manager.OpenRoom(streamKey, r); err != nil {
+		h.releaseConnection(ip)
+		writeOpenRoomError(w, err)
+		return
+	}
+
+	sessionID := uuid.New().String()
+	session := &pollSession{
+		conn:     newConnection(h, streamKey, ip, &pollTransport{}),
+		lastSeen: time.Now(),
+	}
+	session.conn.statsAllowed = h.tokens.Authorized(r, ScopeReadStats)
+	session.conn.credentials = requestCredentials(r, ip)
+
+	h.pollMux.Lock()
+	h.pollSessions[sessionID] = session
+	h.pollMux.Unlock()
+
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"sessionId": sessionID,
+	})
+}
+
+// pollReceive waits for at least one frame, then returns everything queued
+func (h *WSHandler) pollReceive(w http.ResponseWriter, r *http.Request, session *pollSession) {
+	conn := session.conn
+	messages := []WSMessage{}
+
+	timer := time.NewTimer(longPollWait)
+	defer timer.Stop()
+
+	select {
+	case msg := <-conn.Send:
+		messages = append(messages, msg)
+	case <-timer.C:
+	case <-conn.Done():
+		http.Error(w, "Session closed", http.StatusGone)
+		return
+	case <-r.Context().Done():
+		return
+	}
+
+	for drained := false; !drained; {
+		select {
+		case msg := <-conn.Send:
+			messages = append(messages, msg)
+		default:
+			drained = true
+		}
+	}
+
+	writeJSON(w, http.StatusOK, messages)
+	for _, msg := range messages {
+		conn.traceWritten(msg)
+	}
+}
+
+// touchPollSession looks up a session and marks it as alive
+func (h *WSHandler) touchPollSession(sessionID string) (*pollSession, bool) {
+	h.pollMux.Lock()
+	defer h.pollMux.Unlock()
+
+	session, exists := h.pollSessions[sessionID]
+	if exists {
+		session.lastSeen = time.Now()
+	}
+	return session, exists
+}
+
+// closePollSession removes a session, leaves its room and frees its connection
+// slots
+func (h *WSHandler) closePollSession(sessionID string) {
+	h.pollMux.Lock()
+	session, exists := h.pollSessions[sessionID]
+	delete(h.pollSessions, sessionID)
+	h.pollMux.Unlock()
+
+	if exists {
+		session.conn.cleanup()
+		h.releaseConnection(session.conn.RemoteAddr)
+	}
+}
+
+// pollJanitor closes sessions whose clients stopped polling
+func (h *WSHandler) pollJanitor() {
+	defer trackWorker("ws.pollJanitor")()
+
+	ticker := time.NewTicker(longPollSessionTTL / 4)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.pollMux.Lock()
+		expired := []string{}
+		for sessionID, session := range h.pollSessions {
+			if time.Since(session.lastSeen) > longPollSessionTTL {
+				expired = append(expired, sessionID)
+			}
+		}
+		h.pollMux.Unlock()
+
+		for _, sessionID := range expired {
+			h.closePollSession(sessionID)
+		}
+	}
+}
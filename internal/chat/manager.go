@@ -2,7 +2,9 @@ package chat
 
 import (
 	"log"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/google/uuid"
@@ -11,11 +13,37 @@ import (
 // Manager handles all chat rooms and global operations
 type Manager struct {
 	config       *ChatConfig
-	rooms        map[string]*ChatRoom
-	roomsMux     sync.RWMutex
+	shards       []*roomShard // rooms by stream key hash
 	memTracker   *MemoryTracker
+	membership   *MembershipTracker
+	streamLookup StreamLookup // nil allows chat for any stream key
+	roomPolicy   RoomPolicy   // nil lets any stream key create a room
+	historyStore HistoryStore // nil keeps history per instance
+	messageStore MessageStore // nil keeps messages in the room buffers only
+	rateLimiter  *RateLimiter // nil leaves rate records out of the memory stats
+	hooksMux     sync.RWMutex // guards streamLookup, roomPolicy, historyStore, messageStore and rateLimiter
+	userStats    *UserStatsStore
+	replay       *ReplayStore
+	archiver     *chatArchiver // nil when archival is off
+	settings     *streamSettingsStore
+	profiles     *MemoryStore // keeps user profiles when the message store can't
+	messageCount atomic.Int64 // messages posted since startup
+	wheel        *timerWheel  // room inactivity and purge deadlines
 	stopCleanup  chan bool
 	stopMonitor  chan bool
+
+	stopUserStats chan bool
+	stopReplay    chan bool
+	stopArchive   chan bool
+
+	storage     *storageMonitor // health of the message and history stores
+	stopStorage chan bool
+}
+
+// deletedRoom is an inactive room kept around so a returning stream can restore it
+type deletedRoom struct {
+	room      *ChatRoom
+	deletedAt time.Time
 }
 
 // NewManager creates a new chat manager
@@ -25,31 +53,124 @@ func NewManager(config *ChatConfig) *Manager {
 	}
 
 	manager := &Manager{
-		config:      config,
-		rooms:       make(map[string]*ChatRoom),
-		memTracker:  NewMemoryTracker(config.MaxTotalMemoryMB),
-		stopCleanup: make(chan bool),
-		stopMonitor: make(chan bool),
+		config:       config,
+		shards:       newRoomShards(),
+		memTracker:   NewMemoryTracker(config.MaxTotalMemoryMB),
+		membership:   NewMembershipTracker(config.MaxRoomsPerUser, config.MaxJoinsPerMinute),
+		userStats:    NewUserStatsStore(config.StatsDir),
+		replay:       NewReplayStore(config.ReplayDir),
+		archiver:     newConfiguredArchiver(config),
+		settings:     newStreamSettingsStore(),
+		profiles:     NewMemoryStore(),
+		wheel:        newTimerWheel(time.Second),
+		stopCleanup:  make(chan bool),
+		stopMonitor:  make(chan bool),
+
+		stopUserStats: make(chan bool),
+		stopReplay:    make(chan bool),
+		stopArchive:   make(chan bool),
+
+		storage:     newStorageMonitor(),
+		stopStorage: make(chan bool),
 	}
 
 	// Start background jobs
+	go manager.wheel.run()
 	go manager.cleanupWorker()
 	go manager.monitorWorker()
+	go manager.userStatsWorker()
+	if manager.replay.Enabled() {
+		go manager.replayWorker()
+	}
+	if manager.archiver != nil && config.ArchiveIntervalMinutes > 0 {
+		go manager.archiveWorker()
+	}
+	if config.StorageCheckIntervalSeconds > 0 {
+		go manager.storageHealthWorker()
+	}
 
 	return manager
 }
 
+// StreamLookup reports whether a stream key is currently live
+type StreamLookup func(streamKey string) bool
+
+// SetStreamLookup restricts chat to streams the lookup reports as live. Joining or
+// sending to any other stream fails with ErrStreamNotFound, or ErrStreamEnded when
+// the stream had a room.
+func (m *Manager) SetStreamLookup(lookup StreamLookup) {
+	m.hooksMux.Lock()
+	defer m.hooksMux.Unlock()
+
+	m.streamLookup = lookup
+}
+
+// checkStream returns an error if the streamer turned chat off, or if chat is
+// restricted to live streams and this one isn't
+func (m *Manager) checkStream(streamKey string) error {
+	if !m.settings.get(streamKey).ChatEnabled {
+		return ErrChatDisabled
+	}
+
+	m.hooksMux.RLock()
+	lookup := m.streamLookup
+	m.hooksMux.RUnlock()
+
+	if lookup == nil || lookup(streamKey) {
+		return nil
+	}
+
+	if m.hasRoom(streamKey) {
+		return ErrStreamEnded
+	}
+	return ErrStreamNotFound
+}
+
 // GetOrCreateRoom gets an existing room or creates a new one
 func (m *Manager) GetOrCreateRoom(streamKey string) *ChatRoom {
-	m.roomsMux.Lock()
-	defer m.roomsMux.Unlock()
+	shard := m.shard(streamKey)
+	shard.mutex.RLock()
+	room, exists := shard.rooms[streamKey]
+	shard.mutex.RUnlock()
+	if exists {
+		return room
+	}
 
-	if room, exists := m.rooms[streamKey]; exists {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if room, exists := shard.rooms[streamKey]; exists {
 		return room
 	}
 
-	room := NewChatRoom(streamKey, m.config.MaxMessagesPerStream)
-	m.rooms[streamKey] = room
+	// Restore a soft-deleted room with its history intact
+	if deleted, exists := shard.deletedRooms[streamKey]; exists {
+		delete(shard.deletedRooms, streamKey)
+		m.wheel.Cancel("purge:" + streamKey)
+		shard.rooms[streamKey] = deleted.room
+
+		deleted.room.MessagesMux.Lock()
+		deleted.room.LastActivity = time.Now()
+		deleted.room.chatDisabled = !m.settings.get(streamKey).ChatEnabled
+		deleted.room.MessagesMux.Unlock()
+
+		m.scheduleExpiry(streamKey, time.Now().Add(m.config.InactiveStreamTimeout))
+		log.Printf("Restored chat room for stream: %s", streamKey)
+		return deleted.room
+	}
+
+	minMessages, retention := m.roomLimits(streamKey)
+	room = NewAutoSizedChatRoom(streamKey, minMessages, m.historyLimit(streamKey, 0), retention)
+	if m.config.BufferMode == BufferSlab {
+		room.Messages = NewSlabBuffer(room.minMessages, slabSlotBytes(m.config))
+	}
+	room.store = m.persistence()
+	room.chatDisabled = !m.settings.get(streamKey).ChatEnabled
+	shard.rooms[streamKey] = room
+	m.scheduleExpiry(streamKey, time.Now().Add(m.config.InactiveStreamTimeout))
+	if _, ok := room.store.(RoomStore); ok {
+		go room.saveState()
+	}
 
 	log.Printf("Created chat room for stream: %s", streamKey)
 	return room
@@ -57,18 +178,51 @@ func (m *Manager) GetOrCreateRoom(streamKey string) *ChatRoom {
 
 // GetRoom gets an existing room
 func (m *Manager) GetRoom(streamKey string) (*ChatRoom, bool) {
-	m.roomsMux.RLock()
-	defer m.roomsMux.RUnlock()
+	shard := m.shard(streamKey)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
 
-	room, exists := m.rooms[streamKey]
+	room, exists := shard.rooms[streamKey]
 	return room, exists
 }
 
 // AddMessage adds a message to a room
 func (m *Manager) AddMessage(streamKey, userID, username, message string) (*ChatMessage, error) {
-	room := m.GetOrCreateRoom(streamKey)
+	msg := newChatMessage(streamKey, userID, username, message)
+	if err := m.addMessage(msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// addMessage stores a message built by the caller, keeping its ID and origin
+func (m *Manager) addMessage(msg *ChatMessage) error {
+	if err := m.checkStream(msg.StreamKey); err != nil {
+		return err
+	}
+
+	room, err := m.roomForWrite(msg.StreamKey)
+	if err != nil {
+		return err
+	}
+
+	if err := room.allowPost(msg.UserID, msg.Message); err != nil {
+		return err
+	}
+
+	msg.Seq = room.AddMessage(*msg)
+	m.appendSharedHistory(*msg)
+	m.userStats.Record(*msg)
+	if startedAt, live := room.session(); live {
+		m.replay.Record(*msg, startedAt)
+	}
+	m.messageCount.Add(1)
+	return nil
+}
 
-	msg := &ChatMessage{
+// newChatMessage builds a message with a fresh ID and timestamp without storing it
+func newChatMessage(streamKey, userID, username, message string) *ChatMessage {
+	return &ChatMessage{
 		ID:        uuid.New().String(),
 		StreamKey: streamKey,
 		UserID:    userID,
@@ -76,18 +230,46 @@ func (m *Manager) AddMessage(streamKey, userID, username, message string) (*Chat
 		Message:   message,
 		Timestamp: time.Now(),
 	}
-
-	room.AddMessage(*msg)
-	return msg, nil
 }
 
-// AddUser adds a user to a room
+// AddUser adds a connection of a user to a room
 func (m *Manager) AddUser(streamKey, userID, username string) error {
-	room := m.GetOrCreateRoom(streamKey)
+	_, _, err := m.joinUser(streamKey, userID, username, nil)
+	return err
+}
+
+// joinUser adds a connection of a user to a room. A user already in the room
+// through another connection isn't counted against the room's limits again; first
+// reports whether this is the user's first connection there. name is the username
+// the user has in the room, which is numbered if another user's looks the same.
+func (m *Manager) joinUser(streamKey, userID, username string, roles []string) (name string, first bool, err error) {
+	if err := m.checkStream(streamKey); err != nil {
+		return "", false, err
+	}
+
+	room, err := m.roomForWrite(streamKey)
+	if err != nil {
+		return "", false, err
+	}
+
+	if username, err = room.claimUsername(userID, username, m.config.UsernameCollision); err != nil {
+		return "", false, err
+	}
+
+	if room.addSession(userID, username) {
+		return username, false, nil
+	}
 
 	// Check user limit
 	if room.UserCount() >= m.config.MaxUsersPerStream {
-		return ErrRoomFull
+		room.releaseUsername(userID, username)
+		return "", false, ErrRoomFull
+	}
+
+	// Check per-user membership limits
+	if err := m.membership.Join(userID, streamKey); err != nil {
+		room.releaseUsername(userID, username)
+		return "", false, err
 	}
 
 	user := &ChatUser{
@@ -95,26 +277,51 @@ func (m *Manager) AddUser(streamKey, userID, username string) error {
 		Username:    username,
 		ConnectedAt: time.Now(),
 		IsActive:    true,
+		Roles:       roles,
 	}
+	user.applyProfile(m.profileFor(userID))
 
-	room.AddUser(user)
+	if !room.AddUser(user) {
+		// Another connection of the user got in first and holds the membership
+		m.membership.Leave(userID, streamKey)
+		return username, false, nil
+	}
 	log.Printf("User %s (%s) joined room: %s", username, userID, streamKey)
-	return nil
+	return username, true, nil
 }
 
-// RemoveUser removes a user from a room
+// RemoveUser removes a connection of a user from a room
 func (m *Manager) RemoveUser(streamKey, userID string) {
+	m.leaveUser(streamKey, userID)
+}
+
+// leaveUser removes a connection of a user from a room, reporting whether it was
+// the user's last one there
+func (m *Manager) leaveUser(streamKey, userID string) bool {
 	room, exists := m.GetRoom(streamKey)
 	if !exists {
-		return
+		m.membership.Leave(userID, streamKey)
+		return true
 	}
 
-	room.RemoveUser(userID)
+	if !room.RemoveUser(userID) {
+		return false
+	}
+	m.membership.Leave(userID, streamKey)
+
+	if room.UserCount() == 0 {
+		m.scheduleExpiry(streamKey, time.Now().Add(m.config.InactiveStreamTimeout))
+	}
 	log.Printf("User %s left room: %s", userID, streamKey)
+	return true
 }
 
-// GetMessages gets messages from a room
+// GetMessages gets messages from a room, from the shared history when one is set
 func (m *Manager) GetMessages(streamKey string, recentN int) []ChatMessage {
+	if messages, ok := m.sharedMessages(streamKey, recentN); ok {
+		return messages
+	}
+
 	room, exists := m.GetRoom(streamKey)
 	if !exists {
 		return []ChatMessage{}
@@ -123,6 +330,39 @@ func (m *Manager) GetMessages(streamKey string, recentN int) []ChatMessage {
 	return room.GetMessages(recentN)
 }
 
+// GetMessagesAfter gets the messages numbered after seq from a room; see ChatRoom.GetMessagesAfter
+func (m *Manager) GetMessagesAfter(streamKey string, seq int64, limit int) ([]ChatMessage, bool) {
+	room, exists := m.GetRoom(streamKey)
+	if !exists {
+		return []ChatMessage{}, seq == 0
+	}
+
+	return room.GetMessagesAfter(seq, limit)
+}
+
+// GetMessagesBefore gets a page of messages older than beforeID, oldest first
+func (m *Manager) GetMessagesBefore(streamKey, beforeID string, limit int) ([]ChatMessage, bool, error) {
+	room, exists := m.GetRoom(streamKey)
+	if !exists {
+		if beforeID != "" {
+			if messages, hasMore, found := m.sharedMessagesBefore(streamKey, beforeID, limit); found {
+				return messages, hasMore, nil
+			}
+			return nil, false, ErrCursorNotFound
+		}
+		return []ChatMessage{}, false, nil
+	}
+
+	messages, hasMore, found := room.GetMessagesBefore(beforeID, limit)
+	if !found {
+		if messages, hasMore, found = m.sharedMessagesBefore(streamKey, beforeID, limit); !found {
+			return nil, false, ErrCursorNotFound
+		}
+	}
+
+	return messages, hasMore, nil
+}
+
 // GetUsers gets all users in a room
 func (m *Manager) GetUsers(streamKey string) []*ChatUser {
 	room, exists := m.GetRoom(streamKey)
@@ -145,6 +385,8 @@ func (m *Manager) GetUserCount(streamKey string) int {
 
 // cleanupWorker runs periodic cleanup tasks
 func (m *Manager) cleanupWorker() {
+	defer trackWorker("manager.cleanup")()
+
 	ticker := time.NewTicker(time.Duration(m.config.CleanupIntervalMinutes) * time.Minute)
 	defer ticker.Stop()
 
@@ -158,39 +400,94 @@ func (m *Manager) cleanupWorker() {
 	}
 }
 
-// performCleanup cleans up old messages and inactive rooms
+// performCleanup trims old messages from every room, one shard at a time. Inactive
+// rooms are deleted and purged by their deadlines on the timer wheel instead.
 func (m *Manager) performCleanup() {
-	m.roomsMux.Lock()
-	defer m.roomsMux.Unlock()
+	totalRemoved := 0
+	for _, shard := range m.shards {
+		totalRemoved += m.cleanupShard(shard)
+	}
+
+	m.membership.Cleanup()
+
+	if totalRemoved > 0 {
+		log.Printf("Cleanup: Removed %d messages", totalRemoved)
+	}
+}
+
+// cleanupShard trims one shard's rooms, returning the messages removed
+func (m *Manager) cleanupShard(shard *roomShard) int {
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
 
-	retention := time.Duration(m.config.MessageRetentionMinutes) * time.Minute
 	totalRemoved := 0
-	roomsToDelete := []string{}
 
-	for streamKey, room := range m.rooms {
+	for _, room := range shard.rooms {
 		// Clean old messages
-		removed := room.CleanupOldMessages(retention)
-		totalRemoved += removed
+		totalRemoved += room.CleanupOldMessages(room.Retention())
 
-		// Mark empty rooms for deletion
-		if room.UserCount() == 0 && time.Since(room.LastActivity) > m.config.InactiveStreamTimeout {
-			roomsToDelete = append(roomsToDelete, streamKey)
-		}
+		// Give back buffer space rooms no longer need
+		room.ShrinkBuffer()
+	}
+
+	return totalRemoved
+}
+
+// scheduleExpiry checks a room for deletion at the given time
+func (m *Manager) scheduleExpiry(streamKey string, at time.Time) {
+	m.wheel.Schedule("inactive:"+streamKey, at, func() { m.expireRoom(streamKey) })
+}
+
+// expireRoom deletes a room that has been empty and inactive for the
+// InactiveStreamTimeout, or checks again once it could have been. Rooms with users
+// are checked again when the last one leaves.
+func (m *Manager) expireRoom(streamKey string) {
+	shard := m.shard(streamKey)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	room, exists := shard.rooms[streamKey]
+	if !exists || room.UserCount() > 0 {
+		return
+	}
+	if idleUntil := room.LastActivity.Add(m.config.InactiveStreamTimeout); time.Now().Before(idleUntil) {
+		m.scheduleExpiry(streamKey, idleUntil)
+		return
 	}
 
-	// Delete inactive rooms
-	for _, streamKey := range roomsToDelete {
-		delete(m.rooms, streamKey)
-		log.Printf("Deleted inactive room: %s", streamKey)
+	// Soft-delete the room, or delete it outright when there is no grace period
+	if gracePeriod := time.Duration(m.config.RoomDeletionGraceMinutes) * time.Minute; gracePeriod > 0 {
+		deleted := &deletedRoom{room: room, deletedAt: time.Now()}
+		shard.deletedRooms[streamKey] = deleted
+		m.wheel.Schedule("purge:"+streamKey, deleted.deletedAt.Add(gracePeriod), func() { m.purgeRoom(streamKey, deleted) })
+	} else {
+		m.forgetRoomState(streamKey)
 	}
+	delete(shard.rooms, streamKey)
+	if m.archiver != nil {
+		m.archiver.finish(room)
+	}
+	log.Printf("Deleted inactive room: %s", streamKey)
+}
 
-	if totalRemoved > 0 || len(roomsToDelete) > 0 {
-		log.Printf("Cleanup: Removed %d messages, deleted %d rooms", totalRemoved, len(roomsToDelete))
+// purgeRoom drops a soft-deleted room whose restore window has passed, unless it
+// was restored or purged meanwhile
+func (m *Manager) purgeRoom(streamKey string, deleted *deletedRoom) {
+	shard := m.shard(streamKey)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	if shard.deletedRooms[streamKey] == deleted {
+		delete(shard.deletedRooms, streamKey)
+		m.forgetRoomState(streamKey)
+		log.Printf("Purged deleted room: %s", streamKey)
 	}
 }
 
 // monitorWorker monitors memory usage
 func (m *Manager) monitorWorker() {
+	defer trackWorker("manager.monitor")()
+
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
 
@@ -198,6 +495,7 @@ func (m *Manager) monitorWorker() {
 		select {
 		case <-ticker.C:
 			m.updateMemoryStats()
+			m.rescaleHistory()
 		case <-m.stopMonitor:
 			return
 		}
@@ -206,18 +504,10 @@ func (m *Manager) monitorWorker() {
 
 // updateMemoryStats updates memory tracking statistics
 func (m *Manager) updateMemoryStats() {
-	m.roomsMux.RLock()
-	defer m.roomsMux.RUnlock()
+	usage, totalMessages, liveRooms := m.memoryUsage()
 
-	var totalBytes int64
-	var totalMessages int64
-
-	for _, room := range m.rooms {
-		totalBytes += room.BytesUsed
-		totalMessages += room.MessageCount
-	}
-
-	m.memTracker.Update(totalBytes, totalMessages, len(m.rooms))
+	m.memTracker.Update(usage, totalMessages, liveRooms)
+	totalBytes := usage.Total()
 
 	// Log warnings if approaching limits
 	if m.memTracker.IsCritical() {
@@ -230,69 +520,153 @@ func (m *Manager) updateMemoryStats() {
 	}
 }
 
+// memoryUsage adds up the memory held by every room and the rate limiter, along
+// with the messages posted to live rooms and how many there are
+func (m *Manager) memoryUsage() (usage MemoryUsage, totalMessages int64, liveRooms int) {
+
+	for _, shard := range m.shards {
+		shard.mutex.RLock()
+		for _, room := range shard.rooms {
+			usage.MessageBytes += room.Messages.Bytes()
+			usage.UserBytes += room.UserBytes()
+			totalMessages += room.MessageCount
+		}
+
+		// Soft-deleted rooms still hold their history in memory
+		for _, deleted := range shard.deletedRooms {
+			usage.MessageBytes += deleted.room.Messages.Bytes()
+		}
+		liveRooms += len(shard.rooms)
+		shard.mutex.RUnlock()
+	}
+	usage.RateLimiterBytes = m.rateLimiterBytes()
+
+	return usage, totalMessages, liveRooms
+}
+
 // performEmergencyCleanup performs aggressive cleanup when memory is critical
 func (m *Manager) performEmergencyCleanup() {
-	m.roomsMux.Lock()
-	defer m.roomsMux.Unlock()
-
 	log.Println("Performing emergency cleanup...")
 
-	// Reduce retention to 10 minutes for all rooms
-	emergencyRetention := 10 * time.Minute
-	totalRemoved := 0
+	// Give up on restoring soft-deleted rooms before touching live ones
+	purged := []string{}
+	for _, shard := range m.shards {
+		shard.mutex.Lock()
+		for streamKey := range shard.deletedRooms {
+			purged = append(purged, streamKey)
+		}
+		shard.deletedRooms = make(map[string]*deletedRoom)
+		shard.mutex.Unlock()
+	}
+	for _, streamKey := range purged {
+		m.forgetRoomState(streamKey)
+	}
+	if len(purged) > 0 {
+		log.Printf("Emergency cleanup: Purged %d deleted rooms", len(purged))
+	}
 
-	for _, room := range m.rooms {
-		removed := room.CleanupOldMessages(emergencyRetention)
-		totalRemoved += removed
+	// Free what's still over the target from the rooms holding the most, longest
+	usage, _, _ := m.memoryUsage()
+	excess := usage.Total() - int64(float64(m.memTracker.MaxBytes)*emergencyTarget)
+	if excess <= 0 {
+		return
 	}
 
-	log.Printf("Emergency cleanup: Removed %d messages", totalRemoved)
+	freed, removed, rooms := m.evictForMemory(excess)
+	log.Printf("Emergency cleanup: Removed %d messages from %d rooms, freeing %d KB", removed, rooms, freed/1024)
 }
 
 // GetStats returns current chat statistics
 func (m *Manager) GetStats() map[string]interface{} {
-	m.roomsMux.RLock()
-	defer m.roomsMux.RUnlock()
-
+	rooms := m.liveRooms()
 	totalUsers := 0
 	totalMessages := 0
 
-	for _, room := range m.rooms {
+	for _, room := range rooms {
 		totalUsers += room.UserCount()
 		totalMessages += room.Messages.Size()
 	}
 
 	stats := map[string]interface{}{
-		"total_rooms":    len(m.rooms),
+		"total_rooms":    len(rooms),
 		"total_users":    totalUsers,
 		"total_messages": totalMessages,
 		"memory":         m.memTracker.GetStats(),
 		"config":         m.config.CalculateCapacity(),
+		"storage":        m.StorageHealth(),
 	}
 
 	return stats
 }
 
-// Stop stops all background workers
-func (m *Manager) Stop() {
-	close(m.stopCleanup)
-	close(m.stopMonitor)
-	log.Println("Chat manager stopped")
+// RoomSummary is an administrative snapshot of a room
+type RoomSummary struct {
+	StreamKey      string    `json:"streamKey"`
+	Users          int       `json:"users"`
+	Messages       int       `json:"messages"`
+	BufferCapacity int       `json:"bufferCapacity"`
+	TotalMessages  int64     `json:"totalMessages"`
+	BytesUsed      int64     `json:"bytesUsed"`
+	LastActivity   time.Time `json:"lastActivity"`
+	Modes          RoomModes `json:"modes"`
+	ChatEnabled    bool      `json:"chatEnabled"`
 }
 
-// Error definitions
-var (
-	ErrRoomFull = &ChatError{Code: "ROOM_FULL", Message: "Chat room is full"}
-	ErrTimeout  = &ChatError{Code: "TIMEOUT", Message: "You are timed out from chat"}
-	ErrRateLimit = &ChatError{Code: "RATE_LIMIT", Message: "You are sending messages too quickly"}
-)
+// RoomSummaries returns a snapshot of every live room
+func (m *Manager) RoomSummaries() []RoomSummary {
+	rooms := m.liveRooms()
+
+	summaries := make([]RoomSummary, 0, len(rooms))
+	for _, room := range rooms {
+		room.MessagesMux.RLock()
+		summary := RoomSummary{
+			StreamKey:      room.StreamKey,
+			Messages:       room.Messages.Size(),
+			BufferCapacity: room.Messages.Capacity(),
+			TotalMessages:  room.MessageCount,
+			LastActivity:   room.LastActivity,
+		}
+		room.MessagesMux.RUnlock()
+
+		summary.BytesUsed = room.BytesUsed()
+		summary.Users = room.UserCount()
+		summary.Modes = room.Modes()
+		summary.ChatEnabled = m.settings.get(room.StreamKey).ChatEnabled
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].StreamKey < summaries[j].StreamKey })
+	return summaries
+}
+
+// ClearRoom removes a room's buffered messages
+func (m *Manager) ClearRoom(streamKey string) (int, error) {
+	room, exists := m.GetRoom(streamKey)
+	if !exists {
+		return 0, ErrRoomNotFound
+	}
 
-// ChatError represents a chat error
-type ChatError struct {
-	Code    string
-	Message string
+	removed := room.ClearMessages()
+	if store := m.sharedHistory(); store != nil {
+		if err := store.Clear(streamKey); err != nil {
+			log.Printf("Failed to clear shared chat history for %s: %v", streamKey, err)
+		}
+	}
+	if startedAt, live := room.session(); live {
+		m.replay.RecordClear(streamKey, startedAt)
+	}
+	log.Printf("Cleared %d messages from room: %s", removed, streamKey)
+	return removed, nil
 }
 
-func (e *ChatError) Error() string {
-	return e.Message
+// Stop stops all background workers
+func (m *Manager) Stop() {
+	m.wheel.Stop()
+	close(m.stopCleanup)
+	close(m.stopMonitor)
+	close(m.stopUserStats)
+	close(m.stopReplay)
+	close(m.stopArchive)
+	close(m.stopStorage)
+	log.Println("Chat manager stopped")
 }
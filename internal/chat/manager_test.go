@@ -0,0 +1,279 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagerStreamLookup(t *testing.T) {
+	m := NewManager(DefaultConfig())
+	t.Cleanup(m.Stop)
+
+	live := map[string]bool{"live": true}
+	m.SetStreamLookup(func(streamKey string) bool { return live[streamKey] })
+
+	require.Equal(t, ErrStreamNotFound, m.AddUser("random", "alice", "alice"))
+	_, exists := m.GetRoom("random")
+	require.False(t, exists, "rejected stream keys must not create rooms")
+
+	require.NoError(t, m.AddUser("live", "alice", "alice"))
+	_, err := m.AddMessage("live", "alice", "alice", "hi")
+	require.NoError(t, err)
+
+	live["live"] = false
+	_, err = m.AddMessage("live", "alice", "alice", "still there?")
+	require.Equal(t, ErrStreamEnded, err)
+}
+
+func TestManagerRoomPolicy(t *testing.T) {
+	m := NewManager(DefaultConfig())
+	t.Cleanup(m.Stop)
+
+	denied := errors.New("stream has no chat")
+	m.SetRoomPolicy(RoomPolicyFunc(func(streamKey string, r *http.Request) error {
+		if streamKey == "allowed" {
+			return nil
+		}
+		return denied
+	}))
+
+	require.Equal(t, denied, m.OpenRoom("random", nil))
+	require.Equal(t, ErrRoomNotAllowed, m.AddUser("random", "alice", "alice"))
+	_, err := m.AddMessage("random", "alice", "alice", "hi")
+	require.Equal(t, ErrRoomNotAllowed, err)
+	_, exists := m.GetRoom("random")
+	require.False(t, exists, "refused stream keys must not create rooms")
+
+	require.NoError(t, m.OpenRoom("allowed", nil))
+	require.NoError(t, m.AddUser("allowed", "alice", "alice"))
+	_, err = m.AddMessage("allowed", "alice", "alice", "hi")
+	require.NoError(t, err)
+}
+
+func TestRoomModes(t *testing.T) {
+	m := NewManager(DefaultConfig())
+	t.Cleanup(m.Stop)
+
+	room := m.GetOrCreateRoom("room")
+	room.SetModes(RoomModes{SlowModeSeconds: 30})
+
+	_, err := m.AddMessage("room", "alice", "alice", "first")
+	require.NoError(t, err)
+	_, err = m.AddMessage("room", "alice", "alice", "second")
+	require.ErrorContains(t, err, ErrSlowMode.Message)
+	_, err = m.AddMessage("room", "bob", "bob", "hi")
+	require.NoError(t, err, "slow mode is per user")
+
+	room.SetModes(RoomModes{ReadOnly: true})
+	_, err = m.AddMessage("room", "bob", "bob", "hello?")
+	require.Equal(t, ErrRoomReadOnly, err)
+
+	room.SetModes(RoomModes{EmoteOnly: true})
+	_, err = m.AddMessage("room", "bob", "bob", "hello?")
+	require.Equal(t, ErrEmoteOnly, err)
+	_, err = m.AddMessage("room", "bob", "bob", ":pog: 👍🏽 ❤️")
+	require.NoError(t, err)
+
+	require.Error(t, RoomModes{SlowModeSeconds: -1}.Validate())
+}
+
+func TestManagerSpreadsRoomsOverShards(t *testing.T) {
+	m := NewManager(DefaultConfig())
+	t.Cleanup(m.Stop)
+
+	used := map[*roomShard]bool{}
+	for i := 0; i < 200; i++ {
+		streamKey := fmt.Sprintf("stream-%d", i)
+		m.GetOrCreateRoom(streamKey)
+		used[m.shard(streamKey)] = true
+	}
+
+	require.Greater(t, len(used), roomShardCount/2)
+	require.Len(t, m.RoomSummaries(), 200)
+	require.Equal(t, 200, m.Diagnostics().Rooms)
+
+	room, exists := m.GetRoom("stream-42")
+	require.True(t, exists)
+	require.Equal(t, "stream-42", room.StreamKey)
+}
+
+func TestManagerMemoryStats(t *testing.T) {
+	config := DefaultConfig()
+	m := NewManager(config)
+	t.Cleanup(m.Stop)
+	rl := NewRateLimiter(config)
+	t.Cleanup(rl.Stop)
+	m.SetRateLimiter(rl)
+
+	require.NoError(t, m.AddUser("room", "alice", "Alice"))
+	_, err := m.AddMessage("room", "alice", "Alice", "hello")
+	require.NoError(t, err)
+	allowed, _ := rl.CheckMessage("alice", "hello")
+	require.True(t, allowed)
+
+	room, _ := m.GetRoom("room")
+	user, _ := room.GetUser("alice")
+	m.updateMemoryStats()
+
+	usage := m.memTracker.Usage
+	require.Equal(t, room.Messages.Bytes(), usage.MessageBytes)
+	require.Equal(t, user.size(), usage.UserBytes)
+	require.Equal(t, rl.MemoryUsage(), usage.RateLimiterBytes)
+	require.Positive(t, usage.RateLimiterBytes)
+	require.Equal(t, usage.Total(), m.GetStats()["memory"].(map[string]interface{})["total_bytes"])
+
+	// Clearing the room gives back what its messages held
+	_, err = m.ClearRoom("room")
+	require.NoError(t, err)
+	m.updateMemoryStats()
+	require.Equal(t, int64(room.Messages.Capacity())*messageSlotSize, m.memTracker.Usage.MessageBytes)
+}
+
+func TestEmergencyCleanupTrimsLargeIdleRoomsFirst(t *testing.T) {
+	m := NewManager(DefaultConfig())
+	t.Cleanup(m.Stop)
+
+	long := strings.Repeat("x", 1000)
+	for i := 0; i < 200; i++ {
+		_, err := m.AddMessage("big", "alice", "Alice", long)
+		require.NoError(t, err)
+	}
+	for i := 0; i < 2; i++ {
+		_, err := m.AddMessage("small", "bob", "Bob", "hi")
+		require.NoError(t, err)
+	}
+	big, _ := m.GetRoom("big")
+	small, _ := m.GetRoom("small")
+	big.MessagesMux.Lock()
+	big.LastActivity = time.Now().Add(-time.Hour)
+	big.MessagesMux.Unlock()
+	require.Equal(t, 200, big.Messages.Capacity())
+
+	// Over the target by a quarter of what the big room holds
+	usage, _, _ := m.memoryUsage()
+	m.memTracker.MaxBytes = int64(float64(usage.Total()-big.Messages.Bytes()/4) / emergencyTarget)
+	m.performEmergencyCleanup()
+
+	require.Equal(t, 100, big.Messages.Size())
+	require.Equal(t, 100, big.Messages.Capacity())
+	require.Equal(t, 2, small.Messages.Size())
+
+	usage, _, _ = m.memoryUsage()
+	require.LessOrEqual(t, float64(usage.Total()), float64(m.memTracker.MaxBytes)*emergencyTarget)
+}
+
+func TestPopularRoomsKeepMoreHistory(t *testing.T) {
+	config := DefaultConfig()
+	config.MessagesPerViewer = 10
+	config.MessageRetentionMinutes = 60
+	m := NewManager(config)
+	t.Cleanup(m.Stop)
+
+	room := m.GetOrCreateRoom("room")
+	m.SetViewerCount("room", 20)
+	require.Equal(t, 500, room.MaxMessages())
+	m.SetViewerCount("room", 150)
+	require.Equal(t, 1500, room.MaxMessages())
+	m.SetViewerCount("room", 500)
+	require.Equal(t, 2000, room.MaxMessages())
+
+	m.SetViewerCount("room", 150)
+	for i := 0; i < 1000; i++ {
+		room.AddMessage(ChatMessage{ID: fmt.Sprint(i), Timestamp: time.Now()})
+	}
+	require.Equal(t, 1000, room.Messages.Size())
+
+	// Near the memory limit every room falls back to the per-stream maximum
+	m.memTracker.Update(MemoryUsage{MessageBytes: m.memTracker.MaxBytes * 85 / 100}, 0, 1)
+	m.rescaleHistory()
+	require.Equal(t, 500, room.MaxMessages())
+	require.Equal(t, 500, room.Messages.Capacity())
+	require.Equal(t, "999", room.GetMessages(1)[0].ID)
+
+	m.memTracker.Update(MemoryUsage{}, 0, 1)
+	m.rescaleHistory()
+	require.Equal(t, 1500, room.MaxMessages())
+}
+
+func TestRetentionPolicyOverridesServerSettings(t *testing.T) {
+	m := NewManager(DefaultConfig())
+	t.Cleanup(m.Stop)
+
+	room := m.GetOrCreateRoom("room")
+	for i := 0; i < 100; i++ {
+		room.AddMessage(ChatMessage{ID: fmt.Sprint(i), Timestamp: time.Now().Add(-time.Duration(100-i) * time.Minute / 10)})
+	}
+
+	// A smaller limit than the server's minimum trims the room at once
+	require.NoError(t, m.SetRetentionPolicy("room", RetentionPolicy{RetentionMinutes: 5, MaxMessages: 20}))
+	require.Equal(t, 20, room.MaxMessages())
+	require.Equal(t, 5*time.Minute, room.Retention())
+	messages := room.GetMessages(0)
+	require.Len(t, messages, 20)
+	require.Equal(t, "99", messages[19].ID)
+
+	// Overrides are capped at what popular rooms may hold
+	require.NoError(t, m.SetRetentionPolicy("room", RetentionPolicy{MaxMessages: 1_000_000}))
+	require.Equal(t, 2000, room.MaxMessages())
+	require.Equal(t, 30*time.Minute, room.Retention())
+
+	// Rooms created later start with their stream's policy
+	require.NoError(t, m.SetRetentionPolicy("later", RetentionPolicy{RetentionMinutes: 120}))
+	require.Equal(t, 2*time.Hour, m.GetOrCreateRoom("later").Retention())
+
+	require.Error(t, m.SetRetentionPolicy("room", RetentionPolicy{MaxMessages: -1}))
+	require.NoError(t, m.SetRetentionPolicy("room", RetentionPolicy{}))
+	require.Equal(t, 500, room.MaxMessages())
+	require.Equal(t, defaultStreamSettings, m.StreamSettings("room"))
+}
+
+func TestSoftDeletedRoomsRestoreUntilPurged(t *testing.T) {
+	config := DefaultConfig()
+	config.RoomDeletionGraceMinutes = 30
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+	manager.wheel.Stop()
+	store := NewMemoryStore()
+	manager.SetMessageStore(store)
+
+	savedRooms := func() int {
+		saved, err := store.LoadRooms()
+		require.NoError(t, err)
+		return len(saved)
+	}
+	expire := func(room *ChatRoom) time.Time {
+		start := time.Now()
+		room.MessagesMux.Lock()
+		room.LastActivity = start.Add(-time.Hour)
+		room.MessagesMux.Unlock()
+		manager.wheel.advance(start.Add(config.InactiveStreamTimeout + time.Minute))
+		return start
+	}
+
+	_, err := manager.AddMessage("room", "alice", "alice", "still here")
+	require.NoError(t, err)
+	room, _ := manager.GetRoom("room")
+	require.Eventually(t, func() bool { return savedRooms() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	// Within the restore window the room comes back as it was, state and all
+	expire(room)
+	_, live := manager.GetRoom("room")
+	require.False(t, live)
+	require.Equal(t, 1, savedRooms())
+	restored := manager.GetOrCreateRoom("room")
+	require.Same(t, room, restored)
+	require.Equal(t, []string{"still here"}, messageTexts(restored.GetMessages(0)))
+
+	// After it the room and its saved state are gone
+	start := expire(restored)
+	manager.wheel.advance(start.Add(config.InactiveStreamTimeout + 32*time.Minute))
+	require.False(t, manager.hasRoom("room"))
+	require.Zero(t, savedRooms())
+	require.Empty(t, manager.GetOrCreateRoom("room").GetMessages(0))
+}
@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+// MembershipTracker limits how many rooms a single identity may occupy at once
+// and how quickly it may join new ones
+type MembershipTracker struct {
+	maxRooms          int
+	maxJoinsPerMinute int
+	rooms             map[string]map[string]int // userID -> streamKey -> active joins
+	joins             map[string][]time.Time    // userID -> recent join timestamps
+	mutex             sync.Mutex
+}
+
+// NewMembershipTracker creates a new membership tracker. A limit of 0 disables that check.
+func NewMembershipTracker(maxRooms, maxJoinsPerMinute int) *MembershipTracker {
+	return &MembershipTracker{
+		maxRooms:          maxRooms,
+		maxJoinsPerMinute: maxJoinsPerMinute,
+		rooms:             make(map[string]map[string]int),
+		joins:             make(map[string][]time.Time),
+	}
+}
+
+// Join records that a user joined a room, or returns an error if a limit is exceeded
+func (mt *MembershipTracker) Join(userID, streamKey string) error {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+
+	now := time.Now()
+	recent := pruneTimestamps(mt.joins[userID], now.Add(-time.Minute))
+
+	if mt.maxJoinsPerMinute > 0 && len(recent) >= mt.maxJoinsPerMinute {
+		mt.joins[userID] = recent
+		return ErrJoinRateLimit.withDetails(ErrorDetails{
+			RetryAfterSeconds: retryAfter(recent[0].Add(time.Minute).Sub(now)),
+			Limit:             mt.maxJoinsPerMinute,
+			Window:            60,
+			Tier:              TierJoinRate,
+		})
+	}
+
+	userRooms := mt.rooms[userID]
+	if userRooms == nil {
+		userRooms = make(map[string]int)
+	}
+
+	// Rejoining a room the user is already in doesn't count against the room cap
+	if _, inRoom := userRooms[streamKey]; !inRoom && mt.maxRooms > 0 && len(userRooms) >= mt.maxRooms {
+		mt.joins[userID] = recent
+		return ErrTooManyRooms.withDetails(ErrorDetails{Limit: mt.maxRooms})
+	}
+
+	userRooms[streamKey]++
+	mt.rooms[userID] = userRooms
+	mt.joins[userID] = append(recent, now)
+
+	return nil
+}
+
+// Leave records that a user left a room
+func (mt *MembershipTracker) Leave(userID, streamKey string) {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+
+	userRooms, exists := mt.rooms[userID]
+	if !exists {
+		return
+	}
+
+	userRooms[streamKey]--
+	if userRooms[streamKey] <= 0 {
+		delete(userRooms, streamKey)
+	}
+
+	if len(userRooms) == 0 {
+		delete(mt.rooms, userID)
+	}
+}
+
+// RoomCount returns the number of rooms a user is currently in
+func (mt *MembershipTracker) RoomCount(userID string) int {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+
+	return len(mt.rooms[userID])
+}
+
+// RecentJoins returns when the user joined rooms within the join rate window
+func (mt *MembershipTracker) RecentJoins(userID string) []time.Time {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+
+	return append([]time.Time{}, mt.joins[userID]...)
+}
+
+// Cleanup drops join history older than the rate window
+func (mt *MembershipTracker) Cleanup() {
+	mt.mutex.Lock()
+	defer mt.mutex.Unlock()
+
+	cutoff := time.Now().Add(-time.Minute)
+	for userID, timestamps := range mt.joins {
+		recent := pruneTimestamps(timestamps, cutoff)
+		if len(recent) == 0 {
+			delete(mt.joins, userID)
+		} else {
+			mt.joins[userID] = recent
+		}
+	}
+}
+
+// pruneTimestamps returns the timestamps that are after the cutoff
+func pruneTimestamps(timestamps []time.Time, cutoff time.Time) []time.Time {
+	kept := timestamps[:0]
+	for _, ts := range timestamps {
+		if ts.After(cutoff) {
+			kept = append(kept, ts)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,41 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMembershipRoomLimit(t *testing.T) {
+	mt := NewMembershipTracker(2, 0)
+
+	require.NoError(t, mt.Join("user", "a"))
+	require.NoError(t, mt.Join("user", "b"))
+	err := mt.Join("user", "c")
+	require.ErrorIs(t, err, ErrTooManyRooms)
+	require.Equal(t, &ErrorDetails{Limit: 2}, err.(*ChatError).Details)
+
+	// Rejoining an existing room is always allowed
+	require.NoError(t, mt.Join("user", "a"))
+
+	mt.Leave("user", "b")
+	require.NoError(t, mt.Join("user", "c"))
+	require.Equal(t, 2, mt.RoomCount("user"))
+}
+
+func TestMembershipJoinRate(t *testing.T) {
+	mt := NewMembershipTracker(0, 3)
+
+	for _, room := range []string{"a", "b", "c"} {
+		require.NoError(t, mt.Join("user", room))
+		mt.Leave("user", room)
+	}
+
+	err := mt.Join("user", "d")
+	require.ErrorIs(t, err, ErrJoinRateLimit)
+	details := err.(*ChatError).Details
+	require.Equal(t, 3, details.Limit)
+	require.Equal(t, 60, details.Window)
+	require.InDelta(t, 60, details.RetryAfterSeconds, 1)
+	require.NoError(t, mt.Join("other", "d"))
+}
@@ -0,0 +1,195 @@
+package chat
+
+import (
+	"sort"
+	"time"
+	"unsafe"
+)
+
+// Fixed sizes of the records the memory tracker counts
+var (
+	messageSlotSize = int64(unsafe.Sizeof(ChatMessage{}))
+	originSize      = int64(unsafe.Sizeof(MessageOrigin{}))
+	userRecordSize  = int64(unsafe.Sizeof(ChatUser{}))
+	rateRecordSize  = int64(unsafe.Sizeof(UserRateRecord{}))
+	mapEntrySize    = int64(unsafe.Sizeof("") + unsafe.Sizeof(uintptr(0))) // string key and pointer value
+	stringSize      = int64(unsafe.Sizeof(""))
+	timeSize        = int64(unsafe.Sizeof(time.Time{}))
+	intSize         = int64(unsafe.Sizeof(0))
+)
+
+// MemoryUsage breaks down the bytes the chat holds
+type MemoryUsage struct {
+	MessageBytes     int64 // buffer slots and the messages in them
+	UserBytes        int64 // room user records
+	RateLimiterBytes int64 // rate limiter records
+}
+
+// Total is the bytes held across every kind of record
+func (u MemoryUsage) Total() int64 {
+	return u.MessageBytes + u.UserBytes + u.RateLimiterBytes
+}
+
+// messageSize is what a buffered message references beyond its slot in the buffer
+func messageSize(msg ChatMessage) int64 {
+	size := int64(len(msg.ID) + len(msg.StreamKey) + len(msg.UserID) + len(msg.Username) + len(msg.Message))
+	if msg.Origin != nil {
+		size += originSize + int64(len(msg.Origin.System)+len(msg.Origin.ID))
+	}
+	return size
+}
+
+// size is the bytes a room's user record holds, including its map entry
+func (u *ChatUser) size() int64 {
+	return userRecordSize + mapEntrySize + int64(len(u.UserID)+len(u.Username))
+}
+
+// size is the bytes a rate record holds, including its map entry. Callers must
+// hold the record's lock.
+func (r *UserRateRecord) size() int64 {
+	size := rateRecordSize + mapEntrySize + int64(len(r.UserID)+len(r.TimeoutTier))
+	size += int64(cap(r.Messages)) * timeSize
+	size += int64(cap(r.CharCountHistory)) * intSize
+	size += int64(cap(r.MessageContents)) * stringSize
+	for _, content := range r.MessageContents {
+		size += int64(len(content))
+	}
+	return size
+}
+
+// MemoryUsage returns the bytes held by the rate limiter's records
+func (rl *RateLimiter) MemoryUsage() int64 {
+	var total int64
+	for _, shard := range rl.shards {
+		shard.mutex.RLock()
+		for _, record := range shard.records {
+			record.mu.Lock()
+			total += record.size()
+			record.mu.Unlock()
+		}
+		shard.mutex.RUnlock()
+	}
+	return total
+}
+
+// SetRateLimiter counts the rate limiter's records in the memory stats
+func (m *Manager) SetRateLimiter(rl *RateLimiter) {
+	m.hooksMux.Lock()
+	defer m.hooksMux.Unlock()
+
+	m.rateLimiter = rl
+}
+
+// rateLimiterBytes returns the bytes held by the installed rate limiter, if any
+func (m *Manager) rateLimiterBytes() int64 {
+	m.hooksMux.RLock()
+	rl := m.rateLimiter
+	m.hooksMux.RUnlock()
+
+	if rl == nil {
+		return 0
+	}
+	return rl.MemoryUsage()
+}
+
+// emergencyTarget is the share of the memory limit emergency cleanup frees memory
+// down to, leaving headroom below the near-limit warning
+const emergencyTarget = 0.75
+
+// evictForMemory frees about excess bytes of buffered messages. Rooms are ranked by
+// the memory their messages hold weighted by how long they've been idle, and each
+// gives back the older half of its messages in turn, so large, idle rooms shrink
+// first and small, busy ones are only reached if the others can't cover it.
+func (m *Manager) evictForMemory(excess int64) (freed int64, removed, rooms int) {
+	type candidate struct {
+		room   *ChatRoom
+		weight float64
+	}
+
+	now := time.Now()
+	candidates := []candidate{}
+	for _, room := range m.liveRooms() {
+		room.MessagesMux.RLock()
+		idle := now.Sub(room.LastActivity)
+		room.MessagesMux.RUnlock()
+
+		candidates = append(candidates, candidate{
+			room:   room,
+			weight: float64(room.Messages.Bytes()) * (1 + idle.Minutes()),
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].weight > candidates[j].weight })
+
+	trimmed := make(map[*ChatRoom]bool)
+	for freed < excess {
+		progress := false
+		for _, c := range candidates {
+			if freed >= excess {
+				break
+			}
+
+			before := c.room.Messages.Bytes()
+			n := c.room.Trim(c.room.Messages.Size() / 2)
+			if n == 0 {
+				continue
+			}
+			freed += before - c.room.Messages.Bytes()
+			removed += n
+			trimmed[c.room] = true
+			progress = true
+		}
+		if !progress {
+			break
+		}
+	}
+
+	return freed, removed, len(trimmed)
+}
+
+// historyLimit is the most messages a room with the given audience may keep:
+// MessagesPerViewer for each viewer, between MaxMessagesPerStream and
+// PopularStreamMaxMessages. A broadcaster's MaxMessages override takes its place,
+// up to the same ceiling. Every room is held to MaxMessagesPerStream while memory
+// use is near its limit.
+func (m *Manager) historyLimit(streamKey string, viewers int) int {
+	limit := m.config.MaxMessagesPerStream
+	if override := m.RetentionPolicy(streamKey).MaxMessages; override > 0 {
+		if m.memTracker.IsNearLimit() {
+			return min(override, limit)
+		}
+		return min(override, max(limit, m.config.PopularStreamMaxMessages))
+	}
+	if m.config.MessagesPerViewer <= 0 || m.memTracker.IsNearLimit() {
+		return limit
+	}
+	return max(limit, min(viewers*m.config.MessagesPerViewer, m.config.PopularStreamMaxMessages))
+}
+
+// SetViewerCount records a room's audience and scales how much history it keeps
+// to match
+func (m *Manager) SetViewerCount(streamKey string, viewers int) {
+	if m.config.MessagesPerViewer <= 0 {
+		return
+	}
+	room, exists := m.GetRoom(streamKey)
+	if !exists {
+		return
+	}
+
+	room.MessagesMux.Lock()
+	room.viewers = viewers
+	room.MessagesMux.Unlock()
+	room.SetMaxMessages(m.historyLimit(streamKey, viewers))
+}
+
+// rescaleHistory reapplies every room's history limit, so popular rooms fall back
+// to MaxMessagesPerStream once memory use nears its limit and regain their share
+// when it eases
+func (m *Manager) rescaleHistory() {
+	for _, room := range m.liveRooms() {
+		room.MessagesMux.RLock()
+		viewers := room.viewers
+		room.MessagesMux.RUnlock()
+		room.SetMaxMessages(m.historyLimit(room.StreamKey, viewers))
+	}
+}
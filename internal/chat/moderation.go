@@ -0,0 +1,133 @@
+package chat
+
+import (
+	"log"
+	"time"
+)
+
+const maxModeratorTimeoutSeconds = 14 * 24 * 3600
+
+// Moderation actions a "moderate" frame can take
+const (
+	ModerateTimeout   = "timeout"   // keep a user from posting in the room for a while
+	ModerateUntimeout = "untimeout" // lift a moderator's timeout early
+	ModerateClear     = "clear"     // clear the room's messages
+	ModerateSlowMode  = "slow_mode" // set the room's slow mode
+)
+
+// ModerationEvent is the payload of the "moderation" frame telling a room a
+// moderator took an action
+type ModerationEvent struct {
+	Action          string `json:"action"`
+	ModeratorID     string `json:"moderatorId"`
+	UserID          string `json:"userId,omitempty"`          // the user acted on, for timeouts
+	DurationSeconds int    `json:"durationSeconds,omitempty"` // of a timeout, or between messages in slow mode
+}
+
+// TimeoutUser keeps a user from posting in the room for d, replacing any
+// moderator's timeout they were already under. Timeouts earned from the rate
+// limiter are separate, and apply in every room.
+func (cr *ChatRoom) TimeoutUser(userID string, d time.Duration) {
+	cr.modesMux.Lock()
+	defer cr.modesMux.Unlock()
+
+	if cr.timeouts == nil {
+		cr.timeouts = make(map[string]time.Time)
+	}
+	cr.timeouts[userID] = time.Now().Add(d)
+}
+
+// LiftTimeout ends a moderator's timeout early, reporting whether the user was
+// under one
+func (cr *ChatRoom) LiftTimeout(userID string) bool {
+	cr.modesMux.Lock()
+	defer cr.modesMux.Unlock()
+
+	until, timedOut := cr.timeouts[userID]
+	delete(cr.timeouts, userID)
+	return timedOut && time.Now().Before(until)
+}
+
+// handleModerate takes a moderation action in one of the connection's rooms.
+// Users may only time out users who rank below them there.
+func (c *Connection) handleModerate(frame *ModerateFrame) {
+	if c.UserID == "" {
+		c.sendChatError(ErrNotJoined)
+		return
+	}
+	streamKey, err := c.targetRoom(frame.Room)
+	if err != nil {
+		c.sendChatError(err)
+		return
+	}
+	if !c.can(streamKey, PermModerate) {
+		c.sendChatError(ErrNotPermitted)
+		return
+	}
+	room, exists := c.manager.manager.GetRoom(streamKey)
+	if !exists {
+		c.sendChatError(ErrRoomNotFound)
+		return
+	}
+
+	event := ModerationEvent{Action: frame.Action, ModeratorID: c.UserID}
+	switch frame.Action {
+	case ModerateTimeout, ModerateUntimeout:
+		if frame.UserID == c.UserID || !outranks(c.rolesIn(streamKey), room.userRoles(frame.UserID)) {
+			c.sendChatError(ErrNotPermitted)
+			return
+		}
+		event.UserID = frame.UserID
+
+		if frame.Action == ModerateTimeout {
+			duration := time.Duration(frame.DurationSeconds) * time.Second
+			room.TimeoutUser(frame.UserID, duration)
+			event.DurationSeconds = frame.DurationSeconds
+			c.manager.notifyRoomTimeout(streamKey, frame.UserID, WSMessage{
+				Type:      "timeout",
+				Data:      TimeoutEvent{Duration: duration.Seconds()},
+				Room:      streamKey,
+				Timestamp: time.Now(),
+			})
+			c.manager.publishEvent(WebhookEventUserTimeout, streamKey, map[string]interface{}{
+				"userId":      frame.UserID,
+				"duration":    duration.Seconds(),
+				"reason":      "Timed out by a moderator",
+				"moderatorId": c.UserID,
+			})
+		} else if room.LiftTimeout(frame.UserID) {
+			c.manager.notifyRoomTimeout(streamKey, frame.UserID, WSMessage{Type: "timeout_ended", Room: streamKey, Timestamp: time.Now()})
+		}
+
+	case ModerateClear:
+		if _, err := c.manager.ClearRoom(streamKey); err != nil {
+			c.sendChatError(err)
+			return
+		}
+
+	case ModerateSlowMode:
+		modes := room.Modes()
+		modes.SlowModeSeconds = frame.DurationSeconds
+		if err := c.manager.SetRoomModes(streamKey, modes); err != nil {
+			c.sendChatError(err)
+			return
+		}
+		event.DurationSeconds = frame.DurationSeconds
+	}
+
+	log.Printf("User %s (%s) took moderation action %s in stream %s", c.Username, c.UserID, frame.Action, streamKey)
+	c.manager.broadcast(streamKey, WSMessage{
+		Type:      "moderation",
+		Data:      event,
+		Timestamp: time.Now(),
+	}, "")
+}
+
+// notifyRoomTimeout sends a timeout frame to a user's connections in a room
+func (h *WSHandler) notifyRoomTimeout(streamKey, userID string, msg WSMessage) {
+	for _, conn := range h.roomConnections(streamKey) {
+		if conn.UserID == userID {
+			conn.deliver(msg)
+		}
+	}
+}
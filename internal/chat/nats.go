@@ -0,0 +1,120 @@
+package chat
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/nats-io/nats.go"
+)
+
+const (
+	// natsSubjects covers every subject the chat publishes on the backplane
+	natsSubjects      = "chat.>"
+	natsReconnectWait = 2 * time.Second
+	natsStreamMaxAge  = time.Hour
+)
+
+// NATSBroker is a Broker on NATS, for operators already running it. On core NATS
+// events published while an instance is disconnected are lost to it; with JetStream
+// they are kept in a stream, and its subscriptions resume where they left off when
+// it reconnects.
+type NATSBroker struct {
+	conn *nats.Conn
+	js   nats.JetStreamContext // nil on core NATS
+}
+
+// NewNATSBroker connects to the NATS servers at url, a comma-separated list for a
+// cluster. A non-empty stream enables JetStream, creating the stream if needed.
+// The connection reconnects for as long as the broker is open.
+func NewNATSBroker(url string, stream string) (*NATSBroker, error) {
+	conn, err := nats.Connect(url,
+		nats.Name("broadcast-box-chat"),
+		nats.MaxReconnects(-1),
+		nats.ReconnectWait(natsReconnectWait),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("NATS broker disconnected: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(conn *nats.Conn) {
+			log.Printf("NATS broker reconnected to %s", conn.ConnectedUrl())
+		}),
+		nats.ErrorHandler(func(_ *nats.Conn, sub *nats.Subscription, err error) {
+			if sub != nil {
+				log.Printf("NATS broker error on %s: %v", sub.Subject, err)
+				return
+			}
+			log.Printf("NATS broker error: %v", err)
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	broker := &NATSBroker{conn: conn}
+	if stream == "" {
+		return broker, nil
+	}
+
+	if broker.js, err = conn.JetStream(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if _, err = broker.js.StreamInfo(stream); errors.Is(err, nats.ErrStreamNotFound) {
+		_, err = broker.js.AddStream(&nats.StreamConfig{
+			Name:     stream,
+			Subjects: []string{natsSubjects},
+			MaxAge:   natsStreamMaxAge,
+		})
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return broker, nil
+}
+
+// Publish sends a payload on the subject. With JetStream it returns once the
+// stream has stored it.
+func (nb *NATSBroker) Publish(subject string, payload []byte) error {
+	if nb.js != nil {
+		_, err := nb.js.Publish(subject, payload)
+		return err
+	}
+	return nb.conn.Publish(subject, payload)
+}
+
+// Subscribe registers a handler for a subject. NATS calls handlers for a subject
+// one at a time, in the order the events were published.
+func (nb *NATSBroker) Subscribe(subject string, handler func([]byte)) (func(), error) {
+	deliver := func(msg *nats.Msg) {
+		handler(msg.Data)
+	}
+
+	var sub *nats.Subscription
+	var err error
+	if nb.js != nil {
+		// Ordered consumers are recreated from the last delivered event after a reconnect
+		sub, err = nb.js.Subscribe(subject, deliver, nats.OrderedConsumer(), nats.DeliverNew())
+	} else {
+		sub, err = nb.conn.Subscribe(subject, deliver)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		if err := sub.Unsubscribe(); err != nil && !errors.Is(err, nats.ErrConnectionClosed) {
+			log.Printf("NATS broker failed to unsubscribe from %s: %v", subject, err)
+		}
+	}, nil
+}
+
+// Close delivers events already received to their handlers, flushes pending
+// publishes and closes the connection
+func (nb *NATSBroker) Close() error {
+	return nb.conn.Drain()
+}
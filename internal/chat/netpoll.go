@@ -0,0 +1,325 @@
+package chat
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gobwas/ws"
+)
+
+// WebSocket backends accepted by CHAT_WS_BACKEND
+const (
+	BackendGorilla = "gorilla" // a read goroutine per WebSocket
+	BackendNetpoll = "netpoll" // readiness-driven reads from one event loop (Linux only)
+)
+
+const (
+	netpollMaxMessage   = 1 << 20 // largest message a client may send
+	netpollFrameTimeout = 10 * time.Second
+	netpollIdleTimeout  = 60 * time.Second
+	netpollPingInterval = 54 * time.Second
+)
+
+// validBackend reports whether name is a WebSocket backend
+func validBackend(name string) bool {
+	return name == BackendGorilla || name == BackendNetpoll
+}
+
+// netpollReaders is how many workers read WebSockets that have data. A worker is
+// only held up for as long as a client takes to finish sending a frame.
+func netpollReaders() int {
+	return 4 * runtime.GOMAXPROCS(0)
+}
+
+// npTransport carries a Connection over a WebSocket upgraded by gobwas/ws and read
+// only when the poller reports it readable. An idle connection costs no goroutine
+// and no buffer: writes go through the write pool and keep-alive pings run on
+// timers.
+type npTransport struct {
+	conn   net.Conn
+	fd     int
+	poller *epoller
+	codec  Codec     // negotiated through the subprotocol
+	op     ws.OpCode // ws.OpText or ws.OpBinary
+	prefix []byte    // bytes the client sent right after the handshake
+
+	c        *Connection
+	lastSeen atomic.Int64 // unix nanoseconds of the last frame from the client
+	closed   atomic.Bool  // the socket is closed and must not be polled again
+	finished sync.Once
+}
+
+// serveNetpoll upgrades a request on the netpoll backend
+func (h *WSHandler) serveNetpoll(w http.ResponseWriter, r *http.Request, streamKey, ip string) {
+	u := ws.HTTPUpgrader{
+		Protocol: func(protocol string) bool {
+			return protocol == SubprotocolJSON || protocol == SubprotocolMsgPack || protocol == SubprotocolProtobuf
+		},
+	}
+	conn, rw, handshake, err := u.Upgrade(r, w)
+	if err != nil {
+		h.releaseConnection(ip)
+		log.Printf("WebSocket upgrade failed: %v", err)
+		return
+	}
+
+	t := &npTransport{conn: conn, poller: h.poller, codec: h.codec, op: ws.OpText}
+	switch handshake.Protocol {
+	case SubprotocolMsgPack:
+		t.codec, t.op = msgpackCodec{}, ws.OpBinary
+	case SubprotocolProtobuf:
+		t.codec, t.op = protobufCodec{}, ws.OpBinary
+	}
+	if n := rw.Reader.Buffered(); n > 0 {
+		t.prefix, _ = rw.Reader.Peek(n)
+		t.prefix = append([]byte(nil), t.prefix...)
+	}
+	t.lastSeen.Store(time.Now().UnixNano())
+
+	if t.fd, err = connFD(conn); err != nil {
+		log.Printf("WebSocket can't be polled: %v", err)
+		conn.Close()
+		h.releaseConnection(ip)
+		return
+	}
+
+	c := newConnection(h, streamKey, ip, t)
+	c.statsAllowed = h.tokens.Authorized(r, ScopeReadStats)
+	c.credentials = requestCredentials(r, ip)
+	c.writes = h.writers
+	t.c = c
+
+	c.wake() // for the hello frame
+	time.AfterFunc(netpollPingInterval, t.keepAlive)
+
+	if len(t.prefix) > 0 {
+		// The client didn't wait for the handshake; read what it sent before polling
+		h.poller.ready <- t
+		return
+	}
+	if err := h.poller.rearm(t); err != nil {
+		log.Printf("Failed to poll WebSocket: %v", err)
+		t.finish()
+	}
+}
+
+// connFD returns the file descriptor of a TCP connection
+func connFD(conn net.Conn) (int, error) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return 0, errors.New("connection has no file descriptor")
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0, err
+	}
+
+	fd := -1
+	if err := raw.Control(func(f uintptr) { fd = int(f) }); err != nil {
+		return 0, err
+	}
+	return fd, nil
+}
+
+// Read reads from the bytes left over from the handshake, then from the socket.
+// Only the worker handling a readiness event reads, so it needs no locking.
+func (t *npTransport) Read(p []byte) (int, error) {
+	if len(t.prefix) > 0 {
+		n := copy(p, t.prefix)
+		t.prefix = t.prefix[n:]
+		return n, nil
+	}
+	return t.conn.Read(p)
+}
+
+// readable handles the client's next message once the poller reports data, then
+// waits for more. The poller hands a connection to one worker at a time.
+func (t *npTransport) readable() {
+	c := t.c
+
+	for {
+		select {
+		case <-c.done:
+			t.finish()
+			return
+		default:
+		}
+
+		data, err := t.readMessage()
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, net.ErrClosed) {
+				log.Printf("WebSocket error: %v", err)
+			}
+			t.finish()
+			return
+		}
+
+		if data != nil {
+			var msg map[string]interface{}
+			if err := t.codec.Unmarshal(data, &msg); err != nil {
+				t.finish()
+				return
+			}
+			c.handleMessage(msg)
+		}
+
+		if len(t.prefix) == 0 {
+			break
+		}
+	}
+
+	if err := t.poller.rearm(t); err != nil {
+		t.finish()
+	}
+}
+
+// readMessage reads frames until a data message is complete, answering control
+// frames on the way. It returns nil data after a lone control frame.
+func (t *npTransport) readMessage() ([]byte, error) {
+	if err := t.conn.SetReadDeadline(time.Now().Add(netpollFrameTimeout)); err != nil {
+		return nil, err
+	}
+
+	var message []byte
+	for {
+		header, err := ws.ReadHeader(t)
+		if err != nil {
+			return nil, err
+		}
+		if !header.Masked {
+			return nil, errors.New("client frame is not masked")
+		}
+		if header.Length > netpollMaxMessage || int64(len(message))+header.Length > netpollMaxMessage {
+			return nil, errors.New("client message is too large")
+		}
+
+		payload := make([]byte, header.Length)
+		if _, err := io.ReadFull(t, payload); err != nil {
+			return nil, err
+		}
+		ws.Cipher(payload, header.Mask, 0)
+		t.lastSeen.Store(time.Now().UnixNano())
+
+		switch header.OpCode {
+		case ws.OpPing:
+			t.send(ws.OpPong, payload) //nolint
+		case ws.OpPong:
+		case ws.OpClose:
+			return nil, io.EOF
+		default:
+			message = append(message, payload...)
+			if header.Fin {
+				return message, nil
+			}
+			continue
+		}
+
+		if message == nil {
+			return nil, nil
+		}
+	}
+}
+
+// send writes one unfragmented frame. Each frame goes out in a single write, so
+// pings and pool writes never interleave on the wire.
+func (t *npTransport) send(op ws.OpCode, payload []byte) error {
+	frame, err := ws.CompileFrame(ws.NewFrame(op, true, payload))
+	if err != nil {
+		return err
+	}
+
+	if err := t.conn.SetWriteDeadline(time.Now().Add(10 * time.Second)); err != nil {
+		return err
+	}
+	_, err = t.conn.Write(frame)
+	return err
+}
+
+// write encodes and sends one frame for the write pool
+func (t *npTransport) write(c *Connection, message WSMessage) bool {
+	var data []byte
+	if message.prepared != nil {
+		enc, elapsed := message.prepared.encode(frameFormat{codec: t.codec}, message)
+		if enc.err != nil {
+			log.Printf("Failed to encode chat message: %v", enc.err)
+			return true
+		}
+		if elapsed > 0 {
+			c.manager.loadShedder.ObserveEncode(elapsed)
+		}
+		data = enc.data
+	} else {
+		start := time.Now()
+		var err error
+		if data, err = t.codec.Marshal(message); err != nil {
+			log.Printf("Failed to encode chat message: %v", err)
+			return true
+		}
+		c.manager.loadShedder.ObserveEncode(time.Since(start))
+	}
+
+	if err := t.send(t.op, data); err != nil {
+		return false
+	}
+
+	if messages, ok := message.Data.([]*ChatMessage); ok && message.Type == "message_batch" {
+		for _, chatMsg := range messages {
+			c.traceWritten(WSMessage{Type: "message", Data: chatMsg})
+		}
+	} else {
+		c.traceWritten(message)
+	}
+	return true
+}
+
+// keepAlive pings the client, closing the connection if nothing has been heard
+// from it within netpollIdleTimeout
+func (t *npTransport) keepAlive() {
+	select {
+	case <-t.c.done:
+		return
+	default:
+	}
+
+	if time.Since(time.Unix(0, t.lastSeen.Load())) > netpollIdleTimeout+netpollPingInterval {
+		t.c.Close("")
+		return
+	}
+	if err := t.send(ws.OpPing, nil); err != nil {
+		t.c.Close("")
+		return
+	}
+	time.AfterFunc(netpollPingInterval, t.keepAlive)
+}
+
+// Close sends a close frame and closes the socket. Nothing reads a closed socket
+// on this backend, so leaving the room is started here.
+func (t *npTransport) Close(reason string) error {
+	code := ws.StatusNormalClosure
+	if reason != "" {
+		code = ws.StatusPolicyViolation
+	}
+	t.send(ws.OpClose, ws.NewCloseFrameBody(code, reason)) //nolint
+
+	t.closed.Store(true)
+	t.poller.unwatch(t)
+	err := t.conn.Close()
+	go t.finish()
+	return err
+}
+
+// finish leaves the room and frees the connection's slot, once
+func (t *npTransport) finish() {
+	t.finished.Do(func() {
+		t.c.cleanup()
+		t.c.manager.releaseConnection(t.c.RemoteAddr)
+	})
+}
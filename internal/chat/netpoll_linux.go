@@ -0,0 +1,105 @@
+package chat
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+)
+
+const epollEvents = syscall.EPOLLIN | syscall.EPOLLRDHUP | syscall.EPOLLONESHOT
+
+// epoller waits on every netpoll WebSocket with one epoll instance and hands the
+// readable ones to a pool of readers. Connections are registered one-shot, so a
+// connection is read by at most one reader until it is rearmed.
+type epoller struct {
+	fd    int
+	mu    sync.RWMutex
+	conns map[int]*npTransport // fd -> transport
+	ready chan *npTransport
+}
+
+// newEpoller starts an event loop and the given number of readers
+func newEpoller(readers int) (*epoller, error) {
+	fd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return nil, err
+	}
+
+	e := &epoller{
+		fd:    fd,
+		conns: make(map[int]*npTransport),
+		ready: make(chan *npTransport, writePoolQueue),
+	}
+	go e.wait()
+	for i := 0; i < readers; i++ {
+		go e.reader()
+	}
+	return e, nil
+}
+
+// rearm asks to be told the next time the connection is readable, registering it
+// on first use
+func (e *epoller) rearm(t *npTransport) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if t.closed.Load() {
+		// The descriptor may already belong to another connection
+		return net.ErrClosed
+	}
+	_, known := e.conns[t.fd]
+	e.conns[t.fd] = t
+
+	event := &syscall.EpollEvent{Events: epollEvents, Fd: int32(t.fd)}
+	if known {
+		return syscall.EpollCtl(e.fd, syscall.EPOLL_CTL_MOD, t.fd, event)
+	}
+	return syscall.EpollCtl(e.fd, syscall.EPOLL_CTL_ADD, t.fd, event)
+}
+
+// unwatch stops polling a connection. It must be called before the socket is
+// closed, while its descriptor can't yet be reused by another connection.
+func (e *epoller) unwatch(t *npTransport) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.conns[t.fd] == t {
+		delete(e.conns, t.fd)
+		syscall.EpollCtl(e.fd, syscall.EPOLL_CTL_DEL, t.fd, nil) //nolint
+	}
+}
+
+// wait collects readiness events for the readers
+func (e *epoller) wait() {
+	defer trackWorker("netpoll.wait")()
+
+	events := make([]syscall.EpollEvent, 256)
+	for {
+		n, err := syscall.EpollWait(e.fd, events, -1)
+		if errors.Is(err, syscall.EINTR) {
+			continue
+		}
+		if err != nil {
+			return
+		}
+
+		for i := 0; i < n; i++ {
+			e.mu.RLock()
+			t := e.conns[int(events[i].Fd)]
+			e.mu.RUnlock()
+			if t != nil {
+				e.ready <- t
+			}
+		}
+	}
+}
+
+// reader reads from connections that have data
+func (e *epoller) reader() {
+	defer trackWorker("netpoll.reader")()
+
+	for t := range e.ready {
+		t.readable()
+	}
+}
@@ -0,0 +1,22 @@
+//go:build !linux
+
+package chat
+
+import "errors"
+
+// epoller is only implemented on Linux; elsewhere the netpoll backend falls back
+// to gorilla
+type epoller struct {
+	ready chan *npTransport
+}
+
+// newEpoller reports that the platform has no epoll
+func newEpoller(readers int) (*epoller, error) {
+	return nil, errors.New("the netpoll WebSocket backend needs Linux")
+}
+
+func (e *epoller) rearm(t *npTransport) error {
+	return errors.New("the netpoll WebSocket backend needs Linux")
+}
+
+func (e *epoller) unwatch(t *npTransport) {}
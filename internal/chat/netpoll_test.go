@@ -0,0 +1,100 @@
+//go:build linux
+
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func newNetpollTestHandler(t *testing.T) (*WSHandler, *httptest.Server) {
+	config := DefaultConfig()
+	config.WSBackend = BackendNetpoll
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+
+	h := NewWSHandler(manager, NewRateLimiter(config))
+	require.NotNil(t, h.poller)
+	require.NotNil(t, h.writers)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/chat", h.HTTPHandler)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return h, server
+}
+
+func TestNetpollBackendChats(t *testing.T) {
+	h, server := newNetpollTestHandler(t)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+	bob := dialTestClient(t, server, "room")
+	joinTestClient(t, bob, "bob")
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "message",
+		"data": map[string]interface{}{"message": "hello from the event loop"},
+	}))
+	msg := readUntil(t, bob, "message")
+	require.Equal(t, "hello from the event loop", msg["data"].(map[string]interface{})["message"])
+
+	// Pings from the client are answered between messages
+	pong := make(chan struct{}, 1)
+	alice.SetPongHandler(func(string) error {
+		pong <- struct{}{}
+		return nil
+	})
+	require.NoError(t, alice.WriteControl(websocket.PingMessage, []byte("hi"), time.Now().Add(time.Second)))
+	go func() {
+		// Pong handlers run while reading
+		for {
+			if _, _, err := alice.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+	select {
+	case <-pong:
+	case <-time.After(5 * time.Second):
+		t.Fatal("no pong")
+	}
+
+	// A client hanging up leaves the room and frees its slot
+	require.NoError(t, bob.Close())
+	require.Eventually(t, func() bool {
+		return len(h.roomConnections("room")) == 1 && h.openConns.Load() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// So does the server closing a connection
+	require.Equal(t, 1, h.closeUserConnections("alice", "bye"))
+	require.Eventually(t, func() bool {
+		return len(h.roomConnections("room")) == 0 && h.openConns.Load() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestNetpollBackendNegotiatesMsgPack(t *testing.T) {
+	_, server := newNetpollTestHandler(t)
+
+	dialer := websocket.Dialer{Subprotocols: []string{SubprotocolMsgPack}}
+	conn, _, err := dialer.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/api/chat?streamKey=room", nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, SubprotocolMsgPack, conn.Subprotocol())
+
+	messageType, data, err := conn.ReadMessage()
+	require.NoError(t, err)
+	require.Equal(t, websocket.BinaryMessage, messageType)
+
+	var hello map[string]interface{}
+	require.NoError(t, msgpack.Unmarshal(data, &hello))
+	require.Equal(t, "hello", hello["type"])
+}
@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// OriginAllowlist decides which web pages may open chat WebSockets, so a page on
+// another site can't connect with a visitor's cookies. Requests from the server's
+// own origin, and from clients that send no Origin (bots, native apps), are always
+// allowed.
+type OriginAllowlist struct {
+	any      bool
+	patterns []originPattern
+}
+
+// originPattern is one allowlist entry: an exact origin, or one whose host starts
+// with "*." to match any subdomain
+type originPattern struct {
+	scheme   string
+	host     string // with the port, if any; without the "*." of a wildcard
+	wildcard bool
+}
+
+// NewOriginAllowlist parses origins such as "https://example.com",
+// "https://*.example.com" or "*" for any origin. Entries that aren't origins are
+// ignored.
+func NewOriginAllowlist(origins []string) *OriginAllowlist {
+	allowlist := &OriginAllowlist{}
+	for _, origin := range origins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		if origin == "*" {
+			allowlist.any = true
+			continue
+		}
+
+		scheme, host, ok := strings.Cut(origin, "://")
+		if !ok || scheme == "" || host == "" || strings.Contains(host, "/") {
+			continue
+		}
+		pattern := originPattern{scheme: scheme, host: host}
+		if suffix, ok := strings.CutPrefix(host, "*."); ok {
+			pattern.host, pattern.wildcard = suffix, true
+		}
+		allowlist.patterns = append(allowlist.patterns, pattern)
+	}
+	return allowlist
+}
+
+// Allowed reports whether the request's Origin may connect
+func (a *OriginAllowlist) Allowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || a.any {
+		return true
+	}
+
+	parsed, err := url.Parse(origin)
+	if err != nil || parsed.Host == "" {
+		return false
+	}
+	scheme, host := strings.ToLower(parsed.Scheme), strings.ToLower(parsed.Host)
+	if strings.EqualFold(host, r.Host) {
+		return true
+	}
+
+	for _, pattern := range a.patterns {
+		if pattern.scheme != scheme {
+			continue
+		}
+		if host == pattern.host && !pattern.wildcard {
+			return true
+		}
+		if pattern.wildcard && strings.HasSuffix(host, "."+pattern.host) {
+			return true
+		}
+	}
+	return false
+}
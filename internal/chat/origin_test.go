@@ -0,0 +1,47 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOriginAllowlist(t *testing.T) {
+	allowlist := NewOriginAllowlist([]string{"https://example.com", " https://*.Streams.tv", "http://localhost:5173", "not an origin"})
+
+	allowed := func(origin string) bool {
+		r := httptest.NewRequest(http.MethodGet, "http://chat.internal/api/chat", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return allowlist.Allowed(r)
+	}
+
+	for _, origin := range []string{"", "https://example.com", "https://EXAMPLE.com", "https://live.streams.tv", "https://a.b.streams.tv", "http://localhost:5173", "http://chat.internal"} {
+		require.True(t, allowed(origin), origin)
+	}
+	for _, origin := range []string{"http://example.com", "https://example.com.evil.io", "https://streams.tv", "https://evilstreams.tv", "http://localhost:3000", "null"} {
+		require.False(t, allowed(origin), origin)
+	}
+
+	require.True(t, NewOriginAllowlist([]string{"*"}).Allowed(httptest.NewRequest(http.MethodGet, "/", nil)))
+}
+
+func TestWebSocketRefusesOtherOrigins(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.origins = NewOriginAllowlist([]string{"https://example.com"})
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?streamKey=room"
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://evil.io"}})
+	require.Error(t, err)
+	require.Equal(t, http.StatusForbidden, resp.StatusCode)
+	require.Zero(t, h.openConns.Load())
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{"Origin": {"https://example.com"}})
+	require.NoError(t, err)
+	conn.Close()
+}
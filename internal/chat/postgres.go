@@ -0,0 +1,478 @@
+package chat
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/jackc/pgx/v5/stdlib" // registers the "pgx" driver
+)
+
+const postgresSchema = `
+CREATE TABLE IF NOT EXISTS chat_messages (
+	stream_key    TEXT        NOT NULL,
+	seq           BIGINT      NOT NULL,
+	id            TEXT        NOT NULL,
+	user_id       TEXT        NOT NULL,
+	username      TEXT        NOT NULL,
+	message       TEXT        NOT NULL,
+	created_at    TIMESTAMPTZ NOT NULL,
+	origin_system TEXT,
+	origin_id     TEXT,
+	entry         BIGSERIAL   NOT NULL
+) PARTITION BY LIST (stream_key);
+CREATE INDEX IF NOT EXISTS chat_messages_room_seq ON chat_messages (stream_key, seq);
+CREATE INDEX IF NOT EXISTS chat_messages_room_time ON chat_messages (stream_key, created_at);
+CREATE TABLE IF NOT EXISTS chat_rooms (
+	stream_key TEXT PRIMARY KEY,
+	state      JSONB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS chat_timeouts (
+	user_id TEXT PRIMARY KEY,
+	state   JSONB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS chat_profiles (
+	user_id TEXT PRIMARY KEY,
+	state   JSONB NOT NULL
+);
+CREATE TABLE IF NOT EXISTS chat_tombstones (
+	entry      BIGSERIAL PRIMARY KEY,
+	stream_key TEXT      NOT NULL,
+	message_id TEXT      NOT NULL,
+	state      JSONB     NOT NULL
+);
+CREATE INDEX IF NOT EXISTS chat_tombstones_room ON chat_tombstones (stream_key);
+CREATE INDEX IF NOT EXISTS chat_tombstones_message ON chat_tombstones (message_id);
+`
+
+// PostgresStore is a MessageStore keeping every room's messages in PostgreSQL,
+// for deployments that want durable history every instance can read and search.
+// Each room gets its own partition of the messages table, created with its first
+// message, so a room's history is read, expired and dropped without touching the
+// others. Appends are held and written in batches by a background worker, so
+// reads can trail the newest messages by up to the batching's flush interval.
+type PostgresStore struct {
+	db         *sql.DB
+	partitions sync.Map // stream key -> struct{}, for rooms whose partition exists
+	batcher    *writeBatcher
+}
+
+// NewPostgresStore connects to the database at a postgres:// URL, creating the
+// messages table if needed, and holds appends for writing as batching says
+func NewPostgresStore(rawURL string, batching WriteBatching) (*PostgresStore, error) {
+	db, err := sql.Open("pgx", rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("connecting to postgres: %w", err)
+	}
+	if _, err := db.Exec(postgresSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating postgres schema: %w", err)
+	}
+
+	ps := &PostgresStore{db: db}
+	ps.batcher, err = newWriteBatcher("Postgres", batching, ps.write)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return ps, nil
+}
+
+// postgresPartition names a room's partition. Stream keys are hashed, as they may
+// hold characters or lengths an identifier can't.
+func postgresPartition(streamKey string) string {
+	sum := sha256.Sum256([]byte(streamKey))
+	return "chat_messages_" + hex.EncodeToString(sum[:12])
+}
+
+// postgresLiteral quotes a string for the one statement that can't take it as a
+// parameter: the partition's bound
+func postgresLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+// Append holds a message for the next batch. While too many are waiting to be
+// written it is dropped, or the held messages are written first, as the
+// batching's overflow policy says.
+func (ps *PostgresStore) Append(msg ChatMessage) error {
+	ps.batcher.add(msg)
+	return nil
+}
+
+// Range reads up to limit of a room's messages numbered after afterSeq
+func (ps *PostgresStore) Range(streamKey string, afterSeq int64, limit int) ([]ChatMessage, error) {
+	var limitArg interface{} // NULL is no limit
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	return ps.query(
+		`SELECT id, stream_key, user_id, username, message, created_at, seq, origin_system, origin_id
+		 FROM chat_messages WHERE stream_key = $1 AND seq > $2 ORDER BY entry LIMIT $3`,
+		streamKey, afterSeq, limitArg,
+	)
+}
+
+// UserMessages reads every message the user sent, in every room, oldest first
+func (ps *PostgresStore) UserMessages(userID string) ([]ChatMessage, error) {
+	return ps.query(
+		`SELECT id, stream_key, user_id, username, message, created_at, seq, origin_system, origin_id
+		 FROM chat_messages WHERE user_id = $1 ORDER BY created_at, entry`,
+		userID,
+	)
+}
+
+// Search returns the most recent of a room's stored messages matching the query,
+// oldest first, and whether older matches were left out
+func (ps *PostgresStore) Search(streamKey string, query SearchQuery) ([]ChatMessage, bool, error) {
+	conditions := []string{"stream_key = $1"}
+	args := []interface{}{streamKey}
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if query.Text != "" {
+		where(`message ILIKE $%d ESCAPE '\'`, "%"+postgresLikeEscaper.Replace(query.Text)+"%")
+	}
+	if query.User != "" {
+		where("(lower(user_id) = lower($%[1]d) OR lower(username) = lower($%[1]d))", query.User)
+	}
+	if !query.From.IsZero() {
+		where("created_at >= $%d", query.From)
+	}
+	if !query.To.IsZero() {
+		where("created_at <= $%d", query.To)
+	}
+
+	statement := `SELECT id, stream_key, user_id, username, message, created_at, seq, origin_system, origin_id
+		FROM chat_messages WHERE ` + strings.Join(conditions, " AND ") + ` ORDER BY entry DESC`
+	if query.Limit > 0 {
+		// One extra match tells whether any were left out
+		args = append(args, query.Limit+1)
+		statement += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	messages, err := ps.query(statement, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	hasMore := query.Limit > 0 && len(messages) > query.Limit
+	if hasMore {
+		messages = messages[:query.Limit]
+	}
+	slices.Reverse(messages)
+	return messages, hasMore, nil
+}
+
+// postgresLikeEscaper escapes the wildcards of a LIKE pattern
+var postgresLikeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// query reads messages from the rows a statement selects
+func (ps *PostgresStore) query(statement string, args ...interface{}) ([]ChatMessage, error) {
+	rows, err := ps.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []ChatMessage{}
+	for rows.Next() {
+		var msg ChatMessage
+		var originSystem, originID sql.NullString
+		if err := rows.Scan(&msg.ID, &msg.StreamKey, &msg.UserID, &msg.Username, &msg.Message, &msg.Timestamp, &msg.Seq, &originSystem, &originID); err != nil {
+			return nil, err
+		}
+		if originSystem.Valid {
+			msg.Origin = &MessageOrigin{System: originSystem.String, ID: originID.String}
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// DeleteBefore removes a room's messages older than cutoff
+func (ps *PostgresStore) DeleteBefore(streamKey string, cutoff time.Time) (int, error) {
+	result, err := ps.db.Exec(`DELETE FROM chat_messages WHERE stream_key = $1 AND created_at < $2`, streamKey, cutoff)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+// Compact removes every room's messages older than cutoff, and the tombstones of
+// messages no longer stored, and vacuums the partitions, so the space is reused
+// rather than the tables growing. Only empty pages at the end of a partition are
+// given back to the operating system.
+func (ps *PostgresStore) Compact(cutoff time.Time) (int, int64, error) {
+	before, err := ps.size()
+	if err != nil {
+		return 0, 0, err
+	}
+	result, err := ps.db.Exec(`DELETE FROM chat_messages WHERE created_at < $1`, cutoff)
+	if err != nil {
+		return 0, 0, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := ps.db.Exec(`DELETE FROM chat_tombstones t WHERE NOT EXISTS (SELECT 1 FROM chat_messages m WHERE m.id = t.message_id)`); err != nil {
+		return int(removed), 0, err
+	}
+	if _, err := ps.db.Exec(`VACUUM chat_messages`); err != nil {
+		return int(removed), 0, err
+	}
+	after, err := ps.size()
+	if err != nil {
+		return int(removed), 0, err
+	}
+	return int(removed), max(0, before-after), nil
+}
+
+// size returns how many bytes the partitions of the messages table take, with
+// their indexes
+func (ps *PostgresStore) size() (int64, error) {
+	var size int64
+	err := ps.db.QueryRow(
+		`SELECT COALESCE(SUM(pg_total_relation_size(inhrelid)), 0)::BIGINT
+		 FROM pg_inherits WHERE inhparent = 'chat_messages'::regclass`,
+	).Scan(&size)
+	return size, err
+}
+
+// DeleteByID removes one of a room's messages
+func (ps *PostgresStore) DeleteByID(streamKey, id string) (bool, error) {
+	result, err := ps.db.Exec(`DELETE FROM chat_messages WHERE stream_key = $1 AND id = $2`, streamKey, id)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// EraseUser removes every message the user sent, in every room's partition.
+// Messages still queued for writing are written afterwards.
+func (ps *PostgresStore) EraseUser(userID string) (int, error) {
+	// Edits are the user's words too, so the tombstones of their messages go with them
+	if _, err := ps.db.Exec(`DELETE FROM chat_tombstones WHERE message_id IN (SELECT id FROM chat_messages WHERE user_id = $1)`, userID); err != nil {
+		return 0, err
+	}
+	result, err := ps.db.Exec(`DELETE FROM chat_messages WHERE user_id = $1`, userID)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+// AppendTombstone records that a message was deleted or edited
+func (ps *PostgresStore) AppendTombstone(tombstone Tombstone) error {
+	state, err := json.Marshal(tombstone)
+	if err != nil {
+		return err
+	}
+
+	_, err = ps.db.Exec(
+		`INSERT INTO chat_tombstones (stream_key, message_id, state) VALUES ($1, $2, $3)`,
+		tombstone.StreamKey, tombstone.MessageID, string(state),
+	)
+	return err
+}
+
+// Tombstones returns a room's tombstones, oldest first
+func (ps *PostgresStore) Tombstones(streamKey string) ([]Tombstone, error) {
+	return loadSaved[Tombstone](ps.db, `SELECT state::text FROM chat_tombstones WHERE stream_key = $1 ORDER BY entry`, streamKey)
+}
+
+// DropRoom deletes a room's partition and every message in it
+func (ps *PostgresStore) DropRoom(streamKey string) error {
+	ps.partitions.Delete(streamKey)
+	if _, err := ps.db.Exec(`DROP TABLE IF EXISTS ` + postgresPartition(streamKey)); err != nil {
+		return err
+	}
+	_, err := ps.db.Exec(`DELETE FROM chat_tombstones WHERE stream_key = $1`, streamKey)
+	return err
+}
+
+// Pending returns the number of messages waiting to be written
+func (ps *PostgresStore) Pending() int {
+	return ps.batcher.Pending()
+}
+
+// Dropped returns the number of messages dropped for a full queue
+func (ps *PostgresStore) Dropped() int64 {
+	return ps.batcher.Dropped()
+}
+
+// Ping checks the database answers
+func (ps *PostgresStore) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), storagePingTimeout)
+	defer cancel()
+
+	return ps.db.PingContext(ctx)
+}
+
+// Close writes the messages already queued and disconnects
+func (ps *PostgresStore) Close() error {
+	ps.batcher.close()
+	return ps.db.Close()
+}
+
+// write inserts a batch in one transaction, creating the partitions of rooms it is
+// the first to reach
+func (ps *PostgresStore) write(batch []ChatMessage) error {
+	for _, msg := range batch {
+		if err := ps.ensurePartition(msg.StreamKey); err != nil {
+			return fmt.Errorf("creating chat partition for %s: %w", msg.StreamKey, err)
+		}
+	}
+	return ps.insert(batch)
+}
+
+// AppendBatch writes messages at once rather than queueing them, so imports
+// larger than the queue aren't dropped
+func (ps *PostgresStore) AppendBatch(messages []ChatMessage) error {
+	return ps.batcher.writeNow(messages)
+}
+
+// insert writes a batch of messages in one transaction
+func (ps *PostgresStore) insert(batch []ChatMessage) error {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.Prepare(
+		`INSERT INTO chat_messages (stream_key, seq, id, user_id, username, message, created_at, origin_system, origin_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+	)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for _, msg := range batch {
+		var originSystem, originID sql.NullString
+		if msg.Origin != nil {
+			originSystem = sql.NullString{String: msg.Origin.System, Valid: true}
+			originID = sql.NullString{String: msg.Origin.ID, Valid: true}
+		}
+		if _, err := insert.Exec(msg.StreamKey, msg.Seq, msg.ID, msg.UserID, msg.Username, msg.Message, msg.Timestamp, originSystem, originID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ensurePartition creates a room's partition unless it is known to exist
+func (ps *PostgresStore) ensurePartition(streamKey string) error {
+	if _, exists := ps.partitions.Load(streamKey); exists {
+		return nil
+	}
+
+	_, err := ps.db.Exec(fmt.Sprintf(
+		`CREATE TABLE IF NOT EXISTS %s PARTITION OF chat_messages FOR VALUES IN (%s)`,
+		postgresPartition(streamKey), postgresLiteral(streamKey),
+	))
+	if err != nil {
+		return err
+	}
+	ps.partitions.Store(streamKey, struct{}{})
+	return nil
+}
+
+// SaveRoom records a room's state
+func (ps *PostgresStore) SaveRoom(room SavedRoom) error {
+	state, err := json.Marshal(room)
+	if err != nil {
+		return err
+	}
+
+	_, err = ps.db.Exec(
+		`INSERT INTO chat_rooms (stream_key, state) VALUES ($1, $2)
+		 ON CONFLICT (stream_key) DO UPDATE SET state = excluded.state`,
+		room.StreamKey, string(state),
+	)
+	return err
+}
+
+// DeleteRoom forgets a room's state
+func (ps *PostgresStore) DeleteRoom(streamKey string) error {
+	_, err := ps.db.Exec(`DELETE FROM chat_rooms WHERE stream_key = $1`, streamKey)
+	return err
+}
+
+// LoadRooms returns every saved room's state
+func (ps *PostgresStore) LoadRooms() ([]SavedRoom, error) {
+	return loadSaved[SavedRoom](ps.db, `SELECT state::text FROM chat_rooms`)
+}
+
+// SaveTimeout records a user's timeout
+func (ps *PostgresStore) SaveTimeout(timeout SavedTimeout) error {
+	state, err := json.Marshal(timeout)
+	if err != nil {
+		return err
+	}
+
+	_, err = ps.db.Exec(
+		`INSERT INTO chat_timeouts (user_id, state) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET state = excluded.state`,
+		timeout.UserID, string(state),
+	)
+	return err
+}
+
+// DeleteTimeout forgets a user's timeout
+func (ps *PostgresStore) DeleteTimeout(userID string) error {
+	_, err := ps.db.Exec(`DELETE FROM chat_timeouts WHERE user_id = $1`, userID)
+	return err
+}
+
+// LoadTimeouts returns every saved timeout
+func (ps *PostgresStore) LoadTimeouts() ([]SavedTimeout, error) {
+	return loadSaved[SavedTimeout](ps.db, `SELECT state::text FROM chat_timeouts`)
+}
+
+// SaveProfile records a user's profile
+func (ps *PostgresStore) SaveProfile(profile UserProfile) error {
+	state, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+
+	_, err = ps.db.Exec(
+		`INSERT INTO chat_profiles (user_id, state) VALUES ($1, $2)
+		 ON CONFLICT (user_id) DO UPDATE SET state = excluded.state`,
+		profile.UserID, string(state),
+	)
+	return err
+}
+
+// LoadProfile returns a user's profile, if one was saved
+func (ps *PostgresStore) LoadProfile(userID string) (UserProfile, bool, error) {
+	profiles, err := loadSaved[UserProfile](ps.db, `SELECT state::text FROM chat_profiles WHERE user_id = $1`, userID)
+	if err != nil || len(profiles) == 0 {
+		return UserProfile{}, false, err
+	}
+	return profiles[0], true, nil
+}
+
+// DeleteProfile forgets a user's profile
+func (ps *PostgresStore) DeleteProfile(userID string) error {
+	_, err := ps.db.Exec(`DELETE FROM chat_profiles WHERE user_id = $1`, userID)
+	return err
+}
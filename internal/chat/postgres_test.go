@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresPartitionNames(t *testing.T) {
+	name := postgresPartition("room'; DROP TABLE chat_messages; --")
+	require.Regexp(t, `^chat_messages_[0-9a-f]{24}$`, name)
+	require.Equal(t, name, postgresPartition("room'; DROP TABLE chat_messages; --"))
+	require.NotEqual(t, name, postgresPartition("other"))
+
+	require.Equal(t, `'it''s'`, postgresLiteral("it's"))
+}
+
+// searcherStore is a memory store whose searches come from a fixed result
+type searcherStore struct {
+	*MemoryStore
+	results []ChatMessage
+	err     error
+}
+
+func (s *searcherStore) Search(streamKey string, query SearchQuery) ([]ChatMessage, bool, error) {
+	return s.results, true, s.err
+}
+
+func TestSearchUsesMessageStore(t *testing.T) {
+	manager := NewManager(DefaultConfig())
+	defer manager.Stop()
+
+	store := &searcherStore{MemoryStore: NewMemoryStore(), results: []ChatMessage{{ID: "archived", Message: "hello"}}}
+	manager.SetMessageStore(store)
+	_, err := manager.AddMessage("stream", "user", "alice", "hello")
+	require.NoError(t, err)
+
+	messages, hasMore := manager.SearchMessages("stream", SearchQuery{Text: "hello"})
+	require.True(t, hasMore)
+	require.Equal(t, []string{"archived"}, messageIDs(messages))
+
+	// The buffer answers when the store can't
+	store.err = errors.New("down")
+	messages, hasMore = manager.SearchMessages("stream", SearchQuery{Text: "hello"})
+	require.False(t, hasMore)
+	require.Len(t, messages, 1)
+	require.NotEqual(t, "archived", messages[0].ID)
+}
+
+// TestPostgresStore runs against the database at CHAT_TEST_POSTGRES_URL
+func TestPostgresStore(t *testing.T) {
+	url := os.Getenv("CHAT_TEST_POSTGRES_URL")
+	if url == "" {
+		t.Skip("CHAT_TEST_POSTGRES_URL not set")
+	}
+
+	store, err := NewPostgresStore(url, DefaultWriteBatching())
+	require.NoError(t, err)
+	defer store.Close()
+
+	room := "test-" + uuid.New().String()
+	defer store.DropRoom(room)
+
+	now := time.Now().Truncate(time.Microsecond)
+	require.NoError(t, store.Append(ChatMessage{ID: "a", StreamKey: room, UserID: "u1", Username: "alice", Message: "old news", Seq: 1, Timestamp: now.Add(-time.Hour)}))
+	require.NoError(t, store.Append(ChatMessage{ID: "b", StreamKey: room, UserID: "u2", Username: "Bob", Message: "50% off_", Seq: 2, Timestamp: now, Origin: &MessageOrigin{System: "irc", ID: "7"}}))
+	require.NoError(t, store.Append(ChatMessage{ID: "c", StreamKey: room, UserID: "u1", Username: "alice", Message: "news again", Seq: 3, Timestamp: now}))
+
+	require.Eventually(t, func() bool {
+		messages, err := store.Range(room, 0, 0)
+		return err == nil && len(messages) == 3
+	}, 5*time.Second, 50*time.Millisecond)
+
+	messages, err := store.Range(room, 1, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, messageIDs(messages))
+	require.Equal(t, &MessageOrigin{System: "irc", ID: "7"}, messages[0].Origin)
+	require.True(t, now.Equal(messages[0].Timestamp))
+
+	messages, hasMore, err := store.Search(room, SearchQuery{Text: "NEWS", Limit: 1})
+	require.NoError(t, err)
+	require.True(t, hasMore)
+	require.Equal(t, []string{"c"}, messageIDs(messages))
+	messages, _, err = store.Search(room, SearchQuery{Text: "0% off_", User: "bob"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, messageIDs(messages))
+
+	removed, err := store.DeleteBefore(room, now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	deleted, err := store.DeleteByID(room, "c")
+	require.NoError(t, err)
+	require.True(t, deleted)
+
+	messages, err = store.Range(room, 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, messageIDs(messages))
+}
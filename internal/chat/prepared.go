@@ -0,0 +1,68 @@
+package chat
+
+import (
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// preparedFrame caches the encodings of a broadcast frame. Every recipient of a
+// broadcast gets a copy of the same WSMessage, and with it the same preparedFrame,
+// so the frame is marshalled once per wire format however large the room is.
+type preparedFrame struct {
+	mu        sync.Mutex
+	encodings map[frameFormat]*frameEncoding
+}
+
+// frameFormat is a wire format a frame is encoded in
+type frameFormat struct {
+	codec       Codec
+	messageType int // WebSocket message type of the prepared message; 0 for the bytes alone
+}
+
+// frameEncoding is a frame encoded in one format
+type frameEncoding struct {
+	once     sync.Once
+	data     []byte
+	prepared *websocket.PreparedMessage // nil outside WebSockets
+	err      error
+}
+
+// encode returns the message in the given format, marshalling it only for the
+// first caller asking for that format. It also returns how long marshalling took,
+// zero when the encoding was reused.
+func (p *preparedFrame) encode(format frameFormat, msg WSMessage) (*frameEncoding, time.Duration) {
+	p.mu.Lock()
+	if p.encodings == nil {
+		p.encodings = make(map[frameFormat]*frameEncoding)
+	}
+	enc := p.encodings[format]
+	if enc == nil {
+		enc = &frameEncoding{}
+		p.encodings[format] = enc
+	}
+	p.mu.Unlock()
+
+	var elapsed time.Duration
+	enc.once.Do(func() {
+		start := time.Now()
+		msg.prepared = nil
+		enc.data, enc.err = format.codec.Marshal(msg)
+		if enc.err == nil && format.messageType != 0 {
+			enc.prepared, enc.err = websocket.NewPreparedMessage(format.messageType, enc.data)
+		}
+		elapsed = time.Since(start)
+	})
+	return enc, elapsed
+}
+
+// marshal encodes a frame with the codec, reusing the encoding other recipients of
+// the same broadcast already made
+func marshal(codec Codec, msg WSMessage) ([]byte, error) {
+	if msg.prepared == nil {
+		return codec.Marshal(msg)
+	}
+	enc, _ := msg.prepared.encode(frameFormat{codec: codec}, msg)
+	return enc.data, enc.err
+}
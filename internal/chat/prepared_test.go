@@ -0,0 +1,51 @@
+package chat
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// countingCodec counts the frames of each type it marshals
+type countingCodec struct {
+	stdJSONCodec
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (c *countingCodec) Marshal(v interface{}) ([]byte, error) {
+	if msg, ok := v.(WSMessage); ok {
+		c.mu.Lock()
+		c.counts[msg.Type]++
+		c.mu.Unlock()
+	}
+	return c.stdJSONCodec.Marshal(v)
+}
+
+func (c *countingCodec) count(msgType string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.counts[msgType]
+}
+
+func TestBroadcastMarshalsOnce(t *testing.T) {
+	h, server := newTestHandler(t)
+	codec := &countingCodec{counts: make(map[string]int)}
+	h.codec = codec
+
+	clients := []*websocket.Conn{}
+	for _, userID := range []string{"alice", "bob", "carol"} {
+		conn := dialTestClient(t, server, "room")
+		joinTestClient(t, conn, userID)
+		clients = append(clients, conn)
+	}
+
+	h.BroadcastSystemMessage("room", "hello everyone")
+	for _, conn := range clients {
+		msg := readUntil(t, conn, "system")
+		require.Equal(t, "hello everyone", msg["data"].(map[string]interface{})["message"])
+	}
+	require.Equal(t, 1, codec.count("system"))
+}
@@ -0,0 +1,77 @@
+package chat
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// Deployment profiles accepted by CHAT_PROFILE
+const (
+	ProfileSmall  = "small"
+	ProfileMedium = "medium"
+	ProfileLarge  = "large"
+)
+
+// ApplyProfile tunes the config for a deployment size. Every profile sets the same
+// knobs, so switching profiles never leaves one at another profile's value; they
+// only set a coherent baseline, and individual CHAT_* variables still override any
+// value they touch.
+func (c *ChatConfig) ApplyProfile(profile string) error {
+	switch profile {
+	case ProfileSmall:
+		// A handful of streams on a small VPS
+		c.MaxTotalMemoryMB = 32
+		c.MaxMessagesPerStream = 200
+		c.MinMessagesPerStream = 25
+		c.MaxUsersPerStream = 100
+		c.MessageRetentionMinutes = 15
+		c.CleanupIntervalMinutes = 5
+		c.RoomDeletionGraceMinutes = 10
+		c.JoinHistorySize = 50
+		c.SendQueueSize = 64
+		c.BatchWindowMs = 0
+		c.WriteWorkers = 0 // a writer per connection is cheap at this size
+		c.PersistBatchSize = 64
+		c.PersistFlushIntervalMs = 500
+		c.PersistQueueSize = 1000
+
+	case ProfileMedium:
+		// Dozens of streams with a few hundred viewers each
+		c.MaxTotalMemoryMB = 100
+		c.MaxMessagesPerStream = 500
+		c.MinMessagesPerStream = 50
+		c.MaxUsersPerStream = 1000
+		c.MessageRetentionMinutes = 30
+		c.CleanupIntervalMinutes = 5
+		c.RoomDeletionGraceMinutes = 30
+		c.JoinHistorySize = 100
+		c.SendQueueSize = 256
+		c.BatchWindowMs = 20
+		c.WriteWorkers = 2 * runtime.GOMAXPROCS(0)
+		c.PersistBatchSize = 256
+		c.PersistFlushIntervalMs = 200
+		c.PersistQueueSize = 10000
+
+	case ProfileLarge:
+		// Hundreds of streams and rooms with thousands of chatters
+		c.MaxTotalMemoryMB = 1024
+		c.MaxMessagesPerStream = 1000
+		c.MinMessagesPerStream = 100
+		c.MaxUsersPerStream = 20000
+		c.MessageRetentionMinutes = 60
+		c.CleanupIntervalMinutes = 2
+		c.RoomDeletionGraceMinutes = 60
+		c.JoinHistorySize = 25
+		c.SendQueueSize = 512
+		c.BatchWindowMs = 50
+		c.WriteWorkers = 4 * runtime.GOMAXPROCS(0)
+		c.PersistBatchSize = 1024
+		c.PersistFlushIntervalMs = 100
+		c.PersistQueueSize = 50000
+
+	default:
+		return fmt.Errorf("unknown chat profile %q", profile)
+	}
+
+	return nil
+}
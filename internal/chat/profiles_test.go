@@ -0,0 +1,43 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilesSetEveryKnob(t *testing.T) {
+	for _, profile := range []string{ProfileSmall, ProfileMedium, ProfileLarge} {
+		t.Run(profile, func(t *testing.T) {
+			// Start from values no profile uses, so any knob a profile skips shows up
+			config := ChatConfig{}
+			knobs := map[string]*int{
+				"MaxTotalMemoryMB":         &config.MaxTotalMemoryMB,
+				"MaxMessagesPerStream":     &config.MaxMessagesPerStream,
+				"MinMessagesPerStream":     &config.MinMessagesPerStream,
+				"MaxUsersPerStream":        &config.MaxUsersPerStream,
+				"MessageRetentionMinutes":  &config.MessageRetentionMinutes,
+				"CleanupIntervalMinutes":   &config.CleanupIntervalMinutes,
+				"RoomDeletionGraceMinutes": &config.RoomDeletionGraceMinutes,
+				"JoinHistorySize":          &config.JoinHistorySize,
+				"SendQueueSize":            &config.SendQueueSize,
+				"BatchWindowMs":            &config.BatchWindowMs,
+				"WriteWorkers":             &config.WriteWorkers,
+				"PersistBatchSize":         &config.PersistBatchSize,
+				"PersistFlushIntervalMs":   &config.PersistFlushIntervalMs,
+				"PersistQueueSize":         &config.PersistQueueSize,
+			}
+			for _, knob := range knobs {
+				*knob = -1
+			}
+
+			require.NoError(t, config.ApplyProfile(profile))
+			for name, knob := range knobs {
+				require.NotEqual(t, -1, *knob, "%s profile doesn't set %s", profile, name)
+			}
+			require.LessOrEqual(t, config.MinMessagesPerStream, config.MaxMessagesPerStream)
+		})
+	}
+
+	require.Error(t, (&ChatConfig{}).ApplyProfile("huge"))
+}
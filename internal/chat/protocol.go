@@ -0,0 +1,180 @@
+package chat
+
+//go:generate go run ./protocolgen -ts ../../web/src/utils/chatProtocol.ts -go ./chatclient/protocol_gen.go -schema ./protocol.schema.json
+
+import "time"
+
+// HelloEvent is the payload of the "hello" frame that opens every session
+type HelloEvent struct {
+	ProtocolVersion    int             `json:"protocolVersion"`
+	MinProtocolVersion int             `json:"minProtocolVersion"`
+	Features           map[string]bool `json:"features"`
+}
+
+// UserEvent is the payload of "user_joined", "user_left" and "user_updated" frames,
+// and of the "username_assigned" frame telling a client the name it joined under
+// when the one it asked for was taken. Color comes from the user's profile, and
+// Badges from their roles in the room and their profile.
+type UserEvent struct {
+	UserID   string   `json:"userId"`
+	Username string   `json:"username"`
+	Color    string   `json:"color,omitempty"`
+	Badges   []string `json:"badges,omitempty"`
+}
+
+// TypingEvent is the payload of a "typing" frame sent to the rest of the room
+type TypingEvent struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	IsTyping bool   `json:"isTyping"`
+}
+
+// SystemEvent is the payload of a "system" frame
+type SystemEvent struct {
+	Message string `json:"message"`
+}
+
+// TimeoutEvent is the payload of a "timeout" frame
+type TimeoutEvent struct {
+	Duration float64 `json:"duration"` // seconds remaining
+}
+
+// PongEvent is the payload of the "pong" frame answering a client ping. Clients
+// measure latency from ClientTime and estimate clock skew from ServerTime.
+type PongEvent struct {
+	ClientTime int64 `json:"clientTime"` // echoed from the ping, milliseconds since the Unix epoch
+	ServerTime int64 `json:"serverTime"` // when the server answered, milliseconds since the Unix epoch
+}
+
+// RoomLimits are the limits a room enforces on each user's messages
+type RoomLimits struct {
+	MaxMessageLength     int `json:"maxMessageLength"`     // characters
+	MaxMessagesPerMinute int `json:"maxMessagesPerMinute"` // before rate limiting kicks in
+
+	// Message frequency limits. A message is rejected if the user already sent a
+	// window's number of messages within it; slow mode is in the room's modes.
+	RateWindows []RateWindow `json:"rateWindows"`
+}
+
+// RoomState is the payload of the "room_state" frame sent after a successful join,
+// so clients can adapt their UI to the room instead of hard-coding its rules
+type RoomState struct {
+	Modes    RoomModes       `json:"modes"`
+	Limits   RoomLimits      `json:"limits"`
+	Features map[string]bool `json:"features"`
+}
+
+// ReservedEvent is the payload of the "reserved" frame answering a reserve. The
+// client sends its message with this ID before ExpiresAt, and the server broadcasts
+// the message under it.
+type ReservedEvent struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+// MissedEvent is the payload of the "missed" frame answering an ack: the room's
+// messages after the acknowledged sequence number, oldest first, up to 100 of them.
+// Complete is false when more follow, which the client gets by acking the last
+// message, or when some of them are no longer stored, so it can't fill the gap.
+type MissedEvent struct {
+	Messages []ChatMessage `json:"messages"`
+	Complete bool          `json:"complete"`
+}
+
+// HistoryPageEvent is the payload of the "history_page" frame answering a
+// history_request: messages older than the requested one, oldest first
+type HistoryPageEvent struct {
+	Messages []ChatMessage `json:"messages"`
+	HasMore  bool          `json:"hasMore"` // older messages remain; request them before Messages[0]
+}
+
+// BackpressureEvent is the payload of a "backpressure" frame. While Digest is set
+// the client's send queue has been backed up, so it should ease off (e.g. stop
+// sending typing indicators) and gets chat messages as message_batch frames every
+// IntervalSeconds. The frame ending the episode reports the messages Skipped
+// because a digest was full.
+type BackpressureEvent struct {
+	Digest          bool   `json:"digest"`
+	IntervalSeconds int    `json:"intervalSeconds,omitempty"`
+	Message         string `json:"message,omitempty"`
+	Skipped         int    `json:"skipped,omitempty"`
+}
+
+// DrainEvent is the payload of the "drain" frame sent when the server starts
+// shutting down. The connection is closed within Seconds; the client should then
+// reconnect, to ReconnectURL when one is given.
+type DrainEvent struct {
+	ReconnectURL string `json:"reconnectUrl,omitempty"` // scheme and host of the instance to reconnect to
+	Seconds      int    `json:"seconds"`
+}
+
+// RedactedEvent is the payload of a "messages_redacted" frame: messages taken down
+// because their author's data was erased. Clients should remove them, and any
+// other messages from UserID they still show.
+type RedactedEvent struct {
+	UserID     string   `json:"userId"`
+	MessageIDs []string `json:"messageIds"`
+}
+
+// Frame directions
+const (
+	ClientToServer = "client"
+	ServerToClient = "server"
+)
+
+// ProtocolFrame describes one frame type of the chat protocol
+type ProtocolFrame struct {
+	Type      string
+	Direction string
+	Data      interface{} // zero value of the payload type, or nil for frames without data
+}
+
+// Protocol lists every frame type clients can send or receive. The client SDK
+// types are generated from it, so new frames must be added here.
+var Protocol = []ProtocolFrame{
+	{Type: "hello", Direction: ClientToServer, Data: HelloFrame{}},
+	{Type: "join", Direction: ClientToServer, Data: JoinFrame{}},
+	{Type: "message", Direction: ClientToServer, Data: ChatFrame{}},
+	{Type: "typing", Direction: ClientToServer, Data: TypingFrame{}},
+	{Type: "ping", Direction: ClientToServer, Data: PingFrame{}},
+	{Type: "reserve", Direction: ClientToServer, Data: ReserveFrame{}},
+	{Type: "stats", Direction: ClientToServer, Data: StatsFrame{}},
+	{Type: "ack", Direction: ClientToServer, Data: AckFrame{}},
+	{Type: "join_room", Direction: ClientToServer, Data: JoinRoomFrame{}},
+	{Type: "leave_room", Direction: ClientToServer, Data: LeaveRoomFrame{}},
+	{Type: "history_request", Direction: ClientToServer, Data: HistoryRequestFrame{}},
+	{Type: "set_profile", Direction: ClientToServer, Data: SetProfileFrame{}},
+	{Type: "moderate", Direction: ClientToServer, Data: ModerateFrame{}},
+
+	{Type: "hello", Direction: ServerToClient, Data: HelloEvent{}},
+	{Type: "history", Direction: ServerToClient, Data: []ChatMessage{}},
+	{Type: "users", Direction: ServerToClient, Data: []*ChatUser{}},
+	{Type: "message", Direction: ServerToClient, Data: &ChatMessage{}},
+	{Type: "message_batch", Direction: ServerToClient, Data: []*ChatMessage{}},
+	{Type: "user_joined", Direction: ServerToClient, Data: UserEvent{}},
+	{Type: "user_left", Direction: ServerToClient, Data: UserEvent{}},
+	{Type: "user_updated", Direction: ServerToClient, Data: UserEvent{}},
+	{Type: "username_assigned", Direction: ServerToClient, Data: UserEvent{}},
+	{Type: "profile", Direction: ServerToClient, Data: UserProfile{}},
+	{Type: "guest", Direction: ServerToClient, Data: GuestEvent{}},
+	{Type: "typing", Direction: ServerToClient, Data: TypingEvent{}},
+	{Type: "system", Direction: ServerToClient, Data: SystemEvent{}},
+	{Type: "timeout", Direction: ServerToClient, Data: TimeoutEvent{}},
+	{Type: "timeout_ended", Direction: ServerToClient},
+	{Type: "room_state", Direction: ServerToClient, Data: RoomState{}},
+	{Type: "room_modes", Direction: ServerToClient, Data: RoomModes{}},
+	{Type: "chat_cleared", Direction: ServerToClient},
+	{Type: "moderation", Direction: ServerToClient, Data: ModerationEvent{}},
+	{Type: "messages_redacted", Direction: ServerToClient, Data: RedactedEvent{}},
+	{Type: EventViewerCountChanged, Direction: ServerToClient, Data: ViewerCountEvent{}},
+	{Type: "pong", Direction: ServerToClient, Data: PongEvent{}},
+	{Type: "reserved", Direction: ServerToClient, Data: ReservedEvent{}},
+	{Type: "room_stats", Direction: ServerToClient, Data: RoomStatsEvent{}},
+	{Type: "room_left", Direction: ServerToClient},
+	{Type: "missed", Direction: ServerToClient, Data: MissedEvent{}},
+	{Type: "history_page", Direction: ServerToClient, Data: HistoryPageEvent{}},
+	{Type: "backpressure", Direction: ServerToClient, Data: BackpressureEvent{}},
+	{Type: "drain", Direction: ServerToClient, Data: DrainEvent{}},
+	{Type: "rate_limit", Direction: ServerToClient},
+	{Type: "error", Direction: ServerToClient},
+}
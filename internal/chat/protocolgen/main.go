@@ -0,0 +1,502 @@
+// Command protocolgen generates the TypeScript and Go client definitions, and a
+// JSON Schema for clients in other languages, of the chat protocol from the
+// server's typed frames in chat.Protocol and its error codes in chat.ErrorCodes.
+//
+// Run it through go generate in internal/chat.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/glimesh/broadcast-box/internal/chat"
+)
+
+const header = "Code generated by protocolgen from internal/chat. DO NOT EDIT."
+
+var (
+	timeType      = reflect.TypeOf(time.Time{})
+	wsMessageType = reflect.TypeOf(chat.WSMessage{})
+)
+
+func main() {
+	tsPath := flag.String("ts", "", "write TypeScript definitions to this file")
+	goPath := flag.String("go", "", "write the Go client definitions to this file")
+	schemaPath := flag.String("schema", "", "write a JSON Schema of the frames to this file")
+	flag.Parse()
+
+	if *tsPath != "" {
+		if err := os.WriteFile(*tsPath, generateTS(chat.Protocol), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *goPath != "" {
+		src, err := generateGo(chat.Protocol)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(*goPath, src, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if *schemaPath != "" {
+		schema, err := generateSchema(chat.Protocol)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err := os.WriteFile(*schemaPath, schema, 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// field is an exported, JSON-visible struct field
+type field struct {
+	goName   string
+	jsonName string
+	optional bool
+	typ      reflect.Type
+}
+
+// jsonFields returns the fields of a struct as encoding/json sees them
+func jsonFields(t reflect.Type) []field {
+	fields := []field{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, field{
+			goName:   f.Name,
+			jsonName: name,
+			optional: strings.Contains(opts, "omitempty"),
+			typ:      f.Type,
+		})
+	}
+	return fields
+}
+
+// namedStructs returns the struct types reachable from the protocol's payloads and
+// the server envelope, parents before the types they reference
+func namedStructs(frames []chat.ProtocolFrame) []reflect.Type {
+	seen := map[reflect.Type]bool{wsMessageType: true}
+	structs := []reflect.Type{}
+
+	var visit func(t reflect.Type)
+	visit = func(t reflect.Type) {
+		switch t.Kind() {
+		case reflect.Pointer, reflect.Slice, reflect.Array, reflect.Map:
+			visit(t.Elem())
+		case reflect.Struct:
+			if t == timeType || seen[t] {
+				return
+			}
+			seen[t] = true
+			structs = append(structs, t)
+			for _, f := range jsonFields(t) {
+				visit(f.typ)
+			}
+		}
+	}
+
+	for _, frame := range frames {
+		if frame.Data != nil {
+			visit(reflect.TypeOf(frame.Data))
+		}
+	}
+	for _, f := range jsonFields(wsMessageType) {
+		visit(f.typ)
+	}
+	return structs
+}
+
+// payloadComment describes which frames carry a struct in their data
+func payloadComment(t reflect.Type, frames []chat.ProtocolFrame) string {
+	uses := map[string][]string{}
+	for _, frame := range frames {
+		if frame.Data == nil {
+			continue
+		}
+		dt := reflect.TypeOf(frame.Data)
+		for dt.Kind() == reflect.Pointer || dt.Kind() == reflect.Slice {
+			dt = dt.Elem()
+		}
+		if dt == t {
+			uses[frame.Direction] = append(uses[frame.Direction], fmt.Sprintf("%q", frame.Type))
+		}
+	}
+
+	parts := []string{}
+	for _, direction := range []string{chat.ClientToServer, chat.ServerToClient} {
+		if types := uses[direction]; len(types) > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s", direction, strings.Join(types, ", ")))
+		}
+	}
+
+	if len(parts) == 0 {
+		if parent := parentStruct(t, frames); parent != nil {
+			return fmt.Sprintf("%s is part of %s", t.Name(), parent.Name())
+		}
+		return fmt.Sprintf("%s is part of the server frame envelope", t.Name())
+	}
+	return fmt.Sprintf("%s is carried by %s frames", t.Name(), strings.Join(parts, " and "))
+}
+
+// parentStruct returns the first protocol struct with a field of type t
+func parentStruct(t reflect.Type, frames []chat.ProtocolFrame) reflect.Type {
+	for _, parent := range namedStructs(frames) {
+		for _, f := range jsonFields(parent) {
+			ft := f.typ
+			for ft.Kind() == reflect.Pointer || ft.Kind() == reflect.Slice {
+				ft = ft.Elem()
+			}
+			if ft == t {
+				return parent
+			}
+		}
+	}
+	return nil
+}
+
+// tsType renders a Go type as TypeScript
+func tsType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return tsType(t.Elem())
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return tsType(t.Elem()) + "[]"
+	case reflect.Map:
+		return fmt.Sprintf("Record<%s, %s>", tsType(t.Key()), tsType(t.Elem()))
+	case reflect.Struct:
+		if t == timeType {
+			return "string"
+		}
+		return t.Name()
+	}
+	return "unknown"
+}
+
+// generateTS renders the protocol as TypeScript definitions
+func generateTS(frames []chat.ProtocolFrame) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s\n\n", header)
+	fmt.Fprintf(&b, "export const PROTOCOL_VERSION = %d;\n", chat.ProtocolVersion)
+	fmt.Fprintf(&b, "export const MIN_PROTOCOL_VERSION = %d;\n", chat.MinProtocolVersion)
+
+	for _, t := range namedStructs(frames) {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "// %s\n", payloadComment(t, frames))
+		fmt.Fprintf(&b, "export interface %s {\n", t.Name())
+		for _, f := range jsonFields(t) {
+			optional := ""
+			if f.optional {
+				optional = "?"
+			}
+			fmt.Fprintf(&b, "  %s%s: %s;\n", f.jsonName, optional, tsType(f.typ))
+		}
+		b.WriteString("}\n")
+	}
+
+	b.WriteString("\n// Codes of \"error\" and \"rate_limit\" frames\nexport type ErrorCode =\n")
+	for i, info := range chat.ErrorCodes {
+		end := "\n"
+		if i == len(chat.ErrorCodes)-1 {
+			end = ";\n"
+		}
+		fmt.Fprintf(&b, "  // %s\n  | '%s'%s", info.Description, info.Code, end)
+	}
+
+	// Everything in the server envelope besides type and data
+	b.WriteString("\n// Fields shared by every server frame\n")
+	b.WriteString("export interface ServerFrameEnvelope {\n")
+	for _, f := range jsonFields(wsMessageType) {
+		if f.jsonName == "type" || f.jsonName == "data" {
+			continue
+		}
+		optional := ""
+		if f.optional {
+			optional = "?"
+		}
+		typ := tsType(f.typ)
+		if f.jsonName == "code" {
+			typ = "ErrorCode"
+		}
+		fmt.Fprintf(&b, "  %s%s: %s;\n", f.jsonName, optional, typ)
+	}
+	b.WriteString("}\n")
+
+	b.WriteString("\n// Frames a client sends\nexport type ClientFrame =\n")
+	b.WriteString(tsUnion(frames, chat.ClientToServer) + ";\n")
+
+	b.WriteString("\n// Frames the server sends\nexport type ServerFrame = ServerFrameEnvelope & (\n")
+	b.WriteString(tsUnion(frames, chat.ServerToClient) + "\n);\n")
+
+	return b.Bytes()
+}
+
+// tsUnion renders the frames of one direction as a discriminated union
+func tsUnion(frames []chat.ProtocolFrame, direction string) string {
+	members := []string{}
+	for _, frame := range frames {
+		if frame.Direction != direction {
+			continue
+		}
+		if frame.Data == nil {
+			members = append(members, fmt.Sprintf("  | { type: '%s' }", frame.Type))
+			continue
+		}
+		members = append(members, fmt.Sprintf("  | { type: '%s'; data: %s }", frame.Type, tsType(reflect.TypeOf(frame.Data))))
+	}
+	return strings.Join(members, "\n")
+}
+
+// goType renders a Go type as it is spelled in the client package
+func goType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return "*" + goType(t.Elem())
+	case reflect.Slice:
+		return "[]" + goType(t.Elem())
+	case reflect.Map:
+		return fmt.Sprintf("map[%s]%s", goType(t.Key()), goType(t.Elem()))
+	case reflect.Interface:
+		return "json.RawMessage"
+	case reflect.Struct:
+		if t == timeType {
+			return "time.Time"
+		}
+		return t.Name()
+	}
+	return t.Kind().String()
+}
+
+// frameConstName turns a frame type such as "user_joined" into FrameUserJoined
+func frameConstName(frameType string) string {
+	name := "Frame"
+	for _, part := range strings.Split(frameType, "_") {
+		name += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return name
+}
+
+// codeConstName turns an error code such as "ROOM_FULL" into CodeRoomFull
+func codeConstName(code string) string {
+	name := "Code"
+	for _, part := range strings.Split(strings.ToLower(code), "_") {
+		name += strings.ToUpper(part[:1]) + part[1:]
+	}
+	return name
+}
+
+// generateGo renders the protocol as Go definitions for the chatclient package
+func generateGo(frames []chat.ProtocolFrame) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// %s\n\npackage chatclient\n\n", header)
+	b.WriteString("import (\n\t\"encoding/json\"\n\t\"time\"\n)\n\n")
+
+	b.WriteString("// Protocol versions the server speaks\nconst (\n")
+	fmt.Fprintf(&b, "\tProtocolVersion = %d\n", chat.ProtocolVersion)
+	fmt.Fprintf(&b, "\tMinProtocolVersion = %d\n", chat.MinProtocolVersion)
+	b.WriteString(")\n\n")
+
+	b.WriteString("// Frame types\nconst (\n")
+	seen := map[string]bool{}
+	for _, frame := range frames {
+		if !seen[frame.Type] {
+			seen[frame.Type] = true
+			fmt.Fprintf(&b, "\t%s = %q\n", frameConstName(frame.Type), frame.Type)
+		}
+	}
+	b.WriteString(")\n")
+
+	b.WriteString("\n// Codes of \"error\" and \"rate_limit\" frames\nconst (\n")
+	for _, info := range chat.ErrorCodes {
+		fmt.Fprintf(&b, "\t// %s\n\t%s = %q\n", info.Description, codeConstName(info.Code), info.Code)
+	}
+	b.WriteString(")\n")
+
+	for _, t := range namedStructs(frames) {
+		b.WriteString("\n")
+		fmt.Fprintf(&b, "// %s\n", payloadComment(t, frames))
+		writeGoStruct(&b, t.Name(), jsonFields(t))
+	}
+
+	b.WriteString("\n// ServerFrame is a frame received from the server. Decode Data with the payload type for Type.\n")
+	writeGoStruct(&b, "ServerFrame", jsonFields(wsMessageType))
+
+	b.WriteString("\n// ClientFrame is a frame sent to the server\n")
+	b.WriteString("type ClientFrame struct {\n\tType string `json:\"type\"`\n\tData interface{} `json:\"data\"`\n}\n")
+
+	return format.Source(b.Bytes())
+}
+
+func writeGoStruct(b *bytes.Buffer, name string, fields []field) {
+	fmt.Fprintf(b, "type %s struct {\n", name)
+	for _, f := range fields {
+		tag := f.jsonName
+		if f.optional {
+			tag += ",omitempty"
+		}
+		fmt.Fprintf(b, "\t%s %s `json:%q`\n", f.goName, goType(f.typ), tag)
+	}
+	b.WriteString("}\n")
+}
+
+// schemaObject is a JSON Schema node. encoding/json sorts its keys, so the output is stable.
+type schemaObject map[string]interface{}
+
+// schemaType renders a Go type as a JSON Schema, referring to protocol structs by name
+func schemaType(t reflect.Type) schemaObject {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaType(t.Elem())
+	case reflect.String:
+		return schemaObject{"type": "string"}
+	case reflect.Bool:
+		return schemaObject{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return schemaObject{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return schemaObject{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return schemaObject{"type": "array", "items": schemaType(t.Elem())}
+	case reflect.Map:
+		return schemaObject{"type": "object", "additionalProperties": schemaType(t.Elem())}
+	case reflect.Struct:
+		if t == timeType {
+			return schemaObject{"type": "string", "format": "date-time"}
+		}
+		return schemaObject{"$ref": "#/$defs/" + t.Name()}
+	}
+	return schemaObject{}
+}
+
+// schemaStruct renders struct fields as an object schema. Fields without omitempty are required.
+func schemaStruct(description string, fields []field) schemaObject {
+	properties := schemaObject{}
+	required := []string{}
+	for _, f := range fields {
+		properties[f.jsonName] = schemaType(f.typ)
+		if !f.optional {
+			required = append(required, f.jsonName)
+		}
+	}
+
+	schema := schemaObject{"type": "object", "properties": properties}
+	if description != "" {
+		schema["description"] = description
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// schemaUnion renders the frames of one direction as schemas discriminated by type
+func schemaUnion(frames []chat.ProtocolFrame, direction string) []schemaObject {
+	members := []schemaObject{}
+	for _, frame := range frames {
+		if frame.Direction != direction {
+			continue
+		}
+
+		properties := schemaObject{"type": schemaObject{"const": frame.Type}}
+		required := []string{"type"}
+		if frame.Data != nil {
+			properties["data"] = schemaType(reflect.TypeOf(frame.Data))
+			required = append(required, "data")
+		}
+		members = append(members, schemaObject{"type": "object", "properties": properties, "required": required})
+	}
+	return members
+}
+
+// generateSchema renders the protocol as a JSON Schema matching any client or server frame
+func generateSchema(frames []chat.ProtocolFrame) ([]byte, error) {
+	defs := schemaObject{}
+	for _, t := range namedStructs(frames) {
+		defs[t.Name()] = schemaStruct(payloadComment(t, frames), jsonFields(t))
+	}
+
+	// Everything in the server envelope besides type and data
+	envelope := []field{}
+	for _, f := range jsonFields(wsMessageType) {
+		if f.jsonName != "type" && f.jsonName != "data" {
+			envelope = append(envelope, f)
+		}
+	}
+	envelopeSchema := schemaStruct("Fields shared by every server frame", envelope)
+	envelopeSchema["properties"].(schemaObject)["code"] = schemaObject{"$ref": "#/$defs/ErrorCode"}
+	defs["ServerFrameEnvelope"] = envelopeSchema
+
+	codes := []string{}
+	for _, info := range chat.ErrorCodes {
+		codes = append(codes, info.Code)
+	}
+	defs["ErrorCode"] = schemaObject{
+		"description": `Codes of "error" and "rate_limit" frames`,
+		"type":        "string",
+		"enum":        codes,
+	}
+
+	defs["ClientFrame"] = schemaObject{
+		"description": "Frames a client sends",
+		"oneOf":       schemaUnion(frames, chat.ClientToServer),
+	}
+	defs["ServerFrame"] = schemaObject{
+		"description": "Frames the server sends",
+		"allOf": []schemaObject{
+			{"$ref": "#/$defs/ServerFrameEnvelope"},
+			{"oneOf": schemaUnion(frames, chat.ServerToClient)},
+		},
+	}
+
+	schema := schemaObject{
+		"$schema":            "https://json-schema.org/draft/2020-12/schema",
+		"$comment":           header,
+		"title":              "Chat protocol",
+		"description":        fmt.Sprintf("Frames of chat protocol version %d; servers accept clients down to version %d", chat.ProtocolVersion, chat.MinProtocolVersion),
+		"protocolVersion":    chat.ProtocolVersion,
+		"minProtocolVersion": chat.MinProtocolVersion,
+		"anyOf": []schemaObject{
+			{"$ref": "#/$defs/ClientFrame"},
+			{"$ref": "#/$defs/ServerFrame"},
+		},
+		"$defs": defs,
+	}
+
+	out, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(out, '\n'), nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/glimesh/broadcast-box/internal/chat"
+	"github.com/stretchr/testify/require"
+)
+
+// The generated definitions are committed; this fails when they fall behind the
+// server's protocol. Run go generate ./internal/chat to refresh them.
+func TestGeneratedFilesUpToDate(t *testing.T) {
+	ts, err := os.ReadFile("../../../web/src/utils/chatProtocol.ts")
+	require.NoError(t, err)
+	require.Equal(t, string(generateTS(chat.Protocol)), string(ts))
+
+	goSrc, err := generateGo(chat.Protocol)
+	require.NoError(t, err)
+	committed, err := os.ReadFile("../chatclient/protocol_gen.go")
+	require.NoError(t, err)
+	require.Equal(t, string(goSrc), string(committed))
+
+	schema, err := generateSchema(chat.Protocol)
+	require.NoError(t, err)
+	committed, err = os.ReadFile("../protocol.schema.json")
+	require.NoError(t, err)
+	require.Equal(t, string(schema), string(committed))
+}
@@ -1,16 +1,25 @@
 package chat
 
 import (
+	"fmt"
+	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
+// recordIdleTimeout is how long a user's rate record outlives their last message
+const recordIdleTimeout = 30 * time.Minute
+
 // RateLimiter handles rate limiting for chat messages
 type RateLimiter struct {
-	config      *ChatConfig
-	userRecords map[string]*UserRateRecord
-	mutex       sync.RWMutex
+	config *ChatConfig
+	shards []*rateLimitShard // user records by user ID hash
+	wheel  *timerWheel       // timeout ends and idle record expiry
+
+	onTimeoutEnded atomic.Pointer[func(userID string)]
+	timeoutStore   atomic.Pointer[TimeoutStore]
 }
 
 // UserRateRecord tracks rate limiting data for a user
@@ -20,36 +29,81 @@ type UserRateRecord struct {
 	MessageContents  []string         // Content of recent messages for spam detection
 	CharCountHistory []int            // Character counts
 	TimeoutUntil     time.Time
+	TimeoutTier      string // the limit that earned the current timeout
 	Violations       int
 	LastCleanup      time.Time
+
+	mu      sync.Mutex // guards the record; taken after the shard's mutex when both are held
+	removed bool       // the record was dropped from its shard, so a new one must be looked up
+}
+
+// RateWindow limits how many messages a user may have sent within a window before
+// sending another. Windows with a MinLength only apply to messages longer than it.
+type RateWindow struct {
+	Tier          string `json:"tier"` // reported in ErrorDetails when the window is exceeded
+	Messages      int    `json:"messages"`
+	WindowSeconds int    `json:"windowSeconds"`
+	MinLength     int    `json:"minLength,omitempty"` // characters
+}
+
+// duration is the window's length
+func (w RateWindow) duration() time.Duration {
+	return time.Duration(w.WindowSeconds) * time.Second
+}
+
+// The message frequency tiers CheckMessage enforces, advertised to clients by Policy
+var (
+	burstWindow         = RateWindow{Tier: TierBurst, Messages: 5, WindowSeconds: 10}
+	spamWindow          = RateWindow{Tier: TierSpam, Messages: 10, WindowSeconds: 30}
+	heavySpamWindow     = RateWindow{Tier: TierHeavySpam, Messages: 20, WindowSeconds: 60}
+	longMessageWindow   = RateWindow{Tier: TierLongMessage, Messages: 1, WindowSeconds: 10, MinLength: 300}
+	mediumMessageWindow = RateWindow{Tier: TierMediumMessage, Messages: 3, WindowSeconds: 10, MinLength: 100}
+)
+
+// Policy returns the frequency limits messages are checked against, so clients can
+// hold back messages that would be rejected
+func (rl *RateLimiter) Policy() []RateWindow {
+	return []RateWindow{burstWindow, spamWindow, heavySpamWindow, longMessageWindow, mediumMessageWindow}
 }
 
 // NewRateLimiter creates a new rate limiter
 func NewRateLimiter(config *ChatConfig) *RateLimiter {
 	rl := &RateLimiter{
-		config:      config,
-		userRecords: make(map[string]*UserRateRecord),
+		config: config,
+		shards: newRateLimitShards(),
+		wheel:  newTimerWheel(time.Second),
 	}
 
-	// Start cleanup worker
-	go rl.cleanupWorker()
+	go rl.wheel.run()
 
 	return rl
 }
 
+// OnTimeoutEnded sets a function called with the user's ID when a timeout ends
+func (rl *RateLimiter) OnTimeoutEnded(fn func(userID string)) {
+	rl.onTimeoutEnded.Store(&fn)
+}
+
+// Stop stops the rate limiter's timers
+func (rl *RateLimiter) Stop() {
+	rl.wheel.Stop()
+}
+
 // CheckMessage checks if a message is allowed based on rate limits
 func (rl *RateLimiter) CheckMessage(userID, message string) (bool, *ChatError) {
-	rl.mutex.Lock()
-	defer rl.mutex.Unlock()
-
-	record := rl.getOrCreateRecord(userID)
+	record := rl.lockRecord(userID)
+	defer record.mu.Unlock()
 	now := time.Now()
 
+	// Schedules the end of any timeout this message earns
+	defer rl.watchTimeout(record, record.TimeoutUntil)
+
 	// Check if user is timed out
 	if now.Before(record.TimeoutUntil) {
 		return false, &ChatError{
-			Code:    "TIMEOUT",
+			Code:    CodeTimeout,
 			Message: "You are timed out. Please wait before sending messages.",
+			Details: &ErrorDetails{RetryAfterSeconds: retryAfter(record.TimeoutUntil.Sub(now)), Tier: record.TimeoutTier},
 		}
 	}
 
@@ -61,102 +115,113 @@ func (rl *RateLimiter) CheckMessage(userID, message string) (bool, *ChatError) {
 	// Check message length
 	if messageLen > rl.config.MaxCharactersPerMessage {
 		return false, &ChatError{
-			Code:    "MESSAGE_TOO_LONG",
-			Message: "Message is too long. Maximum 500 characters.",
+			Code:    CodeMessageTooLong,
+			Message: fmt.Sprintf("Message is too long. Maximum %d characters.", rl.config.MaxCharactersPerMessage),
+			Details: &ErrorDetails{Limit: rl.config.MaxCharactersPerMessage, Tier: TierMessageLength},
 		}
 	}
 
 	// Tier 1: Basic frequency check (5 messages per 10 seconds)
-	recentMessages := record.countMessagesInWindow(10 * time.Second)
-	if recentMessages >= 5 {
-		record.applyTimeout(30 * time.Second)
+	recentMessages := record.countMessagesInWindow(burstWindow.duration())
+	if recentMessages >= burstWindow.Messages {
+		record.applyTimeout(30*time.Second, burstWindow.Tier)
 		record.Violations++
 		return false, &ChatError{
-			Code:    "RATE_LIMIT",
+			Code:    CodeRateLimit,
 			Message: "Slow down! (30 second cooldown)",
+			Details: &ErrorDetails{RetryAfterSeconds: 30, Limit: burstWindow.Messages, Window: burstWindow.WindowSeconds, Tier: burstWindow.Tier},
 		}
 	}
 
 	// Tier 2: Spam detection (10+ messages in 30 seconds)
-	messagesIn30s := record.countMessagesInWindow(30 * time.Second)
-	if messagesIn30s >= 10 {
-		record.applyTimeout(2 * time.Minute)
+	messagesIn30s := record.countMessagesInWindow(spamWindow.duration())
+	if messagesIn30s >= spamWindow.Messages {
+		record.applyTimeout(2*time.Minute, spamWindow.Tier)
 		record.Violations++
 		return false, &ChatError{
-			Code:    "SPAM_DETECTED",
+			Code:    CodeSpamDetected,
 			Message: "Spam detected. (2 minute timeout)",
+			Details: &ErrorDetails{RetryAfterSeconds: 120, Limit: spamWindow.Messages, Window: spamWindow.WindowSeconds, Tier: spamWindow.Tier},
 		}
 	}
 
 	// Tier 2.5: Heavy spam (20+ messages in 60 seconds)
-	messagesIn60s := record.countMessagesInWindow(60 * time.Second)
-	if messagesIn60s >= 20 {
-		record.applyTimeout(5 * time.Minute)
+	messagesIn60s := record.countMessagesInWindow(heavySpamWindow.duration())
+	if messagesIn60s >= heavySpamWindow.Messages {
+		record.applyTimeout(5*time.Minute, heavySpamWindow.Tier)
 		record.Violations += 2
 		return false, &ChatError{
-			Code:    "HEAVY_SPAM",
+			Code:    CodeHeavySpam,
 			Message: "Heavy spam detected. (5 minute timeout)",
+			Details: &ErrorDetails{RetryAfterSeconds: 300, Limit: heavySpamWindow.Messages, Window: heavySpamWindow.WindowSeconds, Tier: heavySpamWindow.Tier},
 		}
 	}
 
 	// Tier 3: Character-based rate limiting
-	if messageLen > 300 {
+	if messageLen > longMessageWindow.MinLength {
 		// Large messages (300-500 chars): max 1 per 10 seconds
-		if recentMessages >= 1 {
+		if record.countMessagesInWindow(longMessageWindow.duration()) >= longMessageWindow.Messages {
 			return false, &ChatError{
-				Code:    "RATE_LIMIT_LONG_MESSAGE",
+				Code:    CodeRateLimitLongMessage,
 				Message: "Large messages limited to 1 per 10 seconds.",
+				Details: record.windowDetails(longMessageWindow, now),
 			}
 		}
-	} else if messageLen > 100 {
+	} else if messageLen > mediumMessageWindow.MinLength {
 		// Medium messages (100-300 chars): max 3 per 10 seconds
-		if recentMessages >= 3 {
+		if record.countMessagesInWindow(mediumMessageWindow.duration()) >= mediumMessageWindow.Messages {
 			return false, &ChatError{
-				Code:    "RATE_LIMIT_MEDIUM_MESSAGE",
+				Code:    CodeRateLimitMediumMessage,
 				Message: "Medium messages limited to 3 per 10 seconds.",
+				Details: record.windowDetails(mediumMessageWindow, now),
 			}
 		}
 	}
 
 	// Tier 4: Duplicate/similar message detection
 	if record.isDuplicateSpam(message) {
-		record.applyTimeout(5 * time.Minute)
+		record.applyTimeout(5*time.Minute, TierDuplicate)
 		record.Violations++
 		return false, &ChatError{
-			Code:    "DUPLICATE_SPAM",
+			Code:    CodeDuplicateSpam,
 			Message: "Stop sending the same message repeatedly. (5 minute timeout)",
+			Details: &ErrorDetails{RetryAfterSeconds: 300, Tier: TierDuplicate},
 		}
 	}
 
 	// Tier 5: Heavy spam with long messages
 	charsIn5Min := record.countCharsInWindow(5 * time.Minute)
 	if messageLen >= 400 && charsIn5Min > 2000 {
-		record.applyTimeout(10 * time.Minute)
+		record.applyTimeout(10*time.Minute, TierTextSpam)
 		record.Violations += 2
 		return false, &ChatError{
-			Code:    "HEAVY_TEXT_SPAM",
+			Code:    CodeHeavyTextSpam,
 			Message: "Too much text too quickly. (10 minute timeout)",
+			Details: &ErrorDetails{RetryAfterSeconds: 600, Limit: 2000, Window: 300, Tier: TierTextSpam},
 		}
 	}
 
 	// Escalating penalties for repeat offenders
 	if record.Violations >= 5 {
-		record.applyTimeout(30 * time.Minute)
+		record.applyTimeout(30*time.Minute, TierRepeatOffender)
 		return false, &ChatError{
-			Code:    "REPEAT_OFFENDER",
+			Code:    CodeRepeatOffender,
 			Message: "Multiple violations. (30 minute timeout)",
+			Details: &ErrorDetails{RetryAfterSeconds: 1800, Tier: TierRepeatOffender},
 		}
 	} else if record.Violations >= 4 {
-		record.applyTimeout(10 * time.Minute)
+		record.applyTimeout(10*time.Minute, TierRepeatOffender)
 		return false, &ChatError{
-			Code:    "REPEAT_OFFENDER",
+			Code:    CodeRepeatOffender,
 			Message: "Multiple violations. (10 minute timeout)",
+			Details: &ErrorDetails{RetryAfterSeconds: 600, Tier: TierRepeatOffender},
 		}
 	} else if record.Violations >= 3 {
-		record.applyTimeout(5 * time.Minute)
+		record.applyTimeout(5*time.Minute, TierRepeatOffender)
 		return false, &ChatError{
-			Code:    "REPEAT_OFFENDER",
+			Code:    CodeRepeatOffender,
 			Message: "Multiple violations. (5 minute timeout)",
+			Details: &ErrorDetails{RetryAfterSeconds: 300, Tier: TierRepeatOffender},
 		}
 	}
 
@@ -166,10 +231,40 @@ func (rl *RateLimiter) CheckMessage(userID, message string) (bool, *ChatError) {
 	return true, nil
 }
 
-// getOrCreateRecord gets or creates a rate record for a user
-func (rl *RateLimiter) getOrCreateRecord(userID string) *UserRateRecord {
-	if record, exists := rl.userRecords[userID]; exists {
-		return record
+// lockRecord returns a user's rate record, created if needed, with its lock held.
+// The shard's mutex is only held to find the record, so checks for different
+// users never wait on each other.
+func (rl *RateLimiter) lockRecord(userID string) *UserRateRecord {
+	shard := rl.shard(userID)
+	for {
+		shard.mutex.RLock()
+		record, exists := shard.records[userID]
+		shard.mutex.RUnlock()
+
+		if !exists {
+			var created bool
+			shard.mutex.Lock()
+			record, created = shard.getOrCreateRecord(userID)
+			shard.mutex.Unlock()
+			if created {
+				rl.wheel.Schedule("idle:"+userID, time.Now().Add(recordIdleTimeout), func() { rl.expireRecord(userID) })
+			}
+		}
+
+		record.mu.Lock()
+		if !record.removed {
+			return record
+		}
+		// Expired between the lookup and the lock; the next lookup creates a fresh record
+		record.mu.Unlock()
+	}
+}
+
+// getOrCreateRecord gets or creates a rate record for a user, reporting whether it
+// was created. Callers must hold the shard's mutex.
+func (s *rateLimitShard) getOrCreateRecord(userID string) (*UserRateRecord, bool) {
+	if record, exists := s.records[userID]; exists {
+		return record, false
 	}
 
 	record := &UserRateRecord{
@@ -180,8 +275,8 @@ func (rl *RateLimiter) getOrCreateRecord(userID string) *UserRateRecord {
 		LastCleanup:      time.Now(),
 	}
 
-	rl.userRecords[userID] = record
-	return record
+	s.records[userID] = record
+	return record, true
 }
 
 // recordMessage records a sent message
@@ -279,9 +374,28 @@ func similarity(s1, s2 string) float64 {
 	return float64(matches) / float64(len(longer))
 }
 
-// applyTimeout applies a timeout to the user
-func (r *UserRateRecord) applyTimeout(duration time.Duration) {
+// applyTimeout applies a timeout to the user for exceeding a tier
+func (r *UserRateRecord) applyTimeout(duration time.Duration, tier string) {
 	r.TimeoutUntil = time.Now().Add(duration)
+	r.TimeoutTier = tier
+}
+
+// windowDetails describes an exceeded window, with how long until its oldest
+// counted message ages out and another is allowed
+func (r *UserRateRecord) windowDetails(window RateWindow, now time.Time) *ErrorDetails {
+	cutoff := now.Add(-window.duration())
+	inWindow := []time.Time{}
+	for _, timestamp := range r.Messages {
+		if timestamp.After(cutoff) {
+			inWindow = append(inWindow, timestamp)
+		}
+	}
+
+	details := &ErrorDetails{Limit: window.Messages, Window: window.WindowSeconds, Tier: window.Tier}
+	if excess := len(inWindow) - window.Messages; excess >= 0 {
+		details.RetryAfterSeconds = retryAfter(inWindow[excess].Add(window.duration()).Sub(now))
+	}
+	return details
 }
 
 // cleanup removes old message records
@@ -318,46 +432,104 @@ func (r *UserRateRecord) cleanup() {
 	r.LastCleanup = now
 }
 
-// cleanupWorker periodically cleans up old user records
-func (rl *RateLimiter) cleanupWorker() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
+// watchTimeout saves the record's timeout and schedules its end if it was set or
+// extended since it ended at before. Callers must hold the record's lock.
+func (rl *RateLimiter) watchTimeout(record *UserRateRecord, before time.Time) {
+	if !record.TimeoutUntil.After(before) {
+		return
+	}
+
+	rl.saveTimeout(record)
+	rl.scheduleTimeoutEnd(record, before)
+}
 
-	for range ticker.C {
-		rl.performCleanup()
+// scheduleTimeoutEnd schedules the end of the record's timeout if it was set or
+// extended since it ended at before. Callers must hold the record's lock.
+func (rl *RateLimiter) scheduleTimeoutEnd(record *UserRateRecord, before time.Time) {
+	if !record.TimeoutUntil.After(before) {
+		return
 	}
+
+	userID := record.UserID
+	rl.wheel.Schedule("timeout:"+userID, record.TimeoutUntil, func() {
+		rl.forgetTimeout(userID)
+		if fn := rl.onTimeoutEnded.Load(); fn != nil {
+			(*fn)(userID)
+		}
+	})
 }
 
-// performCleanup removes inactive user records
-func (rl *RateLimiter) performCleanup() {
-	rl.mutex.Lock()
-	defer rl.mutex.Unlock()
+// expireRecord removes a user's record once it has been idle for recordIdleTimeout
+// and any timeout has ended, or checks again when that will be
+func (rl *RateLimiter) expireRecord(userID string) {
+	shard := rl.shard(userID)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
 
-	now := time.Now()
-	toDelete := []string{}
+	record, exists := shard.records[userID]
+	if !exists {
+		return
+	}
+	record.mu.Lock()
+	defer record.mu.Unlock()
 
-	for userID, record := range rl.userRecords {
-		// Remove users inactive for more than 30 minutes
-		if len(record.Messages) == 0 ||
-		   (len(record.Messages) > 0 && now.Sub(record.Messages[len(record.Messages)-1]) > 30*time.Minute) {
-			toDelete = append(toDelete, userID)
-		}
+	lastActive := record.LastCleanup
+	if len(record.Messages) > 0 && record.Messages[len(record.Messages)-1].After(lastActive) {
+		lastActive = record.Messages[len(record.Messages)-1]
+	}
+	expiry := lastActive.Add(recordIdleTimeout)
+	if record.TimeoutUntil.After(expiry) {
+		expiry = record.TimeoutUntil
+	}
+
+	if time.Now().Before(expiry) {
+		rl.wheel.Schedule("idle:"+userID, expiry, func() { rl.expireRecord(userID) })
+		return
 	}
+	record.removed = true
+	delete(shard.records, userID)
+}
+
+// Forget drops a user's rate record, its pending timers and any saved timeout, as
+// if the user had never sent a message
+func (rl *RateLimiter) Forget(userID string) {
+	shard := rl.shard(userID)
+	shard.mutex.Lock()
+	if record, exists := shard.records[userID]; exists {
+		record.mu.Lock()
+		record.removed = true
+		record.mu.Unlock()
+		delete(shard.records, userID)
+	}
+	shard.mutex.Unlock()
 
-	for _, userID := range toDelete {
-		delete(rl.userRecords, userID)
+	rl.wheel.Cancel("timeout:" + userID)
+	rl.wheel.Cancel("idle:" + userID)
+	if store := rl.timeouts(); store != nil {
+		if err := store.DeleteTimeout(userID); err != nil {
+			log.Printf("Failed to delete chat timeout for %s: %v", userID, err)
+		}
 	}
 }
 
+// record looks up a user's rate record without locking it
+func (rl *RateLimiter) record(userID string) (*UserRateRecord, bool) {
+	shard := rl.shard(userID)
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	record, exists := shard.records[userID]
+	return record, exists
+}
+
 // GetTimeoutStatus returns the timeout status for a user
 func (rl *RateLimiter) GetTimeoutStatus(userID string) (bool, time.Duration) {
-	rl.mutex.RLock()
-	defer rl.mutex.RUnlock()
-
-	record, exists := rl.userRecords[userID]
+	record, exists := rl.record(userID)
 	if !exists {
 		return false, 0
 	}
+	record.mu.Lock()
+	defer record.mu.Unlock()
 
 	now := time.Now()
 	if now.Before(record.TimeoutUntil) {
@@ -367,3 +539,33 @@ func (rl *RateLimiter) GetTimeoutStatus(userID string) (bool, time.Duration) {
 
 	return false, 0
 }
+
+// RateLimitState is a snapshot of a user's rate limiter record
+type RateLimitState struct {
+	UserID         string    `json:"userId"`
+	RecentMessages int       `json:"recentMessages"`
+	Violations     int       `json:"violations"`
+	TimedOut       bool      `json:"timedOut"`
+	TimeoutUntil   time.Time `json:"timeoutUntil,omitempty"`
+}
+
+// State returns a user's rate limiter state, or false if the user has no record
+func (rl *RateLimiter) State(userID string) (RateLimitState, bool) {
+	record, exists := rl.record(userID)
+	if !exists {
+		return RateLimitState{}, false
+	}
+	record.mu.Lock()
+	defer record.mu.Unlock()
+
+	state := RateLimitState{
+		UserID:         userID,
+		RecentMessages: len(record.Messages),
+		Violations:     record.Violations,
+		TimedOut:       time.Now().Before(record.TimeoutUntil),
+	}
+	if state.TimedOut {
+		state.TimeoutUntil = record.TimeoutUntil
+	}
+	return state, true
+}
@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterLocksPerUser(t *testing.T) {
+	rl := NewRateLimiter(DefaultConfig())
+	t.Cleanup(rl.Stop)
+
+	// Another user whose record lives in the same shard as alice's
+	neighbor := ""
+	for i := 0; neighbor == ""; i++ {
+		if id := fmt.Sprintf("user%d", i); shardIndex(id, rateLimitShardCount) == shardIndex("alice", rateLimitShardCount) {
+			neighbor = id
+		}
+	}
+
+	allowed, _ := rl.CheckMessage("alice", "hello")
+	require.True(t, allowed)
+
+	// A check holding alice's record doesn't hold up the neighbor's
+	record := rl.lockRecord("alice")
+	done := make(chan bool)
+	go func() {
+		allowed, _ := rl.CheckMessage(neighbor, "hello")
+		done <- allowed
+	}()
+	select {
+	case allowed := <-done:
+		require.True(t, allowed)
+	case <-time.After(time.Second):
+		t.Fatal("check for another user in the shard waited on alice's record")
+	}
+	record.mu.Unlock()
+}
+
+func TestRateLimiterReplacesExpiredRecords(t *testing.T) {
+	rl := NewRateLimiter(DefaultConfig())
+	t.Cleanup(rl.Stop)
+
+	allowed, _ := rl.CheckMessage("alice", "hello")
+	require.True(t, allowed)
+	stale, _ := rl.record("alice")
+
+	// Expire the record the way the idle timer does, as if between a lookup and its lock
+	shard := rl.shard("alice")
+	shard.mutex.Lock()
+	stale.mu.Lock()
+	stale.removed = true
+	delete(shard.records, "alice")
+	stale.mu.Unlock()
+	shard.mutex.Unlock()
+
+	allowed, _ = rl.CheckMessage("alice", "hello again")
+	require.True(t, allowed)
+
+	fresh, exists := rl.record("alice")
+	require.True(t, exists)
+	require.NotSame(t, stale, fresh)
+	require.Len(t, fresh.Messages, 1)
+}
+
+func TestRateLimiterRestoresTimeouts(t *testing.T) {
+	store := NewMemoryStore()
+	rl := NewRateLimiter(DefaultConfig())
+	rl.SetTimeoutStore(store)
+
+	for _, text := range []string{"one", "two", "three", "four", "five"} {
+		allowed, _ := rl.CheckMessage("spammer", text)
+		require.True(t, allowed)
+	}
+	allowed, chatErr := rl.CheckMessage("spammer", "one more")
+	require.False(t, allowed)
+	require.Equal(t, CodeRateLimit, chatErr.Code)
+	rl.Stop()
+
+	// A timeout that has already ended is dropped rather than reapplied
+	require.NoError(t, store.SaveTimeout(SavedTimeout{UserID: "reformed", Until: time.Now().Add(-time.Minute), Tier: TierBurst}))
+
+	// A restarted limiter still holds the spammer back
+	rl = NewRateLimiter(DefaultConfig())
+	t.Cleanup(rl.Stop)
+	rl.SetTimeoutStore(store)
+	restored, err := rl.RestoreTimeouts()
+	require.NoError(t, err)
+	require.Equal(t, 1, restored)
+
+	allowed, chatErr = rl.CheckMessage("spammer", "back again")
+	require.False(t, allowed)
+	require.Equal(t, CodeTimeout, chatErr.Code)
+	require.Equal(t, TierBurst, chatErr.Details.Tier)
+	state, _ := rl.State("spammer")
+	require.Equal(t, 1, state.Violations)
+
+	saved, err := store.LoadTimeouts()
+	require.NoError(t, err)
+	require.Len(t, saved, 1)
+	require.Equal(t, "spammer", saved[0].UserID)
+}
+
+func TestRateLimiterForgetsEndedTimeouts(t *testing.T) {
+	store := NewMemoryStore()
+	rl := NewRateLimiter(DefaultConfig())
+	t.Cleanup(rl.Stop)
+	rl.SetTimeoutStore(store)
+
+	record := rl.lockRecord("user")
+	record.TimeoutUntil = time.Now().Add(time.Second)
+	rl.watchTimeout(record, time.Time{})
+	record.mu.Unlock()
+
+	saved, err := store.LoadTimeouts()
+	require.NoError(t, err)
+	require.Len(t, saved, 1)
+
+	require.Eventually(t, func() bool {
+		saved, err := store.LoadTimeouts()
+		return err == nil && len(saved) == 0
+	}, 5*time.Second, 50*time.Millisecond)
+}
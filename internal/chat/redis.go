@@ -0,0 +1,448 @@
+package chat
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	redisHistoryPrefix = "chat:history:"
+	redisHistoryQueue  = 10000
+	redisDialTimeout   = 5 * time.Second
+	redisIOTimeout     = 2 * time.Second
+)
+
+// RedisHistory is a HistoryStore keeping each room's recent messages in a Redis
+// list, trimmed to the room's buffer size and expiring with the retention. Appends
+// are queued without blocking and written in order by a background worker, so
+// sharing history adds nothing to the send path.
+type RedisHistory struct {
+	client  *redisClient
+	maxLen  int
+	ttl     time.Duration
+	queue   chan ChatMessage
+	dropped atomic.Int64
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewRedisHistory connects to the Redis server at a redis:// or rediss:// URL,
+// keeping up to maxLen messages per room for ttl after a room's last message
+func NewRedisHistory(rawURL string, maxLen int, ttl time.Duration) (*RedisHistory, error) {
+	client, err := newRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.do([]string{"PING"}); err != nil {
+		client.close()
+		return nil, fmt.Errorf("connecting to redis: %w", err)
+	}
+
+	return newRedisHistory(client, maxLen, ttl), nil
+}
+
+// newRedisHistory starts a store on a client
+func newRedisHistory(client *redisClient, maxLen int, ttl time.Duration) *RedisHistory {
+	rh := &RedisHistory{
+		client: client,
+		maxLen: maxLen,
+		ttl:    ttl,
+		queue:  make(chan ChatMessage, redisHistoryQueue),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go rh.worker()
+	return rh
+}
+
+// Append queues a message for the room's list. It never blocks; messages are
+// dropped, and counted, if the queue is full.
+func (rh *RedisHistory) Append(msg ChatMessage) error {
+	select {
+	case rh.queue <- msg:
+		return nil
+	default:
+		if rh.dropped.Add(1)%1000 == 1 {
+			log.Printf("Chat history queue full, dropped %d messages so far", rh.dropped.Load())
+		}
+		return nil
+	}
+}
+
+// Recent reads up to limit of the room's latest messages
+func (rh *RedisHistory) Recent(streamKey string, limit int) ([]ChatMessage, error) {
+	replies, err := rh.client.do([]string{"LRANGE", redisHistoryPrefix + streamKey, strconv.Itoa(-limit), "-1"})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, _ := replies[0].([]interface{})
+	messages := make([]ChatMessage, 0, len(entries))
+	for _, entry := range entries {
+		payload, _ := entry.(string)
+		var msg ChatMessage
+		if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+			log.Printf("Skipping unreadable shared chat message for %s: %v", streamKey, err)
+			continue
+		}
+		messages = append(messages, msg)
+	}
+	return messages, nil
+}
+
+// Clear deletes the room's list
+func (rh *RedisHistory) Clear(streamKey string) error {
+	_, err := rh.client.do([]string{"DEL", redisHistoryPrefix + streamKey})
+	return err
+}
+
+// EraseUser removes every message the user sent from every room's list.
+// Messages still queued for writing are written afterwards.
+func (rh *RedisHistory) EraseUser(userID string) (int, error) {
+	keys, err := rh.client.scan(redisHistoryPrefix + "*")
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, key := range keys {
+		replies, err := rh.client.do([]string{"LRANGE", key, "0", "-1"})
+		if err != nil {
+			return removed, err
+		}
+
+		// Entries are removed by value, so each distinct payload is removed once
+		commands := [][]string{}
+		seen := make(map[string]bool)
+		entries, _ := replies[0].([]interface{})
+		for _, entry := range entries {
+			payload, _ := entry.(string)
+			var msg ChatMessage
+			if err := json.Unmarshal([]byte(payload), &msg); err != nil || msg.UserID != userID || seen[payload] {
+				continue
+			}
+			seen[payload] = true
+			commands = append(commands, []string{"LREM", key, "0", payload})
+		}
+		if len(commands) == 0 {
+			continue
+		}
+
+		replies, err = rh.client.do(commands...)
+		if err != nil {
+			return removed, err
+		}
+		for _, reply := range replies {
+			count, _ := reply.(int64)
+			removed += int(count)
+		}
+	}
+	return removed, nil
+}
+
+// Pending returns the number of messages waiting to be written
+func (rh *RedisHistory) Pending() int {
+	return len(rh.queue)
+}
+
+// Ping checks the Redis server answers
+func (rh *RedisHistory) Ping() error {
+	_, err := rh.client.do([]string{"PING"})
+	return err
+}
+
+// Close writes the messages already queued and disconnects
+func (rh *RedisHistory) Close() error {
+	rh.once.Do(func() {
+		close(rh.stop)
+	})
+	<-rh.done
+	return rh.client.close()
+}
+
+// worker writes queued messages in order, pipelining each with the trim and expiry
+// of its list
+func (rh *RedisHistory) worker() {
+	defer trackWorker("redis.history")()
+	defer close(rh.done)
+
+	for {
+		select {
+		case msg := <-rh.queue:
+			rh.write(msg)
+		case <-rh.stop:
+			for {
+				select {
+				case msg := <-rh.queue:
+					rh.write(msg)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write appends one message to its room's list
+func (rh *RedisHistory) write(msg ChatMessage) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to encode shared chat message: %v", err)
+		return
+	}
+
+	key := redisHistoryPrefix + msg.StreamKey
+	_, err = rh.client.do(
+		[]string{"RPUSH", key, string(payload)},
+		[]string{"LTRIM", key, strconv.Itoa(-rh.maxLen), "-1"},
+		[]string{"PEXPIRE", key, strconv.FormatInt(rh.ttl.Milliseconds(), 10)},
+	)
+	if err != nil {
+		log.Printf("Failed to share chat message for %s: %v", msg.StreamKey, err)
+	}
+}
+
+// redisError is an error reply from the server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisClient speaks just enough RESP for the history store over one connection,
+// reconnecting after any failure. Commands are serialized; do pipelines the ones
+// passed together.
+type redisClient struct {
+	addr     string
+	username string
+	password string
+	db       int
+	tls      bool
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// newRedisClient parses redis://[user:password@]host[:port][/db]; rediss:// uses TLS
+func newRedisClient(rawURL string) (*redisClient, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("unsupported redis URL scheme %q", u.Scheme)
+	}
+
+	c := &redisClient{addr: u.Host, tls: u.Scheme == "rediss"}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.username = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.TrimPrefix(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("invalid redis database %q", db)
+		}
+	}
+	return c, nil
+}
+
+// do sends the commands in one round trip and returns their replies. An error
+// reply to any of them is returned as a redisError.
+func (c *redisClient) do(commands ...[]string) ([]interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	replies, err := c.roundTrip(commands)
+	var replyErr redisError
+	if err != nil && !errors.As(err, &replyErr) {
+		// The connection is in an unknown state; start over on the next call
+		c.conn.Close()
+		c.conn = nil
+	}
+	return replies, err
+}
+
+// scan returns every key matching pattern, walking the keyspace with SCAN so the
+// server isn't blocked
+func (c *redisClient) scan(pattern string) ([]string, error) {
+	seen := make(map[string]bool)
+	keys := []string{}
+	cursor := "0"
+	for {
+		replies, err := c.do([]string{"SCAN", cursor, "MATCH", pattern, "COUNT", "100"})
+		if err != nil {
+			return nil, err
+		}
+
+		// The reply is [next cursor, [key, ...]]
+		reply, _ := replies[0].([]interface{})
+		if len(reply) != 2 {
+			return nil, errors.New("redis: malformed SCAN reply")
+		}
+		cursor, _ = reply[0].(string)
+		batch, _ := reply[1].([]interface{})
+		for _, item := range batch {
+			// SCAN may return a key more than once
+			if key, _ := item.(string); !seen[key] {
+				seen[key] = true
+				keys = append(keys, key)
+			}
+		}
+		if cursor == "0" || cursor == "" {
+			return keys, nil
+		}
+	}
+}
+
+// connect dials the server and authenticates. Callers must hold mu.
+func (c *redisClient) connect() error {
+	dialer := &net.Dialer{Timeout: redisDialTimeout}
+	var conn net.Conn
+	var err error
+	if c.tls {
+		host, _, _ := net.SplitHostPort(c.addr)
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+
+	var setup [][]string
+	if c.password != "" {
+		if c.username != "" {
+			setup = append(setup, []string{"AUTH", c.username, c.password})
+		} else {
+			setup = append(setup, []string{"AUTH", c.password})
+		}
+	}
+	if c.db != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(c.db)})
+	}
+	if len(setup) > 0 {
+		if _, err := c.roundTrip(setup); err != nil {
+			conn.Close()
+			c.conn = nil
+			return err
+		}
+	}
+	return nil
+}
+
+// roundTrip writes the commands and reads a reply for each. Callers must hold mu.
+func (c *redisClient) roundTrip(commands [][]string) ([]interface{}, error) {
+	if err := c.conn.SetDeadline(time.Now().Add(redisIOTimeout)); err != nil {
+		return nil, err
+	}
+
+	var buf strings.Builder
+	for _, args := range commands {
+		fmt.Fprintf(&buf, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(&buf, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+	}
+	if _, err := io.WriteString(c.conn, buf.String()); err != nil {
+		return nil, err
+	}
+
+	replies := make([]interface{}, len(commands))
+	var firstErr error
+	for i := range commands {
+		reply, err := readRESP(c.r)
+		var replyErr redisError
+		if err != nil && !errors.As(err, &replyErr) {
+			return nil, err
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+		replies[i] = reply
+	}
+	return replies, firstErr
+}
+
+// readRESP reads one reply: a string for simple and bulk strings (nil for a null
+// bulk string), an int64, a []interface{} for arrays, or a redisError
+func readRESP(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 {
+			return nil, err
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return string(data[:size]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, count)
+		for i := range items {
+			if items[i], err = readRESP(r); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected reply %q", line)
+	}
+}
+
+// close closes the connection, if open
+func (c *redisClient) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.conn == nil {
+		return nil
+	}
+	err := c.conn.Close()
+	c.conn = nil
+	return err
+}
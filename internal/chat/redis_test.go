@@ -0,0 +1,405 @@
+package chat
+
+import (
+	"bufio"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRedis serves the list and stream commands the history stores use from memory
+type fakeRedis struct {
+	addr     string
+	password string
+
+	mu      sync.Mutex
+	lists   map[string][]string
+	streams map[string][]fakeStreamEntry
+	hashes  map[string]map[string]string
+	nextID  int
+}
+
+// fakeStreamEntry is a stream entry with a "millis-n" ID
+type fakeStreamEntry struct {
+	millis int64
+	id     string
+	fields []string
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+
+	f := &fakeRedis{addr: listener.Addr().String(), password: password, lists: make(map[string][]string), streams: make(map[string][]fakeStreamEntry), hashes: make(map[string]map[string]string)}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+
+	for {
+		request, err := readRESP(r)
+		if err != nil {
+			return
+		}
+		items, _ := request.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+
+		if !authed && args[0] != "AUTH" {
+			conn.Write([]byte("-NOAUTH Authentication required.\r\n")) //nolint
+			continue
+		}
+		conn.Write([]byte(f.exec(args, &authed))) //nolint
+	}
+}
+
+func (f *fakeRedis) exec(args []string, authed *bool) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// index resolves a Redis list index, which may count from the end
+	index := func(list []string, arg string) int {
+		i, _ := strconv.Atoi(arg)
+		if i < 0 {
+			i += len(list)
+		}
+		return max(0, min(i, len(list)))
+	}
+
+	switch args[0] {
+	case "PING":
+		return "+PONG\r\n"
+	case "AUTH":
+		if args[len(args)-1] != f.password {
+			return "-WRONGPASS invalid password\r\n"
+		}
+		*authed = true
+		return "+OK\r\n"
+	case "RPUSH":
+		f.lists[args[1]] = append(f.lists[args[1]], args[2:]...)
+		return ":" + strconv.Itoa(len(f.lists[args[1]])) + "\r\n"
+	case "LTRIM":
+		list := f.lists[args[1]]
+		f.lists[args[1]] = list[index(list, args[2]):]
+		return "+OK\r\n"
+	case "PEXPIRE":
+		return ":1\r\n"
+	case "LRANGE":
+		list := f.lists[args[1]]
+		reply := "*" + strconv.Itoa(len(list)-index(list, args[2])) + "\r\n"
+		for _, item := range list[index(list, args[2]):] {
+			reply += "$" + strconv.Itoa(len(item)) + "\r\n" + item + "\r\n"
+		}
+		return reply
+	case "DEL":
+		delete(f.lists, args[1])
+		delete(f.streams, args[1])
+		return ":1\r\n"
+	case "XADD":
+		// XADD key MAXLEN ~ n * field value...
+		f.nextID++
+		millis := time.Now().UnixMilli()
+		entry := fakeStreamEntry{millis: millis, id: strconv.FormatInt(millis, 10) + "-" + strconv.Itoa(f.nextID), fields: args[6:]}
+		stream := append(f.streams[args[1]], entry)
+		if maxLen, _ := strconv.Atoi(args[4]); len(stream) > maxLen {
+			stream = stream[len(stream)-maxLen:]
+		}
+		f.streams[args[1]] = stream
+		return "$" + strconv.Itoa(len(entry.id)) + "\r\n" + entry.id + "\r\n"
+	case "XRANGE", "XREVRANGE":
+		entries := slices.Clone(f.streams[args[1]])
+		if args[0] == "XREVRANGE" {
+			slices.Reverse(entries)
+		}
+		if len(args) == 6 {
+			count, _ := strconv.Atoi(args[5])
+			entries = entries[:min(count, len(entries))]
+		}
+		reply := "*" + strconv.Itoa(len(entries)) + "\r\n"
+		for _, entry := range entries {
+			reply += "*2\r\n$" + strconv.Itoa(len(entry.id)) + "\r\n" + entry.id + "\r\n*" + strconv.Itoa(len(entry.fields)) + "\r\n"
+			for _, field := range entry.fields {
+				reply += "$" + strconv.Itoa(len(field)) + "\r\n" + field + "\r\n"
+			}
+		}
+		return reply
+	case "XTRIM":
+		// XTRIM key MINID millis
+		minID, _ := strconv.ParseInt(args[3], 10, 64)
+		stream := f.streams[args[1]]
+		kept := slices.DeleteFunc(slices.Clone(stream), func(e fakeStreamEntry) bool { return e.millis < minID })
+		f.streams[args[1]] = kept
+		return ":" + strconv.Itoa(len(stream)-len(kept)) + "\r\n"
+	case "HSET":
+		if f.hashes[args[1]] == nil {
+			f.hashes[args[1]] = make(map[string]string)
+		}
+		f.hashes[args[1]][args[2]] = args[3]
+		return ":1\r\n"
+	case "HDEL":
+		delete(f.hashes[args[1]], args[2])
+		return ":1\r\n"
+	case "HGET":
+		value, exists := f.hashes[args[1]][args[2]]
+		if !exists {
+			return "$-1\r\n"
+		}
+		return "$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+	case "HGETALL":
+		reply := "*" + strconv.Itoa(2*len(f.hashes[args[1]])) + "\r\n"
+		for field, value := range f.hashes[args[1]] {
+			reply += "$" + strconv.Itoa(len(field)) + "\r\n" + field + "\r\n$" + strconv.Itoa(len(value)) + "\r\n" + value + "\r\n"
+		}
+		return reply
+	case "LREM":
+		list := f.lists[args[1]]
+		kept := slices.DeleteFunc(slices.Clone(list), func(item string) bool { return item == args[3] })
+		f.lists[args[1]] = kept
+		return ":" + strconv.Itoa(len(list)-len(kept)) + "\r\n"
+	case "SCAN":
+		// SCAN 0 MATCH prefix* COUNT n, answered in one pass
+		prefix := strings.TrimSuffix(args[3], "*")
+		keys := []string{}
+		for key := range f.lists {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		for key := range f.streams {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+		reply := "*2\r\n$1\r\n0\r\n*" + strconv.Itoa(len(keys)) + "\r\n"
+		for _, key := range keys {
+			reply += "$" + strconv.Itoa(len(key)) + "\r\n" + key + "\r\n"
+		}
+		return reply
+	case "XDEL":
+		stream := f.streams[args[1]]
+		kept := slices.DeleteFunc(slices.Clone(stream), func(e fakeStreamEntry) bool { return e.id == args[2] })
+		f.streams[args[1]] = kept
+		return ":" + strconv.Itoa(len(stream)-len(kept)) + "\r\n"
+	default:
+		return "-ERR unknown command\r\n"
+	}
+}
+
+func TestRedisHistorySharesMessagesBetweenManagers(t *testing.T) {
+	redis := newFakeRedis(t, "secret")
+
+	history, err := NewRedisHistory("redis://:secret@"+redis.addr, 3, time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { history.Close() })
+
+	config := DefaultConfig()
+	first, second := NewManager(config), NewManager(config)
+	t.Cleanup(first.Stop)
+	t.Cleanup(second.Stop)
+	first.SetHistoryStore(history)
+	second.SetHistoryStore(history)
+
+	var ids []string
+	for _, text := range []string{"one", "two", "three", "four"} {
+		msg, err := first.AddMessage("room", "alice", "Alice", text)
+		require.NoError(t, err)
+		ids = append(ids, msg.ID)
+	}
+
+	// The second instance never saw the messages, but serves the latest three
+	require.Eventually(t, func() bool { return history.Pending() == 0 && len(second.GetMessages("room", 0)) == 3 }, 5*time.Second, 10*time.Millisecond)
+	messages := second.GetMessages("room", 2)
+	require.Len(t, messages, 2)
+	require.Equal(t, "three", messages[0].Message)
+	require.Equal(t, "four", messages[1].Message)
+
+	// and pages back through them
+	messages, hasMore, err := second.GetMessagesBefore("room", ids[3], 1)
+	require.NoError(t, err)
+	require.True(t, hasMore)
+	require.Equal(t, []string{ids[2]}, messageIDs(messages))
+
+	_, err = first.ClearRoom("room")
+	require.NoError(t, err)
+	require.Empty(t, second.GetMessages("room", 0))
+}
+
+func TestRedisHistoryFallsBackToLocalMessages(t *testing.T) {
+	redis := newFakeRedis(t, "")
+	history, err := NewRedisHistory("redis://"+redis.addr, 10, time.Hour)
+	require.NoError(t, err)
+
+	manager := NewManager(DefaultConfig())
+	t.Cleanup(manager.Stop)
+	manager.SetHistoryStore(history)
+
+	_, err = manager.AddMessage("room", "alice", "Alice", "hello")
+	require.NoError(t, err)
+
+	// With Redis gone, the room's own buffer answers
+	require.NoError(t, history.Close())
+	history.client.addr = "127.0.0.1:1"
+	messages := manager.GetMessages("room", 0)
+	require.Len(t, messages, 1)
+	require.Equal(t, "hello", messages[0].Message)
+}
+
+func TestRedisHistoryRejectsWrongPassword(t *testing.T) {
+	redis := newFakeRedis(t, "secret")
+
+	_, err := NewRedisHistory("redis://:nope@"+redis.addr, 10, time.Hour)
+	require.ErrorContains(t, err, "WRONGPASS")
+
+	_, err = NewRedisHistory("http://"+redis.addr, 10, time.Hour)
+	require.Error(t, err)
+}
+
+func TestRedisStreamStore(t *testing.T) {
+	redis := newFakeRedis(t, "")
+	streams, err := NewRedisStreamStore("redis://"+redis.addr, 3, time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { streams.Close() })
+
+	config := DefaultConfig()
+	config.MinMessagesPerStream = 2
+	config.MaxMessagesPerStream = 2
+	first, second := NewManager(config), NewManager(DefaultConfig())
+	t.Cleanup(first.Stop)
+	t.Cleanup(second.Stop)
+	first.SetMessageStore(streams)
+	first.SetHistoryStore(streams)
+	second.SetHistoryStore(streams)
+
+	for _, text := range []string{"one", "two", "three", "four"} {
+		_, err := first.AddMessage("room", "alice", "Alice", text)
+		require.NoError(t, err)
+	}
+	require.Eventually(t, func() bool { return streams.Pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	// The stream is capped at three, which the second instance serves as history
+	messages := second.GetMessages("room", 0)
+	require.Equal(t, []string{"two", "three", "four"}, messageTexts(messages))
+
+	// The first instance's room resumes past its two-message buffer from the stream
+	room, _ := first.GetRoom("room")
+	messages, complete := room.GetMessagesAfter(1, maxPageSize)
+	require.True(t, complete)
+	require.Equal(t, []string{"two", "three", "four"}, messageTexts(messages))
+
+	deleted, err := streams.DeleteByID("room", messages[1].ID)
+	require.NoError(t, err)
+	require.True(t, deleted)
+	messages, err = streams.Range("room", 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"two"}, messageTexts(messages))
+
+	removed, err := streams.DeleteBefore("room", time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 2, removed)
+	require.Empty(t, second.GetMessages("room", 0))
+}
+
+func TestRedisStoresEraseUsers(t *testing.T) {
+	redis := newFakeRedis(t, "")
+	streams, err := NewRedisStreamStore("redis://"+redis.addr, 10, time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { streams.Close() })
+	history, err := NewRedisHistory("redis://"+redis.addr, 10, time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { history.Close() })
+
+	for i, msg := range []ChatMessage{
+		{ID: "1", StreamKey: "room", UserID: "alice", Message: "one"},
+		{ID: "2", StreamKey: "room", UserID: "bob", Message: "two"},
+		{ID: "3", StreamKey: "other", UserID: "alice", Message: "three"},
+	} {
+		msg.Seq = int64(i + 1)
+		require.NoError(t, streams.Append(msg))
+		require.NoError(t, history.Append(msg))
+	}
+	require.Eventually(t, func() bool { return streams.Pending() == 0 && history.Pending() == 0 }, 5*time.Second, 10*time.Millisecond)
+
+	for _, store := range []UserEraser{streams, history} {
+		removed, err := store.EraseUser("alice")
+		require.NoError(t, err)
+		require.Equal(t, 2, removed)
+	}
+
+	messages, err := streams.Recent("room", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"two"}, messageTexts(messages))
+	messages, err = history.Recent("room", 10)
+	require.NoError(t, err)
+	require.Equal(t, []string{"two"}, messageTexts(messages))
+	messages, err = history.Recent("other", 10)
+	require.NoError(t, err)
+	require.Empty(t, messages)
+}
+
+func TestRedisStreamStoreSavesRooms(t *testing.T) {
+	redis := newFakeRedis(t, "")
+	streams, err := NewRedisStreamStore("redis://"+redis.addr, 3, time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { streams.Close() })
+
+	require.NoError(t, streams.SaveRoom(SavedRoom{StreamKey: "room", Modes: RoomModes{EmoteOnly: true}}))
+	saved, err := streams.LoadRooms()
+	require.NoError(t, err)
+	require.Equal(t, []SavedRoom{{StreamKey: "room", Modes: RoomModes{EmoteOnly: true}}}, saved)
+	require.NoError(t, streams.DeleteRoom("room"))
+	saved, err = streams.LoadRooms()
+	require.NoError(t, err)
+	require.Empty(t, saved)
+}
+
+func TestRedisStreamStoreKeepsProfiles(t *testing.T) {
+	redis := newFakeRedis(t, "")
+	streams, err := NewRedisStreamStore("redis://"+redis.addr, 3, time.Hour)
+	require.NoError(t, err)
+	t.Cleanup(func() { streams.Close() })
+
+	_, exists, err := streams.LoadProfile("alice")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, streams.SaveProfile(UserProfile{UserID: "alice", Color: "#123456"}))
+	profile, exists, err := streams.LoadProfile("alice")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, "#123456", profile.Color)
+
+	require.NoError(t, streams.DeleteProfile("alice"))
+	_, exists, err = streams.LoadProfile("alice")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+// messageTexts lists the text of each message
+func messageTexts(messages []ChatMessage) []string {
+	texts := make([]string, len(messages))
+	for i, msg := range messages {
+		texts[i] = msg.Message
+	}
+	return texts
+}
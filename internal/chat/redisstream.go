@@ -0,0 +1,406 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	redisStreamPrefix = "chat:stream:"
+	redisRoomsKey     = "chat:rooms"    // hash of stream key -> saved room state
+	redisTimeoutsKey  = "chat:timeouts" // hash of user ID -> saved timeout
+	redisProfilesKey  = "chat:profiles" // hash of user ID -> profile
+)
+
+// RedisStreamStore keeps each room's messages in a Redis Stream capped at maxLen
+// entries and expiring ttl after the room's last message. It is both a
+// MessageStore, persisting history for as long as Redis keeps it, and a
+// HistoryStore every instance reads, so one Redis serves light persistence and
+// scale-out alike. Appends are queued without blocking and written in order by a
+// background worker. Entry IDs are left to Redis, whose clock they carry, so
+// DeleteBefore trims by the time Redis stored a message.
+type RedisStreamStore struct {
+	client  *redisClient
+	maxLen  int
+	ttl     time.Duration
+	queue   chan ChatMessage
+	dropped atomic.Int64
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewRedisStreamStore connects to the Redis server at a redis:// or rediss:// URL,
+// keeping up to maxLen messages per room for ttl after a room's last message
+func NewRedisStreamStore(rawURL string, maxLen int, ttl time.Duration) (*RedisStreamStore, error) {
+	client, err := newRedisClient(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := client.do([]string{"PING"}); err != nil {
+		client.close()
+		return nil, fmt.Errorf("connecting to redis: %w", err)
+	}
+
+	return newRedisStreamStore(client, maxLen, ttl), nil
+}
+
+// newRedisStreamStore starts a store on a client
+func newRedisStreamStore(client *redisClient, maxLen int, ttl time.Duration) *RedisStreamStore {
+	rs := &RedisStreamStore{
+		client: client,
+		maxLen: maxLen,
+		ttl:    ttl,
+		queue:  make(chan ChatMessage, redisHistoryQueue),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+
+	go rs.worker()
+	return rs
+}
+
+// Append queues a message for the room's stream. It never blocks; messages are
+// dropped, and counted, if the queue is full.
+func (rs *RedisStreamStore) Append(msg ChatMessage) error {
+	select {
+	case rs.queue <- msg:
+		return nil
+	default:
+		if rs.dropped.Add(1)%1000 == 1 {
+			log.Printf("Chat stream queue full, dropped %d messages so far", rs.dropped.Load())
+		}
+		return nil
+	}
+}
+
+// Range reads up to limit of the room's messages numbered after afterSeq
+func (rs *RedisStreamStore) Range(streamKey string, afterSeq int64, limit int) ([]ChatMessage, error) {
+	entries, err := rs.entries("XRANGE", streamKey, "-", "+")
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []ChatMessage{}
+	for _, entry := range entries {
+		if limit > 0 && len(messages) == limit {
+			break
+		}
+		if entry.msg.Seq > afterSeq {
+			messages = append(messages, entry.msg)
+		}
+	}
+	return messages, nil
+}
+
+// Recent reads up to limit of the room's latest messages, oldest first
+func (rs *RedisStreamStore) Recent(streamKey string, limit int) ([]ChatMessage, error) {
+	entries, err := rs.entries("XREVRANGE", streamKey, "+", "-", "COUNT", strconv.Itoa(limit))
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]ChatMessage, 0, len(entries))
+	for _, entry := range slices.Backward(entries) {
+		messages = append(messages, entry.msg)
+	}
+	return messages, nil
+}
+
+// DeleteBefore trims the room's messages stored before cutoff
+func (rs *RedisStreamStore) DeleteBefore(streamKey string, cutoff time.Time) (int, error) {
+	replies, err := rs.client.do([]string{"XTRIM", redisStreamPrefix + streamKey, "MINID", strconv.FormatInt(cutoff.UnixMilli(), 10)})
+	if err != nil {
+		return 0, err
+	}
+	removed, _ := replies[0].(int64)
+	return int(removed), nil
+}
+
+// DeleteByID removes one of the room's messages
+func (rs *RedisStreamStore) DeleteByID(streamKey, id string) (bool, error) {
+	entries, err := rs.entries("XRANGE", streamKey, "-", "+")
+	if err != nil {
+		return false, err
+	}
+
+	for _, entry := range entries {
+		if entry.msg.ID != id {
+			continue
+		}
+		replies, err := rs.client.do([]string{"XDEL", redisStreamPrefix + streamKey, entry.id})
+		if err != nil {
+			return false, err
+		}
+		removed, _ := replies[0].(int64)
+		return removed > 0, nil
+	}
+	return false, nil
+}
+
+// UserMessages reads every message the user sent from every room's stream
+func (rs *RedisStreamStore) UserMessages(userID string) ([]ChatMessage, error) {
+	keys, err := rs.client.scan(redisStreamPrefix + "*")
+	if err != nil {
+		return nil, err
+	}
+
+	messages := []ChatMessage{}
+	for _, key := range keys {
+		entries, err := rs.entries("XRANGE", strings.TrimPrefix(key, redisStreamPrefix), "-", "+")
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if entry.msg.UserID == userID {
+				messages = append(messages, entry.msg)
+			}
+		}
+	}
+	return messages, nil
+}
+
+// EraseUser removes every message the user sent from every room's stream.
+// Messages still queued for writing are written afterwards.
+func (rs *RedisStreamStore) EraseUser(userID string) (int, error) {
+	keys, err := rs.client.scan(redisStreamPrefix + "*")
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, key := range keys {
+		streamKey := strings.TrimPrefix(key, redisStreamPrefix)
+		entries, err := rs.entries("XRANGE", streamKey, "-", "+")
+		if err != nil {
+			return removed, err
+		}
+
+		commands := [][]string{}
+		for _, entry := range entries {
+			if entry.msg.UserID == userID {
+				commands = append(commands, []string{"XDEL", key, entry.id})
+			}
+		}
+		if len(commands) == 0 {
+			continue
+		}
+		if _, err := rs.client.do(commands...); err != nil {
+			return removed, err
+		}
+		removed += len(commands)
+	}
+	return removed, nil
+}
+
+// Clear deletes the room's stream
+func (rs *RedisStreamStore) Clear(streamKey string) error {
+	_, err := rs.client.do([]string{"DEL", redisStreamPrefix + streamKey})
+	return err
+}
+
+// Pending returns the number of messages waiting to be written
+func (rs *RedisStreamStore) Pending() int {
+	return len(rs.queue)
+}
+
+// Ping checks the Redis server answers
+func (rs *RedisStreamStore) Ping() error {
+	_, err := rs.client.do([]string{"PING"})
+	return err
+}
+
+// Close writes the messages already queued and disconnects
+func (rs *RedisStreamStore) Close() error {
+	rs.once.Do(func() {
+		close(rs.stop)
+	})
+	<-rs.done
+	return rs.client.close()
+}
+
+// streamEntry is a message read back from a stream with its entry ID
+type streamEntry struct {
+	id  string
+	msg ChatMessage
+}
+
+// entries runs a range command over the room's stream and decodes its entries,
+// skipping any that can't be read
+func (rs *RedisStreamStore) entries(command, streamKey string, args ...string) ([]streamEntry, error) {
+	replies, err := rs.client.do(append([]string{command, redisStreamPrefix + streamKey}, args...))
+	if err != nil {
+		return nil, err
+	}
+
+	items, _ := replies[0].([]interface{})
+	entries := make([]streamEntry, 0, len(items))
+	for _, item := range items {
+		// Each entry is [id, [field, value, ...]]
+		pair, _ := item.([]interface{})
+		if len(pair) != 2 {
+			continue
+		}
+		id, _ := pair[0].(string)
+		fields, _ := pair[1].([]interface{})
+		for i := 0; i+1 < len(fields); i += 2 {
+			if name, _ := fields[i].(string); name != "msg" {
+				continue
+			}
+			payload, _ := fields[i+1].(string)
+			var msg ChatMessage
+			if err := json.Unmarshal([]byte(payload), &msg); err != nil {
+				log.Printf("Skipping unreadable chat stream entry for %s: %v", streamKey, err)
+				break
+			}
+			entries = append(entries, streamEntry{id: id, msg: msg})
+		}
+	}
+	return entries, nil
+}
+
+// worker writes queued messages in order
+func (rs *RedisStreamStore) worker() {
+	defer trackWorker("redis.stream")()
+	defer close(rs.done)
+
+	for {
+		select {
+		case msg := <-rs.queue:
+			rs.write(msg)
+		case <-rs.stop:
+			for {
+				select {
+				case msg := <-rs.queue:
+					rs.write(msg)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// write adds one message to its room's stream, pipelined with the stream's expiry
+func (rs *RedisStreamStore) write(msg ChatMessage) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		log.Printf("Failed to encode chat stream entry: %v", err)
+		return
+	}
+
+	key := redisStreamPrefix + msg.StreamKey
+	_, err = rs.client.do(
+		[]string{"XADD", key, "MAXLEN", "~", strconv.Itoa(rs.maxLen), "*", "msg", string(payload)},
+		[]string{"PEXPIRE", key, strconv.FormatInt(rs.ttl.Milliseconds(), 10)},
+	)
+	if err != nil {
+		log.Printf("Failed to write chat stream entry for %s: %v", msg.StreamKey, err)
+	}
+}
+
+// SaveRoom records a room's state in the rooms hash
+func (rs *RedisStreamStore) SaveRoom(room SavedRoom) error {
+	state, err := json.Marshal(room)
+	if err != nil {
+		return err
+	}
+	_, err = rs.client.do([]string{"HSET", redisRoomsKey, room.StreamKey, string(state)})
+	return err
+}
+
+// DeleteRoom forgets a room's state
+func (rs *RedisStreamStore) DeleteRoom(streamKey string) error {
+	_, err := rs.client.do([]string{"HDEL", redisRoomsKey, streamKey})
+	return err
+}
+
+// LoadRooms returns every saved room's state
+func (rs *RedisStreamStore) LoadRooms() ([]SavedRoom, error) {
+	return loadSavedHash[SavedRoom](rs.client, redisRoomsKey)
+}
+
+// SaveTimeout records a user's timeout in the timeouts hash
+func (rs *RedisStreamStore) SaveTimeout(timeout SavedTimeout) error {
+	state, err := json.Marshal(timeout)
+	if err != nil {
+		return err
+	}
+	_, err = rs.client.do([]string{"HSET", redisTimeoutsKey, timeout.UserID, string(state)})
+	return err
+}
+
+// DeleteTimeout forgets a user's timeout
+func (rs *RedisStreamStore) DeleteTimeout(userID string) error {
+	_, err := rs.client.do([]string{"HDEL", redisTimeoutsKey, userID})
+	return err
+}
+
+// LoadTimeouts returns every saved timeout
+func (rs *RedisStreamStore) LoadTimeouts() ([]SavedTimeout, error) {
+	return loadSavedHash[SavedTimeout](rs.client, redisTimeoutsKey)
+}
+
+// SaveProfile records a user's profile in the profiles hash
+func (rs *RedisStreamStore) SaveProfile(profile UserProfile) error {
+	state, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+	_, err = rs.client.do([]string{"HSET", redisProfilesKey, profile.UserID, string(state)})
+	return err
+}
+
+// LoadProfile returns a user's profile, if one was saved
+func (rs *RedisStreamStore) LoadProfile(userID string) (UserProfile, bool, error) {
+	replies, err := rs.client.do([]string{"HGET", redisProfilesKey, userID})
+	if err != nil {
+		return UserProfile{}, false, err
+	}
+	state, ok := replies[0].(string)
+	if !ok {
+		return UserProfile{}, false, nil
+	}
+
+	var profile UserProfile
+	if err := json.Unmarshal([]byte(state), &profile); err != nil {
+		return UserProfile{}, false, err
+	}
+	return profile, true, nil
+}
+
+// DeleteProfile forgets a user's profile
+func (rs *RedisStreamStore) DeleteProfile(userID string) error {
+	_, err := rs.client.do([]string{"HDEL", redisProfilesKey, userID})
+	return err
+}
+
+// loadSavedHash decodes the JSON states held in a hash's values, skipping any that
+// can't be read
+func loadSavedHash[T any](client *redisClient, key string) ([]T, error) {
+	replies, err := client.do([]string{"HGETALL", key})
+	if err != nil {
+		return nil, err
+	}
+
+	// The reply alternates fields and values
+	items, _ := replies[0].([]interface{})
+	saved := []T{}
+	for i := 1; i < len(items); i += 2 {
+		state, _ := items[i].(string)
+		var value T
+		if err := json.Unmarshal([]byte(state), &value); err != nil {
+			log.Printf("Skipping unreadable saved chat state: %v", err)
+			continue
+		}
+		saved = append(saved, value)
+	}
+	return saved, nil
+}
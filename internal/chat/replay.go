@@ -0,0 +1,772 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	replayFlushInterval = 5 * time.Second
+	replayLineLimit     = 1 << 20 // longest log line read back, in bytes
+	replayLogSuffix     = ".jsonl"
+)
+
+// ReplaySession is one stream session whose chat was recorded for replay. A
+// session runs from when the stream goes live until it stops, as broadcast-box
+// reports them; without those reports it starts when the stream's room is created
+// and lasts until the room is purged.
+type ReplaySession struct {
+	ID        string    `json:"id"`
+	StartedAt time.Time `json:"startedAt"`
+}
+
+// ReplayMessage is a chat message placed on its session's timeline. A message
+// moderators deleted keeps its place without its text; one they edited has the
+// latest text.
+type ReplayMessage struct {
+	ChatMessage
+	OffsetMs  int64 `json:"offsetMs"`            // since the session started
+	DeletedMs int64 `json:"deletedMs,omitempty"` // offset it was deleted at
+	EditedMs  int64 `json:"editedMs,omitempty"`  // offset it was last edited at
+}
+
+// ReplaySummary totals one session's chat
+type ReplaySummary struct {
+	ReplaySession
+	EndedAt       *time.Time `json:"endedAt,omitempty"` // unset while the stream is live, or if it never reported stopping
+	DurationMs    int64      `json:"durationMs,omitempty"`
+	Messages      int        `json:"messages"`
+	Chatters      int        `json:"chatters"`      // distinct users who sent messages
+	Clears        int        `json:"clears"`        // times moderators cleared chat
+	Deleted       int        `json:"deleted"`       // messages moderators deleted
+	Edited        int        `json:"edited"`        // edits made to messages
+	LastMessageMs int64      `json:"lastMessageMs"` // offset of the last message
+}
+
+// replayEntry is one line of a session's log
+type replayEntry struct {
+	Type      string       `json:"type"` // "message", "clear" when moderators cleared chat, "start" and "end" when the stream did, or a tombstone's type
+	Message   *ChatMessage `json:"message,omitempty"`
+	Tombstone *Tombstone   `json:"tombstone,omitempty"`
+	Timestamp time.Time    `json:"timestamp"`
+}
+
+// ReplayStore records every session's chat to disk so it can be played back in
+// sync with recordings of the stream
+type ReplayStore struct {
+	dir     string                   // "" disables recording
+	pending map[string][]replayEntry // session log path -> entries not yet written
+	mutex   sync.Mutex
+}
+
+// NewReplayStore creates a store recording to dir, or recording nothing if dir is empty
+func NewReplayStore(dir string) *ReplayStore {
+	return &ReplayStore{
+		dir:     dir,
+		pending: make(map[string][]replayEntry),
+	}
+}
+
+// Enabled reports whether sessions are being recorded
+func (s *ReplayStore) Enabled() bool {
+	return s.dir != ""
+}
+
+// Record queues a message for its session's log
+func (s *ReplayStore) Record(msg ChatMessage, startedAt time.Time) {
+	s.append(msg.StreamKey, startedAt, replayEntry{Type: "message", Message: &msg, Timestamp: msg.Timestamp})
+}
+
+// RecordClear marks that moderators cleared chat, hiding earlier messages from replays
+func (s *ReplayStore) RecordClear(streamKey string, startedAt time.Time) {
+	s.append(streamKey, startedAt, replayEntry{Type: "clear", Timestamp: time.Now()})
+}
+
+// RecordStart marks that the stream went live, starting the session
+func (s *ReplayStore) RecordStart(streamKey string, startedAt time.Time) {
+	s.append(streamKey, startedAt, replayEntry{Type: "start", Timestamp: startedAt})
+}
+
+// RecordEnd marks that the stream stopped, ending the session
+func (s *ReplayStore) RecordEnd(streamKey string, startedAt, endedAt time.Time) {
+	s.append(streamKey, startedAt, replayEntry{Type: "end", Timestamp: endedAt})
+}
+
+// RecordTombstone marks that a message of the session was deleted or edited
+func (s *ReplayStore) RecordTombstone(startedAt time.Time, tombstone Tombstone) {
+	s.append(tombstone.StreamKey, startedAt, replayEntry{Type: tombstone.Type, Tombstone: &tombstone, Timestamp: tombstone.Timestamp})
+}
+
+// append queues an entry for a session's log
+func (s *ReplayStore) append(streamKey string, startedAt time.Time, entry replayEntry) {
+	if !s.Enabled() {
+		return
+	}
+
+	path := s.path(streamKey, replaySessionID(startedAt))
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.pending[path] = append(s.pending[path], entry)
+}
+
+// replaySessionID names a session after when it started
+func replaySessionID(startedAt time.Time) string {
+	return strconv.FormatInt(startedAt.UnixMilli(), 10)
+}
+
+// path is the log a session's chat is recorded to
+func (s *ReplayStore) path(streamKey, sessionID string) string {
+	return filepath.Join(s.dir, url.PathEscape(streamKey), sessionID+replayLogSuffix)
+}
+
+// Flush appends queued entries to their session logs
+func (s *ReplayStore) Flush() error {
+	if !s.Enabled() {
+		return nil
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var errs []error
+	for path, entries := range s.pending {
+		if err := appendReplayEntries(path, entries); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		delete(s.pending, path)
+	}
+	return errors.Join(errs...)
+}
+
+// appendReplayEntries writes entries to the end of a log, one JSON object per line
+func appendReplayEntries(path string, entries []replayEntry) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(file)
+	encoder := json.NewEncoder(writer)
+	for _, entry := range entries {
+		if err := encoder.Encode(entry); err != nil {
+			file.Close()
+			return err
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Sessions lists a stream's recorded sessions, newest first
+func (s *ReplayStore) Sessions(streamKey string) ([]ReplaySession, error) {
+	if err := s.Flush(); err != nil {
+		return nil, err
+	}
+
+	files, err := os.ReadDir(filepath.Join(s.dir, url.PathEscape(streamKey)))
+	if errors.Is(err, os.ErrNotExist) {
+		return []ReplaySession{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// A compacted session may have a gzipped log and a newer plain one
+	seen := make(map[string]bool)
+	sessions := []ReplaySession{}
+	for _, file := range files {
+		id, isLog := strings.CutSuffix(strings.TrimSuffix(file.Name(), gzipSuffix), replayLogSuffix)
+		startedAt, err := parseReplaySessionID(id)
+		if !isLog || err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		sessions = append(sessions, ReplaySession{ID: id, StartedAt: startedAt})
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].StartedAt.After(sessions[j].StartedAt)
+	})
+	return sessions, nil
+}
+
+// sessionAt returns when the session running at a time started, if one was recorded
+func (s *ReplayStore) sessionAt(streamKey string, at time.Time) (time.Time, bool, error) {
+	sessions, err := s.Sessions(streamKey)
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	for _, session := range sessions {
+		if !session.StartedAt.After(at) {
+			return session.StartedAt, true, nil
+		}
+	}
+	return time.Time{}, false, nil
+}
+
+// parseReplaySessionID returns when the session with an ID started
+func parseReplaySessionID(id string) (time.Time, error) {
+	ms, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(ms), nil
+}
+
+// Messages returns a session's messages from offset from onwards, in order. Messages
+// cleared by moderators are left out.
+func (s *ReplayStore) Messages(streamKey, sessionID string, from time.Duration) ([]ReplayMessage, error) {
+	startedAt, err := parseReplaySessionID(sessionID)
+	if err != nil {
+		return nil, ErrReplayNotFound
+	}
+
+	messages := []ReplayMessage{}
+	positions := make(map[string]int) // message ID -> index in messages
+	err = s.readSession(streamKey, sessionID, func(entry replayEntry) {
+		switch {
+		case entry.Type == "clear":
+			messages = messages[:0]
+			clear(positions)
+		case entry.Message != nil:
+			offset := entry.Message.Timestamp.Sub(startedAt)
+			if offset >= from {
+				positions[entry.Message.ID] = len(messages)
+				messages = append(messages, ReplayMessage{ChatMessage: *entry.Message, OffsetMs: offset.Milliseconds()})
+			}
+		case entry.Tombstone != nil:
+			i, exists := positions[entry.Tombstone.MessageID]
+			if !exists {
+				return
+			}
+			offset := entry.Tombstone.Timestamp.Sub(startedAt).Milliseconds()
+			if entry.Type == TombstoneDeleted {
+				messages[i].Message = ""
+				messages[i].DeletedMs = offset
+			} else if messages[i].DeletedMs == 0 {
+				messages[i].Message = entry.Tombstone.Message
+				messages[i].EditedMs = offset
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+// Summary totals a session's chat, for per-session analytics. Cleared messages
+// still count, since they were sent during the stream.
+func (s *ReplayStore) Summary(streamKey, sessionID string) (ReplaySummary, error) {
+	startedAt, err := parseReplaySessionID(sessionID)
+	if err != nil {
+		return ReplaySummary{}, ErrReplayNotFound
+	}
+
+	summary := ReplaySummary{ReplaySession: ReplaySession{ID: sessionID, StartedAt: startedAt}}
+	chatters := make(map[string]bool)
+	err = s.readSession(streamKey, sessionID, func(entry replayEntry) {
+		switch {
+		case entry.Type == "end":
+			endedAt := entry.Timestamp
+			summary.EndedAt = &endedAt
+		case entry.Type == "clear":
+			summary.Clears++
+		case entry.Type == TombstoneDeleted:
+			summary.Deleted++
+		case entry.Type == TombstoneEdited:
+			summary.Edited++
+		case entry.Message != nil:
+			summary.Messages++
+			chatters[entry.Message.UserID] = true
+			summary.LastMessageMs = entry.Message.Timestamp.Sub(startedAt).Milliseconds()
+		}
+	})
+	if err != nil {
+		return ReplaySummary{}, err
+	}
+	summary.Chatters = len(chatters)
+	if summary.EndedAt != nil {
+		summary.DurationMs = summary.EndedAt.Sub(summary.StartedAt).Milliseconds()
+	}
+	return summary, nil
+}
+
+// readSession calls fn with each entry of a session's log, in order. Compaction
+// moves older entries to a gzipped log, so that is read first.
+func (s *ReplayStore) readSession(streamKey, sessionID string, fn func(entry replayEntry)) error {
+	if err := s.Flush(); err != nil {
+		return err
+	}
+
+	path := s.path(streamKey, sessionID)
+	found := false
+	for _, logPath := range []string{path + gzipSuffix, path} {
+		err := readReplayLog(logPath, fn)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		found = true
+	}
+	if !found {
+		return ErrReplayNotFound
+	}
+	return nil
+}
+
+// hasSession reports whether anything was recorded for a session
+func (s *ReplayStore) hasSession(streamKey, sessionID string) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	path := s.path(streamKey, sessionID)
+	if len(s.pending[path]) > 0 {
+		return true
+	}
+	for _, logPath := range []string{path + gzipSuffix, path} {
+		if _, err := os.Stat(logPath); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// readReplayLog calls fn with each entry of one log file, gzipped or not
+func readReplayLog(path string, fn func(entry replayEntry)) error {
+	reader, err := openMaybeGzipped(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, replayLineLimit)
+	for scanner.Scan() {
+		var entry replayEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return err
+		}
+		fn(entry)
+	}
+	return scanner.Err()
+}
+
+// Compact gzips the logs of sessions nothing was recorded to since coldBefore,
+// dropping clears that repeat one with nothing recorded in between, and adds what
+// it did to report. Entries recorded to a session later start a new plain log,
+// merged in by the next compaction.
+func (s *ReplayStore) Compact(coldBefore time.Time, report *CompactionReport) error {
+	if !s.Enabled() {
+		return nil
+	}
+	if err := s.Flush(); err != nil {
+		return err
+	}
+
+	// Holding the mutex keeps flushes from appending to logs being rewritten
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	streams, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, stream := range streams {
+		if !stream.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.dir, stream.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, file := range files {
+			if !strings.HasSuffix(file.Name(), replayLogSuffix) {
+				continue
+			}
+			info, err := file.Info()
+			if err != nil {
+				return err
+			}
+			if !info.ModTime().Before(coldBefore) {
+				continue
+			}
+			if err := compactReplayLog(filepath.Join(dir, file.Name()), report); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// compactReplayLog merges a session's plain log into its gzipped one, dropping
+// repeated clears
+func compactReplayLog(path string, report *CompactionReport) error {
+	var before int64
+	entries := []replayEntry{}
+	for _, logPath := range []string{path + gzipSuffix, path} {
+		info, err := os.Stat(logPath)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		before += info.Size()
+
+		err = readReplayLog(logPath, func(entry replayEntry) {
+			if entry.Type == "clear" && len(entries) > 0 && entries[len(entries)-1].Type == "clear" {
+				report.TombstonesRemoved++
+				return
+			}
+			entries = append(entries, entry)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	after, err := writeGzipFile(path+gzipSuffix, func(w io.Writer) error {
+		encoder := json.NewEncoder(w)
+		for _, entry := range entries {
+			if err := encoder.Encode(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		return err
+	}
+	report.FilesCompressed++
+	report.BytesReclaimed += before - after
+	return nil
+}
+
+// EraseUser removes every message the user sent from the session logs, with the
+// tombstones of edits made to them, and takes their name off deletions and edits
+// they made as a moderator. It returns how many messages were removed.
+func (s *ReplayStore) EraseUser(userID string) (int, error) {
+	if !s.Enabled() {
+		return 0, nil
+	}
+
+	// Holding the mutex keeps flushes from appending to logs being rewritten
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	paths := make(map[string]bool)
+	for path := range s.pending {
+		paths[path] = true
+	}
+	streams, err := os.ReadDir(s.dir)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+	for _, stream := range streams {
+		if !stream.IsDir() {
+			continue
+		}
+		dir := filepath.Join(s.dir, stream.Name())
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			return 0, err
+		}
+		for _, file := range files {
+			if name := strings.TrimSuffix(file.Name(), gzipSuffix); strings.HasSuffix(name, replayLogSuffix) {
+				paths[filepath.Join(dir, name)] = true
+			}
+		}
+	}
+
+	removed := 0
+	for path := range paths {
+		// A session's gzipped log comes before its plain one, and both before what
+		// is pending, so tombstones are always met after their message
+		erased := make(map[string]bool)
+		for _, logPath := range []string{path + gzipSuffix, path} {
+			n, err := eraseReplayLog(logPath, userID, erased)
+			if err != nil {
+				return removed, err
+			}
+			removed += n
+		}
+		if entries, exists := s.pending[path]; exists {
+			kept, n, _ := eraseReplayEntries(entries, userID, erased)
+			s.pending[path] = kept
+			removed += n
+		}
+	}
+	return removed, nil
+}
+
+// eraseReplayLog rewrites one log file without a user's messages, if it had any
+// of their data, adding the IDs of the messages removed to erased
+func eraseReplayLog(path, userID string, erased map[string]bool) (int, error) {
+	entries := []replayEntry{}
+	err := readReplayLog(path, func(entry replayEntry) {
+		entries = append(entries, entry)
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	kept, removed, changed := eraseReplayEntries(entries, userID, erased)
+	if !changed {
+		return 0, nil
+	}
+
+	if strings.HasSuffix(path, gzipSuffix) {
+		_, err = writeGzipFile(path, func(w io.Writer) error {
+			encoder := json.NewEncoder(w)
+			for _, entry := range kept {
+				if err := encoder.Encode(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		return removed, err
+	}
+
+	// Write then rename so a crash never leaves a truncated log
+	tmp := path + ".tmp"
+	os.Remove(tmp)
+	if err := appendReplayEntries(tmp, kept); err != nil {
+		os.Remove(tmp)
+		return 0, err
+	}
+	return removed, os.Rename(tmp, path)
+}
+
+// eraseReplayEntries drops a user's messages, and the tombstones of messages in
+// erased or dropped here, and clears the user from the tombstones left. changed
+// reports whether any entry was dropped or cleared.
+func eraseReplayEntries(entries []replayEntry, userID string, erased map[string]bool) (kept []replayEntry, removed int, changed bool) {
+	kept = make([]replayEntry, 0, len(entries))
+	for _, entry := range entries {
+		switch {
+		case entry.Message != nil && entry.Message.UserID == userID:
+			erased[entry.Message.ID] = true
+			removed++
+			changed = true
+			continue
+		case entry.Tombstone != nil && erased[entry.Tombstone.MessageID]:
+			changed = true
+			continue
+		case entry.Tombstone != nil && entry.Tombstone.ByUserID == userID:
+			tombstone := *entry.Tombstone
+			tombstone.ByUserID = ""
+			entry.Tombstone = &tombstone
+			changed = true
+		}
+		kept = append(kept, entry)
+	}
+	return kept, removed, changed
+}
+
+// replayWorker periodically writes recorded chat to disk until the manager stops
+func (m *Manager) replayWorker() {
+	defer trackWorker("manager.replay")()
+
+	ticker := time.NewTicker(replayFlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.replay.Flush(); err != nil {
+				log.Printf("Failed to save chat replay: %v", err)
+			}
+		case <-m.stopReplay:
+			if err := m.replay.Flush(); err != nil {
+				log.Printf("Failed to save chat replay: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// ReplaySessionsHandler serves GET /api/chat/{streamKey}/replay, listing the stream's
+// recorded sessions
+func (h *WSHandler) ReplaySessionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey", http.StatusBadRequest)
+		return
+	}
+
+	if !h.manager.replay.Enabled() {
+		writeChatError(w, http.StatusNotFound, ErrReplayDisabled)
+		return
+	}
+
+	sessions, err := h.manager.replay.Sessions(streamKey)
+	if err != nil {
+		log.Printf("Failed to list chat replays for %s: %v", streamKey, err)
+		http.Error(w, "Failed to list replays", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"streamKey": streamKey,
+		"sessions":  sessions,
+	})
+}
+
+// ReplayHandler serves GET /api/chat/{streamKey}/replay/{sessionID}?from=MS&limit=N,
+// a session's messages keyed by their offset in milliseconds from the start of the
+// stream. With stream=true the messages from the offset on are sent as Server-Sent
+// Events at their original pacing, for chat playback alongside a recording.
+func (h *WSHandler) ReplayHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	sessionID := r.PathValue("sessionID")
+	if streamKey == "" || sessionID == "" {
+		http.Error(w, "Missing streamKey or sessionID", http.StatusBadRequest)
+		return
+	}
+
+	if !h.manager.replay.Enabled() {
+		writeChatError(w, http.StatusNotFound, ErrReplayDisabled)
+		return
+	}
+
+	params := r.URL.Query()
+
+	var from time.Duration
+	if val := params.Get("from"); val != "" {
+		parsed, err := strconv.ParseInt(val, 10, 64)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid from", http.StatusBadRequest)
+			return
+		}
+		from = time.Duration(parsed) * time.Millisecond
+	}
+
+	limit := maxPageSize
+	if val := params.Get("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, maxPageSize)
+	}
+
+	if err := h.checkHistoryRead(r, streamKey); err != nil {
+		writeChatError(w, http.StatusTooManyRequests, err)
+		return
+	}
+
+	messages, err := h.manager.replay.Messages(streamKey, sessionID, from)
+	if errors.Is(err, ErrReplayNotFound) {
+		writeChatError(w, http.StatusNotFound, ErrReplayNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read chat replay %s for %s: %v", sessionID, streamKey, err)
+		http.Error(w, "Failed to read replay", http.StatusInternalServerError)
+		return
+	}
+
+	if params.Get("stream") == "true" {
+		h.streamReplay(w, r, messages, from)
+		return
+	}
+
+	response := map[string]interface{}{
+		"streamKey": streamKey,
+		"sessionId": sessionID,
+		"messages":  messages[:min(len(messages), limit)],
+	}
+	// The offset to pass as from for the next page
+	if len(messages) > limit {
+		response["nextFrom"] = messages[limit].OffsetMs
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// streamReplay sends messages as Server-Sent Events, each one its offset after from
+// has passed since the request began, and ends with a "replay_end" event
+func (h *WSHandler) streamReplay(w http.ResponseWriter, r *http.Request, messages []ReplayMessage, from time.Duration) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	for _, msg := range messages {
+		due := time.Duration(msg.OffsetMs)*time.Millisecond - from
+		timer.Reset(max(0, due-time.Since(start)))
+
+		select {
+		case <-timer.C:
+		case <-r.Context().Done():
+			return
+		}
+
+		if err := h.writeSSEEvent(w, WSMessage{Type: "message", Data: msg, Timestamp: time.Now()}); err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+
+	if _, err := fmt.Fprint(w, "event: replay_end\ndata: {}\n\n"); err == nil {
+		flusher.Flush()
+	}
+}
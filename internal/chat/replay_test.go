@@ -0,0 +1,149 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newReplayTestHandler(t *testing.T) *WSHandler {
+	config := DefaultConfig()
+	config.ReplayDir = t.TempDir()
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+
+	return NewWSHandler(manager, NewRateLimiter(config))
+}
+
+func replayRequest(h *WSHandler, handler http.HandlerFunc, query string, sessionID string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, "/?"+query, nil)
+	r.SetPathValue("streamKey", "room")
+	r.SetPathValue("sessionID", sessionID)
+	w := httptest.NewRecorder()
+	handler(w, r)
+	return w
+}
+
+func TestReplayRecordsSessions(t *testing.T) {
+	h := newReplayTestHandler(t)
+
+	_, err := h.manager.AddMessage("room", "alice", "alice", "cleared later")
+	require.NoError(t, err)
+	_, err = h.manager.ClearRoom("room")
+	require.NoError(t, err)
+	_, err = h.manager.AddMessage("room", "alice", "alice", "first")
+	require.NoError(t, err)
+	_, err = h.manager.AddMessage("room", "bob", "bob", "second")
+	require.NoError(t, err)
+
+	w := replayRequest(h, h.ReplaySessionsHandler, "", "")
+	require.Equal(t, http.StatusOK, w.Code)
+	var list struct {
+		Sessions []ReplaySession `json:"sessions"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &list))
+	require.Len(t, list.Sessions, 1)
+
+	room, _ := h.manager.GetRoom("room")
+	require.Equal(t, replaySessionID(room.startedAt), list.Sessions[0].ID)
+
+	w = replayRequest(h, h.ReplayHandler, "limit=1", list.Sessions[0].ID)
+	require.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Messages []ReplayMessage `json:"messages"`
+		NextFrom *int64          `json:"nextFrom"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Messages, 1)
+	require.Equal(t, "first", page.Messages[0].Message)
+	require.NotNil(t, page.NextFrom)
+
+	w = replayRequest(h, h.ReplayHandler, "", "12345")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w = replayRequest(h, h.ReplayHandler, "", "../../etc")
+	require.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestReplaySessionsFollowStreamLifecycle(t *testing.T) {
+	h := newReplayTestHandler(t)
+
+	h.manager.StreamStarted("room")
+	first, _ := h.manager.GetRoom("room")
+	firstID := replaySessionID(first.startedAt)
+	for _, send := range [][2]string{{"alice", "hello"}, {"bob", "hi"}, {"alice", "bye"}} {
+		_, err := h.manager.AddMessage("room", send[0], send[0], send[1])
+		require.NoError(t, err)
+	}
+	h.manager.StreamEnded("room")
+
+	// Chat between streams belongs to neither session
+	_, err := h.manager.AddMessage("room", "bob", "bob", "offline")
+	require.NoError(t, err)
+
+	time.Sleep(5 * time.Millisecond)
+	h.manager.StreamStarted("room")
+	_, err = h.manager.AddMessage("room", "carol", "carol", "back")
+	require.NoError(t, err)
+
+	sessions, err := h.manager.replay.Sessions("room")
+	require.NoError(t, err)
+	require.Len(t, sessions, 2)
+	require.Equal(t, firstID, sessions[1].ID)
+
+	w := replayRequest(h, h.ReplaySummaryHandler, "", firstID)
+	require.Equal(t, http.StatusOK, w.Code)
+	var summary ReplaySummary
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &summary))
+	require.Equal(t, 3, summary.Messages)
+	require.Equal(t, 2, summary.Chatters)
+	require.NotNil(t, summary.EndedAt)
+
+	messages, err := h.manager.replay.Messages("room", sessions[0].ID, 0)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Equal(t, "back", messages[0].Message)
+
+	summary, err = h.manager.replay.Summary("room", sessions[0].ID)
+	require.NoError(t, err)
+	require.Nil(t, summary.EndedAt)
+}
+
+func TestReplayStreamsAtOriginalPacing(t *testing.T) {
+	h := newReplayTestHandler(t)
+
+	startedAt := time.Now().Add(-time.Hour)
+	for i, offset := range []time.Duration{time.Second, 1200 * time.Millisecond, 1400 * time.Millisecond} {
+		msg := newChatMessage("room", "alice", "alice", strings.Repeat("x", i+1))
+		msg.Timestamp = startedAt.Add(offset)
+		h.manager.replay.Record(*msg, startedAt)
+	}
+
+	start := time.Now()
+	w := replayRequest(h, h.ReplayHandler, "stream=true&from=1000", replaySessionID(startedAt))
+	elapsed := time.Since(start)
+
+	var events []string
+	scanner := bufio.NewScanner(w.Body)
+	for scanner.Scan() {
+		if name, ok := strings.CutPrefix(scanner.Text(), "event: "); ok {
+			events = append(events, name)
+		}
+	}
+	require.Equal(t, []string{"message", "message", "message", "replay_end"}, events)
+	require.GreaterOrEqual(t, elapsed, 400*time.Millisecond)
+	require.Less(t, elapsed, 2*time.Second)
+}
+
+func TestReplayDisabled(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	w := replayRequest(h, h.ReplaySessionsHandler, "", "")
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Contains(t, w.Body.String(), ErrReplayDisabled.Code)
+}
@@ -0,0 +1,73 @@
+package chat
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	reservationTTL  = 30 * time.Second
+	maxReservations = 16 // outstanding per connection
+)
+
+// messageReservations are the message IDs a connection has reserved but not yet used
+type messageReservations struct {
+	expires map[string]time.Time
+	mutex   sync.Mutex
+}
+
+// reserve hands out a fresh message ID, valid until the returned time
+func (r *messageReservations) reserve() (string, time.Time, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	for id, expiresAt := range r.expires {
+		if now.After(expiresAt) {
+			delete(r.expires, id)
+		}
+	}
+
+	if len(r.expires) >= maxReservations {
+		return "", time.Time{}, ErrTooManyReservations.withDetails(ErrorDetails{Limit: maxReservations})
+	}
+
+	if r.expires == nil {
+		r.expires = make(map[string]time.Time)
+	}
+	id := uuid.New().String()
+	r.expires[id] = now.Add(reservationTTL)
+	return id, r.expires[id], nil
+}
+
+// take spends a reservation, reporting whether it existed and had not expired
+func (r *messageReservations) take(id string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	expiresAt, exists := r.expires[id]
+	delete(r.expires, id)
+	return exists && time.Now().Before(expiresAt)
+}
+
+// handleReserve reserves a message ID for the client's next message
+func (c *Connection) handleReserve() {
+	if c.UserID == "" {
+		c.sendChatError(ErrNotJoined)
+		return
+	}
+
+	id, expiresAt, err := c.reservations.reserve()
+	if err != nil {
+		c.sendChatError(err)
+		return
+	}
+
+	c.send(WSMessage{
+		Type:      "reserved",
+		Data:      ReservedEvent{ID: id, ExpiresAt: expiresAt},
+		Timestamp: time.Now(),
+	})
+}
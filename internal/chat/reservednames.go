@@ -0,0 +1,41 @@
+package chat
+
+import "strings"
+
+// ReservedNames are display names only authenticated users may chat under, so
+// nobody can pass as staff or the broadcaster. Names are compared folded, so
+// lookalikes of a reserved name are reserved too.
+type ReservedNames struct {
+	owners map[string]string // folded name -> the userID it belongs to; "" for whoever the authenticator gives that name
+}
+
+// NewReservedNames parses entries that are either a name, which an authenticated
+// user may use if their identity carries it, or "name=userID", which only that
+// user may use
+func NewReservedNames(entries []string) *ReservedNames {
+	rn := &ReservedNames{owners: make(map[string]string)}
+	for _, entry := range entries {
+		name, owner, _ := strings.Cut(entry, "=")
+		if folded := FoldUsername(name); folded != "" {
+			rn.owners[folded] = strings.TrimSpace(owner)
+		}
+	}
+	return rn
+}
+
+// Allows reports whether a user with the given identity, nil if unauthenticated,
+// may go by username
+func (rn *ReservedNames) Allows(username string, identity *Identity) bool {
+	folded := FoldUsername(username)
+	owner, reserved := rn.owners[folded]
+	if !reserved {
+		return true
+	}
+	if identity == nil {
+		return false
+	}
+	if owner != "" {
+		return identity.UserID == owner
+	}
+	return identity.Username != "" && FoldUsername(identity.Username) == folded
+}
@@ -0,0 +1,40 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReservedNames(t *testing.T) {
+	reserved := NewReservedNames([]string{"admin", "Streamer=user-1"})
+
+	require.True(t, reserved.Allows("alice", nil))
+	for _, name := range []string{"admin", "ADMIN", "Аdmin", "adm1n", "Streamer", "strеamer"} {
+		require.False(t, reserved.Allows(name, nil), name)
+		require.False(t, reserved.Allows(name, &Identity{UserID: "user-2", Username: "alice"}), name)
+	}
+
+	// A plain name is for whoever the authenticator gives it to
+	require.True(t, reserved.Allows("Admin", &Identity{UserID: "user-3", Username: "admin"}))
+
+	// A name with an owner is for the owner only
+	require.True(t, reserved.Allows("Streamer", &Identity{UserID: "user-1"}))
+	require.False(t, reserved.Allows("Streamer", &Identity{UserID: "user-2", Username: "streamer"}))
+}
+
+func TestJoinRefusesReservedNames(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	impostor := dialTestClient(t, server, "room")
+	require.NoError(t, impostor.WriteJSON(map[string]interface{}{"type": "join", "data": map[string]string{"userId": "x", "username": "Moderator"}}))
+	require.Equal(t, CodeUsernameReserved, readUntil(t, impostor, "error")["code"])
+
+	h.SetAuthenticator(AuthenticatorFunc(func(context.Context, Credentials) (*Identity, error) {
+		return &Identity{UserID: "staff-1", Username: "Moderator"}, nil
+	}))
+	mod := dialTestClient(t, server, "room")
+	require.NoError(t, mod.WriteJSON(map[string]interface{}{"type": "join", "data": map[string]string{"userId": "staff-1", "username": "Moderator"}}))
+	readUntil(t, mod, "room_state")
+}
@@ -0,0 +1,174 @@
+package chat
+
+import (
+	"log"
+	"time"
+)
+
+// SavedRoom is what a room keeps besides its messages that should survive a
+// restart
+type SavedRoom struct {
+	StreamKey string     `json:"streamKey"`
+	Modes     RoomModes  `json:"modes"`
+	StartedAt time.Time  `json:"startedAt"`         // start of the stream session, which replays are timed from
+	EndedAt   *time.Time `json:"endedAt,omitempty"` // when the stream stopped, if it isn't live
+
+	// ChatDisabled is set when the streamer turned chat off. It outlives the room:
+	// once the room is gone, a state with only the stream key and this is kept.
+	ChatDisabled bool `json:"chatDisabled,omitempty"`
+}
+
+// RoomStore is implemented by message stores that also keep each live room's
+// state, so the Manager can rehydrate rooms after a restart
+type RoomStore interface {
+	// SaveRoom records a room's state, replacing what was saved before
+	SaveRoom(room SavedRoom) error
+	// DeleteRoom forgets a room that is gone for good
+	DeleteRoom(streamKey string) error
+	// LoadRooms returns the state of every room saved and not deleted
+	LoadRooms() ([]SavedRoom, error)
+}
+
+// roomStates returns the installed message store if it keeps room state, or nil
+func (m *Manager) roomStates() RoomStore {
+	states, _ := m.persistence().(RoomStore)
+	return states
+}
+
+// state returns the room's state
+func (cr *ChatRoom) state() SavedRoom {
+	state := SavedRoom{StreamKey: cr.StreamKey, Modes: cr.Modes()}
+
+	cr.MessagesMux.RLock()
+	state.StartedAt = cr.startedAt
+	state.ChatDisabled = cr.chatDisabled
+	if !cr.endedAt.IsZero() {
+		endedAt := cr.endedAt
+		state.EndedAt = &endedAt
+	}
+	cr.MessagesMux.RUnlock()
+
+	return state
+}
+
+// saveState records the room's current state in its store, if that keeps room
+// state. Saves are serialized and each reads the state when it runs, so the last
+// one to land is always current.
+func (cr *ChatRoom) saveState() {
+	cr.stateMux.Lock()
+	defer cr.stateMux.Unlock()
+
+	cr.MessagesMux.RLock()
+	states, ok := cr.store.(RoomStore)
+	cr.MessagesMux.RUnlock()
+	if !ok {
+		return
+	}
+
+	if err := states.SaveRoom(cr.state()); err != nil {
+		log.Printf("Failed to save chat room state for %s: %v", cr.StreamKey, err)
+	}
+}
+
+// forgetRoomState deletes a purged room's saved state, so it isn't restored. A
+// stream with chat turned off keeps a state saying so.
+func (m *Manager) forgetRoomState(streamKey string) {
+	states := m.roomStates()
+	if states == nil {
+		return
+	}
+
+	var err error
+	if m.settings.get(streamKey).ChatEnabled {
+		err = states.DeleteRoom(streamKey)
+	} else {
+		err = states.SaveRoom(SavedRoom{StreamKey: streamKey, ChatDisabled: true})
+	}
+	if err != nil {
+		log.Printf("Failed to forget chat room state for %s: %v", streamKey, err)
+	}
+}
+
+// isSettingsOnly reports whether a saved state only records that chat is off for a
+// stream whose room is gone
+func (state SavedRoom) isSettingsOnly() bool {
+	return state.ChatDisabled && state.StartedAt.IsZero() && state.EndedAt == nil && state.Modes == (RoomModes{})
+}
+
+// Restore rehydrates the rooms saved in the message store: their modes, session
+// start and the most recent of their messages still within retention, with
+// numbering continuing after the newest, so a deploy mid-stream doesn't wipe chat.
+// Streams whose chat was turned off stay off. Call it once at startup, after
+// SetMessageStore and before serving clients. Returns how many rooms were restored.
+func (m *Manager) Restore() (int, error) {
+	states := m.roomStates()
+	if states == nil {
+		return 0, nil
+	}
+
+	saved, err := states.LoadRooms()
+	if err != nil {
+		return 0, err
+	}
+
+	restored := 0
+	for _, state := range saved {
+		if state.ChatDisabled {
+			m.settings.update(state.StreamKey, func(settings *StreamSettings) { settings.ChatEnabled = false })
+		}
+		if state.isSettingsOnly() {
+			continue
+		}
+
+		messages, err := moderatedRange(m.persistence(), state.StreamKey, 0)
+		if err != nil {
+			log.Printf("Failed to restore chat messages for %s: %v", state.StreamKey, err)
+			continue
+		}
+
+		room := m.GetOrCreateRoom(state.StreamKey)
+		room.SetModes(state.Modes)
+		buffered := room.restore(messages, state.StartedAt, state.EndedAt)
+		room.saveState()
+
+		restored++
+		log.Printf("Restored chat room %s with %d messages", state.StreamKey, buffered)
+	}
+	return restored, nil
+}
+
+// restore fills the buffer of a room being rehydrated with the newest of its
+// stored messages that fit and are within retention, continuing the numbering
+// after the newest stored one and resuming its stream session. Returns how many
+// messages were buffered.
+func (cr *ChatRoom) restore(messages []ChatMessage, startedAt time.Time, endedAt *time.Time) int {
+	cr.MessagesMux.Lock()
+	defer cr.MessagesMux.Unlock()
+
+	for _, msg := range messages {
+		cr.LastSeq = max(cr.LastSeq, msg.Seq)
+	}
+	if !startedAt.IsZero() {
+		cr.startedAt = startedAt
+	}
+	if endedAt != nil {
+		cr.endedAt = *endedAt
+	}
+
+	if cr.retention > 0 {
+		cutoff := time.Now().Add(-cr.retention)
+		for len(messages) > 0 && messages[0].Timestamp.Before(cutoff) {
+			messages = messages[1:]
+		}
+	}
+	messages = messages[max(0, len(messages)-cr.maxMessages):]
+
+	if len(messages) > cr.Messages.Capacity() {
+		cr.Messages.Resize(len(messages))
+	}
+	for _, msg := range messages {
+		cr.Messages.Add(msg)
+	}
+	cr.MessageCount += int64(len(messages))
+	return len(messages)
+}
@@ -0,0 +1,109 @@
+package chat
+
+import (
+	"errors"
+	"time"
+)
+
+// RetentionPolicy is a broadcaster's choice of how long their room keeps messages
+// and how many it may hold, overriding MessageRetentionMinutes and the buffer
+// limits. Zero values keep the server's settings.
+type RetentionPolicy struct {
+	RetentionMinutes int `json:"retentionMinutes,omitempty"`
+	MaxMessages      int `json:"maxMessages,omitempty"` // capped at what the server lets popular rooms hold
+}
+
+// validate rejects policies with negative values
+func (p RetentionPolicy) validate() error {
+	if p.RetentionMinutes < 0 || p.MaxMessages < 0 {
+		return errors.New("retentionMinutes and maxMessages can't be negative")
+	}
+	return nil
+}
+
+// RetentionPolicy returns a stream's retention overrides
+func (m *Manager) RetentionPolicy(streamKey string) RetentionPolicy {
+	return m.settings.get(streamKey).RetentionPolicy
+}
+
+// SetRetentionPolicy overrides how long a stream's room keeps messages and how
+// many it holds. A room that exists trims what falls outside the new policy at
+// once; one created later starts with it.
+func (m *Manager) SetRetentionPolicy(streamKey string, policy RetentionPolicy) error {
+	if err := policy.validate(); err != nil {
+		return err
+	}
+
+	m.settings.update(streamKey, func(settings *StreamSettings) {
+		settings.RetentionPolicy = policy
+	})
+	m.applyRetention(streamKey)
+	return nil
+}
+
+// longestRetention returns the longest any stream's retention policy keeps messages
+func (s *streamSettingsStore) longestRetention() time.Duration {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	longest := 0
+	for _, settings := range s.settings {
+		longest = max(longest, settings.RetentionPolicy.RetentionMinutes)
+	}
+	return time.Duration(longest) * time.Minute
+}
+
+// roomLimits returns the buffer size a stream's room starts at and how long it
+// keeps messages, following the stream's retention policy
+func (m *Manager) roomLimits(streamKey string) (minMessages int, retention time.Duration) {
+	policy := m.RetentionPolicy(streamKey)
+
+	retention = time.Duration(m.config.MessageRetentionMinutes) * time.Minute
+	if policy.RetentionMinutes > 0 {
+		retention = time.Duration(policy.RetentionMinutes) * time.Minute
+	}
+
+	// A limit below the usual minimum lowers the minimum too, so the room never
+	// holds more than the broadcaster asked for
+	minMessages = m.config.MinMessagesPerStream
+	if minMessages < 1 || minMessages > m.config.MaxMessagesPerStream {
+		minMessages = m.config.MaxMessagesPerStream
+	}
+	if policy.MaxMessages > 0 {
+		minMessages = min(minMessages, policy.MaxMessages)
+	}
+	return minMessages, retention
+}
+
+// applyRetention brings a stream's room, if it exists, in line with its
+// retention policy
+func (m *Manager) applyRetention(streamKey string) {
+	room, exists := m.GetRoom(streamKey)
+	if !exists {
+		return
+	}
+	m.applyRoomRetention(room)
+}
+
+// applyRoomRetention sets a room's retention and buffer limits from its stream's
+// policy, dropping the messages that fall outside them
+func (m *Manager) applyRoomRetention(room *ChatRoom) {
+	minMessages, retention := m.roomLimits(room.StreamKey)
+
+	room.MessagesMux.Lock()
+	room.retention = retention
+	room.minMessages = minMessages
+	viewers := room.viewers
+	room.MessagesMux.Unlock()
+
+	room.SetMaxMessages(m.historyLimit(room.StreamKey, viewers))
+	room.CleanupOldMessages(retention)
+}
+
+// Retention returns how long the room keeps messages
+func (cr *ChatRoom) Retention() time.Duration {
+	cr.MessagesMux.RLock()
+	defer cr.MessagesMux.RUnlock()
+
+	return cr.retention
+}
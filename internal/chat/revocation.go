@@ -0,0 +1,136 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	subjectSessionsRevoked = "chat.sessions.revoked"
+	revocationRetention    = 24 * time.Hour
+)
+
+// revocationEvent is published on the backplane when a user's sessions are revoked
+type revocationEvent struct {
+	UserID    string    `json:"userId"`
+	RevokedAt time.Time `json:"revokedAt"`
+}
+
+// SessionRevocations records when each user's sessions were last revoked, so
+// credentials issued before that point can be refused
+type SessionRevocations struct {
+	revoked map[string]time.Time
+	mutex   sync.RWMutex
+}
+
+// NewSessionRevocations creates an empty revocation list
+func NewSessionRevocations() *SessionRevocations {
+	return &SessionRevocations{
+		revoked: make(map[string]time.Time),
+	}
+}
+
+// Revoke records a revocation for a user
+func (sr *SessionRevocations) Revoke(userID string, revokedAt time.Time) {
+	sr.mutex.Lock()
+	defer sr.mutex.Unlock()
+
+	if existing, ok := sr.revoked[userID]; !ok || revokedAt.After(existing) {
+		sr.revoked[userID] = revokedAt
+	}
+
+	// Tokens live at most jwtMaxLifetime, so every one an old entry covers has expired
+	cutoff := time.Now().Add(-revocationRetention)
+	for id, at := range sr.revoked {
+		if at.Before(cutoff) {
+			delete(sr.revoked, id)
+		}
+	}
+}
+
+// IsRevoked reports whether a credential issued at issuedAt has since been revoked
+func (sr *SessionRevocations) IsRevoked(userID string, issuedAt time.Time) bool {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+
+	revokedAt, ok := sr.revoked[userID]
+	return ok && !issuedAt.After(revokedAt)
+}
+
+// RevokedAt returns when a user's sessions were last revoked, if they have been
+// within the retention window
+func (sr *SessionRevocations) RevokedAt(userID string) (time.Time, bool) {
+	sr.mutex.RLock()
+	defer sr.mutex.RUnlock()
+
+	revokedAt, ok := sr.revoked[userID]
+	return revokedAt, ok
+}
+
+// SetBroker connects the handler to a backplane so revocations reach every instance
+func (h *WSHandler) SetBroker(broker Broker) error {
+	unsubscribe, err := broker.Subscribe(subjectSessionsRevoked, h.applyRevocation)
+	if err != nil {
+		return err
+	}
+
+	if h.unsubscribeBroker != nil {
+		h.unsubscribeBroker()
+	}
+
+	h.broker = broker
+	h.unsubscribeBroker = unsubscribe
+	return nil
+}
+
+// RevokeSessions invalidates a user's credentials and closes all of their
+// connections on every instance
+func (h *WSHandler) RevokeSessions(userID string) error {
+	payload, err := json.Marshal(revocationEvent{
+		UserID:    userID,
+		RevokedAt: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := h.broker.Publish(subjectSessionsRevoked, payload); err != nil {
+		return err
+	}
+
+	h.publishEvent(WebhookEventSessionsRevoked, "", map[string]interface{}{
+		"userId": userID,
+	})
+	return nil
+}
+
+// applyRevocation handles a revocation event from the backplane
+func (h *WSHandler) applyRevocation(payload []byte) {
+	var event revocationEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		log.Printf("Ignoring invalid revocation event: %v", err)
+		return
+	}
+
+	h.revocations.Revoke(event.UserID, event.RevokedAt)
+	closed := h.closeUserConnections(event.UserID, "session revoked")
+	log.Printf("Revoked sessions for user %s (%d connections closed)", event.UserID, closed)
+}
+
+// closeUserConnections closes every local connection belonging to a user
+func (h *WSHandler) closeUserConnections(userID, reason string) int {
+	toClose := []*Connection{}
+	h.eachConnection(func(conn *Connection) {
+		if conn.UserID == userID {
+			toClose = append(toClose, conn)
+		}
+	})
+
+	for _, conn := range toClose {
+		conn.Close(reason)
+	}
+
+	return len(toClose)
+}
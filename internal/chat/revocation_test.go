@@ -0,0 +1,81 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSessionRevocationsCutoff(t *testing.T) {
+	revocations := NewSessionRevocations()
+	revokedAt := time.Now()
+	revocations.Revoke("alice", revokedAt)
+
+	// Credentials issued up to the revocation are refused, later ones aren't
+	require.True(t, revocations.IsRevoked("alice", revokedAt.Add(-time.Hour)))
+	require.True(t, revocations.IsRevoked("alice", revokedAt))
+	require.False(t, revocations.IsRevoked("alice", revokedAt.Add(time.Second)))
+	require.False(t, revocations.IsRevoked("bob", revokedAt.Add(-time.Hour)))
+
+	// The cutoff only moves forward
+	revocations.Revoke("alice", revokedAt.Add(-time.Minute))
+	at, ok := revocations.RevokedAt("alice")
+	require.True(t, ok)
+	require.True(t, at.Equal(revokedAt))
+	revocations.Revoke("alice", revokedAt.Add(time.Minute))
+	require.True(t, revocations.IsRevoked("alice", revokedAt.Add(time.Second)))
+
+	// Revocations older than the retention window are forgotten
+	revocations.Revoke("carol", time.Now().Add(-revocationRetention-time.Minute))
+	_, ok = revocations.RevokedAt("carol")
+	require.False(t, ok)
+}
+
+func TestRevokeSessionsClosesConnectionsInEveryRoom(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	alice := dialTestClient(t, server, "one")
+	joinTestClient(t, alice, "alice")
+	aliceElsewhere := dialTestClient(t, server, "two")
+	joinTestClient(t, aliceElsewhere, "alice")
+	bob := dialTestClient(t, server, "one")
+	joinTestClient(t, bob, "bob")
+
+	require.NoError(t, h.RevokeSessions("alice"))
+	for _, conn := range []*websocket.Conn{alice, aliceElsewhere} {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				var closeErr *websocket.CloseError
+				require.ErrorAs(t, err, &closeErr)
+				require.Equal(t, "session revoked", closeErr.Text)
+				break
+			}
+		}
+	}
+
+	_, revoked := h.revocations.RevokedAt("alice")
+	require.True(t, revoked)
+	require.Len(t, h.manager.GetUsers("one"), 1)
+	require.Equal(t, "bob", h.manager.GetUsers("one")[0].UserID)
+}
+
+func TestRevocationsOutliveTokens(t *testing.T) {
+	verifier, err := NewJWTVerifier(testJWTSecret, "", "", "")
+	require.NoError(t, err)
+
+	// The longest-lived token issued just before a revocation that is nearly a day old
+	revokedAt := time.Now().Add(-revocationRetention + time.Minute)
+	claims := testClaims("alice")
+	claims["iat"] = revokedAt.Add(-time.Second).Unix()
+	claims["exp"] = revokedAt.Add(-time.Second).Add(jwtMaxLifetime).Unix()
+	identity, err := verifier.Verify(signTestJWT(t, claims))
+	require.NoError(t, err)
+
+	revocations := NewSessionRevocations()
+	revocations.Revoke("alice", revokedAt)
+	revocations.Revoke("bob", time.Now())
+	require.True(t, revocations.IsRevoked("alice", identity.IssuedAt))
+}
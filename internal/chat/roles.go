@@ -0,0 +1,161 @@
+package chat
+
+import (
+	"slices"
+	"strings"
+)
+
+// Roles a user can hold in a room. Authenticators grant them through
+// Identity.Roles, either in every room ("moderator") or in one ("moderator:streamKey").
+// Users granted none are viewers.
+const (
+	RoleOwner     = "owner" // the broadcaster
+	RoleModerator = "moderator"
+	RoleVIP       = "vip"
+	RoleBot       = "bot" // an automated account, such as an alerts bot
+	RoleViewer    = "viewer"
+)
+
+// Permission is something a role lets its holders do in a room
+type Permission string
+
+const (
+	PermModerate        Permission = "moderate"          // time users out, clear the room and set slow mode
+	PermBypassRateLimit Permission = "bypass_rate_limit" // skip the burst and spam limits
+	PermBypassSlowMode  Permission = "bypass_slow_mode"
+	PermBypassRoomModes Permission = "bypass_room_modes" // post while the room is read-only or emote-only
+	PermBypassAutoMod   Permission = "bypass_automod"
+)
+
+// roleSpec is one role's row of the permission matrix
+type roleSpec struct {
+	rank        int    // users may only moderate users of lower rank
+	badge       string // shown beside the user's name; "" for none
+	permissions []Permission
+}
+
+// roleMatrix says what each role may do. A user holding several roles may do
+// what any of them allows.
+var roleMatrix = map[string]roleSpec{
+	RoleOwner: {rank: 3, badge: "broadcaster", permissions: []Permission{
+		PermModerate, PermBypassRateLimit, PermBypassSlowMode, PermBypassRoomModes, PermBypassAutoMod,
+	}},
+	RoleModerator: {rank: 2, badge: "moderator", permissions: []Permission{
+		PermModerate, PermBypassRateLimit, PermBypassSlowMode, PermBypassRoomModes, PermBypassAutoMod,
+	}},
+	RoleVIP:    {rank: 1, badge: "vip", permissions: []Permission{PermBypassSlowMode}},
+	RoleBot:    {rank: 1, badge: "bot", permissions: []Permission{PermBypassRateLimit, PermBypassSlowMode}},
+	RoleViewer: {rank: 0},
+}
+
+// roleOrder lists the roles most senior first, the order a user's roles are kept in
+var roleOrder = []string{RoleOwner, RoleModerator, RoleVIP, RoleBot, RoleViewer}
+
+// parseRoles returns the roles grants give in a room, most senior first. Unknown
+// roles are ignored, and a user granted none is a viewer.
+func parseRoles(grants []string, streamKey string) []string {
+	held := make(map[string]bool)
+	for _, grant := range grants {
+		role, room, scoped := strings.Cut(strings.TrimSpace(grant), ":")
+		if scoped && room != streamKey {
+			continue
+		}
+		role = strings.ToLower(role)
+		if _, known := roleMatrix[role]; known {
+			held[role] = true
+		}
+	}
+
+	roles := []string{}
+	for _, role := range roleOrder {
+		if held[role] {
+			roles = append(roles, role)
+		}
+	}
+	if len(roles) == 0 {
+		return []string{RoleViewer}
+	}
+	return roles
+}
+
+// Can reports whether a user holding roles has a permission
+func Can(roles []string, permission Permission) bool {
+	for _, role := range roles {
+		if slices.Contains(roleMatrix[role].permissions, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// outranks reports whether a user holding roles may moderate one holding target
+func outranks(roles, target []string) bool {
+	return roleRank(roles) > roleRank(target)
+}
+
+// roleRank returns the rank of the most senior of roles
+func roleRank(roles []string) int {
+	rank := 0
+	for _, role := range roles {
+		rank = max(rank, roleMatrix[role].rank)
+	}
+	return rank
+}
+
+// renderBadges returns the badges shown beside a user: their roles' first, then
+// their profile's. Profile badges that belong to a role the user doesn't hold are
+// dropped, so a badge grant can't pass someone off as a moderator.
+func renderBadges(roles, profileBadges []string) []string {
+	var badges []string
+	for _, role := range roles {
+		if badge := roleMatrix[role].badge; badge != "" {
+			badges = append(badges, badge)
+		}
+	}
+	for _, badge := range profileBadges {
+		if !isRoleBadge(badge) {
+			badges = append(badges, badge)
+		}
+	}
+	return badges
+}
+
+// isRoleBadge reports whether badge is shown for one of the roles
+func isRoleBadge(badge string) bool {
+	for _, spec := range roleMatrix {
+		if spec.badge == badge {
+			return true
+		}
+	}
+	return false
+}
+
+// grantedRoles returns the roles the connection's identity holds in a room
+func (c *Connection) grantedRoles(streamKey string) []string {
+	var grants []string
+	if c.identity != nil {
+		grants = c.identity.Roles
+	}
+	return parseRoles(grants, streamKey)
+}
+
+// rolesIn returns the user's roles in one of the connection's rooms
+func (c *Connection) rolesIn(streamKey string) []string {
+	if streamKey == c.StreamKey && c.roles != nil {
+		return c.roles
+	}
+	return c.grantedRoles(streamKey)
+}
+
+// can reports whether the user's roles in a room give them a permission there
+func (c *Connection) can(streamKey string, permission Permission) bool {
+	return Can(c.rolesIn(streamKey), permission)
+}
+
+// userRoles returns the roles of a user in the room, or viewer for users not in it
+func (cr *ChatRoom) userRoles(userID string) []string {
+	if user, exists := cr.GetUser(userID); exists && len(user.Roles) > 0 {
+		return user.Roles
+	}
+	return []string{RoleViewer}
+}
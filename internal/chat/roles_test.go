@@ -0,0 +1,92 @@
+package chat
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRoles(t *testing.T) {
+	require.Equal(t, []string{RoleViewer}, parseRoles(nil, "room"))
+	require.Equal(t, []string{RoleViewer}, parseRoles([]string{"admin", "moderator:other"}, "room"))
+	require.Equal(t, []string{RoleOwner, RoleVIP}, parseRoles([]string{"VIP", "owner:room"}, "room"))
+
+	require.True(t, Can([]string{RoleModerator}, PermModerate))
+	require.False(t, Can([]string{RoleVIP}, PermModerate))
+	require.True(t, Can([]string{RoleVIP}, PermBypassSlowMode))
+	require.False(t, Can([]string{RoleViewer}, PermBypassSlowMode))
+
+	require.True(t, outranks([]string{RoleOwner}, []string{RoleModerator}))
+	require.False(t, outranks([]string{RoleModerator}, []string{RoleModerator}))
+
+	// Role badges come first, and only from roles
+	require.Equal(t, []string{"moderator", "supporter"}, renderBadges([]string{RoleModerator}, []string{"supporter"}))
+	require.Equal(t, []string{"supporter"}, renderBadges([]string{RoleViewer}, []string{"broadcaster", "supporter"}))
+}
+
+func TestModeration(t *testing.T) {
+	h, server := newTestHandler(t)
+	grants := map[string][]string{
+		"olivia": {"owner:room"},
+		"maria":  {"moderator"},
+		"victor": {"vip"},
+	}
+	h.SetAuthenticator(AuthenticatorFunc(func(_ context.Context, creds Credentials) (*Identity, error) {
+		return &Identity{UserID: creds.Token, Roles: grants[creds.Token]}, nil
+	}))
+
+	join := func(userID string) *websocket.Conn {
+		conn := dialTestClient(t, server, "room&access_token="+userID)
+		joinTestClient(t, conn, userID)
+		return conn
+	}
+	moderate := func(conn *websocket.Conn, data map[string]interface{}) {
+		require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "moderate", "data": data}))
+	}
+
+	owner := join("olivia")
+	mod := join("maria")
+	vip := join("victor")
+	viewer := join("wendy")
+
+	users := h.manager.GetUsers("room")
+	badges := map[string][]string{}
+	for _, user := range users {
+		badges[user.UserID] = user.Badges
+	}
+	require.Equal(t, []string{"broadcaster"}, badges["olivia"])
+	require.Equal(t, []string{"moderator"}, badges["maria"])
+	require.Empty(t, badges["wendy"])
+
+	// Viewers can't moderate, and moderators can't act on their peers or betters
+	moderate(viewer, map[string]interface{}{"action": "clear"})
+	require.Equal(t, CodeNotPermitted, readUntil(t, viewer, "error")["code"])
+	moderate(mod, map[string]interface{}{"action": "timeout", "userId": "olivia", "durationSeconds": 60})
+	require.Equal(t, CodeNotPermitted, readUntil(t, mod, "error")["code"])
+
+	moderate(mod, map[string]interface{}{"action": "timeout", "userId": "wendy", "durationSeconds": 60})
+	event := readUntil(t, owner, "moderation")["data"].(map[string]interface{})
+	require.Equal(t, "timeout", event["action"])
+	require.Equal(t, "wendy", event["userId"])
+	readUntil(t, viewer, "timeout")
+	sendTestMessage(t, viewer, "hello?")
+	require.Equal(t, CodeTimeout, readUntil(t, viewer, "error")["code"])
+
+	moderate(owner, map[string]interface{}{"action": "untimeout", "userId": "wendy"})
+	readUntil(t, viewer, "timeout_ended")
+
+	// Slow mode holds viewers back but not VIPs
+	moderate(mod, map[string]interface{}{"action": "slow_mode", "durationSeconds": 30})
+	readUntil(t, viewer, "room_modes")
+	readUntil(t, vip, "room_modes")
+	for _, text := range []string{"one", "two"} {
+		sendTestMessage(t, vip, text)
+		require.Equal(t, text, readUntil(t, vip, "message")["data"].(map[string]interface{})["message"])
+	}
+	sendTestMessage(t, viewer, "one")
+	readUntil(t, viewer, "message")
+	sendTestMessage(t, viewer, "two")
+	require.Equal(t, CodeSlowMode, readUntil(t, viewer, "error")["code"])
+}
@@ -0,0 +1,150 @@
+package chat
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const maxSlowModeSeconds = 3600
+
+// RoomModes are the moderation modes a room can be switched into
+type RoomModes struct {
+	SlowModeSeconds int  `json:"slowModeSeconds"` // minimum gap between a user's messages, 0 when off
+	ReadOnly        bool `json:"readOnly"`        // only system messages are posted
+	EmoteOnly       bool `json:"emoteOnly"`       // messages may only contain emotes and emoji
+}
+
+// Modes returns the room's current modes
+func (cr *ChatRoom) Modes() RoomModes {
+	cr.modesMux.Lock()
+	defer cr.modesMux.Unlock()
+
+	return cr.modes
+}
+
+// SetModes replaces the room's modes
+func (cr *ChatRoom) SetModes(modes RoomModes) {
+	cr.modesMux.Lock()
+	defer cr.modesMux.Unlock()
+
+	cr.modes = modes
+	if modes.SlowModeSeconds == 0 {
+		cr.lastPost = nil
+	}
+}
+
+// allowPost checks a user's message against moderators' timeouts and, unless the
+// user's roles let them bypass them, the room's modes, recording it for slow mode
+// when it is allowed
+func (cr *ChatRoom) allowPost(userID, message string) error {
+	roles := cr.userRoles(userID)
+
+	cr.modesMux.Lock()
+	defer cr.modesMux.Unlock()
+
+	if until, timedOut := cr.timeouts[userID]; timedOut {
+		if wait := time.Until(until); wait > 0 {
+			return &ChatError{
+				Code:    ErrTimeout.Code,
+				Message: ErrTimeout.Message,
+				Details: &ErrorDetails{RetryAfterSeconds: retryAfter(wait), Tier: TierModerator},
+			}
+		}
+		delete(cr.timeouts, userID)
+	}
+
+	bypassModes := Can(roles, PermBypassRoomModes)
+	if cr.modes.ReadOnly && !bypassModes {
+		return ErrRoomReadOnly
+	}
+
+	if cr.modes.EmoteOnly && !bypassModes && !onlyEmotes(message) {
+		return ErrEmoteOnly
+	}
+
+	if cr.modes.SlowModeSeconds > 0 && !Can(roles, PermBypassSlowMode) {
+		interval := time.Duration(cr.modes.SlowModeSeconds) * time.Second
+		if last, posted := cr.lastPost[userID]; posted {
+			if wait := interval - time.Since(last); wait > 0 {
+				return &ChatError{
+					Code:    ErrSlowMode.Code,
+					Message: fmt.Sprintf("%s Try again in %d seconds.", ErrSlowMode.Message, retryAfter(wait)),
+					Details: &ErrorDetails{RetryAfterSeconds: retryAfter(wait), Limit: 1, Window: cr.modes.SlowModeSeconds, Tier: TierSlowMode},
+				}
+			}
+		}
+
+		if cr.lastPost == nil {
+			cr.lastPost = make(map[string]time.Time)
+		}
+		cr.lastPost[userID] = time.Now()
+	}
+
+	return nil
+}
+
+// onlyEmotes reports whether every word of a message is an emote or emoji
+func onlyEmotes(message string) bool {
+	words := strings.Fields(message)
+	for _, word := range words {
+		if shortcodePattern.MatchString(word) {
+			continue
+		}
+		for _, r := range word {
+			// Modifiers, joiners and variation selectors combine emoji
+			if !unicode.In(r, unicode.So, unicode.Sk, unicode.Mn, unicode.Cf) {
+				return false
+			}
+		}
+	}
+	return len(words) > 0
+}
+
+// Validate reports whether the modes can be applied
+func (rm RoomModes) Validate() error {
+	if rm.SlowModeSeconds < 0 || rm.SlowModeSeconds > maxSlowModeSeconds {
+		return fmt.Errorf("slowModeSeconds must be between 0 and %d", maxSlowModeSeconds)
+	}
+	return nil
+}
+
+// roomState describes a room's modes, limits and features to a joining client
+func (h *WSHandler) roomState(streamKey string) RoomState {
+	config := h.manager.config
+
+	state := RoomState{
+		Limits: RoomLimits{
+			MaxMessageLength:     config.MaxCharactersPerMessage,
+			MaxMessagesPerMinute: config.MaxMessagesPerMinute,
+			RateWindows:          h.rateLimiter.Policy(),
+		},
+		Features: config.Features(),
+	}
+	if room, exists := h.manager.GetRoom(streamKey); exists {
+		state.Modes = room.Modes()
+	}
+	return state
+}
+
+// SetRoomModes changes a room's modes and tells everyone in it
+func (h *WSHandler) SetRoomModes(streamKey string, modes RoomModes) error {
+	if err := modes.Validate(); err != nil {
+		return err
+	}
+
+	room, exists := h.manager.GetRoom(streamKey)
+	if !exists {
+		return ErrRoomNotFound
+	}
+
+	room.SetModes(modes)
+	room.saveState()
+	h.broadcast(streamKey, WSMessage{
+		Type:      "room_modes",
+		Data:      modes,
+		Timestamp: time.Now(),
+	}, "")
+	return nil
+}
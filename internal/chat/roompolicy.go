@@ -0,0 +1,74 @@
+package chat
+
+import (
+	"errors"
+	"net/http"
+)
+
+// RoomPolicy decides whether a session may bring a new chat room into existence.
+// Without a policy, any stream key gets a room on first use.
+type RoomPolicy interface {
+	// CanCreate returns an error to refuse creating the room for streamKey. r is the
+	// HTTP request opening the session, or nil for the IRC and gRPC gateways.
+	CanCreate(streamKey string, r *http.Request) error
+}
+
+// RoomPolicyFunc adapts a function to the RoomPolicy interface
+type RoomPolicyFunc func(streamKey string, r *http.Request) error
+
+// CanCreate calls f(streamKey, r)
+func (f RoomPolicyFunc) CanCreate(streamKey string, r *http.Request) error {
+	return f(streamKey, r)
+}
+
+// SetRoomPolicy installs the policy consulted before rooms are created. Once set,
+// rooms are only created through OpenRoom; joins and messages for rooms that
+// don't exist fail with ErrRoomNotAllowed.
+func (m *Manager) SetRoomPolicy(policy RoomPolicy) {
+	m.hooksMux.Lock()
+	defer m.hooksMux.Unlock()
+
+	m.roomPolicy = policy
+}
+
+// OpenRoom makes sure a room exists for a session that is about to use it,
+// consulting the room policy if the room would have to be created
+func (m *Manager) OpenRoom(streamKey string, r *http.Request) error {
+	m.hooksMux.RLock()
+	policy := m.roomPolicy
+	m.hooksMux.RUnlock()
+
+	if policy == nil || m.hasRoom(streamKey) {
+		return nil
+	}
+
+	if err := policy.CanCreate(streamKey, r); err != nil {
+		return err
+	}
+
+	m.GetOrCreateRoom(streamKey)
+	return nil
+}
+
+// roomForWrite returns the room a join or message goes to, creating it only when no
+// room policy is installed
+func (m *Manager) roomForWrite(streamKey string) (*ChatRoom, error) {
+	m.hooksMux.RLock()
+	restricted := m.roomPolicy != nil
+	m.hooksMux.RUnlock()
+
+	if restricted && !m.hasRoom(streamKey) {
+		return nil, ErrRoomNotAllowed
+	}
+	return m.GetOrCreateRoom(streamKey), nil
+}
+
+// writeOpenRoomError reports a refused room to an HTTP client
+func writeOpenRoomError(w http.ResponseWriter, err error) {
+	var chatErr *ChatError
+	if errors.As(err, &chatErr) {
+		writeChatError(w, http.StatusForbidden, chatErr)
+		return
+	}
+	writeChatError(w, http.StatusForbidden, &ChatError{Code: ErrRoomNotAllowed.Code, Message: err.Error()})
+}
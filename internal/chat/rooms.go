@@ -0,0 +1,162 @@
+package chat
+
+import (
+	"log"
+	"sort"
+	"time"
+)
+
+// inRoom reports whether the connection receives a room's frames: its own room,
+// or one it added with a join_room frame
+func (c *Connection) inRoom(streamKey string) bool {
+	if c.StreamKey == streamKey {
+		return true
+	}
+
+	c.roomsMux.RLock()
+	defer c.roomsMux.RUnlock()
+	return c.rooms[streamKey]
+}
+
+// targetRoom resolves the room a client frame is for: the connection's own room
+// when the frame names none, otherwise one of the rooms it joined
+func (c *Connection) targetRoom(room string) (string, error) {
+	if room == "" {
+		return c.StreamKey, nil
+	}
+	if !c.inRoom(room) {
+		return "", ErrNotInRoom
+	}
+	return room, nil
+}
+
+// addRoom records a joined room, reporting false if the connection was already in it
+func (c *Connection) addRoom(streamKey string) bool {
+	if streamKey == c.StreamKey {
+		return false
+	}
+
+	c.roomsMux.Lock()
+	defer c.roomsMux.Unlock()
+
+	if c.rooms[streamKey] {
+		return false
+	}
+	if c.rooms == nil {
+		c.rooms = make(map[string]bool)
+	}
+	c.rooms[streamKey] = true
+	return true
+}
+
+// removeRoom forgets a room added with join_room, reporting whether the connection was in it
+func (c *Connection) removeRoom(streamKey string) bool {
+	c.roomsMux.Lock()
+	defer c.roomsMux.Unlock()
+
+	if !c.rooms[streamKey] {
+		return false
+	}
+	delete(c.rooms, streamKey)
+	return true
+}
+
+// joinedRooms returns the rooms added with join_room, sorted
+func (c *Connection) joinedRooms() []string {
+	c.roomsMux.RLock()
+	defer c.roomsMux.RUnlock()
+
+	rooms := make([]string, 0, len(c.rooms))
+	for streamKey := range c.rooms {
+		rooms = append(rooms, streamKey)
+	}
+	sort.Strings(rooms)
+	return rooms
+}
+
+// takeRooms forgets every room added with join_room and returns them
+func (c *Connection) takeRooms() []string {
+	c.roomsMux.Lock()
+	defer c.roomsMux.Unlock()
+
+	rooms := make([]string, 0, len(c.rooms))
+	for streamKey := range c.rooms {
+		rooms = append(rooms, streamKey)
+	}
+	c.rooms = nil
+	return rooms
+}
+
+// handleJoinRoom adds another room to a joined connection, as the same user. The
+// client gets the room's state, history and users like after a join, and every
+// frame about the room carries its stream key.
+func (c *Connection) handleJoinRoom(frame *JoinRoomFrame) {
+	if c.UserID == "" {
+		c.sendChatError(ErrNotJoined)
+		return
+	}
+	if !c.addRoom(frame.Room) {
+		return
+	}
+
+	name, first, err := c.manager.manager.joinUser(frame.Room, c.UserID, c.Username, c.rolesIn(frame.Room))
+	if err == nil && name != c.Username {
+		// The connection chats under one name in all its rooms, so it can't be numbered here
+		c.manager.manager.leaveUser(frame.Room, c.UserID)
+		err = ErrUsernameTaken
+	}
+	if err != nil {
+		c.removeRoom(frame.Room)
+		c.sendChatError(err)
+		return
+	}
+
+	c.manager.register(frame.Room, c)
+	c.enterRoom(frame.Room, first)
+}
+
+// handleLeaveRoom leaves a room added with join_room. The connection's own room
+// is left by disconnecting.
+func (c *Connection) handleLeaveRoom(frame *LeaveRoomFrame) {
+	if !c.removeRoom(frame.Room) {
+		c.sendChatError(ErrNotInRoom)
+		return
+	}
+
+	c.leaveRoom(frame.Room)
+	c.sendRoomLeft(frame.Room, nil)
+}
+
+// leaveRoom removes the connection from a room it has already forgotten and, if
+// the user has no other connection there, tells the rest of the room
+func (c *Connection) leaveRoom(streamKey string) {
+	c.manager.unregister(streamKey, c)
+	last := c.manager.manager.leaveUser(streamKey, c.UserID)
+	c.manager.touchViewerCount(streamKey)
+
+	if last {
+		c.manager.broadcast(streamKey, WSMessage{
+			Type:      "user_left",
+			Data:      UserEvent{UserID: c.UserID, Username: c.Username},
+			Timestamp: time.Now(),
+		}, "")
+	}
+
+	log.Printf("User %s (%s) left chat for stream %s", c.Username, c.UserID, streamKey)
+}
+
+// sendRoomLeft confirms the connection no longer receives a room's frames, with
+// the reason if the server removed it
+func (c *Connection) sendRoomLeft(streamKey string, reason *ChatError) {
+	msg := WSMessage{
+		Type:      "room_left",
+		Room:      streamKey,
+		Timestamp: time.Now(),
+	}
+	if reason != nil {
+		msg.Error = reason.Message
+		msg.Code = reason.Code
+	}
+
+	c.send(msg)
+}
@@ -0,0 +1,128 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defaultStatsIntervalSeconds = 5
+	maxStatsIntervalSeconds     = 60
+)
+
+// RoomStatsEvent is the payload of the "room_stats" frames pushed to connections
+// subscribed with a "stats" frame
+type RoomStatsEvent struct {
+	StreamKey         string  `json:"streamKey"`
+	Users             int     `json:"users"`
+	Viewers           int     `json:"viewers"`           // users and read-only subscribers
+	Messages          int64   `json:"messages"`          // since the room opened
+	MessagesPerMinute float64 `json:"messagesPerMinute"` // over the last interval
+	RateLimitHits     int64   `json:"rateLimitHits"`     // messages rejected by the rate limiter in the last interval
+	IntervalSeconds   int     `json:"intervalSeconds"`
+}
+
+// roomCounters are a room's running totals, sampled by stats subscriptions
+type roomCounters struct {
+	messages      int64
+	rateLimitHits int64
+}
+
+// counters returns the room's running totals
+func (cr *ChatRoom) counters() roomCounters {
+	cr.MessagesMux.RLock()
+	defer cr.MessagesMux.RUnlock()
+
+	return roomCounters{messages: cr.MessageCount, rateLimitHits: cr.rateLimitHits.Load()}
+}
+
+// statsSubscription stops a connection's room stats feed
+type statsSubscription struct {
+	stop chan struct{}
+	once sync.Once
+}
+
+// cancel stops the feed; it is safe to call more than once
+func (s *statsSubscription) cancel() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+// roomStats reports a room's activity since the previous sample
+func (h *WSHandler) roomStats(streamKey string, previous roomCounters, interval time.Duration) (RoomStatsEvent, roomCounters) {
+	event := RoomStatsEvent{
+		StreamKey:       streamKey,
+		Users:           h.manager.GetUserCount(streamKey),
+		Viewers:         h.ViewerCount(streamKey),
+		IntervalSeconds: int(interval.Seconds()),
+	}
+
+	room, exists := h.manager.GetRoom(streamKey)
+	if !exists {
+		return event, roomCounters{}
+	}
+
+	current := room.counters()
+	event.Messages = current.messages
+	// Counters restart when a purged room is recreated
+	event.MessagesPerMinute = float64(max(0, current.messages-previous.messages)) / interval.Minutes()
+	event.RateLimitHits = max(0, current.rateLimitHits-previous.rateLimitHits)
+	return event, current
+}
+
+// handleStats starts, restarts with a new interval, or stops the connection's
+// room stats feed. The connection needs the read:stats scope but not a join.
+func (c *Connection) handleStats(frame *StatsFrame) {
+	if !c.statsAllowed {
+		c.sendChatError(ErrForbidden)
+		return
+	}
+
+	c.statsMux.Lock()
+	defer c.statsMux.Unlock()
+
+	if c.stats != nil {
+		c.stats.cancel()
+		c.stats = nil
+	}
+	if !frame.Subscribe {
+		return
+	}
+
+	seconds := frame.IntervalSeconds
+	if seconds == 0 {
+		seconds = defaultStatsIntervalSeconds
+	}
+	// Sample now so the first frame covers exactly its interval
+	var start roomCounters
+	if room, exists := c.manager.manager.GetRoom(c.StreamKey); exists {
+		start = room.counters()
+	}
+
+	c.stats = &statsSubscription{stop: make(chan struct{})}
+	go c.statsWorker(time.Duration(seconds)*time.Second, start, c.stats.stop)
+}
+
+// statsWorker pushes room stats every interval until stopped or the connection closes
+func (c *Connection) statsWorker(interval time.Duration, previous roomCounters, stop <-chan struct{}) {
+	defer trackWorker("ws.roomStats")()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			var event RoomStatsEvent
+			event, previous = c.manager.roomStats(c.StreamKey, previous, interval)
+			c.send(WSMessage{
+				Type:      "room_stats",
+				Data:      event,
+				Timestamp: time.Now(),
+			})
+		case <-stop:
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Routing modes for requests that reach an instance that doesn't own their room
+const (
+	RoutingProxy    = "proxy"    // forward the request, WebSocket upgrades included, to the owner
+	RoutingRedirect = "redirect" // answer 307 with the owner's URL; browsers don't follow redirects for WebSockets
+)
+
+// routedHeader marks a request an instance proxied to the room's owner. The owner
+// serves such requests itself, so instances that disagree on the node list can't
+// bounce a request between them.
+const routedHeader = "X-Chat-Routed"
+
+// ringReplicas is how many points each node gets on the hash ring. More points
+// spread rooms more evenly across nodes.
+const ringReplicas = 128
+
+// hashRing assigns keys to nodes by consistent hashing. Every node is placed at
+// ringReplicas points on a ring of 64-bit hashes, and a key belongs to the node of
+// the first point at or after the key's hash. Adding or removing a node only moves
+// the keys on the arcs that node's points cover.
+type hashRing struct {
+	points []uint64          // sorted
+	owners map[uint64]string // point -> node
+}
+
+// newHashRing places nodes on a ring
+func newHashRing(nodes []string) *hashRing {
+	r := &hashRing{owners: make(map[uint64]string, len(nodes)*ringReplicas)}
+	for _, node := range nodes {
+		for i := 0; i < ringReplicas; i++ {
+			point := ringHash(node + "#" + strconv.Itoa(i))
+			if _, taken := r.owners[point]; taken {
+				continue
+			}
+			r.owners[point] = node
+			r.points = append(r.points, point)
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+	return r
+}
+
+// owner returns the node a key belongs to, or "" if the ring is empty
+func (r *hashRing) owner(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+
+	hash := ringHash(key)
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= hash })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owners[r.points[i]]
+}
+
+// ringHash is 64-bit FNV-1a followed by a finalizer, since FNV alone leaves similar
+// keys like "node#1" and "node#2" clustered on the ring
+func ringHash(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key)) //nolint
+
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+// roomRouter sends requests for a room to the instance that owns it, so each
+// instance only holds its share of the rooms
+type roomRouter struct {
+	self    string
+	mode    string
+	ring    *hashRing
+	proxies map[string]*httputil.ReverseProxy // node -> proxy, in proxy mode
+}
+
+// newRoomRouter creates a router for the cluster of nodes, given as base URLs such
+// as "http://chat-1:8080". self must be one of them.
+func newRoomRouter(self string, nodes []string, mode string) (*roomRouter, error) {
+	if mode != RoutingProxy && mode != RoutingRedirect {
+		return nil, fmt.Errorf("unknown routing mode %q", mode)
+	}
+
+	self = strings.TrimSuffix(self, "/")
+	r := &roomRouter{self: self, mode: mode, proxies: make(map[string]*httputil.ReverseProxy)}
+
+	known := false
+	cleaned := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		node = strings.TrimSuffix(strings.TrimSpace(node), "/")
+		target, err := url.Parse(node)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return nil, fmt.Errorf("cluster node %q is not an http(s) URL", node)
+		}
+		known = known || node == self
+		cleaned = append(cleaned, node)
+
+		if mode == RoutingProxy && node != self {
+			r.proxies[node] = newNodeProxy(self, target)
+		}
+	}
+	if !known {
+		return nil, fmt.Errorf("this instance %q is not one of the cluster nodes", self)
+	}
+
+	r.ring = newHashRing(cleaned)
+	return r, nil
+}
+
+// newNodeProxy forwards requests to another node. The forwarding instance already
+// answered with its own CORS headers, so the owner's are dropped.
+func newNodeProxy(self string, target *url.URL) *httputil.ReverseProxy {
+	return &httputil.ReverseProxy{
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.SetURL(target)
+			pr.SetXForwarded()
+			pr.Out.Header.Set(routedHeader, self)
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			for name := range resp.Header {
+				if strings.HasPrefix(name, "Access-Control-") {
+					resp.Header.Del(name)
+				}
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("Failed to route chat request to %s: %v", target, err)
+			w.WriteHeader(http.StatusBadGateway)
+		},
+	}
+}
+
+// owner returns the node that owns the room
+func (r *roomRouter) owner(streamKey string) string {
+	return r.ring.owner(streamKey)
+}
+
+// forward hands a request for a room owned by node over to it
+func (r *roomRouter) forward(w http.ResponseWriter, req *http.Request, node string) {
+	if r.mode == RoutingRedirect {
+		http.Redirect(w, req, node+req.URL.RequestURI(), http.StatusTemporaryRedirect)
+		return
+	}
+	r.proxies[node].ServeHTTP(w, req)
+}
+
+// RoomOwner returns the base URL of the instance that owns the room, or "" when
+// cluster routing is off
+func (h *WSHandler) RoomOwner(streamKey string) string {
+	if h.router == nil {
+		return ""
+	}
+	return h.router.owner(streamKey)
+}
+
+// OwnedRooms narrows a warm-up source to the rooms this instance owns, so each
+// instance only pre-creates its share
+func (h *WSHandler) OwnedRooms(source WarmupSource) WarmupSource {
+	if h.router == nil {
+		return source
+	}
+
+	return func(ctx context.Context) ([]string, error) {
+		streamKeys, err := source(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		owned := streamKeys[:0]
+		for _, streamKey := range streamKeys {
+			if h.router.owner(streamKey) == h.router.self {
+				owned = append(owned, streamKey)
+			}
+		}
+		return owned, nil
+	}
+}
+
+// RouteRoom wraps a handler for a room's endpoints so requests reaching the wrong
+// instance are proxied or redirected to the room's owner. The stream key is taken
+// from the {streamKey} path value or the streamKey query parameter. Without a
+// cluster configured, every request is served locally.
+//
+// Proxied connections reach the owner from the forwarding instance, so per-address
+// checks such as scraper detection see that instance's address.
+func (h *WSHandler) RouteRoom(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.router == nil || r.Header.Get(routedHeader) != "" {
+			next(w, r)
+			return
+		}
+
+		streamKey := r.PathValue("streamKey")
+		if streamKey == "" {
+			streamKey = r.URL.Query().Get("streamKey")
+		}
+
+		if owner := h.router.owner(streamKey); streamKey != "" && owner != h.router.self {
+			h.router.forward(w, r, owner)
+			return
+		}
+		next(w, r)
+	}
+}
@@ -0,0 +1,138 @@
+package chat
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashRingSpreadsAndKeepsKeys(t *testing.T) {
+	nodes := []string{"http://chat-1:8080", "http://chat-2:8080", "http://chat-3:8080"}
+	ring := newHashRing(nodes)
+
+	counts := map[string]int{}
+	before := map[string]string{}
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("stream-%d", i)
+		before[key] = ring.owner(key)
+		counts[before[key]]++
+	}
+	for _, node := range nodes {
+		require.InDelta(t, 1000, counts[node], 250, "rooms on %s", node)
+	}
+
+	// A fourth node only takes rooms over; no room moves between the original nodes
+	grown := newHashRing(append(nodes, "http://chat-4:8080"))
+	moved := 0
+	for key, owner := range before {
+		if now := grown.owner(key); now != owner {
+			require.Equal(t, "http://chat-4:8080", now)
+			moved++
+		}
+	}
+	require.InDelta(t, 750, moved, 250)
+}
+
+// newClusterNodes starts n chat instances routing rooms between themselves
+func newClusterNodes(t *testing.T, n int, mode string) ([]*WSHandler, []*httptest.Server) {
+	servers := make([]*httptest.Server, n)
+	urls := make([]string, n)
+	for i := range servers {
+		servers[i] = httptest.NewUnstartedServer(nil)
+		urls[i] = "http://" + servers[i].Listener.Addr().String()
+	}
+
+	handlers := make([]*WSHandler, n)
+	for i, server := range servers {
+		config := DefaultConfig()
+		config.ClusterNodes = urls
+		config.ClusterSelf = urls[i]
+		config.ClusterRouting = mode
+		manager := NewManager(config)
+		t.Cleanup(manager.Stop)
+		h := NewWSHandler(manager, NewRateLimiter(config))
+		require.NotNil(t, h.router)
+
+		mux := http.NewServeMux()
+		mux.HandleFunc("/api/chat", h.RouteRoom(h.HTTPHandler))
+		mux.HandleFunc("/api/chat/{streamKey}/messages", h.RouteRoom(h.MessagesHandler))
+		server.Config.Handler = mux
+		server.Start()
+		t.Cleanup(server.Close)
+		handlers[i] = h
+	}
+	return handlers, servers
+}
+
+// roomOwnedBy returns a stream key the router assigns to node
+func roomOwnedBy(h *WSHandler, node string) string {
+	for i := 0; ; i++ {
+		if streamKey := fmt.Sprintf("room-%d", i); h.RoomOwner(streamKey) == node {
+			return streamKey
+		}
+	}
+}
+
+func TestRouteRoomProxiesToOwner(t *testing.T) {
+	handlers, servers := newClusterNodes(t, 2, RoutingProxy)
+	streamKey := roomOwnedBy(handlers[0], servers[1].URL)
+
+	// A WebSocket opened on the first instance ends up in the second's room
+	conn := dialTestClient(t, servers[0], streamKey)
+	joinTestClient(t, conn, "alice")
+
+	require.Len(t, handlers[1].roomConnections(streamKey), 1)
+	require.False(t, handlers[0].manager.hasRoom(streamKey))
+	require.True(t, handlers[1].manager.hasRoom(streamKey))
+}
+
+func TestRouteRoomRedirectsToOwner(t *testing.T) {
+	handlers, servers := newClusterNodes(t, 2, RoutingRedirect)
+	streamKey := roomOwnedBy(handlers[0], servers[1].URL)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(servers[0].URL + "/api/chat/" + streamKey + "/messages?limit=5")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTemporaryRedirect, resp.StatusCode)
+	require.Equal(t, servers[1].URL+"/api/chat/"+streamKey+"/messages?limit=5", resp.Header.Get("Location"))
+
+	// The owner serves its own rooms
+	resp, err = client.Get(servers[1].URL + "/api/chat/" + streamKey + "/messages")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestRouteRoomWithoutClusterServesLocally(t *testing.T) {
+	h, server := newTestHandler(t)
+	require.Nil(t, h.router)
+	require.Empty(t, h.RoomOwner("room"))
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?streamKey=room"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestNewRoomRouterValidatesNodes(t *testing.T) {
+	_, err := newRoomRouter("http://a:8080", []string{"http://b:8080"}, RoutingProxy)
+	require.Error(t, err)
+
+	_, err = newRoomRouter("http://a:8080", []string{"a:8080"}, RoutingProxy)
+	require.Error(t, err)
+
+	_, err = newRoomRouter("http://a:8080", []string{"http://a:8080"}, "teleport")
+	require.Error(t, err)
+
+	router, err := newRoomRouter("http://a:8080/", []string{"http://a:8080/", " http://b:8080"}, RoutingProxy)
+	require.NoError(t, err)
+	require.Contains(t, router.proxies, "http://b:8080")
+}
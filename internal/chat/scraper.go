@@ -0,0 +1,175 @@
+package chat
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ReadTracker detects identities that harvest history across many rooms without
+// ever participating, and throttles their history reads
+type ReadTracker struct {
+	maxRooms int
+	window   time.Duration
+	records  map[string]*readRecord
+	mutex    sync.Mutex
+}
+
+// readRecord tracks history reads and writes for a single identity
+type readRecord struct {
+	reads          map[string]time.Time // streamKey -> last history read
+	lastWrite      time.Time
+	throttledUntil time.Time
+}
+
+// NewReadTracker creates a new read tracker. A maxRooms of 0 disables throttling.
+func NewReadTracker(maxRooms int, window time.Duration) *ReadTracker {
+	rt := &ReadTracker{
+		maxRooms: maxRooms,
+		window:   window,
+		records:  make(map[string]*readRecord),
+	}
+
+	if maxRooms > 0 {
+		go rt.cleanupWorker()
+	}
+
+	return rt
+}
+
+// AllowRead records a history read for the given identities and reports whether it is allowed.
+// A read is refused once any identity has read more than maxRooms distinct rooms within the
+// window without sending a single message.
+func (rt *ReadTracker) AllowRead(streamKey string, identities ...string) bool {
+	if rt.maxRooms <= 0 {
+		return true
+	}
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	now := time.Now()
+	allowed := true
+
+	for _, identity := range identities {
+		if identity == "" {
+			continue
+		}
+
+		record := rt.getOrCreateRecord(identity)
+		if now.Before(record.throttledUntil) {
+			allowed = false
+			continue
+		}
+
+		record.prune(now.Add(-rt.window))
+		record.reads[streamKey] = now
+
+		if len(record.reads) > rt.maxRooms && now.Sub(record.lastWrite) > rt.window {
+			record.throttledUntil = now.Add(rt.window)
+			allowed = false
+			log.Printf("Throttling history reads for %s: %d rooms read without participating", identity, len(record.reads))
+		}
+	}
+
+	return allowed
+}
+
+// throttledError describes a refused read: how long until the longest throttle
+// among the identities lifts
+func (rt *ReadTracker) throttledError(identities ...string) *ChatError {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, identity := range identities {
+		if record, exists := rt.records[identity]; exists {
+			wait = max(wait, record.throttledUntil.Sub(now))
+		}
+	}
+
+	return ErrHistoryThrottled.withDetails(ErrorDetails{
+		RetryAfterSeconds: retryAfter(wait),
+		Limit:             rt.maxRooms,
+		Window:            int(rt.window.Seconds()),
+		Tier:              TierHistoryReads,
+	})
+}
+
+// RecordWrite marks identities as participating, which exempts them from throttling
+func (rt *ReadTracker) RecordWrite(identities ...string) {
+	if rt.maxRooms <= 0 {
+		return
+	}
+
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	now := time.Now()
+	for _, identity := range identities {
+		if identity == "" {
+			continue
+		}
+		rt.getOrCreateRecord(identity).lastWrite = now
+	}
+}
+
+// getOrCreateRecord gets or creates the record for an identity
+func (rt *ReadTracker) getOrCreateRecord(identity string) *readRecord {
+	if record, exists := rt.records[identity]; exists {
+		return record
+	}
+
+	record := &readRecord{reads: make(map[string]time.Time)}
+	rt.records[identity] = record
+	return record
+}
+
+// prune removes reads older than the cutoff
+func (r *readRecord) prune(cutoff time.Time) {
+	for streamKey, readAt := range r.reads {
+		if readAt.Before(cutoff) {
+			delete(r.reads, streamKey)
+		}
+	}
+}
+
+// cleanupWorker periodically removes idle records
+func (rt *ReadTracker) cleanupWorker() {
+	defer trackWorker("scraper.cleanup")()
+
+	ticker := time.NewTicker(5 * time.Minute)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rt.performCleanup()
+	}
+}
+
+// performCleanup removes records with no recent activity
+func (rt *ReadTracker) performCleanup() {
+	rt.mutex.Lock()
+	defer rt.mutex.Unlock()
+
+	now := time.Now()
+	cutoff := now.Add(-rt.window)
+
+	for identity, record := range rt.records {
+		record.prune(cutoff)
+		if len(record.reads) == 0 && now.After(record.throttledUntil) && record.lastWrite.Before(cutoff) {
+			delete(rt.records, identity)
+		}
+	}
+}
+
+// remoteIP returns the IP address of the client that made the request
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
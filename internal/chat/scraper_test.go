@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTrackerThrottlesLurkers(t *testing.T) {
+	rt := NewReadTracker(2, time.Minute)
+
+	require.True(t, rt.AllowRead("a", "ip:1"))
+	require.True(t, rt.AllowRead("b", "ip:1"))
+	require.False(t, rt.AllowRead("c", "ip:1"))
+
+	// Once throttled, even previously read rooms are refused
+	require.False(t, rt.AllowRead("a", "ip:1"))
+	require.True(t, rt.AllowRead("a", "ip:2"))
+}
+
+func TestReadTrackerExemptsParticipants(t *testing.T) {
+	rt := NewReadTracker(2, time.Minute)
+
+	rt.RecordWrite("user:chatty")
+	for _, room := range []string{"a", "b", "c", "d"} {
+		require.True(t, rt.AllowRead(room, "user:chatty"))
+	}
+}
+
+func TestRefusedMessagesDontExemptReaders(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.readTracker = NewReadTracker(2, time.Minute)
+	wrote := func() bool {
+		h.readTracker.mutex.Lock()
+		defer h.readTracker.mutex.Unlock()
+		record, exists := h.readTracker.records["user:alice"]
+		return exists && !record.lastWrite.IsZero()
+	}
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+	room, _ := h.manager.GetRoom("room")
+	room.SetModes(RoomModes{ReadOnly: true})
+
+	sendTestMessage(t, alice, "anyone?")
+	readUntil(t, alice, "error")
+	require.False(t, wrote())
+
+	room.SetModes(RoomModes{})
+	sendTestMessage(t, alice, "hello")
+	readUntil(t, alice, "message")
+	require.True(t, wrote())
+}
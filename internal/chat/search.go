@@ -0,0 +1,123 @@
+package chat
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SearchQuery filters a room's messages. Zero fields match everything.
+type SearchQuery struct {
+	Text  string    // case-insensitive substring of the message
+	User  string    // user ID or username, case-insensitive
+	From  time.Time // inclusive
+	To    time.Time // inclusive
+	Limit int       // most recent matches to return
+}
+
+// Matches reports whether a message satisfies the query
+func (q SearchQuery) Matches(msg ChatMessage) bool {
+	if q.User != "" && !strings.EqualFold(msg.UserID, q.User) && !strings.EqualFold(msg.Username, q.User) {
+		return false
+	}
+	if !q.From.IsZero() && msg.Timestamp.Before(q.From) {
+		return false
+	}
+	if !q.To.IsZero() && msg.Timestamp.After(q.To) {
+		return false
+	}
+	if q.Text != "" && !strings.Contains(strings.ToLower(msg.Message), strings.ToLower(q.Text)) {
+		return false
+	}
+	return true
+}
+
+// MessageSearcher is implemented by message stores that can search a room's whole
+// stored history rather than just what is buffered
+type MessageSearcher interface {
+	// Search returns the most recent stored messages of a room matching the query,
+	// oldest first, and whether older matches were left out
+	Search(streamKey string, query SearchQuery) ([]ChatMessage, bool, error)
+}
+
+// SearchMessages returns the most recent messages of a room matching the query,
+// oldest first, and whether older matches were left out. The message store is
+// searched when it supports it, and the room's buffer otherwise.
+func (m *Manager) SearchMessages(streamKey string, query SearchQuery) ([]ChatMessage, bool) {
+	if searcher, ok := m.persistence().(MessageSearcher); ok {
+		messages, hasMore, err := searcher.Search(streamKey, query)
+		if err == nil {
+			return messages, hasMore
+		}
+		log.Printf("Falling back to buffered chat search for %s: %v", streamKey, err)
+	}
+
+	room, exists := m.GetRoom(streamKey)
+	if !exists {
+		return []ChatMessage{}, false
+	}
+
+	matches := []ChatMessage{}
+	for _, msg := range room.GetMessages(0) {
+		if query.Matches(msg) {
+			matches = append(matches, msg)
+		}
+	}
+
+	if query.Limit > 0 && len(matches) > query.Limit {
+		return matches[len(matches)-query.Limit:], true
+	}
+	return matches, false
+}
+
+// SearchHandler serves GET /api/chat/{streamKey}/search?q=&user=&from=&to=&limit=N
+// for moderators investigating incidents. from and to are RFC 3339 timestamps.
+func (h *WSHandler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey", http.StatusBadRequest)
+		return
+	}
+
+	params := r.URL.Query()
+	query := SearchQuery{
+		Text:  params.Get("q"),
+		User:  params.Get("user"),
+		Limit: defaultPageSize,
+	}
+
+	if val := params.Get("limit"); val != "" {
+		parsed, err := strconv.Atoi(val)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		query.Limit = min(parsed, maxPageSize)
+	}
+
+	for name, target := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		val := params.Get(name)
+		if val == "" {
+			continue
+		}
+		parsed, err := time.Parse(time.RFC3339, val)
+		if err != nil {
+			http.Error(w, "Invalid "+name+" timestamp", http.StatusBadRequest)
+			return
+		}
+		*target = parsed
+	}
+
+	messages, hasMore := h.manager.SearchMessages(streamKey, query)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"messages": messages,
+		"hasMore":  hasMore,
+	})
+}
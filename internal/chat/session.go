@@ -0,0 +1,635 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Transport carries frames between a Connection and its client
+type Transport interface {
+	// Close terminates the client connection, giving the reason where the transport supports one
+	Close(reason string) error
+}
+
+// Connection is a client session in a chat room, independent of the transport carrying it
+type Connection struct {
+	UserID     string
+	Username   string
+	StreamKey  string
+	RemoteAddr string
+	Transport  Transport
+	Send       chan WSMessage
+	manager    *WSHandler
+
+	writes         *writePool  // writes Send for transports on the write pool; nil if the transport has its own writer
+	writeScheduled atomic.Bool // the connection is queued on, or being written by, the write pool
+
+	droppedFrames atomic.Int64 // broadcasts dropped because Send was full, since the client last caught up
+	slowWarned    atomic.Bool  // the client was told it is falling behind
+
+	pressureSamples int          // consecutive samples on the far side of the backpressure watermark; owned by backpressureMonitor
+	digest          digestBuffer // chat messages held for the next digest while the client is in digest mode
+
+	done        chan struct{}
+	closeOnce   sync.Once
+	cleanupOnce sync.Once
+	joinedAs    atomic.Value // UserID, safe to read from the transport's write goroutine and the room's hub
+
+	reservations messageReservations // message IDs reserved for two-phase submits
+
+	protocolVersion atomic.Int32 // negotiated through the client's hello
+
+	statsAllowed bool        // the client presented the read:stats scope when connecting
+	credentials  Credentials // presented when connecting, for the authenticator at join
+	identity     *Identity   // who the authenticator says the client is; nil without one
+	stats        *statsSubscription
+	statsMux     sync.Mutex
+
+	rooms    map[string]bool // rooms joined with join_room, besides StreamKey
+	roomsMux sync.RWMutex
+
+	lazyHistory bool // set on join: the client pages history in rather than getting it on entering rooms
+
+	guest     bool   // joined as a guest; UserID stays empty until the guest chats
+	guestName string // generated for a guest, to chat under
+
+	roles []string // the user's roles in StreamKey, most senior first; set on join
+}
+
+// newConnection creates a session for a client of the given room and queues the server hello
+func newConnection(h *WSHandler, streamKey, remoteAddr string, transport Transport) *Connection {
+	c := &Connection{
+		StreamKey:  streamKey,
+		RemoteAddr: remoteAddr,
+		Transport:  transport,
+		Send:       make(chan WSMessage, h.manager.config.SendQueueSize),
+		manager:    h,
+		done:       make(chan struct{}),
+	}
+	c.protocolVersion.Store(1)
+
+	c.Send <- h.helloFrame()
+	return c
+}
+
+// send queues a frame for the client, giving up if the connection closes first
+func (c *Connection) send(msg WSMessage) {
+	select {
+	case c.Send <- msg:
+		c.wake()
+	case <-c.done:
+	}
+}
+
+// Done returns a channel that is closed once the connection has closed
+func (c *Connection) Done() <-chan struct{} {
+	return c.done
+}
+
+// Close closes the connection's transport. Call cleanup to also leave the room.
+func (c *Connection) Close(reason string) {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		if err := c.Transport.Close(reason); err != nil {
+			log.Printf("Failed to close chat connection: %v", err)
+		}
+	})
+}
+
+// handleMessage handles incoming messages from the client
+func (c *Connection) handleMessage(msg map[string]interface{}) {
+	frame, err := DecodeInbound(msg)
+	if err != nil {
+		if msg["type"] == "message" {
+			c.trace(TraceReceived, "rejected: "+err.Error())
+		}
+		c.sendChatError(err)
+		return
+	}
+
+	c.dispatch(frame)
+}
+
+// handleFrame validates and handles a frame built directly by a gateway
+func (c *Connection) handleFrame(frame InboundFrame) {
+	if err := validateInbound(frame); err != nil {
+		c.sendChatError(err)
+		return
+	}
+
+	c.dispatch(frame)
+}
+
+// dispatch routes a decoded, valid frame to its handler
+func (c *Connection) dispatch(frame InboundFrame) {
+	switch f := frame.(type) {
+	case *HelloFrame:
+		c.handleHello(f)
+	case *JoinFrame:
+		c.handleJoin(f)
+	case *ChatFrame:
+		c.handleChatMessage(f)
+	case *TypingFrame:
+		c.handleTyping(f)
+	case *PingFrame:
+		c.handlePing(f)
+	case *ReserveFrame:
+		c.handleReserve()
+	case *StatsFrame:
+		c.handleStats(f)
+	case *AckFrame:
+		c.handleAck(f)
+	case *JoinRoomFrame:
+		c.handleJoinRoom(f)
+	case *LeaveRoomFrame:
+		c.handleLeaveRoom(f)
+	case *HistoryRequestFrame:
+		c.handleHistoryRequest(f)
+	case *SetProfileFrame:
+		c.handleSetProfile(f)
+	case *ModerateFrame:
+		c.handleModerate(f)
+	}
+}
+
+// handleJoin handles a user joining the chat
+func (c *Connection) handleJoin(frame *JoinFrame) {
+	if frame.Guest {
+		c.joinGuest(frame)
+		return
+	}
+	if c.guest || c.UserID != "" {
+		// A connection is one user for its lifetime; switching users means reconnecting
+		c.sendChatError(ErrAlreadyJoined)
+		return
+	}
+
+	userID, username := frame.UserID, frame.Username
+
+	if c.identity == nil {
+		identity, err := c.manager.resolveIdentity(c.credentials)
+		if err != nil {
+			c.sendChatError(err)
+			return
+		}
+		c.identity = identity
+	}
+	if c.identity != nil {
+		// The authenticator, not the frame, says who the client is
+		if userID != c.identity.UserID {
+			c.sendChatError(ErrIdentityMismatch)
+			return
+		}
+		if c.identity.Username != "" {
+			username = c.identity.Username
+		}
+	}
+	if !c.manager.reservedNames.Allows(username, c.identity) {
+		c.sendChatError(ErrUsernameReserved)
+		return
+	}
+
+	c.roles = c.grantedRoles(c.StreamKey)
+
+	// Add user to manager
+	name, first, err := c.manager.manager.joinUser(c.StreamKey, userID, username, c.roles)
+	if err != nil {
+		c.sendChatError(err)
+		return
+	}
+
+	c.UserID = userID
+	c.Username = name
+	c.lazyHistory = frame.LazyHistory
+	c.joinedAs.Store(userID)
+
+	// Register connection
+	c.manager.register(c.StreamKey, c)
+
+	if name != username {
+		// Someone in the room already goes by a name like it
+		c.send(WSMessage{Type: "username_assigned", Data: UserEvent{UserID: userID, Username: name}, Timestamp: time.Now()})
+	}
+
+	c.enterRoom(c.StreamKey, first)
+
+	// Give the client the profile it keeps across reconnects
+	if profile := c.manager.manager.profileFor(userID); !profile.empty() {
+		c.send(WSMessage{Type: "profile", Data: profile, Timestamp: time.Now()})
+	}
+
+	// Check if user is timed out
+	isTimedOut, duration := c.manager.rateLimiter.GetTimeoutStatus(userID)
+	if isTimedOut {
+		c.send(WSMessage{
+			Type:      "timeout",
+			Data:      TimeoutEvent{Duration: duration.Seconds()},
+			Timestamp: time.Now(),
+		})
+	}
+}
+
+// notifyTimeoutEnded tells a user's connections that their timeout is over
+func (h *WSHandler) notifyTimeoutEnded(userID string) {
+	h.eachConnection(func(conn *Connection) {
+		if conn.UserID == userID {
+			conn.deliver(WSMessage{Type: "timeout_ended", Timestamp: time.Now()})
+		}
+	})
+}
+
+// enterRoom sends a newly joined room's state, history and users, and announces
+// the user to the rest of the room if this is their first connection there
+func (c *Connection) enterRoom(streamKey string, first bool) {
+	c.manager.touchViewerCount(streamKey)
+
+	// Tell the client what the room allows
+	c.send(WSMessage{
+		Type:      "room_state",
+		Data:      c.manager.roomState(streamKey),
+		Room:      streamKey,
+		Timestamp: time.Now(),
+	})
+	if c.manager.loadThrottle.Active() {
+		c.send(WSMessage{
+			Type:      "system",
+			Data:      SystemEvent{Message: loadThrottleOnNotice},
+			Room:      streamKey,
+			Timestamp: time.Now(),
+		})
+	}
+
+	// Send recent history unless the client pages it in, withholding it from
+	// identities harvesting many rooms
+	if !c.lazyHistory {
+		messages := []ChatMessage{}
+		if size := c.manager.manager.config.JoinHistorySize; size <= 0 {
+			// Clients page in all of it
+		} else if c.manager.readTracker.AllowRead(streamKey, c.identities()...) {
+			messages = c.manager.manager.GetMessages(streamKey, size)
+		} else {
+			c.sendChatError(c.manager.readTracker.throttledError(c.identities()...))
+		}
+
+		c.send(WSMessage{
+			Type:      "history",
+			Data:      messages,
+			Room:      streamKey,
+			Timestamp: time.Now(),
+		})
+	}
+
+	// Send user list
+	users := c.manager.manager.GetUsers(streamKey)
+	c.send(WSMessage{
+		Type:      "users",
+		Data:      users,
+		Room:      streamKey,
+		Timestamp: time.Now(),
+	})
+
+	if first {
+		c.announceJoin(streamKey)
+	}
+
+	if c.guest {
+		log.Printf("Guest %s joined chat for stream %s", c.guestName, streamKey)
+	} else {
+		log.Printf("User %s (%s) joined chat for stream %s", c.Username, c.UserID, streamKey)
+	}
+}
+
+// announceJoin tells a room the user has arrived
+func (c *Connection) announceJoin(streamKey string) {
+	event := UserEvent{UserID: c.UserID, Username: c.Username}
+	if room, exists := c.manager.manager.GetRoom(streamKey); exists {
+		if user, exists := room.GetUser(c.UserID); exists {
+			event.Color, event.Badges = user.Color, user.Badges
+		}
+	}
+	c.manager.broadcast(streamKey, WSMessage{
+		Type:      "user_joined",
+		Data:      event,
+		Timestamp: time.Now(),
+	}, "")
+}
+
+// handleChatMessage handles a chat message from the user
+func (c *Connection) handleChatMessage(frame *ChatFrame) {
+	if c.UserID == "" && c.guest {
+		if err := c.joinAsGuest(); err != nil {
+			c.sendChatError(err)
+			return
+		}
+	}
+	if c.UserID == "" {
+		c.sendChatError(ErrNotJoined)
+		return
+	}
+
+	streamKey, err := c.targetRoom(frame.Room)
+	if err != nil {
+		c.sendChatError(err)
+		return
+	}
+
+	message := frame.Message
+	c.trace(TraceReceived, fmt.Sprintf("%d characters", len(message)))
+
+	// A reserved ID is spent on this attempt whether or not the message is accepted
+	if frame.ID != "" && !c.reservations.take(frame.ID) {
+		c.sendChatError(ErrReservationNotFound)
+		return
+	}
+
+	// While the instance is overloaded everyone is held to slow mode
+	if throttleErr := c.manager.loadThrottle.allow(c.UserID); throttleErr != nil {
+		c.trace(TraceRateCheck, "denied: "+throttleErr.Message)
+		c.sendChatError(throttleErr)
+		return
+	}
+
+	// Check rate limit, which the user's roles may let them skip
+	wasTimedOut, _ := c.manager.rateLimiter.GetTimeoutStatus(c.UserID)
+	allowed := true
+	var rateLimitErr *ChatError
+	if !c.can(streamKey, PermBypassRateLimit) {
+		allowed, rateLimitErr = c.manager.rateLimiter.CheckMessage(c.UserID, message)
+	}
+	if !allowed {
+		if isTimedOut, duration := c.manager.rateLimiter.GetTimeoutStatus(c.UserID); isTimedOut && !wasTimedOut {
+			c.manager.publishEvent(WebhookEventUserTimeout, streamKey, map[string]interface{}{
+				"userId":   c.UserID,
+				"username": c.Username,
+				"duration": duration.Seconds(),
+				"reason":   rateLimitErr.Message,
+			})
+		}
+
+		if room, exists := c.manager.manager.GetRoom(streamKey); exists {
+			room.rateLimitHits.Add(1)
+		}
+
+		c.trace(TraceRateCheck, "denied: "+rateLimitErr.Message)
+		c.send(WSMessage{
+			Type:      "rate_limit",
+			Error:     rateLimitErr.Message,
+			Code:      rateLimitErr.Code,
+			Details:   rateLimitErr.Details,
+			Room:      streamKey,
+			Timestamp: time.Now(),
+		})
+		return
+	}
+	c.trace(TraceRateCheck, "allowed")
+
+	chatMsg := newChatMessage(streamKey, c.UserID, c.Username, message)
+	if frame.ID != "" {
+		chatMsg.ID = frame.ID
+	}
+
+	// Check automod filter
+	var filterErr *ChatError
+	if !c.can(streamKey, PermBypassAutoMod) {
+		filterErr = c.manager.autoMod.Check(message)
+	}
+	if filterErr != nil {
+		c.manager.publishEvent(WebhookEventMessageBlocked, streamKey, map[string]interface{}{
+			"userId":   c.UserID,
+			"username": c.Username,
+			"message":  message,
+		})
+
+		if c.manager.autoMod.SilentDrop() {
+			c.trace(TraceFilter, "blocked, echoed to sender only")
+
+			// Echo back to the sender only so the filter doesn't reveal itself
+			c.send(WSMessage{
+				Type:      "message",
+				Data:      chatMsg,
+				Room:      streamKey,
+				Timestamp: time.Now(),
+			})
+			return
+		}
+
+		c.trace(TraceFilter, "blocked: "+filterErr.Message)
+		c.sendChatError(filterErr)
+		return
+	}
+	c.trace(TraceFilter, "passed")
+
+	// Add message to manager
+	if err := c.manager.manager.addMessage(chatMsg); err != nil {
+		c.trace(TraceStore, "failed: "+err.Error())
+		c.sendChatError(err)
+		return
+	}
+	c.trace(TraceStore, "stored as "+chatMsg.ID)
+
+	// Only messages chat accepted count as taking part
+	c.manager.readTracker.RecordWrite(c.identities()...)
+
+	// Broadcast to all users in the room
+	c.manager.broadcastReporting(streamKey, WSMessage{
+		Type:      "message",
+		Data:      chatMsg,
+		Timestamp: time.Now(),
+	}, "", func(queued, dropped int) {
+		c.trace(TraceBroadcast, fmt.Sprintf("queued for %d connections, skipped %d with full queues", queued, dropped))
+	})
+}
+
+// handleTyping handles typing indicator
+func (c *Connection) handleTyping(frame *TypingFrame) {
+	if c.UserID == "" {
+		return
+	}
+	streamKey, err := c.targetRoom(frame.Room)
+	if err != nil {
+		return
+	}
+
+	isTyping := frame.IsTyping
+
+	// Broadcast typing status to room (excluding sender)
+	c.manager.broadcast(streamKey, WSMessage{
+		Type: "typing",
+		Data: TypingEvent{
+			UserID:   c.UserID,
+			Username: c.Username,
+			IsTyping: isTyping,
+		},
+		Timestamp: time.Now(),
+	}, c.UserID)
+}
+
+// handlePing answers a ping with the client's timestamp and the server's clock.
+// Anyone connected may ping, joined or not.
+func (c *Connection) handlePing(frame *PingFrame) {
+	c.send(WSMessage{
+		Type: "pong",
+		Data: PongEvent{
+			ClientTime: frame.ClientTime,
+			ServerTime: time.Now().UnixMilli(),
+		},
+		Timestamp: time.Now(),
+	})
+}
+
+// handleAck resends the messages a joined client reports missing from a room
+func (c *Connection) handleAck(frame *AckFrame) {
+	if c.UserID == "" {
+		c.sendChatError(ErrNotJoined)
+		return
+	}
+	streamKey, err := c.targetRoom(frame.Room)
+	if err != nil {
+		c.sendChatError(err)
+		return
+	}
+
+	if !c.manager.readTracker.AllowRead(streamKey, c.identities()...) {
+		c.sendChatError(c.manager.readTracker.throttledError(c.identities()...))
+		return
+	}
+
+	messages, complete := c.manager.manager.GetMessagesAfter(streamKey, frame.Seq, maxPageSize)
+	c.send(WSMessage{
+		Type:      "missed",
+		Data:      MissedEvent{Messages: messages, Complete: complete},
+		Room:      streamKey,
+		Timestamp: time.Now(),
+	})
+}
+
+// handleHistoryRequest sends a page of a joined room's history
+func (c *Connection) handleHistoryRequest(frame *HistoryRequestFrame) {
+	if c.UserID == "" {
+		c.sendChatError(ErrNotJoined)
+		return
+	}
+	streamKey, err := c.targetRoom(frame.Room)
+	if err != nil {
+		c.sendChatError(err)
+		return
+	}
+	if !c.manager.readTracker.AllowRead(streamKey, c.identities()...) {
+		c.sendChatError(c.manager.readTracker.throttledError(c.identities()...))
+		return
+	}
+
+	limit := defaultPageSize
+	if frame.Limit > 0 {
+		limit = min(frame.Limit, maxPageSize)
+	}
+
+	messages, hasMore, err := c.manager.manager.GetMessagesBefore(streamKey, frame.Before, limit)
+	if err != nil {
+		c.sendChatError(err)
+		return
+	}
+
+	c.send(WSMessage{
+		Type:      "history_page",
+		Data:      HistoryPageEvent{Messages: messages, HasMore: hasMore},
+		Room:      streamKey,
+		Timestamp: time.Now(),
+	})
+}
+
+// broadcastToRoom broadcasts a message to all users in the room
+func (c *Connection) broadcastToRoom(msg WSMessage) {
+	c.manager.broadcast(c.StreamKey, msg, "")
+}
+
+// identities returns the keys used to track this connection's read patterns
+func (c *Connection) identities() []string {
+	return []string{"ip:" + c.RemoteAddr, "user:" + c.UserID}
+}
+
+// trace records a step of this user's message journey when they are being traced
+func (c *Connection) trace(stage, detail string) {
+	c.manager.tracer.Record(c.UserID, c.StreamKey, stage, detail)
+}
+
+// traceWritten records a frame written to a traced user's client. Other users'
+// chat messages are skipped to keep the trace about the user's own journey.
+func (c *Connection) traceWritten(msg WSMessage) {
+	userID, _ := c.joinedAs.Load().(string)
+	if userID == "" {
+		return
+	}
+
+	detail := msg.Type
+	if chatMsg, ok := msg.Data.(*ChatMessage); ok {
+		if chatMsg.UserID != userID {
+			return
+		}
+		detail += " " + chatMsg.ID
+	} else if msg.Error != "" {
+		detail += ": " + msg.Error
+	}
+
+	c.manager.tracer.Record(userID, c.StreamKey, TraceWritten, detail)
+}
+
+// sendChatError sends an error to the client, including its code if it is a ChatError
+func (c *Connection) sendChatError(err error) {
+	msg := WSMessage{
+		Type:      "error",
+		Error:     err.Error(),
+		Timestamp: time.Now(),
+	}
+
+	var chatErr *ChatError
+	var validationErr *ValidationError
+	if errors.As(err, &chatErr) {
+		msg.Code = chatErr.Code
+		msg.Details = chatErr.Details
+	} else if errors.As(err, &validationErr) {
+		msg.Code = ErrInvalidFrame.Code
+		msg.Fields = validationErr.Fields
+	}
+
+	c.send(msg)
+}
+
+// cleanup removes the connection from its room and closes it. Safe to call more than once.
+func (c *Connection) cleanup() {
+	c.cleanupOnce.Do(c.leave)
+}
+
+// leave removes the user from the room and closes the connection
+func (c *Connection) leave() {
+	// Remove from manager
+	if c.UserID != "" {
+		last := c.manager.manager.leaveUser(c.StreamKey, c.UserID)
+		c.manager.touchViewerCount(c.StreamKey)
+
+		c.manager.unregister(c.StreamKey, c)
+
+		for _, streamKey := range c.takeRooms() {
+			c.leaveRoom(streamKey)
+		}
+
+		// Broadcast user left, unless they're still here in another tab
+		if last {
+			c.broadcastToRoom(WSMessage{
+				Type:      "user_left",
+				Data:      UserEvent{UserID: c.UserID, Username: c.Username},
+				Timestamp: time.Now(),
+			})
+		}
+
+		log.Printf("User %s (%s) left chat for stream %s", c.Username, c.UserID, c.StreamKey)
+	} else if c.guest {
+		c.leaveGuest()
+	}
+
+	c.Close("")
+}
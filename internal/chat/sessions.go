@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+)
+
+// StreamStarted starts a new session for a stream that went live, creating its
+// room if nobody has joined yet. Replays of the session are timed from now.
+func (m *Manager) StreamStarted(streamKey string) {
+	room := m.GetOrCreateRoom(streamKey)
+	startedAt := room.startSession(time.Now())
+	m.replay.RecordStart(streamKey, startedAt)
+	room.saveState()
+	log.Printf("Chat session started for stream: %s", streamKey)
+}
+
+// StreamEnded ends the session of a stream that stopped. Its room stays open, but
+// messages sent until the stream goes live again aren't recorded for replay.
+func (m *Manager) StreamEnded(streamKey string) {
+	room, exists := m.GetRoom(streamKey)
+	if !exists {
+		return
+	}
+
+	endedAt := time.Now()
+	startedAt, live := room.endSession(endedAt)
+	if !live {
+		return
+	}
+	m.replay.RecordEnd(streamKey, startedAt, endedAt)
+	room.saveState()
+	log.Printf("Chat session ended for stream: %s", streamKey)
+}
+
+// session returns when the room's stream session started, and whether it is
+// still live
+func (cr *ChatRoom) session() (startedAt time.Time, live bool) {
+	cr.MessagesMux.RLock()
+	defer cr.MessagesMux.RUnlock()
+
+	return cr.startedAt, cr.endedAt.IsZero()
+}
+
+// startSession starts a new stream session at the given time and returns it
+func (cr *ChatRoom) startSession(at time.Time) time.Time {
+	cr.MessagesMux.Lock()
+	defer cr.MessagesMux.Unlock()
+
+	cr.startedAt = at
+	cr.endedAt = time.Time{}
+	return cr.startedAt
+}
+
+// endSession ends the live stream session at the given time, returning when it
+// started and whether there was one to end
+func (cr *ChatRoom) endSession(at time.Time) (startedAt time.Time, live bool) {
+	cr.MessagesMux.Lock()
+	defer cr.MessagesMux.Unlock()
+
+	if !cr.endedAt.IsZero() {
+		return cr.startedAt, false
+	}
+	cr.endedAt = at
+	return cr.startedAt, true
+}
+
+// ReplaySummaryHandler serves GET /api/chat/{streamKey}/replay/{sessionID}/summary,
+// totals of a recorded session's chat
+func (h *WSHandler) ReplaySummaryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	sessionID := r.PathValue("sessionID")
+	if streamKey == "" || sessionID == "" {
+		http.Error(w, "Missing streamKey or sessionID", http.StatusBadRequest)
+		return
+	}
+
+	if !h.manager.replay.Enabled() {
+		writeChatError(w, http.StatusNotFound, ErrReplayDisabled)
+		return
+	}
+
+	summary, err := h.manager.replay.Summary(streamKey, sessionID)
+	if errors.Is(err, ErrReplayNotFound) {
+		writeChatError(w, http.StatusNotFound, ErrReplayNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to summarize chat replay %s for %s: %v", sessionID, streamKey, err)
+		http.Error(w, "Failed to read replay", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, summary)
+}
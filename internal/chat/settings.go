@@ -0,0 +1,204 @@
+package chat
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+)
+
+const maxSettingsBodySize = 4 * 1024
+
+// StreamSettings are the chat choices a streamer makes for their stream. They
+// apply whether or not the stream's room exists.
+type StreamSettings struct {
+	ChatEnabled bool `json:"chatEnabled"`
+	RetentionPolicy
+}
+
+// defaultStreamSettings are the settings of streams nobody has configured
+var defaultStreamSettings = StreamSettings{ChatEnabled: true}
+
+// streamSettingsStore holds the settings of streams that differ from the defaults
+type streamSettingsStore struct {
+	settings map[string]StreamSettings
+	mutex    sync.RWMutex
+}
+
+// newStreamSettingsStore creates a store where every stream has the default settings
+func newStreamSettingsStore() *streamSettingsStore {
+	return &streamSettingsStore{settings: make(map[string]StreamSettings)}
+}
+
+// get returns a stream's settings
+func (s *streamSettingsStore) get(streamKey string) StreamSettings {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	if settings, exists := s.settings[streamKey]; exists {
+		return settings
+	}
+	return defaultStreamSettings
+}
+
+// set replaces a stream's settings
+func (s *streamSettingsStore) set(streamKey string, settings StreamSettings) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.setLocked(streamKey, settings)
+}
+
+// update changes a stream's settings with fn, returning the result
+func (s *streamSettingsStore) update(streamKey string, fn func(*StreamSettings)) StreamSettings {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	settings, exists := s.settings[streamKey]
+	if !exists {
+		settings = defaultStreamSettings
+	}
+	fn(&settings)
+	s.setLocked(streamKey, settings)
+	return settings
+}
+
+// setLocked replaces a stream's settings. Callers must hold the mutex.
+func (s *streamSettingsStore) setLocked(streamKey string, settings StreamSettings) {
+	if settings == defaultStreamSettings {
+		delete(s.settings, streamKey)
+		return
+	}
+	s.settings[streamKey] = settings
+}
+
+// StreamSettings returns a stream's chat settings
+func (m *Manager) StreamSettings(streamKey string) StreamSettings {
+	return m.settings.get(streamKey)
+}
+
+// saveChatEnabled records whether chat is on for a stream in its room's saved
+// state, or in a state of its own when the stream has no room, so turning chat
+// off survives a restart
+func (m *Manager) saveChatEnabled(streamKey string, enabled bool) {
+	shard := m.shard(streamKey)
+	shard.mutex.RLock()
+	room, exists := shard.rooms[streamKey]
+	if deleted, soft := shard.deletedRooms[streamKey]; soft {
+		room, exists = deleted.room, true
+	}
+	shard.mutex.RUnlock()
+	if !exists {
+		m.forgetRoomState(streamKey)
+		return
+	}
+
+	room.MessagesMux.Lock()
+	room.chatDisabled = !enabled
+	room.MessagesMux.Unlock()
+	room.saveState()
+}
+
+// SetStreamSettings changes a stream's chat settings. Turning chat off closes every
+// connection and read-only feed of the stream's room and takes the room away from
+// connections that added it with join_room; clients that join later are refused
+// with ErrChatDisabled until it is turned back on.
+func (h *WSHandler) SetStreamSettings(streamKey string, settings StreamSettings) {
+	previous := h.manager.settings.get(streamKey)
+	h.manager.settings.set(streamKey, settings)
+	h.manager.applyRetention(streamKey)
+	if settings.ChatEnabled != previous.ChatEnabled {
+		h.manager.saveChatEnabled(streamKey, settings.ChatEnabled)
+	}
+	if settings.ChatEnabled {
+		return
+	}
+
+	toClose := []*Connection{}
+	toLeave := []*Connection{}
+	for _, conn := range h.roomConnections(streamKey) {
+		if conn.StreamKey == streamKey {
+			toClose = append(toClose, conn)
+		} else if conn.removeRoom(streamKey) {
+			toLeave = append(toLeave, conn)
+		}
+	}
+
+	for _, conn := range toClose {
+		conn.Close(ErrChatDisabled.Message)
+	}
+	for _, conn := range toLeave {
+		conn.leaveRoom(streamKey)
+		conn.sendRoomLeft(streamKey, ErrChatDisabled)
+	}
+	feeds := h.closeSubscribers(streamKey)
+	log.Printf("Chat disabled for stream %s (%d connections and %d feeds closed)", streamKey, len(toClose), feeds)
+}
+
+// RequireStreamOwner wraps a room's handler so it runs for requests authorized for
+// the scope, and for the stream's owner: a user whose credentials, such as an
+// ?access_token= JWT, grant them the owner role in the room.
+func (h *WSHandler) RequireStreamOwner(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if h.tokens.Authorized(r, scope) || h.isStreamOwner(r, r.PathValue("streamKey")) {
+			next(w, r)
+			return
+		}
+
+		if h.tokens.Lookup(r) == nil {
+			writeChatError(w, http.StatusUnauthorized, ErrUnauthorized)
+		} else {
+			writeChatError(w, http.StatusForbidden, ErrForbidden)
+		}
+	}
+}
+
+// isStreamOwner reports whether a request comes from the owner of a stream
+func (h *WSHandler) isStreamOwner(r *http.Request, streamKey string) bool {
+	if streamKey == "" || h.currentAuthenticator() == nil {
+		return false
+	}
+
+	identity, err := h.resolveIdentity(requestCredentials(r, h.clientIP(r)))
+	if err != nil || identity == nil {
+		return false
+	}
+	return slices.Contains(parseRoles(identity.Roles, streamKey), RoleOwner)
+}
+
+// SettingsHandler serves /api/chat/{streamKey}/settings, the streamer's chat settings:
+//
+//	GET  read the stream's settings
+//	PUT  change them, e.g. {"chatEnabled": false} to turn chat off or
+//	     {"retentionMinutes": 10, "maxMessages": 200} to keep less history
+func (h *WSHandler) SettingsHandler(w http.ResponseWriter, r *http.Request) {
+	streamKey := r.PathValue("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, h.manager.StreamSettings(streamKey))
+
+	case http.MethodPut:
+		// Fields left out keep their current values
+		settings := h.manager.StreamSettings(streamKey)
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxSettingsBodySize)).Decode(&settings); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := settings.RetentionPolicy.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		h.SetStreamSettings(streamKey, settings)
+		writeJSON(w, http.StatusOK, settings)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,98 @@
+package chat
+
+import "sync"
+
+const (
+	roomShardCount      = 64
+	rateLimitShardCount = 64
+	fnvOffset32         = 2166136261
+	fnvPrime32          = 16777619
+)
+
+// shardIndex hashes a key onto one of n shards with FNV-1a
+func shardIndex(key string, n int) int {
+	hash := uint32(fnvOffset32)
+	for i := 0; i < len(key); i++ {
+		hash ^= uint32(key[i])
+		hash *= fnvPrime32
+	}
+	return int(hash % uint32(n))
+}
+
+// roomShard holds the live and soft-deleted rooms whose stream keys hash to it.
+// Spreading rooms over shards means joins, messages and lookups in different
+// rooms rarely wait on the same lock.
+type roomShard struct {
+	rooms        map[string]*ChatRoom
+	deletedRooms map[string]*deletedRoom // soft-deleted rooms awaiting purge
+	mutex        sync.RWMutex
+}
+
+// newRoomShards creates empty room shards
+func newRoomShards() []*roomShard {
+	shards := make([]*roomShard, roomShardCount)
+	for i := range shards {
+		shards[i] = &roomShard{
+			rooms:        make(map[string]*ChatRoom),
+			deletedRooms: make(map[string]*deletedRoom),
+		}
+	}
+	return shards
+}
+
+// hasLocked reports whether a room, live or soft-deleted, exists. Callers must hold the shard's mutex.
+func (s *roomShard) hasLocked(streamKey string) bool {
+	_, live := s.rooms[streamKey]
+	_, deleted := s.deletedRooms[streamKey]
+	return live || deleted
+}
+
+// shard returns the shard holding a stream's room
+func (m *Manager) shard(streamKey string) *roomShard {
+	return m.shards[shardIndex(streamKey, len(m.shards))]
+}
+
+// liveRooms returns every live room, locking one shard at a time
+func (m *Manager) liveRooms() []*ChatRoom {
+	rooms := []*ChatRoom{}
+	for _, shard := range m.shards {
+		shard.mutex.RLock()
+		for _, room := range shard.rooms {
+			rooms = append(rooms, room)
+		}
+		shard.mutex.RUnlock()
+	}
+	return rooms
+}
+
+// roomCounts returns how many rooms are live and soft-deleted
+func (m *Manager) roomCounts() (live, deleted int) {
+	for _, shard := range m.shards {
+		shard.mutex.RLock()
+		live += len(shard.rooms)
+		deleted += len(shard.deletedRooms)
+		shard.mutex.RUnlock()
+	}
+	return live, deleted
+}
+
+// rateLimitShard holds the rate records of the users whose IDs hash to it. Its
+// mutex only guards the map; each record has its own lock for checks.
+type rateLimitShard struct {
+	records map[string]*UserRateRecord
+	mutex   sync.RWMutex
+}
+
+// newRateLimitShards creates empty rate limit shards
+func newRateLimitShards() []*rateLimitShard {
+	shards := make([]*rateLimitShard, rateLimitShardCount)
+	for i := range shards {
+		shards[i] = &rateLimitShard{records: make(map[string]*UserRateRecord)}
+	}
+	return shards
+}
+
+// shard returns the shard holding a user's rate record
+func (rl *RateLimiter) shard(userID string) *rateLimitShard {
+	return rl.shards[shardIndex(userID, len(rl.shards))]
+}
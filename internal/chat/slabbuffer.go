@@ -0,0 +1,362 @@
+package chat
+
+import (
+	"math"
+	"sync"
+	"time"
+	"unsafe"
+)
+
+// Message buffer modes accepted by CHAT_BUFFER_MODE
+const (
+	BufferHeap = "heap" // messages and their strings are separate heap objects
+	BufferSlab = "slab" // messages are copied into a preallocated slab per room
+)
+
+// slabFieldBytes is the room a slot leaves for a message's IDs and names on top
+// of its text
+const slabFieldBytes = 256
+
+// validBufferMode reports whether name is a message buffer mode
+func validBufferMode(name string) bool {
+	return name == BufferHeap || name == BufferSlab
+}
+
+// slabSlotBytes is the size of each slot's region: enough for the longest message
+// a user may send along with its IDs and names
+func slabSlotBytes(config *ChatConfig) int {
+	return config.MaxCharactersPerMessage + slabFieldBytes
+}
+
+// The string fields of a message, in the order they're laid out in a slot's region
+const (
+	slabID = iota
+	slabStreamKey
+	slabUserID
+	slabUsername
+	slabMessage
+	slabOriginSystem
+	slabOriginID
+	slabFields
+)
+
+// slabSlot describes the message in one slot. It holds no pointers, so the
+// garbage collector never scans the slot array.
+type slabSlot struct {
+	seq       int64
+	timestamp int64              // unix nanoseconds; 0 for messages without a timestamp
+	ends      [slabFields]uint32 // where each field ends in the slot's region; each starts where the previous one ends
+	hasOrigin bool
+	overflow  bool // too large for the region, so kept in the overflow map instead
+}
+
+var slabSlotSize = int64(unsafe.Sizeof(slabSlot{}))
+
+// SlabBuffer is a ring buffer of messages that copies each message into a
+// fixed-size region of one preallocated byte slab. Adding a message allocates
+// nothing, and the slab and slot array hold no pointers for the garbage collector
+// to scan, which keeps long-lived, high-volume rooms cheap. Reads copy messages
+// back out. The rare message too large for a region is kept on the heap.
+type SlabBuffer struct {
+	slots     []slabSlot
+	slab      []byte // slotBytes per slot
+	slotBytes int
+	overflow  map[int]ChatMessage // slot index -> message too large for its region
+	maxSize   int
+	head      int
+	tail      int
+	size      int
+	mutex     sync.RWMutex
+}
+
+// NewSlabBuffer creates a slab buffer holding maxSize messages of up to slotBytes
+// bytes of text, IDs and names each
+func NewSlabBuffer(maxSize, slotBytes int) *SlabBuffer {
+	return &SlabBuffer{
+		slots:     make([]slabSlot, maxSize),
+		slab:      make([]byte, maxSize*slotBytes),
+		slotBytes: slotBytes,
+		overflow:  make(map[int]ChatMessage),
+		maxSize:   maxSize,
+	}
+}
+
+// region returns the bytes of a slot
+func (sb *SlabBuffer) region(i int) []byte {
+	return sb.slab[i*sb.slotBytes : (i+1)*sb.slotBytes]
+}
+
+// store writes a message into a slot. Callers must hold the mutex.
+func (sb *SlabBuffer) store(i int, msg ChatMessage) {
+	delete(sb.overflow, i)
+	slot := slabSlot{seq: msg.Seq, hasOrigin: msg.Origin != nil}
+	if !msg.Timestamp.IsZero() {
+		slot.timestamp = msg.Timestamp.UnixNano()
+	}
+
+	fields := [slabFields]string{msg.ID, msg.StreamKey, msg.UserID, msg.Username, msg.Message}
+	if msg.Origin != nil {
+		fields[slabOriginSystem], fields[slabOriginID] = msg.Origin.System, msg.Origin.ID
+	}
+
+	total := 0
+	for _, field := range fields {
+		total += len(field)
+	}
+	if total > sb.slotBytes {
+		slot.overflow = true
+		sb.overflow[i] = msg
+		sb.slots[i] = slot
+		return
+	}
+
+	region := sb.region(i)
+	end := 0
+	for f, field := range fields {
+		end += copy(region[end:], field)
+		slot.ends[f] = uint32(end)
+	}
+	sb.slots[i] = slot
+}
+
+// hasID reports whether the message in a slot has the given ID, without copying it out
+func (sb *SlabBuffer) hasID(i int, id string) bool {
+	if sb.slots[i].overflow {
+		return sb.overflow[i].ID == id
+	}
+	return string(sb.region(i)[:sb.slots[i].ends[slabID]]) == id
+}
+
+// load copies a slot's message out of the slab. Callers must hold the mutex.
+func (sb *SlabBuffer) load(i int) ChatMessage {
+	slot := sb.slots[i]
+	if slot.overflow {
+		return sb.overflow[i]
+	}
+
+	// One allocation for every field; the strings share it
+	all := string(sb.region(i)[:slot.ends[slabFields-1]])
+	text := func(f int) string {
+		start := uint32(0)
+		if f > 0 {
+			start = slot.ends[f-1]
+		}
+		return all[start:slot.ends[f]]
+	}
+
+	msg := ChatMessage{
+		ID:        text(slabID),
+		StreamKey: text(slabStreamKey),
+		UserID:    text(slabUserID),
+		Username:  text(slabUsername),
+		Message:   text(slabMessage),
+		Seq:       slot.seq,
+	}
+	if slot.timestamp != 0 {
+		msg.Timestamp = time.Unix(0, slot.timestamp)
+	}
+	if slot.hasOrigin {
+		msg.Origin = &MessageOrigin{System: text(slabOriginSystem), ID: text(slabOriginID)}
+	}
+	return msg
+}
+
+// free forgets a slot's message. Callers must hold the mutex.
+func (sb *SlabBuffer) free(i int) {
+	delete(sb.overflow, i)
+	sb.slots[i] = slabSlot{}
+}
+
+// index returns the slot of the nth oldest message
+func (sb *SlabBuffer) index(n int) int {
+	return (sb.head + n) % sb.maxSize
+}
+
+// Add adds a message to the buffer, evicting the oldest one when it is full
+func (sb *SlabBuffer) Add(msg ChatMessage) {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	sb.store(sb.tail, msg)
+	sb.tail = (sb.tail + 1) % sb.maxSize
+
+	if sb.size < sb.maxSize {
+		sb.size++
+	} else {
+		sb.head = (sb.head + 1) % sb.maxSize
+	}
+}
+
+// GetAll returns all messages in the buffer, oldest first
+func (sb *SlabBuffer) GetAll() []ChatMessage {
+	return sb.GetRecent(math.MaxInt)
+}
+
+// GetRecent returns the N most recent messages
+func (sb *SlabBuffer) GetRecent(n int) []ChatMessage {
+	sb.mutex.RLock()
+	defer sb.mutex.RUnlock()
+
+	count := min(n, sb.size)
+	result := make([]ChatMessage, count)
+	for i := 0; i < count; i++ {
+		result[i] = sb.load(sb.index(sb.size - count + i))
+	}
+	return result
+}
+
+// GetAfter returns the messages numbered after seq, oldest first
+func (sb *SlabBuffer) GetAfter(seq int64) []ChatMessage {
+	sb.mutex.RLock()
+	defer sb.mutex.RUnlock()
+
+	start := sb.size
+	for start > 0 && sb.slots[sb.index(start-1)].seq > seq {
+		start--
+	}
+
+	result := make([]ChatMessage, 0, sb.size-start)
+	for i := start; i < sb.size; i++ {
+		result = append(result, sb.load(sb.index(i)))
+	}
+	return result
+}
+
+// GetBefore returns up to n messages older than the message with the given ID; see
+// CircularBuffer.GetBefore
+func (sb *SlabBuffer) GetBefore(beforeID string, n int) (messages []ChatMessage, hasMore bool, found bool) {
+	sb.mutex.RLock()
+	defer sb.mutex.RUnlock()
+
+	end := sb.size
+	if beforeID != "" {
+		end = -1
+		for i := sb.size - 1; i >= 0; i-- {
+			if sb.hasID(sb.index(i), beforeID) {
+				end = i
+				break
+			}
+		}
+
+		if end == -1 {
+			return []ChatMessage{}, false, false
+		}
+	}
+
+	start := max(end-n, 0)
+	result := make([]ChatMessage, end-start)
+	for i := start; i < end; i++ {
+		result[i-start] = sb.load(sb.index(i))
+	}
+	return result, start > 0, true
+}
+
+// Size returns the current number of messages in the buffer
+func (sb *SlabBuffer) Size() int {
+	sb.mutex.RLock()
+	defer sb.mutex.RUnlock()
+	return sb.size
+}
+
+// Capacity returns the number of messages the buffer can hold before overwriting
+func (sb *SlabBuffer) Capacity() int {
+	sb.mutex.RLock()
+	defer sb.mutex.RUnlock()
+	return sb.maxSize
+}
+
+// Bytes returns the memory the buffer holds: its slab and slots, which are
+// allocated up front, plus any messages too large for the slab
+func (sb *SlabBuffer) Bytes() int64 {
+	sb.mutex.RLock()
+	defer sb.mutex.RUnlock()
+
+	total := int64(len(sb.slab)) + int64(sb.maxSize)*slabSlotSize
+	for _, msg := range sb.overflow {
+		total += messageSlotSize + messageSize(msg)
+	}
+	return total
+}
+
+// Oldest returns the oldest message in the buffer
+func (sb *SlabBuffer) Oldest() (ChatMessage, bool) {
+	sb.mutex.RLock()
+	defer sb.mutex.RUnlock()
+
+	if sb.size == 0 {
+		return ChatMessage{}, false
+	}
+	return sb.load(sb.head), true
+}
+
+// Resize changes the buffer's capacity, keeping the most recent messages that fit.
+// The slab is reallocated at the new size.
+func (sb *SlabBuffer) Resize(maxSize int) {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	if maxSize < 1 || maxSize == sb.maxSize {
+		return
+	}
+
+	keep := min(sb.size, maxSize)
+	skip := sb.size - keep
+
+	resized := NewSlabBuffer(maxSize, sb.slotBytes)
+	for i := 0; i < keep; i++ {
+		from := sb.index(skip + i)
+		resized.slots[i] = sb.slots[from]
+		copy(resized.region(i), sb.region(from))
+		if msg, ok := sb.overflow[from]; ok {
+			resized.overflow[i] = msg
+		}
+	}
+
+	sb.slots, sb.slab, sb.overflow = resized.slots, resized.slab, resized.overflow
+	sb.maxSize = maxSize
+	sb.head = 0
+	sb.size = keep
+	sb.tail = keep % maxSize
+}
+
+// Clear removes all messages from the buffer
+func (sb *SlabBuffer) Clear() {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	clear(sb.slots)
+	clear(sb.overflow)
+	sb.head = 0
+	sb.tail = 0
+	sb.size = 0
+}
+
+// DropOldest removes up to n of the oldest messages, returning how many were removed
+func (sb *SlabBuffer) DropOldest(n int) int {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	removed := 0
+	for ; removed < n && sb.size > 0; removed++ {
+		sb.free(sb.head)
+		sb.head = (sb.head + 1) % sb.maxSize
+		sb.size--
+	}
+	return removed
+}
+
+// RemoveOlderThan removes messages older than the specified duration
+func (sb *SlabBuffer) RemoveOlderThan(duration time.Duration) int {
+	sb.mutex.Lock()
+	defer sb.mutex.Unlock()
+
+	cutoff := time.Now().Add(-duration).UnixNano()
+	removed := 0
+	for sb.size > 0 && sb.slots[sb.head].timestamp <= cutoff {
+		sb.free(sb.head)
+		sb.head = (sb.head + 1) % sb.maxSize
+		sb.size--
+		removed++
+	}
+	return removed
+}
@@ -0,0 +1,100 @@
+package chat
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlabBufferRoundTrip(t *testing.T) {
+	sb := NewSlabBuffer(3, 64)
+
+	now := time.Now()
+	plain := ChatMessage{ID: "1", StreamKey: "room", UserID: "u1", Username: "alice", Message: "hello", Timestamp: now, Seq: 1}
+	bridged := ChatMessage{ID: "2", StreamKey: "room", UserID: "u2", Username: "bob", Message: "hi", Seq: 2, Origin: &MessageOrigin{System: "irc", ID: "42"}}
+	sb.Add(plain)
+	sb.Add(bridged)
+
+	messages := sb.GetAll()
+	require.Len(t, messages, 2)
+	require.Equal(t, plain.Message, messages[0].Message)
+	require.True(t, plain.Timestamp.Equal(messages[0].Timestamp))
+	require.Nil(t, messages[0].Origin)
+	require.Equal(t, "bob", messages[1].Username)
+	require.True(t, messages[1].Timestamp.IsZero())
+	require.Equal(t, &MessageOrigin{System: "irc", ID: "42"}, messages[1].Origin)
+
+	// A message too large for its slot is kept whole
+	long := ChatMessage{ID: "3", Message: strings.Repeat("x", 100), Seq: 3}
+	sb.Add(long)
+	sb.Add(ChatMessage{ID: "4", Seq: 4})
+	require.Equal(t, []string{"2", "3", "4"}, messageIDs(sb.GetAll()))
+	require.Equal(t, long.Message, sb.GetRecent(2)[0].Message)
+	require.Equal(t, []string{"3", "4"}, messageIDs(sb.GetAfter(2)))
+
+	page, hasMore, found := sb.GetBefore("4", 1)
+	require.True(t, found)
+	require.True(t, hasMore)
+	require.Equal(t, []string{"3"}, messageIDs(page))
+	_, _, found = sb.GetBefore("1", 1)
+	require.False(t, found)
+
+	oldest, ok := sb.Oldest()
+	require.True(t, ok)
+	require.Equal(t, "2", oldest.ID)
+}
+
+func TestSlabBufferResizeAndRemoval(t *testing.T) {
+	sb := NewSlabBuffer(4, 32)
+	for i := 0; i < 6; i++ {
+		sb.Add(ChatMessage{ID: strconv.Itoa(i), Message: strings.Repeat("m", 10*i), Timestamp: time.Now().Add(time.Duration(i-6) * time.Hour)})
+	}
+
+	// 4 and 5 don't fit their slots, so they move with the resize from the overflow
+	sb.Resize(3)
+	require.Equal(t, []string{"3", "4", "5"}, messageIDs(sb.GetAll()))
+	require.Equal(t, strings.Repeat("m", 50), sb.GetRecent(1)[0].Message)
+
+	sb.Resize(5)
+	sb.Add(ChatMessage{ID: "6", Timestamp: time.Now()})
+	require.Equal(t, []string{"3", "4", "5", "6"}, messageIDs(sb.GetAll()))
+	require.Equal(t, 5, sb.Capacity())
+
+	require.Equal(t, 3, sb.RemoveOlderThan(30*time.Minute))
+	require.Equal(t, []string{"6"}, messageIDs(sb.GetAll()))
+
+	require.Equal(t, 1, sb.DropOldest(2))
+	require.Equal(t, 0, sb.Size())
+
+	sb.Add(ChatMessage{ID: "7", Message: strings.Repeat("m", 40)})
+	sb.Clear()
+	require.Empty(t, sb.GetAll())
+	require.Equal(t, int64(5*32)+5*slabSlotSize, sb.Bytes())
+}
+
+func TestSlabBufferAddDoesNotAllocate(t *testing.T) {
+	sb := NewSlabBuffer(100, slabSlotBytes(DefaultConfig()))
+	msg := ChatMessage{ID: "id", StreamKey: "room", UserID: "alice", Username: "alice", Message: "hello chat", Timestamp: time.Now()}
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		msg.Seq++
+		sb.Add(msg)
+	})
+	require.Zero(t, allocs)
+}
+
+func TestManagerUsesSlabBuffers(t *testing.T) {
+	config := DefaultConfig()
+	config.BufferMode = BufferSlab
+	m := NewManager(config)
+	defer m.Stop()
+
+	msg, err := m.AddMessage("room", "alice", "alice", "hello")
+	require.NoError(t, err)
+	room := m.GetOrCreateRoom("room")
+	require.IsType(t, &SlabBuffer{}, room.Messages)
+	require.Equal(t, []string{msg.ID}, messageIDs(room.Messages.GetAll()))
+}
@@ -0,0 +1,106 @@
+package chat
+
+import (
+	"log"
+	"time"
+)
+
+// Overflow policies accepted by CHAT_SEND_QUEUE_POLICY, for broadcasts to a
+// connection whose send queue is full
+const (
+	OverflowDropNewest = "drop-newest" // the new frame is dropped
+	OverflowDropOldest = "drop-oldest" // the oldest queued frame is dropped to make room
+	OverflowDisconnect = "disconnect"  // the connection is closed
+)
+
+// validOverflowPolicy reports whether policy is one of the Overflow constants
+func validOverflowPolicy(policy string) bool {
+	switch policy {
+	case OverflowDropNewest, OverflowDropOldest, OverflowDisconnect:
+		return true
+	}
+	return false
+}
+
+// deliver queues a broadcast frame for the connection without waiting, or holds
+// it for the next digest while the client is in digest mode. A client
+// whose queue fills past ChatConfig.SlowClientWarnPercent is warned once that it
+// is falling behind. A full queue is handled by ChatConfig.SendQueuePolicy, and
+// once ChatConfig.SlowClientMaxDrops frames have been dropped the connection is
+// closed rather than left to miss messages indefinitely. Frames dropped to make
+// room under drop-oldest don't count towards closing it, since the client still
+// gets the newest. Both reset when the client catches up to a half-full queue. It
+// reports whether the frame was queued.
+func (c *Connection) deliver(msg WSMessage) bool {
+	config := c.manager.manager.config
+
+	// Clients in digest mode get chat messages in periodic batches instead
+	if c.digest.hold(msg) {
+		return true
+	}
+
+	select {
+	case c.Send <- msg:
+	default:
+		queued := false
+		maxDrops := config.SlowClientMaxDrops
+		switch config.SendQueuePolicy {
+		case OverflowDropOldest:
+			select {
+			case <-c.Send:
+			default:
+			}
+			select {
+			case c.Send <- msg:
+				queued = true
+				maxDrops = 0
+			default:
+			}
+		case OverflowDisconnect:
+			maxDrops = 1
+		}
+
+		dropped := c.droppedFrames.Add(1)
+		if maxDrops > 0 && dropped == int64(maxDrops) {
+			// Closing writes to the socket, which must not hold up the rest of the room
+			go c.evict(dropped)
+		}
+		if !queued {
+			return false
+		}
+	}
+	c.wake()
+
+	backlog := len(c.Send)
+	switch {
+	case backlog <= cap(c.Send)/2:
+		c.droppedFrames.Store(0)
+		c.slowWarned.Store(false)
+	case config.SlowClientWarnPercent > 0 && backlog*100 >= cap(c.Send)*config.SlowClientWarnPercent:
+		if c.slowWarned.CompareAndSwap(false, true) {
+			c.warnSlow()
+		}
+	}
+	return true
+}
+
+// warnSlow tells the client it is falling behind, if its queue still has room
+func (c *Connection) warnSlow() {
+	select {
+	case c.Send <- WSMessage{
+		Type:      "error",
+		Error:     ErrSlowClient.Message,
+		Code:      ErrSlowClient.Code,
+		Timestamp: time.Now(),
+	}:
+		c.wake()
+	default:
+	}
+}
+
+// evict closes a connection that kept dropping frames
+func (c *Connection) evict(dropped int64) {
+	log.Printf("Closing chat connection for user %s in stream %s: %d frames dropped", c.UserID, c.StreamKey, dropped)
+	c.manager.slowEvictions.Add(1)
+	c.Close(ErrSlowClient.Message)
+}
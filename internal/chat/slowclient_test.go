@@ -0,0 +1,138 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newSlowTestConnection(t *testing.T, queue int) (*WSHandler, *Connection) {
+	h, _ := newTestHandler(t)
+	h.manager.config.SlowClientWarnPercent = 75
+	h.manager.config.SlowClientMaxDrops = 3
+
+	c := &Connection{
+		UserID:    "alice",
+		StreamKey: "room",
+		Transport: &recordingTransport{},
+		Send:      make(chan WSMessage, queue),
+		manager:   h,
+		done:      make(chan struct{}),
+	}
+	return h, c
+}
+
+func TestSlowClientIsWarnedThenEvicted(t *testing.T) {
+	h, c := newSlowTestConnection(t, 4)
+
+	frame := WSMessage{Type: "system"}
+	for i := 0; i < 3; i++ {
+		require.True(t, c.deliver(frame))
+	}
+
+	// Three quarters full: the warning takes the last slot
+	require.Len(t, c.Send, 4)
+	frames := pending(c)
+	require.Equal(t, CodeSlowClient, frames[3].Code)
+
+	// Warned only once per episode
+	for _, f := range frames[:3] {
+		c.Send <- f
+	}
+	require.True(t, c.deliver(frame))
+	require.Len(t, c.Send, 4)
+
+	for i := 0; i < 2; i++ {
+		require.False(t, c.deliver(frame))
+	}
+	select {
+	case <-c.Done():
+		t.Fatal("closed before reaching the drop limit")
+	default:
+	}
+
+	require.False(t, c.deliver(frame))
+	require.Eventually(t, func() bool {
+		select {
+		case <-c.Done():
+			return true
+		default:
+			return false
+		}
+	}, time.Second, 5*time.Millisecond)
+	require.Equal(t, int64(1), h.Diagnostics().SlowEvictions)
+}
+
+func TestSlowClientRecovers(t *testing.T) {
+	_, c := newSlowTestConnection(t, 4)
+
+	frame := WSMessage{Type: "system"}
+	for i := 0; i < 3; i++ {
+		c.deliver(frame)
+	}
+	require.False(t, c.deliver(frame))
+	require.False(t, c.deliver(frame))
+	require.Equal(t, int64(2), c.droppedFrames.Load())
+
+	// Catching up clears the drops and allows a new warning
+	pending(c)
+	require.True(t, c.deliver(frame))
+	require.Zero(t, c.droppedFrames.Load())
+	require.False(t, c.slowWarned.Load())
+}
+
+func TestSendQueueOverflowPolicies(t *testing.T) {
+	t.Run("drop-oldest", func(t *testing.T) {
+		h, c := newSlowTestConnection(t, 2)
+		h.manager.config.SendQueuePolicy = OverflowDropOldest
+		h.manager.config.SlowClientWarnPercent = 0
+
+		for _, text := range []string{"one", "two", "three"} {
+			require.True(t, c.deliver(WSMessage{Type: "system", Data: SystemEvent{Message: text}}))
+		}
+
+		frames := pending(c)
+		require.Len(t, frames, 2)
+		require.Equal(t, SystemEvent{Message: "two"}, frames[0].Data)
+		require.Equal(t, SystemEvent{Message: "three"}, frames[1].Data)
+		require.Equal(t, int64(1), c.droppedFrames.Load())
+
+		// However far behind the client falls, it keeps getting the newest frames
+		h.manager.config.SlowClientMaxDrops = 1
+		for i := 0; i < 3; i++ {
+			require.True(t, c.deliver(WSMessage{Type: "system"}))
+		}
+		select {
+		case <-c.Done():
+			t.Fatal("drop-oldest closed the connection")
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+
+	t.Run("disconnect", func(t *testing.T) {
+		h, c := newSlowTestConnection(t, 2)
+		h.manager.config.SendQueuePolicy = OverflowDisconnect
+		h.manager.config.SlowClientWarnPercent = 0
+
+		require.True(t, c.deliver(WSMessage{Type: "system"}))
+		require.True(t, c.deliver(WSMessage{Type: "system"}))
+		require.False(t, c.deliver(WSMessage{Type: "system"}))
+		require.Eventually(t, func() bool {
+			select {
+			case <-c.Done():
+				return true
+			default:
+				return false
+			}
+		}, time.Second, 5*time.Millisecond)
+	})
+}
+
+func TestSendQueueSizeIsConfigurable(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.manager.config.SendQueueSize = 8
+
+	c := newConnection(h, "room", "127.0.0.1", &recordingTransport{})
+	require.Equal(t, 8, cap(c.Send))
+}
@@ -0,0 +1,429 @@
+package chat
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	_ "modernc.org/sqlite" // registers the pure Go "sqlite" driver
+)
+
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS messages (
+	row           INTEGER PRIMARY KEY,
+	stream_key    TEXT    NOT NULL,
+	seq           INTEGER NOT NULL,
+	id            TEXT    NOT NULL,
+	user_id       TEXT    NOT NULL,
+	username      TEXT    NOT NULL,
+	message       TEXT    NOT NULL,
+	timestamp     INTEGER NOT NULL,
+	origin_system TEXT,
+	origin_id     TEXT
+);
+CREATE INDEX IF NOT EXISTS messages_room_seq ON messages (stream_key, seq);
+CREATE INDEX IF NOT EXISTS messages_room_time ON messages (stream_key, timestamp);
+CREATE INDEX IF NOT EXISTS messages_id ON messages (id);
+CREATE TABLE IF NOT EXISTS rooms (
+	stream_key TEXT PRIMARY KEY,
+	state      TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS timeouts (
+	user_id TEXT PRIMARY KEY,
+	state   TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS profiles (
+	user_id TEXT PRIMARY KEY,
+	state   TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS tombstones (
+	row        INTEGER PRIMARY KEY,
+	stream_key TEXT    NOT NULL,
+	message_id TEXT    NOT NULL,
+	state      TEXT    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tombstones_room ON tombstones (stream_key);
+CREATE INDEX IF NOT EXISTS tombstones_message ON tombstones (message_id);
+`
+
+// SQLiteStore is a MessageStore keeping every room's messages in a SQLite database
+// file, so a single instance keeps chat history across restarts without running a
+// database server. The database uses write-ahead logging, and appends are held
+// briefly and inserted in batches, one transaction each, so persisting adds little
+// to posting a message. Reads and deletes write what is held first.
+type SQLiteStore struct {
+	db      *sql.DB
+	batcher *writeBatcher
+}
+
+// NewSQLiteStore opens, creating if needed, the SQLite database at path, holding
+// appends for writing as batching says
+func NewSQLiteStore(path string, batching WriteBatching) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// One connection: SQLite allows a single writer, and the WAL pragma is per connection
+	db.SetMaxOpenConns(1)
+
+	for _, pragma := range []string{"PRAGMA journal_mode=WAL", "PRAGMA synchronous=NORMAL", "PRAGMA busy_timeout=5000"} {
+		if _, err := db.Exec(pragma); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("configuring sqlite: %w", err)
+		}
+	}
+	if _, err := db.Exec(sqliteSchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("creating sqlite schema: %w", err)
+	}
+
+	s := &SQLiteStore{db: db}
+	s.batcher, err = newWriteBatcher("SQLite", batching, s.insert)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Append holds a message for the next batch. While too many are waiting to be
+// written it is dropped, or the held messages are written first, as the
+// batching's overflow policy says.
+func (s *SQLiteStore) Append(msg ChatMessage) error {
+	s.batcher.add(msg)
+	return nil
+}
+
+// Range reads up to limit of a room's messages numbered after afterSeq
+func (s *SQLiteStore) Range(streamKey string, afterSeq int64, limit int) ([]ChatMessage, error) {
+	if err := s.batcher.flush(); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = -1 // no limit
+	}
+
+	return s.query(
+		`SELECT id, stream_key, user_id, username, message, timestamp, seq, origin_system, origin_id
+		 FROM messages WHERE stream_key = ? AND seq > ? ORDER BY row LIMIT ?`,
+		streamKey, afterSeq, limit,
+	)
+}
+
+// UserMessages reads every message the user sent, in every room, oldest first
+func (s *SQLiteStore) UserMessages(userID string) ([]ChatMessage, error) {
+	if err := s.batcher.flush(); err != nil {
+		return nil, err
+	}
+
+	return s.query(
+		`SELECT id, stream_key, user_id, username, message, timestamp, seq, origin_system, origin_id
+		 FROM messages WHERE user_id = ? ORDER BY timestamp, row`,
+		userID,
+	)
+}
+
+// query reads messages from the rows a statement selects
+func (s *SQLiteStore) query(statement string, args ...interface{}) ([]ChatMessage, error) {
+	rows, err := s.db.Query(statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	messages := []ChatMessage{}
+	for rows.Next() {
+		var msg ChatMessage
+		var timestamp int64
+		var originSystem, originID sql.NullString
+		if err := rows.Scan(&msg.ID, &msg.StreamKey, &msg.UserID, &msg.Username, &msg.Message, &timestamp, &msg.Seq, &originSystem, &originID); err != nil {
+			return nil, err
+		}
+		msg.Timestamp = time.Unix(0, timestamp)
+		if originSystem.Valid {
+			msg.Origin = &MessageOrigin{System: originSystem.String, ID: originID.String}
+		}
+		messages = append(messages, msg)
+	}
+	return messages, rows.Err()
+}
+
+// DeleteBefore removes a room's messages older than cutoff
+func (s *SQLiteStore) DeleteBefore(streamKey string, cutoff time.Time) (int, error) {
+	if err := s.batcher.flush(); err != nil {
+		return 0, err
+	}
+
+	result, err := s.db.Exec(`DELETE FROM messages WHERE stream_key = ? AND timestamp < ?`, streamKey, cutoff.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+// Compact removes every room's messages older than cutoff and the tombstones of
+// messages no longer stored, then rebuilds the database file without the pages
+// they took
+func (s *SQLiteStore) Compact(cutoff time.Time) (int, int64, error) {
+	if err := s.batcher.flush(); err != nil {
+		return 0, 0, err
+	}
+
+	before, err := s.size()
+	if err != nil {
+		return 0, 0, err
+	}
+	result, err := s.db.Exec(`DELETE FROM messages WHERE timestamp < ?`, cutoff.UnixNano())
+	if err != nil {
+		return 0, 0, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := s.db.Exec(`DELETE FROM tombstones WHERE NOT EXISTS (SELECT 1 FROM messages WHERE messages.id = tombstones.message_id)`); err != nil {
+		return int(removed), 0, err
+	}
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return int(removed), 0, err
+	}
+	after, err := s.size()
+	if err != nil {
+		return int(removed), 0, err
+	}
+	return int(removed), max(0, before-after), nil
+}
+
+// size returns how many bytes the database takes
+func (s *SQLiteStore) size() (int64, error) {
+	var pages, pageSize int64
+	if err := s.db.QueryRow(`PRAGMA page_count`).Scan(&pages); err != nil {
+		return 0, err
+	}
+	if err := s.db.QueryRow(`PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return pages * pageSize, nil
+}
+
+// DeleteByID removes one of a room's messages
+func (s *SQLiteStore) DeleteByID(streamKey, id string) (bool, error) {
+	if err := s.batcher.flush(); err != nil {
+		return false, err
+	}
+
+	result, err := s.db.Exec(`DELETE FROM messages WHERE stream_key = ? AND id = ?`, streamKey, id)
+	if err != nil {
+		return false, err
+	}
+	removed, err := result.RowsAffected()
+	return removed > 0, err
+}
+
+// EraseUser removes every message the user sent
+func (s *SQLiteStore) EraseUser(userID string) (int, error) {
+	if err := s.batcher.flush(); err != nil {
+		return 0, err
+	}
+
+	// Edits are the user's words too, so the tombstones of their messages go with them
+	if _, err := s.db.Exec(`DELETE FROM tombstones WHERE message_id IN (SELECT id FROM messages WHERE user_id = ?)`, userID); err != nil {
+		return 0, err
+	}
+	result, err := s.db.Exec(`DELETE FROM messages WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	return int(removed), err
+}
+
+// AppendTombstone records that a message was deleted or edited
+func (s *SQLiteStore) AppendTombstone(tombstone Tombstone) error {
+	state, err := json.Marshal(tombstone)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO tombstones (stream_key, message_id, state) VALUES (?, ?, ?)`,
+		tombstone.StreamKey, tombstone.MessageID, string(state),
+	)
+	return err
+}
+
+// Tombstones returns a room's tombstones, oldest first
+func (s *SQLiteStore) Tombstones(streamKey string) ([]Tombstone, error) {
+	return loadSaved[Tombstone](s.db, `SELECT state FROM tombstones WHERE stream_key = ? ORDER BY row`, streamKey)
+}
+
+// Pending returns the number of messages held for the next batch
+func (s *SQLiteStore) Pending() int {
+	return s.batcher.Pending()
+}
+
+// Dropped returns the number of messages dropped for a full queue
+func (s *SQLiteStore) Dropped() int64 {
+	return s.batcher.Dropped()
+}
+
+// Ping checks the database answers
+func (s *SQLiteStore) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), storagePingTimeout)
+	defer cancel()
+
+	return s.db.PingContext(ctx)
+}
+
+// Close writes the messages still held and closes the database
+func (s *SQLiteStore) Close() error {
+	s.batcher.close()
+	return s.db.Close()
+}
+
+// AppendBatch writes messages at once rather than holding them for the worker,
+// so imports larger than the queue aren't dropped
+func (s *SQLiteStore) AppendBatch(messages []ChatMessage) error {
+	return s.batcher.writeNow(messages)
+}
+
+// insert writes a batch of messages in one transaction
+func (s *SQLiteStore) insert(batch []ChatMessage) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insert, err := tx.Prepare(
+		`INSERT INTO messages (stream_key, seq, id, user_id, username, message, timestamp, origin_system, origin_id)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+	)
+	if err != nil {
+		return err
+	}
+	defer insert.Close()
+
+	for _, msg := range batch {
+		var originSystem, originID sql.NullString
+		if msg.Origin != nil {
+			originSystem = sql.NullString{String: msg.Origin.System, Valid: true}
+			originID = sql.NullString{String: msg.Origin.ID, Valid: true}
+		}
+		if _, err := insert.Exec(msg.StreamKey, msg.Seq, msg.ID, msg.UserID, msg.Username, msg.Message, msg.Timestamp.UnixNano(), originSystem, originID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SaveRoom records a room's state
+func (s *SQLiteStore) SaveRoom(room SavedRoom) error {
+	state, err := json.Marshal(room)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO rooms (stream_key, state) VALUES (?, ?)
+		 ON CONFLICT (stream_key) DO UPDATE SET state = excluded.state`,
+		room.StreamKey, string(state),
+	)
+	return err
+}
+
+// DeleteRoom forgets a room's state
+func (s *SQLiteStore) DeleteRoom(streamKey string) error {
+	_, err := s.db.Exec(`DELETE FROM rooms WHERE stream_key = ?`, streamKey)
+	return err
+}
+
+// LoadRooms returns every saved room's state
+func (s *SQLiteStore) LoadRooms() ([]SavedRoom, error) {
+	return loadSaved[SavedRoom](s.db, `SELECT state FROM rooms`)
+}
+
+// SaveTimeout records a user's timeout
+func (s *SQLiteStore) SaveTimeout(timeout SavedTimeout) error {
+	state, err := json.Marshal(timeout)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO timeouts (user_id, state) VALUES (?, ?)
+		 ON CONFLICT (user_id) DO UPDATE SET state = excluded.state`,
+		timeout.UserID, string(state),
+	)
+	return err
+}
+
+// DeleteTimeout forgets a user's timeout
+func (s *SQLiteStore) DeleteTimeout(userID string) error {
+	_, err := s.db.Exec(`DELETE FROM timeouts WHERE user_id = ?`, userID)
+	return err
+}
+
+// LoadTimeouts returns every saved timeout
+func (s *SQLiteStore) LoadTimeouts() ([]SavedTimeout, error) {
+	return loadSaved[SavedTimeout](s.db, `SELECT state FROM timeouts`)
+}
+
+// SaveProfile records a user's profile
+func (s *SQLiteStore) SaveProfile(profile UserProfile) error {
+	state, err := json.Marshal(profile)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(
+		`INSERT INTO profiles (user_id, state) VALUES (?, ?)
+		 ON CONFLICT (user_id) DO UPDATE SET state = excluded.state`,
+		profile.UserID, string(state),
+	)
+	return err
+}
+
+// LoadProfile returns a user's profile, if one was saved
+func (s *SQLiteStore) LoadProfile(userID string) (UserProfile, bool, error) {
+	profiles, err := loadSaved[UserProfile](s.db, `SELECT state FROM profiles WHERE user_id = ?`, userID)
+	if err != nil || len(profiles) == 0 {
+		return UserProfile{}, false, err
+	}
+	return profiles[0], true, nil
+}
+
+// DeleteProfile forgets a user's profile
+func (s *SQLiteStore) DeleteProfile(userID string) error {
+	_, err := s.db.Exec(`DELETE FROM profiles WHERE user_id = ?`, userID)
+	return err
+}
+
+// loadSaved decodes the JSON states a query selects, skipping any that can't be
+// read
+func loadSaved[T any](db *sql.DB, query string, args ...interface{}) ([]T, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	saved := []T{}
+	for rows.Next() {
+		var state string
+		if err := rows.Scan(&state); err != nil {
+			return nil, err
+		}
+		var value T
+		if err := json.Unmarshal([]byte(state), &value); err != nil {
+			log.Printf("Skipping unreadable saved chat state: %v", err)
+			continue
+		}
+		saved = append(saved, value)
+	}
+	return saved, rows.Err()
+}
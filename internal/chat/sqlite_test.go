@@ -0,0 +1,173 @@
+package chat
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSQLiteStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.db")
+	store, err := NewSQLiteStore(path, DefaultWriteBatching())
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, store.Append(ChatMessage{ID: "a", StreamKey: "room", UserID: "u1", Username: "alice", Message: "old", Seq: 1, Timestamp: now.Add(-time.Hour)}))
+	require.NoError(t, store.Append(ChatMessage{ID: "b", StreamKey: "room", UserID: "u2", Username: "bob", Message: "hi", Seq: 2, Timestamp: now, Origin: &MessageOrigin{System: "irc", ID: "7"}}))
+	require.NoError(t, store.Append(ChatMessage{ID: "c", StreamKey: "room", Seq: 3, Timestamp: now}))
+	require.NoError(t, store.Append(ChatMessage{ID: "other", StreamKey: "other", Seq: 1, Timestamp: now}))
+
+	// Reads see messages still held for the next batch
+	messages, err := store.Range("room", 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c"}, messageIDs(messages))
+	require.Equal(t, "bob", messages[0].Username)
+	require.Equal(t, &MessageOrigin{System: "irc", ID: "7"}, messages[0].Origin)
+	require.True(t, now.Equal(messages[0].Timestamp))
+	require.Nil(t, messages[1].Origin)
+
+	messages, err = store.Range("room", 0, 1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, messageIDs(messages))
+
+	removed, err := store.DeleteBefore("room", now.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+	deleted, err := store.DeleteByID("room", "c")
+	require.NoError(t, err)
+	require.True(t, deleted)
+
+	require.NoError(t, store.Append(ChatMessage{ID: "d", StreamKey: "room", Seq: 4, Timestamp: now}))
+	require.NoError(t, store.Close())
+
+	// History survives reopening the database
+	store, err = NewSQLiteStore(path, DefaultWriteBatching())
+	require.NoError(t, err)
+	defer store.Close()
+
+	messages, err = store.Range("room", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "d"}, messageIDs(messages))
+}
+
+func TestSQLiteStoreWritesInBatches(t *testing.T) {
+	batching := DefaultWriteBatching()
+	batching.FlushInterval = time.Hour
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "chat.db"), batching)
+	require.NoError(t, err)
+	defer store.Close()
+
+	for i := 0; i < batching.BatchSize; i++ {
+		require.NoError(t, store.Append(ChatMessage{ID: "m", StreamKey: "room", Seq: int64(i + 1), Timestamp: time.Now()}))
+	}
+
+	// A full batch is written without waiting for a read to force it
+	require.Eventually(t, func() bool { return store.Pending() == 0 }, time.Second, 10*time.Millisecond)
+
+	var count int
+	require.NoError(t, store.db.QueryRow(`SELECT COUNT(*) FROM messages`).Scan(&count))
+	require.Equal(t, batching.BatchSize, count)
+}
+
+func TestSQLiteStoreKeepsProfiles(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "chat.db"), DefaultWriteBatching())
+	require.NoError(t, err)
+	defer store.Close()
+
+	_, exists, err := store.LoadProfile("alice")
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	profile := UserProfile{UserID: "alice", Color: "#123456", Badges: []string{"vip"}}
+	require.NoError(t, store.SaveProfile(profile))
+	loaded, exists, err := store.LoadProfile("alice")
+	require.NoError(t, err)
+	require.True(t, exists)
+	require.Equal(t, profile.Badges, loaded.Badges)
+	require.Equal(t, profile.Color, loaded.Color)
+
+	require.NoError(t, store.DeleteProfile("alice"))
+	_, exists, err = store.LoadProfile("alice")
+	require.NoError(t, err)
+	require.False(t, exists)
+}
+
+func TestSQLiteStoreKeepsTombstones(t *testing.T) {
+	store, err := NewSQLiteStore(filepath.Join(t.TempDir(), "chat.db"), DefaultWriteBatching())
+	require.NoError(t, err)
+	defer store.Close()
+
+	now := time.Now()
+	require.NoError(t, store.Append(ChatMessage{ID: "a", StreamKey: "room", UserID: "alice", Seq: 1, Timestamp: now.Add(-time.Hour)}))
+	require.NoError(t, store.Append(ChatMessage{ID: "b", StreamKey: "room", UserID: "bob", Seq: 2, Timestamp: now}))
+	require.NoError(t, store.AppendTombstone(Tombstone{StreamKey: "room", MessageID: "a", Type: TombstoneEdited, Message: "edited", Timestamp: now}))
+	require.NoError(t, store.AppendTombstone(Tombstone{StreamKey: "room", MessageID: "b", Type: TombstoneDeleted, ByUserID: "mod", Timestamp: now}))
+
+	tombstones, err := store.Tombstones("room")
+	require.NoError(t, err)
+	require.Len(t, tombstones, 2)
+	require.Equal(t, "edited", tombstones[0].Message)
+	require.Equal(t, "mod", tombstones[1].ByUserID)
+
+	// The messages themselves are kept as they were sent
+	messages, err := store.Range("room", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, messageIDs(messages))
+
+	// Erasing a user takes the tombstones of their messages along
+	_, err = store.EraseUser("bob")
+	require.NoError(t, err)
+	tombstones, err = store.Tombstones("room")
+	require.NoError(t, err)
+	require.Len(t, tombstones, 1)
+
+	// So does compaction, once their messages expire
+	_, _, err = store.Compact(now.Add(-time.Minute))
+	require.NoError(t, err)
+	tombstones, err = store.Tombstones("room")
+	require.NoError(t, err)
+	require.Empty(t, tombstones)
+}
+
+func TestRestoreRoomsAfterRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat.db")
+	store, err := NewSQLiteStore(path, DefaultWriteBatching())
+	require.NoError(t, err)
+
+	manager := NewManager(DefaultConfig())
+	manager.SetMessageStore(store)
+	for _, text := range []string{"one", "two", "three"} {
+		_, err := manager.AddMessage("stream", "user", "alice", text)
+		require.NoError(t, err)
+	}
+	room, _ := manager.GetRoom("stream")
+	room.SetModes(RoomModes{SlowModeSeconds: 10})
+	room.saveState()
+	startedAt := room.startedAt
+	manager.Stop()
+	require.NoError(t, store.Close())
+
+	// A fresh instance on the same database picks up where the last one stopped
+	store, err = NewSQLiteStore(path, DefaultWriteBatching())
+	require.NoError(t, err)
+	defer store.Close()
+
+	manager = NewManager(DefaultConfig())
+	defer manager.Stop()
+	manager.SetMessageStore(store)
+	restored, err := manager.Restore()
+	require.NoError(t, err)
+	require.Equal(t, 1, restored)
+
+	room, exists := manager.GetRoom("stream")
+	require.True(t, exists)
+	require.Equal(t, RoomModes{SlowModeSeconds: 10}, room.Modes())
+	require.True(t, startedAt.Equal(room.startedAt))
+	require.Equal(t, []string{"one", "two", "three"}, messageTexts(room.GetMessages(0)))
+
+	msg, err := manager.AddMessage("stream", "user", "alice", "four")
+	require.NoError(t, err)
+	require.Equal(t, int64(4), msg.Seq)
+}
@@ -0,0 +1,148 @@
+package chat
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const sseKeepAliveInterval = 30 * time.Second
+
+// subscribe registers a read-only feed for a room's broadcasts. The feed is closed
+// if the streamer turns chat off; while it is off, subscribing fails with
+// ErrChatDisabled.
+func (h *WSHandler) subscribe(streamKey string) (chan WSMessage, *ChatError) {
+	sub := make(chan WSMessage, 256)
+
+	h.subMux.Lock()
+	defer h.subMux.Unlock()
+
+	// Checked under the lock so a feed can't slip in as chat is being turned off
+	if !h.manager.settings.get(streamKey).ChatEnabled {
+		return nil, ErrChatDisabled
+	}
+	if h.subscribers[streamKey] == nil {
+		h.subscribers[streamKey] = make(map[chan WSMessage]struct{})
+	}
+	h.subscribers[streamKey][sub] = struct{}{}
+	h.touchViewerCount(streamKey)
+
+	return sub, nil
+}
+
+// unsubscribe removes a read-only feed from a room
+func (h *WSHandler) unsubscribe(streamKey string, sub chan WSMessage) {
+	h.subMux.Lock()
+	defer h.subMux.Unlock()
+
+	delete(h.subscribers[streamKey], sub)
+	if len(h.subscribers[streamKey]) == 0 {
+		delete(h.subscribers, streamKey)
+	}
+	h.touchViewerCount(streamKey)
+}
+
+// closeSubscribers ends every read-only feed of a room
+func (h *WSHandler) closeSubscribers(streamKey string) int {
+	h.subMux.Lock()
+	defer h.subMux.Unlock()
+
+	closed := len(h.subscribers[streamKey])
+	for sub := range h.subscribers[streamKey] {
+		close(sub)
+	}
+	delete(h.subscribers, streamKey)
+	h.touchViewerCount(streamKey)
+	return closed
+}
+
+// EventsHandler serves GET /api/chat/{streamKey}/events, streaming a room's
+// broadcasts as Server-Sent Events. Pass ?history=N to start with recent messages.
+func (h *WSHandler) EventsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	ip := h.clientIP(r)
+	if err := h.admit(ip); err != nil {
+		writeChatError(w, admissionStatus(err), err)
+		return
+	}
+	defer h.releaseConnection(ip)
+
+	// Subscribe before reading history so no message falls between the two
+	sub, chatErr := h.subscribe(streamKey)
+	if chatErr != nil {
+		writeChatError(w, http.StatusForbidden, chatErr)
+		return
+	}
+	defer h.unsubscribe(streamKey, sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if historyN, err := strconv.Atoi(r.URL.Query().Get("history")); err == nil && historyN > 0 && h.checkHistoryRead(r, streamKey) == nil {
+		messages := h.manager.GetMessages(streamKey, min(historyN, maxPageSize))
+		if err := h.writeSSEEvent(w, WSMessage{Type: "history", Data: messages, Timestamp: time.Now()}); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(sseKeepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case msg, ok := <-sub:
+			if !ok {
+				// Chat was turned off
+				h.writeSSEEvent(w, WSMessage{Type: "error", Error: ErrChatDisabled.Message, Code: ErrChatDisabled.Code, Timestamp: time.Now()})
+				flusher.Flush()
+				return
+			}
+			if err := h.writeSSEEvent(w, msg); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeSSEEvent writes a message as a single SSE event named after its type
+func (h *WSHandler) writeSSEEvent(w http.ResponseWriter, msg WSMessage) error {
+	payload, err := marshal(h.codec, msg)
+	if err != nil {
+		log.Printf("Failed to encode chat event: %v", err)
+		return nil
+	}
+
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", msg.Type, payload)
+	return err
+}
@@ -0,0 +1,278 @@
+package chat
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	storagePingTimeout  = 5 * time.Second
+	storageHealthWindow = 20 // checks the error rate is taken over
+)
+
+// Storage backend roles, as named in StorageHealth
+const (
+	storageMessages = "messages" // the MessageStore
+	storageHistory  = "history"  // the HistoryStore
+)
+
+// HealthChecker is implemented by storage backends that can check they are
+// reachable. Backends without it, such as MemoryStore, are taken to be healthy.
+type HealthChecker interface {
+	Ping() error
+}
+
+// queueReporter is implemented by storage backends that queue writes
+type queueReporter interface {
+	Pending() int
+}
+
+// dropReporter is implemented by storage backends that drop writes when their
+// queue is full
+type dropReporter interface {
+	Dropped() int64
+}
+
+// BackendHealth describes how one storage backend has answered health checks
+type BackendHealth struct {
+	Name                string    `json:"name"`    // storageMessages or storageHistory
+	Backend             string    `json:"backend"` // e.g. SQLiteStore
+	Healthy             bool      `json:"healthy"` // false while chat runs without it
+	LatencyMs           float64   `json:"latencyMs"`
+	ErrorRate           float64   `json:"errorRate"`     // share of the latest checks that failed
+	QueueDepth          int       `json:"queueDepth"`    // writes waiting to be made
+	DroppedWrites       int64     `json:"droppedWrites"` // since start, for a full queue
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	LastError           string    `json:"lastError,omitempty"`
+	CheckedAt           time.Time `json:"checkedAt,omitempty"`
+}
+
+// storageMonitor keeps the outcome of each backend's health checks
+type storageMonitor struct {
+	mu       sync.RWMutex
+	backends map[string]*backendMonitor // by role
+}
+
+// backendMonitor is one backend's check history
+type backendMonitor struct {
+	health BackendHealth
+	recent []bool // outcomes of the latest checks, true for failures
+}
+
+// newStorageMonitor creates a monitor with every backend healthy
+func newStorageMonitor() *storageMonitor {
+	return &storageMonitor{backends: make(map[string]*backendMonitor)}
+}
+
+// reset forgets a role's checks, when its backend is replaced
+func (sm *storageMonitor) reset(role string) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	delete(sm.backends, role)
+}
+
+// down reports whether a role's backend has failed enough checks to go unused
+func (sm *storageMonitor) down(role string) bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	backend, ok := sm.backends[role]
+	return ok && !backend.health.Healthy
+}
+
+// get returns a role's latest health, healthy if it was never checked
+func (sm *storageMonitor) get(role string) BackendHealth {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if backend, ok := sm.backends[role]; ok {
+		return backend.health
+	}
+	return BackendHealth{Name: role, Healthy: true}
+}
+
+// record notes a check's outcome, returning whether it took the backend down or
+// brought it back. threshold failures in a row take a backend down; one success
+// brings it back.
+func (sm *storageMonitor) record(role string, latency time.Duration, err error, threshold int) (wentDown, cameBack bool) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	backend, ok := sm.backends[role]
+	if !ok {
+		backend = &backendMonitor{health: BackendHealth{Name: role, Healthy: true}}
+		sm.backends[role] = backend
+	}
+
+	backend.recent = append(backend.recent, err != nil)
+	if len(backend.recent) > storageHealthWindow {
+		backend.recent = backend.recent[1:]
+	}
+	failures := 0
+	for _, failed := range backend.recent {
+		if failed {
+			failures++
+		}
+	}
+
+	health := &backend.health
+	health.LatencyMs = float64(latency.Microseconds()) / 1000
+	health.ErrorRate = float64(failures) / float64(len(backend.recent))
+	health.CheckedAt = time.Now()
+	if err == nil {
+		health.ConsecutiveFailures = 0
+		health.LastError = ""
+		cameBack = !health.Healthy
+		health.Healthy = true
+		return false, cameBack
+	}
+
+	health.ConsecutiveFailures++
+	health.LastError = err.Error()
+	if health.Healthy && health.ConsecutiveFailures >= max(threshold, 1) {
+		health.Healthy = false
+		return true, false
+	}
+	return false, false
+}
+
+// storageBackend is an installed store and the role it has
+type storageBackend struct {
+	role  string
+	store interface{}
+}
+
+// storageBackends returns the installed stores, whether or not they are healthy
+func (m *Manager) storageBackends() []storageBackend {
+	m.hooksMux.RLock()
+	defer m.hooksMux.RUnlock()
+
+	backends := []storageBackend{}
+	if m.messageStore != nil {
+		backends = append(backends, storageBackend{storageMessages, m.messageStore})
+	}
+	if m.historyStore != nil {
+		backends = append(backends, storageBackend{storageHistory, m.historyStore})
+	}
+	return backends
+}
+
+// StorageHealth returns the health of each installed storage backend
+func (m *Manager) StorageHealth() []BackendHealth {
+	backends := m.storageBackends()
+
+	health := make([]BackendHealth, 0, len(backends))
+	for _, backend := range backends {
+		h := m.storage.get(backend.role)
+		h.Backend = backendName(backend.store)
+		if queue, ok := backend.store.(queueReporter); ok {
+			h.QueueDepth = queue.Pending()
+		}
+		if drops, ok := backend.store.(dropReporter); ok {
+			h.DroppedWrites = drops.Dropped()
+		}
+		health = append(health, h)
+	}
+	return health
+}
+
+// StorageHealthy reports whether every installed storage backend is in use
+func (m *Manager) StorageHealthy() bool {
+	for _, backend := range m.storageBackends() {
+		if m.storage.down(backend.role) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckStorage pings each installed storage backend once. A backend failing
+// StorageFailureThreshold checks in a row is set aside, and chat carries on from
+// memory alone, until a check succeeds again.
+func (m *Manager) CheckStorage() {
+	for _, backend := range m.storageBackends() {
+		start := time.Now()
+		var err error
+		if checker, ok := backend.store.(HealthChecker); ok {
+			err = checker.Ping()
+		}
+
+		wentDown, cameBack := m.storage.record(backend.role, time.Since(start), err, m.config.StorageFailureThreshold)
+		switch {
+		case wentDown:
+			log.Printf("WARNING: chat %s store %s is down (%v); falling back to memory-only mode", backend.role, backendName(backend.store), err)
+			if backend.role == storageMessages {
+				m.attachRoomStores(nil)
+			}
+		case cameBack:
+			log.Printf("Chat %s store %s recovered", backend.role, backendName(backend.store))
+			if store, ok := backend.store.(MessageStore); ok && backend.role == storageMessages {
+				m.attachRoomStores(store)
+			}
+		}
+	}
+}
+
+// attachRoomStores points every live room at store, or at none when it is nil
+func (m *Manager) attachRoomStores(store MessageStore) {
+	for _, room := range m.liveRooms() {
+		room.SetStore(store)
+	}
+}
+
+// storageHealthWorker checks the storage backends every StorageCheckIntervalSeconds
+func (m *Manager) storageHealthWorker() {
+	defer trackWorker("manager.storage")()
+
+	ticker := time.NewTicker(time.Duration(m.config.StorageCheckIntervalSeconds) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.CheckStorage()
+		case <-m.stopStorage:
+			return
+		}
+	}
+}
+
+// backendName names a store by its type, e.g. SQLiteStore
+func backendName(store interface{}) string {
+	name := fmt.Sprintf("%T", store)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// ReadyResponse is the body of a readiness check
+type ReadyResponse struct {
+	Ready    bool            `json:"ready"`
+	Draining bool            `json:"draining"`
+	Storage  []BackendHealth `json:"storage"`
+}
+
+// ReadyHandler serves GET /api/chat/ready for readiness probes. It answers 503
+// while connections are being drained or a storage backend is down, and 200
+// otherwise, listing each backend's health either way.
+func (h *WSHandler) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	response := ReadyResponse{
+		Draining: h.Draining(),
+		Storage:  h.manager.StorageHealth(),
+	}
+	response.Ready = !response.Draining && h.manager.StorageHealthy()
+
+	status := http.StatusOK
+	if !response.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	writeJSON(w, status, response)
+}
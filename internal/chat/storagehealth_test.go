@@ -0,0 +1,101 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// flakyStore is a MemoryStore whose health checks fail on demand
+type flakyStore struct {
+	*MemoryStore
+	failing atomic.Bool
+}
+
+func (s *flakyStore) Ping() error {
+	if s.failing.Load() {
+		return errors.New("connection refused")
+	}
+	return nil
+}
+
+func TestStorageFallsBackToMemoryWhileDown(t *testing.T) {
+	config := DefaultConfig()
+	config.StorageCheckIntervalSeconds = 0
+	config.StorageFailureThreshold = 2
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+
+	store := &flakyStore{MemoryStore: NewMemoryStore()}
+	manager.SetMessageStore(store)
+	_, err := manager.AddMessage("room", "alice", "alice", "stored")
+	require.NoError(t, err)
+
+	store.failing.Store(true)
+	manager.CheckStorage()
+	require.True(t, manager.StorageHealthy(), "one failed check isn't enough")
+
+	manager.CheckStorage()
+	require.False(t, manager.StorageHealthy())
+	health := manager.StorageHealth()
+	require.Len(t, health, 1)
+	require.Equal(t, "flakyStore", health[0].Backend)
+	require.False(t, health[0].Healthy)
+	require.Equal(t, 1.0, health[0].ErrorRate)
+	require.Equal(t, "connection refused", health[0].LastError)
+
+	// Chat carries on without the store
+	_, err = manager.AddMessage("room", "alice", "alice", "unstored")
+	require.NoError(t, err)
+	require.Len(t, manager.GetMessages("room", 0), 2)
+	messages, err := store.Range("room", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"stored"}, messageTexts(messages))
+
+	store.failing.Store(false)
+	manager.CheckStorage()
+	require.True(t, manager.StorageHealthy())
+	health = manager.StorageHealth()
+	require.Equal(t, 2.0/3, health[0].ErrorRate)
+	require.Zero(t, health[0].ConsecutiveFailures)
+
+	_, err = manager.AddMessage("room", "alice", "alice", "stored again")
+	require.NoError(t, err)
+	messages, err = store.Range("room", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"stored", "stored again"}, messageTexts(messages))
+}
+
+func TestReadyHandler(t *testing.T) {
+	h, _ := newTestHandler(t)
+	store := &flakyStore{MemoryStore: NewMemoryStore()}
+	h.manager.SetMessageStore(store)
+
+	ready := func() (int, ReadyResponse) {
+		w := httptest.NewRecorder()
+		h.ReadyHandler(w, httptest.NewRequest(http.MethodGet, "/api/chat/ready", nil))
+		var response ReadyResponse
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return w.Code, response
+	}
+
+	code, response := ready()
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, response.Ready)
+	require.Len(t, response.Storage, 1)
+	require.Equal(t, storageMessages, response.Storage[0].Name)
+
+	store.failing.Store(true)
+	for i := 0; i < h.manager.config.StorageFailureThreshold; i++ {
+		h.manager.CheckStorage()
+	}
+	code, response = ready()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.False(t, response.Ready)
+	require.False(t, response.Storage[0].Healthy)
+}
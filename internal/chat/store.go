@@ -0,0 +1,423 @@
+package chat
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// MessageStore persists rooms' messages behind their in-memory buffers. Rooms
+// write every message through to it and read from it when their buffer no longer
+// holds what a client asks for, so persistence backends plug in here without the
+// Manager or WebSocket layers knowing about them.
+type MessageStore interface {
+	// Append adds a numbered message to the end of its room's history
+	Append(msg ChatMessage) error
+	// Range returns up to limit of a room's messages numbered after afterSeq,
+	// oldest first. A limit of 0 returns all of them.
+	Range(streamKey string, afterSeq int64, limit int) ([]ChatMessage, error)
+	// DeleteBefore removes a room's messages older than cutoff, returning how many
+	// were removed
+	DeleteBefore(streamKey string, cutoff time.Time) (int, error)
+	// DeleteByID removes one of a room's messages, reporting whether it was stored
+	DeleteByID(streamKey, id string) (bool, error)
+}
+
+// SetMessageStore persists rooms' messages through store. Rooms created from then
+// on write to it; existing rooms keep what they were created with.
+func (m *Manager) SetMessageStore(store MessageStore) {
+	m.hooksMux.Lock()
+	defer m.hooksMux.Unlock()
+
+	m.messageStore = store
+	m.storage.reset(storageMessages)
+}
+
+// persistence returns the installed message store, or nil when there is none or
+// health checks found it down
+func (m *Manager) persistence() MessageStore {
+	m.hooksMux.RLock()
+	defer m.hooksMux.RUnlock()
+
+	if m.storage.down(storageMessages) {
+		return nil
+	}
+	return m.messageStore
+}
+
+// SetStore persists the room's messages through store, or stops persisting them
+// when it is nil. Messages already buffered aren't copied to it.
+func (cr *ChatRoom) SetStore(store MessageStore) {
+	cr.MessagesMux.Lock()
+	defer cr.MessagesMux.Unlock()
+
+	cr.store = store
+}
+
+// persist writes a numbered message through to the room's store, if any. Callers
+// must hold MessagesMux, which keeps the store's order the same as the buffer's.
+func (cr *ChatRoom) persist(msg ChatMessage) {
+	if cr.store == nil {
+		return
+	}
+	if err := cr.store.Append(msg); err != nil {
+		log.Printf("Failed to persist chat message for %s: %v", cr.StreamKey, err)
+	}
+}
+
+// storedAfter reads up to limit of the messages numbered after seq, up to lastSeq,
+// from the room's store. ok is false without a store, when it fails, or when it is
+// missing some of them too.
+func (cr *ChatRoom) storedAfter(seq, lastSeq int64, limit int) (messages []ChatMessage, ok bool) {
+	if cr.store == nil {
+		return nil, false
+	}
+
+	messages, err := cr.store.Range(cr.StreamKey, seq, limit)
+	if err != nil {
+		log.Printf("Failed to read persisted chat messages for %s: %v", cr.StreamKey, err)
+		return nil, false
+	}
+	complete := int64(len(messages)) == min(lastSeq-seq, int64(limit))
+
+	fates, err := roomTombstones(cr.store, cr.StreamKey)
+	if err != nil {
+		log.Printf("Failed to read chat tombstones for %s: %v", cr.StreamKey, err)
+		return nil, false
+	}
+	return applyTombstones(messages, fates), complete
+}
+
+// storedSeq finds the number of a stored message by ID, searching back from the
+// messages numbered below below a page at a time. ok is false without a store,
+// when it fails, or when it doesn't have the message.
+func (cr *ChatRoom) storedSeq(id string, below int64) (seq int64, ok bool) {
+	if cr.store == nil {
+		return 0, false
+	}
+
+	for before := below - 1; before > 0; before -= maxPageSize {
+		after := max(before-maxPageSize, 0)
+		messages, err := cr.store.Range(cr.StreamKey, after, int(before-after))
+		if err != nil {
+			log.Printf("Failed to read persisted chat messages for %s: %v", cr.StreamKey, err)
+			return 0, false
+		}
+		for _, msg := range messages {
+			if msg.ID == id && msg.Seq < below {
+				return msg.Seq, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// storedBefore reads up to limit of the messages numbered below below from the
+// room's store, oldest first. hasMore reports whether the store holds older ones
+// still. ok is false without a store or when it fails.
+func (cr *ChatRoom) storedBefore(below int64, limit int) (messages []ChatMessage, hasMore bool, ok bool) {
+	if cr.store == nil {
+		return nil, false, false
+	}
+	if limit <= 0 {
+		return []ChatMessage{}, true, true
+	}
+
+	first, err := cr.store.Range(cr.StreamKey, 0, 1)
+	if err != nil {
+		log.Printf("Failed to read persisted chat messages for %s: %v", cr.StreamKey, err)
+		return nil, false, false
+	}
+	if len(first) == 0 || first[0].Seq >= below {
+		return []ChatMessage{}, false, true
+	}
+
+	// Start no earlier than the oldest stored message, so retention doesn't leave
+	// the page short
+	after := max(below-1-int64(limit), first[0].Seq-1)
+	messages, err = cr.store.Range(cr.StreamKey, after, int(below-1-after))
+	if err != nil {
+		log.Printf("Failed to read persisted chat messages for %s: %v", cr.StreamKey, err)
+		return nil, false, false
+	}
+	messages = slices.DeleteFunc(messages, func(msg ChatMessage) bool { return msg.Seq >= below })
+
+	fates, err := roomTombstones(cr.store, cr.StreamKey)
+	if err != nil {
+		log.Printf("Failed to read chat tombstones for %s: %v", cr.StreamKey, err)
+		return nil, false, false
+	}
+	return applyTombstones(messages, fates), after >= first[0].Seq, true
+}
+
+// unpersistBefore removes the room's stored messages older than cutoff. Callers
+// must hold MessagesMux.
+func (cr *ChatRoom) unpersistBefore(cutoff time.Time) {
+	if cr.store == nil {
+		return
+	}
+	if _, err := cr.store.DeleteBefore(cr.StreamKey, cutoff); err != nil {
+		log.Printf("Failed to delete persisted chat messages for %s: %v", cr.StreamKey, err)
+	}
+}
+
+// MemoryStore is a MessageStore that keeps every room's messages in process
+// memory. It persists nothing across restarts; it serves as the reference
+// implementation for backends and keeps resume working past the buffers in tests.
+type MemoryStore struct {
+	rooms      map[string][]ChatMessage // stream key -> messages, oldest first
+	tombstones map[string][]Tombstone   // stream key -> tombstones, oldest first
+	saved      map[string]SavedRoom
+	timeouts   map[string]SavedTimeout // user ID -> timeout
+	profiles   map[string]UserProfile  // user ID -> profile
+	mu         sync.RWMutex
+}
+
+// NewMemoryStore creates an empty memory store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		rooms:      make(map[string][]ChatMessage),
+		tombstones: make(map[string][]Tombstone),
+		saved:      make(map[string]SavedRoom),
+		timeouts:   make(map[string]SavedTimeout),
+		profiles:   make(map[string]UserProfile),
+	}
+}
+
+// Append adds a message to the end of its room's history
+func (s *MemoryStore) Append(msg ChatMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rooms[msg.StreamKey] = append(s.rooms[msg.StreamKey], msg)
+	return nil
+}
+
+// Range returns up to limit of a room's messages numbered after afterSeq
+func (s *MemoryStore) Range(streamKey string, afterSeq int64, limit int) ([]ChatMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	result := []ChatMessage{}
+	for _, msg := range s.rooms[streamKey] {
+		if limit > 0 && len(result) == limit {
+			break
+		}
+		if msg.Seq > afterSeq {
+			result = append(result, msg)
+		}
+	}
+	return result, nil
+}
+
+// DeleteBefore removes a room's messages older than cutoff
+func (s *MemoryStore) DeleteBefore(streamKey string, cutoff time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := s.rooms[streamKey]
+	kept := messages[:0]
+	for _, msg := range messages {
+		if !msg.Timestamp.Before(cutoff) {
+			kept = append(kept, msg)
+		}
+	}
+	clear(messages[len(kept):])
+
+	if len(kept) == 0 {
+		delete(s.rooms, streamKey)
+	} else {
+		s.rooms[streamKey] = kept
+	}
+	return len(messages) - len(kept), nil
+}
+
+// Compact removes every room's messages older than cutoff
+func (s *MemoryStore) Compact(cutoff time.Time) (int, int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	var reclaimed int64
+	for streamKey, messages := range s.rooms {
+		kept := messages[:0]
+		for _, msg := range messages {
+			if msg.Timestamp.Before(cutoff) {
+				removed++
+				reclaimed += messageSize(msg)
+			} else {
+				kept = append(kept, msg)
+			}
+		}
+		clear(messages[len(kept):])
+
+		if len(kept) == 0 {
+			delete(s.rooms, streamKey)
+		} else {
+			s.rooms[streamKey] = kept
+		}
+	}
+	return removed, reclaimed, nil
+}
+
+// DeleteByID removes one of a room's messages
+func (s *MemoryStore) DeleteByID(streamKey, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	messages := s.rooms[streamKey]
+	for i, msg := range messages {
+		if msg.ID == id {
+			s.rooms[streamKey] = append(messages[:i], messages[i+1:]...)
+			messages[len(messages)-1] = ChatMessage{}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// UserMessages returns every message the user sent, in every room
+func (s *MemoryStore) UserMessages(userID string) ([]ChatMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	messages := []ChatMessage{}
+	for _, room := range s.rooms {
+		for _, msg := range room {
+			if msg.UserID == userID {
+				messages = append(messages, msg)
+			}
+		}
+	}
+	return messages, nil
+}
+
+// EraseUser removes every message the user sent
+func (s *MemoryStore) EraseUser(userID string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	removed := 0
+	for streamKey, messages := range s.rooms {
+		erased := make(map[string]bool)
+		for _, msg := range messages {
+			if msg.UserID == userID {
+				erased[msg.ID] = true
+			}
+		}
+		if len(erased) == 0 {
+			continue
+		}
+
+		// Edits are the user's words too, so the tombstones of their messages go with them
+		s.rooms[streamKey] = slices.DeleteFunc(messages, func(msg ChatMessage) bool { return erased[msg.ID] })
+		s.tombstones[streamKey] = slices.DeleteFunc(s.tombstones[streamKey], func(t Tombstone) bool { return erased[t.MessageID] })
+		removed += len(erased)
+	}
+	return removed, nil
+}
+
+// AppendTombstone records that a message was deleted or edited
+func (s *MemoryStore) AppendTombstone(tombstone Tombstone) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tombstones[tombstone.StreamKey] = append(s.tombstones[tombstone.StreamKey], tombstone)
+	return nil
+}
+
+// Tombstones returns a room's tombstones, oldest first
+func (s *MemoryStore) Tombstones(streamKey string) ([]Tombstone, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return slices.Clone(s.tombstones[streamKey]), nil
+}
+
+// SaveRoom records a room's state
+func (s *MemoryStore) SaveRoom(room SavedRoom) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.saved[room.StreamKey] = room
+	return nil
+}
+
+// DeleteRoom forgets a room's state
+func (s *MemoryStore) DeleteRoom(streamKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.saved, streamKey)
+	return nil
+}
+
+// LoadRooms returns every saved room's state
+func (s *MemoryStore) LoadRooms() ([]SavedRoom, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	rooms := make([]SavedRoom, 0, len(s.saved))
+	for _, room := range s.saved {
+		rooms = append(rooms, room)
+	}
+	return rooms, nil
+}
+
+// SaveTimeout records a user's timeout
+func (s *MemoryStore) SaveTimeout(timeout SavedTimeout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timeouts[timeout.UserID] = timeout
+	return nil
+}
+
+// DeleteTimeout forgets a user's timeout
+func (s *MemoryStore) DeleteTimeout(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.timeouts, userID)
+	return nil
+}
+
+// LoadTimeouts returns every saved timeout
+func (s *MemoryStore) LoadTimeouts() ([]SavedTimeout, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	timeouts := make([]SavedTimeout, 0, len(s.timeouts))
+	for _, timeout := range s.timeouts {
+		timeouts = append(timeouts, timeout)
+	}
+	return timeouts, nil
+}
+
+// SaveProfile records a user's profile
+func (s *MemoryStore) SaveProfile(profile UserProfile) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.profiles[profile.UserID] = profile
+	return nil
+}
+
+// LoadProfile returns a user's profile, if one was saved
+func (s *MemoryStore) LoadProfile(userID string) (UserProfile, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	profile, exists := s.profiles[userID]
+	return profile, exists, nil
+}
+
+// DeleteProfile forgets a user's profile
+func (s *MemoryStore) DeleteProfile(userID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.profiles, userID)
+	return nil
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStore(t *testing.T) {
+	store := NewMemoryStore()
+
+	now := time.Now()
+	for i, age := range []time.Duration{time.Hour, time.Minute, 0} {
+		require.NoError(t, store.Append(ChatMessage{ID: string(rune('a' + i)), StreamKey: "room", Seq: int64(i + 1), Timestamp: now.Add(-age)}))
+	}
+	require.NoError(t, store.Append(ChatMessage{ID: "other", StreamKey: "other", Seq: 1, Timestamp: now}))
+
+	messages, err := store.Range("room", 1, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b", "c"}, messageIDs(messages))
+	messages, err = store.Range("room", 0, 2)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b"}, messageIDs(messages))
+
+	removed, err := store.DeleteBefore("room", now.Add(-30*time.Minute))
+	require.NoError(t, err)
+	require.Equal(t, 1, removed)
+
+	deleted, err := store.DeleteByID("room", "c")
+	require.NoError(t, err)
+	require.True(t, deleted)
+	deleted, err = store.DeleteByID("room", "c")
+	require.NoError(t, err)
+	require.False(t, deleted)
+
+	messages, err = store.Range("room", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, messageIDs(messages))
+	messages, err = store.Range("other", 0, 0)
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+}
+
+func TestRoomResumesFromStoreAfterEviction(t *testing.T) {
+	config := DefaultConfig()
+	config.MinMessagesPerStream = 2
+	config.MaxMessagesPerStream = 2
+	manager := NewManager(config)
+	defer manager.Stop()
+
+	store := NewMemoryStore()
+	manager.SetMessageStore(store)
+
+	for _, text := range []string{"one", "two", "three", "four"} {
+		_, err := manager.AddMessage("stream", "user", "alice", text)
+		require.NoError(t, err)
+	}
+
+	// The buffer only holds the last two, but the store has the rest
+	room, _ := manager.GetRoom("stream")
+	messages, complete := room.GetMessagesAfter(1, maxPageSize)
+	require.True(t, complete)
+	require.Len(t, messages, 3)
+	require.Equal(t, "two", messages[0].Message)
+
+	// Replays are paged, oldest first
+	messages, complete = room.GetMessagesAfter(0, 2)
+	require.False(t, complete)
+	require.Equal(t, "one", messages[0].Message)
+	require.Equal(t, "two", messages[1].Message)
+
+	removed := room.ClearMessages()
+	require.Equal(t, 2, removed)
+	stored, err := store.Range("stream", 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, stored)
+
+	_, complete = room.GetMessagesAfter(1, maxPageSize)
+	require.False(t, complete)
+}
+
+func TestRoomPagesBackFromStoreAfterEviction(t *testing.T) {
+	config := DefaultConfig()
+	config.MinMessagesPerStream = 2
+	config.MaxMessagesPerStream = 2
+	manager := NewManager(config)
+	defer manager.Stop()
+	manager.SetMessageStore(NewMemoryStore())
+
+	var ids []string
+	for _, text := range []string{"one", "two", "three", "four", "five"} {
+		msg, err := manager.AddMessage("stream", "user", "alice", text)
+		require.NoError(t, err)
+		ids = append(ids, msg.ID)
+	}
+
+	// Pages reaching past the buffer are finished from the store
+	messages, hasMore, err := manager.GetMessagesBefore("stream", "", 3)
+	require.NoError(t, err)
+	require.True(t, hasMore)
+	require.Equal(t, ids[2:], messageIDs(messages))
+
+	// and cursors the buffer evicted are found there
+	messages, hasMore, err = manager.GetMessagesBefore("stream", ids[2], 5)
+	require.NoError(t, err)
+	require.False(t, hasMore)
+	require.Equal(t, ids[:2], messageIDs(messages))
+
+	_, _, err = manager.GetMessagesBefore("stream", "missing", 5)
+	require.ErrorIs(t, err, ErrCursorNotFound)
+}
@@ -0,0 +1,137 @@
+package chat
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const telemetryTimeout = 10 * time.Second
+
+// TelemetryReport is the anonymized usage an instance reports when telemetry is
+// enabled. It only carries totals and settings, never stream keys, users or messages.
+type TelemetryReport struct {
+	InstanceID      string          `json:"instanceId"` // random per process, not derived from the host
+	ProtocolVersion int             `json:"protocolVersion"`
+	Timestamp       time.Time       `json:"timestamp"`
+	IntervalSeconds int             `json:"intervalSeconds"` // time covered by the message counts
+	Rooms           int             `json:"rooms"`
+	Users           int             `json:"users"`
+	Connections     int             `json:"connections"`
+	Subscribers     int             `json:"subscribers"`
+	Messages        int64           `json:"messages"` // posted during the interval
+	MessagesPerMin  float64         `json:"messagesPerMinute"`
+	Features        map[string]bool `json:"features"`
+	Codec           string          `json:"codec"`
+	Bridges         int             `json:"bridges"`
+	Webhooks        int             `json:"webhooks"`
+}
+
+// telemetryReporter periodically posts usage reports to the configured endpoint
+type telemetryReporter struct {
+	url          string
+	instanceID   string
+	client       *http.Client
+	lastCount    int64
+	lastReported time.Time
+}
+
+// newTelemetryReporter creates a reporter posting to url
+func newTelemetryReporter(url string) *telemetryReporter {
+	return &telemetryReporter{
+		url:          url,
+		instanceID:   uuid.New().String(),
+		client:       &http.Client{Timeout: telemetryTimeout},
+		lastReported: time.Now(),
+	}
+}
+
+// telemetryReport builds the report for the interval since the last one
+func (h *WSHandler) telemetryReport(t *telemetryReporter) TelemetryReport {
+	config := h.manager.config
+	d := h.Diagnostics()
+
+	now := time.Now()
+	count := h.manager.messageCount.Load()
+	interval := now.Sub(t.lastReported)
+
+	report := TelemetryReport{
+		InstanceID:      t.instanceID,
+		ProtocolVersion: ProtocolVersion,
+		Timestamp:       now,
+		IntervalSeconds: int(interval.Seconds()),
+		Rooms:           d.Rooms,
+		Users:           d.Users,
+		Connections:     d.Connections,
+		Subscribers:     d.Subscribers,
+		Messages:        count - t.lastCount,
+		Features:        config.Features(),
+		Codec:           config.Codec,
+		Webhooks:        len(config.Webhooks),
+	}
+	if interval > 0 {
+		report.MessagesPerMin = float64(report.Messages) / interval.Minutes()
+	}
+
+	report.Features["compression"] = config.CompressionEnabled
+	report.Features["irc"] = config.IRCAddress != ""
+	report.Features["grpc"] = config.GRPCAddress != ""
+	report.Features["apiTokens"] = len(config.APITokens) > 0
+
+	h.bridges.mutex.RLock()
+	report.Bridges = len(h.bridges.bridges)
+	h.bridges.mutex.RUnlock()
+
+	return report
+}
+
+// send posts a report to the telemetry endpoint, starting the next interval once it
+// is accepted
+func (t *telemetryReporter) send(report TelemetryReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, t.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "broadcast-box-chat-telemetry")
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("telemetry endpoint responded %s", resp.Status)
+	}
+
+	t.lastCount += report.Messages
+	t.lastReported = report.Timestamp
+	return nil
+}
+
+// telemetryWorker reports usage every interval. Failed reports are logged and not
+// retried; the next report's counts cover the missed interval.
+func (h *WSHandler) telemetryWorker(url string, interval time.Duration) {
+	defer trackWorker("ws.telemetry")()
+
+	reporter := newTelemetryReporter(url)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := reporter.send(h.telemetryReport(reporter)); err != nil {
+			log.Printf("Failed to send chat telemetry: %v", err)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTelemetryReportIsAnonymized(t *testing.T) {
+	var fail atomic.Bool
+	bodies := make(chan []byte, 2)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	h, _ := newTestHandler(t)
+	require.NoError(t, h.manager.AddUser("secret-stream", "user-1", "alice"))
+	_, err := h.manager.AddMessage("secret-stream", "user-1", "alice", "hello")
+	require.NoError(t, err)
+
+	reporter := newTelemetryReporter(server.URL)
+	require.NoError(t, reporter.send(h.telemetryReport(reporter)))
+
+	body := <-bodies
+	for _, private := range []string{"secret-stream", "user-1", "alice", "hello"} {
+		require.False(t, strings.Contains(string(body), private), "report leaks %q", private)
+	}
+
+	var report TelemetryReport
+	require.NoError(t, json.Unmarshal(body, &report))
+	require.Equal(t, 1, report.Rooms)
+	require.Equal(t, 1, report.Users)
+	require.Equal(t, int64(1), report.Messages)
+	require.NotEmpty(t, report.InstanceID)
+
+	// A failed report's messages are counted in the next one
+	_, err = h.manager.AddMessage("secret-stream", "user-1", "alice", "again")
+	require.NoError(t, err)
+	fail.Store(true)
+	require.Error(t, reporter.send(h.telemetryReport(reporter)))
+
+	_, err = h.manager.AddMessage("secret-stream", "user-1", "alice", "and again")
+	require.NoError(t, err)
+	fail.Store(false)
+	require.NoError(t, reporter.send(h.telemetryReport(reporter)))
+
+	require.NoError(t, json.Unmarshal(<-bodies, &report))
+	require.Equal(t, int64(2), report.Messages)
+}
@@ -0,0 +1,604 @@
+package chat
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultTenant owns the rooms no tenant's prefix matches. Its messages stay in
+// the database configured for chat, and users' timeouts and profiles, which aren't
+// any one tenant's, are kept with them.
+const DefaultTenant = "default"
+
+var (
+	tenantNamePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+	errUnknownTenant     = errors.New("no such tenant")
+	errTenantUnsupported = errors.New("the tenant's store doesn't support this")
+)
+
+// Tenant is a set of rooms, those whose stream keys start with Prefix, whose
+// messages are stored apart from every other tenant's
+type Tenant struct {
+	Name   string `json:"name"`
+	Prefix string `json:"prefix"`
+}
+
+// ParseTenants reads tenants given as "name=prefix" entries. Names are lowercase
+// letters, digits and underscores, as they end up in file and schema names.
+func ParseTenants(entries []string) ([]Tenant, error) {
+	tenants := make([]Tenant, 0, len(entries))
+	seen := make(map[string]bool)
+	for _, entry := range entries {
+		name, prefix, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		switch {
+		case !ok || prefix == "":
+			return nil, fmt.Errorf("tenant %q must be given as name=prefix", entry)
+		case !tenantNamePattern.MatchString(name) || name == DefaultTenant:
+			return nil, fmt.Errorf("invalid tenant name %q", name)
+		case seen[name]:
+			return nil, fmt.Errorf("tenant %q is given twice", name)
+		}
+		seen[name] = true
+		tenants = append(tenants, Tenant{Name: name, Prefix: prefix})
+	}
+	return tenants, nil
+}
+
+// ClosableStore is a MessageStore holding resources that Close releases
+type ClosableStore interface {
+	MessageStore
+	Close() error
+}
+
+// TenantBackend keeps each tenant's messages in storage of their own, so one
+// tenant's can be backed up or deleted without touching the others'
+type TenantBackend interface {
+	// Open opens, creating if needed, a tenant's store
+	Open(tenant string) (ClosableStore, error)
+	// Location says where a tenant's messages are kept, for backing them up
+	Location(tenant string) string
+	// Remove deletes a tenant's storage, once its store is closed
+	Remove(tenant string) error
+}
+
+// SQLiteTenants keeps each tenant's messages in a database file next to Path,
+// named for the tenant: chat.db holds the default tenant's, chat.acme.db acme's
+type SQLiteTenants struct {
+	Path     string
+	Batching WriteBatching
+}
+
+// Open opens the tenant's database file
+func (st SQLiteTenants) Open(tenant string) (ClosableStore, error) {
+	return NewSQLiteStore(st.Location(tenant), st.Batching)
+}
+
+// Location returns the path of the tenant's database file
+func (st SQLiteTenants) Location(tenant string) string {
+	if tenant == DefaultTenant {
+		return st.Path
+	}
+	ext := filepath.Ext(st.Path)
+	return strings.TrimSuffix(st.Path, ext) + "." + tenant + ext
+}
+
+// Remove deletes the tenant's database file and its write-ahead log
+func (st SQLiteTenants) Remove(tenant string) error {
+	path := st.Location(tenant)
+	for _, file := range []string{path, path + "-wal", path + "-shm"} {
+		if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// PostgresTenants keeps each tenant's messages in a schema of the database at
+// URL, named chat_<tenant>; the default tenant's stay where URL puts them
+type PostgresTenants struct {
+	URL      string
+	Batching WriteBatching
+}
+
+// Open creates the tenant's schema if needed and connects to it
+func (pt PostgresTenants) Open(tenant string) (ClosableStore, error) {
+	if tenant == DefaultTenant {
+		return NewPostgresStore(pt.URL, pt.Batching)
+	}
+
+	tenantURL, err := url.Parse(pt.URL)
+	if err != nil {
+		return nil, err
+	}
+	if err := pt.exec(`CREATE SCHEMA IF NOT EXISTS ` + pt.Location(tenant)); err != nil {
+		return nil, fmt.Errorf("creating schema for tenant %s: %w", tenant, err)
+	}
+	query := tenantURL.Query()
+	query.Set("search_path", pt.Location(tenant))
+	tenantURL.RawQuery = query.Encode()
+	return NewPostgresStore(tenantURL.String(), pt.Batching)
+}
+
+// Location returns the name of the tenant's schema
+func (pt PostgresTenants) Location(tenant string) string {
+	if tenant == DefaultTenant {
+		return "public"
+	}
+	return "chat_" + tenant
+}
+
+// Remove drops the tenant's schema and everything in it
+func (pt PostgresTenants) Remove(tenant string) error {
+	if tenant == DefaultTenant {
+		return errors.New("the default tenant's messages can't be dropped")
+	}
+	return pt.exec(`DROP SCHEMA IF EXISTS ` + pt.Location(tenant) + ` CASCADE`)
+}
+
+// exec runs one statement on a connection of its own
+func (pt PostgresTenants) exec(statement string) error {
+	db, err := sql.Open("pgx", pt.URL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = db.Exec(statement)
+	return err
+}
+
+// TenantStore is a MessageStore giving each tenant a store of its own, opened
+// through a TenantBackend, and routing each room's messages to its tenant's by
+// stream key prefix. What isn't any room's, users' timeouts and profiles, is kept
+// in the default tenant's store.
+type TenantStore struct {
+	tenants []Tenant // longest prefix first
+	backend TenantBackend
+
+	mu     sync.RWMutex
+	stores map[string]ClosableStore // by tenant name
+}
+
+// NewTenantStore opens the store of every tenant and of the default tenant
+func NewTenantStore(tenants []Tenant, backend TenantBackend) (*TenantStore, error) {
+	ts := &TenantStore{
+		tenants: slices.Clone(tenants),
+		backend: backend,
+		stores:  make(map[string]ClosableStore),
+	}
+	sort.SliceStable(ts.tenants, func(i, j int) bool { return len(ts.tenants[i].Prefix) > len(ts.tenants[j].Prefix) })
+
+	for _, name := range append([]string{DefaultTenant}, ts.names()...) {
+		store, err := backend.Open(name)
+		if err != nil {
+			ts.Close()
+			return nil, fmt.Errorf("opening store of tenant %s: %w", name, err)
+		}
+		ts.stores[name] = store
+	}
+	return ts, nil
+}
+
+// names returns the configured tenants' names
+func (ts *TenantStore) names() []string {
+	names := make([]string, 0, len(ts.tenants))
+	for _, tenant := range ts.tenants {
+		names = append(names, tenant.Name)
+	}
+	return names
+}
+
+// TenantOf returns the name of the tenant a room belongs to
+func (ts *TenantStore) TenantOf(streamKey string) string {
+	for _, tenant := range ts.tenants {
+		if strings.HasPrefix(streamKey, tenant.Prefix) {
+			return tenant.Name
+		}
+	}
+	return DefaultTenant
+}
+
+// storeFor returns the store of the tenant a room belongs to
+func (ts *TenantStore) storeFor(streamKey string) ClosableStore {
+	return ts.store(ts.TenantOf(streamKey))
+}
+
+// store returns a tenant's store
+func (ts *TenantStore) store(tenant string) ClosableStore {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	return ts.stores[tenant]
+}
+
+// all returns every tenant's store, the default tenant's first
+func (ts *TenantStore) all() []ClosableStore {
+	ts.mu.RLock()
+	defer ts.mu.RUnlock()
+
+	stores := []ClosableStore{ts.stores[DefaultTenant]}
+	for _, name := range ts.names() {
+		stores = append(stores, ts.stores[name])
+	}
+	return stores
+}
+
+// tenantCapability returns a store as the optional interface T, or
+// errTenantUnsupported if the backend's stores don't implement it
+func tenantCapability[T any](store MessageStore) (T, error) {
+	capable, ok := store.(T)
+	if !ok {
+		return capable, errTenantUnsupported
+	}
+	return capable, nil
+}
+
+// Append adds a message to its tenant's store
+func (ts *TenantStore) Append(msg ChatMessage) error {
+	return ts.storeFor(msg.StreamKey).Append(msg)
+}
+
+// Range reads a room's messages from its tenant's store
+func (ts *TenantStore) Range(streamKey string, afterSeq int64, limit int) ([]ChatMessage, error) {
+	return ts.storeFor(streamKey).Range(streamKey, afterSeq, limit)
+}
+
+// DeleteBefore removes a room's old messages from its tenant's store
+func (ts *TenantStore) DeleteBefore(streamKey string, cutoff time.Time) (int, error) {
+	return ts.storeFor(streamKey).DeleteBefore(streamKey, cutoff)
+}
+
+// DeleteByID removes one of a room's messages from its tenant's store
+func (ts *TenantStore) DeleteByID(streamKey, id string) (bool, error) {
+	return ts.storeFor(streamKey).DeleteByID(streamKey, id)
+}
+
+// AppendBatch writes messages to their tenants' stores at once
+func (ts *TenantStore) AppendBatch(messages []ChatMessage) error {
+	byTenant := make(map[string][]ChatMessage)
+	for _, msg := range messages {
+		tenant := ts.TenantOf(msg.StreamKey)
+		byTenant[tenant] = append(byTenant[tenant], msg)
+	}
+
+	for tenant, batch := range byTenant {
+		batcher, err := tenantCapability[BatchAppender](ts.store(tenant))
+		if err != nil {
+			return err
+		}
+		if err := batcher.AppendBatch(batch); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search searches a room's messages in its tenant's store
+func (ts *TenantStore) Search(streamKey string, query SearchQuery) ([]ChatMessage, bool, error) {
+	searcher, err := tenantCapability[MessageSearcher](ts.storeFor(streamKey))
+	if err != nil {
+		return nil, false, err
+	}
+	return searcher.Search(streamKey, query)
+}
+
+// AppendTombstone records a deletion or edit in its room's tenant's store
+func (ts *TenantStore) AppendTombstone(tombstone Tombstone) error {
+	tombstones, err := tenantCapability[TombstoneStore](ts.storeFor(tombstone.StreamKey))
+	if err != nil {
+		return err
+	}
+	return tombstones.AppendTombstone(tombstone)
+}
+
+// Tombstones reads a room's tombstones from its tenant's store
+func (ts *TenantStore) Tombstones(streamKey string) ([]Tombstone, error) {
+	tombstones, err := tenantCapability[TombstoneStore](ts.storeFor(streamKey))
+	if err != nil {
+		return nil, err
+	}
+	return tombstones.Tombstones(streamKey)
+}
+
+// SaveRoom records a room's state in its tenant's store
+func (ts *TenantStore) SaveRoom(room SavedRoom) error {
+	rooms, err := tenantCapability[RoomStore](ts.storeFor(room.StreamKey))
+	if err != nil {
+		return err
+	}
+	return rooms.SaveRoom(room)
+}
+
+// DeleteRoom forgets a room's state in its tenant's store
+func (ts *TenantStore) DeleteRoom(streamKey string) error {
+	rooms, err := tenantCapability[RoomStore](ts.storeFor(streamKey))
+	if err != nil {
+		return err
+	}
+	return rooms.DeleteRoom(streamKey)
+}
+
+// LoadRooms returns the rooms saved in every tenant's store
+func (ts *TenantStore) LoadRooms() ([]SavedRoom, error) {
+	saved := []SavedRoom{}
+	for _, store := range ts.all() {
+		rooms, err := tenantCapability[RoomStore](store)
+		if err != nil {
+			return nil, err
+		}
+		loaded, err := rooms.LoadRooms()
+		if err != nil {
+			return nil, err
+		}
+		saved = append(saved, loaded...)
+	}
+	return saved, nil
+}
+
+// UserMessages returns the messages a user sent in every tenant's rooms, oldest first
+func (ts *TenantStore) UserMessages(userID string) ([]ChatMessage, error) {
+	messages := []ChatMessage{}
+	for _, store := range ts.all() {
+		reader, err := tenantCapability[UserMessageReader](store)
+		if err != nil {
+			return nil, err
+		}
+		sent, err := reader.UserMessages(userID)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, sent...)
+	}
+	sort.SliceStable(messages, func(i, j int) bool { return messages[i].Timestamp.Before(messages[j].Timestamp) })
+	return messages, nil
+}
+
+// EraseUser removes a user's messages from every tenant's store
+func (ts *TenantStore) EraseUser(userID string) (int, error) {
+	removed := 0
+	for _, store := range ts.all() {
+		eraser, err := tenantCapability[UserEraser](store)
+		if err != nil {
+			return removed, err
+		}
+		n, err := eraser.EraseUser(userID)
+		removed += n
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// Compact compacts every tenant's store
+func (ts *TenantStore) Compact(cutoff time.Time) (int, int64, error) {
+	removed, reclaimed := 0, int64(0)
+	for _, store := range ts.all() {
+		compactor, err := tenantCapability[Compactor](store)
+		if err != nil {
+			return removed, reclaimed, err
+		}
+		n, bytes, err := compactor.Compact(cutoff)
+		removed += n
+		reclaimed += bytes
+		if err != nil {
+			return removed, reclaimed, err
+		}
+	}
+	return removed, reclaimed, nil
+}
+
+// SaveTimeout records a user's timeout in the default tenant's store
+func (ts *TenantStore) SaveTimeout(timeout SavedTimeout) error {
+	timeouts, err := tenantCapability[TimeoutStore](ts.store(DefaultTenant))
+	if err != nil {
+		return err
+	}
+	return timeouts.SaveTimeout(timeout)
+}
+
+// DeleteTimeout forgets a user's timeout in the default tenant's store
+func (ts *TenantStore) DeleteTimeout(userID string) error {
+	timeouts, err := tenantCapability[TimeoutStore](ts.store(DefaultTenant))
+	if err != nil {
+		return err
+	}
+	return timeouts.DeleteTimeout(userID)
+}
+
+// LoadTimeouts returns the timeouts saved in the default tenant's store
+func (ts *TenantStore) LoadTimeouts() ([]SavedTimeout, error) {
+	timeouts, err := tenantCapability[TimeoutStore](ts.store(DefaultTenant))
+	if err != nil {
+		return nil, err
+	}
+	return timeouts.LoadTimeouts()
+}
+
+// SaveProfile records a user's profile in the default tenant's store
+func (ts *TenantStore) SaveProfile(profile UserProfile) error {
+	profiles, err := tenantCapability[ProfileStore](ts.store(DefaultTenant))
+	if err != nil {
+		return err
+	}
+	return profiles.SaveProfile(profile)
+}
+
+// LoadProfile reads a user's profile from the default tenant's store
+func (ts *TenantStore) LoadProfile(userID string) (UserProfile, bool, error) {
+	profiles, err := tenantCapability[ProfileStore](ts.store(DefaultTenant))
+	if err != nil {
+		return UserProfile{}, false, err
+	}
+	return profiles.LoadProfile(userID)
+}
+
+// DeleteProfile forgets a user's profile in the default tenant's store
+func (ts *TenantStore) DeleteProfile(userID string) error {
+	profiles, err := tenantCapability[ProfileStore](ts.store(DefaultTenant))
+	if err != nil {
+		return err
+	}
+	return profiles.DeleteProfile(userID)
+}
+
+// Ping checks every tenant's store answers
+func (ts *TenantStore) Ping() error {
+	for _, store := range ts.all() {
+		if checker, ok := store.(HealthChecker); ok {
+			if err := checker.Ping(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Pending returns the number of messages waiting to be written to any tenant's store
+func (ts *TenantStore) Pending() int {
+	pending := 0
+	for _, store := range ts.all() {
+		if queue, ok := store.(queueReporter); ok {
+			pending += queue.Pending()
+		}
+	}
+	return pending
+}
+
+// Dropped returns the number of messages any tenant's store dropped for a full queue
+func (ts *TenantStore) Dropped() int64 {
+	dropped := int64(0)
+	for _, store := range ts.all() {
+		if drops, ok := store.(dropReporter); ok {
+			dropped += drops.Dropped()
+		}
+	}
+	return dropped
+}
+
+// Close closes every tenant's store
+func (ts *TenantStore) Close() error {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	var firstErr error
+	for _, store := range ts.stores {
+		if err := store.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// TenantInfo describes a tenant and where its messages are kept
+type TenantInfo struct {
+	Tenant
+	Location string `json:"location"` // database file or schema
+}
+
+// Tenants describes the default tenant and every configured one
+func (ts *TenantStore) Tenants() []TenantInfo {
+	infos := []TenantInfo{{Tenant: Tenant{Name: DefaultTenant}, Location: ts.backend.Location(DefaultTenant)}}
+	for _, tenant := range ts.tenants {
+		infos = append(infos, TenantInfo{Tenant: tenant, Location: ts.backend.Location(tenant.Name)})
+	}
+	sort.SliceStable(infos[1:], func(i, j int) bool { return infos[i+1].Name < infos[j+1].Name })
+	return infos
+}
+
+// DeleteTenant deletes every message a tenant's store holds, by removing its
+// storage and starting afresh. Its rooms carry on; only what was stored is gone.
+func (ts *TenantStore) DeleteTenant(tenant string) error {
+	if tenant == DefaultTenant {
+		return errors.New("the default tenant can't be deleted")
+	}
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	store, ok := ts.stores[tenant]
+	if !ok {
+		return errUnknownTenant
+	}
+	if err := store.Close(); err != nil {
+		log.Printf("Failed to close the chat store of tenant %s: %v", tenant, err)
+	}
+	if err := ts.backend.Remove(tenant); err != nil {
+		return err
+	}
+
+	reopened, err := ts.backend.Open(tenant)
+	if err != nil {
+		return err
+	}
+	ts.stores[tenant] = reopened
+	log.Printf("Deleted the stored chat messages of tenant %s", tenant)
+	return nil
+}
+
+// tenantStore returns the installed message store if it keeps tenants apart
+func (m *Manager) tenantStore() (*TenantStore, bool) {
+	m.hooksMux.RLock()
+	defer m.hooksMux.RUnlock()
+
+	ts, ok := m.messageStore.(*TenantStore)
+	return ts, ok
+}
+
+// TenantsHandler serves GET /api/chat/admin/tenants, listing each tenant and
+// where its messages are kept
+func (h *WSHandler) TenantsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ts, ok := h.manager.tenantStore()
+	if !ok {
+		http.Error(w, "Tenants aren't configured", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, ts.Tenants())
+}
+
+// TenantHandler serves DELETE /api/chat/admin/tenants/{tenant}, deleting every
+// message stored for the tenant's rooms
+func (h *WSHandler) TenantHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	ts, ok := h.manager.tenantStore()
+	if !ok {
+		http.Error(w, "Tenants aren't configured", http.StatusNotFound)
+		return
+	}
+
+	tenant := r.PathValue("tenant")
+	err := ts.DeleteTenant(tenant)
+	switch {
+	case errors.Is(err, errUnknownTenant):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case tenant == DefaultTenant:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case err != nil:
+		log.Printf("Failed to delete chat tenant %s: %v", tenant, err)
+		http.Error(w, "Failed to delete tenant", http.StatusInternalServerError)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,109 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseTenants(t *testing.T) {
+	tenants, err := ParseTenants([]string{"acme=acme-", " globex=gx-"})
+	require.NoError(t, err)
+	require.Equal(t, []Tenant{{Name: "acme", Prefix: "acme-"}, {Name: "globex", Prefix: "gx-"}}, tenants)
+
+	for _, invalid := range [][]string{{"acme"}, {"acme="}, {"Acme=a"}, {"default=d"}, {"a/b=x"}, {"acme=a", "acme=b"}} {
+		_, err := ParseTenants(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestTenantStoreKeepsTenantsApart(t *testing.T) {
+	backend := SQLiteTenants{Path: filepath.Join(t.TempDir(), "chat.db"), Batching: DefaultWriteBatching()}
+	store, err := NewTenantStore([]Tenant{{Name: "acme", Prefix: "acme-"}, {Name: "acme_eu", Prefix: "acme-eu-"}}, backend)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+
+	require.Equal(t, "acme_eu", store.TenantOf("acme-eu-1"))
+	require.Equal(t, "acme", store.TenantOf("acme-1"))
+	require.Equal(t, DefaultTenant, store.TenantOf("other"))
+
+	now := time.Now()
+	for _, room := range []string{"acme-1", "acme-eu-1", "other"} {
+		require.NoError(t, store.Append(ChatMessage{ID: room, StreamKey: room, UserID: "alice", Seq: 1, Timestamp: now}))
+		require.NoError(t, store.SaveRoom(SavedRoom{StreamKey: room}))
+	}
+	require.NoError(t, store.SaveProfile(UserProfile{UserID: "alice", Color: "#123456"}))
+
+	messages, err := store.UserMessages("alice")
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+	rooms, err := store.LoadRooms()
+	require.NoError(t, err)
+	require.Len(t, rooms, 3)
+
+	// Each tenant's database file holds its rooms only
+	require.NoError(t, store.Close())
+	acme, err := NewSQLiteStore(backend.Location("acme"), DefaultWriteBatching())
+	require.NoError(t, err)
+	messages, err = acme.UserMessages("alice")
+	require.NoError(t, err)
+	require.Equal(t, []string{"acme-1"}, messageIDs(messages))
+	_, exists, err := acme.LoadProfile("alice")
+	require.NoError(t, err)
+	require.False(t, exists, "profiles stay with the default tenant")
+	require.NoError(t, acme.Close())
+
+	store, err = NewTenantStore([]Tenant{{Name: "acme", Prefix: "acme-"}, {Name: "acme_eu", Prefix: "acme-eu-"}}, backend)
+	require.NoError(t, err)
+
+	// Deleting a tenant leaves the others' messages, and its rooms carry on
+	require.NoError(t, store.DeleteTenant("acme"))
+	messages, err = store.UserMessages("alice")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"acme-eu-1", "other"}, messageIDs(messages))
+	require.NoError(t, store.Append(ChatMessage{ID: "again", StreamKey: "acme-1", Seq: 2, Timestamp: now}))
+	messages, err = store.Range("acme-1", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"again"}, messageIDs(messages))
+
+	require.ErrorIs(t, store.DeleteTenant("nobody"), errUnknownTenant)
+	require.Error(t, store.DeleteTenant(DefaultTenant))
+}
+
+func TestTenantHandlers(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	w := httptest.NewRecorder()
+	h.TenantsHandler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	backend := SQLiteTenants{Path: filepath.Join(t.TempDir(), "chat.db"), Batching: DefaultWriteBatching()}
+	store, err := NewTenantStore([]Tenant{{Name: "acme", Prefix: "acme-"}}, backend)
+	require.NoError(t, err)
+	t.Cleanup(func() { store.Close() })
+	h.manager.SetMessageStore(store)
+
+	w = httptest.NewRecorder()
+	h.TenantsHandler(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var tenants []TenantInfo
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &tenants))
+	require.Len(t, tenants, 2)
+	require.Equal(t, backend.Location("acme"), tenants[1].Location)
+
+	deleteTenant := func(name string) int {
+		r := httptest.NewRequest(http.MethodDelete, "/", nil)
+		r.SetPathValue("tenant", name)
+		w := httptest.NewRecorder()
+		h.TenantHandler(w, r)
+		return w.Code
+	}
+	require.Equal(t, http.StatusNoContent, deleteTenant("acme"))
+	require.Equal(t, http.StatusNotFound, deleteTenant("globex"))
+	require.Equal(t, http.StatusBadRequest, deleteTenant(DefaultTenant))
+}
@@ -0,0 +1,111 @@
+package chat
+
+import (
+	"log"
+	"time"
+)
+
+// SavedTimeout is a user's timeout as kept by a TimeoutStore
+type SavedTimeout struct {
+	UserID     string    `json:"userId"`
+	Until      time.Time `json:"until"`
+	Tier       string    `json:"tier"`
+	Violations int       `json:"violations"` // kept so repeat offenders still escalate after a restart
+}
+
+// TimeoutStore is implemented by message stores that also keep users' timeouts,
+// so a restart doesn't let everyone who was timed out straight back in
+type TimeoutStore interface {
+	// SaveTimeout records a user's timeout, replacing what was saved before
+	SaveTimeout(timeout SavedTimeout) error
+	// DeleteTimeout forgets a user's timeout once it has ended
+	DeleteTimeout(userID string) error
+	// LoadTimeouts returns every saved timeout, including any that have since ended
+	LoadTimeouts() ([]SavedTimeout, error)
+}
+
+// SetTimeoutStore saves timeouts applied from then on to store, deleting each when
+// it ends
+func (rl *RateLimiter) SetTimeoutStore(store TimeoutStore) {
+	rl.timeoutStore.Store(&store)
+}
+
+// timeouts returns the installed timeout store, or nil
+func (rl *RateLimiter) timeouts() TimeoutStore {
+	if store := rl.timeoutStore.Load(); store != nil {
+		return *store
+	}
+	return nil
+}
+
+// saveTimeout records the record's timeout in the timeout store, if any. Callers
+// must hold the record's lock, which keeps saves and deletes for a user in order.
+func (rl *RateLimiter) saveTimeout(record *UserRateRecord) {
+	store := rl.timeouts()
+	if store == nil {
+		return
+	}
+
+	timeout := SavedTimeout{UserID: record.UserID, Until: record.TimeoutUntil, Tier: record.TimeoutTier, Violations: record.Violations}
+	if err := store.SaveTimeout(timeout); err != nil {
+		log.Printf("Failed to save chat timeout for %s: %v", record.UserID, err)
+	}
+}
+
+// forgetTimeout deletes a user's saved timeout if it has ended rather than been
+// extended since its end was scheduled
+func (rl *RateLimiter) forgetTimeout(userID string) {
+	store := rl.timeouts()
+	if store == nil {
+		return
+	}
+
+	if record, exists := rl.record(userID); exists {
+		record.mu.Lock()
+		defer record.mu.Unlock()
+		if time.Now().Before(record.TimeoutUntil) {
+			return
+		}
+	}
+	if err := store.DeleteTimeout(userID); err != nil {
+		log.Printf("Failed to delete chat timeout for %s: %v", userID, err)
+	}
+}
+
+// RestoreTimeouts reapplies the timeouts saved in the timeout store that haven't
+// ended yet, and deletes those that have. Call it once at startup, after
+// SetTimeoutStore and before serving clients. Returns how many were reapplied.
+func (rl *RateLimiter) RestoreTimeouts() (int, error) {
+	store := rl.timeouts()
+	if store == nil {
+		return 0, nil
+	}
+
+	saved, err := store.LoadTimeouts()
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	restored := 0
+	for _, timeout := range saved {
+		if !now.Before(timeout.Until) {
+			if err := store.DeleteTimeout(timeout.UserID); err != nil {
+				log.Printf("Failed to delete chat timeout for %s: %v", timeout.UserID, err)
+			}
+			continue
+		}
+
+		record := rl.lockRecord(timeout.UserID)
+		before := record.TimeoutUntil
+		if timeout.Until.After(record.TimeoutUntil) {
+			record.TimeoutUntil = timeout.Until
+			record.TimeoutTier = timeout.Tier
+		}
+		record.Violations = max(record.Violations, timeout.Violations)
+		rl.scheduleTimeoutEnd(record, before)
+		record.mu.Unlock()
+		restored++
+	}
+	return restored, nil
+}
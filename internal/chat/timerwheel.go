@@ -0,0 +1,190 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	wheelLevels   = 4
+	wheelSlotBits = 6
+	wheelSlots    = 1 << wheelSlotBits
+	wheelSlotMask = wheelSlots - 1
+)
+
+// timerWheel runs callbacks at deadlines without scanning every pending one. It
+// is hierarchical: level 0 has a slot per tick for the next 64 ticks, and each
+// level above has slots 64 times as wide. A timer waits in the slot its deadline
+// falls in and moves down a level each time its slot comes due, so every tick
+// touches only the timers in one slot. With one-second ticks the four levels
+// reach about six months ahead; later deadlines wait at the top level.
+//
+// Timers are keyed, and scheduling a key replaces its pending timer. Callbacks
+// run one at a time on the wheel's goroutine, so they must not block.
+type timerWheel struct {
+	tick  time.Duration
+	start time.Time
+
+	mu     sync.Mutex
+	now    uint64 // ticks processed since start
+	slots  [wheelLevels][wheelSlots]map[string]*wheelTimer
+	timers map[string]*wheelTimer // key -> pending timer
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// wheelTimer is a pending callback
+type wheelTimer struct {
+	key      string
+	deadline uint64 // tick
+	fn       func()
+	level    int
+	slot     int
+}
+
+// newTimerWheel creates a wheel counting ticks from now. Call run to start it.
+func newTimerWheel(tick time.Duration) *timerWheel {
+	w := &timerWheel{
+		tick:   tick,
+		start:  time.Now(),
+		timers: make(map[string]*wheelTimer),
+		stop:   make(chan struct{}),
+	}
+	for level := range w.slots {
+		for slot := range w.slots[level] {
+			w.slots[level][slot] = make(map[string]*wheelTimer)
+		}
+	}
+	return w
+}
+
+// Schedule runs fn at the first tick at or after at, replacing any timer pending
+// for key. Deadlines already past run on the next tick.
+func (w *timerWheel) Schedule(key string, at time.Time, fn func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.removeLocked(key)
+
+	deadline := uint64(0)
+	if elapsed := at.Sub(w.start); elapsed > 0 {
+		deadline = uint64((elapsed + w.tick - 1) / w.tick)
+	}
+	timer := &wheelTimer{key: key, deadline: max(deadline, w.now+1), fn: fn}
+	w.timers[key] = timer
+	w.placeLocked(timer)
+}
+
+// Cancel drops the timer pending for key, if any
+func (w *timerWheel) Cancel(key string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.removeLocked(key)
+}
+
+// Len returns the number of pending timers
+func (w *timerWheel) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return len(w.timers)
+}
+
+// run advances the wheel every tick until Stop is called
+func (w *timerWheel) run() {
+	defer trackWorker("timerwheel")()
+
+	ticker := time.NewTicker(w.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			w.advance(now)
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// Stop stops the wheel; pending timers never run
+func (w *timerWheel) Stop() {
+	w.once.Do(func() {
+		close(w.stop)
+	})
+}
+
+// advance processes every tick up to now and runs the timers that came due
+func (w *timerWheel) advance(now time.Time) {
+	target := uint64(now.Sub(w.start) / w.tick)
+
+	for {
+		w.mu.Lock()
+		if w.now >= target {
+			w.mu.Unlock()
+			return
+		}
+		if len(w.timers) == 0 {
+			// Nothing is pending, so there is nothing to move or run on the way
+			w.now = target
+			w.mu.Unlock()
+			return
+		}
+		w.now++
+
+		// Move timers down from each higher level whose slot starts at this tick
+		for level := 1; level < wheelLevels; level++ {
+			if w.now&(1<<(level*wheelSlotBits)-1) != 0 {
+				break
+			}
+			slot := int(w.now>>(level*wheelSlotBits)) & wheelSlotMask
+			if timers := w.slots[level][slot]; len(timers) > 0 {
+				w.slots[level][slot] = make(map[string]*wheelTimer)
+				for _, timer := range timers {
+					w.placeLocked(timer)
+				}
+			}
+		}
+
+		slot := int(w.now & wheelSlotMask)
+		due := w.slots[0][slot]
+		if len(due) == 0 {
+			w.mu.Unlock()
+			continue
+		}
+		w.slots[0][slot] = make(map[string]*wheelTimer)
+		for key := range due {
+			delete(w.timers, key)
+		}
+		w.mu.Unlock()
+
+		for _, timer := range due {
+			timer.fn()
+		}
+	}
+}
+
+// placeLocked files a timer in the level and slot its deadline falls in. Callers
+// must hold mu.
+func (w *timerWheel) placeLocked(timer *wheelTimer) {
+	delta := timer.deadline - w.now
+
+	level := 0
+	for level < wheelLevels-1 && delta >= 1<<((level+1)*wheelSlotBits) {
+		level++
+	}
+
+	timer.level = level
+	timer.slot = int(timer.deadline>>(level*wheelSlotBits)) & wheelSlotMask
+	w.slots[level][timer.slot][timer.key] = timer
+}
+
+// removeLocked drops a pending timer. Callers must hold mu.
+func (w *timerWheel) removeLocked(key string) {
+	if timer, ok := w.timers[key]; ok {
+		delete(w.slots[timer.level][timer.slot], key)
+		delete(w.timers, key)
+	}
+}
@@ -0,0 +1,173 @@
+package chat
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// firedLog records the keys of timers as they run
+type firedLog struct {
+	mu   sync.Mutex
+	keys []string
+}
+
+func (f *firedLog) record(key string) func() {
+	return func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		f.keys = append(f.keys, key)
+	}
+}
+
+func (f *firedLog) fired() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.keys...)
+}
+
+func TestTimerWheelRunsTimersAtTheirDeadlines(t *testing.T) {
+	w := newTimerWheel(time.Second)
+	log := &firedLog{}
+
+	// One deadline per level, plus one already past
+	w.Schedule("past", w.start.Add(-time.Minute), log.record("past"))
+	w.Schedule("seconds", w.start.Add(30*time.Second), log.record("seconds"))
+	w.Schedule("minutes", w.start.Add(20*time.Minute), log.record("minutes"))
+	w.Schedule("hours", w.start.Add(30*time.Hour), log.record("hours"))
+	w.Schedule("days", w.start.Add(5*24*time.Hour), log.record("days"))
+	require.Equal(t, 5, w.Len())
+
+	w.advance(w.start.Add(time.Second))
+	require.Equal(t, []string{"past"}, log.fired())
+
+	w.advance(w.start.Add(29 * time.Second))
+	require.Equal(t, []string{"past"}, log.fired())
+	w.advance(w.start.Add(30 * time.Second))
+	require.Equal(t, []string{"past", "seconds"}, log.fired())
+
+	w.advance(w.start.Add(20*time.Minute - time.Second))
+	require.Len(t, log.fired(), 2)
+	w.advance(w.start.Add(20 * time.Minute))
+	require.Equal(t, "minutes", log.fired()[2])
+
+	w.advance(w.start.Add(30*time.Hour - time.Second))
+	require.Len(t, log.fired(), 3)
+	w.advance(w.start.Add(30 * time.Hour))
+	require.Equal(t, "hours", log.fired()[3])
+
+	w.advance(w.start.Add(5*24*time.Hour - time.Second))
+	require.Len(t, log.fired(), 4)
+	w.advance(w.start.Add(5 * 24 * time.Hour))
+	require.Equal(t, "days", log.fired()[4])
+	require.Zero(t, w.Len())
+}
+
+func TestTimerWheelReschedulesAndCancels(t *testing.T) {
+	w := newTimerWheel(time.Second)
+	log := &firedLog{}
+
+	w.Schedule("a", w.start.Add(10*time.Second), log.record("first"))
+	w.Schedule("a", w.start.Add(2*time.Hour), log.record("second"))
+	w.Schedule("b", w.start.Add(5*time.Second), log.record("b"))
+	w.Cancel("b")
+	require.Equal(t, 1, w.Len())
+
+	w.advance(w.start.Add(time.Hour))
+	require.Empty(t, log.fired())
+
+	w.advance(w.start.Add(2 * time.Hour))
+	require.Equal(t, []string{"second"}, log.fired())
+}
+
+func TestTimerWheelCallbacksMayReschedule(t *testing.T) {
+	w := newTimerWheel(time.Second)
+	log := &firedLog{}
+
+	var tick func()
+	count := 0
+	tick = func() {
+		count++
+		if count < 3 {
+			w.Schedule("tick", w.start.Add(time.Duration(count+1)*time.Minute), tick)
+		}
+	}
+	w.Schedule("tick", w.start.Add(time.Minute), tick)
+	w.Schedule("other", w.start.Add(90*time.Second), log.record("other"))
+
+	w.advance(w.start.Add(10 * time.Minute))
+	require.Equal(t, 3, count)
+	require.Equal(t, []string{"other"}, log.fired())
+	require.Zero(t, w.Len())
+}
+
+func TestRateLimiterReportsTimeoutEnd(t *testing.T) {
+	rl := NewRateLimiter(DefaultConfig())
+	t.Cleanup(rl.Stop)
+
+	ended := make(chan string, 1)
+	rl.OnTimeoutEnded(func(userID string) { ended <- userID })
+
+	for _, text := range []string{"hi", "how is everyone", "great stream", "lol", "what game is this"} {
+		allowed, _ := rl.CheckMessage("alice", text)
+		require.True(t, allowed)
+	}
+	allowed, err := rl.CheckMessage("alice", "one too many")
+	require.False(t, allowed)
+	require.Equal(t, CodeRateLimit, err.Code)
+
+	// The timeout is scheduled to end, not found by a scan
+	rl.wheel.Stop()
+	rl.wheel.advance(time.Now().Add(31 * time.Second))
+	select {
+	case userID := <-ended:
+		require.Equal(t, "alice", userID)
+	case <-time.After(time.Second):
+		t.Fatal("timeout end was not reported")
+	}
+
+	// The record itself expires once idle
+	record, _ := rl.record("alice")
+	record.mu.Lock()
+	record.LastCleanup = record.LastCleanup.Add(-time.Hour)
+	record.TimeoutUntil = record.TimeoutUntil.Add(-time.Hour)
+	for i := range record.Messages {
+		record.Messages[i] = record.Messages[i].Add(-time.Hour)
+	}
+	record.mu.Unlock()
+
+	rl.wheel.advance(time.Now().Add(recordIdleTimeout + time.Minute))
+	_, exists := rl.State("alice")
+	require.False(t, exists)
+}
+
+func TestManagerExpiresInactiveRooms(t *testing.T) {
+	config := DefaultConfig()
+	config.RoomDeletionGraceMinutes = 30
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+	manager.wheel.Stop()
+
+	require.NoError(t, manager.AddUser("room", "alice", "alice"))
+	start := time.Now()
+
+	// Occupied rooms are never deleted
+	manager.wheel.advance(start.Add(config.InactiveStreamTimeout + time.Minute))
+	require.True(t, manager.hasRoom("room"))
+
+	manager.RemoveUser("room", "alice")
+	room, _ := manager.GetRoom("room")
+	room.MessagesMux.Lock()
+	room.LastActivity = start.Add(-time.Hour)
+	room.MessagesMux.Unlock()
+
+	manager.wheel.advance(start.Add(2*config.InactiveStreamTimeout + 2*time.Minute))
+	_, live := manager.GetRoom("room")
+	require.False(t, live)
+	require.True(t, manager.hasRoom("room"), "soft-deleted rooms are kept for the grace period")
+
+	manager.wheel.advance(start.Add(2*config.InactiveStreamTimeout + 33*time.Minute))
+	require.False(t, manager.hasRoom("room"))
+}
@@ -0,0 +1,138 @@
+package chat
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// Scope is a permission granted to an API token
+type Scope string
+
+const (
+	ScopeReadHistory Scope = "read:history"
+	ScopeReadStats   Scope = "read:stats"
+	ScopeWriteSystem Scope = "write:system"
+	ScopeModerate    Scope = "moderate"
+	ScopeAdmin       Scope = "admin"
+)
+
+// publicScopes are open to anonymous callers while no API tokens are configured
+var publicScopes = map[Scope]bool{
+	ScopeReadHistory: true,
+	ScopeReadStats:   true,
+}
+
+// APIToken is a credential issued to an integration
+type APIToken struct {
+	Name      string  `json:"name"`
+	Token     string  `json:"token"`
+	Scopes    []Scope `json:"scopes"`
+	UserAgent string  `json:"userAgent,omitempty"` // Optional User-Agent prefix the token is pinned to
+}
+
+// HasScope reports whether the token grants a scope. Admin tokens grant every scope.
+func (t *APIToken) HasScope(scope Scope) bool {
+	for _, granted := range t.Scopes {
+		if granted == scope || granted == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseAPITokens parses a JSON array of API tokens
+func ParseAPITokens(raw string) ([]APIToken, error) {
+	var tokens []APIToken
+	if err := json.Unmarshal([]byte(raw), &tokens); err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+// TokenStore validates API tokens presented to the HTTP endpoints
+type TokenStore struct {
+	tokens []APIToken
+}
+
+// NewTokenStore creates a new token store
+func NewTokenStore(tokens []APIToken) *TokenStore {
+	return &TokenStore{tokens: tokens}
+}
+
+// Lookup returns the token presented with the request, or nil if none is valid.
+// Tokens may also be passed as a ?token= query parameter for clients such as
+// EventSource that cannot set headers.
+func (ts *TokenStore) Lookup(r *http.Request) *APIToken {
+	const bearerPrefix = "Bearer "
+
+	var presented []byte
+	if header := r.Header.Get("Authorization"); strings.HasPrefix(header, bearerPrefix) {
+		presented = []byte(strings.TrimPrefix(header, bearerPrefix))
+	} else if query := r.URL.Query().Get("token"); query != "" {
+		presented = []byte(query)
+	} else {
+		return nil
+	}
+
+	return ts.match(presented, r.UserAgent())
+}
+
+// match returns the token presented by a client with the given User-Agent, or nil
+// if none is valid
+func (ts *TokenStore) match(presented []byte, userAgent string) *APIToken {
+	for i := range ts.tokens {
+		token := &ts.tokens[i]
+		if subtle.ConstantTimeCompare(presented, []byte(token.Token)) != 1 {
+			continue
+		}
+
+		if token.UserAgent != "" && !strings.HasPrefix(userAgent, token.UserAgent) {
+			return nil
+		}
+		return token
+	}
+
+	return nil
+}
+
+// Authorized reports whether the request may use a scope
+func (ts *TokenStore) Authorized(r *http.Request, scope Scope) bool {
+	return ts.allows(ts.Lookup(r), scope)
+}
+
+// HeaderAuthorized reports whether the bearer token in a header, such as the one
+// gRPC metadata makes, may use a scope
+func (ts *TokenStore) HeaderAuthorized(header http.Header, scope Scope) bool {
+	var token *APIToken
+	if presented, ok := strings.CutPrefix(header.Get("Authorization"), "Bearer "); ok {
+		token = ts.match([]byte(presented), header.Get("User-Agent"))
+	}
+	return ts.allows(token, scope)
+}
+
+// allows reports whether a presented token, or none, may use a scope
+func (ts *TokenStore) allows(token *APIToken, scope Scope) bool {
+	if token != nil {
+		return token.HasScope(scope)
+	}
+
+	return len(ts.tokens) == 0 && publicScopes[scope]
+}
+
+// RequireScope wraps a handler so it only runs for requests authorized for the scope
+func (ts *TokenStore) RequireScope(scope Scope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if ts.Authorized(r, scope) {
+			next(w, r)
+			return
+		}
+
+		if ts.Lookup(r) == nil {
+			writeChatError(w, http.StatusUnauthorized, ErrUnauthorized)
+		} else {
+			writeChatError(w, http.StatusForbidden, ErrForbidden)
+		}
+	}
+}
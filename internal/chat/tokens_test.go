@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTokenRequest(token, userAgent string) *http.Request {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	r.Header.Set("User-Agent", userAgent)
+	return r
+}
+
+func TestTokenStoreScopes(t *testing.T) {
+	tokens, err := ParseAPITokens(`[
+		{"name": "overlay", "token": "overlay-secret", "scopes": ["read:history"], "userAgent": "OBS"},
+		{"name": "ops", "token": "ops-secret", "scopes": ["admin"]}
+	]`)
+	require.NoError(t, err)
+	ts := NewTokenStore(tokens)
+
+	require.True(t, ts.Authorized(newTokenRequest("overlay-secret", "OBS/30.0"), ScopeReadHistory))
+	require.False(t, ts.Authorized(newTokenRequest("overlay-secret", "curl/8.0"), ScopeReadHistory))
+	require.False(t, ts.Authorized(newTokenRequest("overlay-secret", "OBS/30.0"), ScopeModerate))
+	require.True(t, ts.Authorized(newTokenRequest("ops-secret", ""), ScopeModerate))
+	require.False(t, ts.Authorized(newTokenRequest("", ""), ScopeReadHistory))
+
+	w := httptest.NewRecorder()
+	ts.RequireScope(ScopeAdmin, func(http.ResponseWriter, *http.Request) {})(w, newTokenRequest("overlay-secret", "OBS"))
+	require.Equal(t, http.StatusForbidden, w.Code)
+}
+
+func TestTokenStorePublicScopesWithoutTokens(t *testing.T) {
+	ts := NewTokenStore(nil)
+
+	require.True(t, ts.Authorized(newTokenRequest("", ""), ScopeReadHistory))
+	require.True(t, ts.Authorized(newTokenRequest("", ""), ScopeReadStats))
+	require.False(t, ts.Authorized(newTokenRequest("", ""), ScopeAdmin))
+}
@@ -0,0 +1,201 @@
+package chat
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+	"unicode/utf8"
+)
+
+// Tombstone types
+const (
+	TombstoneDeleted = "deleted"
+	TombstoneEdited  = "edited"
+)
+
+// Tombstone records that a message was deleted or edited. Stores that keep
+// tombstones keep the message as it was sent too, so exports and replays show
+// what moderators did rather than history being rewritten.
+type Tombstone struct {
+	StreamKey string    `json:"streamKey"`
+	MessageID string    `json:"messageId"`
+	Type      string    `json:"type"`               // TombstoneDeleted or TombstoneEdited
+	Message   string    `json:"message,omitempty"`  // the text an edit replaced the message's with
+	ByUserID  string    `json:"byUserId,omitempty"` // who deleted or edited it
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// TombstoneStore is implemented by message stores that record deletions and edits
+// next to the messages they are about. Deleting from other stores removes the
+// message, and edits only change the room's buffer.
+type TombstoneStore interface {
+	// AppendTombstone records that a message was deleted or edited
+	AppendTombstone(tombstone Tombstone) error
+	// Tombstones returns a room's tombstones, oldest first
+	Tombstones(streamKey string) ([]Tombstone, error)
+}
+
+// messageFate is what tombstones say happened to one message
+type messageFate struct {
+	deleted *Tombstone
+	edited  *Tombstone // the latest edit
+}
+
+// indexTombstones returns the fate of each message tombstones are about
+func indexTombstones(tombstones []Tombstone) map[string]messageFate {
+	fates := make(map[string]messageFate)
+	for i := range tombstones {
+		tombstone := &tombstones[i]
+		fate := fates[tombstone.MessageID]
+		switch tombstone.Type {
+		case TombstoneDeleted:
+			fate.deleted = tombstone
+		case TombstoneEdited:
+			fate.edited = tombstone
+		}
+		fates[tombstone.MessageID] = fate
+	}
+	return fates
+}
+
+// roomTombstones returns the fates of a room's messages the store has tombstones
+// for, or nil if it keeps none
+func roomTombstones(store MessageStore, streamKey string) (map[string]messageFate, error) {
+	tombstones, ok := store.(TombstoneStore)
+	if !ok {
+		return nil, nil
+	}
+	saved, err := tombstones.Tombstones(streamKey)
+	if err != nil {
+		return nil, err
+	}
+	return indexTombstones(saved), nil
+}
+
+// applyTombstones returns messages as chat shows them now: deleted ones left out,
+// and edited ones with their latest text
+func applyTombstones(messages []ChatMessage, fates map[string]messageFate) []ChatMessage {
+	if len(fates) == 0 {
+		return messages
+	}
+
+	shown := messages[:0]
+	for _, msg := range messages {
+		fate := fates[msg.ID]
+		if fate.deleted != nil {
+			continue
+		}
+		if fate.edited != nil {
+			msg.Message = fate.edited.Message
+		}
+		shown = append(shown, msg)
+	}
+	return shown
+}
+
+// moderatedRange reads a room's stored messages as chat shows them now
+func moderatedRange(store MessageStore, streamKey string, afterSeq int64) ([]ChatMessage, error) {
+	messages, err := store.Range(streamKey, afterSeq, 0)
+	if err != nil {
+		return nil, err
+	}
+	fates, err := roomTombstones(store, streamKey)
+	if err != nil {
+		return nil, err
+	}
+	return applyTombstones(messages, fates), nil
+}
+
+// DeleteMessage deletes one of a room's messages on behalf of byUserID. Where the
+// message store keeps tombstones the deletion is recorded next to the message;
+// otherwise the message is removed from the store.
+func (m *Manager) DeleteMessage(streamKey, messageID, byUserID string) error {
+	return m.moderateMessage(Tombstone{
+		StreamKey: streamKey,
+		MessageID: messageID,
+		Type:      TombstoneDeleted,
+		ByUserID:  byUserID,
+		Timestamp: time.Now(),
+	})
+}
+
+// EditMessage replaces the text of one of a room's messages on behalf of byUserID.
+// Where the message store keeps tombstones the edit is recorded next to the
+// message as it was sent; otherwise only the room's buffer changes.
+func (m *Manager) EditMessage(streamKey, messageID, text, byUserID string) error {
+	if text == "" {
+		return errors.New("message can't be empty")
+	}
+	if limit := m.config.MaxCharactersPerMessage; limit > 0 && utf8.RuneCountInString(text) > limit {
+		return fmt.Errorf("message can't be longer than %d characters", limit)
+	}
+
+	return m.moderateMessage(Tombstone{
+		StreamKey: streamKey,
+		MessageID: messageID,
+		Type:      TombstoneEdited,
+		Message:   text,
+		ByUserID:  byUserID,
+		Timestamp: time.Now(),
+	})
+}
+
+// moderateMessage applies a tombstone to the room's buffer, its message store and
+// the replay of the session the message was sent in. Replays only learn of
+// tombstones for messages still buffered, as those say when they were sent.
+func (m *Manager) moderateMessage(tombstone Tombstone) error {
+	var msg ChatMessage
+	buffered := false
+	if room, exists := m.GetRoom(tombstone.StreamKey); exists {
+		msg, buffered = room.applyTombstone(tombstone)
+	}
+
+	if store := m.persistence(); store != nil {
+		if tombstones, ok := store.(TombstoneStore); ok {
+			if err := tombstones.AppendTombstone(tombstone); err != nil {
+				return err
+			}
+		} else if tombstone.Type == TombstoneDeleted {
+			if _, err := store.DeleteByID(tombstone.StreamKey, tombstone.MessageID); err != nil {
+				return err
+			}
+		}
+	}
+
+	if buffered && m.replay.Enabled() {
+		startedAt, found, err := m.replay.sessionAt(tombstone.StreamKey, msg.Timestamp)
+		if err != nil {
+			log.Printf("Failed to find the chat replay of message %s: %v", tombstone.MessageID, err)
+		} else if found {
+			m.replay.RecordTombstone(startedAt, tombstone)
+		}
+	}
+	return nil
+}
+
+// applyTombstone removes or edits the buffered copy of the message a tombstone is
+// about, returning the message as it was and whether the buffer held it
+func (cr *ChatRoom) applyTombstone(tombstone Tombstone) (ChatMessage, bool) {
+	cr.MessagesMux.Lock()
+	defer cr.MessagesMux.Unlock()
+
+	messages := cr.Messages.GetAll()
+	i := slices.IndexFunc(messages, func(msg ChatMessage) bool { return msg.ID == tombstone.MessageID })
+	if i < 0 {
+		return ChatMessage{}, false
+	}
+	original := messages[i]
+
+	if tombstone.Type == TombstoneDeleted {
+		messages = slices.Delete(messages, i, i+1)
+	} else {
+		messages[i].Message = tombstone.Message
+	}
+	cr.Messages.Clear()
+	for _, msg := range messages {
+		cr.Messages.Add(msg)
+	}
+	return original, true
+}
@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTombstonesKeepModeratedHistory(t *testing.T) {
+	h := newReplayTestHandler(t)
+	m := h.manager
+	store := NewMemoryStore()
+	m.SetMessageStore(store)
+	m.StreamStarted("room")
+	room, _ := m.GetRoom("room")
+	sessionID := replaySessionID(room.startedAt)
+
+	var ids []string
+	for _, send := range [][2]string{{"alice", "hello"}, {"bob", "spam"}, {"carol", "tpyo"}} {
+		msg, err := m.AddMessage("room", send[0], send[0], send[1])
+		require.NoError(t, err)
+		ids = append(ids, msg.ID)
+	}
+	time.Sleep(2 * time.Millisecond)
+	require.NoError(t, m.DeleteMessage("room", ids[1], "mod"))
+	require.NoError(t, m.EditMessage("room", ids[2], "typo", "carol"))
+	require.Error(t, m.EditMessage("room", ids[0], "", "alice"))
+
+	// Chat shows the moderated history
+	require.Equal(t, []string{"hello", "typo"}, messageTexts(room.GetMessages(0)))
+	shown, err := moderatedRange(store, "room", 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"hello", "typo"}, messageTexts(shown))
+
+	// The store keeps what was sent
+	stored, err := store.Range("room", 0, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"hello", "spam", "tpyo"}, messageTexts(stored))
+
+	// Exports mark where history was moderated
+	history := m.RetainedMessages("room")
+	require.Len(t, history, 3)
+	require.Nil(t, history[0].DeletedAt)
+	require.Empty(t, history[1].Message)
+	require.NotNil(t, history[1].DeletedAt)
+	require.Equal(t, "typo", history[2].Message)
+	require.NotNil(t, history[2].EditedAt)
+
+	export, err := m.ExportUserData("carol")
+	require.NoError(t, err)
+	require.Len(t, export.Tombstones, 1)
+	require.Equal(t, TombstoneEdited, export.Tombstones[0].Type)
+
+	// And so do replays, from when it happened
+	replayed, err := m.replay.Messages("room", sessionID, 0)
+	require.NoError(t, err)
+	require.Len(t, replayed, 3)
+	require.Empty(t, replayed[1].Message)
+	require.Greater(t, replayed[1].DeletedMs, replayed[1].OffsetMs)
+	require.Equal(t, "typo", replayed[2].Message)
+	require.Greater(t, replayed[2].EditedMs, replayed[2].OffsetMs)
+
+	summary, err := m.replay.Summary("room", sessionID)
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Deleted)
+	require.Equal(t, 1, summary.Edited)
+}
+
+// plainStore hides every optional interface of the store it wraps
+type plainStore struct {
+	MessageStore
+}
+
+func TestDeletingWithoutTombstonesRemovesMessages(t *testing.T) {
+	m := NewManager(DefaultConfig())
+	t.Cleanup(m.Stop)
+	store := NewMemoryStore()
+	m.SetMessageStore(plainStore{store})
+
+	msg, err := m.AddMessage("room", "bob", "bob", "spam")
+	require.NoError(t, err)
+	require.NoError(t, m.DeleteMessage("room", msg.ID, "mod"))
+
+	stored, err := store.Range("room", 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, stored)
+	room, _ := m.GetRoom("room")
+	require.Empty(t, room.GetMessages(0))
+}
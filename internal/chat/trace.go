@@ -0,0 +1,120 @@
+package chat
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultTraceDuration = 15 * time.Minute
+	maxTraceDuration     = 24 * time.Hour
+	maxTraceEvents       = 500
+)
+
+// Trace stages a chat message passes through, in order
+const (
+	TraceReceived  = "received"
+	TraceRateCheck = "rate_check"
+	TraceFilter    = "filter"
+	TraceStore     = "store"
+	TraceBroadcast = "broadcast"
+	TraceWritten   = "written"
+)
+
+// TraceEvent is one step of a traced user's message journey
+type TraceEvent struct {
+	Time      time.Time `json:"time"`
+	Stage     string    `json:"stage"`
+	StreamKey string    `json:"streamKey"`
+	Detail    string    `json:"detail,omitempty"`
+}
+
+// userTrace buffers the most recent events for one traced user
+type userTrace struct {
+	events    []TraceEvent
+	expiresAt time.Time
+}
+
+// Tracer records verbose per-event traces for a handful of users an admin is
+// debugging. Untraced users cost a single atomic load.
+type Tracer struct {
+	active atomic.Int32
+	traces map[string]*userTrace // userID -> trace
+	mutex  sync.Mutex
+}
+
+// NewTracer creates a tracer with nobody traced
+func NewTracer() *Tracer {
+	return &Tracer{
+		traces: make(map[string]*userTrace),
+	}
+}
+
+// Enable starts tracing a user for the given duration, keeping any events already buffered
+func (t *Tracer) Enable(userID string, duration time.Duration) time.Time {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	trace, exists := t.traces[userID]
+	if !exists {
+		trace = &userTrace{}
+		t.traces[userID] = trace
+		t.active.Add(1)
+	}
+	trace.expiresAt = time.Now().Add(duration)
+	return trace.expiresAt
+}
+
+// Disable stops tracing a user and discards their events
+func (t *Tracer) Disable(userID string) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if _, exists := t.traces[userID]; exists {
+		delete(t.traces, userID)
+		t.active.Add(-1)
+	}
+}
+
+// Events returns a copy of a user's buffered events, oldest first
+func (t *Tracer) Events(userID string) ([]TraceEvent, time.Time, bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	trace, exists := t.traces[userID]
+	if !exists {
+		return nil, time.Time{}, false
+	}
+	return append([]TraceEvent{}, trace.events...), trace.expiresAt, true
+}
+
+// Record appends an event to a user's trace if they are being traced
+func (t *Tracer) Record(userID, streamKey, stage, detail string) {
+	if t.active.Load() == 0 {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	trace, exists := t.traces[userID]
+	if !exists {
+		return
+	}
+
+	if time.Now().After(trace.expiresAt) {
+		// Expired traces stop recording but stay readable until disabled
+		return
+	}
+
+	if len(trace.events) >= maxTraceEvents {
+		trace.events = trace.events[1:]
+	}
+	trace.events = append(trace.events, TraceEvent{
+		Time:      time.Now(),
+		Stage:     stage,
+		StreamKey: streamKey,
+		Detail:    detail,
+	})
+}
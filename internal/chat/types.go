@@ -2,30 +2,57 @@ package chat
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 // ChatMessage represents a single chat message
 type ChatMessage struct {
-	ID        string    `json:"id"`
-	StreamKey string    `json:"streamKey"`
-	UserID    string    `json:"userId"`
-	Username  string    `json:"username"`
-	Message   string    `json:"message"`
-	Timestamp time.Time `json:"timestamp"`
+	ID        string         `json:"id"`
+	StreamKey string         `json:"streamKey"`
+	UserID    string         `json:"userId"`
+	Username  string         `json:"username"`
+	Message   string         `json:"message"`
+	Timestamp time.Time      `json:"timestamp"`
+	Origin    *MessageOrigin `json:"origin,omitempty"` // set on messages relayed in by a bridge
+	Seq       int64          `json:"seq,omitempty"`    // numbered per room as messages are stored; 0 on messages that weren't
 }
 
 // ChatUser represents a user in the chat
 type ChatUser struct {
-	UserID       string
-	Username     string
-	ConnectedAt  time.Time
-	LastMessage  time.Time
-	MessageCount int
-	CharCount    int64
-	TimeoutUntil time.Time
-	Violations   int
-	IsActive     bool
+	UserID       string    `json:"userId"`
+	Username     string    `json:"username"`
+	ConnectedAt  time.Time `json:"connectedAt"`
+	LastMessage  time.Time `json:"lastMessage"`
+	MessageCount int       `json:"messageCount"`
+	CharCount    int64     `json:"charCount"`
+	TimeoutUntil time.Time `json:"timeoutUntil"`
+	Violations   int       `json:"violations"`
+	IsActive     bool      `json:"isActive"`
+	Color        string    `json:"color,omitempty"`  // from the user's profile
+	Roles        []string  `json:"roles,omitempty"`  // most senior first
+	Badges       []string  `json:"badges,omitempty"` // from the user's roles and profile
+
+	sessions int // connections open as this user, such as browser tabs
+}
+
+// MessageBuffer holds a room's recent messages, oldest first, evicting the oldest
+// when full. CircularBuffer keeps messages on the heap; SlabBuffer copies them
+// into a preallocated slab.
+type MessageBuffer interface {
+	Add(msg ChatMessage)
+	GetAll() []ChatMessage
+	GetRecent(n int) []ChatMessage
+	GetAfter(seq int64) []ChatMessage
+	GetBefore(beforeID string, n int) (messages []ChatMessage, hasMore bool, found bool)
+	Size() int
+	Capacity() int
+	Bytes() int64
+	Oldest() (ChatMessage, bool)
+	Resize(maxSize int)
+	Clear()
+	DropOldest(n int) int
+	RemoveOlderThan(duration time.Duration) int
 }
 
 // CircularBuffer implements a fixed-size ring buffer for messages
@@ -35,6 +62,7 @@ type CircularBuffer struct {
 	head    int
 	tail    int
 	size    int
+	bytes   int64 // held by the buffered messages beyond their slots
 	mutex   sync.RWMutex
 }
 
@@ -54,7 +82,12 @@ func (cb *CircularBuffer) Add(msg ChatMessage) {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
+	if cb.size == cb.maxSize {
+		// Buffer is full; the message in the tail slot is evicted
+		cb.bytes -= messageSize(cb.data[cb.tail])
+	}
 	cb.data[cb.tail] = msg
+	cb.bytes += messageSize(msg)
 	cb.tail = (cb.tail + 1) % cb.maxSize
 
 	if cb.size < cb.maxSize {
@@ -108,6 +141,59 @@ func (cb *CircularBuffer) GetRecent(n int) []ChatMessage {
 	return result
 }
 
+// GetAfter returns the messages numbered after seq, oldest first
+func (cb *CircularBuffer) GetAfter(seq int64) []ChatMessage {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	start := cb.size
+	for start > 0 && cb.data[(cb.head+start-1)%cb.maxSize].Seq > seq {
+		start--
+	}
+
+	result := make([]ChatMessage, 0, cb.size-start)
+	for i := start; i < cb.size; i++ {
+		result = append(result, cb.data[(cb.head+i)%cb.maxSize])
+	}
+
+	return result
+}
+
+// GetBefore returns up to n messages older than the message with the given ID, oldest first.
+// An empty beforeID pages back from the newest message. hasMore reports whether older
+// messages remain, and found is false if beforeID is no longer in the buffer.
+func (cb *CircularBuffer) GetBefore(beforeID string, n int) (messages []ChatMessage, hasMore bool, found bool) {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	end := cb.size
+	if beforeID != "" {
+		end = -1
+		for i := cb.size - 1; i >= 0; i-- {
+			if cb.data[(cb.head+i)%cb.maxSize].ID == beforeID {
+				end = i
+				break
+			}
+		}
+
+		if end == -1 {
+			return []ChatMessage{}, false, false
+		}
+	}
+
+	start := end - n
+	if start < 0 {
+		start = 0
+	}
+
+	result := make([]ChatMessage, end-start)
+	for i := start; i < end; i++ {
+		result[i-start] = cb.data[(cb.head+i)%cb.maxSize]
+	}
+
+	return result, start > 0, true
+}
+
 // Size returns the current number of messages in the buffer
 func (cb *CircularBuffer) Size() int {
 	cb.mutex.RLock()
@@ -115,14 +201,86 @@ func (cb *CircularBuffer) Size() int {
 	return cb.size
 }
 
+// Capacity returns the number of messages the buffer can hold before overwriting
+func (cb *CircularBuffer) Capacity() int {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return cb.maxSize
+}
+
+// Bytes returns the memory the buffer holds: a slot per message it can hold, plus
+// what the buffered messages reference
+func (cb *CircularBuffer) Bytes() int64 {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+	return int64(cb.maxSize)*messageSlotSize + cb.bytes
+}
+
+// Oldest returns the oldest message in the buffer
+func (cb *CircularBuffer) Oldest() (ChatMessage, bool) {
+	cb.mutex.RLock()
+	defer cb.mutex.RUnlock()
+
+	if cb.size == 0 {
+		return ChatMessage{}, false
+	}
+	return cb.data[cb.head], true
+}
+
+// Resize changes the buffer's capacity, keeping the most recent messages that fit
+func (cb *CircularBuffer) Resize(maxSize int) {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	if maxSize < 1 || maxSize == cb.maxSize {
+		return
+	}
+
+	keep := min(cb.size, maxSize)
+	skip := cb.size - keep
+
+	for i := 0; i < skip; i++ {
+		cb.bytes -= messageSize(cb.data[(cb.head+i)%cb.maxSize])
+	}
+
+	data := make([]ChatMessage, maxSize)
+	for i := 0; i < keep; i++ {
+		data[i] = cb.data[(cb.head+skip+i)%cb.maxSize]
+	}
+
+	cb.data = data
+	cb.maxSize = maxSize
+	cb.head = 0
+	cb.size = keep
+	cb.tail = keep % maxSize
+}
+
 // Clear removes all messages from the buffer
 func (cb *CircularBuffer) Clear() {
 	cb.mutex.Lock()
 	defer cb.mutex.Unlock()
 
+	// Drop the messages so their memory can be reclaimed
+	clear(cb.data)
 	cb.head = 0
 	cb.tail = 0
 	cb.size = 0
+	cb.bytes = 0
+}
+
+// DropOldest removes up to n of the oldest messages, returning how many were removed
+func (cb *CircularBuffer) DropOldest(n int) int {
+	cb.mutex.Lock()
+	defer cb.mutex.Unlock()
+
+	removed := 0
+	for ; removed < n && cb.size > 0; removed++ {
+		cb.bytes -= messageSize(cb.data[cb.head])
+		cb.data[cb.head] = ChatMessage{}
+		cb.head = (cb.head + 1) % cb.maxSize
+		cb.size--
+	}
+	return removed
 }
 
 // RemoveOlderThan removes messages older than the specified duration
@@ -144,6 +302,8 @@ func (cb *CircularBuffer) RemoveOlderThan(duration time.Duration) int {
 			break
 		}
 
+		cb.bytes -= messageSize(msg)
+		cb.data[cb.head] = ChatMessage{}
 		cb.head = (cb.head + 1) % cb.maxSize
 		cb.size--
 		removed++
@@ -155,40 +315,142 @@ func (cb *CircularBuffer) RemoveOlderThan(duration time.Duration) int {
 // ChatRoom represents a chat room for a specific stream
 type ChatRoom struct {
 	StreamKey    string
-	Messages     *CircularBuffer
+	Messages     MessageBuffer
 	Users        map[string]*ChatUser
 	LastActivity time.Time
 	MessageCount int64
-	BytesUsed    int64
+	LastSeq      int64 // sequence number of the newest message
 	MessagesMux  sync.RWMutex
 	UsersMux     sync.RWMutex
+
+	// Buffer self-tuning bounds; equal when the buffer has a fixed size
+	minMessages int
+	maxMessages int
+	retention   time.Duration
+	viewers     int // last reported audience, which popularity-scaled limits are based on
+
+	// Moderation modes, moderators' timeouts and the slow mode bookkeeping they need
+	modes    RoomModes
+	lastPost map[string]time.Time // userID -> last accepted message while slow mode is on
+	timeouts map[string]time.Time // userID -> when a moderator's timeout ends
+	modesMux sync.Mutex
+
+	startedAt time.Time // start of the stream session, which replays are timed from
+	endedAt   time.Time // when the stream stopped; zero while the session is live
+
+	chatDisabled bool // the streamer turned chat off, which is saved with the room's state
+
+	store    MessageStore // nil keeps messages in the buffer only
+	stateMux sync.Mutex   // serializes saves of the room's state to the store
+
+	rateLimitHits atomic.Int64 // messages the rate limiter rejected, for room stats
+
+	names map[string]string // folded username -> userID holding it; guarded by UsersMux
 }
 
 // NewChatRoom creates a new chat room
 func NewChatRoom(streamKey string, maxMessages int) *ChatRoom {
+	return NewAutoSizedChatRoom(streamKey, maxMessages, maxMessages, 0)
+}
+
+// NewAutoSizedChatRoom creates a chat room whose message buffer starts at minMessages
+// and grows towards maxMessages while the room evicts messages younger than the
+// retention period, shrinking again once the room goes quiet
+func NewAutoSizedChatRoom(streamKey string, minMessages, maxMessages int, retention time.Duration) *ChatRoom {
+	if minMessages < 1 || minMessages > maxMessages {
+		minMessages = maxMessages
+	}
+
 	return &ChatRoom{
 		StreamKey:    streamKey,
-		Messages:     NewCircularBuffer(maxMessages),
+		Messages:     NewCircularBuffer(minMessages),
 		Users:        make(map[string]*ChatUser),
 		LastActivity: time.Now(),
 		MessageCount: 0,
-		BytesUsed:    0,
+		minMessages:  minMessages,
+		maxMessages:  maxMessages,
+		retention:    retention,
+		startedAt:    time.Now(),
 	}
 }
 
-// AddMessage adds a message to the room
-func (cr *ChatRoom) AddMessage(msg ChatMessage) {
+// AddMessage adds a message to the room, numbering it after the room's newest
+// message, and returns its sequence number
+func (cr *ChatRoom) AddMessage(msg ChatMessage) int64 {
 	cr.MessagesMux.Lock()
 	defer cr.MessagesMux.Unlock()
 
+	cr.LastSeq++
+	msg.Seq = cr.LastSeq
+
+	cr.growBuffer()
 	cr.Messages.Add(msg)
+	cr.persist(msg)
 	cr.LastActivity = time.Now()
 	cr.MessageCount++
+	return msg.Seq
+}
+
+// growBuffer doubles a full buffer, up to the room's maximum, when the message
+// about to be evicted is still within retention. Callers must hold MessagesMux.
+func (cr *ChatRoom) growBuffer() {
+	capacity := cr.Messages.Capacity()
+	if capacity >= cr.maxMessages || cr.Messages.Size() < capacity {
+		return
+	}
+
+	oldest, ok := cr.Messages.Oldest()
+	if ok && time.Since(oldest.Timestamp) < cr.retention {
+		cr.Messages.Resize(min(capacity*2, cr.maxMessages))
+	}
+}
+
+// SetMaxMessages changes how far the buffer may grow, shrinking it at once,
+// newest messages kept, if it already holds more. The limit never goes below the
+// room's minimum.
+func (cr *ChatRoom) SetMaxMessages(limit int) {
+	cr.MessagesMux.Lock()
+	defer cr.MessagesMux.Unlock()
+
+	cr.maxMessages = max(limit, cr.minMessages)
+	if cr.Messages.Capacity() > cr.maxMessages {
+		cr.Messages.Resize(cr.maxMessages)
+	}
+}
+
+// MaxMessages returns how far the buffer may grow
+func (cr *ChatRoom) MaxMessages() int {
+	cr.MessagesMux.RLock()
+	defer cr.MessagesMux.RUnlock()
+
+	return cr.maxMessages
+}
+
+// ShrinkBuffer halves the message buffer, down to the room's minimum, while it is
+// less than a quarter full. Returns the new capacity.
+func (cr *ChatRoom) ShrinkBuffer() int {
+	cr.MessagesMux.Lock()
+	defer cr.MessagesMux.Unlock()
+
+	capacity := cr.Messages.Capacity()
+	if capacity > cr.minMessages && cr.Messages.Size() <= capacity/4 {
+		capacity = max(capacity/2, cr.minMessages)
+		cr.Messages.Resize(capacity)
+	}
+	return capacity
+}
+
+// Trim evicts the oldest messages beyond keep and shrinks the buffer to fit what's
+// left, down to the room's minimum. Returns how many messages were evicted.
+func (cr *ChatRoom) Trim(keep int) int {
+	cr.MessagesMux.Lock()
+	defer cr.MessagesMux.Unlock()
 
-	// Estimate memory usage
-	msgSize := len(msg.ID) + len(msg.StreamKey) + len(msg.UserID) +
-		len(msg.Username) + len(msg.Message) + 100 // overhead
-	cr.BytesUsed += int64(msgSize)
+	removed := cr.Messages.DropOldest(cr.Messages.Size() - keep)
+	if capacity := max(keep, cr.minMessages, 1); capacity < cr.Messages.Capacity() {
+		cr.Messages.Resize(capacity)
+	}
+	return removed
 }
 
 // GetMessages returns all messages or recent N messages
@@ -202,21 +464,119 @@ func (cr *ChatRoom) GetMessages(recentN int) []ChatMessage {
 	return cr.Messages.GetAll()
 }
 
-// AddUser adds or updates a user in the room
-func (cr *ChatRoom) AddUser(user *ChatUser) {
+// GetMessagesAfter returns up to limit of the stored messages numbered after seq,
+// oldest first, reading them from the room's store when the buffer has evicted
+// some. complete is false when more follow the limit, when some of them are gone
+// from both, or when seq is ahead of the room because its numbering restarted;
+// then the newest buffered messages are returned.
+func (cr *ChatRoom) GetMessagesAfter(seq int64, limit int) (messages []ChatMessage, complete bool) {
+	cr.MessagesMux.RLock()
+	lastSeq := cr.LastSeq
+	if seq > lastSeq {
+		messages = cr.Messages.GetRecent(limit)
+		cr.MessagesMux.RUnlock()
+		return messages, false
+	}
+	messages = cr.Messages.GetAfter(seq)
+	cr.MessagesMux.RUnlock()
+
+	missed := lastSeq - seq
+	if int64(len(messages)) != missed {
+		// The store is read unlocked, so a slow one doesn't hold up the room
+		if stored, ok := cr.storedAfter(seq, lastSeq, limit); ok {
+			return stored, missed <= int64(limit)
+		}
+		return messages[:min(len(messages), limit)], false
+	}
+	if len(messages) > limit {
+		return messages[:limit], false
+	}
+	return messages, true
+}
+
+// GetMessagesBefore returns a page of messages older than beforeID. Pages reaching
+// past the buffer are finished from the room's store, which also finds cursors the
+// buffer has evicted.
+func (cr *ChatRoom) GetMessagesBefore(beforeID string, limit int) ([]ChatMessage, bool, bool) {
+	cr.MessagesMux.RLock()
+	messages, hasMore, found := cr.Messages.GetBefore(beforeID, limit)
+	below := cr.LastSeq + 1
+	if len(messages) > 0 {
+		below = messages[0].Seq
+	} else if oldest, ok := cr.Messages.Oldest(); ok {
+		below = oldest.Seq
+	}
+	cr.MessagesMux.RUnlock()
+
+	if cr.store == nil || hasMore || below <= 1 {
+		return messages, hasMore, found
+	}
+
+	// The store is read unlocked, so a slow one doesn't hold up the room
+	if !found {
+		seq, ok := cr.storedSeq(beforeID, below)
+		if !ok {
+			return messages, false, false
+		}
+		below = seq
+	}
+	older, more, ok := cr.storedBefore(below, limit-len(messages))
+	if !ok {
+		return messages, hasMore, found
+	}
+	return append(older, messages...), more, true
+}
+
+// AddUser adds a user to the room, or counts another connection of a user who is
+// already in it. It reports whether the user is new to the room.
+func (cr *ChatRoom) AddUser(user *ChatUser) bool {
 	cr.UsersMux.Lock()
 	defer cr.UsersMux.Unlock()
 
+	cr.LastActivity = time.Now()
+	if existing, exists := cr.Users[user.UserID]; exists {
+		existing.sessions++
+		existing.Username = user.Username
+		return false
+	}
+
+	user.sessions = 1
 	cr.Users[user.UserID] = user
+	return true
+}
+
+// addSession counts another connection of a user already in the room, reporting
+// false if the user isn't in it
+func (cr *ChatRoom) addSession(userID, username string) bool {
+	cr.UsersMux.Lock()
+	defer cr.UsersMux.Unlock()
+
+	existing, exists := cr.Users[userID]
+	if !exists {
+		return false
+	}
+	existing.sessions++
+	existing.Username = username
 	cr.LastActivity = time.Now()
+	return true
 }
 
-// RemoveUser removes a user from the room
-func (cr *ChatRoom) RemoveUser(userID string) {
+// RemoveUser drops one of a user's connections, removing the user from the room
+// with their last one. It reports whether the user left.
+func (cr *ChatRoom) RemoveUser(userID string) bool {
 	cr.UsersMux.Lock()
 	defer cr.UsersMux.Unlock()
 
+	user, exists := cr.Users[userID]
+	if !exists {
+		return false
+	}
+	if user.sessions--; user.sessions > 0 {
+		return false
+	}
+	cr.forgetUsername(userID, user.Username)
 	delete(cr.Users, userID)
+	return true
 }
 
 // GetUser returns a user by ID
@@ -240,6 +600,23 @@ func (cr *ChatRoom) GetAllUsers() []*ChatUser {
 	return users
 }
 
+// UserBytes returns the memory held by the room's user records
+func (cr *ChatRoom) UserBytes() int64 {
+	cr.UsersMux.RLock()
+	defer cr.UsersMux.RUnlock()
+
+	var total int64
+	for _, user := range cr.Users {
+		total += user.size()
+	}
+	return total
+}
+
+// BytesUsed returns the memory held by the room's messages and users
+func (cr *ChatRoom) BytesUsed() int64 {
+	return cr.Messages.Bytes() + cr.UserBytes()
+}
+
 // UserCount returns the number of users in the room
 func (cr *ChatRoom) UserCount() int {
 	cr.UsersMux.RLock()
@@ -248,28 +625,32 @@ func (cr *ChatRoom) UserCount() int {
 	return len(cr.Users)
 }
 
-// CleanupOldMessages removes messages older than the retention period
+// CleanupOldMessages removes messages older than the retention period from the
+// buffer and the room's store
 func (cr *ChatRoom) CleanupOldMessages(retention time.Duration) int {
 	cr.MessagesMux.Lock()
 	defer cr.MessagesMux.Unlock()
 
-	removed := cr.Messages.RemoveOlderThan(retention)
+	cr.unpersistBefore(time.Now().Add(-retention))
+	return cr.Messages.RemoveOlderThan(retention)
+}
 
-	// Update byte count estimate
-	if removed > 0 {
-		avgMessageSize := int64(500)
-		cr.BytesUsed -= int64(removed) * avgMessageSize
-		if cr.BytesUsed < 0 {
-			cr.BytesUsed = 0
-		}
-	}
+// ClearMessages removes every message from the buffer and the room's store,
+// returning how many were buffered
+func (cr *ChatRoom) ClearMessages() int {
+	cr.MessagesMux.Lock()
+	defer cr.MessagesMux.Unlock()
 
+	removed := cr.Messages.Size()
+	cr.Messages.Clear()
+	cr.unpersistBefore(time.Now())
 	return removed
 }
 
 // MemoryTracker tracks global memory usage
 type MemoryTracker struct {
 	TotalBytes    int64
+	Usage         MemoryUsage // what TotalBytes is made of
 	TotalMessages int64
 	ActiveStreams int
 	MaxBytes      int64
@@ -284,11 +665,12 @@ func NewMemoryTracker(maxMemoryMB int) *MemoryTracker {
 }
 
 // Update updates the memory tracker with current stats
-func (mt *MemoryTracker) Update(bytesUsed int64, messageCount int64, streamCount int) {
+func (mt *MemoryTracker) Update(usage MemoryUsage, messageCount int64, streamCount int) {
 	mt.mutex.Lock()
 	defer mt.mutex.Unlock()
 
-	mt.TotalBytes = bytesUsed
+	mt.TotalBytes = usage.Total()
+	mt.Usage = usage
 	mt.TotalMessages = messageCount
 	mt.ActiveStreams = streamCount
 }
@@ -301,18 +683,29 @@ func (mt *MemoryTracker) GetStats() map[string]interface{} {
 	usagePercent := float64(mt.TotalBytes) / float64(mt.MaxBytes) * 100
 
 	return map[string]interface{}{
-		"total_bytes":       mt.TotalBytes,
-		"total_mb":          float64(mt.TotalBytes) / 1024 / 1024,
-		"max_bytes":         mt.MaxBytes,
-		"max_mb":            float64(mt.MaxBytes) / 1024 / 1024,
-		"usage_percent":     usagePercent,
-		"total_messages":    mt.TotalMessages,
-		"active_streams":    mt.ActiveStreams,
-		"is_near_limit":     usagePercent > 80,
-		"is_critical":       usagePercent > 90,
+		"total_bytes":        mt.TotalBytes,
+		"total_mb":           float64(mt.TotalBytes) / 1024 / 1024,
+		"message_bytes":      mt.Usage.MessageBytes,
+		"user_bytes":         mt.Usage.UserBytes,
+		"rate_limiter_bytes": mt.Usage.RateLimiterBytes,
+		"max_bytes":          mt.MaxBytes,
+		"max_mb":             float64(mt.MaxBytes) / 1024 / 1024,
+		"usage_percent":      usagePercent,
+		"total_messages":     mt.TotalMessages,
+		"active_streams":     mt.ActiveStreams,
+		"is_near_limit":      usagePercent > 80,
+		"is_critical":        usagePercent > 90,
 	}
 }
 
+// UsagePercent returns the share of the memory limit in use, in percent
+func (mt *MemoryTracker) UsagePercent() float64 {
+	mt.mutex.RLock()
+	defer mt.mutex.RUnlock()
+
+	return float64(mt.TotalBytes) / float64(mt.MaxBytes) * 100
+}
+
 // IsNearLimit returns true if memory usage is above 80%
 func (mt *MemoryTracker) IsNearLimit() bool {
 	mt.mutex.RLock()
@@ -0,0 +1,127 @@
+package chat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCircularBufferGetBefore(t *testing.T) {
+	cb := NewCircularBuffer(5)
+	for i := 0; i < 7; i++ {
+		cb.Add(ChatMessage{ID: strconv.Itoa(i)})
+	}
+
+	// Buffer now holds 2..6
+	page, hasMore, found := cb.GetBefore("", 2)
+	require.True(t, found)
+	require.True(t, hasMore)
+	require.Equal(t, []string{"5", "6"}, messageIDs(page))
+
+	page, hasMore, found = cb.GetBefore("5", 10)
+	require.True(t, found)
+	require.False(t, hasMore)
+	require.Equal(t, []string{"2", "3", "4"}, messageIDs(page))
+
+	_, _, found = cb.GetBefore("0", 2)
+	require.False(t, found)
+}
+
+func TestChatRoomMessagesAfter(t *testing.T) {
+	room := NewChatRoom("room", 5)
+	for i := 0; i < 7; i++ {
+		require.Equal(t, int64(i+1), room.AddMessage(ChatMessage{ID: strconv.Itoa(i)}))
+	}
+
+	// Buffer now holds seq 3..7
+	messages, complete := room.GetMessagesAfter(4, maxPageSize)
+	require.True(t, complete)
+	require.Equal(t, []string{"4", "5", "6"}, messageIDs(messages))
+
+	// Replays are cut at the limit, which the client pages past
+	messages, complete = room.GetMessagesAfter(4, 2)
+	require.False(t, complete)
+	require.Equal(t, []string{"4", "5"}, messageIDs(messages))
+
+	messages, complete = room.GetMessagesAfter(7, maxPageSize)
+	require.True(t, complete)
+	require.Empty(t, messages)
+
+	messages, complete = room.GetMessagesAfter(1, maxPageSize)
+	require.False(t, complete)
+	require.Len(t, messages, 5)
+
+	// Numbering restarted, e.g. the room was purged and recreated
+	messages, complete = room.GetMessagesAfter(50, maxPageSize)
+	require.False(t, complete)
+	require.Len(t, messages, 5)
+}
+
+func TestChatRoomBufferSelfTuning(t *testing.T) {
+	room := NewAutoSizedChatRoom("room", 4, 16, time.Hour)
+	require.Equal(t, 4, room.Messages.Capacity())
+
+	// A burst of recent messages grows the buffer instead of evicting them
+	for i := 0; i < 10; i++ {
+		room.AddMessage(ChatMessage{ID: strconv.Itoa(i), Timestamp: time.Now()})
+	}
+	require.Equal(t, 16, room.Messages.Capacity())
+	require.Equal(t, 10, room.Messages.Size())
+
+	// Once retention empties the room, the buffer shrinks back one step at a time
+	room.CleanupOldMessages(0)
+	require.Equal(t, 8, room.ShrinkBuffer())
+	require.Equal(t, 4, room.ShrinkBuffer())
+	require.Equal(t, 4, room.ShrinkBuffer())
+}
+
+func TestCircularBufferResizeKeepsNewest(t *testing.T) {
+	cb := NewCircularBuffer(4)
+	for i := 0; i < 6; i++ {
+		cb.Add(ChatMessage{ID: strconv.Itoa(i)})
+	}
+
+	cb.Resize(2)
+	require.Equal(t, []string{"4", "5"}, messageIDs(cb.GetAll()))
+
+	cb.Resize(3)
+	cb.Add(ChatMessage{ID: "6"})
+	cb.Add(ChatMessage{ID: "7"})
+	require.Equal(t, []string{"5", "6", "7"}, messageIDs(cb.GetAll()))
+}
+
+func messageIDs(messages []ChatMessage) []string {
+	ids := make([]string, len(messages))
+	for i, msg := range messages {
+		ids[i] = msg.ID
+	}
+	return ids
+}
+
+func TestCircularBufferTracksBytes(t *testing.T) {
+	cb := NewCircularBuffer(2)
+	require.Equal(t, 2*messageSlotSize, cb.Bytes())
+
+	old := ChatMessage{ID: "1", Message: "hello", Timestamp: time.Now().Add(-time.Hour)}
+	mid := ChatMessage{ID: "2", Message: "a bit longer", Timestamp: time.Now().Add(-time.Hour)}
+	bridged := ChatMessage{ID: "3", Message: "hi", Timestamp: time.Now(), Origin: &MessageOrigin{System: "irc", ID: "42"}}
+	require.Equal(t, int64(len("2")+len("a bit longer")), messageSize(mid))
+	require.Equal(t, int64(len("3")+len("hi")+len("irc")+len("42"))+originSize, messageSize(bridged))
+
+	// Evicting the oldest message gives its bytes back
+	cb.Add(old)
+	cb.Add(mid)
+	cb.Add(bridged)
+	require.Equal(t, 2*messageSlotSize+messageSize(mid)+messageSize(bridged), cb.Bytes())
+
+	cb.RemoveOlderThan(time.Minute)
+	require.Equal(t, 2*messageSlotSize+messageSize(bridged), cb.Bytes())
+
+	cb.Resize(4)
+	require.Equal(t, 4*messageSlotSize+messageSize(bridged), cb.Bytes())
+
+	cb.Clear()
+	require.Equal(t, 4*messageSlotSize, cb.Bytes())
+}
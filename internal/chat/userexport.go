@@ -0,0 +1,179 @@
+package chat
+
+import (
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// UserMessageReader is implemented by message stores that can find one user's
+// messages across every room
+type UserMessageReader interface {
+	// UserMessages returns every message the user sent that is still stored
+	UserMessages(userID string) ([]ChatMessage, error)
+}
+
+// UserDataExport is everything the server keeps about a user, for data access
+// requests
+type UserDataExport struct {
+	UserID     string                   `json:"userId"`
+	ExportedAt time.Time                `json:"exportedAt"`
+	Profile    UserProfile              `json:"profile"`
+	Messages   []ChatMessage            `json:"messages"`    // oldest first, from room buffers and the message store
+	Tombstones []Tombstone              `json:"tombstones"`  // deletions and edits of the messages
+	Rooms      []UserPresence           `json:"rooms"`       // rooms the user is in now
+	Joins      []time.Time              `json:"recentJoins"` // joins within the join rate window
+	Activity   map[string]UserAggregate `json:"activity"`    // chat wrapped aggregates by stream key
+	Moderation UserModeration           `json:"moderation"`
+}
+
+// UserPresence is a user's membership of a room, as the room sees it
+type UserPresence struct {
+	StreamKey string `json:"streamKey"`
+	ChatUser
+}
+
+// UserModeration is the moderation state kept about a user
+type UserModeration struct {
+	RateLimit         *RateLimitState `json:"rateLimit,omitempty"`
+	SavedTimeout      *SavedTimeout   `json:"savedTimeout,omitempty"`
+	SessionsRevokedAt *time.Time      `json:"sessionsRevokedAt,omitempty"`
+}
+
+// ExportUserData gathers what the manager keeps about a user: their messages in
+// every room's buffer and in the message store, their profile, the rooms they are
+// in, their recent joins, chat wrapped aggregates and rate limit state, including
+// any saved timeout. The error is the first store failure; the export holds everything else
+// regardless.
+func (m *Manager) ExportUserData(userID string) (UserDataExport, error) {
+	export := UserDataExport{
+		UserID:     userID,
+		ExportedAt: time.Now(),
+		Messages:   []ChatMessage{},
+		Tombstones: []Tombstone{},
+		Rooms:      []UserPresence{},
+		Joins:      m.membership.RecentJoins(userID),
+		Activity:   m.userStats.UserActivity(userID),
+	}
+	var firstErr error
+
+	profile, err := m.Profile(userID)
+	if err != nil {
+		firstErr = err
+	}
+	export.Profile = profile
+
+	// Buffered messages may be stored too, so the store's copies are matched by ID
+	seen := make(map[string]bool)
+	for _, room := range m.allRooms() {
+		for _, msg := range room.GetMessages(0) {
+			if msg.UserID == userID && !seen[msg.ID] {
+				seen[msg.ID] = true
+				export.Messages = append(export.Messages, msg)
+			}
+		}
+
+		room.UsersMux.RLock()
+		if user, exists := room.Users[userID]; exists {
+			export.Rooms = append(export.Rooms, UserPresence{StreamKey: room.StreamKey, ChatUser: *user})
+		}
+		room.UsersMux.RUnlock()
+	}
+
+	if store := m.persistence(); store != nil {
+		if reader, ok := store.(UserMessageReader); ok {
+			stored, err := reader.UserMessages(userID)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			for _, msg := range stored {
+				if !seen[msg.ID] {
+					seen[msg.ID] = true
+					export.Messages = append(export.Messages, msg)
+				}
+			}
+		} else {
+			log.Printf("Chat store %T can't find a user's messages, exporting buffered ones only", store)
+		}
+	}
+	sort.SliceStable(export.Messages, func(i, j int) bool {
+		return export.Messages[i].Timestamp.Before(export.Messages[j].Timestamp)
+	})
+
+	if tombstones, ok := m.persistence().(TombstoneStore); ok {
+		rooms := make(map[string]bool)
+		for _, msg := range export.Messages {
+			rooms[msg.StreamKey] = true
+		}
+		for streamKey := range rooms {
+			saved, err := tombstones.Tombstones(streamKey)
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			for _, tombstone := range saved {
+				if seen[tombstone.MessageID] {
+					export.Tombstones = append(export.Tombstones, tombstone)
+				}
+			}
+		}
+		sort.SliceStable(export.Tombstones, func(i, j int) bool {
+			return export.Tombstones[i].Timestamp.Before(export.Tombstones[j].Timestamp)
+		})
+	}
+
+	m.hooksMux.RLock()
+	rl := m.rateLimiter
+	m.hooksMux.RUnlock()
+	if rl != nil {
+		if state, exists := rl.State(userID); exists {
+			export.Moderation.RateLimit = &state
+		}
+		if store := rl.timeouts(); store != nil {
+			timeouts, err := store.LoadTimeouts()
+			if err != nil && firstErr == nil {
+				firstErr = err
+			}
+			for _, timeout := range timeouts {
+				if timeout.UserID == userID {
+					export.Moderation.SavedTimeout = &timeout
+				}
+			}
+		}
+	}
+
+	return export, firstErr
+}
+
+// ExportUserData exports a user's data like Manager.ExportUserData, adding when
+// their sessions were last revoked
+func (h *WSHandler) ExportUserData(userID string) (UserDataExport, error) {
+	export, err := h.manager.ExportUserData(userID)
+	if revokedAt, ok := h.revocations.RevokedAt(userID); ok {
+		export.Moderation.SessionsRevokedAt = &revokedAt
+	}
+	return export, err
+}
+
+// ExportUserHandler serves GET /api/chat/admin/users/{userID}/export, a JSON
+// download of everything stored about a user
+func (h *WSHandler) ExportUserHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID := r.PathValue("userID")
+	if userID == "" {
+		http.Error(w, "Missing userID", http.StatusBadRequest)
+		return
+	}
+
+	export, err := h.ExportUserData(userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="chat-user-`+exportFilename(userID)+`.json"`)
+	writeJSON(w, http.StatusOK, export)
+}
@@ -0,0 +1,57 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportUserData(t *testing.T) {
+	h, server := newTestHandler(t)
+	m := h.manager
+	store := NewMemoryStore()
+	m.SetMessageStore(store)
+	m.SetRateLimiter(h.rateLimiter)
+	h.rateLimiter.SetTimeoutStore(store)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	// Messages only the store still holds are exported alongside buffered ones
+	require.NoError(t, store.Append(ChatMessage{ID: "old", StreamKey: "gone", UserID: "alice", Message: "from last week", Timestamp: time.Now().Add(-7 * 24 * time.Hour)}))
+	_, err := m.AddMessage("room", "alice", "alice", "hello")
+	require.NoError(t, err)
+	_, err = m.AddMessage("room", "bob", "bob", "not alice's")
+	require.NoError(t, err)
+
+	record := h.rateLimiter.lockRecord("alice")
+	record.TimeoutUntil = time.Now().Add(time.Hour)
+	record.TimeoutTier = TierSpam
+	h.rateLimiter.watchTimeout(record, time.Time{})
+	record.mu.Unlock()
+	h.revocations.Revoke("alice", time.Now())
+
+	r := httptest.NewRequest(http.MethodGet, "/api/chat/admin/users/alice/export", nil)
+	r.SetPathValue("userID", "alice")
+	w := httptest.NewRecorder()
+	h.ExportUserHandler(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `attachment; filename="chat-user-alice.json"`, w.Header().Get("Content-Disposition"))
+
+	var export UserDataExport
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &export))
+	require.Equal(t, "alice", export.UserID)
+	require.Equal(t, []string{"from last week", "hello"}, messageTexts(export.Messages))
+	require.Len(t, export.Rooms, 1)
+	require.Equal(t, "room", export.Rooms[0].StreamKey)
+	require.Equal(t, "alice", export.Rooms[0].UserID)
+	require.Len(t, export.Joins, 1)
+	require.Equal(t, 1, export.Activity["room"].Messages)
+	require.True(t, export.Moderation.RateLimit.TimedOut)
+	require.Equal(t, TierSpam, export.Moderation.SavedTimeout.Tier)
+	require.NotNil(t, export.Moderation.SessionsRevokedAt)
+}
@@ -0,0 +1,112 @@
+package chat
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Username collision policies, for a join whose name looks like that of another
+// user in the room
+const (
+	UsernameSuffix = "suffix" // join under the name with the lowest free number appended
+	UsernameReject = "reject" // refuse the join with USERNAME_TAKEN
+	UsernameAllow  = "allow"  // don't check names
+)
+
+// usernameConfusables maps characters that pass for Latin letters, once folded to
+// lower case, onto the letter they imitate
+var usernameConfusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'l', 'ї': 'l', 'ј': 'j', 'к': 'k',
+	'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c', 'ѕ': 's', 'т': 't', 'у': 'y', 'х': 'x',
+	'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w', 'ɡ': 'g',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'l', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p',
+	'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w',
+	// Digits and Latin letters easily mistaken for each other
+	'0': 'o', '1': 'l', 'i': 'l', 'ı': 'l',
+}
+
+// FoldUsername reduces a display name to the form two names that look alike share:
+// compatibility forms and accents are stripped, case is folded, lookalike letters
+// and digits are mapped onto one letter, and everything but letters and digits is
+// dropped, so "ｓｔｒｅａｍｅｒ", "Stréamer_" and "Strеamеr" spelled with Cyrillic
+// e's all fold to "streamer".
+func FoldUsername(name string) string {
+	var b strings.Builder
+	for _, r := range norm.NFKD.String(name) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		r = unicode.ToLower(r)
+		if mapped, ok := usernameConfusables[r]; ok {
+			r = mapped
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+
+	folded := b.String()
+	folded = strings.ReplaceAll(folded, "rn", "m")
+	folded = strings.ReplaceAll(folded, "vv", "w")
+	return folded
+}
+
+// claimUsername gives a user a display name in the room, one that no other user
+// in it shares once folded. A taken name is numbered, or refused, as the policy
+// says. The name is held for the user until releaseUsername, or until the user
+// leaves the room.
+func (cr *ChatRoom) claimUsername(userID, username, policy string) (string, error) {
+	folded := FoldUsername(username)
+	if policy == UsernameAllow || folded == "" {
+		return username, nil
+	}
+
+	cr.UsersMux.Lock()
+	defer cr.UsersMux.Unlock()
+
+	if cr.names == nil {
+		cr.names = make(map[string]string)
+	}
+
+	name := username
+	for n := 2; ; n++ {
+		if holder, taken := cr.names[folded]; !taken || holder == userID {
+			break
+		}
+		if policy == UsernameReject {
+			return "", ErrUsernameTaken
+		}
+		name = username + strconv.Itoa(n)
+		folded = FoldUsername(name)
+	}
+
+	// A user holds one name per room; a reconnect under a new one gives up the old
+	if user, exists := cr.Users[userID]; exists {
+		cr.forgetUsername(userID, user.Username)
+	}
+	cr.names[folded] = userID
+	return name, nil
+}
+
+// releaseUsername gives up a name claimed for a join that didn't go through
+func (cr *ChatRoom) releaseUsername(userID, username string) {
+	cr.UsersMux.Lock()
+	defer cr.UsersMux.Unlock()
+
+	if _, joined := cr.Users[userID]; !joined {
+		cr.forgetUsername(userID, username)
+	}
+}
+
+// forgetUsername drops a user's hold on a name. Callers must hold UsersMux.
+func (cr *ChatRoom) forgetUsername(userID, username string) {
+	folded := FoldUsername(username)
+	if cr.names[folded] == userID {
+		delete(cr.names, folded)
+	}
+}
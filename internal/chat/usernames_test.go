@@ -0,0 +1,79 @@
+package chat
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFoldUsername(t *testing.T) {
+	for _, lookalike := range []string{"Streamer", "STREAMER", "ｓｔｒｅａｍｅｒ", "Stréamer_", "Strеamеr", "stream.er", "Str​eamer"} {
+		require.Equal(t, "streamer", FoldUsername(lookalike), lookalike)
+	}
+	require.Equal(t, FoldUsername("modbot"), FoldUsername("M0DB0T"))
+	require.Equal(t, FoldUsername("Bill"), FoldUsername("BiIl"))
+	require.Equal(t, FoldUsername("mike"), FoldUsername("rnike"))
+	require.NotEqual(t, FoldUsername("streamer"), FoldUsername("streamers"))
+	require.Empty(t, FoldUsername("___"))
+}
+
+func TestUsernameCollisions(t *testing.T) {
+	config := DefaultConfig()
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+
+	name, _, err := manager.joinUser("room", "broadcaster", "Streamer", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Streamer", name)
+
+	// Lookalikes are numbered, and reconnecting keeps the user's own name
+	name, _, err = manager.joinUser("room", "impostor", "Strеamer", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Strеamer2", name)
+	name, _, err = manager.joinUser("room", "third", "streamer", nil)
+	require.NoError(t, err)
+	require.Equal(t, "streamer3", name)
+	name, first, err := manager.joinUser("room", "broadcaster", "Streamer", nil)
+	require.NoError(t, err)
+	require.False(t, first)
+	require.Equal(t, "Streamer", name)
+
+	// Other rooms don't care
+	name, _, err = manager.joinUser("other", "impostor", "Streamer", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Streamer", name)
+
+	// The name is free again once its holder's last connection leaves
+	require.False(t, manager.leaveUser("room", "broadcaster"))
+	require.True(t, manager.leaveUser("room", "broadcaster"))
+	name, _, err = manager.joinUser("room", "newcomer", "streamer", nil)
+	require.NoError(t, err)
+	require.Equal(t, "streamer", name)
+
+	config.UsernameCollision = UsernameReject
+	_, _, err = manager.joinUser("room", "fourth", "STREAMER", nil)
+	require.ErrorIs(t, err, ErrUsernameTaken)
+	require.Len(t, manager.GetUsers("room"), 3)
+
+	config.UsernameCollision = UsernameAllow
+	name, _, err = manager.joinUser("room", "fourth", "STREAMER", nil)
+	require.NoError(t, err)
+	require.Equal(t, "STREAMER", name)
+}
+
+func TestUsernameReleasedWhenJoinFails(t *testing.T) {
+	config := DefaultConfig()
+	config.MaxUsersPerStream = 1
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+
+	_, _, err := manager.joinUser("room", "alice", "alice", nil)
+	require.NoError(t, err)
+	_, _, err = manager.joinUser("room", "bob", "bob", nil)
+	require.ErrorIs(t, err, ErrRoomFull)
+
+	manager.leaveUser("room", "alice")
+	name, _, err := manager.joinUser("room", "carol", "Bob", nil)
+	require.NoError(t, err)
+	require.Equal(t, "Bob", name)
+}
@@ -0,0 +1,260 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+const (
+	maxProfileBadges        = 16
+	maxProfileBadgeLength   = 32
+	maxProfilePreferences   = 32
+	maxPreferenceKeyLength  = 64
+	maxPreferenceValueBytes = 256
+	maxProfileBodySize      = 8 * 1024
+)
+
+// profileColorPattern matches the #rrggbb name colors users may choose
+var profileColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// UserProfile is what follows a user across connections and restarts, rather than
+// living on the ChatUser of each room they are in
+type UserProfile struct {
+	UserID      string            `json:"userId"`
+	Color       string            `json:"color,omitempty"`       // name color as #rrggbb
+	Badges      []string          `json:"badges,omitempty"`      // badge entitlements, granted by admins
+	Preferences map[string]string `json:"preferences,omitempty"` // notification and other client preferences, opaque to the server
+	UpdatedAt   time.Time         `json:"updatedAt"`
+}
+
+// fieldErrors describes what makes a profile invalid, rejecting profiles clients
+// could abuse to bloat storage or broadcasts
+func (p UserProfile) fieldErrors() []FieldError {
+	var errs []FieldError
+	if p.Color != "" && !profileColorPattern.MatchString(p.Color) {
+		errs = append(errs, FieldError{Field: "color", Message: "must be a #rrggbb hex color"})
+	}
+	if len(p.Badges) > maxProfileBadges {
+		errs = append(errs, FieldError{Field: "badges", Message: fmt.Sprintf("must hold at most %d badges", maxProfileBadges)})
+	}
+	for _, badge := range p.Badges {
+		if badge == "" || len(badge) > maxProfileBadgeLength {
+			errs = append(errs, FieldError{Field: "badges", Message: fmt.Sprintf("must be 1 to %d characters each", maxProfileBadgeLength)})
+			break
+		}
+	}
+	if len(p.Preferences) > maxProfilePreferences {
+		errs = append(errs, FieldError{Field: "preferences", Message: fmt.Sprintf("must hold at most %d preferences", maxProfilePreferences)})
+	}
+	for key, value := range p.Preferences {
+		if key == "" || len(key) > maxPreferenceKeyLength || len(value) > maxPreferenceValueBytes {
+			errs = append(errs, FieldError{Field: "preferences", Message: fmt.Sprintf("must have names of 1 to %d characters and values of at most %d bytes", maxPreferenceKeyLength, maxPreferenceValueBytes)})
+			break
+		}
+	}
+	return errs
+}
+
+// validate returns an error describing the first problem with a profile
+func (p UserProfile) validate() error {
+	if errs := p.fieldErrors(); len(errs) > 0 {
+		return fmt.Errorf("%s %s", errs[0].Field, errs[0].Message)
+	}
+	return nil
+}
+
+// empty reports whether the profile holds nothing worth keeping
+func (p UserProfile) empty() bool {
+	return p.Color == "" && len(p.Badges) == 0 && len(p.Preferences) == 0
+}
+
+// ProfileStore is implemented by message stores that also keep user profiles, so
+// they survive restarts and are shared by every instance using the store
+type ProfileStore interface {
+	// SaveProfile records a user's profile, replacing what was saved before
+	SaveProfile(profile UserProfile) error
+	// LoadProfile returns a user's profile, if one was saved
+	LoadProfile(userID string) (UserProfile, bool, error)
+	// DeleteProfile forgets a user's profile
+	DeleteProfile(userID string) error
+}
+
+// profileStore returns the message store if it keeps profiles, or the in-memory
+// store that keeps them across reconnects otherwise
+func (m *Manager) profileStore() ProfileStore {
+	if profiles, ok := m.persistence().(ProfileStore); ok {
+		return profiles
+	}
+	return m.profiles
+}
+
+// Profile returns a user's profile, empty if they have none
+func (m *Manager) Profile(userID string) (UserProfile, error) {
+	profile, exists, err := m.profileStore().LoadProfile(userID)
+	if err != nil || !exists {
+		return UserProfile{UserID: userID}, err
+	}
+	return profile, nil
+}
+
+// UpdateProfile changes a user's profile with fn and saves the result if it is
+// valid, deleting profiles left empty. The rooms the user is in show their new
+// color and badges at once.
+func (m *Manager) UpdateProfile(userID string, fn func(*UserProfile)) (UserProfile, error) {
+	profile, err := m.Profile(userID)
+	if err != nil {
+		return UserProfile{}, err
+	}
+
+	fn(&profile)
+	profile.UserID = userID
+	if err := profile.validate(); err != nil {
+		return UserProfile{}, err
+	}
+	profile.UpdatedAt = time.Now()
+
+	store := m.profileStore()
+	if profile.empty() {
+		err = store.DeleteProfile(userID)
+	} else {
+		err = store.SaveProfile(profile)
+	}
+	if err != nil {
+		return UserProfile{}, err
+	}
+
+	// Users are replaced rather than changed, since user lists are encoded unlocked
+	for _, room := range m.liveRooms() {
+		room.UsersMux.Lock()
+		if user, exists := room.Users[userID]; exists {
+			updated := *user
+			updated.applyProfile(profile)
+			room.Users[userID] = &updated
+		}
+		room.UsersMux.Unlock()
+	}
+	return profile, nil
+}
+
+// profileFor returns a user's profile for showing them in rooms, logging rather
+// than failing on store errors
+func (m *Manager) profileFor(userID string) UserProfile {
+	profile, err := m.Profile(userID)
+	if err != nil {
+		log.Printf("Failed to load chat profile for %s: %v", userID, err)
+	}
+	return profile
+}
+
+// applyProfile shows what the user's profile says about them to the room
+func (u *ChatUser) applyProfile(profile UserProfile) {
+	u.Color = profile.Color
+	u.Badges = renderBadges(u.Roles, profile.Badges)
+}
+
+// userEvent describes a user to their rooms, with what their profile shows
+func userEvent(userID, username string, profile UserProfile) UserEvent {
+	return UserEvent{UserID: userID, Username: username, Color: profile.Color, Badges: profile.Badges}
+}
+
+// UpdateProfile changes a user's profile like Manager.UpdateProfile, sends the
+// result to the user's connections and tells the rooms they are in
+func (h *WSHandler) UpdateProfile(userID string, fn func(*UserProfile)) (UserProfile, error) {
+	profile, err := h.manager.UpdateProfile(userID, fn)
+	if err != nil {
+		return UserProfile{}, err
+	}
+
+	// Each room gets one update, however many of the user's connections are in it
+	rooms := make(map[string]string) // stream key -> username
+	h.eachConnection(func(conn *Connection) {
+		if conn.UserID != userID {
+			return
+		}
+		conn.deliver(WSMessage{Type: "profile", Data: profile, Timestamp: time.Now()})
+		rooms[conn.StreamKey] = conn.Username
+		for _, streamKey := range conn.joinedRooms() {
+			rooms[streamKey] = conn.Username
+		}
+	})
+	for streamKey, username := range rooms {
+		event := userEvent(userID, username, profile)
+		if room, exists := h.manager.GetRoom(streamKey); exists {
+			if user, exists := room.GetUser(userID); exists {
+				event.Badges = user.Badges
+			}
+		}
+		h.broadcast(streamKey, WSMessage{
+			Type:      "user_updated",
+			Data:      event,
+			Timestamp: time.Now(),
+		}, "")
+	}
+	return profile, nil
+}
+
+// handleSetProfile replaces the user's own color and preferences, which the frame
+// has already validated. Badges are granted by admins and left alone.
+func (c *Connection) handleSetProfile(frame *SetProfileFrame) {
+	if c.UserID == "" {
+		c.sendChatError(ErrNotJoined)
+		return
+	}
+
+	_, err := c.manager.UpdateProfile(c.UserID, func(profile *UserProfile) {
+		profile.Color = frame.Color
+		profile.Preferences = frame.Preferences
+	})
+	if err != nil {
+		log.Printf("Failed to save chat profile for %s: %v", c.UserID, err)
+		c.sendChatError(errors.New("Failed to save your profile"))
+	}
+}
+
+// ProfileHandler serves GET and PUT /api/chat/admin/users/{userID}/profile. PUT
+// replaces the whole profile, including the badges users can't set themselves.
+func (h *WSHandler) ProfileHandler(w http.ResponseWriter, r *http.Request) {
+	userID := r.PathValue("userID")
+	if userID == "" {
+		http.Error(w, "Missing userID", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		profile, err := h.manager.Profile(userID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+
+	case http.MethodPut:
+		var update UserProfile
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxProfileBodySize)).Decode(&update); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := update.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		profile, err := h.UpdateProfile(userID, func(profile *UserProfile) {
+			*profile = update
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		writeJSON(w, http.StatusOK, profile)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilesSurviveReconnects(t *testing.T) {
+	_, server := newTestHandler(t)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+	bob := dialTestClient(t, server, "room")
+	joinTestClient(t, bob, "bob")
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "set_profile",
+		"data": map[string]interface{}{"color": "#ff8800", "preferences": map[string]interface{}{"mentions": "sound"}},
+	}))
+	profile := readUntil(t, alice, "profile")["data"].(map[string]interface{})
+	require.Equal(t, "#ff8800", profile["color"])
+	updated := readUntil(t, bob, "user_updated")["data"].(map[string]interface{})
+	require.Equal(t, "alice", updated["userId"])
+	require.Equal(t, "#ff8800", updated["color"])
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "set_profile",
+		"data": map[string]interface{}{"color": "orange"},
+	}))
+	require.Equal(t, ErrInvalidFrame.Code, readUntil(t, alice, "error")["code"])
+
+	// A new connection as alice gets her profile back, and the room shows her color
+	require.NoError(t, alice.Close())
+	readUntil(t, bob, "user_left")
+	alice = dialTestClient(t, server, "room")
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{"userId": "alice", "username": "alice"},
+	}))
+	users := readUntil(t, alice, "users")["data"].([]interface{})
+	colors := map[string]interface{}{}
+	for _, user := range users {
+		user := user.(map[string]interface{})
+		colors[user["userId"].(string)] = user["color"]
+	}
+	require.Equal(t, "#ff8800", colors["alice"])
+	preferences := readUntil(t, alice, "profile")["data"].(map[string]interface{})["preferences"]
+	require.Equal(t, map[string]interface{}{"mentions": "sound"}, preferences)
+	require.Equal(t, "#ff8800", readUntil(t, bob, "user_joined")["data"].(map[string]interface{})["color"])
+}
+
+func TestProfileHandlerGrantsBadges(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(body))
+		r.SetPathValue("userID", "alice")
+		w := httptest.NewRecorder()
+		h.ProfileHandler(w, r)
+		return w
+	}
+
+	w := put(`{"badges":["founder","moderator"],"color":"#00ff00"}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	w = put(`{"badges":["` + strings.Repeat("x", maxProfileBadgeLength+1) + `"]}`)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+
+	profile, err := h.manager.Profile("alice")
+	require.NoError(t, err)
+	require.Equal(t, []string{"founder", "moderator"}, profile.Badges)
+	require.Equal(t, "#00ff00", profile.Color)
+
+	_, _, err = h.manager.joinUser("room", "alice", "alice", nil)
+	require.NoError(t, err)
+	room, _ := h.manager.GetRoom("room")
+	user, _ := room.GetUser("alice")
+	require.Equal(t, []string{"founder"}, user.Badges, "a role's badge is only shown to holders of the role")
+
+	// Clearing everything deletes the profile
+	require.Equal(t, http.StatusOK, put(`{}`).Code)
+	_, exists, err := h.manager.profileStore().LoadProfile("alice")
+	require.NoError(t, err)
+	require.False(t, exists)
+	user, _ = room.GetUser("alice")
+	require.Empty(t, user.Badges)
+}
@@ -0,0 +1,115 @@
+package chat
+
+import (
+	"sync"
+	"time"
+)
+
+// ViewerCountEvent is the data of viewer_count_changed events and frames
+type ViewerCountEvent struct {
+	StreamKey string `json:"streamKey"`
+	Count     int    `json:"count"` // joined users plus read-only subscribers and guests
+}
+
+// viewerCounter collects rooms whose audience changed so counts are published at
+// most once per debounce interval
+type viewerCounter struct {
+	dirty  map[string]struct{}
+	last   map[string]int // streamKey -> last published count
+	guests map[string]int // streamKey -> guests watching without having chatted
+	mutex  sync.Mutex
+}
+
+func newViewerCounter() *viewerCounter {
+	return &viewerCounter{
+		dirty:  make(map[string]struct{}),
+		last:   make(map[string]int),
+		guests: make(map[string]int),
+	}
+}
+
+// addGuest counts guests arriving in, or leaving, a room
+func (vc *viewerCounter) addGuest(streamKey string, delta int) {
+	vc.mutex.Lock()
+	defer vc.mutex.Unlock()
+
+	if vc.guests[streamKey] += delta; vc.guests[streamKey] <= 0 {
+		delete(vc.guests, streamKey)
+	}
+}
+
+// touchViewerCount marks a room's audience as changed
+func (h *WSHandler) touchViewerCount(streamKey string) {
+	h.viewerCounts.mutex.Lock()
+	h.viewerCounts.dirty[streamKey] = struct{}{}
+	h.viewerCounts.mutex.Unlock()
+}
+
+// ViewerCount returns the number of users, read-only subscribers and guests in a room
+func (h *WSHandler) ViewerCount(streamKey string) int {
+	h.subMux.RLock()
+	subscribers := len(h.subscribers[streamKey])
+	h.subMux.RUnlock()
+
+	h.viewerCounts.mutex.Lock()
+	guests := h.viewerCounts.guests[streamKey]
+	h.viewerCounts.mutex.Unlock()
+
+	return h.manager.GetUserCount(streamKey) + subscribers + guests
+}
+
+// viewerCountWorker publishes changed viewer counts once per debounce interval
+func (h *WSHandler) viewerCountWorker(interval time.Duration) {
+	defer trackWorker("ws.viewerCount")()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		h.flushViewerCounts()
+	}
+}
+
+// flushViewerCounts publishes the count of every touched room whose count changed
+func (h *WSHandler) flushViewerCounts() {
+	vc := h.viewerCounts
+
+	vc.mutex.Lock()
+	dirty := vc.dirty
+	vc.dirty = make(map[string]struct{})
+	vc.mutex.Unlock()
+
+	for streamKey := range dirty {
+		count := h.ViewerCount(streamKey)
+
+		vc.mutex.Lock()
+		last, published := vc.last[streamKey]
+		if count == 0 {
+			delete(vc.last, streamKey)
+		} else {
+			vc.last[streamKey] = count
+		}
+		vc.mutex.Unlock()
+
+		if published && count == last || !published && count == 0 {
+			continue
+		}
+		h.manager.SetViewerCount(streamKey, count)
+
+		event := ViewerCountEvent{StreamKey: streamKey, Count: count}
+		h.events.Publish(Event{Type: EventViewerCountChanged, StreamKey: streamKey, Data: event})
+
+		if h.manager.config.BroadcastViewerCount {
+			h.broadcast(streamKey, WSMessage{
+				Type:      EventViewerCountChanged,
+				Data:      event,
+				Timestamp: time.Now(),
+			}, "")
+		}
+	}
+}
+
+// Events returns the bus chat events are published on
+func (h *WSHandler) Events() *EventBus {
+	return h.events
+}
@@ -0,0 +1,484 @@
+package chat
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	walFilePrefix = "events-"
+	walFileSuffix = ".wal"
+	gzipSuffix    = ".gz"
+	walLineLimit  = 1 << 20 // longest event read back, in bytes
+	walQueueSize  = 1024    // events waiting for the writer before appenders block
+)
+
+// walEphemeralTypes are frames about the moment rather than chat's state: typing,
+// presence and viewer counts. Nothing is rebuilt from them, so they aren't logged.
+var walEphemeralTypes = map[string]bool{
+	"typing":                true,
+	"user_joined":           true,
+	"user_left":             true,
+	"room_stats":            true,
+	EventViewerCountChanged: true,
+}
+
+// walRecord is an event line queued for the log's writer
+type walRecord struct {
+	line []byte     // nil for a barrier, which only waits for the records queued before it
+	done chan error // answered once the line is written, and synced if the log syncs; nil if nobody waits
+}
+
+// EventLog is a write-ahead log of chat events. Every event broadcast or handed to
+// webhooks, ephemeral frames aside, is appended to a local file, one JSON object per
+// line, before anything else sees it, so operators can rebuild state after a crash
+// and feed downstream processors without a database. Files are rotated once they
+// reach a size limit, and the oldest are deleted beyond a count limit. Compaction
+// gzips rotated files.
+//
+// Events are queued for a writer goroutine, which writes whatever has queued up
+// while it was busy with one buffered write and, if syncing, one sync, so
+// concurrent appenders share the cost of committing.
+type EventLog struct {
+	dir      string // "" disables the log
+	maxBytes int64  // 0 never rotates
+	maxFiles int    // 0 keeps every file
+	sync     bool
+
+	records  chan walRecord
+	stopped  chan struct{} // closed once the writer has written everything and closed the file
+	closed   bool
+	closeErr error
+	closeMux sync.RWMutex // held to queue records, and exclusively to close
+
+	// Only the writer touches these once it has started
+	file   *os.File
+	writer *bufio.Writer
+	size   int64 // bytes in the file being written
+
+	index int        // number of the file being written
+	mutex sync.Mutex // guards index, which compression reads
+}
+
+// NewEventLog opens an event log in dir, continuing its newest file. It rotates
+// files at maxBytes and keeps at most maxFiles of them; with sync set, every event
+// is synced to disk before Append returns. With an empty dir it logs nothing.
+func NewEventLog(dir string, maxBytes int64, maxFiles int, sync bool) (*EventLog, error) {
+	l := &EventLog{dir: dir, maxBytes: maxBytes, maxFiles: maxFiles, sync: sync}
+	if dir == "" {
+		return l, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	indexes, err := walIndexes(dir)
+	if err != nil {
+		return nil, err
+	}
+	index := 1
+	if len(indexes) > 0 {
+		index = indexes[len(indexes)-1]
+	}
+	if err := l.open(index); err != nil {
+		return nil, err
+	}
+
+	l.records = make(chan walRecord, walQueueSize)
+	l.stopped = make(chan struct{})
+	go l.run()
+	return l, nil
+}
+
+// Enabled reports whether events are being logged
+func (l *EventLog) Enabled() bool {
+	return l.dir != ""
+}
+
+// Append queues an event for the end of the log. With sync set it waits until the
+// event is on disk; otherwise a write failure is only logged.
+func (l *EventLog) Append(eventType, streamKey string, data interface{}) error {
+	if !l.Enabled() {
+		return nil
+	}
+
+	line, err := json.Marshal(WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		StreamKey: streamKey,
+		Data:      data,
+		Timestamp: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	record := walRecord{line: line}
+	if l.sync {
+		record.done = make(chan error, 1)
+	}
+	return l.queue(record)
+}
+
+// Flush waits until every event appended so far is written, and synced if the log
+// syncs, so readers of its files see them
+func (l *EventLog) Flush() error {
+	if !l.Enabled() {
+		return nil
+	}
+	return l.queue(walRecord{done: make(chan error, 1)})
+}
+
+// queue hands a record to the writer, waiting for it to be written if anyone waits
+func (l *EventLog) queue(record walRecord) error {
+	l.closeMux.RLock()
+	if l.closed {
+		l.closeMux.RUnlock()
+		return errors.New("chat event log is closed")
+	}
+	l.records <- record
+	l.closeMux.RUnlock()
+
+	if record.done == nil {
+		return nil
+	}
+	return <-record.done
+}
+
+// Close writes the events still queued and closes the file being written
+func (l *EventLog) Close() error {
+	if !l.Enabled() {
+		return nil
+	}
+
+	l.closeMux.Lock()
+	if l.closed {
+		l.closeMux.Unlock()
+		return nil
+	}
+	l.closed = true
+	close(l.records)
+	l.closeMux.Unlock()
+
+	<-l.stopped
+	return l.closeErr
+}
+
+// run writes queued records until the log is closed. Records queued while a group
+// was being written are written together as the next group.
+func (l *EventLog) run() {
+	defer trackWorker("wal.writer")()
+	defer close(l.stopped)
+
+	for record := range l.records {
+		batch := []walRecord{record}
+	gather:
+		for len(batch) < walQueueSize {
+			select {
+			case next, ok := <-l.records:
+				if !ok {
+					break gather
+				}
+				batch = append(batch, next)
+			default:
+				break gather
+			}
+		}
+
+		err := l.write(batch)
+		if err != nil && !l.sync {
+			log.Printf("Failed to write to the chat event log: %v", err)
+		}
+		for _, record := range batch {
+			if record.done != nil {
+				record.done <- err
+			}
+		}
+	}
+
+	if l.file != nil {
+		if err := l.writer.Flush(); err != nil {
+			l.closeErr = err
+		}
+		if err := l.file.Close(); err != nil && l.closeErr == nil {
+			l.closeErr = err
+		}
+	}
+}
+
+// write appends a group of records to the log, rotating first whenever the next
+// one would take the current file past its size limit, then flushes and, if the
+// log syncs, syncs them
+func (l *EventLog) write(batch []walRecord) error {
+	for _, record := range batch {
+		if record.line == nil {
+			continue
+		}
+		if l.file == nil {
+			return errors.New("chat event log has no file open")
+		}
+		if l.maxBytes > 0 && l.size > 0 && l.size+int64(len(record.line)) > l.maxBytes {
+			if err := l.rotate(); err != nil {
+				return err
+			}
+		}
+
+		n, err := l.writer.Write(record.line)
+		l.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	if l.file == nil {
+		return errors.New("chat event log has no file open")
+	}
+	if err := l.writer.Flush(); err != nil {
+		return err
+	}
+	if l.sync {
+		return l.file.Sync()
+	}
+	return nil
+}
+
+// open starts appending to the numbered file
+func (l *EventLog) open(index int) error {
+	file, err := os.OpenFile(walPath(l.dir, index), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	// A crash may have cut the last event short; end it so the next one starts a line
+	if size := info.Size(); size > 0 {
+		if last, err := readLastByte(walPath(l.dir, index), size); err == nil && last != '\n' {
+			if _, err := file.Write([]byte{'\n'}); err != nil {
+				file.Close()
+				return err
+			}
+		}
+	}
+	if info, err = file.Stat(); err != nil {
+		file.Close()
+		return err
+	}
+
+	l.file = file
+	l.writer = bufio.NewWriter(file)
+	l.size = info.Size()
+
+	l.mutex.Lock()
+	l.index = index
+	l.mutex.Unlock()
+	return nil
+}
+
+// readLastByte reads the byte at the end of a file of the given size
+func readLastByte(path string, size int64) (byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	last := make([]byte, 1)
+	_, err = file.ReadAt(last, size-1)
+	return last[0], err
+}
+
+// rotate finishes the current file, starts the next one and deletes the oldest
+// files beyond maxFiles. Only the writer calls it.
+func (l *EventLog) rotate() error {
+	// The group's sync only covers the next file, so this one is synced now
+	if err := l.writer.Flush(); err != nil {
+		return err
+	}
+	if l.sync {
+		if err := l.file.Sync(); err != nil {
+			return err
+		}
+	}
+	if err := l.file.Close(); err != nil {
+		log.Printf("Failed to close chat event log file: %v", err)
+	}
+	l.file = nil
+	if err := l.open(l.index + 1); err != nil {
+		return err
+	}
+
+	if l.maxFiles <= 0 {
+		return nil
+	}
+	indexes, err := walIndexes(l.dir)
+	if err != nil {
+		return err
+	}
+	for len(indexes) > l.maxFiles {
+		for _, path := range []string{walPath(l.dir, indexes[0]), walPath(l.dir, indexes[0]) + gzipSuffix} {
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+		indexes = indexes[1:]
+	}
+	return nil
+}
+
+// Compress gzips the rotated files last written before coldBefore, adding what
+// it did to report
+func (l *EventLog) Compress(coldBefore time.Time, report *CompactionReport) error {
+	if !l.Enabled() {
+		return nil
+	}
+
+	// Rotations due for events already appended happen first
+	if err := l.Flush(); err != nil {
+		return err
+	}
+	l.mutex.Lock()
+	current := l.index
+	l.mutex.Unlock()
+
+	indexes, err := walIndexes(l.dir)
+	if err != nil {
+		return err
+	}
+	for _, index := range indexes {
+		if index >= current {
+			break
+		}
+		path := walPath(l.dir, index)
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // compressed already, or pruned since
+		}
+		if err != nil {
+			return err
+		}
+		if !info.ModTime().Before(coldBefore) {
+			continue
+		}
+
+		reclaimed, err := gzipFile(path)
+		if err != nil {
+			return err
+		}
+		report.FilesCompressed++
+		report.BytesReclaimed += reclaimed
+	}
+	return nil
+}
+
+// walPath is the numbered file of an event log
+func walPath(dir string, index int) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%08d%s", walFilePrefix, index, walFileSuffix))
+}
+
+// walReadPath is the file holding a numbered part of an event log, gzipped or not
+func walReadPath(dir string, index int) string {
+	path := walPath(dir, index)
+	if _, err := os.Stat(path + gzipSuffix); err == nil {
+		return path + gzipSuffix
+	}
+	return path
+}
+
+// walIndexes returns the numbers of an event log's files, oldest first
+func walIndexes(dir string) ([]int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[int]bool)
+	indexes := []int{}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), gzipSuffix)
+		if entry.IsDir() || !strings.HasPrefix(name, walFilePrefix) || !strings.HasSuffix(name, walFileSuffix) {
+			continue
+		}
+		index, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, walFilePrefix), walFileSuffix))
+		if err != nil || seen[index] {
+			continue
+		}
+		seen[index] = true
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	return indexes, nil
+}
+
+// ReadEventLog calls fn with every event in the log in dir, oldest first, stopping
+// at the first error fn returns
+func ReadEventLog(dir string, fn func(WebhookEvent) error) error {
+	indexes, err := walIndexes(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, index := range indexes {
+		if err := readEventLogFile(walReadPath(dir, index), fn); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readEventLogFile calls fn with every event in one file of a log. Lines that
+// don't decode, such as one cut short by a crash, are skipped.
+func readEventLogFile(path string, fn func(WebhookEvent) error) error {
+	reader, err := openMaybeGzipped(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(nil, walLineLimit)
+	for scanner.Scan() {
+		var event WebhookEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			log.Printf("Skipping unreadable chat event in %s: %v", path, err)
+			continue
+		}
+		if err := fn(event); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// logEvent appends an event to the write-ahead log, unless it is ephemeral, logging
+// rather than failing on errors so a full disk doesn't take chat down
+func (h *WSHandler) logEvent(eventType, streamKey string, data interface{}) {
+	if walEphemeralTypes[eventType] {
+		return
+	}
+	if err := h.eventLog.Append(eventType, streamKey, data); err != nil {
+		log.Printf("Failed to append %s event to the chat event log: %v", eventType, err)
+	}
+}
+
+// CloseEventLog writes the events still queued for the write-ahead log and closes
+// it, for shutdown
+func (h *WSHandler) CloseEventLog() error {
+	return h.eventLog.Close()
+}
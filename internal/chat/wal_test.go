@@ -0,0 +1,124 @@
+package chat
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// readEventTypes returns the types of every event in the log in dir
+func readEventTypes(t *testing.T, dir string) []string {
+	types := []string{}
+	require.NoError(t, ReadEventLog(dir, func(event WebhookEvent) error {
+		types = append(types, event.Type)
+		return nil
+	}))
+	return types
+}
+
+func TestEventLogRotatesAndPrunes(t *testing.T) {
+	dir := t.TempDir()
+	eventLog, err := NewEventLog(dir, 200, 2, true)
+	require.NoError(t, err)
+
+	for _, eventType := range []string{"one", "two", "three", "four", "five"} {
+		require.NoError(t, eventLog.Append(eventType, "room", map[string]string{"padding": "0123456789012345678901234567890123456789"}))
+	}
+	require.NoError(t, eventLog.Close())
+
+	indexes, err := walIndexes(dir)
+	require.NoError(t, err)
+	require.Len(t, indexes, 2)
+	require.Equal(t, []string{"four", "five"}, readEventTypes(t, dir))
+}
+
+func TestEventLogContinuesAfterTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	eventLog, err := NewEventLog(dir, 0, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, eventLog.Append("before", "room", nil))
+	require.NoError(t, eventLog.Close())
+
+	// Simulate a crash part way through writing an event
+	file, err := os.OpenFile(walPath(dir, 1), os.O_APPEND|os.O_WRONLY, 0o644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"id":"torn","type":"mess`)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	eventLog, err = NewEventLog(dir, 0, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, eventLog.Append("after", "room", nil))
+	require.NoError(t, eventLog.Close())
+
+	require.Equal(t, []string{"before", "after"}, readEventTypes(t, dir))
+}
+
+func TestBroadcastAppendsToEventLog(t *testing.T) {
+	config := DefaultConfig()
+	config.WALDir = t.TempDir()
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+	h := NewWSHandler(manager, NewRateLimiter(config))
+	t.Cleanup(func() { h.eventLog.Close() })
+
+	msg := newChatMessage("room", "alice", "alice", "hello")
+	h.broadcast("room", WSMessage{Type: "message", Data: msg, Timestamp: time.Now()}, "")
+	h.broadcast("room", WSMessage{Type: "typing", Data: TypingEvent{UserID: "alice"}, Timestamp: time.Now()}, "")
+	h.publishEvent(WebhookEventUserTimeout, "room", map[string]interface{}{"userId": "alice"})
+	require.NoError(t, h.eventLog.Flush())
+
+	// Ephemeral frames such as typing aren't logged
+	events := []WebhookEvent{}
+	require.NoError(t, ReadEventLog(config.WALDir, func(event WebhookEvent) error {
+		events = append(events, event)
+		return nil
+	}))
+	require.Len(t, events, 2)
+	require.Equal(t, "message", events[0].Type)
+	require.Equal(t, "room", events[0].StreamKey)
+	require.Equal(t, "hello", events[0].Data.(map[string]interface{})["message"])
+	require.Equal(t, WebhookEventUserTimeout, events[1].Type)
+}
+
+func TestEventLogGroupsConcurrentAppends(t *testing.T) {
+	dir := t.TempDir()
+	eventLog, err := NewEventLog(dir, 0, 0, true)
+	require.NoError(t, err)
+
+	errs := make(chan error, 50)
+	for i := 0; i < 50; i++ {
+		go func() { errs <- eventLog.Append("message", "room", nil) }()
+	}
+	for i := 0; i < 50; i++ {
+		require.NoError(t, <-errs)
+	}
+
+	// Every synced append is on disk once it returns, before the log is closed
+	require.Len(t, readEventTypes(t, dir), 50)
+	require.NoError(t, eventLog.Close())
+	require.Error(t, eventLog.Append("message", "room", nil))
+}
+
+func TestErasureAppendsToEventLog(t *testing.T) {
+	config := DefaultConfig()
+	config.WALDir = t.TempDir()
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+	h := NewWSHandler(manager, NewRateLimiter(config))
+
+	_, err := h.EraseUserData("alice")
+	require.NoError(t, err)
+	require.NoError(t, h.CloseEventLog())
+
+	events := []WebhookEvent{}
+	require.NoError(t, ReadEventLog(config.WALDir, func(event WebhookEvent) error {
+		events = append(events, event)
+		return nil
+	}))
+	require.Len(t, events, 1)
+	require.Equal(t, WebhookEventUserErased, events[0].Type)
+	require.Equal(t, "alice", events[0].Data.(map[string]interface{})["userId"])
+}
@@ -0,0 +1,102 @@
+package chat
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const warmupTimeout = 10 * time.Second
+
+// WarmupSource lists the stream keys that are live right now
+type WarmupSource func(ctx context.Context) ([]string, error)
+
+// HistoryLoader returns up to limit of the most recent messages for a stream, oldest
+// first and numbered as they were sent
+type HistoryLoader func(streamKey string, limit int) ([]ChatMessage, error)
+
+// StoredHistory is the HistoryLoader reading a stream's messages from the installed
+// message store, moderated as chat shows them
+func (m *Manager) StoredHistory(streamKey string, limit int) ([]ChatMessage, error) {
+	store := m.persistence()
+	if store == nil {
+		return []ChatMessage{}, nil
+	}
+
+	messages, err := moderatedRange(store, streamKey, 0)
+	if err != nil {
+		return nil, err
+	}
+	return messages[max(0, len(messages)-limit):], nil
+}
+
+// StatusWarmupSource lists the live streams reported by a broadcast-box /api/status endpoint
+func StatusWarmupSource(statusURL string) WarmupSource {
+	return func(ctx context.Context) ([]string, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, statusURL, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close() //nolint
+
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("status endpoint returned %d", resp.StatusCode)
+		}
+
+		var statuses []struct {
+			StreamKey string `json:"streamKey"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&statuses); err != nil {
+			return nil, fmt.Errorf("failed to decode stream statuses: %w", err)
+		}
+
+		streamKeys := make([]string, 0, len(statuses))
+		for _, status := range statuses {
+			if status.StreamKey != "" {
+				streamKeys = append(streamKeys, status.StreamKey)
+			}
+		}
+		return streamKeys, nil
+	}
+}
+
+// WarmUp pre-creates rooms for every live stream so viewers reconnecting after a
+// deploy land in a ready room. When a loader is given, recent history is restored
+// into rooms that are still empty, with numbering continuing after it.
+func (m *Manager) WarmUp(source WarmupSource, loader HistoryLoader) error {
+	ctx, cancel := context.WithTimeout(context.Background(), warmupTimeout)
+	defer cancel()
+
+	streamKeys, err := source(ctx)
+	if err != nil {
+		return err
+	}
+
+	restored := 0
+	for _, streamKey := range streamKeys {
+		room := m.GetOrCreateRoom(streamKey)
+		if loader == nil || room.Messages.Size() > 0 {
+			continue
+		}
+
+		messages, err := loader(streamKey, m.config.MaxMessagesPerStream)
+		if err != nil {
+			log.Printf("Failed to load history for stream %s: %v", streamKey, err)
+			continue
+		}
+
+		// Restored rather than added, so they keep their numbers and aren't stored twice
+		restored += room.restore(messages, time.Time{}, nil)
+	}
+
+	log.Printf("Chat warm-up: prepared %d rooms, restored %d messages", len(streamKeys), restored)
+	return nil
+}
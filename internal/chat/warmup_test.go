@@ -0,0 +1,37 @@
+package chat
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWarmUpRestoresStoredHistory(t *testing.T) {
+	manager := NewManager(DefaultConfig())
+	defer manager.Stop()
+	store := NewMemoryStore()
+	manager.SetMessageStore(store)
+	for seq := int64(1); seq <= 3; seq++ {
+		require.NoError(t, store.Append(ChatMessage{ID: fmt.Sprint(seq), StreamKey: "live", Seq: seq, UserID: "alice", Message: fmt.Sprint("message ", seq), Timestamp: time.Now()}))
+	}
+
+	source := func(context.Context) ([]string, error) { return []string{"live", "quiet"}, nil }
+	require.NoError(t, manager.WarmUp(source, manager.StoredHistory))
+
+	room, exists := manager.GetRoom("live")
+	require.True(t, exists)
+	require.Equal(t, []string{"message 1", "message 2", "message 3"}, messageTexts(room.GetMessages(0)))
+	_, exists = manager.GetRoom("quiet")
+	require.True(t, exists)
+
+	// Numbering carries on and nothing was stored twice
+	msg, err := manager.AddMessage("live", "bob", "bob", "next")
+	require.NoError(t, err)
+	require.Equal(t, int64(4), msg.Seq)
+	stored, err := store.Range("live", 0, 0)
+	require.NoError(t, err)
+	require.Len(t, stored, 4)
+}
@@ -0,0 +1,251 @@
+package chat
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Webhook event types. Room frames use their protocol type; moderation actions have their own.
+const (
+	WebhookEventMessage         = "message"
+	WebhookEventUserJoined      = "user_joined"
+	WebhookEventUserLeft        = "user_left"
+	WebhookEventSystem          = "system"
+	WebhookEventUserTimeout     = "user_timeout"
+	WebhookEventMessageBlocked  = "message_blocked"
+	WebhookEventSessionsRevoked = "sessions_revoked"
+	WebhookEventUserErased      = "user_erased" // consumers of the event log drop the user's earlier events
+)
+
+const (
+	webhookQueueSize      = 1000
+	webhookWorkers        = 4
+	webhookTimeout        = 10 * time.Second
+	webhookInitialBackoff = time.Second
+	webhookMaxBackoff     = 5 * time.Minute
+)
+
+// WebhookEndpoint is a URL that receives the chat events it subscribes to
+type WebhookEndpoint struct {
+	URL    string   `json:"url"`
+	Secret string   `json:"secret"` // Signs each body as X-Chat-Signature: sha256=<hex hmac>
+	Events []string `json:"events"` // Event types to deliver, "*" for all
+}
+
+// wants reports whether the endpoint subscribes to an event type
+func (e *WebhookEndpoint) wants(eventType string) bool {
+	for _, event := range e.Events {
+		if event == eventType || event == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseWebhookEndpoints parses a JSON array of webhook endpoints
+func ParseWebhookEndpoints(raw string) ([]WebhookEndpoint, error) {
+	var endpoints []WebhookEndpoint
+	if err := json.Unmarshal([]byte(raw), &endpoints); err != nil {
+		return nil, err
+	}
+	for _, endpoint := range endpoints {
+		if endpoint.URL == "" {
+			return nil, fmt.Errorf("webhook endpoint is missing a url")
+		}
+	}
+	return endpoints, nil
+}
+
+// WebhookEvent is the JSON body POSTed to webhook endpoints
+type WebhookEvent struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	StreamKey string      `json:"streamKey,omitempty"`
+	Data      interface{} `json:"data,omitempty"`
+	Timestamp time.Time   `json:"timestamp"`
+}
+
+// webhookDelivery is one event on its way to one endpoint
+type webhookDelivery struct {
+	endpoint *WebhookEndpoint
+	event    string
+	id       string
+	body     []byte
+	attempt  int
+}
+
+// WebhookDispatcher delivers chat events to webhook endpoints in the background,
+// retrying failed deliveries with exponential backoff
+type WebhookDispatcher struct {
+	endpoints   []WebhookEndpoint
+	subscribed  map[string]bool // event types at least one endpoint wants
+	maxAttempts int
+	client      *http.Client
+	queue       chan *webhookDelivery
+	stop        chan struct{}
+	stopOnce    sync.Once
+}
+
+// NewWebhookDispatcher creates a dispatcher and starts its delivery workers
+func NewWebhookDispatcher(endpoints []WebhookEndpoint, maxAttempts int) *WebhookDispatcher {
+	d := &WebhookDispatcher{
+		endpoints:   endpoints,
+		subscribed:  make(map[string]bool),
+		maxAttempts: maxAttempts,
+		client:      &http.Client{Timeout: webhookTimeout},
+		queue:       make(chan *webhookDelivery, webhookQueueSize),
+		stop:        make(chan struct{}),
+	}
+
+	for _, endpoint := range endpoints {
+		for _, event := range endpoint.Events {
+			d.subscribed[event] = true
+		}
+	}
+
+	if len(endpoints) > 0 {
+		for i := 0; i < webhookWorkers; i++ {
+			go d.worker()
+		}
+	}
+
+	return d
+}
+
+// Pending returns the number of deliveries waiting for a worker
+func (d *WebhookDispatcher) Pending() int {
+	return len(d.queue)
+}
+
+// Dispatch queues an event for every endpoint subscribed to its type. It never blocks;
+// events are dropped if the queue is full.
+func (d *WebhookDispatcher) Dispatch(eventType, streamKey string, data interface{}) {
+	if !d.subscribed[eventType] && !d.subscribed["*"] {
+		return
+	}
+
+	event := WebhookEvent{
+		ID:        uuid.New().String(),
+		Type:      eventType,
+		StreamKey: streamKey,
+		Data:      data,
+		Timestamp: time.Now(),
+	}
+	body, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Failed to encode webhook event %s: %v", eventType, err)
+		return
+	}
+
+	for i := range d.endpoints {
+		if d.endpoints[i].wants(eventType) {
+			d.enqueue(&webhookDelivery{endpoint: &d.endpoints[i], event: eventType, id: event.ID, body: body})
+		}
+	}
+}
+
+// Close stops delivery. Queued and pending retries are dropped.
+func (d *WebhookDispatcher) Close() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+}
+
+func (d *WebhookDispatcher) enqueue(delivery *webhookDelivery) {
+	select {
+	case d.queue <- delivery:
+	case <-d.stop:
+	default:
+		log.Printf("Webhook queue full, dropping %s event for %s", delivery.event, delivery.endpoint.URL)
+	}
+}
+
+func (d *WebhookDispatcher) worker() {
+	defer trackWorker("webhook.worker")()
+
+	for {
+		select {
+		case delivery := <-d.queue:
+			d.deliver(delivery)
+		case <-d.stop:
+			return
+		}
+	}
+}
+
+// deliver makes one attempt and schedules a retry if it failed
+func (d *WebhookDispatcher) deliver(delivery *webhookDelivery) {
+	delivery.attempt++
+
+	retry, err := d.post(delivery)
+	if err == nil {
+		return
+	}
+
+	if !retry || delivery.attempt >= d.maxAttempts {
+		log.Printf("Giving up on webhook %s event %s to %s after %d attempts: %v",
+			delivery.event, delivery.id, delivery.endpoint.URL, delivery.attempt, err)
+		return
+	}
+
+	time.AfterFunc(webhookBackoff(delivery.attempt), func() {
+		d.enqueue(delivery)
+	})
+}
+
+// post sends a delivery, reporting whether a failure is worth retrying
+func (d *WebhookDispatcher) post(delivery *webhookDelivery) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, delivery.endpoint.URL, bytes.NewReader(delivery.body))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "broadcast-box-chat-webhooks")
+	req.Header.Set("X-Chat-Event", delivery.event)
+	req.Header.Set("X-Chat-Delivery", delivery.id)
+	if delivery.endpoint.Secret != "" {
+		req.Header.Set("X-Chat-Signature", "sha256="+SignWebhookBody(delivery.endpoint.Secret, delivery.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close() //nolint
+
+	switch {
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		return false, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500:
+		return true, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	default:
+		return false, fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+}
+
+// webhookBackoff returns the delay before the retry following the given attempt
+func webhookBackoff(attempt int) time.Duration {
+	backoff := webhookInitialBackoff
+	for i := 1; i < attempt && backoff < webhookMaxBackoff; i++ {
+		backoff *= 2
+	}
+	return min(backoff, webhookMaxBackoff)
+}
+
+// SignWebhookBody returns the hex HMAC-SHA256 of a webhook body, as sent in X-Chat-Signature
+func SignWebhookBody(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWebhookDispatcherSignsAndRetries(t *testing.T) {
+	var attempts atomic.Int32
+	delivered := make(chan *http.Request, 1)
+	bodies := make(chan []byte, 1)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		delivered <- r
+		bodies <- body
+	}))
+	defer server.Close()
+
+	d := NewWebhookDispatcher([]WebhookEndpoint{
+		{URL: server.URL, Secret: "shh", Events: []string{WebhookEventMessage}},
+	}, 3)
+	defer d.Close()
+
+	d.Dispatch(WebhookEventUserJoined, "room", nil) // not subscribed
+	d.Dispatch(WebhookEventMessage, "room", map[string]interface{}{"message": "hi"})
+
+	select {
+	case r := <-delivered:
+		body := <-bodies
+		require.Equal(t, WebhookEventMessage, r.Header.Get("X-Chat-Event"))
+		require.Equal(t, "sha256="+SignWebhookBody("shh", body), r.Header.Get("X-Chat-Signature"))
+		require.Contains(t, string(body), `"message":"hi"`)
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not retried")
+	}
+	require.Equal(t, int32(2), attempts.Load())
+}
+
+func TestWebhookBackoff(t *testing.T) {
+	require.Equal(t, time.Second, webhookBackoff(1))
+	require.Equal(t, 4*time.Second, webhookBackoff(3))
+	require.Equal(t, webhookMaxBackoff, webhookBackoff(40))
+}
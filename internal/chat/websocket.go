@@ -3,88 +3,364 @@ package chat
 import (
 	"log"
 	"net/http"
+	"runtime"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+// WebSocket subprotocols. Clients that don't ask for one get JSON.
+const (
+	SubprotocolJSON     = "chat.v1.json"
+	SubprotocolMsgPack  = "chat.v1.msgpack"
+	SubprotocolProtobuf = "chat.v1.protobuf"
+)
+
+// upgrader is copied per connection; the handler sets its origin check
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all origins for now
-	},
+	Subprotocols: []string{SubprotocolJSON, SubprotocolMsgPack, SubprotocolProtobuf},
 }
 
 // WSMessage represents a WebSocket message
 type WSMessage struct {
-	Type      string      `json:"type"`
-	Data      interface{} `json:"data,omitempty"`
-	Error     string      `json:"error,omitempty"`
-	Timestamp time.Time   `json:"timestamp"`
+	Type      string        `json:"type"`
+	Data      interface{}   `json:"data,omitempty"`
+	Error     string        `json:"error,omitempty"`
+	Code      string        `json:"code,omitempty"`    // ChatError code, when the error has one
+	Fields    []FieldError  `json:"fields,omitempty"`  // invalid fields of a rejected client frame
+	Details   *ErrorDetails `json:"details,omitempty"` // specifics of errors about limits
+	Room      string        `json:"room,omitempty"`    // stream key of the room the frame belongs to
+	Timestamp time.Time     `json:"timestamp"`
+
+	prepared *preparedFrame // encodings shared by every recipient of a broadcast
 }
 
-// WSHandler handles WebSocket connections for chat
+// WSHandler handles chat connections over WebSocket and the fallback transports
 type WSHandler struct {
 	manager     *Manager
 	rateLimiter *RateLimiter
-	connections map[string]*Connection // userID -> connection
-	connMux     sync.RWMutex
-}
-
-// Connection represents a WebSocket connection
-type Connection struct {
-	UserID     string
-	Username   string
-	StreamKey  string
-	Conn       *websocket.Conn
-	Send       chan WSMessage
-	manager    *WSHandler
+	readTracker *ReadTracker
+	autoMod     *AutoMod
+	tokens      *TokenStore
+	origins     *OriginAllowlist
+	codec       Codec
+	hubs        map[string]*roomHub // streamKey -> hub of the connections receiving the room
+	hubMux      sync.RWMutex
+	subscribers map[string]map[chan WSMessage]struct{} // streamKey -> read-only feed subscribers
+	subMux      sync.RWMutex
+	revocations *SessionRevocations
+	webhooks    *WebhookDispatcher
+	exporter    *EventExporter
+	eventLog    *EventLog
+	loadShedder *LoadShedder
+	tracer      *Tracer
+	events      *EventBus
+	bridges     *bridgeHub
+
+	viewerCounts *viewerCounter
+	loadThrottle *LoadThrottle
+
+	pollSessions map[string]*pollSession // sessionID -> long-poll session
+	pollMux      sync.Mutex
+
+	broker            Broker
+	unsubscribeBroker func()
+
+	writers *writePool  // nil when every WebSocket has its own writer goroutine
+	poller  *epoller    // nil on the gorilla backend
+	router  *roomRouter // nil when every instance serves every room
+
+	slowEvictions atomic.Int64 // connections closed for falling behind
+	openConns     atomic.Int64 // WebSockets counted against MaxConnections
+	rejectedConns atomic.Int64 // WebSocket upgrades refused at MaxConnections
+	draining      atomic.Bool  // new WebSockets are refused while connections are closed for a restart
+
+	compaction compactionStats
+
+	authenticator Authenticator // nil when clients join as whoever they claim to be
+	authMux       sync.RWMutex
+	reservedNames *ReservedNames
+
+	proxies  *TrustedProxies // whose forwarding headers say who the client is
+	ipLimits *IPLimiter
 }
 
 // NewWSHandler creates a new WebSocket handler
 func NewWSHandler(manager *Manager, rateLimiter *RateLimiter) *WSHandler {
-	return &WSHandler{
+	scraperWindow := time.Duration(manager.config.ScraperWindowMinutes) * time.Minute
+
+	codec, err := NewCodec(manager.config.Codec)
+	if err != nil {
+		log.Printf("Falling back to the default chat codec: %v", err)
+		codec = stdJSONCodec{}
+	}
+
+	exporter, err := NewKafkaExporter(manager.config.KafkaBrokers, manager.config.KafkaTopic, manager.config.KafkaFormat)
+	if err != nil {
+		log.Printf("Chat event export disabled: %v", err)
+		exporter = &EventExporter{}
+	}
+
+	eventLog, err := NewEventLog(manager.config.WALDir, int64(manager.config.WALMaxFileMB)*1024*1024, manager.config.WALMaxFiles, manager.config.WALSync)
+	if err != nil {
+		log.Printf("Chat event log disabled: %v", err)
+		eventLog = &EventLog{}
+	}
+
+	h := &WSHandler{
 		manager:     manager,
 		rateLimiter: rateLimiter,
-		connections: make(map[string]*Connection),
+		readTracker: NewReadTracker(manager.config.ScraperMaxRooms, scraperWindow),
+		autoMod:     NewAutoMod(manager.config.BlockedTerms, manager.config.AutoModSilentDrop),
+		tokens:      NewTokenStore(manager.config.APITokens),
+		origins:     NewOriginAllowlist(manager.config.AllowedOrigins),
+		codec:       codec,
+		hubs:        make(map[string]*roomHub),
+		subscribers: make(map[string]map[chan WSMessage]struct{}),
+		revocations: NewSessionRevocations(),
+		webhooks:    NewWebhookDispatcher(manager.config.Webhooks, manager.config.WebhookMaxAttempts),
+		exporter:    exporter,
+		eventLog:    eventLog,
+		loadShedder: NewLoadShedder(manager.config.LoadShedQueuePercent, manager.config.LoadShedEncodeMicros),
+		tracer:      NewTracer(),
+		events:      NewEventBus(),
+		bridges:     newBridgeHub(),
+
+		viewerCounts: newViewerCounter(),
+		loadThrottle: NewLoadThrottle(manager.config.LoadThrottleMessagesPerSecond, manager.config.LoadThrottleMemoryPercent, manager.config.LoadThrottleSlowModeSeconds),
+		pollSessions: make(map[string]*pollSession),
+
+		proxies:  NewTrustedProxies(manager.config.TrustedProxies),
+		ipLimits: NewIPLimiter(manager.config.MaxConnectionsPerIP, manager.config.MaxJoinsPerIPPerMinute),
+	}
+
+	rateLimiter.OnTimeoutEnded(h.notifyTimeoutEnded)
+
+	h.reservedNames = NewReservedNames(manager.config.ReservedUsernames)
+
+	if config := manager.config; config.JWTSecret != "" || config.JWTPublicKeyFile != "" {
+		verifier, err := NewJWTVerifier(config.JWTSecret, config.JWTPublicKeyFile, config.JWTIssuer, config.JWTAudience)
+		if err != nil {
+			// Keep requiring tokens rather than opening chat to anyone
+			log.Printf("Chat JWT key unusable, refusing RS256 tokens: %v", err)
+		}
+		h.authenticator = verifier
 	}
+
+	if manager.config.WSBackend == BackendNetpoll {
+		poller, err := newEpoller(netpollReaders())
+		if err != nil {
+			log.Printf("Falling back to the gorilla WebSocket backend: %v", err)
+		} else {
+			h.poller = poller
+		}
+	}
+
+	if workers := manager.config.WriteWorkers; workers > 0 || h.poller != nil {
+		if workers == 0 {
+			// Netpoll connections have no writer goroutines of their own
+			workers = 4 * runtime.GOMAXPROCS(0)
+		}
+		h.writers = newWritePool(workers)
+	}
+
+	if len(manager.config.ClusterNodes) > 0 {
+		router, err := newRoomRouter(manager.config.ClusterSelf, manager.config.ClusterNodes, manager.config.ClusterRouting)
+		if err != nil {
+			log.Printf("Chat room routing disabled: %v", err)
+		} else {
+			h.router = router
+		}
+	}
+
+	go h.pollJanitor()
+	go h.diagnosticsMonitor()
+	if manager.config.ViewerCountDebounceMs > 0 {
+		go h.viewerCountWorker(time.Duration(manager.config.ViewerCountDebounceMs) * time.Millisecond)
+	}
+	if h.loadShedder.enabled {
+		go h.loadMonitor()
+	}
+	if h.loadThrottle.enabled() {
+		go h.loadThrottleMonitor()
+	}
+	if manager.config.BackpressurePercent > 0 {
+		go h.backpressureMonitor()
+	}
+	if manager.config.TelemetryURL != "" && manager.config.TelemetryIntervalMinutes > 0 {
+		go h.telemetryWorker(manager.config.TelemetryURL, time.Duration(manager.config.TelemetryIntervalMinutes)*time.Minute)
+	}
+	if manager.config.CompactionIntervalMinutes > 0 {
+		go h.compactionWorker(time.Duration(manager.config.CompactionIntervalMinutes) * time.Minute)
+	}
+
+	// Single-instance until a shared backplane is configured
+	h.SetBroker(NewLocalBroker()) //nolint
+
+	return h
 }
 
 // HandleWebSocket handles incoming WebSocket connections
 func (h *WSHandler) HandleWebSocket(w http.ResponseWriter, r *http.Request, streamKey string) {
-	conn, err := upgrader.Upgrade(w, r, nil)
+	config := h.manager.config
+
+	if !h.origins.Allowed(r) {
+		writeChatError(w, http.StatusForbidden, ErrOriginNotAllowed)
+		return
+	}
+
+	ip := h.clientIP(r)
+	if err := h.admit(ip); err != nil {
+		writeChatError(w, admissionStatus(err), err)
+		return
+	}
+
+	if err := h.manager.OpenRoom(streamKey, r); err != nil {
+		h.releaseConnection(ip)
+		writeOpenRoomError(w, err)
+		return
+	}
+
+	if h.poller != nil && r.TLS == nil {
+		h.serveNetpoll(w, r, streamKey, ip)
+		return
+	}
+
+	u := upgrader
+	u.EnableCompression = config.CompressionEnabled
+	u.CheckOrigin = h.origins.Allowed
+	conn, err := u.Upgrade(w, r, nil)
 	if err != nil {
+		h.releaseConnection(ip)
 		log.Printf("WebSocket upgrade failed: %v", err)
 		return
 	}
 
-	connection := &Connection{
-		Conn:      conn,
-		StreamKey: streamKey,
-		Send:      make(chan WSMessage, 256),
-		manager:   h,
+	transport := &wsTransport{
+		conn:        conn,
+		codec:       h.codec,
+		messageType: websocket.TextMessage,
+		batchWindow: time.Duration(config.BatchWindowMs) * time.Millisecond,
+	}
+	if config.CompressionEnabled {
+		// Compression only takes effect if the client negotiated permessage-deflate
+		if err := conn.SetCompressionLevel(config.CompressionLevel); err != nil {
+			log.Printf("Invalid chat compression level %d: %v", config.CompressionLevel, err)
+		}
+		transport.compressMinBytes = config.CompressionMinBytes
 	}
+	switch conn.Subprotocol() {
+	case SubprotocolMsgPack:
+		transport.codec, transport.messageType = msgpackCodec{}, websocket.BinaryMessage
+	case SubprotocolProtobuf:
+		transport.codec, transport.messageType = protobufCodec{}, websocket.BinaryMessage
+	}
+
+	connection := newConnection(h, streamKey, ip, transport)
+	connection.statsAllowed = h.tokens.Authorized(r, ScopeReadStats)
+	connection.credentials = requestCredentials(r, ip)
 
 	// Start goroutines for reading and writing
-	go connection.writePump()
-	go connection.readPump()
+	if h.writers != nil {
+		connection.writes = h.writers
+		transport.keepAlive(connection)
+		connection.wake() // for the hello frame
+	} else {
+		go transport.writePump(connection)
+	}
+	go transport.readPump(connection)
+}
+
+// admit counts a new connection from ip against the instance's and the address's
+// limits, returning the error to refuse it with if it is over one or the instance
+// is draining. Every admitted connection must be released with releaseConnection,
+// whichever listener it came through.
+func (h *WSHandler) admit(ip string) *ChatError {
+	config := h.manager.config
+
+	if h.Draining() {
+		return ErrDraining.withDetails(ErrorDetails{RetryAfterSeconds: config.ConnectionRetrySeconds})
+	}
+	if err := h.ipLimits.Admit(ip); err != nil {
+		return err
+	}
+	if !h.admitConnection() {
+		h.ipLimits.Release(ip)
+		return ErrServerFull.withDetails(ErrorDetails{
+			RetryAfterSeconds: config.ConnectionRetrySeconds,
+			Limit:             config.MaxConnections,
+		})
+	}
+	return nil
+}
+
+// admissionStatus returns the HTTP status a connection refused by admit is
+// answered with
+func admissionStatus(err *ChatError) int {
+	if err.Code == CodeIPConnectionLimit || err.Code == CodeIPJoinRateLimit {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusServiceUnavailable
+}
+
+// admitConnection counts a new connection against MaxConnections, returning false
+// if the instance is already full
+func (h *WSHandler) admitConnection() bool {
+	limit := int64(h.manager.config.MaxConnections)
+	if open := h.openConns.Add(1); limit > 0 && open > limit {
+		h.openConns.Add(-1)
+		h.rejectedConns.Add(1)
+		return false
+	}
+	return true
+}
+
+// releaseConnection frees the slots of a connection admitted from ip
+func (h *WSHandler) releaseConnection(ip string) {
+	h.openConns.Add(-1)
+	h.ipLimits.Release(ip)
+}
+
+// wsTransport carries a Connection over a WebSocket
+type wsTransport struct {
+	conn        *websocket.Conn
+	codec       Codec // negotiated through the subprotocol
+	messageType int   // websocket.TextMessage or websocket.BinaryMessage
+
+	compressMinBytes int           // frames at least this large are compressed; 0 disables compression
+	batchWindow      time.Duration // chat messages queued within this window share a frame; 0 disables batching
+}
+
+// Close sends a close frame and closes the underlying socket
+func (t *wsTransport) Close(reason string) error {
+	code := websocket.CloseNormalClosure
+	if reason != "" {
+		code = websocket.ClosePolicyViolation
+	}
+
+	closeMessage := websocket.FormatCloseMessage(code, reason)
+	t.conn.WriteControl(websocket.CloseMessage, closeMessage, time.Now().Add(time.Second)) //nolint
+	return t.conn.Close()
 }
 
 // readPump reads messages from the WebSocket connection
-func (c *Connection) readPump() {
+func (t *wsTransport) readPump(c *Connection) {
+	defer trackWorker("ws.readPump")()
+	defer c.manager.releaseConnection(c.RemoteAddr)
 	defer func() {
 		c.cleanup()
 	}()
 
-	c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
-	c.Conn.SetPongHandler(func(string) error {
-		c.Conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	t.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
+	t.conn.SetPongHandler(func(string) error {
+		t.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 		return nil
 	})
 
 	for {
-		var msg map[string]interface{}
-		err := c.Conn.ReadJSON(&msg)
+		_, data, err := t.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
@@ -92,268 +368,226 @@ func (c *Connection) readPump() {
 			break
 		}
 
+		var msg map[string]interface{}
+		if err := t.codec.Unmarshal(data, &msg); err != nil {
+			break
+		}
+
 		c.handleMessage(msg)
 	}
 }
 
 // writePump writes messages to the WebSocket connection
-func (c *Connection) writePump() {
+func (t *wsTransport) writePump(c *Connection) {
+	defer trackWorker("ws.writePump")()
+
 	ticker := time.NewTicker(54 * time.Second)
 	defer func() {
 		ticker.Stop()
-		c.Conn.Close()
+		c.Close("")
 	}()
 
 	for {
 		select {
-		case message, ok := <-c.Send:
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if !ok {
-				c.Conn.WriteMessage(websocket.CloseMessage, []byte{})
-				return
+		case message := <-c.Send:
+			if _, ok := batchable(message); ok && t.batchWindow > 0 && c.protocolVersion.Load() >= 2 {
+				batch, next := t.collectBatch(c, message)
+				if !t.write(c, batch) {
+					return
+				}
+				if next != nil && !t.write(c, *next) {
+					return
+				}
+				continue
 			}
 
-			if err := c.Conn.WriteJSON(message); err != nil {
+			if !t.write(c, message) {
 				return
 			}
 
 		case <-ticker.C:
-			c.Conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
-			if err := c.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+			t.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := t.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
+
+		case <-c.done:
+			return
 		}
 	}
 }
 
-// handleMessage handles incoming messages from the client
-func (c *Connection) handleMessage(msg map[string]interface{}) {
-	msgType, ok := msg["type"].(string)
-	if !ok {
-		c.sendError("Invalid message type")
-		return
-	}
+// keepAlive pings a connection on the write pool every 54 seconds until it closes.
+// Pings are control frames, which may be written alongside the pool's writes.
+func (t *wsTransport) keepAlive(c *Connection) {
+	var ping func()
+	ping = func() {
+		select {
+		case <-c.done:
+			return
+		default:
+		}
 
-	switch msgType {
-	case "join":
-		c.handleJoin(msg)
-	case "message":
-		c.handleChatMessage(msg)
-	case "typing":
-		c.handleTyping(msg)
-	default:
-		c.sendError("Unknown message type")
+		if err := t.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(10*time.Second)); err != nil {
+			c.Close("")
+			return
+		}
+		time.AfterFunc(54*time.Second, ping)
 	}
+	time.AfterFunc(54*time.Second, ping)
 }
 
-// handleJoin handles a user joining the chat
-func (c *Connection) handleJoin(msg map[string]interface{}) {
-	data, ok := msg["data"].(map[string]interface{})
-	if !ok {
-		c.sendError("Invalid join data")
-		return
-	}
-
-	userID, _ := data["userId"].(string)
-	username, _ := data["username"].(string)
-
-	if userID == "" || username == "" {
-		c.sendError("Missing userId or username")
-		return
+// maxBatchSize caps the chat messages in one message_batch frame
+const maxBatchSize = 256
+
+// write encodes and sends one frame, reporting false once the socket has failed
+func (t *wsTransport) write(c *Connection, message WSMessage) bool {
+	var data []byte
+	var prepared *websocket.PreparedMessage
+	if message.prepared != nil {
+		// Broadcasts are encoded by their first recipient and shared with the rest
+		enc, elapsed := message.prepared.encode(frameFormat{codec: t.codec, messageType: t.messageType}, message)
+		if enc.err != nil {
+			log.Printf("Failed to encode chat message: %v", enc.err)
+			return true
+		}
+		if elapsed > 0 {
+			c.manager.loadShedder.ObserveEncode(elapsed)
+		}
+		data, prepared = enc.data, enc.prepared
+	} else {
+		start := time.Now()
+		var err error
+		if data, err = t.codec.Marshal(message); err != nil {
+			log.Printf("Failed to encode chat message: %v", err)
+			return true
+		}
+		c.manager.loadShedder.ObserveEncode(time.Since(start))
 	}
 
-	c.UserID = userID
-	c.Username = username
-
-	// Add user to manager
-	err := c.manager.manager.AddUser(c.StreamKey, userID, username)
-	if err != nil {
-		c.sendError(err.Error())
-		return
+	if t.compressMinBytes > 0 {
+		t.conn.EnableWriteCompression(len(data) >= t.compressMinBytes)
 	}
 
-	// Register connection
-	c.manager.connMux.Lock()
-	c.manager.connections[userID] = c
-	c.manager.connMux.Unlock()
-
-	// Send message history
-	messages := c.manager.manager.GetMessages(c.StreamKey, 100)
-	c.Send <- WSMessage{
-		Type:      "history",
-		Data:      messages,
-		Timestamp: time.Now(),
+	t.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	var err error
+	if prepared != nil {
+		err = t.conn.WritePreparedMessage(prepared)
+	} else {
+		err = t.conn.WriteMessage(t.messageType, data)
 	}
-
-	// Send user list
-	users := c.manager.manager.GetUsers(c.StreamKey)
-	c.Send <- WSMessage{
-		Type:      "users",
-		Data:      users,
-		Timestamp: time.Now(),
+	if err != nil {
+		return false
 	}
 
-	// Check if user is timed out
-	isTimedOut, duration := c.manager.rateLimiter.GetTimeoutStatus(userID)
-	if isTimedOut {
-		c.Send <- WSMessage{
-			Type: "timeout",
-			Data: map[string]interface{}{
-				"duration": duration.Seconds(),
-			},
-			Timestamp: time.Now(),
+	if messages, ok := message.Data.([]*ChatMessage); ok && message.Type == "message_batch" {
+		for _, chatMsg := range messages {
+			c.traceWritten(WSMessage{Type: "message", Data: chatMsg})
 		}
+	} else {
+		c.traceWritten(message)
 	}
-
-	// Broadcast user joined
-	c.broadcastToRoom(WSMessage{
-		Type: "user_joined",
-		Data: map[string]interface{}{
-			"userId":   userID,
-			"username": username,
-		},
-		Timestamp: time.Now(),
-	})
-
-	log.Printf("User %s (%s) joined chat for stream %s", username, userID, c.StreamKey)
+	return true
 }
 
-// handleChatMessage handles a chat message from the user
-func (c *Connection) handleChatMessage(msg map[string]interface{}) {
-	if c.UserID == "" {
-		c.sendError("Not joined to chat")
-		return
-	}
-
-	data, ok := msg["data"].(map[string]interface{})
-	if !ok {
-		c.sendError("Invalid message data")
-		return
-	}
-
-	message, ok := data["message"].(string)
-	if !ok || message == "" {
-		c.sendError("Invalid message content")
-		return
-	}
-
-	// Check rate limit
-	allowed, rateLimitErr := c.manager.rateLimiter.CheckMessage(c.UserID, message)
-	if !allowed {
-		c.Send <- WSMessage{
-			Type:      "rate_limit",
-			Error:     rateLimitErr.Message,
-			Timestamp: time.Now(),
+// collectBatch gathers the chat messages queued for a connection within the batch
+// window after first into one message_batch frame. A frame of any other type, or a
+// message from another of the connection's rooms, ends the window early and is
+// returned so it can be written after the batch, keeping frames in order. A lone
+// message is returned as is.
+func (t *wsTransport) collectBatch(c *Connection, first WSMessage) (WSMessage, *WSMessage) {
+	chatMsg, _ := batchable(first)
+	messages := []*ChatMessage{chatMsg}
+
+	timer := time.NewTimer(t.batchWindow)
+	defer timer.Stop()
+
+	var next *WSMessage
+collect:
+	for len(messages) < maxBatchSize {
+		select {
+		case message := <-c.Send:
+			chatMsg, ok := batchable(message)
+			if !ok || message.Room != first.Room {
+				next = &message
+				break collect
+			}
+			messages = append(messages, chatMsg)
+		case <-timer.C:
+			break collect
+		case <-c.done:
+			break collect
 		}
-		return
 	}
 
-	// Add message to manager
-	chatMsg, err := c.manager.manager.AddMessage(c.StreamKey, c.UserID, c.Username, message)
-	if err != nil {
-		c.sendError(err.Error())
-		return
+	if len(messages) == 1 {
+		return first, next
 	}
-
-	// Broadcast to all users in the room
-	c.broadcastToRoom(WSMessage{
-		Type:      "message",
-		Data:      chatMsg,
-		Timestamp: time.Now(),
-	})
+	return WSMessage{Type: "message_batch", Data: messages, Room: first.Room, Timestamp: time.Now()}, next
 }
 
-// handleTyping handles typing indicator
-func (c *Connection) handleTyping(msg map[string]interface{}) {
-	if c.UserID == "" {
-		return
+// batchable returns the chat message carried by frames that may be batched
+func batchable(message WSMessage) (*ChatMessage, bool) {
+	if message.Type != "message" {
+		return nil, false
 	}
+	chatMsg, ok := message.Data.(*ChatMessage)
+	return chatMsg, ok
+}
 
-	data, ok := msg["data"].(map[string]interface{})
-	if !ok {
-		return
-	}
+// broadcast fans a message out to every connection and feed subscriber in a room,
+// optionally skipping one user. Connections get it from the room's hub, which
+// queues it after the frames already broadcast to the room.
+func (h *WSHandler) broadcast(streamKey string, msg WSMessage, exceptUserID string) {
+	h.broadcastReporting(streamKey, msg, exceptUserID, nil)
+}
 
-	isTyping, _ := data["isTyping"].(bool)
+// broadcastReporting broadcasts like broadcast, then calls report with how many
+// connections the message was queued for and how many were skipped because their
+// queue was full
+func (h *WSHandler) broadcastReporting(streamKey string, msg WSMessage, exceptUserID string, report func(queued, dropped int)) {
+	msg.Room = streamKey
+	msg.prepared = &preparedFrame{}
 
-	// Broadcast typing status to room (excluding sender)
-	c.broadcastToRoomExcept(WSMessage{
-		Type: "typing",
-		Data: map[string]interface{}{
-			"userId":   c.UserID,
-			"username": c.Username,
-			"isTyping": isTyping,
-		},
-		Timestamp: time.Now(),
-	}, c.UserID)
-}
+	h.logEvent(msg.Type, streamKey, msg.Data)
 
-// broadcastToRoom broadcasts a message to all users in the room
-func (c *Connection) broadcastToRoom(msg WSMessage) {
-	c.manager.connMux.RLock()
-	defer c.manager.connMux.RUnlock()
-
-	for _, conn := range c.manager.connections {
-		if conn.StreamKey == c.StreamKey {
-			select {
-			case conn.Send <- msg:
-			default:
-				// Channel full, skip
-			}
+	// Under load, optional frames are shed before they reach clients; webhooks and the export still see them
+	if !h.loadShedder.Allows(msg.Type) {
+		h.dispatchEvent(msg.Type, streamKey, msg.Data)
+		if report != nil {
+			report(0, 0)
 		}
+		return
 	}
-}
 
-// broadcastToRoomExcept broadcasts to all users except one
-func (c *Connection) broadcastToRoomExcept(msg WSMessage, exceptUserID string) {
-	c.manager.connMux.RLock()
-	defer c.manager.connMux.RUnlock()
-
-	for _, conn := range c.manager.connections {
-		if conn.StreamKey == c.StreamKey && conn.UserID != exceptUserID {
-			select {
-			case conn.Send <- msg:
-			default:
-				// Channel full, skip
-			}
+	delivered := false
+	if hub := h.hub(streamKey, false); hub != nil {
+		select {
+		case hub.broadcast <- hubBroadcast{msg: msg, exceptUserID: exceptUserID, report: report}:
+			delivered = true
+		case <-hub.done:
+			// The room emptied; nobody is left to receive it
 		}
 	}
-}
-
-// sendError sends an error message to the client
-func (c *Connection) sendError(errorMsg string) {
-	c.Send <- WSMessage{
-		Type:      "error",
-		Error:     errorMsg,
-		Timestamp: time.Now(),
+	if !delivered && report != nil {
+		report(0, 0)
 	}
-}
 
-// cleanup cleans up the connection
-func (c *Connection) cleanup() {
-	// Remove from manager
-	if c.UserID != "" {
-		c.manager.manager.RemoveUser(c.StreamKey, c.UserID)
-
-		c.manager.connMux.Lock()
-		delete(c.manager.connections, c.UserID)
-		c.manager.connMux.Unlock()
-
-		// Broadcast user left
-		c.broadcastToRoom(WSMessage{
-			Type: "user_left",
-			Data: map[string]interface{}{
-				"userId":   c.UserID,
-				"username": c.Username,
-			},
-			Timestamp: time.Now(),
-		})
+	h.subMux.RLock()
+	for sub := range h.subscribers[streamKey] {
+		select {
+		case sub <- msg:
+		default:
+			// Subscriber is behind, skip
+		}
+	}
+	h.subMux.RUnlock()
 
-		log.Printf("User %s (%s) left chat for stream %s", c.Username, c.UserID, c.StreamKey)
+	if chatMsg, ok := msg.Data.(*ChatMessage); ok && msg.Type == "message" {
+		h.bridges.relay(*chatMsg)
 	}
 
-	close(c.Send)
-	c.Conn.Close()
+	h.dispatchEvent(msg.Type, streamKey, msg.Data)
 }
 
 // HTTPHandler returns an HTTP handler function for WebSocket connections
@@ -370,15 +604,7 @@ func (h *WSHandler) HTTPHandler(w http.ResponseWriter, r *http.Request) {
 
 // GetRoomStats returns statistics for a specific room
 func (h *WSHandler) GetRoomStats(streamKey string) map[string]interface{} {
-	h.connMux.RLock()
-	defer h.connMux.RUnlock()
-
-	connectedUsers := 0
-	for _, conn := range h.connections {
-		if conn.StreamKey == streamKey {
-			connectedUsers++
-		}
-	}
+	connectedUsers := len(h.roomConnections(streamKey))
 
 	messages := h.manager.GetMessages(streamKey, 0)
 	users := h.manager.GetUsers(streamKey)
@@ -394,23 +620,9 @@ func (h *WSHandler) GetRoomStats(streamKey string) map[string]interface{} {
 
 // BroadcastSystemMessage broadcasts a system message to a room
 func (h *WSHandler) BroadcastSystemMessage(streamKey, message string) {
-	h.connMux.RLock()
-	defer h.connMux.RUnlock()
-
-	msg := WSMessage{
-		Type: "system",
-		Data: map[string]interface{}{
-			"message": message,
-		},
+	h.broadcast(streamKey, WSMessage{
+		Type:      "system",
+		Data:      SystemEvent{Message: message},
 		Timestamp: time.Now(),
-	}
-
-	for _, conn := range h.connections {
-		if conn.StreamKey == streamKey {
-			select {
-			case conn.Send <- msg:
-			default:
-			}
-		}
-	}
+	}, "")
 }
@@ -0,0 +1,1118 @@
+package chat
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestHandler(t *testing.T) (*WSHandler, *httptest.Server) {
+	config := DefaultConfig()
+	manager := NewManager(config)
+	t.Cleanup(manager.Stop)
+
+	h := NewWSHandler(manager, NewRateLimiter(config))
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/chat", h.HTTPHandler)
+	mux.HandleFunc("/api/chat/poll", h.LongPollHandler)
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return h, server
+}
+
+func dialTestClient(t *testing.T, server *httptest.Server, streamKey string) *websocket.Conn {
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?streamKey=" + streamKey
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// readUntil reads frames until one of the given type arrives
+func readUntil(t *testing.T, conn *websocket.Conn, msgType string) map[string]interface{} {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		var msg map[string]interface{}
+		require.NoError(t, conn.ReadJSON(&msg))
+		if msg["type"] == msgType {
+			return msg
+		}
+	}
+}
+
+func joinTestClient(t *testing.T, conn *websocket.Conn, userID string) {
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{"userId": userID, "username": userID},
+	}))
+	readUntil(t, conn, "users")
+}
+
+func TestWebSocketMessageFanout(t *testing.T) {
+	_, server := newTestHandler(t)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	bob := dialTestClient(t, server, "room")
+	joinTestClient(t, bob, "bob")
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "message",
+		"data": map[string]interface{}{"message": "hello"},
+	}))
+
+	msg := readUntil(t, bob, "message")
+	require.Equal(t, "hello", msg["data"].(map[string]interface{})["message"])
+}
+
+func TestLongPollSession(t *testing.T) {
+	_, server := newTestHandler(t)
+
+	resp, err := http.Post(server.URL+"/api/chat/poll?streamKey=room", "application/json", nil)
+	require.NoError(t, err)
+	var opened map[string]string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&opened))
+	resp.Body.Close()
+	sessionURL := server.URL + "/api/chat/poll?session=" + opened["sessionId"]
+
+	join, _ := json.Marshal(map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{"userId": "carol", "username": "carol"},
+	})
+	resp, err = http.Post(sessionURL, "application/json", bytes.NewReader(join))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusAccepted, resp.StatusCode)
+
+	resp, err = http.Get(sessionURL)
+	require.NoError(t, err)
+	var frames []WSMessage
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&frames))
+	resp.Body.Close()
+
+	types := []string{}
+	for _, frame := range frames {
+		types = append(types, frame.Type)
+	}
+	require.Contains(t, types, "history")
+	require.Contains(t, types, "users")
+}
+
+func TestSystemMessageHandlerBroadcasts(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	viewer := dialTestClient(t, server, "room")
+	joinTestClient(t, viewer, "viewer")
+
+	r := httptest.NewRequest(http.MethodPost, "/api/chat/room/system", strings.NewReader(`{"message":"Stream starting soon"}`))
+	r.SetPathValue("streamKey", "room")
+	w := httptest.NewRecorder()
+	h.SystemMessageHandler(w, r)
+	require.Equal(t, http.StatusAccepted, w.Code)
+
+	msg := readUntil(t, viewer, "system")
+	require.Equal(t, "Stream starting soon", msg["data"].(map[string]interface{})["message"])
+
+	r = httptest.NewRequest(http.MethodPost, "/api/chat/room/system", strings.NewReader(`{"message":""}`))
+	r.SetPathValue("streamKey", "room")
+	w = httptest.NewRecorder()
+	h.SystemMessageHandler(w, r)
+	require.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestWebSocketMsgPackSubprotocol(t *testing.T) {
+	_, server := newTestHandler(t)
+
+	dialer := websocket.Dialer{Subprotocols: []string{SubprotocolMsgPack}}
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?streamKey=room"
+	conn, _, err := dialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, SubprotocolMsgPack, conn.Subprotocol())
+
+	codec := msgpackCodec{}
+	join, err := codec.Marshal(map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{"userId": "dave", "username": "dave"},
+	})
+	require.NoError(t, err)
+	require.NoError(t, conn.WriteMessage(websocket.BinaryMessage, join))
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		messageType, data, err := conn.ReadMessage()
+		require.NoError(t, err)
+		require.Equal(t, websocket.BinaryMessage, messageType)
+
+		var frame map[string]interface{}
+		require.NoError(t, codec.Unmarshal(data, &frame))
+		if frame["type"] == "users" {
+			break
+		}
+	}
+}
+
+func TestTraceFollowsMessageJourney(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.tracer.Enable("alice", time.Minute)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "message",
+		"data": map[string]interface{}{"message": "hello"},
+	}))
+	readUntil(t, alice, "message")
+
+	// The written stage is recorded just after the frame reaches the socket
+	require.Eventually(t, func() bool {
+		events, _, _ := h.tracer.Events("alice")
+		return len(events) > 0 && events[len(events)-1].Stage == TraceWritten
+	}, time.Second, 10*time.Millisecond)
+
+	events, _, exists := h.tracer.Events("alice")
+	require.True(t, exists)
+	stages := []string{}
+	for _, event := range events {
+		if event.Stage != TraceWritten || strings.HasPrefix(event.Detail, "message") {
+			stages = append(stages, event.Stage)
+		}
+	}
+	require.Equal(t, []string{TraceReceived, TraceRateCheck, TraceFilter, TraceStore, TraceBroadcast, TraceWritten}, stages)
+}
+
+func TestWebSocketCompression(t *testing.T) {
+	_, server := newTestHandler(t)
+
+	dialer := websocket.Dialer{EnableCompression: true}
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?streamKey=room"
+	conn, resp, err := dialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Contains(t, resp.Header.Get("Sec-WebSocket-Extensions"), "permessage-deflate")
+
+	joinTestClient(t, conn, "erin")
+
+	long := strings.Repeat("compress me ", 40)
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type": "message",
+		"data": map[string]interface{}{"message": long},
+	}))
+	msg := readUntil(t, conn, "message")
+	require.Equal(t, long, msg["data"].(map[string]interface{})["message"])
+}
+
+func TestWebSocketHelloHandshake(t *testing.T) {
+	_, server := newTestHandler(t)
+	conn := dialTestClient(t, server, "room")
+
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	var hello map[string]interface{}
+	require.NoError(t, conn.ReadJSON(&hello))
+	require.Equal(t, "hello", hello["type"], "hello must be the first frame")
+	data := hello["data"].(map[string]interface{})
+	require.Equal(t, float64(ProtocolVersion), data["protocolVersion"])
+	require.Contains(t, data["features"], "typing")
+
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type": "hello",
+		"data": map[string]interface{}{"protocolVersion": 0},
+	}))
+	errFrame := readUntil(t, conn, "error")
+	require.Equal(t, ErrProtocolUnsupported.Code, errFrame["code"])
+}
+
+func TestSearchHandler(t *testing.T) {
+	h, _ := newTestHandler(t)
+	m := h.manager
+
+	_, err := m.AddMessage("room", "alice", "Alice", "the raid is starting")
+	require.NoError(t, err)
+	_, err = m.AddMessage("room", "bob", "Bob", "RAID incoming")
+	require.NoError(t, err)
+	_, err = m.AddMessage("room", "alice", "Alice", "hello")
+	require.NoError(t, err)
+
+	search := func(query string) (int, map[string]interface{}) {
+		r := httptest.NewRequest(http.MethodGet, "/api/chat/room/search?"+query, nil)
+		r.SetPathValue("streamKey", "room")
+		w := httptest.NewRecorder()
+		h.SearchHandler(w, r)
+
+		var body map[string]interface{}
+		json.NewDecoder(w.Body).Decode(&body) //nolint
+		return w.Code, body
+	}
+
+	code, body := search("q=raid")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, body["messages"], 2)
+
+	_, body = search("q=raid&user=alice")
+	messages := body["messages"].([]interface{})
+	require.Len(t, messages, 1)
+	require.Equal(t, "the raid is starting", messages[0].(map[string]interface{})["message"])
+
+	_, body = search("user=ALICE&limit=1")
+	require.Len(t, body["messages"], 1)
+	require.Equal(t, true, body["hasMore"])
+
+	_, body = search("from=" + time.Now().Add(time.Hour).UTC().Format(time.RFC3339))
+	require.Empty(t, body["messages"])
+
+	code, _ = search("to=yesterday")
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestAdminRoomControls(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	viewer := dialTestClient(t, server, "room")
+	joinTestClient(t, viewer, "viewer")
+	_, err := h.manager.AddMessage("room", "viewer", "viewer", "spam")
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodPut, "/api/chat/admin/rooms/room/modes", strings.NewReader(`{"slowModeSeconds":10}`))
+	r.SetPathValue("streamKey", "room")
+	w := httptest.NewRecorder()
+	h.RoomModesHandler(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	msg := readUntil(t, viewer, "room_modes")
+	require.Equal(t, float64(10), msg["data"].(map[string]interface{})["slowModeSeconds"])
+
+	r = httptest.NewRequest(http.MethodPost, "/api/chat/admin/rooms/room/clear", nil)
+	r.SetPathValue("streamKey", "room")
+	w = httptest.NewRecorder()
+	h.ClearRoomHandler(w, r)
+	require.Equal(t, http.StatusOK, w.Code)
+	readUntil(t, viewer, "chat_cleared")
+	require.Empty(t, h.manager.GetMessages("room", 0))
+
+	w = httptest.NewRecorder()
+	h.RoomsHandler(w, httptest.NewRequest(http.MethodGet, "/api/chat/admin/rooms", nil))
+	var rooms struct {
+		Rooms []struct {
+			StreamKey   string    `json:"streamKey"`
+			Connections int       `json:"connections"`
+			Modes       RoomModes `json:"modes"`
+		} `json:"rooms"`
+	}
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&rooms))
+	require.Len(t, rooms.Rooms, 1)
+	require.Equal(t, 1, rooms.Rooms[0].Connections)
+	require.Equal(t, 10, rooms.Rooms[0].Modes.SlowModeSeconds)
+
+	r = httptest.NewRequest(http.MethodPost, "/api/chat/admin/users/viewer/disconnect", nil)
+	r.SetPathValue("userID", "viewer")
+	w = httptest.NewRecorder()
+	h.DisconnectHandler(w, r)
+	require.Contains(t, w.Body.String(), `"closed":1`)
+}
+
+func TestDiagnosticsDetectsOrphanedConnections(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	viewer := dialTestClient(t, server, "room")
+	joinTestClient(t, viewer, "viewer")
+
+	d := h.Diagnostics()
+	require.Equal(t, 1, d.Rooms)
+	require.Equal(t, 1, d.Connections)
+	require.GreaterOrEqual(t, d.Workers["ws.readPump"], int64(1))
+	require.Empty(t, d.Leaks)
+
+	// A room dropped while a session still points at it
+	shard := h.manager.shard("room")
+	shard.mutex.Lock()
+	delete(shard.rooms, "room")
+	shard.mutex.Unlock()
+
+	d = h.Diagnostics()
+	require.Len(t, d.Leaks, 1)
+	require.Contains(t, d.Leaks[0], "outlived its room room")
+}
+
+func TestViewerCountChanged(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	counts := make(chan ViewerCountEvent, 10)
+	unsubscribe := h.Events().Subscribe(func(event Event) {
+		if event.Type == EventViewerCountChanged {
+			counts <- event.Data.(ViewerCountEvent)
+		}
+	})
+	defer unsubscribe()
+
+	first := dialTestClient(t, server, "room")
+	joinTestClient(t, first, "first")
+	second := dialTestClient(t, server, "room")
+	joinTestClient(t, second, "second")
+
+	// Both joins are folded into one event
+	h.flushViewerCounts()
+	require.Equal(t, ViewerCountEvent{StreamKey: "room", Count: 2}, <-counts)
+
+	msg := readUntil(t, first, EventViewerCountChanged)
+	require.Equal(t, float64(2), msg["data"].(map[string]interface{})["count"])
+
+	// Nothing changed, nothing published
+	h.touchViewerCount("room")
+	h.flushViewerCounts()
+	require.Empty(t, counts)
+}
+
+func TestWebSocketMessageBatching(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.manager.config.BatchWindowMs = 500
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	// Only clients speaking protocol version 2 get batches
+	bob := dialTestClient(t, server, "room")
+	require.NoError(t, bob.WriteJSON(map[string]interface{}{
+		"type": "hello",
+		"data": map[string]interface{}{"protocolVersion": 2},
+	}))
+	joinTestClient(t, bob, "bob")
+
+	carol := dialTestClient(t, server, "room")
+	joinTestClient(t, carol, "carol")
+
+	for _, text := range []string{"one", "two", "three"} {
+		require.NoError(t, alice.WriteJSON(map[string]interface{}{
+			"type": "message",
+			"data": map[string]interface{}{"message": text},
+		}))
+	}
+
+	batch := readUntil(t, bob, "message_batch")
+	messages := batch["data"].([]interface{})
+	require.Len(t, messages, 3)
+	require.Equal(t, "one", messages[0].(map[string]interface{})["message"])
+	require.Equal(t, "three", messages[2].(map[string]interface{})["message"])
+
+	for _, text := range []string{"one", "two", "three"} {
+		msg := readUntil(t, carol, "message")
+		require.Equal(t, text, msg["data"].(map[string]interface{})["message"])
+	}
+}
+
+func TestWebSocketPing(t *testing.T) {
+	_, server := newTestHandler(t)
+
+	// Pings are answered before joining
+	conn := dialTestClient(t, server, "room")
+	before := time.Now().UnixMilli()
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type": "ping",
+		"data": map[string]interface{}{"clientTime": 1700000000000},
+	}))
+
+	pong := readUntil(t, conn, "pong")
+	data := pong["data"].(map[string]interface{})
+	require.Equal(t, float64(1700000000000), data["clientTime"])
+	require.GreaterOrEqual(t, data["serverTime"].(float64), float64(before))
+}
+
+func TestJoinAdvertisesRoomState(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.manager.GetOrCreateRoom("room").SetModes(RoomModes{SlowModeSeconds: 5, EmoteOnly: true})
+
+	conn := dialTestClient(t, server, "room")
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{"userId": "alice", "username": "alice"},
+	}))
+
+	state := readUntil(t, conn, "room_state")["data"].(map[string]interface{})
+	require.Equal(t, map[string]interface{}{"slowModeSeconds": float64(5), "readOnly": false, "emoteOnly": true}, state["modes"])
+	limits := state["limits"].(map[string]interface{})
+	require.Equal(t, float64(500), limits["maxMessageLength"])
+	require.Equal(t, float64(10), limits["maxMessagesPerMinute"])
+	require.Contains(t, limits["rateWindows"], map[string]interface{}{"tier": TierBurst, "messages": float64(5), "windowSeconds": float64(10)})
+	require.Contains(t, limits["rateWindows"], map[string]interface{}{"tier": TierLongMessage, "messages": float64(1), "windowSeconds": float64(10), "minLength": float64(300)})
+	require.Equal(t, true, state["features"].(map[string]interface{})["viewerList"])
+}
+
+func TestWebSocketReservedMessageID(t *testing.T) {
+	_, server := newTestHandler(t)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+	bob := dialTestClient(t, server, "room")
+	joinTestClient(t, bob, "bob")
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{"type": "reserve", "data": map[string]interface{}{}}))
+	reserved := readUntil(t, alice, "reserved")["data"].(map[string]interface{})
+	id := reserved["id"].(string)
+	require.NotEmpty(t, id)
+
+	send := func(id string) {
+		require.NoError(t, alice.WriteJSON(map[string]interface{}{
+			"type": "message",
+			"data": map[string]interface{}{"message": "optimistic", "id": id},
+		}))
+	}
+
+	send(id)
+	msg := readUntil(t, bob, "message")
+	require.Equal(t, id, msg["data"].(map[string]interface{})["id"])
+
+	// Reservations are single use
+	send(id)
+	require.Equal(t, ErrReservationNotFound.Code, readUntil(t, alice, "error")["code"])
+}
+
+func TestEmbedHandler(t *testing.T) {
+	h, _ := newTestHandler(t)
+	for _, text := range []string{"first", "<b>second</b>", "third"} {
+		_, err := h.manager.AddMessage("room", "alice", "alice", text)
+		require.NoError(t, err)
+	}
+
+	request := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/chat/room/embed"+query, nil)
+		r.SetPathValue("streamKey", "room")
+		w := httptest.NewRecorder()
+		h.EmbedHandler(w, r)
+		return w
+	}
+
+	w := request("?limit=2&refresh=10")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Header().Get("Content-Type"), "text/html")
+	body := w.Body.String()
+	require.Contains(t, body, `<meta http-equiv="refresh" content="10">`)
+	require.Contains(t, body, "&lt;b&gt;second&lt;/b&gt;")
+	require.Contains(t, body, "third")
+	require.NotContains(t, body, "first")
+
+	require.Equal(t, "public, max-age=10", w.Header().Get("Cache-Control"))
+	require.Equal(t, "private, max-age=10", request("?refresh=10&token=secret").Header().Get("Cache-Control"))
+	require.Equal(t, "private, max-age=10", request("?refresh=10&access_token=jwt").Header().Get("Cache-Control"))
+
+	w = request("?format=json&refresh=0")
+	var page embedPage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	require.Len(t, page.Messages, 3)
+	require.Zero(t, page.Refresh)
+	require.Empty(t, w.Header().Get("Cache-Control"))
+
+	require.Equal(t, http.StatusBadRequest, request("?refresh=-1").Code)
+}
+
+func TestWebSocketRoomStats(t *testing.T) {
+	_, server := newTestHandler(t)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	// Dashboards subscribe without joining
+	dashboard := dialTestClient(t, server, "room")
+	require.NoError(t, dashboard.WriteJSON(map[string]interface{}{
+		"type": "stats",
+		"data": map[string]interface{}{"subscribe": true, "intervalSeconds": 1},
+	}))
+	require.NoError(t, dashboard.WriteJSON(map[string]interface{}{"type": "ping", "data": map[string]interface{}{"clientTime": 1}}))
+	readUntil(t, dashboard, "pong")
+
+	for _, message := range []string{"hello", "how are you", "what a play", "nice", "gg", "wow"} {
+		require.NoError(t, alice.WriteJSON(map[string]interface{}{
+			"type": "message",
+			"data": map[string]interface{}{"message": message},
+		}))
+	}
+	rateLimit := readUntil(t, alice, "rate_limit")
+	require.Equal(t, CodeRateLimit, rateLimit["code"])
+	require.Equal(t, map[string]interface{}{"retryAfterSeconds": float64(30), "limit": float64(5), "window": float64(10), "tier": TierBurst}, rateLimit["details"])
+
+	stats := readUntil(t, dashboard, "room_stats")["data"].(map[string]interface{})
+	require.Equal(t, "room", stats["streamKey"])
+	require.Equal(t, float64(1), stats["users"])
+	require.Equal(t, float64(5), stats["messages"])
+	require.Equal(t, float64(300), stats["messagesPerMinute"])
+	require.GreaterOrEqual(t, stats["rateLimitHits"], float64(1))
+
+	require.NoError(t, dashboard.WriteJSON(map[string]interface{}{
+		"type": "stats",
+		"data": map[string]interface{}{"subscribe": true, "intervalSeconds": 61},
+	}))
+	require.Contains(t, readUntil(t, dashboard, "error")["error"], "intervalSeconds")
+}
+
+func TestWebSocketRoomStatsRequiresScope(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.tokens = NewTokenStore([]APIToken{{Name: "dashboard", Token: "secret", Scopes: []Scope{ScopeReadStats}}})
+
+	conn := dialTestClient(t, server, "room")
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{
+		"type": "stats",
+		"data": map[string]interface{}{"subscribe": true},
+	}))
+	require.Equal(t, ErrForbidden.Code, readUntil(t, conn, "error")["code"])
+}
+
+func TestWebSocketAckResendsMissedMessages(t *testing.T) {
+	_, server := newTestHandler(t)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	for _, message := range []string{"one", "two", "three"} {
+		require.NoError(t, alice.WriteJSON(map[string]interface{}{
+			"type": "message",
+			"data": map[string]interface{}{"message": message},
+		}))
+		msg := readUntil(t, alice, "message")["data"].(map[string]interface{})
+		require.Equal(t, message, msg["message"])
+	}
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "ack",
+		"data": map[string]interface{}{"seq": 1},
+	}))
+	missed := readUntil(t, alice, "missed")["data"].(map[string]interface{})
+	require.Equal(t, true, missed["complete"])
+
+	messages := missed["messages"].([]interface{})
+	require.Len(t, messages, 2)
+	require.Equal(t, float64(2), messages[0].(map[string]interface{})["seq"])
+	require.Equal(t, "three", messages[1].(map[string]interface{})["message"])
+}
+
+func TestWebSocketMultiRoom(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+	bob := dialTestClient(t, server, "other")
+	joinTestClient(t, bob, "bob")
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "join_room",
+		"data": map[string]interface{}{"room": "other"},
+	}))
+	users := readUntil(t, alice, "users")
+	require.Equal(t, "other", users["room"])
+	require.Len(t, users["data"], 2)
+	readUntil(t, bob, "user_joined") // bob's own
+	require.Equal(t, "alice", readUntil(t, bob, "user_joined")["data"].(map[string]interface{})["userId"])
+
+	// Frames from both rooms arrive tagged with their room
+	require.NoError(t, bob.WriteJSON(map[string]interface{}{
+		"type": "message",
+		"data": map[string]interface{}{"message": "hi from other"},
+	}))
+	readUntil(t, bob, "message") // bob's own
+	msg := readUntil(t, alice, "message")
+	require.Equal(t, "other", msg["room"])
+	require.Equal(t, "hi from other", msg["data"].(map[string]interface{})["message"])
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "message",
+		"data": map[string]interface{}{"message": "hi back", "room": "other"},
+	}))
+	msg = readUntil(t, bob, "message")
+	require.Equal(t, "other", msg["room"])
+	require.Equal(t, "alice", msg["data"].(map[string]interface{})["userId"])
+
+	require.NoError(t, bob.WriteJSON(map[string]interface{}{
+		"type": "message",
+		"data": map[string]interface{}{"message": "sneaky", "room": "room"},
+	}))
+	require.Equal(t, ErrNotInRoom.Code, readUntil(t, bob, "error")["code"])
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "leave_room",
+		"data": map[string]interface{}{"room": "other"},
+	}))
+	require.Equal(t, "other", readUntil(t, alice, "room_left")["room"])
+	require.Equal(t, "alice", readUntil(t, bob, "user_left")["data"].(map[string]interface{})["userId"])
+	require.Equal(t, 1, h.manager.GetUserCount("other"))
+}
+
+func TestStreamSettingsDisableChat(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	put := func(body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPut, "/api/chat/room/settings", strings.NewReader(body))
+		r.SetPathValue("streamKey", "room")
+		w := httptest.NewRecorder()
+		h.SettingsHandler(w, r)
+		return w
+	}
+
+	w := put(`{"chatEnabled": false}`)
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"chatEnabled": false}`, w.Body.String())
+
+	// Existing connections are told why and closed
+	require.NoError(t, alice.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		_, _, err := alice.ReadMessage()
+		if err != nil {
+			var closeErr *websocket.CloseError
+			require.ErrorAs(t, err, &closeErr)
+			require.Equal(t, websocket.ClosePolicyViolation, closeErr.Code)
+			require.Equal(t, ErrChatDisabled.Message, closeErr.Text)
+			break
+		}
+	}
+
+	bob := dialTestClient(t, server, "room")
+	require.NoError(t, bob.WriteJSON(map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{"userId": "bob", "username": "bob"},
+	}))
+	require.Equal(t, ErrChatDisabled.Code, readUntil(t, bob, "error")["code"])
+
+	summaries := h.manager.RoomSummaries()
+	require.Len(t, summaries, 1)
+	require.False(t, summaries[0].ChatEnabled)
+
+	// An empty update keeps the current settings
+	require.JSONEq(t, `{"chatEnabled": false}`, put(`{}`).Body.String())
+
+	put(`{"chatEnabled": true}`)
+	joinTestClient(t, bob, "bob")
+}
+
+func TestStreamSettingsCloseFeeds(t *testing.T) {
+	h, _ := newTestHandler(t)
+
+	feed, chatErr := h.subscribe("room")
+	require.Nil(t, chatErr)
+
+	h.SetStreamSettings("room", StreamSettings{ChatEnabled: false})
+	_, open := <-feed
+	require.False(t, open)
+	require.Zero(t, h.ViewerCount("room"))
+
+	// No new feed can start until chat is back on
+	_, chatErr = h.subscribe("room")
+	require.Equal(t, ErrChatDisabled, chatErr)
+
+	h.SetStreamSettings("room", StreamSettings{ChatEnabled: true})
+	feed, chatErr = h.subscribe("room")
+	require.Nil(t, chatErr)
+	h.unsubscribe("room", feed)
+}
+
+func TestStreamSettingsSurviveRestart(t *testing.T) {
+	store := NewMemoryStore()
+	start := func() *WSHandler {
+		manager := NewManager(DefaultConfig())
+		t.Cleanup(manager.Stop)
+		manager.SetMessageStore(store)
+		_, err := manager.Restore()
+		require.NoError(t, err)
+		return NewWSHandler(manager, NewRateLimiter(manager.config))
+	}
+
+	// Turned off for a stream with a room and one without
+	h := start()
+	h.manager.GetOrCreateRoom("live")
+	h.SetStreamSettings("live", StreamSettings{ChatEnabled: false})
+	h.SetStreamSettings("idle", StreamSettings{ChatEnabled: false})
+
+	h = start()
+	require.False(t, h.manager.StreamSettings("live").ChatEnabled)
+	require.False(t, h.manager.StreamSettings("idle").ChatEnabled)
+	_, exists := h.manager.GetRoom("idle")
+	require.False(t, exists)
+
+	// Turning it back on is remembered too
+	h.SetStreamSettings("idle", StreamSettings{ChatEnabled: true})
+	h = start()
+	require.True(t, h.manager.StreamSettings("idle").ChatEnabled)
+	require.False(t, h.manager.StreamSettings("live").ChatEnabled)
+}
+
+func TestSettingsRequireStreamOwner(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.tokens = NewTokenStore([]APIToken{{Name: "mod", Token: "secret", Scopes: []Scope{ScopeModerate}}})
+	grants := map[string][]string{
+		"olivia": {"owner:room"},
+		"oscar":  {"owner:other"},
+	}
+	h.SetAuthenticator(AuthenticatorFunc(func(_ context.Context, creds Credentials) (*Identity, error) {
+		return &Identity{UserID: creds.Token, Roles: grants[creds.Token]}, nil
+	}))
+	handler := h.RequireStreamOwner(ScopeModerate, h.SettingsHandler)
+
+	get := func(query string) int {
+		r := httptest.NewRequest(http.MethodGet, "/api/chat/room/settings?"+query, nil)
+		r.SetPathValue("streamKey", "room")
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	require.Equal(t, http.StatusOK, get("token=secret"))
+	require.Equal(t, http.StatusOK, get("access_token=olivia"))
+	require.Equal(t, http.StatusUnauthorized, get("access_token=oscar"))
+	require.Equal(t, http.StatusUnauthorized, get(""))
+}
+
+func TestHistoryThrottleSetsRetryAfter(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.readTracker = NewReadTracker(1, time.Minute)
+
+	request := func(streamKey string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/chat/"+streamKey+"/messages", nil)
+		r.SetPathValue("streamKey", streamKey)
+		w := httptest.NewRecorder()
+		h.MessagesHandler(w, r)
+		return w
+	}
+
+	require.Equal(t, http.StatusOK, request("a").Code)
+
+	w := request("b")
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "60", w.Header().Get("Retry-After"))
+
+	var body struct {
+		Code    string       `json:"code"`
+		Details ErrorDetails `json:"details"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, CodeHistoryThrottled, body.Code)
+	require.Equal(t, ErrorDetails{RetryAfterSeconds: 60, Limit: 1, Window: 60, Tier: TierHistoryReads}, body.Details)
+}
+
+func TestRoomHubsFollowRooms(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	indexed := func(streamKey string) []string {
+		userIDs := []string{}
+		for _, conn := range h.roomConnections(streamKey) {
+			userIDs = append(userIDs, conn.UserID)
+		}
+		return userIDs
+	}
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+	bob := dialTestClient(t, server, "other")
+	joinTestClient(t, bob, "bob")
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "join_room",
+		"data": map[string]interface{}{"room": "other"},
+	}))
+	readUntil(t, alice, "users")
+	require.Equal(t, []string{"alice"}, indexed("room"))
+	require.ElementsMatch(t, []string{"alice", "bob"}, indexed("other"))
+	require.Len(t, h.Connections(""), 2)
+
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "leave_room",
+		"data": map[string]interface{}{"room": "other"},
+	}))
+	readUntil(t, alice, "room_left")
+	require.Equal(t, []string{"bob"}, indexed("other"))
+
+	// The room's hub retires with its last connection
+	require.NoError(t, bob.Close())
+	require.Eventually(t, func() bool {
+		return h.hub("other", false) == nil
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestTimeoutEndIsSentToTheUser(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	h.notifyTimeoutEnded("alice")
+	readUntil(t, alice, "timeout_ended")
+}
+
+func TestConnectionCapRejectsUpgrades(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.manager.config.MaxConnections = 1
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/api/chat?streamKey=room"
+	_, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.ErrorIs(t, err, websocket.ErrBadHandshake)
+	require.Equal(t, http.StatusServiceUnavailable, resp.StatusCode)
+	require.Equal(t, "5", resp.Header.Get("Retry-After"))
+
+	var body struct {
+		Code    string       `json:"code"`
+		Details ErrorDetails `json:"details"`
+	}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, CodeServerFull, body.Code)
+	require.Equal(t, ErrorDetails{RetryAfterSeconds: 5, Limit: 1}, body.Details)
+	require.EqualValues(t, 1, h.Diagnostics().RejectedConnections)
+
+	// The slot frees up once the connection closes
+	require.NoError(t, alice.Close())
+	require.Eventually(t, func() bool {
+		return h.openConns.Load() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	dialTestClient(t, server, "room")
+}
+
+func TestSameUserInSeveralTabs(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	// typesUntil reads frames up to one of the given type, returning the types before it
+	typesUntil := func(conn *websocket.Conn, msgType string) []string {
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+		seen := []string{}
+		for {
+			var msg map[string]interface{}
+			require.NoError(t, conn.ReadJSON(&msg))
+			if msg["type"] == msgType {
+				return seen
+			}
+			seen = append(seen, msg["type"].(string))
+		}
+	}
+	say := func(text string) {
+		h.BroadcastSystemMessage("room", text)
+	}
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+	firstTab := dialTestClient(t, server, "room")
+	joinTestClient(t, firstTab, "bob")
+	readUntil(t, alice, "user_joined") // alice's own
+	require.Equal(t, "bob", readUntil(t, alice, "user_joined")["data"].(map[string]interface{})["userId"])
+
+	// A second tab is announced to nobody and isn't a second user
+	secondTab := dialTestClient(t, server, "room")
+	joinTestClient(t, secondTab, "bob")
+	require.Len(t, h.manager.GetUsers("room"), 2)
+	require.Len(t, h.roomConnections("room"), 3)
+
+	say("both tabs")
+	require.NotContains(t, typesUntil(alice, "system"), "user_joined")
+	readUntil(t, firstTab, "system")
+	readUntil(t, secondTab, "system")
+
+	// Closing one tab keeps the user in the room
+	require.NoError(t, firstTab.Close())
+	require.Eventually(t, func() bool {
+		return len(h.roomConnections("room")) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, h.manager.GetUsers("room"), 2)
+
+	say("one tab")
+	require.NotContains(t, typesUntil(alice, "system"), "user_left")
+	readUntil(t, secondTab, "system")
+
+	// The last tab takes the user with it
+	require.NoError(t, secondTab.Close())
+	readUntil(t, alice, "user_left")
+	require.Len(t, h.manager.GetUsers("room"), 1)
+	require.Equal(t, 1, h.manager.membership.RoomCount("alice"))
+	require.Equal(t, 0, h.manager.membership.RoomCount("bob"))
+}
+
+func TestHistoryPaging(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.manager.config.JoinHistorySize = 3
+
+	for i := 0; i < 5; i++ {
+		_, err := h.manager.AddMessage("room", "streamer", "streamer", fmt.Sprintf("message %d", i))
+		require.NoError(t, err)
+	}
+	messageTexts := func(messages []interface{}) []string {
+		texts := []string{}
+		for _, m := range messages {
+			texts = append(texts, m.(map[string]interface{})["message"].(string))
+		}
+		return texts
+	}
+
+	// Joining sends only the newest messages
+	alice := dialTestClient(t, server, "room")
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{"userId": "alice", "username": "alice"},
+	}))
+	history := readUntil(t, alice, "history")["data"].([]interface{})
+	require.Equal(t, []string{"message 2", "message 3", "message 4"}, messageTexts(history))
+
+	// The rest is paged in on request
+	require.NoError(t, alice.WriteJSON(map[string]interface{}{
+		"type": "history_request",
+		"data": map[string]interface{}{"before": history[0].(map[string]interface{})["id"], "limit": 1},
+	}))
+	page := readUntil(t, alice, "history_page")["data"].(map[string]interface{})
+	require.Equal(t, []string{"message 1"}, messageTexts(page["messages"].([]interface{})))
+	require.Equal(t, true, page["hasMore"])
+
+	// Lazy clients get no history on join
+	bob := dialTestClient(t, server, "room")
+	require.NoError(t, bob.WriteJSON(map[string]interface{}{
+		"type": "join",
+		"data": map[string]interface{}{"userId": "bob", "username": "bob", "lazyHistory": true},
+	}))
+	require.NoError(t, bob.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for {
+		var msg map[string]interface{}
+		require.NoError(t, bob.ReadJSON(&msg))
+		require.NotEqual(t, "history", msg["type"])
+		if msg["type"] == "users" {
+			break
+		}
+	}
+
+	require.NoError(t, bob.WriteJSON(map[string]interface{}{
+		"type": "history_request",
+		"data": map[string]interface{}{},
+	}))
+	page = readUntil(t, bob, "history_page")["data"].(map[string]interface{})
+	require.Len(t, page["messages"], 5)
+	require.Equal(t, false, page["hasMore"])
+
+	// Paging from a message that has aged out fails
+	require.NoError(t, bob.WriteJSON(map[string]interface{}{
+		"type": "history_request",
+		"data": map[string]interface{}{"before": "gone"},
+	}))
+	require.Equal(t, CodeCursorNotFound, readUntil(t, bob, "error")["code"])
+}
+
+func TestExportHandler(t *testing.T) {
+	h, _ := newTestHandler(t)
+	m := h.manager
+	m.SetMessageStore(NewMemoryStore())
+
+	_, err := m.AddMessage("my room", "alice", "Alice", "hello, world")
+	require.NoError(t, err)
+	_, err = m.AddMessage("my room", "bob", "Bob", `say "hi"`)
+	require.NoError(t, err)
+
+	export := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/chat/my%20room/export?"+query, nil)
+		r.SetPathValue("streamKey", "my room")
+		w := httptest.NewRecorder()
+		h.ExportHandler(w, r)
+		return w
+	}
+
+	w := export("")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, `attachment; filename="chat-my_room.json"`, w.Header().Get("Content-Disposition"))
+	var messages []ChatMessage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &messages))
+	require.Equal(t, []string{"hello, world", `say "hi"`}, messageTexts(messages))
+
+	w = export("format=csv")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 3)
+	require.Equal(t, "seq,id,timestamp,userId,username,message,originSystem,originId,deletedAt,editedAt", lines[0])
+	require.True(t, strings.HasPrefix(lines[1], "1,"))
+	require.True(t, strings.HasSuffix(lines[2], `,bob,Bob,"say ""hi""",,,,`))
+
+	require.Equal(t, http.StatusBadRequest, export("format=xml").Code)
+
+	// Rooms that never had a message export an empty history
+	r := httptest.NewRequest(http.MethodGet, "/api/chat/empty/export", nil)
+	r.SetPathValue("streamKey", "empty")
+	w = httptest.NewRecorder()
+	h.ExportHandler(w, r)
+	require.Equal(t, "[]\n", w.Body.String())
+}
+
+// pagedStore records the limits a message store's history is read with
+type pagedStore struct {
+	*MemoryStore
+	limits []int
+}
+
+func (s *pagedStore) Range(streamKey string, afterSeq int64, limit int) ([]ChatMessage, error) {
+	s.limits = append(s.limits, limit)
+	return s.MemoryStore.Range(streamKey, afterSeq, limit)
+}
+
+func TestExportHandlerReadsPages(t *testing.T) {
+	h, _ := newTestHandler(t)
+	store := &pagedStore{MemoryStore: NewMemoryStore()}
+	for seq := int64(1); seq <= exportPageSize+1; seq++ {
+		require.NoError(t, store.Append(ChatMessage{ID: fmt.Sprint(seq), StreamKey: "room", Seq: seq, UserID: "alice", Message: "hi"}))
+	}
+	h.manager.SetMessageStore(store)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/chat/room/export", nil)
+	r.SetPathValue("streamKey", "room")
+	w := httptest.NewRecorder()
+	h.ExportHandler(w, r)
+
+	var messages []ChatMessage
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &messages))
+	require.Len(t, messages, exportPageSize+1)
+	require.Equal(t, []int{exportPageSize, exportPageSize, exportPageSize}, store.limits)
+}
+
+func TestExportHandlerNeutralizesFormulas(t *testing.T) {
+	h, _ := newTestHandler(t)
+	h.manager.SetMessageStore(NewMemoryStore())
+	for _, text := range []string{"=HYPERLINK(\"http://evil\")", "+1", "-1", "@SUM(A1)", "fine"} {
+		_, err := h.manager.AddMessage("room", "alice", "=cmd", text)
+		require.NoError(t, err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/api/chat/room/export?format=csv", nil)
+	r.SetPathValue("streamKey", "room")
+	w := httptest.NewRecorder()
+	h.ExportHandler(w, r)
+
+	lines := strings.Split(strings.TrimSpace(w.Body.String()), "\n")
+	require.Len(t, lines, 6)
+	require.Contains(t, lines[1], `,'=cmd,"'=HYPERLINK(""http://evil"")",`)
+	require.Contains(t, lines[2], ",'+1,")
+	require.Contains(t, lines[3], ",'-1,")
+	require.Contains(t, lines[4], ",'@SUM(A1),")
+	require.Contains(t, lines[5], ",fine,")
+}
+
+func TestWebSocketRejoinRefused(t *testing.T) {
+	h, server := newTestHandler(t)
+
+	conn := dialTestClient(t, server, "room")
+	joinTestClient(t, conn, "a")
+	require.NoError(t, conn.WriteJSON(map[string]interface{}{"type": "join", "data": map[string]interface{}{"userId": "b", "username": "b"}}))
+	require.Equal(t, CodeAlreadyJoined, readUntil(t, conn, "error")["code"])
+
+	users := h.manager.GetUsers("room")
+	require.Len(t, users, 1)
+	require.Equal(t, "a", users[0].UserID)
+
+	// Closing leaves nothing behind in the room or its hub
+	conn.Close()
+	require.Eventually(t, func() bool {
+		return len(h.manager.GetUsers("room")) == 0 && len(h.roomConnections("room")) == 0
+	}, 5*time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,413 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+const (
+	userStatsSaveInterval = time.Minute
+	favoriteEmoteCount    = 5
+)
+
+// shortcodePattern matches :emote: style emote names
+var shortcodePattern = regexp.MustCompile(`^:[A-Za-z0-9_+-]+:$`)
+
+// UserAggregate is one user's chat activity in a channel, kept for "chat wrapped" recaps
+type UserAggregate struct {
+	UserID       string         `json:"userId"`
+	Username     string         `json:"username"`
+	Messages     int            `json:"messages"`
+	Emotes       map[string]int `json:"emotes"`
+	Hours        [24]int        `json:"hours"` // messages by UTC hour of day
+	FirstMessage time.Time      `json:"firstMessage"`
+	LastMessage  time.Time      `json:"lastMessage"`
+}
+
+// channelStats holds the aggregates of everyone who has chatted in a channel
+type channelStats struct {
+	Users   map[string]*UserAggregate `json:"users"`
+	changes int                       // bumped on every change, so a flush can tell whether it saved the latest
+	saved   int                       // changes as of the last write to disk
+}
+
+// UserStatsStore aggregates per-user chat activity by channel. With a directory it
+// persists each channel's aggregates there so recaps can span restarts, and only
+// keeps channels in memory until they are saved.
+type UserStatsStore struct {
+	dir      string // "" keeps stats in memory only
+	channels map[string]*channelStats
+	mutex    sync.Mutex
+	flushMux sync.Mutex // one flush at a time, so an older snapshot never lands over a newer one
+}
+
+// NewUserStatsStore creates a store persisting to dir, or to nothing if dir is empty
+func NewUserStatsStore(dir string) *UserStatsStore {
+	return &UserStatsStore{
+		dir:      dir,
+		channels: make(map[string]*channelStats),
+	}
+}
+
+// Record counts a message towards its author's aggregate
+func (s *UserStatsStore) Record(msg ChatMessage) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	channel := s.channelLocked(msg.StreamKey)
+	agg, exists := channel.Users[msg.UserID]
+	if !exists {
+		agg = &UserAggregate{
+			UserID:       msg.UserID,
+			Emotes:       make(map[string]int),
+			FirstMessage: msg.Timestamp,
+		}
+		channel.Users[msg.UserID] = agg
+	}
+
+	agg.Username = msg.Username
+	agg.Messages++
+	agg.Hours[msg.Timestamp.UTC().Hour()]++
+	agg.LastMessage = msg.Timestamp
+	for _, emote := range extractEmotes(msg.Message) {
+		agg.Emotes[emote]++
+	}
+	channel.changes++
+}
+
+// channelLocked returns a channel's stats, loading them from disk the first time
+func (s *UserStatsStore) channelLocked(streamKey string) *channelStats {
+	if channel, exists := s.channels[streamKey]; exists {
+		return channel
+	}
+
+	channel := s.loadLocked(streamKey)
+	s.channels[streamKey] = channel
+	return channel
+}
+
+// loadLocked reads a channel's persisted stats, if any
+func (s *UserStatsStore) loadLocked(streamKey string) *channelStats {
+	channel := &channelStats{Users: make(map[string]*UserAggregate)}
+	if s.dir != "" {
+		data, err := os.ReadFile(s.path(streamKey))
+		if err == nil {
+			err = json.Unmarshal(data, channel)
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to load chat stats for %s: %v", streamKey, err)
+		}
+	}
+	return channel
+}
+
+// path is the file a channel's stats are persisted to
+func (s *UserStatsStore) path(streamKey string) string {
+	return filepath.Join(s.dir, url.PathEscape(streamKey)+".json")
+}
+
+// Flush writes every channel changed since the last flush to disk, then drops the
+// channels saved as they are from memory; they are loaded again when next needed.
+// Channels are snapshotted under the lock and written outside it, so recording
+// never waits on the disk.
+func (s *UserStatsStore) Flush() error {
+	if s.dir == "" {
+		return nil
+	}
+
+	s.flushMux.Lock()
+	defer s.flushMux.Unlock()
+
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return err
+	}
+
+	type snapshot struct {
+		streamKey string
+		channel   *channelStats
+		changes   int
+		data      []byte
+	}
+
+	var errs []error
+	snapshots := []snapshot{}
+	s.mutex.Lock()
+	for streamKey, channel := range s.channels {
+		if channel.changes == channel.saved {
+			continue
+		}
+		data, err := json.Marshal(channel)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		snapshots = append(snapshots, snapshot{streamKey: streamKey, channel: channel, changes: channel.changes, data: data})
+	}
+	s.mutex.Unlock()
+
+	written := []snapshot{}
+	for _, snap := range snapshots {
+		// Write then rename so a crash never leaves a truncated file
+		tmp := s.path(snap.streamKey) + ".tmp"
+		if err := os.WriteFile(tmp, snap.data, 0o644); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if err := os.Rename(tmp, s.path(snap.streamKey)); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		written = append(written, snap)
+	}
+
+	s.mutex.Lock()
+	for _, snap := range written {
+		snap.channel.saved = snap.changes
+	}
+	for streamKey, channel := range s.channels {
+		if channel.changes == channel.saved {
+			delete(s.channels, streamKey)
+		}
+	}
+	s.mutex.Unlock()
+
+	return errors.Join(errs...)
+}
+
+// EmoteCount is how often a user sent an emote
+type EmoteCount struct {
+	Emote string `json:"emote"`
+	Count int    `json:"count"`
+}
+
+// UserRecap summarizes a user's activity in a channel
+type UserRecap struct {
+	UserID         string       `json:"userId"`
+	Username       string       `json:"username"`
+	Messages       int          `json:"messages"`
+	FavoriteEmotes []EmoteCount `json:"favoriteEmotes"`
+	MostActiveHour int          `json:"mostActiveHour"` // UTC hour of day
+	FirstMessage   time.Time    `json:"firstMessage"`
+	LastMessage    time.Time    `json:"lastMessage"`
+}
+
+// recap summarizes an aggregate
+func (a *UserAggregate) recap() UserRecap {
+	emotes := make([]EmoteCount, 0, len(a.Emotes))
+	for emote, count := range a.Emotes {
+		emotes = append(emotes, EmoteCount{Emote: emote, Count: count})
+	}
+	sort.Slice(emotes, func(i, j int) bool {
+		if emotes[i].Count != emotes[j].Count {
+			return emotes[i].Count > emotes[j].Count
+		}
+		return emotes[i].Emote < emotes[j].Emote
+	})
+
+	mostActive := 0
+	for hour, count := range a.Hours {
+		if count > a.Hours[mostActive] {
+			mostActive = hour
+		}
+	}
+
+	return UserRecap{
+		UserID:         a.UserID,
+		Username:       a.Username,
+		Messages:       a.Messages,
+		FavoriteEmotes: emotes[:min(len(emotes), favoriteEmoteCount)],
+		MostActiveHour: mostActive,
+		FirstMessage:   a.FirstMessage,
+		LastMessage:    a.LastMessage,
+	}
+}
+
+// Export returns recaps of every user who chatted in a channel, most active first
+func (s *UserStatsStore) Export(streamKey string) []UserRecap {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// Lookups of channels nobody chatted in aren't kept
+	channel, exists := s.channels[streamKey]
+	if !exists {
+		channel = s.loadLocked(streamKey)
+		if len(channel.Users) > 0 {
+			s.channels[streamKey] = channel
+		}
+	}
+
+	recaps := make([]UserRecap, 0, len(channel.Users))
+	for _, agg := range channel.Users {
+		recaps = append(recaps, agg.recap())
+	}
+	sort.Slice(recaps, func(i, j int) bool {
+		if recaps[i].Messages != recaps[j].Messages {
+			return recaps[i].Messages > recaps[j].Messages
+		}
+		return recaps[i].UserID < recaps[j].UserID
+	})
+	return recaps
+}
+
+// UserActivity returns a user's aggregate in every channel they chatted in, by
+// stream key, including channels only persisted to disk
+func (s *UserStatsStore) UserActivity(userID string) map[string]UserAggregate {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	activity := make(map[string]UserAggregate)
+	for streamKey := range s.streamKeysLocked() {
+		channel, exists := s.channels[streamKey]
+		if !exists {
+			channel = s.loadLocked(streamKey)
+		}
+		if agg, exists := channel.Users[userID]; exists {
+			activity[streamKey] = *agg
+		}
+	}
+	return activity
+}
+
+// ForgetUser removes a user's aggregate from every channel, in memory and on disk,
+// and returns how many channels had one
+func (s *UserStatsStore) ForgetUser(userID string) (int, error) {
+	s.mutex.Lock()
+	forgotten := 0
+	for streamKey := range s.streamKeysLocked() {
+		channel, exists := s.channels[streamKey]
+		if !exists {
+			channel = s.loadLocked(streamKey)
+		}
+		if _, exists := channel.Users[userID]; !exists {
+			continue
+		}
+		delete(channel.Users, userID)
+		channel.changes++
+		s.channels[streamKey] = channel
+		forgotten++
+	}
+	s.mutex.Unlock()
+
+	// Erasure reaches the disk now rather than at the next save
+	return forgotten, s.Flush()
+}
+
+// streamKeysLocked returns every channel with stats, including channels only
+// persisted to disk
+func (s *UserStatsStore) streamKeysLocked() map[string]bool {
+	streamKeys := make(map[string]bool)
+	for streamKey := range s.channels {
+		streamKeys[streamKey] = true
+	}
+	if s.dir != "" {
+		entries, err := os.ReadDir(s.dir)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Failed to list chat stats: %v", err)
+		}
+		for _, entry := range entries {
+			name, ok := strings.CutSuffix(entry.Name(), ".json")
+			if !ok {
+				continue
+			}
+			if streamKey, err := url.PathUnescape(name); err == nil {
+				streamKeys[streamKey] = true
+			}
+		}
+	}
+	return streamKeys
+}
+
+// extractEmotes returns the :shortcode: emotes and emoji in a message
+func extractEmotes(message string) []string {
+	var emotes []string
+	for _, word := range strings.Fields(message) {
+		if shortcodePattern.MatchString(word) {
+			emotes = append(emotes, word)
+			continue
+		}
+		for _, r := range word {
+			if unicode.Is(unicode.So, r) {
+				emotes = append(emotes, string(r))
+			}
+		}
+	}
+	return emotes
+}
+
+// userStatsWorker periodically persists per-user stats until the manager stops
+func (m *Manager) userStatsWorker() {
+	defer trackWorker("manager.userStats")()
+
+	ticker := time.NewTicker(userStatsSaveInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := m.userStats.Flush(); err != nil {
+				log.Printf("Failed to save chat stats: %v", err)
+			}
+		case <-m.stopUserStats:
+			if err := m.userStats.Flush(); err != nil {
+				log.Printf("Failed to save chat stats: %v", err)
+			}
+			return
+		}
+	}
+}
+
+// WrappedHandler serves GET /api/chat/{streamKey}/wrapped?user=&limit=N, the per-user
+// recaps streamers turn into end-of-stream or end-of-year "chat wrapped" content.
+// They profile individual users, so only moderators and the stream's owner may
+// read them.
+func (h *WSHandler) WrappedHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	streamKey := r.PathValue("streamKey")
+	if streamKey == "" {
+		http.Error(w, "Missing streamKey", http.StatusBadRequest)
+		return
+	}
+
+	recaps := h.manager.userStats.Export(streamKey)
+
+	params := r.URL.Query()
+	if user := params.Get("user"); user != "" {
+		filtered := []UserRecap{}
+		for _, recap := range recaps {
+			if recap.UserID == user {
+				filtered = append(filtered, recap)
+			}
+		}
+		recaps = filtered
+	}
+
+	if val := params.Get("limit"); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit <= 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		recaps = recaps[:min(len(recaps), limit)]
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"streamKey": streamKey,
+		"users":     recaps,
+	})
+}
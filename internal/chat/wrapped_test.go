@@ -0,0 +1,96 @@
+package chat
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExtractEmotes(t *testing.T) {
+	require.Equal(t, []string{":pog:", "🔥", "🔥"}, extractEmotes("that was :pog: 🔥🔥 :not an emote"))
+	require.Empty(t, extractEmotes("plain text"))
+}
+
+func TestUserStatsStore(t *testing.T) {
+	dir := t.TempDir()
+	store := NewUserStatsStore(dir)
+
+	evening := time.Date(2026, 1, 1, 20, 0, 0, 0, time.UTC)
+	store.Record(ChatMessage{StreamKey: "room", UserID: "alice", Username: "alice", Message: "hi :wave:", Timestamp: evening})
+	store.Record(ChatMessage{StreamKey: "room", UserID: "alice", Username: "Alice", Message: ":wave: :pog:", Timestamp: evening.Add(time.Minute)})
+	store.Record(ChatMessage{StreamKey: "room", UserID: "alice", Username: "Alice", Message: "morning", Timestamp: evening.Add(12 * time.Hour)})
+	store.Record(ChatMessage{StreamKey: "room", UserID: "bob", Username: "bob", Message: "yo", Timestamp: evening})
+	require.NoError(t, store.Flush())
+
+	// A fresh store picks the channel up from disk
+	recaps := NewUserStatsStore(dir).Export("room")
+	require.Len(t, recaps, 2)
+
+	alice := recaps[0]
+	require.Equal(t, "Alice", alice.Username)
+	require.Equal(t, 3, alice.Messages)
+	require.Equal(t, []EmoteCount{{Emote: ":wave:", Count: 2}, {Emote: ":pog:", Count: 1}}, alice.FavoriteEmotes)
+	require.Equal(t, 20, alice.MostActiveHour)
+	require.True(t, alice.FirstMessage.Equal(evening))
+	require.Equal(t, "bob", recaps[1].UserID)
+
+	require.Empty(t, store.Export("elsewhere"))
+}
+
+func TestUserStatsStoreEvictsSavedChannels(t *testing.T) {
+	store := NewUserStatsStore(t.TempDir())
+	store.Record(ChatMessage{StreamKey: "room", UserID: "alice", Username: "alice", Message: "hi", Timestamp: time.Now()})
+	require.NoError(t, store.Flush())
+	require.Empty(t, store.channels)
+
+	// Saved channels are picked up from disk again, in full
+	store.Record(ChatMessage{StreamKey: "room", UserID: "alice", Username: "alice", Message: "again", Timestamp: time.Now()})
+	require.Len(t, store.channels, 1)
+	require.Equal(t, 2, store.Export("room")[0].Messages)
+	require.NoError(t, store.Flush())
+	require.Empty(t, store.channels)
+	require.Equal(t, 2, store.Export("room")[0].Messages)
+
+	// Without a directory memory is all there is
+	memory := NewUserStatsStore("")
+	memory.Record(ChatMessage{StreamKey: "room", UserID: "alice", Username: "alice", Message: "hi", Timestamp: time.Now()})
+	require.NoError(t, memory.Flush())
+	require.Len(t, memory.Export("room"), 1)
+}
+
+func TestWrappedHandler(t *testing.T) {
+	h, _ := newTestHandler(t)
+	for _, user := range []string{"alice", "alice", "bob"} {
+		_, err := h.manager.AddMessage("room", user, user, "gg 🎉")
+		require.NoError(t, err)
+	}
+
+	request := func(query string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/api/chat/room/wrapped"+query, nil)
+		r.SetPathValue("streamKey", "room")
+		w := httptest.NewRecorder()
+		h.WrappedHandler(w, r)
+		return w
+	}
+
+	w := request("?limit=1")
+	require.Equal(t, http.StatusOK, w.Code)
+	var body struct {
+		Users []UserRecap `json:"users"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Users, 1)
+	require.Equal(t, "alice", body.Users[0].UserID)
+	require.Equal(t, []EmoteCount{{Emote: "🎉", Count: 2}}, body.Users[0].FavoriteEmotes)
+
+	w = request("?user=bob")
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Len(t, body.Users, 1)
+	require.Equal(t, 1, body.Users[0].Messages)
+
+	require.Equal(t, http.StatusBadRequest, request("?limit=zero").Code)
+}
@@ -0,0 +1,145 @@
+package chat
+
+import "time"
+
+const writePoolQueue = 4096
+
+// frameWriter is a transport the write pool can write frames to
+type frameWriter interface {
+	// write sends one frame, reporting false once the client connection has failed
+	write(c *Connection, message WSMessage) bool
+}
+
+// writePool writes queued frames to clients on a fixed number of workers rather
+// than a goroutine per connection. A connection with frames waiting is scheduled
+// once; the worker that picks it up writes everything queued so far, merging runs
+// of chat messages into message_batch frames for clients that accept them. A slow
+// client ties up one worker for at most a write deadline, and broadcasting only
+// ever queues frames, so it never waits on a socket.
+type writePool struct {
+	ready chan *Connection // connections with frames to write
+}
+
+// newWritePool starts a pool of workers
+func newWritePool(workers int) *writePool {
+	p := &writePool{ready: make(chan *Connection, writePoolQueue)}
+	for i := 0; i < workers; i++ {
+		go p.worker()
+	}
+	return p
+}
+
+// schedule queues a connection for writing unless it already is. It blocks only
+// when every worker is busy and the queue is full.
+func (p *writePool) schedule(c *Connection) {
+	if c.writeScheduled.CompareAndSwap(false, true) {
+		p.ready <- c
+	}
+}
+
+// Pending returns the number of connections waiting for a worker
+func (p *writePool) Pending() int {
+	return len(p.ready)
+}
+
+// worker writes for scheduled connections
+func (p *writePool) worker() {
+	defer trackWorker("ws.writer")()
+
+	for c := range p.ready {
+		p.flush(c)
+	}
+}
+
+// flush writes a connection's queued frames. Frames queued meanwhile are written
+// too, going back to the queue between passes so a busy client can't hold a
+// worker while others wait.
+func (p *writePool) flush(c *Connection) {
+	writer := c.Transport.(frameWriter)
+
+	for {
+		select {
+		case <-c.done:
+			return
+		default:
+		}
+
+		for _, frame := range coalesce(c, pending(c)) {
+			if !writer.write(c, frame) {
+				c.Close("")
+				return
+			}
+		}
+
+		c.writeScheduled.Store(false)
+		if len(c.Send) == 0 || !c.writeScheduled.CompareAndSwap(false, true) {
+			// Nothing left, or whoever queued the rest has scheduled the connection
+			return
+		}
+
+		select {
+		case p.ready <- c:
+			return
+		default:
+			// The queue is full; keep writing rather than wait for room in it
+		}
+	}
+}
+
+// pending takes the frames queued for a connection, without waiting for more
+func pending(c *Connection) []WSMessage {
+	frames := make([]WSMessage, 0, len(c.Send))
+	for len(frames) < cap(c.Send) {
+		select {
+		case frame := <-c.Send:
+			frames = append(frames, frame)
+		default:
+			return frames
+		}
+	}
+	return frames
+}
+
+// coalesce merges consecutive chat messages for the same room into message_batch
+// frames of up to maxBatchSize messages, for clients speaking protocol version 2.
+// Other frames keep their place between the batches.
+func coalesce(c *Connection, frames []WSMessage) []WSMessage {
+	if c.protocolVersion.Load() < 2 || len(frames) < 2 {
+		return frames
+	}
+
+	out := make([]WSMessage, 0, len(frames))
+	for i := 0; i < len(frames); {
+		first := frames[i]
+		chatMsg, ok := batchable(first)
+		if !ok {
+			out = append(out, first)
+			i++
+			continue
+		}
+
+		messages := []*ChatMessage{chatMsg}
+		for i++; i < len(frames) && len(messages) < maxBatchSize; i++ {
+			next, ok := batchable(frames[i])
+			if !ok || frames[i].Room != first.Room {
+				break
+			}
+			messages = append(messages, next)
+		}
+
+		if len(messages) == 1 {
+			out = append(out, first)
+		} else {
+			out = append(out, WSMessage{Type: "message_batch", Data: messages, Room: first.Room, Timestamp: time.Now()})
+		}
+	}
+	return out
+}
+
+// wake schedules the connection's queued frames for writing if a write pool
+// serves it; transports with their own writer read the queue themselves
+func (c *Connection) wake() {
+	if c.writes != nil {
+		c.writes.schedule(c)
+	}
+}
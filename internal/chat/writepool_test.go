@@ -0,0 +1,117 @@
+package chat
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/require"
+)
+
+// recordingTransport records the frames the write pool writes to it
+type recordingTransport struct {
+	mu     sync.Mutex
+	frames []WSMessage
+}
+
+func (t *recordingTransport) Close(string) error { return nil }
+
+func (t *recordingTransport) write(_ *Connection, message WSMessage) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.frames = append(t.frames, message)
+	return true
+}
+
+func (t *recordingTransport) written() []WSMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]WSMessage(nil), t.frames...)
+}
+
+func TestWritePoolBatchesPendingFrames(t *testing.T) {
+	transport := &recordingTransport{}
+	c := &Connection{Transport: transport, Send: make(chan WSMessage, 16), done: make(chan struct{})}
+	c.protocolVersion.Store(2)
+
+	chat := func(room, text string) WSMessage {
+		return WSMessage{Type: "message", Room: room, Data: &ChatMessage{Message: text}}
+	}
+	for _, frame := range []WSMessage{
+		{Type: "hello"},
+		chat("a", "one"), chat("a", "two"), chat("a", "three"),
+		chat("b", "four"),
+		{Type: "system", Room: "a"},
+		chat("a", "five"),
+	} {
+		c.Send <- frame
+	}
+
+	// Queued before the pool has any workers, so everything is pending at once
+	p := &writePool{ready: make(chan *Connection, 1)}
+	c.writes = p
+	c.wake()
+	c.wake()
+	require.Equal(t, 1, p.Pending(), "a connection is scheduled once")
+	go p.worker()
+
+	require.Eventually(t, func() bool { return len(transport.written()) == 5 }, time.Second, 5*time.Millisecond)
+	frames := transport.written()
+	require.Equal(t, "hello", frames[0].Type)
+	require.Equal(t, "message_batch", frames[1].Type)
+	require.Len(t, frames[1].Data, 3)
+	require.Equal(t, "a", frames[1].Room)
+	require.Equal(t, "message", frames[2].Type)
+	require.Equal(t, "b", frames[2].Room)
+	require.Equal(t, "system", frames[3].Type)
+	require.Equal(t, "message", frames[4].Type)
+
+	// Frames queued later are written on the next wake
+	c.send(chat("a", "six"))
+	require.Eventually(t, func() bool { return len(transport.written()) == 6 }, time.Second, 5*time.Millisecond)
+}
+
+func TestWritePoolFanout(t *testing.T) {
+	h, server := newTestHandler(t)
+	h.writers = newWritePool(2)
+
+	alice := dialTestClient(t, server, "room")
+	joinTestClient(t, alice, "alice")
+
+	bob := dialTestClient(t, server, "room")
+	require.NoError(t, bob.WriteJSON(map[string]interface{}{
+		"type": "hello",
+		"data": map[string]interface{}{"protocolVersion": 2},
+	}))
+	joinTestClient(t, bob, "bob")
+
+	texts := []string{"one", "two", "three"}
+	for _, text := range texts {
+		require.NoError(t, alice.WriteJSON(map[string]interface{}{
+			"type": "message",
+			"data": map[string]interface{}{"message": text},
+		}))
+	}
+
+	// Bob may get the messages in batches or one by one, but in order
+	var received []string
+	require.NoError(t, bob.SetReadDeadline(time.Now().Add(5*time.Second)))
+	for len(received) < len(texts) {
+		var msg map[string]interface{}
+		require.NoError(t, bob.ReadJSON(&msg))
+		switch msg["type"] {
+		case "message":
+			received = append(received, msg["data"].(map[string]interface{})["message"].(string))
+		case "message_batch":
+			for _, m := range msg["data"].([]interface{}) {
+				received = append(received, m.(map[string]interface{})["message"].(string))
+			}
+		}
+	}
+	require.Equal(t, texts, received)
+
+	// Closing the socket tears the session down as with a writer per connection
+	require.NoError(t, bob.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")))
+	require.Eventually(t, func() bool { return len(h.roomConnections("room")) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
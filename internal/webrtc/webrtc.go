@@ -114,8 +114,11 @@ func getStream(streamKey string, whipSessionId string) (*stream, error) {
 	}
 
 	if whipSessionId != "" {
-		foundStream.hasWHIPClient.Store(true)
+		wasLive := foundStream.hasWHIPClient.Swap(true)
 		foundStream.sessionId = whipSessionId
+		if !wasLive {
+			notifyStreamLifecycle(streamKey, true)
+		}
 	}
 
 	return foundStream, nil
@@ -147,6 +150,7 @@ func peerConnectionDisconnected(forWHIP bool, streamKey string, sessionId string
 			return
 		}
 		stream.hasWHIPClient.Store(false)
+		notifyStreamLifecycle(streamKey, false)
 	}
 
 	// Only delete stream if all WHEP Sessions are gone and have no WHIP Client
@@ -455,6 +459,34 @@ type whepSessionStatus struct {
 	PacketsWritten uint64 `json:"packetsWritten"`
 }
 
+// StreamLifecycleHandler is told when a stream goes live and when its WHIP client
+// stops publishing. It is called with the stream map locked, so it must not call
+// back into this package.
+type StreamLifecycleHandler func(streamKey string, live bool)
+
+var streamLifecycleHandler StreamLifecycleHandler
+
+// OnStreamLifecycle installs the handler told about streams starting and stopping.
+// Call it before serving.
+func OnStreamLifecycle(handler StreamLifecycleHandler) {
+	streamLifecycleHandler = handler
+}
+
+func notifyStreamLifecycle(streamKey string, live bool) {
+	if streamLifecycleHandler != nil {
+		streamLifecycleHandler(streamKey, live)
+	}
+}
+
+// IsStreamLive reports whether a WHIP client is currently publishing to streamKey
+func IsStreamLive(streamKey string) bool {
+	streamMapLock.Lock()
+	defer streamMapLock.Unlock()
+
+	stream, ok := streamMap[streamKey]
+	return ok && stream.hasWHIPClient.Load()
+}
+
 func GetStreamStatuses() []StreamStatus {
 	streamMapLock.Lock()
 	defer streamMapLock.Unlock()
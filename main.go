@@ -9,10 +9,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/glimesh/broadcast-box/internal/chat"
@@ -259,12 +261,134 @@ func main() {
 	chatConfig := chat.LoadFromEnv()
 	chatManager := chat.NewManager(chatConfig)
 	rateLimiter := chat.NewRateLimiter(chatConfig)
+	chatManager.SetRateLimiter(rateLimiter)
 	chatWSHandler := chat.NewWSHandler(chatManager, rateLimiter)
 
+	if chatConfig.RequireLiveStream {
+		chatManager.SetStreamLookup(webrtc.IsStreamLive)
+	}
+	webrtc.OnStreamLifecycle(func(streamKey string, live bool) {
+		if live {
+			chatManager.StreamStarted(streamKey)
+		} else {
+			chatManager.StreamEnded(streamKey)
+		}
+	})
+
+	if chatConfig.NATSURL != "" {
+		broker, err := chat.NewNATSBroker(chatConfig.NATSURL, chatConfig.NATSStream)
+		if err != nil {
+			log.Fatalf("Failed to connect chat to NATS: %v", err)
+		}
+		if err := chatWSHandler.SetBroker(broker); err != nil {
+			log.Fatalf("Failed to subscribe chat to NATS: %v", err)
+		}
+	}
+
+	var messageStore io.Closer
+	if chatConfig.RedisURL != "" {
+		retention := time.Duration(chatConfig.MessageRetentionMinutes) * time.Minute
+		if chatConfig.RedisStreams {
+			streams, err := chat.NewRedisStreamStore(chatConfig.RedisURL, chatConfig.RedisStreamMaxLength, retention)
+			if err != nil {
+				log.Fatalf("Failed to connect chat history to Redis: %v", err)
+			}
+			chatManager.SetHistoryStore(streams)
+			chatManager.SetMessageStore(streams)
+			messageStore = streams
+		} else {
+			history, err := chat.NewRedisHistory(chatConfig.RedisURL, chatConfig.MaxMessagesPerStream, retention)
+			if err != nil {
+				log.Fatalf("Failed to connect chat history to Redis: %v", err)
+			}
+			chatManager.SetHistoryStore(history)
+		}
+	}
+
+	// A database, when configured, persists messages in place of Redis Streams. With
+	// tenants, each tenant's rooms get a database file or schema of their own.
+	tenants, err := chat.ParseTenants(chatConfig.Tenants)
+	if err != nil {
+		log.Fatalf("Invalid chat tenants: %v", err)
+	}
+	var database chat.TenantBackend
+	switch {
+	case chatConfig.PostgresURL != "":
+		database = chat.PostgresTenants{URL: chatConfig.PostgresURL, Batching: chat.WriteBatchingFromConfig(chatConfig)}
+	case chatConfig.SQLitePath != "":
+		database = chat.SQLiteTenants{Path: chatConfig.SQLitePath, Batching: chat.WriteBatchingFromConfig(chatConfig)}
+	case len(tenants) > 0:
+		log.Printf("Chat tenants need CHAT_SQLITE_PATH or CHAT_POSTGRES_URL; storing every tenant's messages together")
+	}
+	if database != nil {
+		var store chat.ClosableStore
+		if len(tenants) > 0 {
+			store, err = chat.NewTenantStore(tenants, database)
+		} else {
+			store, err = database.Open(chat.DefaultTenant)
+		}
+		if err != nil {
+			log.Fatalf("Failed to open chat message store: %v", err)
+		}
+		chatManager.SetMessageStore(store)
+		messageStore = store
+	}
+	if restored, err := chatManager.Restore(); err != nil {
+		log.Printf("Failed to restore chat rooms: %v", err)
+	} else if restored > 0 {
+		log.Printf("Restored %d chat rooms", restored)
+	}
+	if timeouts, ok := messageStore.(chat.TimeoutStore); ok {
+		rateLimiter.SetTimeoutStore(timeouts)
+		if restored, err := rateLimiter.RestoreTimeouts(); err != nil {
+			log.Printf("Failed to restore chat timeouts: %v", err)
+		} else if restored > 0 {
+			log.Printf("Restored %d chat timeouts", restored)
+		}
+	}
+
 	log.Printf("Chat system initialized with %d MB memory limit", chatConfig.MaxTotalMemoryMB)
 	capacity := chatConfig.CalculateCapacity()
 	log.Printf("Chat capacity: ~%v streams, ~%v total messages", capacity["estimated_max_streams"], capacity["total_message_capacity"])
 
+	if chatConfig.WarmupStatusURL != "" {
+		go func() {
+			if err := chatManager.WarmUp(chatWSHandler.OwnedRooms(chat.StatusWarmupSource(chatConfig.WarmupStatusURL)), chatManager.StoredHistory); err != nil {
+				log.Printf("Chat warm-up failed: %v", err)
+			}
+		}()
+	}
+
+	if chatConfig.IRCAddress != "" {
+		go func() {
+			log.Fatal(chat.NewIRCGateway(chatWSHandler).ListenAndServe(chatConfig.IRCAddress))
+		}()
+	}
+
+	if chatConfig.GRPCAddress != "" {
+		go func() {
+			log.Fatal(chat.NewGRPCServer(chatWSHandler).ListenAndServe(chatConfig.GRPCAddress))
+		}()
+	}
+
+	// Close chat connections gradually on shutdown so a rolling restart doesn't
+	// send every client to the other instances at once
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM)
+		<-signals
+		chatWSHandler.Drain(chatConfig.DrainReconnectURL, time.Duration(chatConfig.DrainSeconds)*time.Second)
+		if err := chatWSHandler.CloseEventLog(); err != nil {
+			log.Printf("Failed to close chat event log: %v", err)
+		}
+		if messageStore != nil {
+			if err := messageStore.Close(); err != nil {
+				log.Printf("Failed to close chat message store: %v", err)
+			}
+		}
+		os.Exit(0)
+	}()
+
 	if os.Getenv("NETWORK_TEST_ON_START") == "true" {
 		fmt.Println(networkTestIntroMessage) //nolint
 
@@ -310,11 +434,41 @@ func main() {
 	mux.HandleFunc("/api/status", corsHandler(statusHandler))
 
 	// Chat endpoints
-	mux.HandleFunc("/api/chat", corsHandler(chatWSHandler.HTTPHandler))
-	mux.HandleFunc("/api/chat/stats", corsHandler(func(w http.ResponseWriter, r *http.Request) {
+	mux.HandleFunc("/api/chat", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.HTTPHandler)))
+	mux.HandleFunc("/api/chat/poll", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.LongPollHandler)))
+	mux.HandleFunc("/api/chat/ready", corsHandler(chatWSHandler.ReadyHandler))
+	mux.HandleFunc("/api/chat/stats", corsHandler(chatWSHandler.RequireScope(chat.ScopeReadStats, func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(chatManager.GetStats())
-	}))
+	})))
+	mux.HandleFunc("/api/chat/{streamKey}/messages", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeReadHistory, chatWSHandler.MessagesHandler))))
+	mux.HandleFunc("/api/chat/{streamKey}/events", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeReadHistory, chatWSHandler.EventsHandler))))
+	mux.HandleFunc("/api/chat/{streamKey}/embed", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeReadHistory, chatWSHandler.EmbedHandler))))
+	mux.HandleFunc("/api/chat/{streamKey}/replay", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeReadHistory, chatWSHandler.ReplaySessionsHandler))))
+	mux.HandleFunc("/api/chat/{streamKey}/replay/{sessionID}", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeReadHistory, chatWSHandler.ReplayHandler))))
+	mux.HandleFunc("/api/chat/{streamKey}/replay/{sessionID}/summary", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeReadHistory, chatWSHandler.ReplaySummaryHandler))))
+	mux.HandleFunc("/api/chat/{streamKey}/export", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeReadHistory, chatWSHandler.ExportHandler))))
+	mux.HandleFunc("/api/chat/{streamKey}/search", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeModerate, chatWSHandler.SearchHandler))))
+	mux.HandleFunc("/api/chat/{streamKey}/wrapped", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireStreamOwner(chat.ScopeModerate, chatWSHandler.WrappedHandler))))
+	mux.HandleFunc("/api/chat/{streamKey}/settings", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireStreamOwner(chat.ScopeModerate, chatWSHandler.SettingsHandler))))
+	mux.HandleFunc("/api/chat/{streamKey}/system", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeWriteSystem, chatWSHandler.SystemMessageHandler))))
+	mux.HandleFunc("/api/chat/admin/users/{userID}/revoke", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.RevokeSessionsHandler)))
+	mux.HandleFunc("/api/chat/admin/users/{userID}/profile", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.ProfileHandler)))
+	mux.HandleFunc("/api/chat/admin/users/{userID}/export", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.ExportUserHandler)))
+	mux.HandleFunc("/api/chat/admin/users/{userID}/erase", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.EraseUserHandler)))
+	mux.HandleFunc("/api/chat/admin/users/{userID}/disconnect", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.DisconnectHandler)))
+	mux.HandleFunc("/api/chat/admin/rooms", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.RoomsHandler)))
+	mux.HandleFunc("/api/chat/admin/rooms/{streamKey}/clear", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.ClearRoomHandler))))
+	mux.HandleFunc("/api/chat/admin/rooms/{streamKey}/import", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.ImportHandler))))
+	mux.HandleFunc("/api/chat/admin/rooms/{streamKey}/modes", corsHandler(chatWSHandler.RouteRoom(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.RoomModesHandler))))
+	mux.HandleFunc("/api/chat/admin/diagnostics", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.DiagnosticsHandler)))
+	mux.HandleFunc("/api/chat/admin/connections", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.ConnectionsHandler)))
+	mux.HandleFunc("/api/chat/admin/ratelimit/{userID}", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.RateLimitHandler)))
+	mux.HandleFunc("/api/chat/admin/trace/{userID}", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.TraceHandler)))
+	mux.HandleFunc("/api/chat/admin/tenants", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.TenantsHandler)))
+	mux.HandleFunc("/api/chat/admin/tenants/{tenant}", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.TenantHandler)))
+	mux.HandleFunc("/api/chat/admin/compact", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.CompactHandler)))
+	mux.HandleFunc("/api/chat/admin/drain", corsHandler(chatWSHandler.RequireScope(chat.ScopeAdmin, chatWSHandler.DrainHandler)))
 
 	server := &http.Server{
 		Handler: mux,
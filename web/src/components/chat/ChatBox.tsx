@@ -22,12 +22,20 @@ const ChatBox: React.FC<ChatBoxProps> = ({
     messages,
     users,
     userCount,
+    viewerCount,
+    latency,
+    roomModes,
+    limits,
+    cooldown,
+    chatDisabled,
     isConnected,
     isTimeout,
     timeoutDuration,
     error,
     sendMessage,
     sendTyping,
+    hasOlderMessages,
+    loadOlderMessages,
     currentUserId,
     currentUsername,
   } = useChat({ streamKey, enabled: true });
@@ -44,7 +52,7 @@ const ChatBox: React.FC<ChatBoxProps> = ({
   }, [isFullscreen]);
 
   const handleSendMessage = (message: string) => {
-    sendMessage(message);
+    return sendMessage(message);
   };
 
   const handleMentionClick = (username: string) => {
@@ -97,8 +105,21 @@ const ChatBox: React.FC<ChatBoxProps> = ({
                   Chat
                 </span>
                 <span className="text-xs text-white/60">
-                  {userCount} online
+                  {viewerCount ?? userCount} watching
                 </span>
+                {roomModes?.slowModeSeconds ? (
+                  <span className="text-xs text-yellow-300/80">
+                    Slow mode ({roomModes.slowModeSeconds}s)
+                  </span>
+                ) : null}
+                {roomModes?.emoteOnly && (
+                  <span className="text-xs text-yellow-300/80">Emote only</span>
+                )}
+                {latency !== null && (
+                  <span className="text-xs text-white/40" title="Chat latency">
+                    {latency} ms
+                  </span>
+                )}
               </div>
               <button
                 onClick={() => setIsVisible(false)}
@@ -121,6 +142,8 @@ const ChatBox: React.FC<ChatBoxProps> = ({
                 messages={messages}
                 currentUserId={currentUserId}
                 onMentionClick={handleMentionClick}
+                hasOlderMessages={hasOlderMessages}
+                onLoadOlder={loadOlderMessages}
               />
             </div>
 
@@ -130,7 +153,9 @@ const ChatBox: React.FC<ChatBoxProps> = ({
               onTyping={sendTyping}
               isTimeout={isTimeout}
               timeoutDuration={timeoutDuration}
-              disabled={!isConnected}
+              disabled={!isConnected || chatDisabled}
+              maxLength={limits?.maxMessageLength}
+              cooldown={cooldown}
             />
           </div>
         )}
@@ -185,6 +210,8 @@ const ChatBox: React.FC<ChatBoxProps> = ({
           messages={messages}
           currentUserId={currentUserId}
           onMentionClick={handleMentionClick}
+          hasOlderMessages={hasOlderMessages}
+          onLoadOlder={loadOlderMessages}
         />
       </div>
 
@@ -194,7 +221,9 @@ const ChatBox: React.FC<ChatBoxProps> = ({
         onTyping={sendTyping}
         isTimeout={isTimeout}
         timeoutDuration={timeoutDuration}
-        disabled={!isConnected}
+        disabled={!isConnected || chatDisabled}
+        maxLength={limits?.maxMessageLength}
+        cooldown={cooldown}
       />
     </div>
   );
@@ -2,12 +2,13 @@ import React, { useState, useRef, useEffect } from 'react';
 import { formatTimeout } from '../../utils/time';
 
 interface MessageInputProps {
-  onSendMessage: (message: string) => void;
+  onSendMessage: (message: string) => boolean | void;
   onTyping?: (isTyping: boolean) => void;
   isTimeout: boolean;
   timeoutDuration: number;
   disabled?: boolean;
   maxLength?: number;
+  cooldown?: number; // seconds until the room's rate limits allow another message
 }
 
 const MessageInput: React.FC<MessageInputProps> = ({
@@ -17,6 +18,7 @@ const MessageInput: React.FC<MessageInputProps> = ({
   timeoutDuration,
   disabled = false,
   maxLength = 500,
+  cooldown = 0,
 }) => {
   const [message, setMessage] = useState('');
   const [isTyping, setIsTyping] = useState(false);
@@ -60,7 +62,10 @@ const MessageInput: React.FC<MessageInputProps> = ({
       return;
     }
 
-    onSendMessage(message);
+    // Keep the message if it couldn't be sent, so it can be retried
+    if (onSendMessage(message) === false) {
+      return;
+    }
     setMessage('');
 
     // Stop typing indicator
@@ -126,7 +131,7 @@ const MessageInput: React.FC<MessageInputProps> = ({
 
         <button
           type="submit"
-          disabled={disabled || isTimeout || !message.trim()}
+          disabled={disabled || isTimeout || cooldown > 0 || !message.trim()}
           className={`
             px-4 py-2 md:py-1.5
             bg-blue-600 hover:bg-blue-500
@@ -137,7 +142,7 @@ const MessageInput: React.FC<MessageInputProps> = ({
             min-w-[60px]
           `}
         >
-          Send
+          {cooldown > 0 ? `${cooldown}s` : 'Send'}
         </button>
       </div>
 
@@ -6,12 +6,17 @@ interface MessageListProps {
   messages: ChatMessage[];
   currentUserId: string;
   onMentionClick?: (username: string) => void;
+  // Older history the server still holds, paged in when scrolled to the top
+  hasOlderMessages?: boolean;
+  onLoadOlder?: () => void;
 }
 
 const MessageList: React.FC<MessageListProps> = ({
   messages,
   currentUserId,
   onMentionClick,
+  hasOlderMessages = false,
+  onLoadOlder,
 }) => {
   const messagesEndRef = useRef<HTMLDivElement>(null);
   const containerRef = useRef<HTMLDivElement>(null);
@@ -32,6 +37,10 @@ const MessageList: React.FC<MessageListProps> = ({
     const isAtBottom = scrollHeight - scrollTop - clientHeight < 50;
 
     setAutoScroll(isAtBottom);
+
+    if (scrollTop < 50 && hasOlderMessages) {
+      onLoadOlder?.();
+    }
   };
 
   // Parse message for @mentions
@@ -55,9 +55,12 @@ const UserList: React.FC<UserListProps> = ({
                     transition-colors
                   `}
                 >
-                  <span className={isCurrentUser ? '⭐ ' : '• '}>
+                  <span className={isCurrentUser ? '⭐ ' : '• '} style={user.color ? { color: user.color } : undefined}>
                     {user.username}
                   </span>
+                  {user.badges?.map((badge) => (
+                    <span key={badge} className="text-xs text-yellow-400 ml-1">[{badge}]</span>
+                  ))}
                   {isCurrentUser && (
                     <span className="text-xs text-green-500 ml-1">(You)</span>
                   )}
@@ -1,21 +1,23 @@
 import { useEffect, useRef, useState, useCallback } from 'react';
 import { getUserId, getUsername } from '../utils/username';
+import {
+  ChatMessage,
+  ChatUser as ProtocolChatUser,
+  PROTOCOL_VERSION,
+  RoomLimits,
+  RoomModes,
+} from '../utils/chatProtocol';
+import { sendDelay } from '../utils/rateLimit';
 
-export interface ChatMessage {
-  id: string;
-  streamKey: string;
-  userId: string;
-  username: string;
-  message: string;
-  timestamp: string;
-}
+export type { ChatMessage };
 
-export interface ChatUser {
-  userId: string;
-  username: string;
-  connectedAt: string;
-  isActive: boolean;
-}
+export type ChatUser = Pick<ProtocolChatUser, 'userId' | 'username' | 'connectedAt' | 'isActive' | 'color' | 'badges'>;
+
+// How often to measure chat latency
+const PING_INTERVAL_MS = 15000;
+
+// How long our sent messages are remembered for client-side rate limiting
+const SENT_HISTORY_MS = 60000;
 
 interface UseChatOptions {
   streamKey: string;
@@ -29,10 +31,35 @@ export function useChat({ streamKey, enabled = true }: UseChatOptions) {
   const [isTimeout, setIsTimeout] = useState(false);
   const [timeoutDuration, setTimeoutDuration] = useState(0);
   const [error, setError] = useState<string | null>(null);
+  const [features, setFeatures] = useState<Record<string, boolean>>({});
+  const [viewerCount, setViewerCount] = useState<number | null>(null);
+  const [roomModes, setRoomModes] = useState<RoomModes | null>(null);
+  const [limits, setLimits] = useState<RoomLimits | null>(null);
+  const [latency, setLatency] = useState<number | null>(null);
+  const [clockSkew, setClockSkew] = useState<number | null>(null);
+  // The streamer turned chat off for this stream
+  const [chatDisabled, setChatDisabled] = useState(false);
+  // Seconds until the room's rate limits let us send again
+  const [cooldown, setCooldown] = useState(0);
+  // The server may hold messages older than the oldest we have
+  const [hasOlderMessages, setHasOlderMessages] = useState(false);
 
   const wsRef = useRef<WebSocket | null>(null);
   const reconnectTimeoutRef = useRef<number | undefined>(undefined);
   const reconnectAttemptsRef = useRef(0);
+  // A message ID reserved ahead of time so sent messages can render immediately
+  const reservationRef = useRef<{ id: string; expiresAt: number } | null>(null);
+  const pendingIdsRef = useRef<Set<string>>(new Set());
+  // When our recent messages were sent, oldest first
+  const sentAtRef = useRef<number[]>([]);
+  // Sequence number of the newest message received, to spot gaps
+  const lastSeqRef = useRef(0);
+  // A history_request is waiting for its page
+  const loadingOlderRef = useRef(false);
+  // The server is sending us digests because we fell behind; hold off on typing indicators
+  const backpressureRef = useRef(false);
+  // The server is restarting: where to reconnect (empty for the same address) once it closes us
+  const drainRef = useRef<{ reconnectUrl: string; reconnecting: boolean } | null>(null);
 
   const userId = getUserId();
   const username = getUsername();
@@ -43,18 +70,25 @@ export function useChat({ streamKey, enabled = true }: UseChatOptions) {
 
     try {
       const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-      const wsUrl = `${protocol}//${window.location.host}/api/chat?streamKey=${streamKey}`;
+      const base = drainRef.current?.reconnectUrl || `${protocol}//${window.location.host}`;
+      const wsUrl = `${base}/api/chat?streamKey=${streamKey}`;
 
       console.log('Connecting to chat:', wsUrl);
       const ws = new WebSocket(wsUrl);
 
       ws.onopen = () => {
         console.log('Chat connected');
+        drainRef.current = null;
         setIsConnected(true);
         setError(null);
+        setChatDisabled(false);
         reconnectAttemptsRef.current = 0;
 
-        // Join the chat
+        // Announce our protocol version, then join the chat
+        ws.send(JSON.stringify({
+          type: 'hello',
+          data: { protocolVersion: PROTOCOL_VERSION },
+        }));
         ws.send(JSON.stringify({
           type: 'join',
           data: {
@@ -78,10 +112,24 @@ export function useChat({ streamKey, enabled = true }: UseChatOptions) {
         setError('Connection error');
       };
 
-      ws.onclose = () => {
+      ws.onclose = (event) => {
         console.log('Chat disconnected');
         setIsConnected(false);
 
+        // The server ended the session on purpose, e.g. chat was turned off; don't come back
+        if (event.code === 1008) {
+          setError(event.reason || 'Disconnected from chat');
+          return;
+        }
+
+        // The server drained us for a restart; come back right away, spread out a little
+        if (enabled && drainRef.current && !drainRef.current.reconnecting) {
+          drainRef.current.reconnecting = true;
+          reconnectAttemptsRef.current = 0;
+          reconnectTimeoutRef.current = window.setTimeout(connect, Math.random() * 1000);
+          return;
+        }
+
         // Attempt to reconnect with exponential backoff
         if (enabled && reconnectAttemptsRef.current < 5) {
           const delay = Math.min(1000 * Math.pow(2, reconnectAttemptsRef.current), 10000);
@@ -101,17 +149,110 @@ export function useChat({ streamKey, enabled = true }: UseChatOptions) {
     }
   }, [enabled, streamKey, userId, username]);
 
+  // Ask the server for a message ID to use for the next message
+  const reserveMessageId = () => {
+    if (wsRef.current?.readyState === WebSocket.OPEN) {
+      wsRef.current.send(JSON.stringify({ type: 'reserve', data: {} }));
+    }
+  };
+
+  // Add messages, replacing optimistic copies that share their ID
+  const mergeMessages = (incoming: ChatMessage[]) => {
+    setMessages((prev) => {
+      const confirmed = new Set(incoming.map((m) => m.id));
+      confirmed.forEach((id) => pendingIdsRef.current.delete(id));
+      return [...prev.filter((m) => !confirmed.has(m.id)), ...incoming];
+    });
+  };
+
+  // Ask the server for messages we missed when sequence numbers skip ahead
+  const trackSeq = (incoming: ChatMessage[]) => {
+    for (const m of incoming) {
+      if (!m.seq) continue;
+      if (lastSeqRef.current && m.seq > lastSeqRef.current + 1 && wsRef.current?.readyState === WebSocket.OPEN) {
+        wsRef.current.send(JSON.stringify({ type: 'ack', data: { seq: lastSeqRef.current } }));
+      }
+      lastSeqRef.current = Math.max(lastSeqRef.current, m.seq);
+    }
+  };
+
+  // Drop optimistic messages the server refused
+  const dropPendingMessages = () => {
+    if (pendingIdsRef.current.size === 0) return;
+    const pending = new Set(pendingIdsRef.current);
+    pendingIdsRef.current.clear();
+    setMessages((prev) => prev.filter((m) => !pending.has(m.id)));
+  };
+
   // Handle incoming messages
   const handleMessage = (data: any) => {
+    // Frames about other rooms multiplexed onto the connection belong to other chats
+    if (data.room && data.room !== streamKey) return;
+
     switch (data.type) {
+      case 'hello':
+        // Server protocol version and enabled features
+        setFeatures(data.data?.features || {});
+        backpressureRef.current = false;
+        break;
+
+      case 'room_state':
+        // What the room allows, sent once we've joined
+        setRoomModes(data.data.modes);
+        setLimits(data.data.limits);
+        setFeatures(data.data.features || {});
+        if (data.data.features?.reserve) {
+          reserveMessageId();
+        }
+        break;
+
+      case 'reserved':
+        reservationRef.current = {
+          id: data.data.id,
+          expiresAt: new Date(data.data.expiresAt).getTime(),
+        };
+        break;
+
+      case 'room_modes':
+        // A moderator changed the room's modes
+        setRoomModes(data.data);
+        break;
+
       case 'history':
         // Received message history on connect
         setMessages(data.data || []);
+        setHasOlderMessages((data.data || []).length > 0);
+        loadingOlderRef.current = false;
+        lastSeqRef.current = 0;
+        trackSeq(data.data || []);
+        break;
+
+      case 'history_page':
+        // Older messages we asked for, in front of what we already have
+        loadingOlderRef.current = false;
+        setHasOlderMessages(data.data.hasMore);
+        setMessages((prev) => {
+          const known = new Set(prev.map((m) => m.id));
+          return [...data.data.messages.filter((m: ChatMessage) => !known.has(m.id)), ...prev];
+        });
         break;
 
       case 'message':
         // New message received
-        setMessages((prev) => [...prev, data.data]);
+        trackSeq([data.data]);
+        mergeMessages([data.data]);
+        break;
+
+      case 'message_batch':
+        // Messages the server coalesced into one frame, oldest first
+        trackSeq(data.data);
+        mergeMessages(data.data);
+        break;
+
+      case 'missed':
+        // Messages resent after we reported a gap, put back in order
+        mergeMessages(data.data.messages);
+        setMessages((prev) => [...prev].sort((a, b) => (a.seq || Infinity) - (b.seq || Infinity)));
         break;
 
       case 'users':
@@ -129,10 +270,19 @@ export function useChat({ streamKey, enabled = true }: UseChatOptions) {
             username: data.data.username,
             connectedAt: new Date().toISOString(),
             isActive: true,
+            color: data.data.color,
+            badges: data.data.badges,
           }];
         });
         break;
 
+      case 'user_updated':
+        // A user's profile changed their color or badges
+        setUsers((prev) => prev.map(u => u.userId === data.data.userId
+          ? { ...u, color: data.data.color, badges: data.data.badges }
+          : u));
+        break;
+
       case 'user_left':
         // User left
         setUsers((prev) => prev.filter(u => u.userId !== data.data.userId));
@@ -144,18 +294,79 @@ export function useChat({ streamKey, enabled = true }: UseChatOptions) {
         setTimeoutDuration(data.data.duration || 0);
         break;
 
+      case 'timeout_ended':
+        setIsTimeout(false);
+        setTimeoutDuration(0);
+        break;
+
       case 'rate_limit':
-        // Rate limited
+        // Rate limited; spam protection times the user out for details.retryAfterSeconds
+        dropPendingMessages();
+        if (data.details?.retryAfterSeconds) {
+          setIsTimeout(true);
+          setTimeoutDuration(data.details.retryAfterSeconds);
+        }
         setError(data.error || 'You are sending messages too quickly');
         setTimeout(() => setError(null), 3000);
         break;
 
       case 'error':
         // Error message
+        if (data.code === 'CHAT_DISABLED') {
+          setChatDisabled(true);
+        }
+        if (data.code === 'TIMEOUT' && data.details?.retryAfterSeconds) {
+          // Still timed out; resync the countdown with the server's
+          setIsTimeout(true);
+          setTimeoutDuration(data.details.retryAfterSeconds);
+        }
+        if (data.code === 'CURSOR_NOT_FOUND') {
+          // Our oldest message has aged out of the room's history
+          loadingOlderRef.current = false;
+          setHasOlderMessages(false);
+          break;
+        }
+        dropPendingMessages();
         setError(data.error || 'An error occurred');
         setTimeout(() => setError(null), 5000);
         break;
 
+      case 'pong': {
+        // Round trip time, and how far the server clock is ahead of ours
+        const rtt = Date.now() - data.data.clientTime;
+        setLatency(rtt);
+        setClockSkew(data.data.serverTime - (data.data.clientTime + rtt / 2));
+        break;
+      }
+
+      case 'viewer_count_changed':
+        // Everyone watching chat, including read-only viewers
+        setViewerCount(data.data.count);
+        break;
+
+      case 'chat_cleared':
+        // A moderator cleared the chat
+        setMessages([]);
+        break;
+
+      case 'messages_redacted':
+        // The author's data was erased; drop everything we show from them
+        setMessages((prev) => prev.filter((m) => m.userId !== data.data.userId));
+        break;
+
+      case 'drain':
+        // The server is restarting and will close us shortly
+        drainRef.current = { reconnectUrl: data.data.reconnectUrl || '', reconnecting: false };
+        break;
+
+      case 'backpressure':
+        // Our connection fell behind; messages arrive as message_batch digests until it catches up
+        backpressureRef.current = data.data.digest;
+        if (data.data.message) {
+          console.log('Backpressure:', data.data.message);
+        }
+        break;
+
       case 'system':
         // System message
         console.log('System:', data.data.message);
@@ -177,24 +388,71 @@ export function useChat({ streamKey, enabled = true }: UseChatOptions) {
       return false;
     }
 
+    // Hold back messages the server would reject for going too fast
+    const delay = sendDelay(sentAtRef.current, message.trim().length, limits, roomModes?.slowModeSeconds);
+    if (delay > 0) {
+      setError(`Slow down! You can send again in ${Math.ceil(delay / 1000)}s`);
+      setTimeout(() => setError(null), 3000);
+      return false;
+    }
+
     try {
+      // Render the message right away under a reserved ID; the broadcast replaces it
+      const reservation = reservationRef.current;
+      reservationRef.current = null;
+      const id = reservation && reservation.expiresAt > Date.now() + 1000 ? reservation.id : undefined;
+      if (id) {
+        pendingIdsRef.current.add(id);
+        setMessages((prev) => [...prev, {
+          id,
+          streamKey,
+          userId,
+          username,
+          message: message.trim(),
+          timestamp: new Date().toISOString(),
+        }]);
+      }
+
       wsRef.current.send(JSON.stringify({
         type: 'message',
-        data: { message: message.trim() },
+        data: { message: message.trim(), id },
       }));
+
+      const now = Date.now();
+      sentAtRef.current = [...sentAtRef.current.filter((t) => t > now - SENT_HISTORY_MS), now];
+      setCooldown(Math.ceil(sendDelay(sentAtRef.current, 0, limits, roomModes?.slowModeSeconds, now) / 1000));
+      if (reservation) {
+        reserveMessageId();
+      }
       return true;
     } catch (e) {
       console.error('Failed to send message:', e);
       setError('Failed to send message');
       return false;
     }
-  }, []);
+  }, [streamKey, userId, username, limits, roomModes]);
+
+  // Page in the messages before the oldest one we have
+  const loadOlderMessages = useCallback(() => {
+    if (loadingOlderRef.current || !hasOlderMessages || wsRef.current?.readyState !== WebSocket.OPEN) {
+      return;
+    }
+
+    loadingOlderRef.current = true;
+    wsRef.current.send(JSON.stringify({
+      type: 'history_request',
+      data: { before: messages[0]?.id },
+    }));
+  }, [messages, hasOlderMessages]);
 
   // Send typing indicator
   const sendTyping = useCallback((isTyping: boolean) => {
     if (!wsRef.current || wsRef.current.readyState !== WebSocket.OPEN) {
       return;
     }
+    if (backpressureRef.current && isTyping) {
+      return;
+    }
 
     try {
       wsRef.current.send(JSON.stringify({
@@ -221,7 +479,38 @@ export function useChat({ streamKey, enabled = true }: UseChatOptions) {
     };
   }, [connect]);
 
+  // Measure chat latency while connected
+  useEffect(() => {
+    if (!isConnected) {
+      setLatency(null);
+      return;
+    }
+
+    const ping = () => {
+      if (wsRef.current?.readyState === WebSocket.OPEN) {
+        wsRef.current.send(JSON.stringify({
+          type: 'ping',
+          data: { clientTime: Date.now() },
+        }));
+      }
+    };
+
+    ping();
+    const interval = setInterval(ping, PING_INTERVAL_MS);
+    return () => clearInterval(interval);
+  }, [isConnected]);
+
   // Handle timeout countdown
+  // Count down while the room's rate limits hold back sending
+  useEffect(() => {
+    if (cooldown <= 0) return;
+
+    const timer = window.setTimeout(() => {
+      setCooldown(Math.ceil(sendDelay(sentAtRef.current, 0, limits, roomModes?.slowModeSeconds) / 1000));
+    }, 1000);
+    return () => clearTimeout(timer);
+  }, [cooldown, limits, roomModes]);
+
   useEffect(() => {
     if (isTimeout && timeoutDuration > 0) {
       const interval = setInterval(() => {
@@ -242,12 +531,22 @@ export function useChat({ streamKey, enabled = true }: UseChatOptions) {
     messages,
     users,
     userCount: users.length,
+    viewerCount,
+    latency,
+    clockSkew,
     isConnected,
     isTimeout,
     timeoutDuration,
     error,
+    features,
+    roomModes,
+    limits,
+    cooldown,
+    chatDisabled,
     sendMessage,
     sendTyping,
+    hasOlderMessages,
+    loadOlderMessages,
     currentUserId: userId,
     currentUsername: username,
   };
@@ -0,0 +1,437 @@
+// Code generated by protocolgen from internal/chat. DO NOT EDIT.
+
+export const PROTOCOL_VERSION = 2;
+export const MIN_PROTOCOL_VERSION = 1;
+
+// HelloFrame is carried by client "hello" frames
+export interface HelloFrame {
+  protocolVersion: number;
+}
+
+// JoinFrame is carried by client "join" frames
+export interface JoinFrame {
+  userId?: string;
+  username?: string;
+  lazyHistory?: boolean;
+  guest?: boolean;
+}
+
+// ChatFrame is carried by client "message" frames
+export interface ChatFrame {
+  message: string;
+  id?: string;
+  room?: string;
+}
+
+// TypingFrame is carried by client "typing" frames
+export interface TypingFrame {
+  isTyping: boolean;
+  room?: string;
+}
+
+// PingFrame is carried by client "ping" frames
+export interface PingFrame {
+  clientTime: number;
+}
+
+// ReserveFrame is carried by client "reserve" frames
+export interface ReserveFrame {
+}
+
+// StatsFrame is carried by client "stats" frames
+export interface StatsFrame {
+  subscribe: boolean;
+  intervalSeconds?: number;
+}
+
+// AckFrame is carried by client "ack" frames
+export interface AckFrame {
+  seq: number;
+  room?: string;
+}
+
+// JoinRoomFrame is carried by client "join_room" frames
+export interface JoinRoomFrame {
+  room: string;
+}
+
+// LeaveRoomFrame is carried by client "leave_room" frames
+export interface LeaveRoomFrame {
+  room: string;
+}
+
+// HistoryRequestFrame is carried by client "history_request" frames
+export interface HistoryRequestFrame {
+  before?: string;
+  limit?: number;
+  room?: string;
+}
+
+// SetProfileFrame is carried by client "set_profile" frames
+export interface SetProfileFrame {
+  color?: string;
+  preferences?: Record<string, string>;
+}
+
+// ModerateFrame is carried by client "moderate" frames
+export interface ModerateFrame {
+  action: string;
+  userId?: string;
+  durationSeconds?: number;
+  room?: string;
+}
+
+// HelloEvent is carried by server "hello" frames
+export interface HelloEvent {
+  protocolVersion: number;
+  minProtocolVersion: number;
+  features: Record<string, boolean>;
+}
+
+// ChatMessage is carried by server "history", "message", "message_batch" frames
+export interface ChatMessage {
+  id: string;
+  streamKey: string;
+  userId: string;
+  username: string;
+  message: string;
+  timestamp: string;
+  origin?: MessageOrigin;
+  seq?: number;
+}
+
+// MessageOrigin is part of ChatMessage
+export interface MessageOrigin {
+  system: string;
+  id: string;
+}
+
+// ChatUser is carried by server "users" frames
+export interface ChatUser {
+  userId: string;
+  username: string;
+  connectedAt: string;
+  lastMessage: string;
+  messageCount: number;
+  charCount: number;
+  timeoutUntil: string;
+  violations: number;
+  isActive: boolean;
+  color?: string;
+  roles?: string[];
+  badges?: string[];
+}
+
+// UserEvent is carried by server "user_joined", "user_left", "user_updated", "username_assigned" frames
+export interface UserEvent {
+  userId: string;
+  username: string;
+  color?: string;
+  badges?: string[];
+}
+
+// UserProfile is carried by server "profile" frames
+export interface UserProfile {
+  userId: string;
+  color?: string;
+  badges?: string[];
+  preferences?: Record<string, string>;
+  updatedAt: string;
+}
+
+// GuestEvent is carried by server "guest" frames
+export interface GuestEvent {
+  username: string;
+  canChat: boolean;
+}
+
+// TypingEvent is carried by server "typing" frames
+export interface TypingEvent {
+  userId: string;
+  username: string;
+  isTyping: boolean;
+}
+
+// SystemEvent is carried by server "system" frames
+export interface SystemEvent {
+  message: string;
+}
+
+// TimeoutEvent is carried by server "timeout" frames
+export interface TimeoutEvent {
+  duration: number;
+}
+
+// RoomState is carried by server "room_state" frames
+export interface RoomState {
+  modes: RoomModes;
+  limits: RoomLimits;
+  features: Record<string, boolean>;
+}
+
+// RoomModes is carried by server "room_modes" frames
+export interface RoomModes {
+  slowModeSeconds: number;
+  readOnly: boolean;
+  emoteOnly: boolean;
+}
+
+// RoomLimits is part of RoomState
+export interface RoomLimits {
+  maxMessageLength: number;
+  maxMessagesPerMinute: number;
+  rateWindows: RateWindow[];
+}
+
+// RateWindow is part of RoomLimits
+export interface RateWindow {
+  tier: string;
+  messages: number;
+  windowSeconds: number;
+  minLength?: number;
+}
+
+// ModerationEvent is carried by server "moderation" frames
+export interface ModerationEvent {
+  action: string;
+  moderatorId: string;
+  userId?: string;
+  durationSeconds?: number;
+}
+
+// RedactedEvent is carried by server "messages_redacted" frames
+export interface RedactedEvent {
+  userId: string;
+  messageIds: string[];
+}
+
+// ViewerCountEvent is carried by server "viewer_count_changed" frames
+export interface ViewerCountEvent {
+  streamKey: string;
+  count: number;
+}
+
+// PongEvent is carried by server "pong" frames
+export interface PongEvent {
+  clientTime: number;
+  serverTime: number;
+}
+
+// ReservedEvent is carried by server "reserved" frames
+export interface ReservedEvent {
+  id: string;
+  expiresAt: string;
+}
+
+// RoomStatsEvent is carried by server "room_stats" frames
+export interface RoomStatsEvent {
+  streamKey: string;
+  users: number;
+  viewers: number;
+  messages: number;
+  messagesPerMinute: number;
+  rateLimitHits: number;
+  intervalSeconds: number;
+}
+
+// MissedEvent is carried by server "missed" frames
+export interface MissedEvent {
+  messages: ChatMessage[];
+  complete: boolean;
+}
+
+// HistoryPageEvent is carried by server "history_page" frames
+export interface HistoryPageEvent {
+  messages: ChatMessage[];
+  hasMore: boolean;
+}
+
+// BackpressureEvent is carried by server "backpressure" frames
+export interface BackpressureEvent {
+  digest: boolean;
+  intervalSeconds?: number;
+  message?: string;
+  skipped?: number;
+}
+
+// DrainEvent is carried by server "drain" frames
+export interface DrainEvent {
+  reconnectUrl?: string;
+  seconds: number;
+}
+
+// FieldError is part of the server frame envelope
+export interface FieldError {
+  field: string;
+  message: string;
+}
+
+// ErrorDetails is part of the server frame envelope
+export interface ErrorDetails {
+  retryAfterSeconds?: number;
+  limit?: number;
+  window?: number;
+  tier?: string;
+}
+
+// Codes of "error" and "rate_limit" frames
+export type ErrorCode =
+  // The room has as many users as it allows
+  | 'ROOM_FULL'
+  // The user is in as many rooms as one user may be; details.limit is the cap
+  | 'TOO_MANY_ROOMS'
+  // The user joined rooms too quickly; details give the limit, window and when to retry
+  | 'JOIN_RATE_LIMIT'
+  // The frame needs a join first
+  | 'NOT_JOINED'
+  // The session has already joined
+  | 'ALREADY_JOINED'
+  // The frame names a room the connection hasn't joined
+  | 'NOT_IN_ROOM'
+  // The room does not exist
+  | 'ROOM_NOT_FOUND'
+  // The server's room policy refused to create the room
+  | 'ROOM_NOT_ALLOWED'
+  // No stream has this key
+  | 'STREAM_NOT_FOUND'
+  // The stream is no longer live
+  | 'STREAM_ENDED'
+  // The streamer turned chat off; don't reconnect until it's back on
+  | 'CHAT_DISABLED'
+  // History was withheld because the user reads too many rooms; retry after details.retryAfterSeconds
+  | 'HISTORY_THROTTLED'
+  // The history page cursor is no longer stored
+  | 'CURSOR_NOT_FOUND'
+  // Joining needs credentials the server accepts, and the client's were missing, invalid, expired or revoked
+  | 'UNAUTHENTICATED'
+  // The join's userId isn't the user the connection's credentials belong to
+  | 'IDENTITY_MISMATCH'
+  // The server doesn't let guests join; join as a user
+  | 'GUESTS_DISABLED'
+  // Guests can watch but not chat; join as a user to chat
+  | 'GUEST_READ_ONLY'
+  // Another user in the room has the same name, or one that looks like it; join under another
+  | 'USERNAME_TAKEN'
+  // The name, or one that looks like it, is reserved for a signed-in account
+  | 'USERNAME_RESERVED'
+  // The room is read-only
+  | 'READ_ONLY'
+  // Slow mode allows one message per details.window seconds; retry after details.retryAfterSeconds
+  | 'SLOW_MODE'
+  // The room only accepts emotes
+  | 'EMOTE_ONLY'
+  // The user's roles in the room don't allow the action, or the user it targets ranks as high
+  | 'NOT_PERMITTED'
+  // The user is timed out; retry after details.retryAfterSeconds
+  | 'TIMEOUT'
+  // Too many messages in a short burst; the user is timed out
+  | 'RATE_LIMIT'
+  // Too many long messages; details give the limit and window
+  | 'RATE_LIMIT_LONG_MESSAGE'
+  // Too many medium-length messages; details give the limit and window
+  | 'RATE_LIMIT_MEDIUM_MESSAGE'
+  // The message is longer than details.limit characters
+  | 'MESSAGE_TOO_LONG'
+  // Sustained messaging above the spam limit; the user is timed out
+  | 'SPAM_DETECTED'
+  // Messaging far above the spam limit; the user is timed out
+  | 'HEAVY_SPAM'
+  // The same message was sent repeatedly; the user is timed out
+  | 'DUPLICATE_SPAM'
+  // Too many characters in a short time; the user is timed out
+  | 'HEAVY_TEXT_SPAM'
+  // Repeated violations; the user is timed out for longer each time
+  | 'REPEAT_OFFENDER'
+  // The chat filter blocked the message
+  | 'MESSAGE_BLOCKED'
+  // A bridge relayed a message that is already in chat
+  | 'ECHO_SUPPRESSED'
+  // The client isn't reading frames fast enough; some were skipped, and the connection closes if it stays behind
+  | 'SLOW_CLIENT'
+  // The server has as many connections as it accepts; retry after details.retryAfterSeconds
+  | 'SERVER_FULL'
+  // The client's address has details.limit connections open, as many as one address may
+  | 'IP_CONNECTION_LIMIT'
+  // The client's address opened connections too quickly; details give the limit, window and when to retry
+  | 'IP_JOIN_RATE_LIMIT'
+  // The server is shutting down and accepts no new connections; retry after details.retryAfterSeconds
+  | 'DRAINING'
+  // The client's protocol version is too old
+  | 'PROTOCOL_UNSUPPORTED'
+  // The frame doesn't match the protocol; fields lists the problems
+  | 'INVALID_FRAME'
+  // The reserved message ID is unknown or expired
+  | 'RESERVATION_NOT_FOUND'
+  // The connection holds details.limit unused message IDs
+  | 'TOO_MANY_RESERVATIONS'
+  // The request needs a valid API token
+  | 'UNAUTHORIZED'
+  // The API token lacks the required scope
+  | 'FORBIDDEN'
+  // The page's origin isn't on the server's allowlist for WebSocket connections
+  | 'ORIGIN_NOT_ALLOWED'
+  // The server doesn't record chat for replay
+  | 'REPLAY_DISABLED'
+  // No chat was recorded for the stream session
+  | 'REPLAY_NOT_FOUND';
+
+// Fields shared by every server frame
+export interface ServerFrameEnvelope {
+  error?: string;
+  code?: ErrorCode;
+  fields?: FieldError[];
+  details?: ErrorDetails;
+  room?: string;
+  timestamp: string;
+}
+
+// Frames a client sends
+export type ClientFrame =
+  | { type: 'hello'; data: HelloFrame }
+  | { type: 'join'; data: JoinFrame }
+  | { type: 'message'; data: ChatFrame }
+  | { type: 'typing'; data: TypingFrame }
+  | { type: 'ping'; data: PingFrame }
+  | { type: 'reserve'; data: ReserveFrame }
+  | { type: 'stats'; data: StatsFrame }
+  | { type: 'ack'; data: AckFrame }
+  | { type: 'join_room'; data: JoinRoomFrame }
+  | { type: 'leave_room'; data: LeaveRoomFrame }
+  | { type: 'history_request'; data: HistoryRequestFrame }
+  | { type: 'set_profile'; data: SetProfileFrame }
+  | { type: 'moderate'; data: ModerateFrame };
+
+// Frames the server sends
+export type ServerFrame = ServerFrameEnvelope & (
+  | { type: 'hello'; data: HelloEvent }
+  | { type: 'history'; data: ChatMessage[] }
+  | { type: 'users'; data: ChatUser[] }
+  | { type: 'message'; data: ChatMessage }
+  | { type: 'message_batch'; data: ChatMessage[] }
+  | { type: 'user_joined'; data: UserEvent }
+  | { type: 'user_left'; data: UserEvent }
+  | { type: 'user_updated'; data: UserEvent }
+  | { type: 'username_assigned'; data: UserEvent }
+  | { type: 'profile'; data: UserProfile }
+  | { type: 'guest'; data: GuestEvent }
+  | { type: 'typing'; data: TypingEvent }
+  | { type: 'system'; data: SystemEvent }
+  | { type: 'timeout'; data: TimeoutEvent }
+  | { type: 'timeout_ended' }
+  | { type: 'room_state'; data: RoomState }
+  | { type: 'room_modes'; data: RoomModes }
+  | { type: 'chat_cleared' }
+  | { type: 'moderation'; data: ModerationEvent }
+  | { type: 'messages_redacted'; data: RedactedEvent }
+  | { type: 'viewer_count_changed'; data: ViewerCountEvent }
+  | { type: 'pong'; data: PongEvent }
+  | { type: 'reserved'; data: ReservedEvent }
+  | { type: 'room_stats'; data: RoomStatsEvent }
+  | { type: 'room_left' }
+  | { type: 'missed'; data: MissedEvent }
+  | { type: 'history_page'; data: HistoryPageEvent }
+  | { type: 'backpressure'; data: BackpressureEvent }
+  | { type: 'drain'; data: DrainEvent }
+  | { type: 'rate_limit' }
+  | { type: 'error' }
+);
@@ -0,0 +1,38 @@
+// Client-side mirror of the room's rate limits, so messages the server would
+// reject are held back instead of sent
+
+import { RoomLimits } from './chatProtocol';
+
+/**
+ * Returns how many milliseconds until a message of the given length would be
+ * accepted, given when our previous messages were sent (oldest first)
+ * Returns 0 when it can be sent now
+ */
+export function sendDelay(
+  sentAt: number[],
+  length: number,
+  limits: RoomLimits | null,
+  slowModeSeconds: number = 0,
+  now: number = Date.now(),
+): number {
+  let delay = 0;
+
+  if (slowModeSeconds > 0 && sentAt.length > 0) {
+    delay = Math.max(delay, sentAt[sentAt.length - 1] + slowModeSeconds * 1000 - now);
+  }
+
+  for (const window of limits?.rateWindows || []) {
+    if (window.minLength && length <= window.minLength) {
+      continue;
+    }
+
+    // Wait for the oldest message counted against the window to leave it
+    const windowMs = window.windowSeconds * 1000;
+    const recent = sentAt.filter((t) => t > now - windowMs);
+    if (recent.length >= window.messages) {
+      delay = Math.max(delay, recent[recent.length - window.messages] + windowMs - now);
+    }
+  }
+
+  return Math.max(0, delay);
+}